@@ -1,23 +1,43 @@
 package main
 
 import (
+	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
 
 	audiostrike "github.com/audiostrike/music/internal"
 	art "github.com/audiostrike/music/pkg/art"
 	flags "github.com/jessevdk/go-flags"
-	"path/filepath"
-	"regexp"
-	"strconv"
 )
 
-var peerAddressRegexp = regexp.MustCompile("^(?P<pubkey>[0-9a-f]+)@(?P<host>[a-z0-9.]+):(?P<port>[0-9]+)$")
+// peerPageSize is how many peers main gets from localStorage at a time to sync from them.
+const peerPageSize = 100
+
+// recentlyReachable is how recently a peer must have synced to be synced from before the other peers.
+const recentlyReachable = 24 * time.Hour
+
+// playbackMutex lets one peer's tracks play at a time while syncing from several peers at once.
+var playbackMutex sync.Mutex
 
 // main runs austk with config from command line, austk.config file, or defaults. `-help` for help:
 //
 //     go/src/github.com/audiostrike/music$ ./austk -help
 //
+// Settings may also come from a JSON config file, `-configfile {path}`, keyed by flag name,
+// e.g. `{"artist": "aliceinchains", "dbengine": "mysql", "lndtimeout": "1m"}`. Its settings override austk.config,
+// and flags override both. Unknown keys are logged and ignored. `-dumpconfig` prints the resolved config
+// as such a file, with passwords shown as `***`, then exits.
+//
 // Setup your computer to run `austk` to serve music with the steps at
 // https://github.com/audiostrike/music/wiki/austk-node-setup
 // bitcoind may take several days for initial block download to sync to bitcoin mainnet blockchain.
@@ -26,318 +46,1074 @@ var peerAddressRegexp = regexp.MustCompile("^(?P<pubkey>[0-9a-f]+)@(?P<host>[a-z
 //
 //     go/src/github.com/audiostrike/music$ ./austk -artist aliceinchains
 //
+// By default, austk stores art in files under the `-dir` directory.
+// Store the track payloads elsewhere with `-payloaddir {path}`, e.g. on a big HDD with the rest of the art on an SSD.
+// To store art in a database instead, select the engine with `-dbengine sqlite`, `mysql`, or `postgres`.
+// sqlite keeps the database in the `-dbfile {path}` file.
+// mysql and postgres connect to `-dbname {name}` at `-dbhost {host}` and `-dbport {port}`.
+// `-dbengine memory` keeps art only in memory until austk exits, e.g. for an ephemeral seed node in a demo.
 // The node setup steps create a mysql db user for `austk` to use.
 // Specify that mysql username with `-dbuser {username}` and password with `-dbpass {password}`.
 // On first run, also initialize the database with `-dbinit`:
 //
-//     go/src/github.com/audiostrike/music$ ./austk -artist aliceinchains
+//     go/src/github.com/audiostrike/music$ ./austk -artist aliceinchains -dbengine mysql
 //     -dbuser examplemysqlusername -dbpass 3x4mpl3mysqlp455w0rd -dbinit
 //
-// Add mp3 files to the art directory with `-add {filepath}`:
+// With a database, a cloud-hosted node may store the track payloads in a bucket of an S3-compatible service,
+// e.g. AWS S3 or MinIO, with `-s3endpoint {url}` and `-s3bucket {bucket}` (created by `-dbinit` if missing),
+// `-s3region {region}` outside us-east-1, and credentials `-s3accesskey` or AUSTK_S3_ACCESS_KEY
+// and AUSTK_S3_SECRET_KEY, which austk reads only from the environment, not from flags or config files.
+// austk streams the payloads it serves from the bucket, giving up on any S3 request after 10 minutes,
+// and reanalyzes, previews, plays and verifies them through private temporary copies:
+//
+//     go/src/github.com/audiostrike/music$ AUSTK_S3_ACCESS_KEY=minioadmin AUSTK_S3_SECRET_KEY=minioadmin
+//     ./austk -artist aliceinchains -dbengine sqlite -s3endpoint http://localhost:9000 -s3bucket austk -dbinit
+//
+// Or, with a database, pin the payloads of free tracks in a local IPFS node, e.g. kubo, with `-ipfsapi {url}`
+// so the IPFS network helps distribute them. Each free track records the CID of its payload, published with its hash.
+// A payload pinned in IPFS is public to anyone with its CID, so the payloads of paid tracks stay in files,
+// and the CID of a track priced after its payload was pinned is no longer published.
+// A node configured with `-ipfsapi`, or else with an IPFS gateway such as `-ipfsgateway https://ipfs.io`,
+// fetches the payloads of synced tracks by their CIDs, and from the peer that published them
+// if that fails or fetches bytes that do not match the published hash:
+//
+//     go/src/github.com/audiostrike/music$ ./austk -artist aliceinchains -dbengine sqlite
+//     -ipfsapi http://127.0.0.1:5001 -dbinit
+//
+// Add mp3, flac, ogg (Vorbis), opus, or wav files to the art directory with `-add {filepath}`,
+// optionally with a price in satoshis with `-price {sats}`.
+// Use `-albumprice {sats}` to price the other tracks on its album, otherwise `-defaultprice` applies:
 //
 //     go/src/github.com/audiostrike/music$ ./austk -artist aliceinchains
-//     -add /media/recordings/dirt/would.mp3
+//     -add /media/recordings/dirt/would.mp3 -price 2000
+//
+// Set `defaultprice = {sats}` in austk.config to price every track without its own or its album's price.
+// `-defaultprice {sats}` on the command line overrides austk.config, which overrides the 1000 sat default.
+// A default price of 0 makes those tracks free to download without an invoice.
+// An unpaid invoice for a track expires after 15 minutes, long enough to pay over tor,
+// or as configured with `-invoiceexpiry {seconds}`. austk records the tracks each invoice sells with the art,
+// so a buyer's preimage still gets them after austk restarts, and forgets invoices a day after they expire unpaid.
+// Its memo reads `{artistId}/{trackId} by {artistName}`,
+// or as templated with `-invoicememo`, e.g. `-invoicememo "{trackTitle} ({albumId}) by {artistName}, {sats} sats"`.
+// The template may use `{artistName}`, `{artistId}`, `{trackTitle}`, `{trackId}`, `{albumId}`, and `{sats}`;
+// austk refuses to start with any other field.
+// Peers buy all the priced tracks of an album with one invoice from `POST /albuminvoice/{artist id}/{album id}`,
+// whose preimage gets each track it lists. Its memo fills `{trackTitle}` with the album title.
+//
+// Add `-transcode flac` to store wav files as flac, encoded by the `flac` command, to save space.
+// Tracks record both the format added and the format stored. Without `-transcode`, wav files are stored as added.
+//
+// Add every mp3, flac, ogg, opus, and wav file under a directory with `-add {dirpath}`.
+// Tracks already stored with the same audio are skipped, and a summary lists any files that failed.
+// A file with different audio than the track stored for the same artist and title fails
+// unless added with `-force`, which also stores again the tracks that would be skipped.
+// Cover art embedded in the files is stored for their album, preferring a front cover picture,
+// and served at /cover/{artist}/{album} for peers to display the album if it is a jpeg, png, gif, or webp image.
+// An album's id is its title lowercased without spaces or punctuation, split into levels at each `/`,
+// e.g. `anthology/disc1` for "Anthology / Disc 1", or at the text set with `-albumseparator`, e.g. `-albumseparator " - "`.
+// A different album whose title makes the same id, e.g. "Live?" after "Live!", gets the id with `-2` added, and so on.
+// A track of an album already stored joins it under the id it was stored with, even after changing `-albumseparator`.
+//
+// The loudness of each added track is measured for players to normalize volume, and its duration for players
+// to show. Measure tracks added before loudness or duration were measured with `-reanalyze`.
+//
+// The first `-preview {seconds}` (default 30, 0 for none) of each added track are clipped as a wav file
+// served free at /preview/{artist}/{track}, so listeners can hear a track before buying it.
+// A preview is at most a third of its track, so a short track is never given away whole.
+// Clip the previews of stored tracks again, e.g. of tracks added before previews or to change their length,
+// with `-repreview`:
+//
+//     go/src/github.com/audiostrike/music$ ./austk -artist aliceinchains -preview 45 -repreview
+//
+// Add `-dryrun` to print the tags and the artist, album, and track ids that `-add` would store
+// without storing anything. austk exits nonzero if it cannot read the file.
 //
 // To serve added tracks, run as a daemon with the `-daemon` flag.
-// Publish your austk node's tor address with `-host {address}`.
+// Publish your austk node's tor address with `-host {address}` and `-port {port}` (default 53545).
+// The daemon binds that port on all interfaces, or binds `-listen {ip}` and `-listenport {port}` instead,
+// e.g. `-listen 127.0.0.1` where the tor hidden service of `-host` maps its port.
 // Connect securely with your `lnd` through `-macaroon` and `-tlscert`.
+// In a container, pass them as base64 in `AUSTK_MACAROON_BASE64` and `AUSTK_TLS_CERT_BASE64` instead,
+// e.g. `AUSTK_MACAROON_BASE64=$(base64 admin.macaroon)`, which override config files but not flags.
+// The macaroon is refused as the flag `-macaroonbase64`, where other users of the host could read it.
+// Set the bitcoin network of your `lnd` with `-network regtest` (the default), `testnet`, or `mainnet`,
+// which picks its default macaroon, `~/.lnd/data/chain/bitcoin/{network}/admin.macaroon`.
+// Limit what a leaked macaroon allows by giving calls macaroons of narrower scope:
+// `-invoicemacaroon ~/.lnd/data/chain/bitcoin/mainnet/invoice.macaroon` creates and looks up invoices,
+// `-readonlymacaroon ~/.lnd/data/chain/bitcoin/mainnet/readonly.macaroon` gets lnd's info, verifies signatures,
+// and looks up payments, and `-signmacaroon {file}`, baked with `lncli bakemacaroon message:write`, signs publications.
+// Other calls, such as paying invoices, use `-macaroon`. austk refuses to start if `lnd` denies a scoped macaroon
+// for a call that changes nothing, so it adds no invoice to check `-invoicemacaroon`.
+// Each call to `lnd` gives up after 30 seconds, or as configured with `-lndtimeout {duration}`, e.g. `-lndtimeout 1m`,
+// except payments, which wait for lnd to settle or fail them so that a slow payment is never sent again.
+// If `lnd` restarts, austk re-dials it, backing off up to 30 seconds between dials, and retries the calls
+// that are safe to repeat; it does not retry adding an invoice or sending a payment.
+// While `lnd` is unavailable, invoices and streams fail with 503 Service Unavailable and "lnd unavailable".
+// A daemon whose artists are stored starts while `lnd` is unreachable, with the pubkey stored for its artist,
+// and signs and sells once austk reconnects to `lnd`. A daemon that cannot reach `lnd` to store its artist
+// still starts, offline: it serves the catalog and previews it has, but neither signs, syncs, nor sells
+// until it restarts with `lnd`. Commands that need `lnd` still fail.
 //
 //     go/src/github.com/audiostrike/music$ ./austk -artist aliceinchains
 //     -dbuser examplemysqlusername -dbpass 3x4mpl3mysqlp455w0rd
-//     -macaroon ~/.lnd/data/chain/bitcoin/mainnet/admin.macaroon -tlscert ~/.lnd/tls.cert
+//     -network mainnet -tlscert ~/.lnd/tls.cert
 //     -host 45o4k7vt75tgh4zwbkxl5ec6ccagaulr273piugh3tt2cfmcawzeiwqd.onion -daemon
 //
+// Print the version, git commit, and build date of austk with `-version`. Builds inject them with ldflags:
+//
+//     go/src/github.com/audiostrike/music$ go build -ldflags "-X github.com/audiostrike/music/internal.Version=v0.4.0
+//     -X github.com/audiostrike/music/internal.Commit=$(git rev-parse --short HEAD)
+//     -X github.com/audiostrike/music/internal.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/austk
+//
+// The daemon logs its version on start and names it in each reply and request to peers as `X-Austk-Version`,
+// warning of a peer whose version differs in major version (or, before v1, in minor version).
+// Each sync starts with a handshake at `POST /handshake`, in which the peers agree on the sync protocol version
+// and features they have in common. A peer from before the handshake is synced in full each time;
+// a peer speaking no version in common is refused.
+// Each artist hosted by a node publishes its art in its own publication, signed by that artist, so a change
+// to one artist's art re-signs only that publication. Peers that support it list the publications at
+// `GET /publications` and serve each from `GET /publication/{artist id}`, and a sync gets only those
+// updated since their last sync.
+// Each publication is stamped with a sequence that increases whenever the art changes. austk remembers the latest
+// sequence validated from each artist pubkey and refuses an older publication, e.g. one replayed by a relay
+// to hide a takedown, as it refuses art the artist did not sign.
+// Peers that support it serve their art compressed with `-synccompression {codec}`: gzip (default), zstd, or none.
+// Track payloads, already compressed audio, are served as they are.
+//
+// The daemon answers `GET /healthz` with its version while running and `GET /readyz` while lnd and storage are reachable,
+// e.g. for systemd or k8s probes. While reconnecting to lnd, `/readyz` says since when lnd has been unavailable.
+// Browsers that open the daemon's address get a web player at `/`, while peers get the art there as before.
+// It lists the recently added tracks, plays their previews and free tracks, and plays a track once its invoice
+// is paid and the preimage pasted. Unlocking it with the `-admintoken` or the hex lnd macaroon, choosing which,
+// lets an admin delete tracks from it too. Tracks and previews are served with the mime type of their audio and in any byte range
+// requested, so the player can seek in them.
+// It serves its version, whether it is syncing, and when it last synced from its peers and syncs next
+// as JSON at `GET /status`.
+//
+// Admins may stream the daemon's events (syncs started and finished, invoices created, payments settled,
+// and peers added) as server-sent events from `GET /events`, authenticated by `Authorization: Bearer {token}`
+// with the `-admintoken` (or `AUSTK_ADMIN_TOKEN`), or by the hex of the lnd macaroon in `Grpc-Metadata-Macaroon`.
+//
+//     $ curl -N -H "Authorization: Bearer $AUSTK_ADMIN_TOKEN" --socks5-hostname localhost:9050 http://{onion}:53545/events
+//
+// Admins may delete a track and its payload with `DELETE /art/{artist id}/{track id}`, or an album and its cover art
+// with `DELETE /album/{artist id}/{album id}`, which refuses an album with tracks unless given `?cascade=true`
+// to delete its tracks too. The daemon then publishes its art again without them, with a tombstone of each
+// deleted track and album signed by its artist. Peers that synced the art delete their copies when they sync
+// the tombstones, and refuse an older publication replayed to restore it. Tombstones are published for 90 days,
+// so a peer that has not synced for longer keeps its copies of art deleted before.
+// Admins may retitle a track or move it to another album with `PATCH /art/{artist id}/{track id}` given form values
+// `title` and/or `album`, e.g. `curl -X PATCH -d title=Intro -d album=Demos ...`. A track whose id changes keeps
+// its payload under the new id, which is in the `Location` of the reply, unless another track has that id,
+// and leaves a tombstone of its old id.
+//
+// Serve prometheus metrics of syncs, payments, and downloads at `/metrics` on a separate port with `-metrics {port}`.
+//
+// The daemon syncs from its peers at startup, then again every `-syncinterval {duration}`, e.g. `-syncinterval 30m`,
+// skipping a sync while the previous one is still running. Without `-syncinterval` it syncs only at startup.
+// Cap the bytes of track payloads stored with `-maxstorage {bytes}`. After each sync, austk evicts the payloads
+// of synced tracks least recently played (or, if never played, least recently downloaded) until the payloads fit,
+// keeping their art to download them again, and `GET /art/{artist}/{track}` answers 404 for an evicted payload.
+// Any range of a track served counts as playing it. The tracks of the hosted artists are never evicted.
+// `GET /status` lists the bytes stored and left under `-maxstorage`.
+// austk syncs from up to `-syncworkers {count}` peers at once (default 4). SIGINT while syncing stops
+// syncing from more peers but lets the syncs under way finish.
+// SIGINT stops the daemon from accepting connections, then it waits for downloads and streams in flight
+// to finish for up to `-shutdowntimeout {duration}` (default 30s). A second SIGINT closes them at once.
+// Peers synced within the last day are synced first, most recent first. The daemon serves when each
+// stored peer was last seen and last synced as JSON at `GET /peers/catalog`.
+// It serves each artist's albums and tracks as JSON at `GET /artist/{artist id}/catalog`, tagged with an `ETag`
+// so web clients that poll it with `If-None-Match` get 304 Not Modified until the catalog changes.
+// It lists the tracks most recently added to the node by any artist, newest first, at `GET /recent?limit={count}`
+// (default 20, at most 100).
+//
+// The daemon throttles each connection, and each peer of a private node by the pubkey it proves,
+// past `-ratelimit {requests/s}` (default 20) or `-bandwidthlimit {bytes/s}` (default 8 MiB/s)
+// with 429 Too Many Requests. 0 is no limit.
+// It counts the bytes downloaded and streamed by each peer, by the pubkey it proves to a private node
+// or else by its address, listed at `GET /peers/catalog`, and stores them each minute and at shutdown.
+// It refuses a peer served `-peerquota {bytes}` in a month, reset with `-quotaperiod calendar` (the default)
+// on the first of each month or counted over the last 30 days with `-quotaperiod rolling`.
+//
+// Keep a node private with `-allowpeer {pubkey}` for each peer allowed to sync from it. A private node serves
+// its art only to those peers, each proving its pubkey by signing a challenge from `POST /challenge` with its lnd,
+// and replies 403 Forbidden to other peers. Without `-allowpeer` the node serves every peer.
+// The signature binds a session key agreed with the node, which keys a mac of each numbered request,
+// so an eavesdropper on a peer dialed without tor cannot replay or alter its requests.
+// A session lasts an hour, and a challenge not answered within a minute expires.
+//
+// After syncing from the stored peers, austk syncs from the peers they gossip that are not stored yet, and so on,
+// up to `-maxpeerhops {hops}` away (default 2). A gossiped peer is stored once it is reached and synced,
+// until `-maxpeers {count}` peers are stored (default 100). Each sync dials at most `-maxpeerdials {count}`
+// gossiped peers (default 20), skipping one that did not answer for an hour, doubling with each further try.
+//
+// Tip the artist of a peer by keysend with `-tip {sats}` and `-peer {pubkey}@{host}:{port}`.
+// The `-peer` host may be a v3 onion address, an IPv4 address, an IPv6 address in brackets,
+// e.g. `-peer {pubkey}@[2001:db8::7]:53545`, or a host name; austk names the malformed part of any other address.
+// Check whether `lnd` was paid for an invoice with `-invoice {hash}`, or whether it sent a payment,
+// e.g. for a download or tip, with `-payment {hash}`. Each prints its state and amount, then austk exits.
+//
+// Log less or more with `-loglevel error`, `warn`, `info` (the default), or `debug`.
+// Each log record is a line of key=value fields, labelled with the component that logged it.
+//
+// Find stored artists and tracks, including those synced from peers, with `-search {text}`:
+//
+//     go/src/github.com/audiostrike/music$ ./austk -search would
+//
+// Search only for tracks tagged with a genre with `-genre {genre}`, or released in a year or range of years
+// with `-years {year}` or `-years {from}-{to}`. Either may be given without `-search` to list every such track:
+//
+//     go/src/github.com/audiostrike/music$ ./austk -genre grunge -years 1990-1994
+//
+// Create a playlist of tracks by any artists with `-playlist {title}` and a `-track {artist}/{track}` for each track.
+// Peers that sync the playlist also sync the artists of its tracks that they do not have yet:
+//
+//     go/src/github.com/audiostrike/music$ ./austk -artist aliceinchains -playlist Grunge
+//     -track aliceinchains/dirt/would -track soundgarden/superunknown/blackholesun
+//
+// Carry art between nodes without a network route, e.g. on a USB stick: write the signed publication of the
+// stored art to a file with `-export {path}`, then validate and store it on the other node with `-import {path}`:
+//
+//     go/src/github.com/audiostrike/music$ ./austk -artist aliceinchains -export /media/usb/aliceinchains.pb
+//     go/src/github.com/audiostrike/music$ ./austk -artist bob -import /media/usb/aliceinchains.pb
+//
+// Sign the publication with a key kept on an air-gapped node: write the stored art unsigned with
+// `-preparesigning {path}`, sign it on the air-gapped node with `-signprepared {path}`, which writes `{path}.sig`,
+// then publish it with the signature on the serving node with `-attachsignature {path}`:
+//
+//     go/src/github.com/audiostrike/music$ ./austk -artist aliceinchains -preparesigning /media/usb/art.pb
+//     airgapped$ ./austk -artist aliceinchains -signprepared /media/usb/art.pb
+//     go/src/github.com/audiostrike/music$ ./austk -artist aliceinchains -attachsignature /media/usb/art.pb
+//
+// After rotating the identity key of lnd, publications signed with the old key no longer validate,
+// so the daemon refuses to start while a hosted artist is stored with another pubkey than lnd's.
+// Peers accept the new pubkey of an artist they stored only if the old key linked to it, so before rotating,
+// print the signature linking lnd's old key to the new node's pubkey with `-linkpubkey {new pubkey}`.
+// Then, with the new key, sign the art of each hosted artist again, and store that key as the artist's pubkey
+// with the link, with `-resign -pubkeylinksig {signature}`. Peers that sync the new publications check the link,
+// accept the pubkey change, and sync all the art again. Each artist's publications signed with its old pubkey are removed:
+//
+//     go/src/github.com/audiostrike/music$ ./austk -artist aliceinchains -linkpubkey 03b0...e1
+//     go/src/github.com/audiostrike/music$ ./austk -artist aliceinchains -resign -pubkeylinksig d8b4...9z
+//
+// List the stored peers with when each was last seen and last synced, and how many times it failed since,
+// with `-listpeers`. Remove a peer with `-removepeer {pubkey}`, or every peer not synced within a duration
+// with `-prunepeers {duration}`, e.g. `-prunepeers 720h`. Either publishes the art again without the removed peers,
+// which may be stored again if other peers still gossip them. The node's own peer is never removed:
+//
+//     go/src/github.com/audiostrike/music$ ./austk -artist aliceinchains -listpeers
+//     go/src/github.com/audiostrike/music$ ./austk -artist aliceinchains -prunepeers 720h
+//
+// Print the plays and purchases of the most played tracks with `-stats {count}`. Each stream started,
+// whole download served, and invoice settled is counted on this node only, not published with the art.
+// A running node stores its counts every minute and as it stops, so `-stats` may miss the last minute's.
+// Add `-catalogstats` to list each track's counts in the JSON catalog too.
+//
+//     go/src/github.com/audiostrike/music$ ./austk -stats 10
+//
+// Check stored art with `-verify` for tracks without payloads, albums without tracks,
+// and payload files without tracks. austk exits nonzero if it finds any.
+// Add `-repair` to remove the payload files without tracks.
+// If the art records drift from the payload files, e.g. after copying files into `-payloaddir` by hand,
+// rebuild them with `-reindex`. It stores a track, with its album and artist, for each payload file of a hosted
+// artist that has none, from the file's tags or else its path, and corrects the format of stored tracks
+// from their files. Then it publishes the changed artists and prints what it changed. Running it again changes
+// nothing. It keeps tracks without payload files, and payload files of other artists, which their nodes publish.
+// It reports stored tracks whose payload files have another hash, e.g. replaced or corrupted, and keeps their
+// signed hash unless you add `-rehash` to overwrite it with the hash of the file.
+// Merge a duplicate artist, e.g. "alice-in-chains" imported from files tagged "Alice-In-Chains", into the artist
+// it duplicates, e.g. "aliceinchains", with `-mergeartist {from artist id}/{to artist id}`. Its albums, cover art,
+// tracks, payloads, previews, and stats move to the other artist, with track ids kept, and playlists list its tracks
+// under the other artist.
+// Then both artists are published again, with tombstones of the moved art for peers to delete their copies.
+// austk refuses to merge into an artist not stored or not published by this node, from an artist of another node,
+// or onto a track id the other artist has. A merge that fails partway is undone.
+//
+//     go/src/github.com/audiostrike/music$ ./austk -mergeartist alice-in-chains/aliceinchains
+//
 func main() {
-	const logPrefix = "austk main "
-
 	cfg, err := audiostrike.LoadConfig()
 	if err != nil {
-		isShowingHelp := (err.(*flags.Error).Type == flags.ErrHelp)
+		var flagsErr *flags.Error
+		isShowingHelp := errors.As(err, &flagsErr) && flagsErr.Type == flags.ErrHelp
 		if isShowingHelp {
 			return
 		}
-		log.Fatalf(logPrefix+"LoadConfig error: %v", err)
+		fmt.Fprintf(os.Stderr, "austk: %v\n", err)
+		os.Exit(1)
 	}
+	if cfg.ShowVersion {
+		fmt.Println("austk " + audiostrike.VersionString())
+		return
+	}
+	// Components built without cfg log through the default logger, so log them at -loglevel too.
+	slog.SetDefault(cfg.Logger)
+	logger := cfg.Logger.With("component", "main")
+	logger.Debug("loaded config", "config", cfg)
+	// Cancelling ctx cancels the calls to lnd made for this run, e.g. to pay for synced tracks.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	localStorage, err := audiostrike.NewFileServer(cfg.ArtDir)
-	if err != nil {
-		log.Fatalf(logPrefix+"Failed to open data dir %s, error: %v", cfg.ArtDir, err)
+	if cfg.DumpConfig {
+		err = cfg.WriteJSON(os.Stdout)
+		if err != nil {
+			fatal(logger, "failed to print config", "error", err)
+		}
+		return
 	}
 
+	if cfg.DryRun {
+		err = printAudioFileArt(cfg.AddMp3Filename)
+		if err != nil {
+			fatal(logger, "failed to read audio file", "path", cfg.AddMp3Filename, "error", err)
+		}
+		return
+	}
+
+	if cfg.MetricsPort != 0 {
+		go serveMetrics(logger, cfg.MetricsPort)
+	}
+
+	var localStorage audiostrike.ArtServer
+	if cfg.DbEngine == "" {
+		localStorage, err = injectFileServer(cfg)
+		if err != nil {
+			fatal(logger, "failed to open data dir", "path", cfg.ArtDir, "error", err)
+		}
+	} else if cfg.DbEngine == audiostrike.DbEngineMemory {
+		localStorage = audiostrike.NewMemoryArtServer()
+	} else {
+		localStorage, err = injectDbServer(cfg)
+		if err != nil {
+			fatal(logger, "failed to open db", "db_engine", cfg.DbEngine, "error", err)
+		}
+	}
+
+	if cfg.Search != "" || cfg.Genre != "" || cfg.Years != "" {
+		filter := audiostrike.TrackFilter{Genre: cfg.Genre}
+		if cfg.Years != "" {
+			filter.MinYear, filter.MaxYear, err = audiostrike.ParseYearRange(cfg.Years)
+			if err != nil {
+				fatal(logger, "failed to parse -years", "years", cfg.Years, "error", err)
+			}
+		}
+		err = printSearchResults(cfg.Search, filter, localStorage)
+		if err != nil {
+			fatal(logger, "failed to search", "query", cfg.Search, "error", err)
+		}
+		return
+	}
+
+	if cfg.Stats > 0 {
+		err = printTopTracks(cfg.Stats, localStorage)
+		if err != nil {
+			fatal(logger, "failed to get track stats", "error", err)
+		}
+		return
+	}
+
+	if cfg.ListPeers {
+		err = printPeers(cfg.ArtistID, localStorage)
+		if err != nil {
+			fatal(logger, "failed to list peers", "error", err)
+		}
+		return
+	}
+
+	if cfg.Verify {
+		report, err := audiostrike.VerifyArt(localStorage, cfg.PayloadDir, cfg.Repair)
+		if err != nil {
+			fatal(logger, "failed to verify art", "path", cfg.PayloadDir, "error", err)
+		}
+		fmt.Println(report)
+		if !report.OK() {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Commands that sign, invoice, or pay need lnd, while a daemon can still serve its catalog without it.
+	needsLnd := cfg.AddMp3Filename != "" || cfg.Reanalyze || cfg.Repreview || cfg.Playlist != "" ||
+		cfg.ImportFilename != "" || cfg.ExportFilename != "" || cfg.SignPreparedFilename != "" ||
+		cfg.AttachSignatureFilename != "" || cfg.Resign || cfg.LinkPubkey != "" || cfg.Reindex || cfg.MergeArtist != "" || cfg.RemovePeer != "" || cfg.PrunePeers > 0 ||
+		cfg.InvoiceHash != "" || cfg.PaymentHash != ""
+	var publisher audiostrike.Publisher
 	lightning, err := audiostrike.NewLightningNode(cfg, localStorage)
+	if errors.Is(err, audiostrike.ErrLndUnavailable) && !needsLnd {
+		logger.Warn("serve the catalog and previews offline, without signing or payments, until austk restarts with lnd",
+			"error", err)
+		publisher, err = audiostrike.NewOfflinePublisher(cfg, localStorage, err)
+	} else {
+		publisher = lightning
+	}
 	if err != nil {
-		log.Fatalf(logPrefix+"Failed to connect with Lightning node, error: %v", err)
+		fatal(logger, "failed to connect with lightning node", "error", err)
+	}
+
+	if cfg.InvoiceHash != "" || cfg.PaymentHash != "" {
+		err = printPaymentStatus(ctx, cfg.InvoiceHash, cfg.PaymentHash, lightning)
+		if err != nil {
+			fatal(logger, "failed to look up payment status", "error", err)
+		}
+		return
 	}
 
-	austkServer, err := injectPublisher(cfg, localStorage, lightning)
+	austkServer, err := injectPublisher(cfg, localStorage, publisher)
 	if err != nil {
-		if cfg.AddMp3Filename != "" || cfg.RunAsDaemon {
-			log.Fatalf(logPrefix+"Failed to connect to lightning network, error: %v", err)
+		if needsLnd || cfg.RunAsDaemon {
+			fatal(logger, "failed to connect to lightning network", "error", err)
 		} else {
-			log.Printf(logPrefix+"failed to connect to lightning network, error: %v", err)
+			logger.Warn("failed to connect to lightning network", "error", err)
 		}
 	}
 	injectedArtist, _ := austkServer.Artist()
-	log.Printf(logPrefix+"injected lnd into new austk server for artist %v", injectedArtist)
+	logger.Info("injected lnd into new austk server", "artist_id", injectedArtist.GetArtistId())
+
+	if cfg.LinkPubkey != "" {
+		linkSignature, err := austkServer.LinkPubkey(cfg.LinkPubkey)
+		if err != nil {
+			fatal(logger, "failed to link pubkey", "pubkey", cfg.LinkPubkey, "error", err)
+		}
+		fmt.Println(linkSignature)
+		return
+	}
 
 	if cfg.AddMp3Filename != "" {
-		mp3, err := storeMp3File(cfg, cfg.AddMp3Filename, localStorage, austkServer)
+		fileInfo, err := os.Stat(cfg.AddMp3Filename)
+		if err == nil && fileInfo.IsDir() {
+			report, err := austkServer.ImportDirectory(cfg.AddMp3Filename)
+			if err != nil {
+				fatal(logger, "failed to import directory", "path", cfg.AddMp3Filename, "error", err)
+			}
+			fmt.Println(report)
+		} else {
+			audio, result, err := austkServer.ImportAudioFile(cfg.AddMp3Filename)
+			if err != nil {
+				fatal(logger, "failed to import audio file", "path", cfg.AddMp3Filename, "error", err)
+			}
+			if result == audiostrike.ImportSkipped {
+				fmt.Printf("skipped %s already stored with the same audio (add with -force to store it again)\n",
+					cfg.AddMp3Filename)
+			} else {
+				logger.Info("imported audio file", "path", cfg.AddMp3Filename)
+			}
+
+			if cfg.PlayMp3 {
+				audio.PlayAndWait()
+			}
+		}
+	}
+
+	if cfg.Reindex {
+		report, err := austkServer.Reindex(cfg.Rehash)
 		if err != nil {
-			log.Fatalf(logPrefix+"storeMp3File error: %v", err)
+			fatal(logger, "failed to reindex payloads", "path", cfg.PayloadDir, "error", err)
 		}
-		log.Printf(logPrefix+"storeMp3File %s ok", cfg.AddMp3Filename)
+		fmt.Println(report)
+	}
 
-		if cfg.PlayMp3 {
-			mp3.PlayAndWait()
+	if cfg.MergeArtist != "" {
+		fromID, toID, err := audiostrike.ParseArtistMerge(cfg.MergeArtist)
+		if err != nil {
+			fatal(logger, "failed to parse artist merge", "error", err)
 		}
+		err = austkServer.MergeArtist(fromID, toID)
+		if err != nil {
+			fatal(logger, "failed to merge artist", "artist_id", fromID, "to_artist_id", toID, "error", err)
+		}
+		logger.Info("merged artist", "artist_id", fromID, "to_artist_id", toID)
 	}
 
-	if cfg.RunAsDaemon {
-		log.Println(logPrefix + "Starting Audiostrike server...")
-		err = startServer(cfg, localStorage, austkServer)
+	if cfg.Reanalyze {
+		measured, err := austkServer.ReanalyzeTracks()
 		if err != nil {
-			log.Fatalf(logPrefix+"startServer daemon error: %v", err)
+			fatal(logger, "failed to reanalyze tracks", "error", err)
 		}
-		defer austkServer.Stop()
+		logger.Info("reanalyzed tracks", "tracks", measured)
+	}
 
-		cfg.Pubkey, err = austkServer.Pubkey()
+	if cfg.Repreview {
+		regenerated, err := austkServer.RegeneratePreviews()
 		if err != nil {
-			log.Fatalf(logPrefix+"error getting server pubkey: %v", err)
+			fatal(logger, "failed to regenerate previews", "error", err)
 		}
+		logger.Info("regenerated previews", "tracks", regenerated)
 	}
 
-	if cfg.PeerAddress != "" {
-		peerAddressGroups := peerAddressRegexp.FindStringSubmatch(cfg.PeerAddress)
-		if peerAddressGroups == nil {
-			log.Fatalf(logPrefix+"Failed to parse peer address (pubkey@host:port) from %s", cfg.PeerAddress)
+	if cfg.Playlist != "" {
+		playlist, err := austkServer.CreatePlaylist(cfg.Playlist, cfg.Tracks)
+		if err != nil {
+			fatal(logger, "failed to create playlist", "title", cfg.Playlist, "error", err)
 		}
-		peerPubkey := peerAddressGroups[1]
-		peerHost := peerAddressGroups[2]
-		peerPortString := peerAddressGroups[3]
-		peerPortUint, err := strconv.ParseUint(peerPortString, 10, 32)
+		logger.Info("created playlist", "playlist_id", playlist.ArtistPlaylistId, "tracks", len(playlist.Tracks))
+	}
+
+	if cfg.Resign {
+		rotatedArtistIDs, err := austkServer.ResignPublications(cfg.PubkeyLinkSignature)
 		if err != nil {
-			log.Fatalf(logPrefix+"error reading peer port \"%s\" as decimal, error: %v", peerPortString, err)
+			fatal(logger, "failed to re-sign publications", "error", err)
 		}
-		peerPort := uint32(peerPortUint)
-		peer := art.Peer{Pubkey: peerPubkey, Host: peerHost, Port: peerPort}
-		err = localStorage.StorePeer(&peer, austkServer)
+		logger.Info("re-signed publications", "rotated_artist_ids", rotatedArtistIDs)
+	}
+
+	if cfg.RemovePeer != "" {
+		err = austkServer.RemovePeer(cfg.RemovePeer)
 		if err != nil {
-			log.Fatalf(logPrefix+"failed to store configured peer %s, error: %v", cfg.PeerAddress, err)
+			fatal(logger, "failed to remove peer", "peer", cfg.RemovePeer, "error", err)
 		}
 	}
 
-	peers, err := localStorage.Peers()
-	if err != nil {
-		log.Printf(logPrefix+"failed to get Peers from localStorage, error: %v", err)
+	if cfg.PrunePeers > 0 {
+		prunedPubkeys, err := austkServer.PrunePeers(cfg.PrunePeers)
+		if err != nil {
+			fatal(logger, "failed to prune peers", "error", err)
+		}
+		for _, pubkey := range prunedPubkeys {
+			fmt.Printf("removed peer %s\n", pubkey)
+		}
+		logger.Info("pruned peers", "peers", len(prunedPubkeys))
 	}
-	for _, peer := range peers {
-		if peer.Pubkey == cfg.Pubkey && peer.Host == cfg.RestHost {
-			log.Printf(logPrefix+"skip sync from self pubkey %v", peer)
-			continue // to next peer
+
+	if cfg.ImportFilename != "" {
+		_, err = austkServer.ImportPublication(cfg.ImportFilename)
+		if err != nil {
+			fatal(logger, "failed to import publication", "path", cfg.ImportFilename, "error", err)
 		}
-		log.Printf(logPrefix+"sync from peer %v", peer)
-		peerAddress := fmt.Sprintf("%s:%d", peer.Host, peer.Port)
+	}
 
-		client, err := audiostrike.NewClient(cfg.TorProxy, peerAddress, austkServer)
+	if cfg.ExportFilename != "" {
+		_, err = austkServer.ExportPublication(injectedArtist.GetArtistId(), cfg.ExportFilename)
 		if err != nil {
-			log.Fatalf(logPrefix+"NewClient via torProxy %v to peerAddress %v, error: %v",
-				cfg.TorProxy, peer.Host, err)
+			fatal(logger, "failed to export publication", "path", cfg.ExportFilename, "error", err)
 		}
+	}
 
-		resources, err := client.SyncFromPeer(localStorage)
+	if cfg.PrepareSigningFilename != "" {
+		err = austkServer.PrepareSigningFile(cfg.PrepareSigningFilename)
 		if err != nil {
-			// Log misbehaving peer but continue with other peers.
-			log.Printf(logPrefix+"SyncFromPeer error: %v", err)
-			client.CloseConnection()
-			continue
+			fatal(logger, "failed to prepare art to sign", "path", cfg.PrepareSigningFilename, "error", err)
 		}
+	}
 
-		if cfg.PlayMp3 {
-			tracks := resources.Tracks
-			log.Printf("download %d tracks to play...", len(tracks))
-			err = client.DownloadTracks(tracks, localStorage)
-			if err != nil {
-				log.Printf(logPrefix+"DownloadTracks error: %v", err)
-			}
-			err = playTracks(tracks, localStorage)
-		} else {
-			log.Printf("will not play tracks")
+	if cfg.SignPreparedFilename != "" {
+		err = austkServer.SignPreparedFile(injectedArtist.GetArtistId(), cfg.SignPreparedFilename)
+		if err != nil {
+			fatal(logger, "failed to sign prepared art", "path", cfg.SignPreparedFilename, "error", err)
 		}
+	}
 
-		client.CloseConnection()
+	if cfg.AttachSignatureFilename != "" {
+		_, err = austkServer.AttachSignatureFile(cfg.AttachSignatureFilename)
+		if err != nil {
+			fatal(logger, "failed to attach signature", "path", cfg.AttachSignatureFilename, "error", err)
+		}
 	}
 
 	if cfg.RunAsDaemon {
-		// Execution will stop in this function until server quits from SIGINT etc.
-		austkServer.WaitUntilQuitSignal()
-	}
-}
+		logger.Info("starting audiostrike server")
+		err = startServer(ctx, austkServer)
+		if err != nil {
+			fatal(logger, "failed to start server", "error", err)
+		}
+		defer austkServer.Stop()
 
-// playTracks opens the mp3 files of the given tracks, plays each in series, and waits for playback to finish.
-// It is used to test mp3 files added for the artist or downloaded from other artists.
-func playTracks(tracks []*art.Track, fileServer *audiostrike.FileServer) error {
-	const logPrefix = "austk playTracks "
+		cfg.Pubkey, err = austkServer.Pubkey(ctx)
+		if err != nil {
+			fatal(logger, "failed to get server pubkey", "error", err)
+		}
+	}
 
-	for _, track := range tracks {
-		mp3FilePath := fileServer.TrackFilePath(track)
-		mp3, err := audiostrike.OpenMp3ToRead(mp3FilePath)
+	var configuredPeerPubkey string
+	if cfg.PeerAddress != "" {
+		peer, err := audiostrike.ParsePeerAddress(cfg.PeerAddress)
 		if err != nil {
-			log.Fatalf(logPrefix+"OpenMp3ToRead %v, error: %v", track, err)
-			return err
+			fatal(logger, "failed to parse peer address as pubkey@host:port", "peer_address", cfg.PeerAddress, "error", err)
+		}
+		configuredPeerPubkey = peer.Pubkey
+		err = localStorage.StorePeer(peer, austkServer)
+		if err != nil {
+			fatal(logger, "failed to store configured peer", "peer_address", cfg.PeerAddress, "error", err)
 		}
-		mp3.PlayAndWait()
 	}
-	return nil
-}
 
-// storeMp3File reads mp3 tags from the file named filename
-// and stores an art record for the track, for the artist, and for the album if relevant.
-// This lets the austk node host the mp3 track for the artist and collect payments to download/stream it.
-func storeMp3File(cfg *audiostrike.Config, filename string, localStorage audiostrike.ArtServer, austkServer *audiostrike.AustkServer) (*audiostrike.Mp3, error) {
-	const logPrefix = "austk storeMp3File "
+	// Sync from several peers at once, storing their art one peer at a time.
+	// SIGINT or SIGTERM stops dispatching peers to sync but lets the syncs under way finish,
+	// then quits the daemon.
+	quitCtx, stopQuitOnSignal := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stopQuitOnSignal()
+	syncStorage := audiostrike.NewSerializedArtServer(localStorage)
+	peerTracker := audiostrike.NewPeerTracker(syncStorage)
+	syncPeers := func(ctx context.Context) {
+		peersToSync := make(chan *art.Peer)
+		go dispatchStoredPeers(ctx, logger, syncStorage, peerTracker, peersToSync)
+		gossipedPeers := syncFromPeers(ctx, logger, cfg, peersToSync, syncStorage, austkServer, peerTracker, configuredPeerPubkey)
+		discoverPeers(ctx, logger, cfg, gossipedPeers, syncStorage, austkServer, peerTracker, configuredPeerPubkey)
+	}
+	syncsDone := make(chan struct{})
+	if cfg.RunAsDaemon && cfg.SyncInterval > 0 {
+		go func() {
+			defer close(syncsDone)
+			austkServer.SyncPeriodically(quitCtx, cfg.SyncInterval, syncPeers)
+		}()
+	} else {
+		austkServer.SyncPeers(quitCtx, syncPeers)
+		close(syncsDone)
+	}
 
-	mp3, err := audiostrike.OpenMp3ToRead(filename)
-	if err != nil {
-		return nil, err
+	if cfg.RunAsDaemon {
+		// Execution will stop in this function until server quits from SIGINT etc. and its requests drain.
+		austkServer.WaitUntilQuitSignal(quitCtx)
+		<-syncsDone
+		if lightning != nil {
+			lightning.Close()
+		}
+		if closer, isCloser := localStorage.(io.Closer); isCloser {
+			err = closer.Close()
+			if err != nil {
+				logger.Error("failed to close storage", "error", err)
+			}
+		}
+		logger.Info("quit")
 	}
+}
 
-	artistName := mp3.ArtistName()
-	artistID := audiostrike.NameToID(artistName)
+// fatal logs msg with the given fields as an error and exits austk with a nonzero status.
+func fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
 
-	// Store the artist if not yet known
-	artist, err := localStorage.Artist(artistID)
-	if err != nil && err != audiostrike.ErrArtNotFound {
-		log.Fatalf(logPrefix+"failed to get artist %s, error: %v", artistID, err)
-		return nil, err
+// dispatchStoredPeers sends the peers stored in localStorage to peersToSync, until ctx is done.
+// It sends first the peers that peerTracker found reachable recently, most recent first,
+// then the others page by page. Syncing may store new peers, which shift the later pages,
+// so it skips any peer whose pubkey sorts before the last peer sent. It closes peersToSync when done.
+func dispatchStoredPeers(ctx context.Context, logger *slog.Logger, localStorage audiostrike.ArtServer, peerTracker *audiostrike.PeerTracker,
+	peersToSync chan<- *art.Peer) {
+	defer close(peersToSync)
+	isDispatched := make(map[string]bool)
+	reachablePeers, err := peerTracker.ReachablePeers(recentlyReachable)
+	if err != nil {
+		logger.Warn("failed to get recently reachable peers", "error", err)
 	}
-	if artist == nil {
-		// Store the artist.
-		artist = &art.Artist{
-			ArtistId: artistID,
-			Name:     artistName,
-		}
-		if artistID == cfg.ArtistID {
-			log.Printf(logPrefix+"store artist %v with pubkey from lnd", *artist)
-			err = setArtistPubkey(cfg, austkServer, localStorage, artist)
-		} else {
-			log.Printf(logPrefix+"store artist %v without pubkey", *artist)
-			err = localStorage.StoreArtist(artist)
+	for _, peer := range reachablePeers {
+		isDispatched[peer.Pubkey] = true
+		if !dispatchPeer(ctx, logger, peer, peersToSync) {
+			return
 		}
+	}
+
+	var lastPubkey string
+	for offset := 0; ; offset += peerPageSize {
+		peers, err := localStorage.PeersPage(offset, peerPageSize)
 		if err != nil {
-			log.Printf(logPrefix+"StoreArtist %v, error: %v", *artist, err)
-			return nil, err
+			logger.Error("failed to get peers page", "offset", offset, "error", err)
+			return
+		}
+		for _, peer := range peers {
+			if peer.Pubkey <= lastPubkey || isDispatched[peer.Pubkey] {
+				continue // to next peer
+			}
+			lastPubkey = peer.Pubkey
+			if !dispatchPeer(ctx, logger, peer, peersToSync) {
+				return
+			}
+		}
+		if len(peers) < peerPageSize {
+			return
 		}
 	}
+}
 
-	var artistTrackID string
-	trackTitle := mp3.Title()
+// dispatchPeer sends peer to peersToSync unless ctx is done first, reporting whether it sent peer.
+func dispatchPeer(ctx context.Context, logger *slog.Logger, peer *art.Peer, peersToSync chan<- *art.Peer) bool {
+	if ctx.Err() == nil {
+		select {
+		case peersToSync <- peer:
+			return true
+		case <-ctx.Done():
+		}
+	}
+	logger.Info("stop dispatching peers to sync", "error", ctx.Err())
+	return false
+}
 
-	albumTitle, isInAlbum := mp3.AlbumTitle()
-	var artistAlbumID string
-	trackTitleID := audiostrike.NameToID(trackTitle)
-	log.Printf(logPrefix+"file: %v\n\tTitle: %v\n\tArtist: %v\n\tAlbum: %v\n\tTags: %v",
-		filename, trackTitle, artistName, albumTitle, mp3.Tags)
-	if isInAlbum {
-		artistAlbumID = audiostrike.TitleToHierarchy(albumTitle)
-		err = localStorage.StoreAlbum(&art.Album{
-			ArtistId:      artistID,
-			ArtistAlbumId: artistAlbumID,
-			Title:         albumTitle,
-		}, austkServer)
-		artistTrackID = filepath.Join(artistAlbumID, trackTitleID)
-	} else {
-		artistAlbumID = ""
-		artistTrackID = trackTitleID
+// syncFromPeers syncs from each peer received from peersToSync, up to -syncworkers peers at once,
+// until peersToSync is closed. It logs how many peers were synced, skipped, or failed
+// and returns the peers gossiped by the peers synced.
+func syncFromPeers(ctx context.Context, logger *slog.Logger, cfg *audiostrike.Config, peersToSync <-chan *art.Peer, localStorage audiostrike.ArtServer,
+	austkServer *audiostrike.AustkServer, peerTracker *audiostrike.PeerTracker, configuredPeerPubkey string) []*art.Peer {
+	workers := cfg.SyncWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	var gossipedPeers []*art.Peer
+	statusCounts := make(map[peerSyncStatus]int)
+	var resultMutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for peer := range peersToSync {
+				peerGossipedPeers, status := syncFromPeer(ctx, logger, cfg, peer, localStorage, austkServer, peerTracker, configuredPeerPubkey)
+				resultMutex.Lock()
+				gossipedPeers = append(gossipedPeers, peerGossipedPeers...)
+				statusCounts[status]++
+				resultMutex.Unlock()
+			}
+		}()
+	}
+	waitGroup.Wait()
+	logger.Info("synced from peers", "synced", statusCounts[peerSynced], "skipped", statusCounts[peerSkipped],
+		"failed", statusCounts[peerFailed], "workers", workers)
+	return gossipedPeers
+}
+
+// discoverPeers syncs from the peers gossiped by the peers synced, then from the peers those gossip,
+// up to -maxpeerhops hops away. Syncing from a reachable peer stores its own peer record,
+// so discovery stops once -maxpeers peers are stored. It dials at most -maxpeerdials peers,
+// skipping those that did not answer until peerTracker's cooldown elapses.
+func discoverPeers(ctx context.Context, logger *slog.Logger, cfg *audiostrike.Config, gossipedPeers []*art.Peer, localStorage audiostrike.ArtServer,
+	austkServer *audiostrike.AustkServer, peerTracker *audiostrike.PeerTracker, configuredPeerPubkey string) {
+	isSynced := make(map[string]bool)
+	dials := 0
+	for hops := 1; hops <= cfg.MaxPeerHops && len(gossipedPeers) > 0 && ctx.Err() == nil; hops++ {
+		peers, err := localStorage.Peers()
+		if err != nil {
+			logger.Error("failed to get peers", "error", err)
+			return
+		}
+		// Count each peer to discover as stored, since syncing from several at once could pass -maxpeers.
+		var peersToDiscover []*art.Peer
+		for _, peer := range gossipedPeers {
+			if isSynced[peer.Pubkey] || peers[peer.Pubkey] != nil {
+				continue // to next peer, gossiped by more than one peer or stored since it was gossiped
+			}
+			if !peerTracker.ShouldDialPeer(peer) {
+				logger.Debug("skip gossiped peer that did not answer until its cooldown elapses", "peer", peer.Pubkey)
+				continue // to next peer
+			}
+			if len(peers)+len(peersToDiscover) >= cfg.MaxPeers {
+				logger.Info("stop discovering peers at -maxpeers", "peers", len(peers))
+				break
+			}
+			if dials >= cfg.MaxPeerDials {
+				logger.Info("stop discovering peers at -maxpeerdials", "dials", dials)
+				break
+			}
+			dials++
+			isSynced[peer.Pubkey] = true
+			logger.Info("discover gossiped peer", "event", audiostrike.EventPeerAdded, "peer", peer.Pubkey, "hops", hops)
+			peersToDiscover = append(peersToDiscover, peer)
+		}
+
+		peersToSync := make(chan *art.Peer)
+		go func() {
+			defer close(peersToSync)
+			for _, peer := range peersToDiscover {
+				if !dispatchPeer(ctx, logger, peer, peersToSync) {
+					return
+				}
+			}
+		}()
+		gossipedPeers = syncFromPeers(ctx, logger, cfg, peersToSync, localStorage, austkServer, peerTracker, configuredPeerPubkey)
 	}
+}
 
-	// Store the track
-	track := &art.Track{
-		ArtistId:      artistID,
-		ArtistTrackId: artistTrackID,
-		Title:         trackTitle,
-		ArtistAlbumId: artistAlbumID,
+// peerSyncStatus is how syncing from a peer ended, to summarize syncing from many peers.
+type peerSyncStatus int
+
+const (
+	peerSynced peerSyncStatus = iota
+	peerSkipped
+	peerFailed
+)
+
+// syncFromPeer syncs art from peer into localStorage, tipping its artist if it is the configured peer
+// and downloading its tracks to play them if configured. It logs and skips a peer that fails or misbehaves.
+// Misbehaving peers are recorded in peerTracker and skipped until their cooldown elapses.
+// It returns the peers that peer gossips, which are not stored yet, and how syncing from peer ended.
+func syncFromPeer(ctx context.Context, logger *slog.Logger, cfg *audiostrike.Config, peer *art.Peer, localStorage audiostrike.ArtServer, austkServer *audiostrike.AustkServer,
+	peerTracker *audiostrike.PeerTracker, configuredPeerPubkey string) ([]*art.Peer, peerSyncStatus) {
+	peerAddress := audiostrike.PeerDialAddress(peer)
+	logger = logger.With("peer", peer.Pubkey, "peer_address", peerAddress)
+
+	if peer.Pubkey == cfg.Pubkey && audiostrike.NormalizePeerHost(peer.Host) == audiostrike.NormalizePeerHost(cfg.RestHost) {
+		logger.Debug("skip sync from self")
+		return nil, peerSkipped
 	}
-	err = localStorage.StoreTrack(track, austkServer)
-	if err != nil {
-		log.Printf(logPrefix+"StoreTrack %v, error: %v", track, err)
-		return nil, err
+	if !peerTracker.ShouldSyncPeer(peer) {
+		logger.Info("skip sync from misbehaving peer until its cooldown elapses")
+		return nil, peerSkipped
 	}
+	logger.Info("sync from peer", "event", audiostrike.EventSyncStarted)
 
-	trackPayload, err := mp3.ReadBytes()
+	client, err := austkServer.PeerClients().Get(ctx, peerAddress)
 	if err != nil {
-		log.Printf(logPrefix+"ReadBytes error: %v", err)
-		return nil, err
+		// Keep syncing from the other peers rather than exit the daemon from this worker.
+		logger.Error("failed to create client", "tor_proxy", cfg.TorProxy, "error", err)
+		return nil, peerFailed
 	}
+	defer austkServer.PeerClients().Put(client)
 
-	err = localStorage.StoreTrackPayload(track, trackPayload)
+	resources, err := client.SyncFromPeer(peer.Pubkey, localStorage)
+	if errors.Is(err, audiostrike.ErrSignatureInvalid) || errors.Is(err, audiostrike.ErrPubkeyMismatch) ||
+		errors.Is(err, audiostrike.ErrForeignArt) || errors.Is(err, audiostrike.ErrPublicationStale) {
+		// Skip art that the peer's artist did not sign or may not sign for, but continue with other peers.
+		logger.Warn("reject art from misbehaving peer", "error", err)
+		peerTracker.RecordPeerFailure(peer, err)
+		return nil, peerFailed
+	} else if err != nil {
+		// The peer may be unreachable for now, so continue with other peers.
+		logger.Warn("failed to sync from peer", "error", err)
+		peerTracker.RecordPeerUnreachable(peer, err)
+		return nil, peerFailed
+	}
+	gossipedPeers, err := client.GossipedPeers(resources, localStorage)
 	if err != nil {
-		log.Printf(logPrefix+"StoreTrackPayload for %s/%s with %d bytes, error: %v",
-			track.ArtistId, track.ArtistTrackId, len(trackPayload), err)
-		return nil, err
+		logger.Warn("failed to get gossiped peers", "error", err)
 	}
 
-	resources, err := audiostrike.CollectResources(localStorage)
-	if err != nil {
-		log.Printf(logPrefix+"Failed to collect resources, error: %v", err)
-		return nil, err
+	if cfg.Tip > 0 && peer.Pubkey == configuredPeerPubkey {
+		for _, artist := range resources.Artists {
+			if artist.Pubkey == peer.Pubkey {
+				err = client.TipArtist(artist, cfg.Tip)
+				if err != nil {
+					logger.Warn("failed to tip artist", "artist_id", artist.ArtistId, "error", err)
+				}
+				break
+			}
+		}
 	}
 
-	publication, err := austkServer.Sign(resources)
-	if err != nil {
-		log.Printf(logPrefix+"Failed to sign resources %v, error: %v", resources, err)
-		return nil, err
+	// Pull the cover art of synced albums to display them.
+	err = client.DownloadAlbumArt(resources.Albums, localStorage)
+	if errors.Is(err, audiostrike.ErrPayloadMismatch) {
+		logger.Warn("reject album cover art from misbehaving peer", "error", err)
+		peerTracker.RecordPeerFailure(peer, err)
+		return nil, peerFailed
+	} else if err != nil {
+		logger.Warn("failed to download album cover art", "error", err)
 	}
 
-	err = localStorage.StorePublication(publication)
-	if err != nil {
-		log.Printf(logPrefix+"Failed to store publication %v, error: %v", publication, err)
-		return nil, err
+	// Sync the artists of playlist tracks not stored yet, so the playlists can be played.
+	err = client.SyncPlaylistTracksFromPeer(resources.Playlists, localStorage)
+	if errors.Is(err, audiostrike.ErrSignatureInvalid) || errors.Is(err, audiostrike.ErrPubkeyMismatch) ||
+		errors.Is(err, audiostrike.ErrForeignArt) || errors.Is(err, audiostrike.ErrPublicationStale) {
+		logger.Warn("reject playlist track art from misbehaving peer", "error", err)
+		peerTracker.RecordPeerFailure(peer, err)
+		return nil, peerFailed
+	} else if err != nil {
+		logger.Warn("failed to sync playlist tracks", "error", err)
 	}
 
-	return mp3, nil
+	if cfg.PlayMp3 {
+		tracks := resources.Tracks
+		logger.Info("download tracks to play", "tracks", len(tracks))
+		err = client.DownloadTracks(tracks, localStorage)
+		if errors.Is(err, audiostrike.ErrPayloadMismatch) {
+			logger.Warn("reject tracks from misbehaving peer", "error", err)
+			peerTracker.RecordPeerFailure(peer, err)
+		} else {
+			if err != nil {
+				logger.Warn("failed to download tracks", "error", err)
+			}
+			peerTracker.RecordPeerSuccess(peer)
+		}
+		playbackMutex.Lock()
+		err = playTracks(tracks, localStorage)
+		playbackMutex.Unlock()
+		if err != nil {
+			logger.Warn("failed to play tracks", "error", err)
+		}
+	} else {
+		peerTracker.RecordPeerSuccess(peer)
+		logger.Debug("will not play tracks")
+	}
+	logger.Info("synced from peer", "event", audiostrike.EventSyncFinished, "tracks", len(resources.Tracks))
+	return gossipedPeers, peerSynced
 }
 
-// startServer sets the configured artist to use the configured lnd for signing and selling music.
-// and starts running as a daemon
-// until SIGINT (ctrl-c or `kill`) is received.
-func startServer(cfg *audiostrike.Config, localStorage audiostrike.ArtServer, austkServer *audiostrike.AustkServer) error {
-	const logPrefix = "austk startServer "
-
-	artist, err := localStorage.Artist(cfg.ArtistID)
+// printSearchResults prints the artists and tracks in localStorage whose names or titles contain query.
+// Only tracks are printed if filter narrows the search, since artists are not tagged with genres or years.
+func printSearchResults(query string, filter audiostrike.TrackFilter, localStorage audiostrike.ArtServer) error {
+	if filter == (audiostrike.TrackFilter{}) {
+		artists, err := localStorage.SearchArtists(query)
+		if err != nil {
+			return err
+		}
+		for _, artist := range artists {
+			fmt.Printf("artist %s: %s\n", artist.ArtistId, artist.Name)
+		}
+	}
+	tracks, err := localStorage.SearchTracks(query, filter)
 	if err != nil {
-		log.Fatalf(logPrefix+"failed to get artist %s, error: %v", cfg.ArtistID, err)
 		return err
 	}
+	for _, track := range tracks {
+		fmt.Printf("track %s/%s: %s\n", track.ArtistId, track.ArtistTrackId, track.Title)
+	}
+	return nil
+}
 
-	err = setArtistPubkey(cfg, austkServer, localStorage, artist)
+// printTopTracks prints the plays and purchases of the count most played tracks still stored, most played first.
+func printTopTracks(count int, localStorage audiostrike.ArtServer) error {
+	// Stats outlive deleted tracks, so get enough to print count stored tracks after skipping any deleted.
+	stats, err := localStorage.TopTrackStats(-1)
 	if err != nil {
-		log.Fatalf(logPrefix+"failed to setArtistPubkey, error: %v", err)
 		return err
 	}
+	for _, trackStats := range stats {
+		if count == 0 {
+			break
+		}
+		track, err := localStorage.Track(trackStats.ArtistId, trackStats.ArtistTrackId)
+		if errors.Is(err, audiostrike.ErrArtNotFound) || (err == nil && track == nil) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("track %s/%s: %s, plays %d, purchases %d\n", track.ArtistId, track.ArtistTrackId, track.Title,
+			trackStats.Plays, trackStats.Purchases)
+		count--
+	}
+	return nil
+}
 
-	err = austkServer.Start()
+// printPeers prints each stored peer, ordered by pubkey, with when it was last seen and last synced
+// and its failures since. The peer of the artist with artistID is marked as this node.
+func printPeers(artistID string, localStorage audiostrike.ArtServer) error {
+	var selfPubkey string
+	if artist, err := localStorage.Artist(artistID); err == nil && artist != nil {
+		selfPubkey = artist.Pubkey
+	}
+	peers, err := localStorage.Peers()
 	if err != nil {
-		log.Fatalf(logPrefix+"Start error: %v", err)
 		return err
 	}
+	pubkeys := make([]string, 0, len(peers))
+	for pubkey := range peers {
+		pubkeys = append(pubkeys, pubkey)
+	}
+	sort.Strings(pubkeys)
+	for _, pubkey := range pubkeys {
+		peer := peers[pubkey]
+		reputation, err := localStorage.PeerReputation(pubkey)
+		if err != nil {
+			return err
+		}
+		self := ""
+		if selfPubkey != "" && pubkey == selfPubkey {
+			self = " (this node)"
+		}
+		fmt.Printf("peer %s@%s%s: last seen %s, last synced %s, failures %d\n", pubkey, audiostrike.PeerDialAddress(peer), self,
+			unixTimeString(reputation.LastSeenAt), unixTimeString(reputation.LastReachableAt), reputation.FailureCount)
+	}
 	return nil
 }
 
-func setArtistPubkey(cfg *audiostrike.Config, austkServer *audiostrike.AustkServer, localStorage audiostrike.ArtServer, artist *art.Artist) error {
-	const logPrefix = "austk setArtistPubkey "
+// unixTimeString formats the Unix time seconds to print, or "never" for 0.
+func unixTimeString(seconds uint64) string {
+	if seconds == 0 {
+		return "never"
+	}
+	return time.Unix(int64(seconds), 0).UTC().Format(time.RFC3339)
+}
+
+// printPaymentStatus prints the state of the invoice with the hex hash invoiceHash
+// and of the payment with the hex hash paymentHash, either of which may be empty to skip it.
+// An invoice or payment unknown to lnd is printed as not found.
+func printPaymentStatus(ctx context.Context, invoiceHash, paymentHash string, lightning *audiostrike.LightningNode) error {
+	if invoiceHash != "" {
+		hash, err := hex.DecodeString(invoiceHash)
+		if err != nil {
+			return fmt.Errorf("malformed invoice hash %s, error: %v", invoiceHash, err)
+		}
+		invoice, err := lightning.LookupInvoice(ctx, hash)
+		if errors.Is(err, audiostrike.ErrInvoiceNotFound) {
+			fmt.Printf("invoice %s: not found\n", invoiceHash)
+		} else if err != nil {
+			return err
+		} else {
+			fmt.Printf("invoice %s: %s, %d of %d sats paid\n", invoiceHash, invoice.State, invoice.AmtPaidSat, invoice.Value)
+		}
+	}
+	if paymentHash != "" {
+		hash, err := hex.DecodeString(paymentHash)
+		if err != nil {
+			return fmt.Errorf("malformed payment hash %s, error: %v", paymentHash, err)
+		}
+		payment, err := lightning.LookupPayment(ctx, hash)
+		if errors.Is(err, audiostrike.ErrPaymentNotFound) {
+			fmt.Printf("payment %s: not found\n", paymentHash)
+		} else if err != nil {
+			return err
+		} else {
+			fmt.Printf("payment %s: %s, %d sats plus %d sats fee\n", paymentHash, payment.Status, payment.ValueSat, payment.Fee)
+		}
+	}
+	return nil
+}
 
-	// Set the pubkey for artistID to this server's pubkey (from lnd).
-	pubkey, err := austkServer.Pubkey()
+// serveMetrics serves prometheus /metrics on port until austk exits.
+func serveMetrics(logger *slog.Logger, port int) {
+	metricsRouter := http.NewServeMux()
+	metricsRouter.Handle("/metrics", audiostrike.MetricsHandler())
+	logger.Info("serve /metrics", "port", port)
+	err := http.ListenAndServe(fmt.Sprintf(":%d", port), metricsRouter)
 	if err != nil {
-		log.Fatalf(logPrefix+"s.Pubkey error: %v", err)
-		return err
+		logger.Error("failed to serve /metrics", "port", port, "error", err)
 	}
+}
 
-	artist.Pubkey = pubkey
-	err = localStorage.StoreArtist(artist)
+// printAudioFileArt prints the tags read from the audio file named filename
+// and the art that -add would store for it, without storing or signing anything.
+func printAudioFileArt(filename string) error {
+	audio, err := audiostrike.OpenAudioFile(filename)
 	if err != nil {
-		log.Fatalf(logPrefix+"StoreArtist %v, error: %v", artist, err)
 		return err
 	}
+	artist, album, track := audiostrike.AudioFileArt(audio)
+	albumTitle, _ := audio.AlbumTitle()
+	fmt.Printf("file %s\n", filename)
+	fmt.Printf("\ttags: artist %q, album %q, title %q, container %s, codec %s\n",
+		audio.ArtistName(), albumTitle, audio.Title(), audio.Container(), audio.Codec())
+	fmt.Printf("\tartist %s: %s\n", artist.ArtistId, artist.Name)
+	if album != nil {
+		fmt.Printf("\talbum %s/%s: %s\n", album.ArtistId, album.ArtistAlbumId, album.Title)
+		if picture := audio.CoverArt(); picture != nil {
+			fmt.Printf("\tcover art: %s, %d bytes\n", picture.Mime, len(picture.Data))
+		}
+	}
+	fmt.Printf("\ttrack %s/%s: %s\n", track.ArtistId, track.ArtistTrackId, track.Title)
+	if track.AlbumTrackNumber != 0 {
+		fmt.Printf("\ttrack number: %d\n", track.AlbumTrackNumber)
+	}
 	return nil
 }
+
+// playTracks opens the audio files of the given tracks, plays each in series, and waits for playback to finish.
+// It is used to test audio files added for the artist or downloaded from other artists.
+func playTracks(tracks []*art.Track, artServer audiostrike.ArtServer) error {
+	for _, track := range tracks {
+		audio, closeAudio, err := audiostrike.OpenTrackAudio(artServer, track)
+		if err != nil {
+			return fmt.Errorf("failed to open %s/%s: %w", track.ArtistId, track.ArtistTrackId, err)
+		}
+		audio.PlayAndWait()
+		closeAudio()
+	}
+	return nil
+}
+
+// startServer checks that the hosted artists use the configured lnd for signing and selling music
+// and starts serving as a daemon. It returns once the server listens; main then syncs and waits
+// in WaitUntilQuitSignal for SIGINT (ctrl-c) or SIGTERM (`kill`).
+func startServer(ctx context.Context, austkServer *audiostrike.AustkServer) error {
+	err := austkServer.CheckHostedPubkeys(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check pubkeys of artists hosted by lnd: %w", err)
+	}
+
+	return austkServer.Start()
+}
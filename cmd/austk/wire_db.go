@@ -0,0 +1,22 @@
+// +build wireinject
+// Wire builds wire_gen.go from
+// 1. the signature from func injectDbServer (the injector function) in this stub file,
+// 2. the expressions that injectDbServer passes to `wire.Build()`, and
+// 3. the functions other than the injector.
+// The `+build` directive above omits this file from released builds, which use generated wire_gen.go.
+
+package main
+
+import (
+	audiostrike "github.com/audiostrike/music/internal"
+	"github.com/google/wire"
+)
+
+func injectDbServer(cfg *audiostrike.Config) (s audiostrike.ArtServer, err error) {
+	wire.Build(audiostrike.NewDbServer, useDbServer)
+	return
+}
+
+func useDbServer(dbServer *audiostrike.DbServer) audiostrike.ArtServer {
+	return dbServer
+}
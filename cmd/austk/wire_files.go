@@ -12,11 +12,16 @@ import (
 	"github.com/google/wire"
 )
 
-func injectFileServer(artDirPath string) (s audiostrike.ArtServer, err error) {
-	wire.Build(audiostrike.NewFileServer, useFileServer)
+func injectFileServer(cfg *audiostrike.Config) (s audiostrike.ArtServer, err error) {
+	wire.Build(newConfiguredFileServer, useFileServer)
 	return
 }
 
+// newConfiguredFileServer creates a FileServer storing art in the configured -dir and payloads in -payloaddir.
+func newConfiguredFileServer(cfg *audiostrike.Config) (*audiostrike.FileServer, error) {
+	return audiostrike.NewFileServerWithPayloadDir(cfg.ArtDir, cfg.PayloadDir)
+}
+
 func useFileServer(fileServer *audiostrike.FileServer) audiostrike.ArtServer {
 	return fileServer
 }
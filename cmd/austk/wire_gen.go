@@ -9,10 +9,21 @@ import (
 	"github.com/audiostrike/music/internal"
 )
 
+// Injectors from wire_db.go:
+
+func injectDbServer(cfg *audiostrike.Config) (audiostrike.ArtServer, error) {
+	dbServer, err := audiostrike.NewDbServer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	artServer := useDbServer(dbServer)
+	return artServer, nil
+}
+
 // Injectors from wire_files.go:
 
-func injectFileServer(artDirPath string) (audiostrike.ArtServer, error) {
-	fileServer, err := audiostrike.NewFileServer(artDirPath)
+func injectFileServer(cfg *audiostrike.Config) (audiostrike.ArtServer, error) {
+	fileServer, err := newConfiguredFileServer(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -41,8 +52,19 @@ func injectPublisher(cfg *audiostrike.Config, artServer audiostrike.ArtServer, p
 	return austkServer, nil
 }
 
+// wire_db.go:
+
+func useDbServer(dbServer *audiostrike.DbServer) audiostrike.ArtServer {
+	return dbServer
+}
+
 // wire_files.go:
 
+// newConfiguredFileServer creates a FileServer storing art in the configured -dir and payloads in -payloaddir.
+func newConfiguredFileServer(cfg *audiostrike.Config) (*audiostrike.FileServer, error) {
+	return audiostrike.NewFileServerWithPayloadDir(cfg.ArtDir, cfg.PayloadDir)
+}
+
 func useFileServer(fileServer *audiostrike.FileServer) audiostrike.ArtServer {
 	return fileServer
 }
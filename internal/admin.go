@@ -0,0 +1,350 @@
+package audiostrike
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/mux"
+)
+
+// MacaroonHeader is the http header in which an admin client authenticates with the hex-encoded lnd macaroon
+// of the node, as lnd's REST api expects it.
+const MacaroonHeader = "Grpc-Metadata-Macaroon"
+
+// isAdmin checks that req authenticates as this node's admin, with the configured -admintoken
+// as a bearer token or with the hex of lnd's macaroon in MacaroonHeader.
+func (server *AustkServer) isAdmin(req *http.Request) bool {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if server.config.AdminToken != "" && token != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(server.config.AdminToken)) == 1 {
+		return true
+	}
+	hexMacaroon := req.Header.Get(MacaroonHeader)
+	if hexMacaroon == "" {
+		return false
+	}
+	requestMacaroon, err := hex.DecodeString(hexMacaroon)
+	if err != nil {
+		return false
+	}
+	lndMacaroon, err := macaroonFromFile(server.config)
+	if err != nil {
+		server.logger.Warn("failed to get macaroon to authenticate admin", "error", err)
+		return false
+	}
+	macaroonBytes, err := lndMacaroon.MarshalBinary()
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(requestMacaroon, macaroonBytes) == 1
+}
+
+// adminOnly wraps handler to reply 401 Unauthorized to a request that does not authenticate as the admin.
+func (server *AustkServer) adminOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !server.isAdmin(req) {
+			server.logger.Info("reject unauthenticated admin request", "url", req.URL.Path, "remote_address", req.RemoteAddr)
+			http.Error(w, "authenticate with -admintoken or the lnd macaroon", http.StatusUnauthorized)
+			return
+		}
+		handler(w, req)
+	}
+}
+
+// DeleteTrack deletes the stored track with its payload, then publishes the stored art again without it
+// and with a tombstone of it, so peers that synced the track delete their copies too.
+func (server *AustkServer) DeleteTrack(artistID string, artistTrackID string) error {
+	logger := server.logger.With("artist_id", artistID, "track_id", artistTrackID)
+	err := server.artServer.DeleteTrack(&art.Track{ArtistId: artistID, ArtistTrackId: artistTrackID})
+	if err != nil {
+		logger.Warn("failed to delete track", "error", err)
+		return err
+	}
+	logger.Info("deleted track")
+	err = server.storeTombstone(artistID, "", artistTrackID)
+	if err != nil {
+		return err
+	}
+	return server.publish(server.signingArtistID(artistID))
+}
+
+// DeleteAlbum deletes the stored album with its cover art, then publishes the stored art again without it
+// and with tombstones of it and of any tracks deleted with it.
+// If isCascading, it deletes the album's tracks with their payloads first;
+// otherwise it refuses to delete an album with tracks, with ErrAlbumNotEmpty.
+func (server *AustkServer) DeleteAlbum(artistID string, artistAlbumID string, isCascading bool) error {
+	logger := server.logger.With("artist_id", artistID, "album_id", artistAlbumID)
+	if isCascading {
+		tracks, err := server.artServer.Tracks(artistID)
+		if err != nil {
+			return err
+		}
+		for _, track := range tracks {
+			if track.ArtistAlbumId != artistAlbumID {
+				continue
+			}
+			err = server.artServer.DeleteTrack(track)
+			if err != nil {
+				logger.Warn("failed to delete album track", "track_id", track.ArtistTrackId, "error", err)
+				return err
+			}
+			logger.Info("deleted album track", "track_id", track.ArtistTrackId)
+			err = server.storeTombstone(artistID, "", track.ArtistTrackId)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err := server.artServer.DeleteAlbum(&art.Album{ArtistId: artistID, ArtistAlbumId: artistAlbumID})
+	if err != nil {
+		logger.Warn("failed to delete album", "error", err)
+		return err
+	}
+	logger.Info("deleted album", "cascade", isCascading)
+	err = server.storeTombstone(artistID, artistAlbumID, "")
+	if err != nil {
+		return err
+	}
+	return server.publish(server.signingArtistID(artistID))
+}
+
+// deleteTrackHandler handles an admin's request to delete a track.
+func (server *AustkServer) deleteTrackHandler(w http.ResponseWriter, req *http.Request) {
+	err := server.DeleteTrack(mux.Vars(req)["artist"], mux.Vars(req)["track"])
+	replyDeleted(w, err)
+}
+
+// deleteAlbumHandler handles an admin's request to delete an album, with its tracks if ?cascade=true.
+func (server *AustkServer) deleteAlbumHandler(w http.ResponseWriter, req *http.Request) {
+	isCascading := req.URL.Query().Get("cascade") == "true"
+	err := server.DeleteAlbum(mux.Vars(req)["artist"], mux.Vars(req)["album"], isCascading)
+	replyDeleted(w, err)
+}
+
+// replyDeleted replies 204 No Content if the art was deleted,
+// or else 404 Not Found, 409 Conflict for an album with tracks, or 500 with the error.
+func replyDeleted(w http.ResponseWriter, err error) {
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, ErrArtNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrAlbumNotEmpty):
+		http.Error(w, err.Error()+"; delete with ?cascade=true to delete its tracks too", http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// UpdateTrackMetadata retitles the stored track as newTitle and moves it to the album titled newAlbum,
+// keeping its title or album where newTitle or newAlbum is empty, then publishes the stored art again.
+// A new album gets the id of its title disambiguated from any other album by AlbumHierarchy.
+// A track moved to another album is numbered after the album's last track.
+// The track's id follows its title and album like an added track's, so a changed id moves the stored payload,
+// which keeps its hash, and the stats, and the track is republished under the new id with a tombstone
+// of the old id, so peers that synced it delete their copies.
+// Other art naming the old id, e.g. a playlist, is not updated.
+// It fails with ErrTrackCollision if another track is stored with the new id.
+// It updates track with the new title and ids.
+func (server *AustkServer) UpdateTrackMetadata(track *art.Track, newTitle, newAlbum string) error {
+	logger := server.logger.With("artist_id", track.ArtistId, "track_id", track.ArtistTrackId)
+	storedTrack, err := server.artServer.Track(track.ArtistId, track.ArtistTrackId)
+	if err != nil {
+		logger.Warn("no track to update", "error", err)
+		return err
+	}
+	updatedTrack := proto.Clone(storedTrack).(*art.Track)
+	if newTitle != "" {
+		updatedTrack.Title = newTitle
+	}
+	if newAlbum != "" {
+		albumID, err := AlbumHierarchy(server.artServer, server.config.hierarchyRules(), track.ArtistId, newAlbum)
+		if err != nil {
+			return err
+		}
+		album := &art.Album{ArtistId: track.ArtistId, ArtistAlbumId: albumID, Title: newAlbum}
+		albums, err := server.artServer.Albums(track.ArtistId)
+		if err != nil {
+			return err
+		}
+		if albums[album.ArtistAlbumId] == nil {
+			err = server.artServer.StoreAlbum(album, server)
+			if err != nil {
+				logger.Error("failed to store album", "album_id", album.ArtistAlbumId, "error", err)
+				return err
+			}
+		}
+		updatedTrack.ArtistAlbumId = album.ArtistAlbumId
+		if updatedTrack.ArtistAlbumId != storedTrack.ArtistAlbumId {
+			// Number the track after those of its new album rather than take the number of one of them.
+			updatedTrack.AlbumTrackNumber, err = server.nextAlbumTrackNumber(track.ArtistId, updatedTrack.ArtistAlbumId)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	updatedTrack.ArtistTrackId = NameToID(updatedTrack.Title)
+	if updatedTrack.ArtistAlbumId != "" {
+		updatedTrack.ArtistTrackId = filepath.Join(updatedTrack.ArtistAlbumId, updatedTrack.ArtistTrackId)
+	}
+
+	if updatedTrack.ArtistTrackId == storedTrack.ArtistTrackId {
+		err = server.artServer.StoreTrack(updatedTrack, server)
+	} else {
+		err = server.moveTrack(storedTrack, updatedTrack)
+		if err == nil {
+			err = server.storeTombstone(storedTrack.ArtistId, "", storedTrack.ArtistTrackId)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("updated track", "new_track_id", updatedTrack.ArtistTrackId, "title", updatedTrack.Title)
+	track.Reset()
+	proto.Merge(track, updatedTrack)
+	return server.publish(server.signingArtistID(track.ArtistId))
+}
+
+// moveTrack stores movedTrack, storedTrack under a new id, moves the payload, preview, and stats of storedTrack
+// to it, then deletes storedTrack. It fails with ErrTrackCollision if a track is already stored with the new id.
+func (server *AustkServer) moveTrack(storedTrack *art.Track, movedTrack *art.Track) error {
+	logger := server.logger.With("artist_id", storedTrack.ArtistId, "track_id", storedTrack.ArtistTrackId,
+		"new_track_id", movedTrack.ArtistTrackId)
+	_, err := server.artServer.Track(movedTrack.ArtistId, movedTrack.ArtistTrackId)
+	if err == nil {
+		logger.Warn("keep track, whose new id is taken by another track")
+		return fmt.Errorf("%w: %s/%s is already stored", ErrTrackCollision, movedTrack.ArtistId, movedTrack.ArtistTrackId)
+	} else if !errors.Is(err, ErrArtNotFound) {
+		return err
+	}
+
+	var preview []byte
+	if len(storedTrack.PreviewSha256) > 0 {
+		preview, err = server.artServer.TrackPreview(storedTrack.ArtistId, storedTrack.ArtistTrackId)
+		if err != nil && !errors.Is(err, ErrArtNotFound) {
+			return err
+		}
+	}
+	// Store the plays and purchases counted so far, so they move with the stored stats.
+	server.trackStats.flush()
+	stats, err := server.artServer.TrackStats(storedTrack.ArtistId, storedTrack.ArtistTrackId)
+	if err != nil {
+		return err
+	}
+	hasStats := stats.Plays > 0 || stats.Purchases > 0 || stats.LastPlayedAt > 0
+	if hasStats {
+		movedStats := proto.Clone(stats).(*art.TrackStats)
+		movedStats.ArtistId = movedTrack.ArtistId
+		movedStats.ArtistTrackId = movedTrack.ArtistTrackId
+		err = server.artServer.StoreTrackStats(movedStats)
+		if err != nil {
+			logger.Error("failed to store moved stats", "error", err)
+			return err
+		}
+	}
+
+	err = server.artServer.StoreTrack(movedTrack, server)
+	if err != nil {
+		logger.Error("failed to store moved track", "error", err)
+		server.artServer.DeleteTrackStats(movedTrack.ArtistId, movedTrack.ArtistTrackId)
+		return err
+	}
+	if preview != nil {
+		err = server.artServer.StoreTrackPreview(movedTrack, preview)
+		if err != nil {
+			logger.Error("failed to store moved preview", "error", err)
+		}
+	}
+	if err == nil {
+		err = server.movePayload(storedTrack, movedTrack)
+		if err != nil {
+			logger.Error("failed to move payload", "error", err)
+		}
+	}
+	if err != nil {
+		// Keep the track under its old id rather than under both. Deleting movedTrack also drops it from
+		// the index of its album and number, which it may share with storedTrack, so store storedTrack again.
+		server.artServer.DeleteTrack(movedTrack)
+		server.artServer.DeleteTrackStats(movedTrack.ArtistId, movedTrack.ArtistTrackId)
+		restoreErr := server.artServer.StoreTrack(storedTrack, server)
+		if restoreErr != nil {
+			logger.Error("failed to restore track", "error", restoreErr)
+		}
+		return err
+	}
+	err = server.artServer.DeleteTrack(storedTrack)
+	if err != nil || !hasStats {
+		return err
+	}
+	return server.artServer.DeleteTrackStats(storedTrack.ArtistId, storedTrack.ArtistTrackId)
+}
+
+// nextAlbumTrackNumber gets the number after the highest of the stored tracks of the artist's album,
+// or 1 for an album without tracks.
+func (server *AustkServer) nextAlbumTrackNumber(artistID string, albumID string) (uint32, error) {
+	tracks, err := server.artServer.Tracks(artistID)
+	if err != nil {
+		return 0, err
+	}
+	var lastNumber uint32
+	for _, track := range tracks {
+		if track.ArtistAlbumId == albumID && track.AlbumTrackNumber > lastNumber {
+			lastNumber = track.AlbumTrackNumber
+		}
+	}
+	return lastNumber + 1, nil
+}
+
+// movePayload moves the stored payload of storedTrack to movedTrack:
+// its file, if stored in one, or else its bytes. A track stored without a payload has none to move.
+func (server *AustkServer) movePayload(storedTrack *art.Track, movedTrack *art.Track) error {
+	if len(storedTrack.PayloadSha256) == 0 {
+		return nil
+	}
+	storedPath := server.artServer.TrackFilePath(storedTrack)
+	if storedPath != "" {
+		movedPath := server.artServer.TrackFilePath(movedTrack)
+		err := os.MkdirAll(filepath.Dir(movedPath), 0755)
+		if err != nil {
+			return err
+		}
+		return os.Rename(storedPath, movedPath)
+	}
+	payloadReader, err := server.artServer.TrackFilePartialReader(storedTrack, 0)
+	if err != nil {
+		return err
+	}
+	defer payloadReader.Close()
+	payload, err := ioutil.ReadAll(payloadReader)
+	if err != nil {
+		return err
+	}
+	return server.artServer.StoreTrackPayload(movedTrack, payload)
+}
+
+// updateTrackHandler handles an admin's request to retitle a track or move it to another album,
+// with the form values title and album.
+func (server *AustkServer) updateTrackHandler(w http.ResponseWriter, req *http.Request) {
+	track := &art.Track{ArtistId: mux.Vars(req)["artist"], ArtistTrackId: mux.Vars(req)["track"]}
+	err := server.UpdateTrackMetadata(track, req.FormValue("title"), req.FormValue("album"))
+	switch {
+	case err == nil:
+		w.Header().Set("Location", "/art/"+track.ArtistId+"/"+track.ArtistTrackId)
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, ErrArtNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrTrackCollision):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
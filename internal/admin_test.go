@@ -0,0 +1,224 @@
+package audiostrike
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/mux"
+)
+
+// TestDeleteTrackAndAlbum verifies that an admin can delete a track or an album with its tracks,
+// that their payload files are removed, and that the stored art is published again without them.
+func TestDeleteTrackAndAlbum(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	artServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	adminCfg := *cfg
+	adminCfg.AdminToken = "s3cr3t"
+	austkServer, err := NewAustkServer(&adminCfg, artServer, &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	err = artServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	album := &art.Album{ArtistId: mockArtistID, ArtistAlbumId: "album", Title: "Album"}
+	err = artServer.StoreAlbum(album, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreAlbum error: %v", err)
+	}
+	single := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "single", Title: "Single"}
+	albumTrack := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "album/one", Title: "One",
+		ArtistAlbumId: "album", AlbumTrackNumber: 1}
+	for _, track := range []*art.Track{single, albumTrack} {
+		err = artServer.StoreTrack(track, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreTrack error: %v", err)
+		}
+		err = artServer.StoreTrackPayload(track, []byte("payload of "+track.Title))
+		if err != nil {
+			t.Fatalf("StoreTrackPayload error: %v", err)
+		}
+	}
+	deleteArt := func(handler http.HandlerFunc, url string, vars map[string]string, token string) int {
+		request := httptest.NewRequest("DELETE", url, nil)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		austkServer.adminOnly(handler)(recorder, mux.SetURLVars(request, vars))
+		return recorder.Code
+	}
+	singleVars := map[string]string{"artist": mockArtistID, "track": "single"}
+	albumVars := map[string]string{"artist": mockArtistID, "album": "album"}
+	isPayloadStored := func(track *art.Track) bool {
+		_, err := os.Stat(artServer.TrackFilePath(track))
+		return err == nil
+	}
+
+	if code := deleteArt(austkServer.deleteTrackHandler, "/art/"+mockArtistID+"/single", singleVars, "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("expected delete without the admin token refused but got %d", code)
+	}
+	if code := deleteArt(austkServer.deleteTrackHandler, "/art/"+mockArtistID+"/single", singleVars, "s3cr3t"); code != http.StatusNoContent {
+		t.Fatalf("expected track deleted but got %d", code)
+	}
+	if isPayloadStored(single) {
+		t.Errorf("expected payload file of deleted track removed")
+	}
+	resources, err := artServer.readSavedResources(&mockArtist)
+	if err != nil || len(resources.Tracks) != 1 || resources.Tracks[0].ArtistTrackId != "album/one" {
+		t.Errorf("expected publication without deleted track but got %v, error: %v", resources, err)
+	}
+
+	if code := deleteArt(austkServer.deleteAlbumHandler, "/album/"+mockArtistID+"/album", albumVars, "s3cr3t"); code != http.StatusConflict {
+		t.Errorf("expected album with a track kept without ?cascade=true but got %d", code)
+	}
+	if code := deleteArt(austkServer.deleteAlbumHandler, "/album/"+mockArtistID+"/album?cascade=true", albumVars, "s3cr3t"); code != http.StatusNoContent {
+		t.Fatalf("expected album deleted with its tracks but got %d", code)
+	}
+	if isPayloadStored(albumTrack) {
+		t.Errorf("expected payload file of deleted album track removed")
+	}
+	resources, err = artServer.readSavedResources(&mockArtist)
+	if err != nil || len(resources.Tracks) != 0 || len(resources.Albums) != 0 {
+		t.Errorf("expected publication without deleted album but got %v, error: %v", resources, err)
+	}
+	if code := deleteArt(austkServer.deleteTrackHandler, "/art/"+mockArtistID+"/single", singleVars, "s3cr3t"); code != http.StatusNotFound {
+		t.Errorf("expected 404 deleting deleted track but got %d", code)
+	}
+}
+
+// TestUpdateTrackMetadata verifies that retitling a track or moving it to another album moves its payload file
+// to its new id with the same hash, numbered after the tracks of its new album, that the stored art is published
+// again with it and a tombstone of its old id, and that a track is kept, indexed in its album, if its new id is taken or its payload cannot move.
+func TestUpdateTrackMetadata(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	artServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	austkServer, err := NewAustkServer(cfg, artServer, &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	err = artServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	err = artServer.StoreAlbum(&art.Album{ArtistId: mockArtistID, ArtistAlbumId: "firstalbum", Title: "First Album"}, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreAlbum error: %v", err)
+	}
+	demo := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "demo", Title: "Demo", AlbumTrackNumber: 1}
+	other := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "other", Title: "Other"}
+	opener := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "firstalbum/opener", ArtistAlbumId: "firstalbum",
+		Title: "Opener", AlbumTrackNumber: 1}
+	for _, track := range []*art.Track{demo, other, opener} {
+		err = artServer.StoreTrack(track, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreTrack error: %v", err)
+		}
+		err = artServer.StoreTrackPayload(track, []byte("payload of "+track.Title))
+		if err != nil {
+			t.Fatalf("StoreTrackPayload error: %v", err)
+		}
+	}
+	oldPath := artServer.TrackFilePath(demo)
+	payloadHash := append([]byte(nil), demo.PayloadSha256...)
+	err = artServer.StoreTrackStats(&art.TrackStats{ArtistId: mockArtistID, ArtistTrackId: "demo", Plays: 2})
+	if err != nil {
+		t.Fatalf("StoreTrackStats error: %v", err)
+	}
+	austkServer.trackStats.count(demo, 1, 0)
+	demo.PreviewSeconds = 30
+	err = artServer.StoreTrackPreview(demo, []byte("preview of Demo"))
+	if err != nil {
+		t.Fatalf("StoreTrackPreview error: %v", err)
+	}
+
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "demo"}
+	err = austkServer.UpdateTrackMetadata(track, "Intro", "First Album")
+	if err != nil {
+		t.Fatalf("UpdateTrackMetadata error: %v", err)
+	}
+	if track.ArtistTrackId != "firstalbum/intro" || track.ArtistAlbumId != "firstalbum" || track.Title != "Intro" {
+		t.Errorf("expected track retitled in the new album but got %v", track)
+	}
+	if track.AlbumTrackNumber != 2 {
+		t.Errorf("expected track numbered after the opener of its new album but got %d", track.AlbumTrackNumber)
+	}
+	if _, err = os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Errorf("expected payload file moved from %s but got %v", oldPath, err)
+	}
+	payload, err := ioutil.ReadFile(artServer.TrackFilePath(track))
+	if err != nil || string(payload) != "payload of Demo" {
+		t.Errorf("expected payload moved to the new id but got %q, error: %v", payload, err)
+	}
+	storedTrack, err := artServer.Track(mockArtistID, "firstalbum/intro")
+	if err != nil || string(storedTrack.PayloadSha256) != string(payloadHash) {
+		t.Errorf("expected moved track stored with the same payload hash but got %v, error: %v", storedTrack, err)
+	}
+	if _, err = artServer.Track(mockArtistID, "demo"); err != ErrArtNotFound {
+		t.Errorf("expected track deleted from its old id but got %v", err)
+	}
+	if preview, err := artServer.TrackPreview(mockArtistID, "firstalbum/intro"); err != nil || string(preview) != "preview of Demo" {
+		t.Errorf("expected preview moved to the new id but got %q, error: %v", preview, err)
+	}
+	if plays, _, err := austkServer.TrackStats(track); err != nil || plays != 3 {
+		t.Errorf("expected stored and counted plays moved to the new id but got %d, error: %v", plays, err)
+	}
+	if stats, err := artServer.TrackStats(mockArtistID, "demo"); err != nil || stats.Plays != 0 {
+		t.Errorf("expected no stats left under the old id but got %v, error: %v", stats, err)
+	}
+	resources, err := artServer.readSavedResources(&mockArtist)
+	if err != nil || len(resources.Tracks) != 3 || len(resources.Albums) != 1 {
+		t.Errorf("expected publication with the moved track and its album but got %v, error: %v", resources, err)
+	}
+	if len(resources.GetTombstones()) != 1 || resources.Tombstones[0].ArtistTrackId != "demo" {
+		t.Errorf("expected publication with a tombstone of the old id but got %v", resources.GetTombstones())
+	}
+
+	err = austkServer.UpdateTrackMetadata(&art.Track{ArtistId: mockArtistID, ArtistTrackId: "other"}, "Intro", "First Album")
+	if !errors.Is(err, ErrTrackCollision) {
+		t.Errorf("expected ErrTrackCollision moving a track to a taken id but got %v", err)
+	}
+	if _, err = artServer.Track(mockArtistID, "other"); err != nil {
+		t.Errorf("expected track kept when its new id is taken but got %v", err)
+	}
+
+	// A directory in the way of the payload keeps the track under its old id and number in its album.
+	closer := proto.Clone(opener).(*art.Track)
+	closer.ArtistTrackId = "firstalbum/closer"
+	err = os.MkdirAll(artServer.TrackFilePath(closer), 0755)
+	if err != nil {
+		t.Fatalf("MkdirAll error: %v", err)
+	}
+	err = austkServer.UpdateTrackMetadata(&art.Track{ArtistId: mockArtistID, ArtistTrackId: "firstalbum/opener"}, "Closer", "")
+	if err == nil {
+		t.Errorf("expected error moving a payload onto a directory")
+	}
+	albumTracks, err := artServer.AlbumTracks(mockArtistID, "firstalbum")
+	if err != nil || albumTracks[1].GetArtistTrackId() != "firstalbum/opener" {
+		t.Errorf("expected track kept as the first of its album but got %v, error: %v", albumTracks, err)
+	}
+	if _, err = artServer.Track(mockArtistID, "firstalbum/closer"); err != ErrArtNotFound {
+		t.Errorf("expected no track under the new id but got %v", err)
+	}
+}
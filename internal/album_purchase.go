@@ -0,0 +1,246 @@
+package audiostrike
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/mux"
+)
+
+// TrackPurchase is the outcome of buying one track of an album with PurchaseAlbum.
+type TrackPurchase struct {
+	Track *art.Track
+	// Preimage proves payment of the track for GetTrack, or is nil for a free track or one not bought.
+	Preimage []byte
+	// Err is why the track was not bought, or nil if it was bought or is free.
+	Err error
+}
+
+// CreateAlbumInvoice creates one lightning invoice for the total effective price of the tracks of album,
+// whose preimage proves payment of each of them. The album's artist must be hosted by this server.
+// Free tracks need no payment, so they are left out of the invoice, which lists the tracks it sells.
+func (server *AustkServer) CreateAlbumInvoice(ctx context.Context, album *art.Album) (*art.AlbumInvoice, error) {
+	logger := server.logger.With("artist_id", album.ArtistId, "album_id", album.ArtistAlbumId)
+
+	artist, err := server.PublishingArtist(album.ArtistId)
+	if err != nil {
+		logger.Warn("cannot invoice album of artist not hosted", "error", err)
+		return nil, err
+	}
+	artistTracks, err := server.artServer.Tracks(album.ArtistId)
+	if err != nil {
+		logger.Error("failed to get album tracks", "error", err)
+		return nil, err
+	}
+	var tracks []*art.Track
+	var sats uint64
+	for _, track := range artistTracks {
+		if track.ArtistAlbumId != album.ArtistAlbumId {
+			continue // to next track, which is on another album
+		}
+		price, err := server.EffectiveTrackPrice(track)
+		if err != nil {
+			return nil, err
+		}
+		if price == 0 {
+			continue // to next track, which is free
+		}
+		tracks = append(tracks, track)
+		sats += price
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("album %s/%s has no tracks for sale", album.ArtistId, album.ArtistAlbumId)
+	}
+	sortTracksInAlbumOrder(tracks)
+
+	// The memo describes the album as if it were a track titled like the album.
+	albumAsTrack := &art.Track{ArtistId: album.ArtistId, ArtistAlbumId: album.ArtistAlbumId,
+		ArtistTrackId: album.ArtistAlbumId, Title: album.Title}
+	memo := resolveInvoiceMemo(server.config.invoiceMemo(), artist, albumAsTrack, sats)
+	paymentRequest, invoiceHash, err := server.publisher.AddInvoice(ctx, memo, sats)
+	if err != nil {
+		logger.Error("failed to add album invoice", "sats", sats, "error", err)
+		return nil, err
+	}
+	logger.Info("created album invoice", "event", EventInvoiceCreated, "sats", sats, "tracks", len(tracks),
+		"payment_request", paymentRequest)
+	invoicesCreatedTotal.Inc()
+
+	err = server.recordInvoice(invoiceHash, tracks)
+	if err != nil {
+		return nil, err
+	}
+
+	albumInvoice := &art.AlbumInvoice{
+		ArtistId:      album.ArtistId,
+		ArtistAlbumId: album.ArtistAlbumId,
+		Invoice: &art.Invoice{
+			ArtistId:       album.ArtistId,
+			PaymentRequest: paymentRequest,
+			InvoiceHash:    invoiceHash,
+			Sats:           sats,
+		},
+	}
+	for _, track := range tracks {
+		albumInvoice.ArtistTrackId = append(albumInvoice.ArtistTrackId, track.ArtistTrackId)
+	}
+	return albumInvoice, nil
+}
+
+// createAlbumInvoiceHandler handles requests to buy all the tracks of a specified album by a specified artist
+// by replying with one lightning invoice for them.
+func (server *AustkServer) createAlbumInvoiceHandler(w http.ResponseWriter, req *http.Request) {
+	artistID := mux.Vars(req)["artist"]
+	artistAlbumID := mux.Vars(req)["album"]
+	logger := server.logger.With("artist_id", artistID, "album_id", artistAlbumID)
+	albums, err := server.artServer.Albums(artistID)
+	if err != nil || albums[artistAlbumID] == nil {
+		logger.Info("no album to invoice", "error", err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	albumInvoice, err := server.CreateAlbumInvoice(req.Context(), albums[artistAlbumID])
+	if err != nil {
+		logger.Warn("failed to create album invoice", "error", err)
+		if errors.Is(err, ErrArtNotFound) {
+			// This server does not host the artist to sell the album.
+			w.WriteHeader(http.StatusNotFound)
+		} else if errors.Is(err, ErrLndUnavailable) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	responseData, err := proto.Marshal(albumInvoice)
+	if err != nil {
+		logger.Error("failed to marshal album invoice", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseData)
+}
+
+// PurchaseAlbum buys all the tracks of album from client's peer by paying one lightning invoice for them.
+// It refuses to pay more than the sum of the effective prices the peer published for the tracks it sells.
+// It returns a TrackPurchase for each track of the album in album order, with the preimage of the paid invoice
+// for each track sold. If the peer sold only some of the tracks with a price, the others have their Err set
+// and PurchaseAlbum returns the purchases with an error wrapping ErrPartialPurchase.
+// It fails with an error wrapping ErrFeatureMissing, without asking for an invoice, if the album has a track
+// with a price but the peer does not support FeatureAlbumInvoice.
+func (client *Client) PurchaseAlbum(album *art.Album) ([]TrackPurchase, error) {
+	logger := client.logger.With("artist_id", album.ArtistId, "album_id", album.ArtistAlbumId)
+	publication, err := client.GetScopedArtByTor(album.ArtistId, album.ArtistAlbumId)
+	if err != nil {
+		logger.Warn("failed to get album tracks", "route", client.route(), "error", err)
+		return nil, err
+	}
+	resources, err := client.validatePublication(publication)
+	if err != nil {
+		return nil, err
+	}
+	var tracks []*art.Track
+	for _, track := range resources.Tracks {
+		if track.ArtistId == album.ArtistId && track.ArtistAlbumId == album.ArtistAlbumId {
+			tracks = append(tracks, track)
+		}
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("%w: peer %s has no tracks on album %s/%s",
+			ErrArtNotFound, client.peerAddress, album.ArtistId, album.ArtistAlbumId)
+	}
+	sortTracksInAlbumOrder(tracks)
+	purchases := make([]TrackPurchase, len(tracks))
+	isForSale := false
+	for i, track := range tracks {
+		purchases[i].Track = track
+		isForSale = isForSale || track.EffectivePriceSats > 0
+	}
+	if !isForSale {
+		return purchases, nil
+	}
+	protocol, err := client.Handshake()
+	if err != nil {
+		return nil, err
+	}
+	if !protocol.Supports(FeatureAlbumInvoice) {
+		logger.Info("peer sells no albums with one invoice", "route", client.route())
+		return nil, fmt.Errorf("%w: peer %s does not support %s", ErrFeatureMissing, client.peerAddress, FeatureAlbumInvoice)
+	}
+
+	invoiceUrl := fmt.Sprintf("http://%s/albuminvoice/%s/%s", client.peerAddress, album.ArtistId, album.ArtistAlbumId)
+	albumInvoice, err := client.postAlbumInvoice(invoiceUrl)
+	if err != nil {
+		logger.Warn("failed to request album invoice", "url", invoiceUrl, "route", client.route(), "error", err)
+		return nil, err
+	}
+	isSold := make(map[string]bool)
+	for _, artistTrackID := range albumInvoice.ArtistTrackId {
+		isSold[artistTrackID] = true
+	}
+	var maxSats uint64
+	for _, track := range tracks {
+		if isSold[track.ArtistTrackId] {
+			maxSats += track.EffectivePriceSats
+		}
+	}
+
+	var preimage []byte
+	if maxSats > 0 {
+		preimage, err = client.publisher.PayInvoice(client.ctx, albumInvoice.Invoice.GetPaymentRequest(), maxSats)
+		if err != nil {
+			logger.Warn("failed to pay album invoice", "payment_request", albumInvoice.Invoice.GetPaymentRequest(),
+				"error", err)
+			return nil, err
+		}
+		logger.Info("paid for album", "sats", albumInvoice.Invoice.GetSats(), "tracks", len(albumInvoice.ArtistTrackId))
+	}
+
+	var unsoldTrackIDs []string
+	for i, track := range tracks {
+		if isSold[track.ArtistTrackId] && preimage != nil {
+			purchases[i].Preimage = preimage
+		} else if track.EffectivePriceSats > 0 {
+			purchases[i].Err = fmt.Errorf("%w: peer %s did not sell track %s/%s with album %s",
+				ErrPaymentRequired, client.peerAddress, track.ArtistId, track.ArtistTrackId, album.ArtistAlbumId)
+			unsoldTrackIDs = append(unsoldTrackIDs, track.ArtistTrackId)
+		}
+	}
+	if len(unsoldTrackIDs) > 0 {
+		logger.Warn("album partly purchased", "unsold_tracks", unsoldTrackIDs)
+		return purchases, fmt.Errorf("%w: %s/%s tracks %s",
+			ErrPartialPurchase, album.ArtistId, album.ArtistAlbumId, strings.Join(unsoldTrackIDs, ", "))
+	}
+	return purchases, nil
+}
+
+// postAlbumInvoice posts to invoiceUrl and reads the AlbumInvoice in reply.
+func (client *Client) postAlbumInvoice(invoiceUrl string) (*art.AlbumInvoice, error) {
+	response, err := client.post(invoiceUrl)
+	if err != nil {
+		return nil, client.connectionError(invoiceUrl, err)
+	}
+	defer response.Body.Close()
+	replyBytes, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, client.replyError(response, replyBytes)
+	}
+	albumInvoice := art.AlbumInvoice{}
+	err = proto.Unmarshal(replyBytes, &albumInvoice)
+	if err != nil {
+		return nil, err
+	}
+	return &albumInvoice, nil
+}
@@ -0,0 +1,154 @@
+package audiostrike
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/gorilla/mux"
+)
+
+// TestPurchaseAlbum tests that a client buys the tracks of an album with one invoice whose preimage
+// gets each of them but no track of another album, and that tracks the peer does not sell with the album
+// are reported without failing the tracks it sold, and that it buys no album from a peer without FeatureAlbumInvoice.
+func TestPurchaseAlbum(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	err = fileServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	for _, albumID := range []string{"dirt", "facelift"} {
+		err = fileServer.StoreAlbum(&art.Album{ArtistId: mockArtistID, ArtistAlbumId: albumID, Title: albumID}, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreAlbum %s error: %v", albumID, err)
+		}
+	}
+	tracks := []*art.Track{
+		{ArtistId: mockArtistID, ArtistAlbumId: "dirt", ArtistTrackId: "rooster", AlbumTrackNumber: 2, Price: &art.Price{Sats: 100}},
+		{ArtistId: mockArtistID, ArtistAlbumId: "dirt", ArtistTrackId: "thembones", AlbumTrackNumber: 1, Price: &art.Price{Sats: 200}},
+		{ArtistId: mockArtistID, ArtistAlbumId: "dirt", ArtistTrackId: "intro", AlbumTrackNumber: 3, Price: &art.Price{Sats: 0}},
+		{ArtistId: mockArtistID, ArtistAlbumId: "facelift", ArtistTrackId: "maninthebox", Price: &art.Price{Sats: 100}},
+	}
+	for _, track := range tracks {
+		err = fileServer.StoreTrack(track, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreTrack %s error: %v", track.ArtistTrackId, err)
+		}
+		err = fileServer.StoreTrackPayload(track, []byte(track.ArtistTrackId))
+		if err != nil {
+			t.Fatalf("StoreTrackPayload %s error: %v", track.ArtistTrackId, err)
+		}
+	}
+
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	// beforeAlbumInvoice, if set, changes the stored art after the client got the published album.
+	var beforeAlbumInvoice func()
+	testRouter := mux.NewRouter()
+	testRouter.HandleFunc("/handshake", austkServer.handshakeHandler).Methods("POST")
+	testRouter.HandleFunc("/", austkServer.getAllArtHandler).Methods("GET")
+	testRouter.HandleFunc("/art/{artist:[^/]*}/{track:.*}", austkServer.getArtHandler).Methods("GET")
+	testRouter.HandleFunc("/albuminvoice/{artist:[^/]*}/{album:.*}", func(w http.ResponseWriter, req *http.Request) {
+		if beforeAlbumInvoice != nil {
+			beforeAlbumInvoice()
+		}
+		austkServer.createAlbumInvoiceHandler(w, req)
+	}).Methods("POST")
+	testHttpServer := httptest.NewServer(testRouter)
+	defer testHttpServer.Close()
+	testUrl, _ := url.Parse(testHttpServer.URL)
+
+	client, err := NewClient(context.Background(), TorProxyDisabled, testUrl.Host, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	defer client.CloseConnection()
+
+	purchases, err := client.PurchaseAlbum(&art.Album{ArtistId: mockArtistID, ArtistAlbumId: "dirt"})
+	if err != nil {
+		t.Fatalf("PurchaseAlbum error: %v", err)
+	}
+	expectedTrackIDs := []string{"thembones", "rooster", "intro"}
+	if len(purchases) != len(expectedTrackIDs) {
+		t.Fatalf("expected purchases of %v but got %v", expectedTrackIDs, purchases)
+	}
+	for i, purchase := range purchases {
+		if purchase.Track.ArtistTrackId != expectedTrackIDs[i] || purchase.Err != nil {
+			t.Errorf("expected purchase of %s but got %+v", expectedTrackIDs[i], purchase)
+		}
+		isFree := purchase.Track.ArtistTrackId == "intro"
+		if isFree != (purchase.Preimage == nil) {
+			t.Errorf("expected preimage only for priced track but got %+v", purchase)
+		}
+		payload, err := client.GetTrack(mockArtistID, purchase.Track.ArtistTrackId, purchase.Preimage)
+		if err != nil || string(payload) != purchase.Track.ArtistTrackId {
+			t.Errorf("expected track %s for album preimage but got %q, error: %v",
+				purchase.Track.ArtistTrackId, payload, err)
+		}
+	}
+	_, err = client.GetTrack(mockArtistID, "maninthebox", purchases[0].Preimage)
+	if !errors.Is(err, ErrPaymentRequired) {
+		t.Errorf("expected ErrPaymentRequired for track of another album but got %v", err)
+	}
+
+	// The artist makes rooster free after the client got its price, so the peer does not sell it with the album.
+	beforeAlbumInvoice = func() {
+		freeTrack := *tracks[0]
+		freeTrack.Price = &art.Price{Sats: 0}
+		err := fileServer.StoreTrack(&freeTrack, &mockPublisher)
+		if err != nil {
+			t.Errorf("StoreTrack error: %v", err)
+		}
+	}
+	purchases, err = client.PurchaseAlbum(&art.Album{ArtistId: mockArtistID, ArtistAlbumId: "dirt", Title: "Dirt"})
+	if !errors.Is(err, ErrPartialPurchase) || len(purchases) != 3 {
+		t.Fatalf("expected ErrPartialPurchase with 3 purchases but got %v, error: %v", purchases, err)
+	}
+	if purchases[0].Preimage == nil || purchases[0].Err != nil {
+		t.Errorf("expected thembones bought but got %+v", purchases[0])
+	}
+	if purchases[1].Preimage != nil || !errors.Is(purchases[1].Err, ErrPaymentRequired) {
+		t.Errorf("expected rooster not bought but got %+v", purchases[1])
+	}
+
+	_, err = client.PurchaseAlbum(&art.Album{ArtistId: mockArtistID, ArtistAlbumId: unknownID})
+	if !errors.Is(err, ErrArtNotFound) {
+		t.Errorf("expected ErrArtNotFound buying unknown album but got %v", err)
+	}
+
+	// A peer from before the handshake sells no album with one invoice.
+	legacyRouter := mux.NewRouter()
+	legacyRouter.HandleFunc("/", austkServer.getAllArtHandler).Methods("GET")
+	legacyHttpServer := httptest.NewServer(legacyRouter)
+	defer legacyHttpServer.Close()
+	legacyUrl, _ := url.Parse(legacyHttpServer.URL)
+	legacyClient, err := NewClient(context.Background(), TorProxyDisabled, legacyUrl.Host, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	defer legacyClient.CloseConnection()
+	_, err = legacyClient.PurchaseAlbum(&art.Album{ArtistId: mockArtistID, ArtistAlbumId: "dirt"})
+	if !errors.Is(err, ErrFeatureMissing) {
+		t.Errorf("expected ErrFeatureMissing buying from a peer without %s but got %v", FeatureAlbumInvoice, err)
+	}
+}
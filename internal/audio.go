@@ -0,0 +1,225 @@
+package audiostrike
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/faiface/beep"
+)
+
+// AudioFile exposes the tags (metadata) and bytes of an audio file to add as a track.
+// Mp3, Flac, Ogg, and Wav implement AudioFile so ingest need not know the file format.
+type AudioFile interface {
+	ArtistName() string
+	Title() string
+	AlbumTitle() (string, bool)
+	// TrackNumber gets the position of the track on its album from its track number tag, or 0 if it has none.
+	TrackNumber() uint32
+	// Genres gets the genres of the genre tag, which may list several, or nil if it has none.
+	Genres() []string
+	// Year gets the four-digit release year from the year or date tag, or 0 if it has none.
+	Year() uint32
+	// Container gets the audio container format to record on the track, e.g. "mp3" or "flac".
+	Container() string
+	// Codec gets the audio codec to record on the track, e.g. "mp3", "flac", "vorbis", or "opus".
+	Codec() string
+	// CoverArt gets the picture embedded in the file to use as album cover art, or nil if it has none.
+	CoverArt() *Picture
+	// Duration gets the length of the audio, read from the file's headers where the format records it
+	// or else by decoding all of it.
+	Duration() (time.Duration, error)
+	ReadBytes() ([]byte, error)
+	// Decode opens the file to stream its audio samples. Close the streamer to close the file.
+	Decode() (beep.StreamSeekCloser, beep.Format, error)
+	PlayAndWait() error
+}
+
+// OpenAudioFile opens the audio file at path to read its data and tags.
+// The format is sniffed from the file's magic bytes, falling back to the file extension.
+func OpenAudioFile(path string) (AudioFile, error) {
+	container, err := sniffContainer(path)
+	if err != nil {
+		return nil, err
+	}
+	switch container {
+	case ContainerFlac:
+		return OpenFlacToRead(path)
+	case ContainerMp3:
+		return OpenMp3ToRead(path)
+	case ContainerOgg:
+		return OpenOggToRead(path)
+	case ContainerWav:
+		return OpenWavToRead(path)
+	}
+	return nil, fmt.Errorf("unsupported audio file type %s", path)
+}
+
+// OpenTrackAudio opens the stored payload of track in artServer as an AudioFile: its payload file,
+// or else a private temporary copy of the payload stored elsewhere, e.g. in an s3 bucket.
+// Call closeAudio when done with the AudioFile to remove any temporary copy.
+func OpenTrackAudio(artServer ArtServer, track *art.Track) (audio AudioFile, closeAudio func(), err error) {
+	if trackFilePath := artServer.TrackFilePath(track); trackFilePath != "" {
+		audio, err = OpenAudioFile(trackFilePath)
+		return audio, func() {}, err
+	}
+	payloadReader, err := artServer.TrackFilePartialReader(track, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer payloadReader.Close()
+	// The temp file is created with a random name, readable only by this user.
+	tempFile, err := ioutil.TempFile("", "austk-payload-*."+TrackContainer(track))
+	if err != nil {
+		return nil, nil, err
+	}
+	closeAudio = func() { os.Remove(tempFile.Name()) }
+	_, err = io.Copy(tempFile, payloadReader)
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		audio, err = OpenAudioFile(tempFile.Name())
+	}
+	if err != nil {
+		closeAudio()
+		return nil, nil, err
+	}
+	return audio, closeAudio, nil
+}
+
+// AudioFileArt derives from the tags of audio the art records to store for it:
+// the artist, the album if the track is on one (else nil), and the track.
+// Ids are derived from names and titles with NameToID, and album ids with TitleToHierarchy,
+// so a track on an album has an ArtistTrackId under the album's ArtistAlbumId.
+func AudioFileArt(audio AudioFile) (*art.Artist, *art.Album, *art.Track) {
+	artistName := audio.ArtistName()
+	artistID := NameToID(artistName)
+	artist := &art.Artist{
+		ArtistId: artistID,
+		Name:     artistName,
+	}
+
+	trackTitle := audio.Title()
+	track := &art.Track{
+		ArtistId:      artistID,
+		ArtistTrackId: NameToID(trackTitle),
+		Title:         trackTitle,
+		Container:     audio.Container(),
+		Codec:         audio.Codec(),
+		Genres:        audio.Genres(),
+		Year:          audio.Year(),
+	}
+
+	var album *art.Album
+	albumTitle, isInAlbum := audio.AlbumTitle()
+	if isInAlbum {
+		album = &art.Album{
+			ArtistId:      artistID,
+			ArtistAlbumId: TitleToHierarchy(albumTitle),
+			Title:         albumTitle,
+			Genres:        track.Genres,
+			Year:          track.Year,
+		}
+		track.ArtistAlbumId = album.ArtistAlbumId
+		track.ArtistTrackId = filepath.Join(album.ArtistAlbumId, track.ArtistTrackId)
+		track.AlbumTrackNumber = audio.TrackNumber()
+	}
+	return artist, album, track
+}
+
+// parseTrackNumber parses a track number tag such as "3" or "3/12", the third of twelve tracks.
+// It returns 0 if the tag is empty or malformed.
+func parseTrackNumber(tag string) uint32 {
+	number := strings.TrimSpace(strings.SplitN(tag, "/", 2)[0])
+	trackNumber, err := strconv.ParseUint(number, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(trackNumber)
+}
+
+// genreSeparators split a genre tag that lists several genres, e.g. "Grunge; Alternative Metal".
+// ID3v2.4 separates them with null characters, and a vorbis comment block with several GENRE fields
+// is read as one tag joined with semicolons.
+var genreSeparators = regexp.MustCompile(`[;,\x00]`)
+
+// id3GenreReference matches the numeric reference of an ID3v1 genre in an ID3v2 genre tag, e.g. "(6)" in "(6)Grunge".
+var id3GenreReference = regexp.MustCompile(`^\(\d+\)`)
+
+// parseGenres parses a genre tag into its genres without duplicates, ignoring case.
+// Numeric ID3v1 references, which only repeat the name of the genre if one follows, are dropped.
+func parseGenres(tag string) []string {
+	var genres []string
+	isParsed := make(map[string]bool)
+	for _, genre := range genreSeparators.Split(tag, -1) {
+		genre = strings.TrimSpace(id3GenreReference.ReplaceAllString(strings.TrimSpace(genre), ""))
+		if genre == "" || isParsed[strings.ToLower(genre)] {
+			continue // to next genre
+		}
+		isParsed[strings.ToLower(genre)] = true
+		genres = append(genres, genre)
+	}
+	return genres
+}
+
+// fourDigits matches the year in a year or date tag, e.g. in "1992", "1992-09-29", or "29/09/1992".
+var fourDigits = regexp.MustCompile(`\d{4}`)
+
+// parseYear parses the four-digit year from a year or date tag, returning 0 if the tag has none.
+func parseYear(tag string) uint32 {
+	year, err := strconv.ParseUint(fourDigits.FindString(tag), 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(year)
+}
+
+// sniffContainer identifies the audio container format of the file at path.
+func sniffContainer(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	magic := make([]byte, 12)
+	_, err = io.ReadFull(file, magic)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if bytes.HasPrefix(magic, []byte(flacMagic)) {
+		return ContainerFlac, nil
+	}
+	if bytes.HasPrefix(magic, []byte(oggMagic)) {
+		return ContainerOgg, nil
+	}
+	if bytes.HasPrefix(magic, []byte(riffMagic)) && string(magic[8:]) == waveMagic {
+		return ContainerWav, nil
+	}
+	// mp3 files start with an ID3v2 tag or with an mpeg audio frame sync.
+	if bytes.HasPrefix(magic, []byte("ID3")) || (magic[0] == 0xff && magic[1]&0xe0 == 0xe0) {
+		return ContainerMp3, nil
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac":
+		return ContainerFlac, nil
+	case ".mp3":
+		return ContainerMp3, nil
+	case ".ogg", ".oga", ".opus":
+		return ContainerOgg, nil
+	case ".wav", ".wave":
+		return ContainerWav, nil
+	}
+	return "", fmt.Errorf("unsupported audio file type %s", path)
+}
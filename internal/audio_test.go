@@ -0,0 +1,189 @@
+package audiostrike
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// TestSniffContainer verifies that the container is sniffed from magic bytes before the file extension.
+func TestSniffContainer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		filename          string
+		contents          []byte
+		expectedContainer string
+	}{
+		{"flacnamedmp3.mp3", flacWithComments("TITLE=Would?"), ContainerFlac},
+		{"id3.flac", []byte("ID3\x03\x00\x00\x00\x00\x00\x00"), ContainerMp3},
+		{"framesync", []byte{0xff, 0xfb, 0x90, 0x00}, ContainerMp3},
+		{"unknown.flac", []byte("????"), ContainerFlac},
+		{"vorbisnamedmp3.mp3", oggWithComments(CodecVorbis, "TITLE=Would?"), ContainerOgg},
+		{"unknown.opus", []byte("????"), ContainerOgg},
+		{"wavnamedflac.flac", wavWithInfo(), ContainerWav},
+		{"unknown.wav", []byte("????"), ContainerWav},
+	}
+	for _, testCase := range testCases {
+		path := filepath.Join(dir, testCase.filename)
+		err = ioutil.WriteFile(path, testCase.contents, 0644)
+		if err != nil {
+			t.Fatalf("WriteFile %s error: %v", path, err)
+		}
+		container, err := sniffContainer(path)
+		if err != nil {
+			t.Errorf("sniffContainer %s error: %v", testCase.filename, err)
+		} else if container != testCase.expectedContainer {
+			t.Errorf("expected %s container for %s but got %s", testCase.expectedContainer, testCase.filename, container)
+		}
+	}
+
+	path := filepath.Join(dir, "unknown.aiff")
+	ioutil.WriteFile(path, []byte("FORM"), 0644)
+	_, err = sniffContainer(path)
+	if err == nil {
+		t.Errorf("expected error sniffing unsupported file")
+	}
+}
+
+// TestAudioFileArt verifies the artist, album, and track ids, genres, and year derived from an audio file's tags.
+func TestAudioFileArt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		comments            []string
+		expectedAlbumID     string
+		expectedTrackID     string
+		expectedTrackNumber uint32
+		expectedGenres      []string
+		expectedYear        uint32
+	}{
+		{[]string{"ARTIST=Alice in Chains", "TITLE=Would?", "ALBUM=Dirt", "TRACKNUMBER=13/13",
+			"GENRE=Grunge", "GENRE=Alternative Metal; grunge", "DATE=1992-09-29"},
+			"dirt", filepath.Join("dirt", "would"), 13, []string{"Grunge", "Alternative Metal"}, 1992},
+		{[]string{"ARTIST=Alice in Chains", "TITLE=Would?", "TRACKNUMBER=13"}, "", "would", 0, nil, 0},
+	}
+	for _, testCase := range testCases {
+		path := filepath.Join(dir, "would.flac")
+		err = ioutil.WriteFile(path, flacWithComments(testCase.comments...), 0644)
+		if err != nil {
+			t.Fatalf("WriteFile %s error: %v", path, err)
+		}
+		audio, err := OpenAudioFile(path)
+		if err != nil {
+			t.Fatalf("OpenAudioFile %s error: %v", path, err)
+		}
+		artist, album, track := AudioFileArt(audio)
+		if artist.ArtistId != "aliceinchains" || artist.Name != "Alice in Chains" {
+			t.Errorf("expected artist aliceinchains named Alice in Chains but got %v", artist)
+		}
+		if album.GetArtistAlbumId() != testCase.expectedAlbumID || track.ArtistAlbumId != testCase.expectedAlbumID {
+			t.Errorf("expected album %q but got %v for track %v", testCase.expectedAlbumID, album, track)
+		}
+		if track.ArtistId != artist.ArtistId || track.ArtistTrackId != testCase.expectedTrackID ||
+			track.Title != "Would?" || track.Container != ContainerFlac {
+			t.Errorf("expected flac track %s titled Would? but got %v", testCase.expectedTrackID, track)
+		}
+		if track.AlbumTrackNumber != testCase.expectedTrackNumber {
+			t.Errorf("expected track number %d but got %d", testCase.expectedTrackNumber, track.AlbumTrackNumber)
+		}
+		if strings.Join(track.Genres, ",") != strings.Join(testCase.expectedGenres, ",") || track.Year != testCase.expectedYear {
+			t.Errorf("expected genres %v and year %d but got %v", testCase.expectedGenres, testCase.expectedYear, track)
+		}
+		if album != nil && (strings.Join(album.Genres, ",") != strings.Join(track.Genres, ",") || album.Year != track.Year) {
+			t.Errorf("expected album %v tagged like its track %v", album, track)
+		}
+	}
+}
+
+// TestParseTrackNumber verifies that track numbers are parsed with or without the number of tracks on the album.
+func TestParseTrackNumber(t *testing.T) {
+	tests := map[string]uint32{
+		"3":      3,
+		"03":     3,
+		"3/12":   3,
+		" 3 /12": 3,
+		"":       0,
+		"/12":    0,
+		"A1":     0,
+	}
+	for tag, expected := range tests {
+		actual := parseTrackNumber(tag)
+		if actual != expected {
+			t.Errorf("expected track number %d from tag %q but got %d", expected, tag, actual)
+		}
+	}
+}
+
+// TestParseGenres verifies that a genre tag listing several genres is split into each genre once,
+// without ID3v1 references.
+func TestParseGenres(t *testing.T) {
+	tests := map[string][]string{
+		"Grunge":                          {"Grunge"},
+		"Grunge; Alternative Metal":       {"Grunge", "Alternative Metal"},
+		"Grunge\x00Alternative Metal\x00": {"Grunge", "Alternative Metal"},
+		"Rock, Hard Rock;rock":            {"Rock", "Hard Rock"},
+		"(6)Grunge":                       {"Grunge"},
+		"(17)":                            nil,
+		" ; ":                             nil,
+		"Drum & Bass/Jungle":              {"Drum & Bass/Jungle"},
+	}
+	for tag, expected := range tests {
+		actual := parseGenres(tag)
+		if strings.Join(actual, "|") != strings.Join(expected, "|") {
+			t.Errorf("expected genres %q from tag %q but got %q", expected, tag, actual)
+		}
+	}
+}
+
+// TestParseYear verifies that the four-digit year is parsed from years and full dates.
+func TestParseYear(t *testing.T) {
+	tests := map[string]uint32{
+		"1992":                 1992,
+		"1992-09-29":           1992,
+		"1992-09-29T00:00:00Z": 1992,
+		"29/09/1992":           1992,
+		"19920929":             1992,
+		"'92":                  0,
+		"":                     0,
+	}
+	for tag, expected := range tests {
+		actual := parseYear(tag)
+		if actual != expected {
+			t.Errorf("expected year %d from tag %q but got %d", expected, tag, actual)
+		}
+	}
+}
+
+// TestSortTracksInAlbumOrder verifies that album tracks sort by track number, then unnumbered tracks by title,
+// then singles.
+func TestSortTracksInAlbumOrder(t *testing.T) {
+	tracks := []*art.Track{
+		{ArtistId: "alice", ArtistTrackId: "single", Title: "Single"},
+		{ArtistId: "alice", ArtistAlbumId: "dirt", ArtistTrackId: "dirt/bonus", Title: "Bonus"},
+		{ArtistId: "alice", ArtistAlbumId: "dirt", ArtistTrackId: "dirt/would", Title: "Would?", AlbumTrackNumber: 13},
+		{ArtistId: "alice", ArtistAlbumId: "dirt", ArtistTrackId: "dirt/rain", Title: "Rain When I Die", AlbumTrackNumber: 2},
+		{ArtistId: "alice", ArtistAlbumId: "dirt", ArtistTrackId: "dirt/acoustic", Title: "Acoustic"},
+		{ArtistId: "alice", ArtistAlbumId: "dirt", ArtistTrackId: "dirt/them", Title: "Them Bones", AlbumTrackNumber: 1},
+		{ArtistId: "aaron", ArtistTrackId: "song", Title: "Song"},
+	}
+	sortTracksInAlbumOrder(tracks)
+	expectedTrackIDs := []string{"song", "dirt/them", "dirt/rain", "dirt/would", "dirt/acoustic", "dirt/bonus", "single"}
+	for i, track := range tracks {
+		if track.ArtistTrackId != expectedTrackIDs[i] {
+			t.Errorf("expected track %s at %d but got %s", expectedTrackIDs[i], i, track.ArtistTrackId)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package audiostrike
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	// QuotaPeriodCalendar resets the quota of each peer on the first of each month, UTC.
+	QuotaPeriodCalendar = "calendar"
+	// QuotaPeriodRolling counts the bytes served to each peer in the last 30 days against its quota.
+	QuotaPeriodRolling = "rolling"
+
+	rollingQuotaDays = 30
+	// bandwidthDays is how many days of bytes served to each peer are kept, enough for either quota period.
+	bandwidthDays = 31
+	secondsPerDay = 24 * 60 * 60
+
+	// bandwidthFlushInterval is how often a bandwidthMeter stores the bytes it counted,
+	// so that serving a response does not rewrite the bandwidth of every peer.
+	bandwidthFlushInterval = time.Minute
+	// maxPendingBandwidths is how many clients a bandwidthMeter counts before it stores their bytes early.
+	maxPendingBandwidths = 4096
+)
+
+// bandwidthMeter counts the bytes of payloads served to each peer in an ArtServer,
+// and checks them against the monthly quota of each peer if any.
+// It keeps the bytes counted in memory and stores them every bandwidthFlushInterval and by flush.
+type bandwidthMeter struct {
+	artServer    ArtServer
+	monthlyQuota uint64
+	quotaPeriod  string
+
+	// pending maps each client to its bandwidth counted since it was last stored.
+	pending     map[string]*art.PeerBandwidth
+	lastFlushAt time.Time
+	// mutex serializes counting bytes, which reads then stores the bandwidth of a peer, and locks pending.
+	mutex sync.Mutex
+
+	// now gets the current time.
+	now    func() time.Time
+	logger *slog.Logger
+}
+
+// newBandwidthMeter creates a bandwidthMeter storing the bytes served to each peer in artServer,
+// with a monthlyQuota of bytes for each peer counted over quotaPeriod, or no quota if monthlyQuota is 0.
+func newBandwidthMeter(artServer ArtServer, monthlyQuota uint64, quotaPeriod string) *bandwidthMeter {
+	return &bandwidthMeter{
+		artServer:    artServer,
+		monthlyQuota: monthlyQuota,
+		quotaPeriod:  quotaPeriod,
+		pending:      make(map[string]*art.PeerBandwidth),
+		now:          time.Now,
+		logger:       componentLogger("bandwidthMeter"),
+	}
+}
+
+// record counts bytes served today to the peer with pubkey, forgetting the days too old for any quota.
+// It stores the bytes counted for every peer if they were last stored bandwidthFlushInterval ago.
+func (meter *bandwidthMeter) record(pubkey string, bytes uint64) {
+	if bytes == 0 {
+		return
+	}
+	peerBytesServedTotal.Add(float64(bytes))
+
+	meter.mutex.Lock()
+	defer meter.mutex.Unlock()
+	bandwidth, err := meter.peerBandwidthLocked(pubkey)
+	if err != nil {
+		meter.logger.Error("failed to get peer bandwidth", "peer", pubkey, "error", err)
+		return
+	}
+	now := meter.now()
+	today := uint64(now.Unix()) / secondsPerDay
+	bandwidth.TotalBytes += bytes
+	lastDay := len(bandwidth.Days) - 1
+	if lastDay >= 0 && bandwidth.Days[lastDay].Day == today {
+		bandwidth.Days[lastDay].Bytes += bytes
+	} else {
+		bandwidth.Days = append(bandwidth.Days, &art.DailyBandwidth{Day: today, Bytes: bytes})
+	}
+	for len(bandwidth.Days) > 0 && bandwidth.Days[0].Day+bandwidthDays <= today {
+		bandwidth.Days = bandwidth.Days[1:]
+	}
+	meter.pending[pubkey] = bandwidth
+	if now.Sub(meter.lastFlushAt) >= bandwidthFlushInterval || len(meter.pending) >= maxPendingBandwidths {
+		meter.flushLocked()
+	}
+}
+
+// flush stores the bytes counted for each peer since they were last stored, e.g. as the server shuts down.
+func (meter *bandwidthMeter) flush() {
+	meter.mutex.Lock()
+	defer meter.mutex.Unlock()
+	meter.flushLocked()
+}
+
+// flushLocked stores the pending bandwidths, keeping any that fail to store to try again.
+// The caller must hold meter.mutex.
+func (meter *bandwidthMeter) flushLocked() {
+	meter.lastFlushAt = meter.now()
+	for pubkey, bandwidth := range meter.pending {
+		err := meter.artServer.StorePeerBandwidth(bandwidth)
+		if err != nil {
+			meter.logger.Error("failed to store peer bandwidth", "peer", pubkey, "error", err)
+			continue
+		}
+		delete(meter.pending, pubkey)
+	}
+}
+
+// forget drops the bytes counted for the peer with pubkey and not stored yet, e.g. as the peer is deleted.
+func (meter *bandwidthMeter) forget(pubkey string) {
+	meter.mutex.Lock()
+	defer meter.mutex.Unlock()
+	delete(meter.pending, pubkey)
+}
+
+// peerBandwidth gets the bytes served to the peer with pubkey, including those not stored yet.
+// The bandwidth is a copy.
+func (meter *bandwidthMeter) peerBandwidth(pubkey string) (*art.PeerBandwidth, error) {
+	meter.mutex.Lock()
+	defer meter.mutex.Unlock()
+	bandwidth, err := meter.peerBandwidthLocked(pubkey)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Clone(bandwidth).(*art.PeerBandwidth), nil
+}
+
+// peerBandwidthLocked gets the pending bandwidth of the peer with pubkey, or else its stored bandwidth.
+// The caller must hold meter.mutex.
+func (meter *bandwidthMeter) peerBandwidthLocked(pubkey string) (*art.PeerBandwidth, error) {
+	if bandwidth, isPending := meter.pending[pubkey]; isPending {
+		return bandwidth, nil
+	}
+	return meter.artServer.PeerBandwidth(pubkey)
+}
+
+// monthlyBytes gets the bytes served to the peer of bandwidth in the quota period as of now:
+// since the first of this month for a calendar period, or in the last 30 days for a rolling period.
+func (meter *bandwidthMeter) monthlyBytes(bandwidth *art.PeerBandwidth) uint64 {
+	now := meter.now().UTC()
+	firstDay := uint64(now.Unix())/secondsPerDay + 1 - rollingQuotaDays
+	if meter.quotaPeriod != QuotaPeriodRolling {
+		firstDay = uint64(now.Unix())/secondsPerDay + 1 - uint64(now.Day())
+	}
+	var bytes uint64
+	for _, day := range bandwidth.Days {
+		if day.Day >= firstDay {
+			bytes += day.Bytes
+		}
+	}
+	return bytes
+}
+
+// checkQuota checks that the peer with pubkey has not been served its monthly quota of bytes.
+// It returns an error wrapping ErrQuotaExceeded if it has, and how long until the quota may allow more.
+func (meter *bandwidthMeter) checkQuota(pubkey string) (retryAfter time.Duration, err error) {
+	if meter.monthlyQuota == 0 {
+		return 0, nil
+	}
+	bandwidth, err := meter.peerBandwidth(pubkey)
+	if err != nil {
+		return 0, err
+	}
+	bytes := meter.monthlyBytes(bandwidth)
+	if bytes < meter.monthlyQuota {
+		return 0, nil
+	}
+
+	// A rolling quota may allow more when the oldest day drops out tomorrow, a calendar quota next month.
+	now := meter.now().UTC()
+	reset := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	if meter.quotaPeriod != QuotaPeriodRolling {
+		reset = time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return reset.Sub(now), fmt.Errorf("%w: peer %s was served %d bytes of its %d byte quota per %s month",
+		ErrQuotaExceeded, pubkey, bytes, meter.monthlyQuota, meter.quotaPeriod)
+}
+
+// PeerBandwidth gets the total bytes of payloads served to the peer with pubkey.
+func (server *AustkServer) PeerBandwidth(pubkey string) (uint64, error) {
+	bandwidth, err := server.bandwidth.peerBandwidth(pubkey)
+	if err != nil {
+		return 0, err
+	}
+	return bandwidth.TotalBytes, nil
+}
+
+// bandwidthClient gets the client that req counts against in quotas: the pubkey it proved to peersOnly,
+// or else its remote address without the port, since the pubkey it claims in PubkeyHeader is not proven.
+func bandwidthClient(req *http.Request) string {
+	if pubkey := provenPubkey(req); pubkey != "" {
+		return pubkey
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return "address " + host
+}
+
+// rejectOverQuota replies 429 Too Many Requests, with a Retry-After header, to a request from a client
+// that has been served its monthly quota of bytes, and checks whether it did.
+func (server *AustkServer) rejectOverQuota(w http.ResponseWriter, req *http.Request) bool {
+	client := bandwidthClient(req)
+	retryAfter, err := server.bandwidth.checkQuota(client)
+	if err == nil {
+		return false
+	}
+	if retryAfter == 0 {
+		// Serve the peer rather than fail for want of its bandwidth.
+		server.logger.Error("failed to check peer quota", "peer", client, "error", err)
+		return false
+	}
+	server.logger.Info("reject request over quota", "peer", client, "url", req.URL.Path, "error", err)
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+	return true
+}
+
+// recordBandwidth counts bytes served in reply to req against its client.
+func (server *AustkServer) recordBandwidth(req *http.Request, bytes uint64) {
+	server.bandwidth.record(bandwidthClient(req), bytes)
+}
@@ -0,0 +1,132 @@
+package audiostrike
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/gorilla/mux"
+)
+
+// TestBandwidthQuotaPeriods verifies that the bytes served to a peer are totalled,
+// counted against its quota since the first of the month or over the last 30 days,
+// and stored when flushed.
+func TestBandwidthQuotaPeriods(t *testing.T) {
+	now := time.Date(2020, time.March, 30, 12, 0, 0, 0, time.UTC)
+	artServer := NewMemoryArtServer()
+	calendar := newBandwidthMeter(artServer, 1000, QuotaPeriodCalendar)
+	rolling := newBandwidthMeter(artServer, 1000, QuotaPeriodRolling)
+	for _, meter := range []*bandwidthMeter{calendar, rolling} {
+		meter.now = func() time.Time { return now }
+	}
+
+	calendar.record(mockPubkey, 600)
+	now = now.Add(2 * 24 * time.Hour) // April 1
+	calendar.record(mockPubkey, 300)
+	calendar.record(mockPubkey, 100)
+
+	bandwidth, err := artServer.PeerBandwidth(mockPubkey)
+	if err != nil || bandwidth.TotalBytes != 900 {
+		t.Errorf("expected 900 bytes stored before the flush interval passed but got %v, error: %v", bandwidth, err)
+	}
+	calendar.flush()
+	bandwidth, err = artServer.PeerBandwidth(mockPubkey)
+	if err != nil || bandwidth.TotalBytes != 1000 || len(bandwidth.Days) != 2 {
+		t.Fatalf("expected 1000 bytes served over 2 days but got %v, error: %v", bandwidth, err)
+	}
+	if bytes := calendar.monthlyBytes(bandwidth); bytes != 400 {
+		t.Errorf("expected 400 bytes served since April 1 but got %d", bytes)
+	}
+	if _, err := calendar.checkQuota(mockPubkey); err != nil {
+		t.Errorf("expected calendar quota not exceeded but got %v", err)
+	}
+	retryAfter, err := rolling.checkQuota(mockPubkey)
+	if !errors.Is(err, ErrQuotaExceeded) || retryAfter != 12*time.Hour {
+		t.Errorf("expected rolling quota exceeded until tomorrow but got %v, error: %v", retryAfter, err)
+	}
+
+	now = now.Add(rollingQuotaDays * 24 * time.Hour)
+	calendar.record(mockPubkey, 1)
+	bandwidth, _ = artServer.PeerBandwidth(mockPubkey)
+	if bandwidth.TotalBytes != 1001 || len(bandwidth.Days) != 2 || bandwidth.Days[0].Bytes != 400 {
+		t.Errorf("expected days older than any quota period forgotten but got %v", bandwidth)
+	}
+}
+
+// TestDownloadOverQuota verifies that a download is counted against the peer that proves its pubkey,
+// or else against the client's address, not the pubkey it claims, and that the client is refused
+// with 429 Too Many Requests once it has been served its quota.
+func TestDownloadOverQuota(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	artServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	quotaCfg := *cfg
+	quotaCfg.PeerMonthlyQuota = 10
+	austkServer, err := NewAustkServer(&quotaCfg, artServer, &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "quota", Title: "Quota", Price: &art.Price{Sats: 0}}
+	err = artServer.StoreTrack(track, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	err = artServer.StoreTrackPayload(track, []byte("twelve bytes"))
+	if err != nil {
+		t.Fatalf("StoreTrackPayload error: %v", err)
+	}
+	download := func(isProven bool) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/art/"+mockArtistID+"/quota", nil)
+		request.RemoteAddr = "192.0.2.1:1234"
+		if isProven {
+			request = withProvenPubkey(request, mockPubkey)
+		} else {
+			request.Header.Set(PubkeyHeader, mockPubkey)
+		}
+		request = mux.SetURLVars(request, map[string]string{"artist": mockArtistID, "track": "quota"})
+		recorder := httptest.NewRecorder()
+		austkServer.getArtHandler(recorder, request)
+		return recorder
+	}
+
+	if response := download(true); response.Code != http.StatusOK {
+		t.Fatalf("expected download served but got %d", response.Code)
+	}
+	servedBytes, err := austkServer.PeerBandwidth(mockPubkey)
+	if err != nil || servedBytes != 12 {
+		t.Errorf("expected 12 bytes served to peer but got %d, error: %v", servedBytes, err)
+	}
+	response := download(true)
+	if response.Code != http.StatusTooManyRequests || response.Header().Get("Retry-After") == "" {
+		t.Errorf("expected download over quota refused with Retry-After but got %d", response.Code)
+	}
+
+	// A client that only claims the pubkey is metered by its address instead.
+	if response := download(false); response.Code != http.StatusOK {
+		t.Fatalf("expected download by unproven client served but got %d", response.Code)
+	}
+	servedBytes, err = austkServer.PeerBandwidth("address 192.0.2.1")
+	if err != nil || servedBytes != 12 {
+		t.Errorf("expected 12 bytes served to the client's address but got %d, error: %v", servedBytes, err)
+	}
+	if response := download(false); response.Code != http.StatusTooManyRequests {
+		t.Errorf("expected download by unproven client over quota refused but got %d", response.Code)
+	}
+
+	austkServer.bandwidth.flush()
+	bandwidth, err := artServer.PeerBandwidth(mockPubkey)
+	if err != nil || bandwidth.TotalBytes != 12 {
+		t.Errorf("expected 12 bytes served to peer stored in the .bandwidth file but got %v, error: %v", bandwidth, err)
+	}
+}
@@ -0,0 +1,355 @@
+package audiostrike
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultRecentLimit is how many recent tracks to list without a ?limit, and maxRecentLimit the most to list.
+	defaultRecentLimit = 20
+	maxRecentLimit     = 100
+)
+
+// Catalog is the JSON view of an artist's albums and tracks for web front-ends
+// that do not speak the protobuf sync protocol.
+type Catalog struct {
+	ArtistID string         `json:"artistId"`
+	Name     string         `json:"name"`
+	Pubkey   string         `json:"pubkey"`
+	Albums   []CatalogAlbum `json:"albums"`
+	Tracks   []CatalogTrack `json:"tracks"`
+	// UpdatedAt is the Unix time of the latest update to the artist's art, served as Last-Modified.
+	UpdatedAt uint64 `json:"updatedAt,omitempty"`
+}
+
+// CatalogAlbum is the JSON view of an album in a Catalog.
+type CatalogAlbum struct {
+	ArtistAlbumID string `json:"artistAlbumId"`
+	Title         string `json:"title"`
+	// PriceSats is the price set for each track on the album without its own price, if any.
+	PriceSats *uint64 `json:"priceSats,omitempty"`
+	// CoverArtMime is the mime type of the album's cover art, served at /cover/{artistId}/{artistAlbumId}, if any.
+	CoverArtMime string `json:"coverArtMime,omitempty"`
+	// Genres and Year are the genres and four-digit release year tagged on the album's tracks, if any.
+	Genres []string `json:"genres,omitempty"`
+	Year   uint32   `json:"year,omitempty"`
+}
+
+// CatalogTrack is the JSON view of a track in a Catalog.
+type CatalogTrack struct {
+	ArtistTrackID string `json:"artistTrackId"`
+	ArtistAlbumID string `json:"artistAlbumId,omitempty"`
+	// TrackNumber is the position of the track on its album, if known.
+	TrackNumber uint32 `json:"trackNumber,omitempty"`
+	Title       string `json:"title"`
+	Container   string `json:"container"`
+	Codec       string `json:"codec"`
+	// PriceSats is the effective price to buy the track.
+	PriceSats uint64 `json:"priceSats"`
+	// PayloadSha256 is the hex SHA-256 hash of the track payload, if recorded.
+	PayloadSha256 string `json:"payloadSha256,omitempty"`
+	// PayloadCid is the IPFS CID of the track payload, if pinned in IPFS.
+	PayloadCid string `json:"payloadCid,omitempty"`
+	// PreviewSeconds is the length of the free preview clip, served at /preview/{artistId}/{artistTrackId}, if any.
+	PreviewSeconds uint32 `json:"previewSeconds,omitempty"`
+	// Genres and Year are the genres and four-digit release year tagged on the track, if any.
+	Genres []string `json:"genres,omitempty"`
+	Year   uint32   `json:"year,omitempty"`
+	// DurationMs is the length of the track in milliseconds, if measured.
+	DurationMs uint32 `json:"durationMs,omitempty"`
+	// LoudnessLufs and SamplePeak are the loudness of the track payload to normalize its volume, if measured.
+	LoudnessLufs *float64 `json:"loudnessLufs,omitempty"`
+	SamplePeak   *float64 `json:"samplePeak,omitempty"`
+	// Plays and Purchases are how often this node played and sold the track, listed only with -catalogstats.
+	Plays     *uint64 `json:"plays,omitempty"`
+	Purchases *uint64 `json:"purchases,omitempty"`
+}
+
+// RecentCatalog is the JSON view of the tracks most recently added to this node by any artists, newest first.
+type RecentCatalog struct {
+	Tracks []RecentTrack `json:"tracks"`
+}
+
+// RecentTrack is the JSON view of a track in a RecentCatalog.
+type RecentTrack struct {
+	ArtistID string `json:"artistId"`
+	CatalogTrack
+	// CreatedAt is the Unix time the artist's node first stored the track, if recorded.
+	CreatedAt uint64 `json:"createdAt,omitempty"`
+}
+
+// PeersCatalog is the JSON view of the stored peers and how recently each was reachable,
+// e.g. for a dashboard of the node's peers.
+type PeersCatalog struct {
+	Peers []CatalogPeer `json:"peers"`
+}
+
+// CatalogPeer is the JSON view of a peer in a PeersCatalog.
+type CatalogPeer struct {
+	Pubkey string `json:"pubkey"`
+	Host   string `json:"host"`
+	Port   uint32 `json:"port"`
+	// LastSeenAt is the Unix time the peer last answered a sync from this node, if ever.
+	LastSeenAt uint64 `json:"lastSeenAt,omitempty"`
+	// LastReachableAt is the Unix time of the last successful sync from the peer, if ever.
+	LastReachableAt uint64 `json:"lastReachableAt,omitempty"`
+	// BytesServed is the total bytes of payloads served to the peer, and MonthlyBytesServed those in its quota period.
+	BytesServed        uint64 `json:"bytesServed"`
+	MonthlyBytesServed uint64 `json:"monthlyBytesServed"`
+}
+
+// ArtistCatalog gets the catalog of the artist with artistID from the resources this server publishes,
+// or ErrArtNotFound if no such artist is stored.
+func (server *AustkServer) ArtistCatalog(artistID string) (*Catalog, error) {
+	artist, err := server.artServer.Artist(artistID)
+	if err != nil {
+		return nil, err
+	}
+	if artist == nil {
+		return nil, ErrArtNotFound
+	}
+	resources, err := server.CollectResources()
+	if err != nil {
+		return nil, err
+	}
+	catalog := &Catalog{
+		ArtistID:  artist.ArtistId,
+		Name:      artist.Name,
+		Pubkey:    artist.Pubkey,
+		Albums:    []CatalogAlbum{},
+		Tracks:    []CatalogTrack{},
+		UpdatedAt: latestUpdate(artistResources(resources, artistID, false)),
+	}
+	for _, album := range resources.Albums {
+		if album.ArtistId == artistID {
+			catalog.Albums = append(catalog.Albums, catalogAlbum(album))
+		}
+	}
+	for _, track := range resources.Tracks {
+		if track.ArtistId == artistID {
+			catalogTrack := catalogTrack(track)
+			if server.config.CatalogStats {
+				plays, purchases, err := server.TrackStats(track)
+				if err != nil {
+					return nil, err
+				}
+				catalogTrack.Plays, catalogTrack.Purchases = &plays, &purchases
+			}
+			catalog.Tracks = append(catalog.Tracks, catalogTrack)
+		}
+	}
+	return catalog, nil
+}
+
+// RecentCatalog gets the catalog of at most limit tracks most recently added to this node.
+// Tracks of hosted artists are priced as published, and tracks synced from peers at the price their peer published.
+func (server *AustkServer) RecentCatalog(limit int) (*RecentCatalog, error) {
+	tracks, err := server.artServer.RecentTracks(limit)
+	if err != nil {
+		return nil, err
+	}
+	catalog := &RecentCatalog{Tracks: []RecentTrack{}}
+	for _, track := range tracks {
+		recentTrack := RecentTrack{
+			ArtistID:     track.ArtistId,
+			CatalogTrack: catalogTrack(track),
+			CreatedAt:    track.CreatedAt,
+		}
+		if _, err := server.PublishingArtist(track.ArtistId); err == nil {
+			recentTrack.PriceSats, err = server.EffectiveTrackPrice(track)
+			if err != nil {
+				return nil, err
+			}
+		}
+		catalog.Tracks = append(catalog.Tracks, recentTrack)
+	}
+	return catalog, nil
+}
+
+// PeersCatalog gets the catalog of the stored peers, ordered by pubkey.
+func (server *AustkServer) PeersCatalog() (*PeersCatalog, error) {
+	peers, err := server.artServer.Peers()
+	if err != nil {
+		return nil, err
+	}
+	catalog := &PeersCatalog{Peers: []CatalogPeer{}}
+	for pubkey, peer := range peers {
+		reputation, err := server.artServer.PeerReputation(pubkey)
+		if err != nil {
+			return nil, err
+		}
+		bandwidth, err := server.bandwidth.peerBandwidth(pubkey)
+		if err != nil {
+			return nil, err
+		}
+		catalog.Peers = append(catalog.Peers, CatalogPeer{
+			Pubkey:          peer.Pubkey,
+			Host:            peer.Host,
+			Port:            peer.Port,
+			LastSeenAt:      reputation.LastSeenAt,
+			LastReachableAt: reputation.LastReachableAt,
+
+			BytesServed:        bandwidth.TotalBytes,
+			MonthlyBytesServed: server.bandwidth.monthlyBytes(bandwidth),
+		})
+	}
+	sort.Slice(catalog.Peers, func(i, j int) bool { return catalog.Peers[i].Pubkey < catalog.Peers[j].Pubkey })
+	return catalog, nil
+}
+
+// catalogAlbum gets the JSON view of album.
+func catalogAlbum(album *art.Album) CatalogAlbum {
+	catalogAlbum := CatalogAlbum{
+		ArtistAlbumID: album.ArtistAlbumId,
+		Title:         album.Title,
+		CoverArtMime:  album.CoverArtMime,
+		Genres:        album.Genres,
+		Year:          album.Year,
+	}
+	if album.Price != nil {
+		sats := album.Price.Sats
+		catalogAlbum.PriceSats = &sats
+	}
+	return catalogAlbum
+}
+
+// catalogTrack gets the JSON view of track, priced at its EffectivePriceSats.
+func catalogTrack(track *art.Track) CatalogTrack {
+	catalogTrack := CatalogTrack{
+		ArtistTrackID: track.ArtistTrackId,
+		ArtistAlbumID: track.ArtistAlbumId,
+		TrackNumber:   track.AlbumTrackNumber,
+		Title:         track.Title,
+		Container:     TrackContainer(track),
+		Codec:         TrackCodec(track),
+		PriceSats:     track.EffectivePriceSats,
+		PayloadSha256: hex.EncodeToString(track.PayloadSha256),
+		PayloadCid:    track.PayloadCid,
+
+		PreviewSeconds: track.PreviewSeconds,
+		DurationMs:     track.DurationMs,
+		Genres:         track.Genres,
+		Year:           track.Year,
+	}
+	if track.Loudness != nil {
+		lufs, peak := track.Loudness.IntegratedLufs, track.Loudness.SamplePeak
+		catalogTrack.LoudnessLufs = &lufs
+		catalogTrack.SamplePeak = &peak
+	}
+	return catalogTrack
+}
+
+// catalogHandler handles requests for an artist's catalog by replying with it as JSON.
+func (server *AustkServer) catalogHandler(w http.ResponseWriter, req *http.Request) {
+	artistID := mux.Vars(req)["artist"]
+	logger := server.logger.With("artist_id", artistID)
+	catalog, err := server.ArtistCatalog(artistID)
+	if errors.Is(err, ErrArtNotFound) {
+		logger.Info("no artist for catalog", "error", err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		logger.Error("failed to get catalog", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	responseData, err := json.Marshal(catalog)
+	if err != nil {
+		logger.Error("failed to marshal catalog", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// The same art always marshals to the same catalog, so its hash tags the catalog for a client polling it.
+	catalogHash := sha256.Sum256(responseData)
+	etag := `"` + hex.EncodeToString(catalogHash[:]) + `"`
+	w.Header().Set("ETag", etag)
+	if catalog.UpdatedAt > 0 {
+		w.Header().Set("Last-Modified", time.Unix(int64(catalog.UpdatedAt), 0).UTC().Format(http.TimeFormat))
+	}
+	// Deleting art does not advance UpdatedAt, so only the ETag tells whether the catalog is unchanged.
+	if isETagMatched(req.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseData)
+}
+
+// isETagMatched checks whether the If-None-Match header ifNoneMatch lists etag, or is "*",
+// comparing weakly as for a GET.
+func isETagMatched(ifNoneMatch string, etag string) bool {
+	for _, listed := range strings.Split(ifNoneMatch, ",") {
+		listed = strings.TrimSpace(listed)
+		if listed == "*" || strings.TrimPrefix(listed, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// peersCatalogHandler handles requests for the catalog of stored peers by replying with it as JSON.
+func (server *AustkServer) peersCatalogHandler(w http.ResponseWriter, req *http.Request) {
+	catalog, err := server.PeersCatalog()
+	if err != nil {
+		server.logger.Error("failed to get peers catalog", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	responseData, err := json.Marshal(catalog)
+	if err != nil {
+		server.logger.Error("failed to marshal peers catalog", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseData)
+}
+
+// recentHandler handles requests for the tracks most recently added to this node by replying with them as JSON.
+// The ?limit parameter sets how many tracks to list, up to maxRecentLimit.
+func (server *AustkServer) recentHandler(w http.ResponseWriter, req *http.Request) {
+	limit := defaultRecentLimit
+	if limitParam := req.URL.Query().Get("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 0 {
+			server.logger.Info("invalid limit for recent tracks", "limit", limitParam)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if limit > maxRecentLimit {
+			limit = maxRecentLimit
+		}
+	}
+	catalog, err := server.RecentCatalog(limit)
+	if err != nil {
+		server.logger.Error("failed to get recent tracks", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	responseData, err := json.Marshal(catalog)
+	if err != nil {
+		server.logger.Error("failed to marshal recent tracks", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseData)
+}
@@ -1,47 +1,120 @@
 package audiostrike
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	art "github.com/audiostrike/music/pkg/art"
 	"github.com/cretz/bine/tor"
 	"github.com/golang/protobuf/proto"
 	"google.golang.org/grpc"
-	"log"
+	"log/slog"
 )
 
+// downloadAttempts is how many times DownloadTracks tries to download a track,
+// resuming after the bytes already downloaded if the connection drops.
+const downloadAttempts = 3
+
+// TorProxyDisabled configured as the tor proxy makes clients dial every peer directly, even .onion hosts.
+const TorProxyDisabled = "disabled"
+
+// Client talks to one austk peer: it gets the peer's signed catalog of art, buys and downloads tracks,
+// and syncs the peer's art into an ArtServer. The austk command uses it from Connect;
+// being under internal, it cannot be imported from outside this module.
+//
+// Its methods fail with errors that wrap the sentinel errors of this package, to check with errors.Is:
+// ErrPeerUnreachable if the peer cannot be reached, ErrIncompatiblePeer if it speaks no protocol in common,
+// ErrArtNotFound, ErrPaymentRequired, or ErrRateLimited as the peer replies,
+// ErrSignatureInvalid or ErrPubkeyMismatch for art not signed by its artist, and ErrPayloadMismatch
+// for a payload that does not match the hash its artist published.
+//
+// A Client is not safe for concurrent use: it keeps the state of one session with its peer,
+// e.g. the negotiated protocol and the art last synced. Use a Client from one goroutine at a time,
+// and a ClientPool, which is safe for concurrent use, to share connections to peers between goroutines.
 type Client struct {
 	peerAddress      string
-	torClient        *http.Client
+	httpClient       *http.Client
 	torProxy         string
 	connectionCtx    context.Context
 	connectionCancel context.CancelFunc
+	// ctx is the caller's context for the client's session, which cancels its lnd calls when done.
+	ctx context.Context
+	// isBroken is set when the client fails to connect to its peer, so that a ClientPool evicts it.
+	isBroken bool
+	// peerVersion is the austk Version the peer last named, to warn once if it is incompatible.
+	peerVersion string
+	// protocol is the sync protocol negotiated with the peer by Handshake for the session, or nil before.
+	protocol *Handshake
+	// compression is the codec in which to ask the peer for its art, if it supports it.
+	compression string
+	// ipfs fetches the payloads of tracks pinned in IPFS, if an IPFS node or gateway is configured, or else is nil.
+	ipfs *IPFSNode
 
 	// publisher signs/checks signature of an artist's resources for a publication.
 	publisher Publisher
+	// pubkey of publisher, got once to name this node to a private peer in each request.
+	pubkey      string
+	isPubkeyGot bool
+	// isPeerPrivate is set for a peer that serves only allowed peers, to prove this node's pubkey to.
+	isPeerPrivate bool
+	// challenge is the challenge of a private peer that the client signed with challengeSignature,
+	// binding the client's sessionKey, to prove its pubkey in each request, or empty for a public peer.
+	// Each request is numbered by requestSequence and has a mac keyed by sessionMacKey.
+	challenge          string
+	challengeSignature string
+	sessionKey         string
+	sessionMacKey      []byte
+	requestSequence    uint64
+	authenticatedAt    time.Time
 	// publishedArtist, publications, and resources are art resources this peer published.
 	publishedArtists map[string]*art.Artist
 	publications     map[string]*art.ArtistPublication
 	resources        map[string]*art.ArtResources
+
+	logger *slog.Logger
 }
 
-// NewClient creates a new austk Client to communicate over torProxy with peerAddress.
-func NewClient(torProxy string, peerAddress string, publisher Publisher) (*Client, error) {
-	const logPrefix = "client NewClient "
+// NewClient creates a new austk Client to communicate with peerAddress,
+// over the torProxy for an .onion host or else directly.
+// A torProxy of "" or TorProxyDisabled dials every peer directly, e.g. to test peers on a LAN.
+// Cancelling ctx cancels the client's calls to lnd through publisher, e.g. to pay for tracks.
+func NewClient(ctx context.Context, torProxy string, peerAddress string, publisher Publisher) (*Client, error) {
+	logger := componentLogger("client").With("peer_address", peerAddress)
 
-	ctx := context.Background()
 	// Wait a few minutes to connect to tor network.
 	connectionCtx, connectionCancel := context.WithTimeout(ctx, 3*time.Minute)
 
-	torClient, err := newTorClient(torProxy)
-	if err != nil {
-		return nil, err
+	if !isOnionAddress(peerAddress) || torProxy == TorProxyDisabled {
+		torProxy = ""
+	}
+	var httpClient *http.Client
+	if torProxy == "" {
+		logger.Debug("dial peer directly")
+		// Use a transport of the client's own so that CloseConnection closes only its connections.
+		httpClient = &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()}
+	} else {
+		torClient, err := newTorClient(torProxy)
+		if err != nil {
+			connectionCancel()
+			return nil, err
+		}
+		httpClient = torClient
 	}
 
 	client := &Client{
@@ -49,19 +122,114 @@ func NewClient(torProxy string, peerAddress string, publisher Publisher) (*Clien
 		peerAddress:      peerAddress,
 		connectionCtx:    connectionCtx,
 		connectionCancel: connectionCancel,
-		torClient:        torClient,
+		ctx:              ctx,
+		httpClient:       httpClient,
 		publisher:        publisher,
 		publishedArtists: make(map[string]*art.Artist),
 		publications:     make(map[string]*art.ArtistPublication),
 		resources:        make(map[string]*art.ArtResources),
+		compression:      defaultSyncCompression,
+		logger:           logger,
 	}
 	return client, nil
 }
 
+// Connect creates a Client, as NewClient does, and negotiates the sync protocol with the peer at peerAddress
+// to check that it is reachable and compatible before the client is used.
+// Close the client's connection with CloseConnection when done with it.
+func Connect(ctx context.Context, torProxy string, peerAddress string, publisher Publisher) (*Client, error) {
+	client, err := NewClient(ctx, torProxy, peerAddress, publisher)
+	if err != nil {
+		return nil, err
+	}
+	_, err = client.Handshake()
+	if err != nil {
+		client.CloseConnection()
+		return nil, err
+	}
+	return client, nil
+}
+
+// newRequest creates a request to url that, for a private peer, names the pubkey of this node
+// proven by a signed challenge and the mac of the session. A public peer is not told the pubkey.
+func (client *Client) newRequest(method string, url string) (*http.Request, error) {
+	request, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if client.isPeerPrivate {
+		err = client.setSessionHeaders(request)
+		if err != nil {
+			return nil, err
+		}
+	}
+	request.Header.Set(VersionHeader, Version)
+	return request, nil
+}
+
+// get gets url from the client's peer.
+func (client *Client) get(url string) (*http.Response, error) {
+	request, err := client.newRequest("GET", url)
+	if err != nil {
+		return nil, err
+	}
+	return client.httpClient.Do(request)
+}
+
+// post posts an empty request to url on the client's peer.
+func (client *Client) post(url string) (*http.Response, error) {
+	request, err := client.newRequest("POST", url)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/octet-stream")
+	return client.httpClient.Do(request)
+}
+
+// isOnionAddress checks whether the host of peerAddress, with or without a port, is a tor onion service.
+func isOnionAddress(peerAddress string) bool {
+	host, _, err := net.SplitHostPort(peerAddress)
+	if err != nil {
+		host = peerAddress
+	}
+	return strings.HasSuffix(strings.ToLower(host), ".onion")
+}
+
+// route describes how the client connects to its peer, to tell connection errors over tor from direct ones.
+func (client *Client) route() string {
+	if client.torProxy == "" {
+		return "directly"
+	}
+	return "over tor via " + client.torProxy
+}
+
+// connectionError describes the failure to connect to the client's peer for url, wrapping ErrPeerUnreachable.
+func (client *Client) connectionError(url string, err error) error {
+	client.isBroken = true
+	return fmt.Errorf("%w: failed to connect to peer %s %s for %s: %w",
+		ErrPeerUnreachable, client.peerAddress, client.route(), url, err)
+}
+
 // CloseConnection closes the onion-routing connection to the peer.
-// This should be called after completing a session with a Client obtained by NewClient.
+// This should be called after completing a session with a Client obtained by NewClient,
+// unless the Client was obtained from a ClientPool to put back.
 func (client *Client) CloseConnection() {
+	if client.connectionCancel != nil {
+		client.connectionCancel()
+	}
+	client.httpClient.CloseIdleConnections()
+}
+
+// renew starts a new session of a client reused from a ClientPool with ctx, keeping its connection to the peer
+// but forgetting the art the peer published and the protocol negotiated in the last session.
+func (client *Client) renew(ctx context.Context) {
 	client.connectionCancel()
+	client.connectionCtx, client.connectionCancel = context.WithTimeout(ctx, 3*time.Minute)
+	client.ctx = ctx
+	client.publishedArtists = make(map[string]*art.Artist)
+	client.publications = make(map[string]*art.ArtistPublication)
+	client.resources = make(map[string]*art.ArtResources)
+	client.protocol = nil
 }
 
 func (client *Client) Read(publication *art.ArtistPublication) (*art.ArtResources, error) {
@@ -79,61 +247,341 @@ func (client *Client) Read(publication *art.ArtistPublication) (*art.ArtResource
 // SyncFromPeer gets art resources (music metadata) from client's peer over tor
 // and stores the resources in localStorage.
 // It does not retrieve the mp3 payloads but just the metadata.
-func (client *Client) SyncFromPeer(localStorage ArtServer) (*art.ArtResources, error) {
-	const logPrefix = "client SyncFromPeer "
+//
+// It first negotiates the sync protocol with the peer, failing with an error wrapping ErrIncompatiblePeer
+// if they speak no version in common.
+// After the first sync from the peer with peerPubkey, it gets only the art updated since the last sync,
+// if the peer supports FeatureDeltaSync.
+// It syncs all the art again if the peer's art seems rewound or republished with another pubkey.
+//
+// From a peer that supports FeatureArtistPublications, it syncs the publication of each artist the peer lists
+// on its own, skipping the artists whose art has not been updated since their last sync.
+func (client *Client) SyncFromPeer(peerPubkey string, localStorage ArtServer) (*art.ArtResources, error) {
+	startTime := time.Now()
+	resources, err := client.syncFromPeer(peerPubkey, localStorage)
+	recordPeerSync(time.Since(startTime), err)
+	return resources, err
+}
+
+// syncFromPeer syncs art from the client's peer for SyncFromPeer.
+func (client *Client) syncFromPeer(peerPubkey string, localStorage ArtServer) (*art.ArtResources, error) {
+	logger := client.logger.With("peer", peerPubkey)
 
-	publication, err := client.GetAllArtByTor()
+	protocol, err := client.Handshake()
 	if err != nil {
-		log.Fatalf(logPrefix+"GetAllArtByTor <-%v<-%v error: %v", client.torProxy, client.peerAddress, err)
 		return nil, err
 	}
+	if protocol.Supports(FeatureArtistPublications) && protocol.Supports(FeatureDeltaSync) {
+		return client.syncArtistPublications(peerPubkey, localStorage)
+	}
+	since, err := localStorage.SyncCursor(peerPubkey)
+	if err != nil {
+		logger.Error("failed to get sync cursor", "error", err)
+		return nil, err
+	}
+	if !protocol.Supports(FeatureDeltaSync) {
+		// The peer may not filter its art by since, so get it all.
+		since = 0
+	}
 
-	resources, err := client.storePublication(publication, localStorage)
+	publication, resources, err := client.catalogSince(since)
 	if err != nil {
-		log.Fatalf(logPrefix+"importArtReply error: %v", err)
+		return nil, err
+	}
+	if since > 0 && client.needsFullSync(since, publication, resources, localStorage) {
+		logger.Info("sync all art again from peer", "since", since)
+		publication, resources, err = client.catalogSince(0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = client.storePublication(publication, resources, localStorage)
+	if err != nil {
+		logger.Error("failed to store publication", "error", err)
+		return nil, err
 	}
 
+	err = localStorage.StoreSyncCursor(peerPubkey, resources.AsOf)
+	if err != nil {
+		logger.Error("failed to store sync cursor", "as_of", resources.AsOf, "error", err)
+		return nil, err
+	}
+	return resources, nil
+}
+
+// artistSyncCursorKey names the sync cursor of the publication of the artist with artistID
+// from the peer with peerPubkey.
+func artistSyncCursorKey(peerPubkey string, artistID string) string {
+	return peerPubkey + "/" + artistID
+}
+
+// syncArtistPublications syncs art from the client's peer for SyncFromPeer, one artist publication at a time.
+// It picks from the publications the peer lists those updated since their last sync, so a change to the art
+// of one artist syncs only that artist's art, and gets each with only its art updated since then.
+// It gets the synced resources of all the picked publications.
+func (client *Client) syncArtistPublications(peerPubkey string, localStorage ArtServer) (*art.ArtResources, error) {
+	listings, err := client.ListPublications()
+	if err != nil {
+		return nil, err
+	}
+	syncedResources := &art.ArtResources{}
+	for _, listing := range listings {
+		logger := client.logger.With("peer", peerPubkey, "artist_id", listing.ArtistID)
+		cursorKey := artistSyncCursorKey(peerPubkey, listing.ArtistID)
+		since, err := localStorage.SyncCursor(cursorKey)
+		if err != nil {
+			logger.Error("failed to get sync cursor", "error", err)
+			return nil, err
+		}
+		// Records updated in the second of the last sync, after it, are synced with the next update of the artist.
+		// An artist republished with another pubkey, e.g. after rotating its key, is synced again to validate it.
+		if since > 0 && listing.AsOf == since {
+			storedArtist, err := localStorage.Artist(listing.ArtistID)
+			if err == nil && storedArtist.Pubkey == listing.Pubkey {
+				logger.Debug("skip artist publication not updated since last sync", "as_of", since)
+				continue // to next publication
+			}
+		}
+
+		publication, resources, err := client.getValidArtistPublication(listing.ArtistID, since)
+		if err != nil {
+			return nil, err
+		}
+		if since > 0 && client.needsFullSync(since, publication, resources, localStorage) {
+			logger.Info("sync all art of artist again from peer", "since", since)
+			publication, resources, err = client.getValidArtistPublication(listing.ArtistID, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = client.storePublication(publication, resources, localStorage)
+		if err != nil {
+			return nil, err
+		}
+		err = localStorage.StoreSyncCursor(cursorKey, resources.AsOf)
+		if err != nil {
+			logger.Error("failed to store sync cursor", "as_of", resources.AsOf, "error", err)
+			return nil, err
+		}
+		asOf := syncedResources.AsOf
+		syncedResources = mergeResources(syncedResources, resources)
+		if asOf > syncedResources.AsOf {
+			syncedResources.AsOf = asOf
+		}
+	}
+	return syncedResources, nil
+}
+
+// getValidArtistPublication gets the publication of the artist with artistID from client's peer, with only
+// the art updated since the given Unix time or all the artist's art if since is 0,
+// and checks that the artist signed it.
+func (client *Client) getValidArtistPublication(artistID string, since uint64) (*art.ArtistPublication, *art.ArtResources, error) {
+	publication, err := client.GetArtistPublicationByTor(artistID, since)
+	if err != nil {
+		client.logger.Warn("failed to get artist publication from peer", "artist_id", artistID,
+			"route", client.route(), "error", err)
+		return nil, nil, err
+	}
+	resources, err := client.validatePublication(publication)
+	if err != nil {
+		return nil, nil, err
+	}
+	if publication.Artist.ArtistId != artistID {
+		client.logger.Warn("reject publication of another artist", "artist_id", artistID,
+			"publishing_artist_id", publication.Artist.ArtistId)
+		return nil, nil, fmt.Errorf("%w: publication of artist %s signed by %s",
+			ErrSignatureInvalid, artistID, publication.Artist.ArtistId)
+	}
+	return publication, resources, nil
+}
+
+// SyncArtistFromPeer gets the art of only the artist with artistID from client's peer over tor
+// and stores it in localStorage, leaving the peer's other art unsynced to save bandwidth.
+// It returns an error wrapping ErrArtNotFound if the peer has no such artist.
+//
+// It gets all the artist's art each time, not only the art updated since the last sync,
+// and does not change where the next SyncFromPeer starts.
+func (client *Client) SyncArtistFromPeer(artistID string, localStorage ArtServer) (*art.ArtResources, error) {
+	startTime := time.Now()
+	resources, err := client.syncScopeFromPeer(artistID, "", localStorage)
+	recordPeerSync(time.Since(startTime), err)
 	return resources, err
 }
 
-// storeArtResources stores art in localStorage with a signature from signer.
-func (client *Client) storePublication(publication *art.ArtistPublication, localStorage ArtServer) (*art.ArtResources, error) {
-	const logPrefix = "client storePublication "
+// SyncAlbumFromPeer gets the art of only the album with albumID by the artist with artistID, and its tracks,
+// from client's peer like SyncArtistFromPeer.
+func (client *Client) SyncAlbumFromPeer(artistID string, albumID string, localStorage ArtServer) (*art.ArtResources, error) {
+	startTime := time.Now()
+	resources, err := client.syncScopeFromPeer(artistID, albumID, localStorage)
+	recordPeerSync(time.Since(startTime), err)
+	return resources, err
+}
 
-	pubkey := publication.Artist.Pubkey
-	client.publishedArtists[pubkey] = publication.Artist
+// SyncPlaylistTracksFromPeer syncs from client's peer the art of each artist with tracks on playlists
+// that are not stored in localStorage, so the playlists can be played.
+// Artists the peer does not have are skipped, for the nodes of those artists to provide.
+func (client *Client) SyncPlaylistTracksFromPeer(playlists []*art.Playlist, localStorage ArtServer) error {
+	syncedArtistIDs := make(map[string]bool)
+	for _, playlist := range playlists {
+		unresolved, err := UnresolvedPlaylistTracks(playlist, localStorage)
+		if err != nil {
+			client.logger.Error("failed to resolve playlist tracks", "artist_id", playlist.ArtistId,
+				"playlist_id", playlist.ArtistPlaylistId, "error", err)
+			return err
+		}
+		for _, trackReference := range unresolved {
+			if syncedArtistIDs[trackReference.ArtistId] {
+				continue // to next track, whose artist was synced for an earlier track
+			}
+			syncedArtistIDs[trackReference.ArtistId] = true
+			_, err = client.SyncArtistFromPeer(trackReference.ArtistId, localStorage)
+			if errors.Is(err, ErrArtNotFound) {
+				client.logger.Info("peer has no artist of playlist track", "artist_id", trackReference.ArtistId,
+					"track_id", trackReference.ArtistTrackId)
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
-	err := localStorage.StorePublication(publication)
+// GossipedPeers gets the peers listed in resources synced from client's peer that are not stored in localStorage,
+// once each. Storing the peer's publication stores only its own peer record, so these peers are only gossip
+// until synced from, which stores their own records if they are reachable.
+func (client *Client) GossipedPeers(resources *art.ArtResources, localStorage ArtServer) ([]*art.Peer, error) {
+	var gossipedPeers []*art.Peer
+	isListed := make(map[string]bool)
+	for _, peer := range resources.Peers {
+		if isListed[peer.Pubkey] {
+			continue // to next peer
+		}
+		isListed[peer.Pubkey] = true
+		_, err := localStorage.Peer(peer.Pubkey)
+		if err == ErrPeerNotFound {
+			gossipedPeers = append(gossipedPeers, peer)
+		} else if err != nil {
+			client.logger.Error("failed to get peer", "gossiped_peer", peer.Pubkey, "error", err)
+			return nil, err
+		}
+	}
+	return gossipedPeers, nil
+}
+
+// syncScopeFromPeer syncs the art of an artist, or only of one album if albumID is set, from client's peer.
+func (client *Client) syncScopeFromPeer(artistID string, albumID string, localStorage ArtServer) (*art.ArtResources, error) {
+	publication, err := client.GetScopedArtByTor(artistID, albumID)
 	if err != nil {
-		log.Printf(logPrefix+"failed to store publication %v, error: %v", publication, err)
+		client.logger.Warn("failed to get art from peer", "artist_id", artistID, "album_id", albumID,
+			"route", client.route(), "error", err)
 		return nil, err
 	}
+	resources, err := client.validatePublication(publication)
+	if err != nil {
+		return nil, err
+	}
+	err = client.storePublication(publication, resources, localStorage)
+	if err != nil {
+		client.logger.Error("failed to store publication", "artist_id", artistID, "album_id", albumID, "error", err)
+		return nil, err
+	}
+	return resources, nil
+}
+
+// Catalog gets all the art the client's peer publishes, after checking that the publishing artist signed it.
+// It gets the art of the peer's artists, albums, and tracks, but not the payloads of the tracks.
+func (client *Client) Catalog() (*art.ArtResources, error) {
+	_, resources, err := client.catalogSince(0)
+	return resources, err
+}
 
-	// Read the resources from the publication.
-	publishedResources, err := read(publication)
+// catalogSince gets the art updated since the given Unix time from client's peer,
+// or all its art if since is 0, and checks that the publishing artist signed it.
+func (client *Client) catalogSince(since uint64) (*art.ArtistPublication, *art.ArtResources, error) {
+	publication, err := client.GetAllArtByTor(since)
 	if err != nil {
-		log.Fatalf(logPrefix+"failed to read publication %v, error: %v", publication, err)
+		client.logger.Warn("failed to get art from peer", "route", client.route(), "error", err)
+		return nil, nil, err
+	}
+	resources, err := client.validatePublication(publication)
+	if err != nil {
+		return nil, nil, err
+	}
+	return publication, resources, nil
+}
+
+// validatePublication checks that the publishing artist signed publication and gets its resources.
+func (client *Client) validatePublication(publication *art.ArtistPublication) (*art.ArtResources, error) {
+	// Store only art signed by the publishing artist.
+	resources, err := client.publisher.ValidatePublication(client.ctx, publication)
+	if err != nil {
+		client.logger.Warn("reject publication", "artist_id", publication.Artist.GetArtistId(), "error", err)
 		return nil, err
 	}
+	return resources, nil
+}
+
+// needsFullSync checks whether the art updated since the last sync is not enough to sync from the peer,
+// because the peer's art was collected before the last sync or is published with a different pubkey.
+func (client *Client) needsFullSync(since uint64, publication *art.ArtistPublication, resources *art.ArtResources, localStorage ArtServer) bool {
+	if resources.Since == 0 {
+		return false // The peer already replied with all its art.
+	}
+	if resources.AsOf < since {
+		return true
+	}
+	storedArtist, err := localStorage.Artist(publication.Artist.ArtistId)
+	return err != nil || storedArtist.Pubkey != publication.Artist.Pubkey
+}
+
+// storePublication stores the art of a valid publication in localStorage
+// and deletes from it the tracks and albums the publication withdraws.
+func (client *Client) storePublication(publication *art.ArtistPublication, publishedResources *art.ArtResources, localStorage ArtServer) error {
+	pubkey := publication.Artist.Pubkey
+	err := checkPubkeyLink(client.ctx, client.publisher, publication, localStorage)
+	if err != nil {
+		client.logger.Warn("reject publication by unlinked pubkey", "artist_id", publication.Artist.ArtistId, "error", err)
+		return err
+	}
+	client.publishedArtists[pubkey] = publication.Artist
+
+	err = localStorage.StorePublication(publication)
+	if err != nil {
+		client.logger.Error("failed to store publication", "artist_id", publication.Artist.ArtistId, "error", err)
+		return err
+	}
+	err = applyTombstones(localStorage, pubkey, publishedResources, client.logger)
+	if err != nil {
+		return err
+	}
 
 	client.publications[pubkey] = publication
 	client.resources[pubkey] = publishedResources
-	
-	return publishedResources, nil
+
+	return nil
 }
 
 // DownloadTracks downloads tracks over tor from the peer whose pubkey matches the track artist.
+// Tracks with a price are purchased first to prove payment to the peer,
+// unless their payload is fetched by its CID from IPFS, with the published hash, before the purchase.
 //
 // The .mp3 file is written as `./tracks/{ArtistId}/{ArtistTrackId}.mp3`
 // That is, tracks download under an artist-specific subdirectory of ./tracks
 // with filenames from the track's ArtistTrackId.
+//
+// Tracks published with a payload hash are stored only if the downloaded bytes match it;
+// otherwise DownloadTracks returns an error wrapping ErrPayloadMismatch.
+//
+// Bytes download first into a .part file beside the track file. If the connection drops,
+// the download resumes from the end of the .part file, now or on the next call to DownloadTracks.
 func (client *Client) DownloadTracks(tracks []*art.Track, localStorage ArtServer) (err error) {
-	const logPrefix = "client DownloadTracks "
-	var errors []error
+	var failures []error
 	for _, track := range tracks {
+		logger := client.logger.With("artist_id", track.ArtistId, "track_id", track.ArtistTrackId)
 		trackArtist, err := localStorage.Artist(track.ArtistId)
 		if err != nil {
-			errors = append(errors, err)
+			failures = append(failures, err)
 			continue // to next track
 		}
 
@@ -141,64 +589,283 @@ func (client *Client) DownloadTracks(tracks []*art.Track, localStorage ArtServer
 		if peer == nil {
 			err = fmt.Errorf("no known peer owns pubkey %s for %s/%s.mp3",
 				trackArtist.Pubkey, track.ArtistId, track.ArtistTrackId)
-			errors = append(errors, err)
+			failures = append(failures, err)
 			continue // to next track
 		}
 
-		replyBytes, err := client.GetTrack(track.ArtistId, track.ArtistTrackId)
+		partFilename, isTempPart, err := downloadPartPath(localStorage, track)
 		if err != nil {
-			log.Printf(logPrefix+"Failed GetTrackByTor, error: %v", err)
-			errors = append(errors, err)
+			logger.Error("failed to create file to download payload into", "error", err)
+			failures = append(failures, err)
+			continue // to next track
+		}
+		// A temp file cannot resume a later download, so remove it whether or not this one succeeds.
+		discardTempPart := func() {
+			if isTempPart {
+				os.Remove(partFilename)
+			}
+		}
+		// Fetch a pinned payload from IPFS before paying the peer for it,
+		// and from the peer if IPFS fails to fetch the published bytes.
+		isFetched := false
+		if track.PayloadCid != "" && client.ipfs != nil {
+			err = client.ipfs.Download(track, partFilename)
+			if err == nil && len(track.PayloadSha256) > 0 {
+				err = verifyPayloadFile(partFilename, track)
+			}
+			if err == nil {
+				isFetched = true
+			} else {
+				logger.Info("download from peer what ipfs failed to fetch", "cid", track.PayloadCid, "error", err)
+				os.Remove(partFilename)
+			}
+		}
+		var preimage []byte
+		if !isFetched && track.EffectivePriceSats > 0 {
+			preimage, err = client.PurchaseTrack(track)
+			if err != nil {
+				logger.Warn("failed to purchase track", "error", err)
+				discardTempPart()
+				failures = append(failures, err)
+				continue // to next track
+			}
+		}
+		var payloadSha256 []byte
+		for attempt := 1; !isFetched; attempt++ {
+			payloadSha256, err = client.downloadTrack(track, preimage, partFilename)
+			if err == nil || attempt == downloadAttempts || !isResumable(err) {
+				break
+			}
+			logger.Info("resume download", "attempt", attempt, "error", err)
+		}
+		if err != nil {
+			logger.Warn("failed to download track", "error", err)
+			discardTempPart()
+			failures = append(failures, err)
 			continue // to next track
 		}
 
+		// Keep only the bytes the track artist published, so a peer cannot serve tampered bytes.
+		if len(track.PayloadSha256) > 0 && !isFetched {
+			if !bytes.Equal(payloadSha256, track.PayloadSha256) {
+				err = fmt.Errorf("%w: peer %s sent bytes with hash %x, not %x for %s/%s", ErrPayloadMismatch,
+					client.peerAddress, payloadSha256, track.PayloadSha256, track.ArtistId, track.ArtistTrackId)
+			}
+			if err != nil {
+				logger.Warn("reject downloaded payload", "error", err)
+				os.Remove(partFilename)
+				failures = append(failures, err)
+				continue // to next track
+			}
+		}
+
+		replyBytes, err := ioutil.ReadFile(partFilename)
+		if err != nil {
+			logger.Error("failed to read downloaded payload", "path", partFilename, "error", err)
+			discardTempPart()
+			failures = append(failures, err)
+			continue // to next track
+		}
 		err = localStorage.StoreTrackPayload(track, replyBytes)
 		if err != nil {
-			log.Printf(logPrefix+"Failed StoreTrackPayload, error: %v", err)
-			errors = append(errors, err)
+			logger.Error("failed to store track payload", "error", err)
+			discardTempPart()
+			failures = append(failures, err)
 			continue // to next track
 		}
+		tracksStoredTotal.Inc()
+		os.Remove(partFilename)
 	}
 
-	if len(errors) > 0 {
-		log.Printf(logPrefix+"%v errors:", len(errors))
-		for _, err = range errors {
-			log.Printf(logPrefix+"\terror: %v", err)
+	if len(failures) > 0 {
+		err := errors.Join(failures...)
+		client.logger.Warn("failed to download tracks", "failures", len(failures), "tracks", len(tracks), "error", err)
+		return err // wrapping every failure, not just the first, e.g. ErrPayloadMismatch
+	}
+
+	return nil
+}
+
+// downloadPartPath gets the path of the file to download the payload of track into before storing it:
+// beside its payload file, to resume an interrupted download, or else, if localStorage stores payloads
+// elsewhere, e.g. in an s3 bucket, a new temp file with a random name that only this user can open,
+// which the caller removes when done with it.
+func downloadPartPath(localStorage ArtServer, track *art.Track) (partFilename string, isTemp bool, err error) {
+	if trackFilePath := localStorage.TrackFilePath(track); trackFilePath != "" {
+		return trackFilePath + ".part", false, nil
+	}
+	partFile, err := ioutil.TempFile("", "austk-download-*.part")
+	if err != nil {
+		return "", false, err
+	}
+	return partFile.Name(), true, partFile.Close()
+}
+
+// DownloadAlbumArt downloads the cover art of albums from client's peer and stores it in localStorage for display.
+// Albums without cover art, and those whose cover art is already stored, are skipped.
+// Cover art published with a hash is stored only if the downloaded image matches it;
+// otherwise DownloadAlbumArt returns an error wrapping ErrPayloadMismatch.
+func (client *Client) DownloadAlbumArt(albums []*art.Album, localStorage ArtServer) error {
+	var failures []error
+	for _, album := range albums {
+		if album.CoverArtMime == "" {
+			continue // to next album
+		}
+		logger := client.logger.With("artist_id", album.ArtistId, "album_id", album.ArtistAlbumId)
+		if !isAlbumArtMime(album.CoverArtMime) {
+			logger.Warn("refuse album cover art that is not an image", "mime", album.CoverArtMime)
+			failures = append(failures, fmt.Errorf("cover art of %s/%s has mime type %q, not an image",
+				album.ArtistId, album.ArtistAlbumId, album.CoverArtMime))
+			continue // to next album
+		}
+		storedImage, _, err := localStorage.AlbumArt(album.ArtistId, album.ArtistAlbumId)
+		if err == nil && isAlbumArtImage(album, storedImage) {
+			logger.Debug("skip album cover art already stored")
+			continue // to next album
+		}
+
+		image, _, err := client.GetAlbumArt(album)
+		if err != nil {
+			logger.Warn("failed to download album cover art", "error", err)
+			failures = append(failures, err)
+			continue // to next album
+		}
+		// Store the image with the mime type signed in the album rather than the one the peer replied with.
+		err = localStorage.StoreAlbumArt(album, image, album.CoverArtMime)
+		if err != nil {
+			logger.Error("failed to store album cover art", "error", err)
+			failures = append(failures, err)
+			continue // to next album
 		}
-		return errors[0] // return the first error
 	}
 
+	if len(failures) > 0 {
+		err := errors.Join(failures...)
+		client.logger.Warn("failed to download album cover art", "failures", len(failures), "albums", len(albums), "error", err)
+		return err // wrapping every failure, not just the first, e.g. ErrPayloadMismatch
+	}
 	return nil
 }
 
+// isAlbumArtImage checks whether image has the hash of the cover art published for album, if any.
+func isAlbumArtImage(album *art.Album, image []byte) bool {
+	if len(album.CoverArtSha256) == 0 {
+		return true
+	}
+	imageHash := sha256.Sum256(image)
+	return bytes.Equal(imageHash[:], album.CoverArtSha256)
+}
+
 // GetAllArtByTor gets the art-directory music metadata over tor from the client's peer.
-func (client *Client) GetAllArtByTor() (*art.ArtistPublication, error) {
-	const logPrefix = "client GetAllArtByTor "
-	response, err := client.torClient.Get("http://" + client.peerAddress)
+// If since is nonzero, it gets only the art updated since that Unix time.
+func (client *Client) GetAllArtByTor(since uint64) (*art.ArtistPublication, error) {
+	query := url.Values{}
+	if since > 0 {
+		query.Set("since", strconv.FormatUint(since, 10))
+	}
+	return client.getArtByTor("/", query)
+}
+
+// GetScopedArtByTor gets the art of the artist with artistID over tor from the client's peer,
+// or only the art of that artist's album with albumID if it is set.
+// It returns an error wrapping ErrArtNotFound if the peer has no such artist or album.
+func (client *Client) GetScopedArtByTor(artistID string, albumID string) (*art.ArtistPublication, error) {
+	query := url.Values{}
+	query.Set("artist", artistID)
+	if albumID != "" {
+		query.Set("album", albumID)
+	}
+	return client.getArtByTor("/", query)
+}
+
+// GetArtistPublicationByTor gets the publication of the artist with artistID over tor from the client's peer,
+// from a peer that supports FeatureArtistPublications.
+// If since is nonzero, it gets only the artist's art updated since that Unix time.
+// It returns an error wrapping ErrArtNotFound if the peer does not publish the artist.
+func (client *Client) GetArtistPublicationByTor(artistID string, since uint64) (*art.ArtistPublication, error) {
+	query := url.Values{}
+	if since > 0 {
+		query.Set("since", strconv.FormatUint(since, 10))
+	}
+	return client.getArtByTor("/publication/"+url.PathEscape(artistID), query)
+}
+
+// ListPublications lists the artist publications of the client's peer,
+// from a peer that supports FeatureArtistPublications.
+func (client *Client) ListPublications() ([]PublicationListing, error) {
+	publicationsURL := "http://" + client.peerAddress + "/publications"
+	request, err := client.newRequest("GET", publicationsURL)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		client.logger.Warn("failed to list publications", "url", publicationsURL, "route", client.route(), "error", err)
+		return nil, client.connectionError(publicationsURL, err)
+	}
+	defer response.Body.Close()
+	replyBytes, err := readDecompressed(response, maxPublicationBytes)
 	if err != nil {
-		log.Printf(logPrefix+"torClient.Get %v, error: %v", client.peerAddress, err)
 		return nil, err
 	}
+	if response.StatusCode != http.StatusOK {
+		return nil, client.replyError(response, replyBytes)
+	}
+	var listings []PublicationListing
+	err = json.Unmarshal(replyBytes, &listings)
+	if err != nil {
+		client.logger.Warn("failed to unmarshal publications", "url", publicationsURL, "error", err)
+		return nil, err
+	}
+	return listings, nil
+}
+
+// getArtByTor gets the publication of the client's peer at path with the art that query requests.
+func (client *Client) getArtByTor(path string, query url.Values) (*art.ArtistPublication, error) {
+	artUrl := "http://" + client.peerAddress + path
+	if len(query) > 0 {
+		artUrl += "?" + query.Encode()
+	}
+	request, err := client.newRequest("GET", artUrl)
+	if err != nil {
+		return nil, err
+	}
+	// Name the codec, or identity, rather than let the http client ask for gzip and hide it.
+	codec := client.compressionCodec()
+	if codec == "" {
+		codec = "identity"
+	}
+	request.Header.Set("Accept-Encoding", codec)
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		client.logger.Warn("failed to get art", "url", artUrl, "route", client.route(), "error", err)
+		return nil, client.connectionError(artUrl, err)
+	}
 	defer response.Body.Close()
-	log.Printf(logPrefix+"torClient %v did Get http://%v", client.torProxy, client.peerAddress)
+	client.logger.Debug("got art", "url", artUrl, "route", client.route(),
+		"content_encoding", response.Header.Get("Content-Encoding"))
+	client.checkPeerVersion(response.Header.Get(VersionHeader))
 
 	// Read the reply into an ArtReply.
-	replyBytes, err := ioutil.ReadAll(response.Body)
+	replyBytes, err := readDecompressed(response, maxPublicationBytes)
 	if err != nil {
-		log.Printf(logPrefix+"ReadAll response.Body error: %v", err)
+		client.logger.Warn("failed to read art reply", "url", artUrl, "error", err)
 		return nil, err
 	}
+	if response.StatusCode != http.StatusOK {
+		return nil, client.replyError(response, replyBytes)
+	}
 	publication := art.ArtistPublication{}
 	err = proto.Unmarshal(replyBytes, &publication)
 	if err != nil {
-		log.Printf(logPrefix+"Unmarshal reply error: %v", err)
+		client.logger.Warn("failed to unmarshal art reply", "url", artUrl, "error", err)
 		return nil, err
 	}
 
 	resources := art.ArtResources{}
 	err = proto.Unmarshal(publication.SerializedArtResources, &resources)
 	if err != nil {
-		log.Printf(logPrefix+"failed to deserialize resources from %v, error: %v", publication, err)
+		client.logger.Warn("failed to unmarshal published resources", "artist_id", publication.Artist.GetArtistId(), "error", err)
 		return nil, err
 	}
 
@@ -212,37 +879,278 @@ func (client *Client) GetAllArtByTor() (*art.ArtistPublication, error) {
 
 // GetTrack gets the mp3 track (the bytes of the mp3 file) artistID/artistTrackID
 // from client's peer by http over tor .
-func (client *Client) GetTrack(artistID string, artistTrackID string) ([]byte, error) {
-	const logPrefix = "client GetTrackByTor "
-
+// The preimage from PurchaseTrack proves payment for a track with a price; it may be nil for a free track.
+func (client *Client) GetTrack(artistID string, artistTrackID string, preimage []byte) ([]byte, error) {
 	trackUrl := fmt.Sprintf("http://%s/art/%s/%s",
 		client.peerAddress, artistID, artistTrackID)
-	log.Printf(logPrefix+"Get %s...", trackUrl)
-	response, err := client.torClient.Get(trackUrl)
+	logger := client.logger.With("url", trackUrl)
+	logger.Debug("get track")
+	request, err := client.newRequest("GET", trackUrl)
 	if err != nil {
-		log.Printf(logPrefix+"torClient.get %v, error: %v", trackUrl, err)
+		logger.Error("failed to create request", "error", err)
 		return nil, err
 	}
+	if preimage != nil {
+		request.Header.Set(PreimageHeader, hex.EncodeToString(preimage))
+	}
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		logger.Warn("failed to get track", "route", client.route(), "error", err)
+		return nil, client.connectionError(trackUrl, err)
+	}
 	defer response.Body.Close()
 
 	// Read the reply and return the bytes.
 	replyBytes, err := ioutil.ReadAll(response.Body)
-	log.Printf(logPrefix+"Read %d-byte reply", len(replyBytes))
+	logger.Debug("read track reply", "bytes", len(replyBytes))
 	if err != nil {
-		log.Printf(logPrefix+"ReadAll response.Body error: %v", err)
+		logger.Warn("failed to read track reply", "error", err)
 		return nil, err
 	}
+	if response.StatusCode != http.StatusOK {
+		return nil, client.replyError(response, replyBytes)
+	}
 	return replyBytes, nil
 }
 
+// DownloadTrack gets the payload of track, e.g. from Catalog, from client's peer, first buying it with
+// PurchaseTrack if it has a price. It checks the payload against the hash the artist published for the track,
+// failing with an error wrapping ErrPayloadMismatch if they differ.
+// Unlike DownloadTracks, it neither stores the payload nor resumes a dropped download.
+func (client *Client) DownloadTrack(track *art.Track) ([]byte, error) {
+	var preimage []byte
+	var err error
+	if track.EffectivePriceSats > 0 {
+		preimage, err = client.PurchaseTrack(track)
+		if err != nil {
+			return nil, err
+		}
+	}
+	payload, err := client.GetTrack(track.ArtistId, track.ArtistTrackId, preimage)
+	if err != nil {
+		return nil, err
+	}
+	if len(track.PayloadSha256) > 0 {
+		err = verifyPayloadHash(bytes.NewReader(payload), "payload from peer "+client.peerAddress, track)
+		if err != nil {
+			client.logger.Warn("reject downloaded payload", "artist_id", track.ArtistId,
+				"track_id", track.ArtistTrackId, "error", err)
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// GetAlbumArt gets the cover art image of album and its mime type from client's peer.
+// It returns an error wrapping ErrPayloadMismatch if the image does not match the hash published for album.
+func (client *Client) GetAlbumArt(album *art.Album) ([]byte, string, error) {
+	coverUrl := fmt.Sprintf("http://%s/cover/%s/%s",
+		client.peerAddress, album.ArtistId, album.ArtistAlbumId)
+	logger := client.logger.With("url", coverUrl)
+	logger.Debug("get album cover art")
+	response, err := client.get(coverUrl)
+	if err != nil {
+		logger.Warn("failed to get album cover art", "route", client.route(), "error", err)
+		return nil, "", client.connectionError(coverUrl, err)
+	}
+	defer response.Body.Close()
+
+	replyBytes, err := ioutil.ReadAll(io.LimitReader(response.Body, maxAlbumArtBytes+1))
+	if err != nil {
+		logger.Warn("failed to read album cover art reply", "error", err)
+		return nil, "", err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, "", client.replyError(response, replyBytes)
+	}
+	if len(replyBytes) > maxAlbumArtBytes {
+		return nil, "", fmt.Errorf("peer %s served cover art over %d bytes for %s/%s",
+			client.peerAddress, maxAlbumArtBytes, album.ArtistId, album.ArtistAlbumId)
+	}
+	if !isAlbumArtImage(album, replyBytes) {
+		return nil, "", fmt.Errorf("%w: peer %s served cover art with another hash than %x for %s/%s",
+			ErrPayloadMismatch, client.peerAddress, album.CoverArtSha256, album.ArtistId, album.ArtistAlbumId)
+	}
+	return replyBytes, response.Header.Get("Content-Type"), nil
+}
+
+// downloadTrack downloads the payload of track from client's peer into partFilename.
+// If partFilename has bytes from an earlier attempt, it requests only the rest of the track,
+// with the checksum of those bytes so the peer can check that they begin its payload.
+// A peer that does not serve ranges or has a different payload replies with the whole track,
+// which replaces the bytes in partFilename.
+// It returns the SHA-256 hash of the whole payload in partFilename, hashed as its bytes are written.
+func (client *Client) downloadTrack(track *art.Track, preimage []byte, partFilename string) ([]byte, error) {
+	err := os.MkdirAll(filepath.Dir(partFilename), 0755)
+	if err != nil {
+		return nil, err
+	}
+	partFile, err := os.OpenFile(partFilename, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer partFile.Close()
+	checksum := crc32.NewIEEE()
+	payloadHash := sha256.New()
+	offset, err := io.Copy(io.MultiWriter(checksum, payloadHash), partFile)
+	if err != nil {
+		return nil, err
+	}
+
+	trackUrl := fmt.Sprintf("http://%s/art/%s/%s",
+		client.peerAddress, track.ArtistId, track.ArtistTrackId)
+	logger := client.logger.With("url", trackUrl)
+	request, err := client.newRequest("GET", trackUrl)
+	if err != nil {
+		logger.Error("failed to create request", "error", err)
+		return nil, err
+	}
+	if preimage != nil {
+		request.Header.Set(PreimageHeader, hex.EncodeToString(preimage))
+	}
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		request.Header.Set(PrefixChecksumHeader, hex.EncodeToString(checksum.Sum(nil)))
+	}
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		logger.Warn("failed to get track", "route", client.route(), "error", err)
+		return nil, client.connectionError(trackUrl, err)
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusPartialContent:
+		contentRange := response.Header.Get("Content-Range")
+		if !strings.HasPrefix(contentRange, fmt.Sprintf("bytes %d-", offset)) {
+			return nil, fmt.Errorf("peer %s replied range %s to resume %s at byte %d",
+				client.peerAddress, contentRange, trackUrl, offset)
+		}
+		logger.Info("resume download", "offset", offset)
+	case http.StatusOK:
+		if offset > 0 {
+			logger.Info("peer replied with the whole track, so discard downloaded bytes", "offset", offset)
+		}
+		err = truncateFile(partFile)
+		if err != nil {
+			return nil, err
+		}
+		payloadHash.Reset()
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The downloaded bytes are not a prefix of the peer's payload, so download it all next time.
+		err = truncateFile(partFile)
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("peer %s cannot resume %s at byte %d", client.peerAddress, trackUrl, offset)
+	default:
+		replyBytes, _ := ioutil.ReadAll(response.Body)
+		return nil, client.replyError(response, replyBytes)
+	}
+
+	// Hash the bytes as they arrive, so verifying a large payload needs no second pass over its file.
+	copiedBytes, err := io.Copy(io.MultiWriter(partFile, payloadHash), response.Body)
+	logger.Debug("read track reply", "bytes", copiedBytes, "path", partFilename)
+	if err != nil {
+		return nil, err
+	}
+	return payloadHash.Sum(nil), nil
+}
+
+// truncateFile empties file to write it again from the start.
+func truncateFile(file *os.File) error {
+	err := file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	return err
+}
+
+// isResumable checks whether a failed download might succeed if tried again.
+// It need not be tried again if the peer requires payment or lacks the track.
+func isResumable(err error) bool {
+	return !errors.Is(err, ErrPaymentRequired) && !errors.Is(err, ErrArtNotFound)
+}
+
+// replyError describes the peer's unsuccessful reply to a request.
+// It wraps ErrPaymentRequired or ErrArtNotFound for those replies so callers can check with errors.Is.
+func (client *Client) replyError(response *http.Response, replyBytes []byte) error {
+	switch response.StatusCode {
+	case http.StatusPaymentRequired:
+		return fmt.Errorf("%w: peer %s replied %s to %s", ErrPaymentRequired, client.peerAddress, replyBytes, response.Request.URL)
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: peer %s has no %s", ErrArtNotFound, client.peerAddress, response.Request.URL)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: peer %s replied %s to %s: %s",
+			ErrPeerNotAllowed, client.peerAddress, response.Status, response.Request.URL, bytes.TrimSpace(replyBytes))
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("%w: peer %s replied %s to %s, retry after %ss",
+			ErrRateLimited, client.peerAddress, replyBytes, response.Request.URL, response.Header.Get("Retry-After"))
+	default:
+		return fmt.Errorf("peer %s replied %s to %s: %s", client.peerAddress, response.Status, response.Request.URL, replyBytes)
+	}
+}
+
+// PurchaseTrack buys the given track from client's peer by paying its lightning invoice.
+// It refuses to pay more than the effective price the peer published for the track.
+// It returns the preimage of the paid invoice as proof of payment.
+func (client *Client) PurchaseTrack(track *art.Track) (preimage []byte, err error) {
+	invoiceUrl := fmt.Sprintf("http://%s/invoice/%s/%s",
+		client.peerAddress, track.ArtistId, track.ArtistTrackId)
+	logger := client.logger.With("artist_id", track.ArtistId, "track_id", track.ArtistTrackId)
+	logger.Debug("request invoice", "url", invoiceUrl)
+	response, err := client.post(invoiceUrl)
+	if err != nil {
+		logger.Warn("failed to request invoice", "url", invoiceUrl, "route", client.route(), "error", err)
+		return nil, client.connectionError(invoiceUrl, err)
+	}
+	defer response.Body.Close()
+	replyBytes, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		logger.Warn("failed to read invoice reply", "error", err)
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, client.replyError(response, replyBytes)
+	}
+	invoice := art.Invoice{}
+	err = proto.Unmarshal(replyBytes, &invoice)
+	if err != nil {
+		logger.Warn("failed to unmarshal invoice", "error", err)
+		return nil, err
+	}
+
+	preimage, err = client.publisher.PayInvoice(client.ctx, invoice.PaymentRequest, track.EffectivePriceSats)
+	if err != nil {
+		logger.Warn("failed to pay invoice", "payment_request", invoice.PaymentRequest, "error", err)
+		return nil, err
+	}
+	logger.Info("paid for track", "sats", invoice.Sats)
+	return preimage, nil
+}
+
+// TipArtist pays sats to the given artist's pubkey by keysend, without buying any track.
+func (client *Client) TipArtist(artist *art.Artist, sats uint64) error {
+	if artist.Pubkey == "" {
+		return fmt.Errorf("artist %s has no pubkey to tip", artist.ArtistId)
+	}
+	err := client.publisher.Keysend(client.ctx, artist.Pubkey, sats)
+	if err != nil {
+		client.logger.Warn("failed to tip artist", "artist_id", artist.ArtistId, "sats", sats, "error", err)
+		return err
+	}
+	client.logger.Info("tipped artist", "artist_id", artist.ArtistId, "sats", sats)
+	return nil
+}
+
 // GetAllArtByGrpc is similar to GetAllArtByTor but uses Grpc rather than raw http over tor.
 // This is dead code for now, as GetAllArtByTor seems to expose the needed functionality.
 // This code may be revived if fields must be specified in the ArtRequest, e.g. for filtering results.
 func (client *Client) GetAllArtByGrpc() (*art.ArtistPublication, error) {
-	const logPrefix = "client GetAllArtByGrpc "
 	torClient, err := tor.Start(client.connectionCtx, nil)
 	if err != nil {
-		log.Printf(logPrefix+"tor.Start error: %v", err)
+		client.logger.Error("failed to start tor", "error", err)
 		return nil, err
 	}
 	defer torClient.Close()
@@ -251,12 +1159,12 @@ func (client *Client) GetAllArtByGrpc() (*art.ArtistPublication, error) {
 	}
 	dialer, err := torClient.Dialer(client.connectionCtx, &dialConf)
 	if err != nil {
-		log.Printf(logPrefix+"tor.Dialer error: %v", err)
+		client.logger.Error("failed to get tor dialer", "error", err)
 		return nil, err
 	}
 
 	artRequest := art.ArtRequest{}
-	log.Printf(logPrefix+"Dial peer %v by over tor...", client.peerAddress)
+	client.logger.Debug("dial peer grpc over tor")
 	peerConnection, err := grpc.DialContext(
 		client.connectionCtx,
 		client.peerAddress,
@@ -270,27 +1178,25 @@ func (client *Client) GetAllArtByGrpc() (*art.ArtistPublication, error) {
 		}),
 	)
 	if err != nil {
-		log.Printf(logPrefix+"Dial peer error: %v", err)
+		client.logger.Warn("failed to dial peer grpc", "error", err)
 		return nil, err
 	}
 	defer peerConnection.Close()
 
-	log.Printf(logPrefix+"GetArt from peer %v...", client.peerAddress)
+	client.logger.Debug("get art by grpc")
 	artClient := art.NewArtClient(peerConnection)
 	publication, err := artClient.GetArt(client.connectionCtx, &artRequest)
 	if err != nil {
-		log.Printf(logPrefix+"artClient.GetArt error: %v", err)
+		client.logger.Warn("failed to get art by grpc", "error", err)
 		return nil, err
 	}
 	return publication, nil
 }
 
 func newTorClient(torProxy string) (*http.Client, error) {
-	const logPrefix = "client NetTorClient "
 	torProxyUrl, err := url.Parse(torProxy)
 	if err != nil {
-		log.Printf(logPrefix+"url.Parse %v error: %v", torProxy, err)
-		return nil, err
+		return nil, fmt.Errorf("malformed tor proxy %s: %w", torProxy, err)
 	}
 	return &http.Client{
 		Transport: &http.Transport{
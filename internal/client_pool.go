@@ -0,0 +1,159 @@
+package audiostrike
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"log/slog"
+)
+
+// ClientPool keeps the Clients done syncing idle by peer address to reuse their connections,
+// since a new tor circuit to a peer takes seconds to build.
+// It is safe for concurrent use. A Client taken from the pool is used by one caller until put back.
+type ClientPool struct {
+	torProxy    string
+	publisher   Publisher
+	maxIdle     int
+	idleTimeout time.Duration
+	// compression is the codec in which new clients ask peers for their art, or "" for the default.
+	compression string
+	// ipfs fetches the payloads pinned in IPFS for new clients, or is nil.
+	ipfs *IPFSNode
+
+	// idleClients has the idle clients to each peer address, least recently used first.
+	idleClients map[string][]*idleClient
+	idleCount   int
+	isClosed    bool
+	mutex       sync.Mutex
+
+	// now gets the current time.
+	now    func() time.Time
+	logger *slog.Logger
+}
+
+// idleClient is a Client in the pool and when it was put there.
+type idleClient struct {
+	client    *Client
+	idleSince time.Time
+}
+
+// NewClientPool creates a ClientPool of clients that dial peers over torProxy and sign with publisher,
+// keeping up to maxIdle clients idle for up to idleTimeout each.
+func NewClientPool(torProxy string, publisher Publisher, maxIdle int, idleTimeout time.Duration) *ClientPool {
+	return &ClientPool{
+		torProxy:    torProxy,
+		publisher:   publisher,
+		maxIdle:     maxIdle,
+		idleTimeout: idleTimeout,
+		idleClients: make(map[string][]*idleClient),
+		now:         time.Now,
+		logger:      componentLogger("clientPool"),
+	}
+}
+
+// Get gets the most recently used idle client to peerAddress, or a new client if none is idle.
+// Cancelling ctx cancels the client's calls to lnd, as for NewClient.
+// Put the client back in the pool when done with it, instead of closing its connection.
+func (pool *ClientPool) Get(ctx context.Context, peerAddress string) (*Client, error) {
+	pool.mutex.Lock()
+	pool.evictExpired()
+	idleClients := pool.idleClients[peerAddress]
+	if len(idleClients) == 0 {
+		pool.mutex.Unlock()
+		client, err := NewClient(ctx, pool.torProxy, peerAddress, pool.publisher)
+		if err == nil && pool.compression != "" {
+			client.compression = pool.compression
+		}
+		if err == nil {
+			client.ipfs = pool.ipfs
+		}
+		return client, err
+	}
+	client := idleClients[len(idleClients)-1].client
+	pool.removeIdle(peerAddress, len(idleClients)-1)
+	pool.mutex.Unlock()
+
+	pool.logger.Debug("reuse idle client", "peer_address", peerAddress)
+	client.renew(ctx)
+	return client, nil
+}
+
+// Put keeps client idle in the pool to reuse its connection, evicting the least recently used client
+// if the pool already holds its maximum of idle clients.
+// It closes the connection of a client that failed to connect, or of any client once the pool is closed.
+func (pool *ClientPool) Put(client *Client) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if pool.isClosed || pool.maxIdle <= 0 || client.isBroken {
+		client.CloseConnection()
+		return
+	}
+	pool.evictExpired()
+	if pool.idleCount >= pool.maxIdle {
+		pool.evictLeastRecentlyUsed()
+	}
+	pool.idleClients[client.peerAddress] = append(pool.idleClients[client.peerAddress],
+		&idleClient{client: client, idleSince: pool.now()})
+	pool.idleCount++
+}
+
+// Close closes the connections of all the idle clients and of any client put back later.
+func (pool *ClientPool) Close() {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	pool.isClosed = true
+	for peerAddress, idleClients := range pool.idleClients {
+		for _, idle := range idleClients {
+			idle.client.CloseConnection()
+		}
+		delete(pool.idleClients, peerAddress)
+	}
+	pool.idleCount = 0
+}
+
+// evictExpired closes the clients idle longer than the idle timeout.
+// The caller must hold pool.mutex.
+func (pool *ClientPool) evictExpired() {
+	expiry := pool.now().Add(-pool.idleTimeout)
+	for peerAddress, idleClients := range pool.idleClients {
+		// Clients are put back in order, so the expired clients are first.
+		for len(idleClients) > 0 && !idleClients[0].idleSince.After(expiry) {
+			pool.logger.Debug("evict expired idle client", "peer_address", peerAddress)
+			idleClients[0].client.CloseConnection()
+			pool.removeIdle(peerAddress, 0)
+			idleClients = pool.idleClients[peerAddress]
+		}
+	}
+}
+
+// evictLeastRecentlyUsed closes the client idle the longest.
+// The caller must hold pool.mutex.
+func (pool *ClientPool) evictLeastRecentlyUsed() {
+	var oldestAddress string
+	var oldest *idleClient
+	for peerAddress, idleClients := range pool.idleClients {
+		if len(idleClients) > 0 && (oldest == nil || idleClients[0].idleSince.Before(oldest.idleSince)) {
+			oldestAddress, oldest = peerAddress, idleClients[0]
+		}
+	}
+	if oldest == nil {
+		return
+	}
+	pool.logger.Debug("evict least recently used idle client", "peer_address", oldestAddress)
+	oldest.client.CloseConnection()
+	pool.removeIdle(oldestAddress, 0)
+}
+
+// removeIdle removes the idle client at index i of those to peerAddress without closing it.
+// The caller must hold pool.mutex.
+func (pool *ClientPool) removeIdle(peerAddress string, i int) {
+	idleClients := pool.idleClients[peerAddress]
+	idleClients = append(idleClients[:i], idleClients[i+1:]...)
+	if len(idleClients) == 0 {
+		delete(pool.idleClients, peerAddress)
+	} else {
+		pool.idleClients[peerAddress] = idleClients
+	}
+	pool.idleCount--
+}
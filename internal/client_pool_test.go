@@ -0,0 +1,66 @@
+package audiostrike
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestClientPool verifies that a ClientPool reuses an idle client to the same peer
+// and closes clients that are broken, idle too long, past its maximum, or put back after it closes.
+func TestClientPool(t *testing.T) {
+	const peerAddress, otherPeerAddress = "127.0.0.1:53545", "127.0.0.1:53546"
+	now := time.Now()
+	pool := NewClientPool(TorProxyDisabled, &mockPublisher, 2, time.Minute)
+	pool.now = func() time.Time { return now }
+	get := func(peerAddress string) *Client {
+		client, err := pool.Get(context.Background(), peerAddress)
+		if err != nil {
+			t.Fatalf("Get(%s) error: %v", peerAddress, err)
+		}
+		return client
+	}
+
+	client := get(peerAddress)
+	pool.Put(client)
+	if reused := get(peerAddress); reused != client {
+		t.Errorf("expected idle client to %s reused", peerAddress)
+	}
+	if other := get(otherPeerAddress); other == client {
+		t.Errorf("expected new client to %s but got the client to %s", otherPeerAddress, peerAddress)
+	}
+
+	client.isBroken = true
+	pool.Put(client)
+	if reused := get(peerAddress); reused == client {
+		t.Errorf("expected broken client not reused")
+	}
+
+	client = get(peerAddress)
+	pool.Put(client)
+	now = now.Add(time.Minute)
+	if reused := get(peerAddress); reused == client {
+		t.Errorf("expected client idle past timeout not reused")
+	}
+
+	first, second, third := get(peerAddress), get(peerAddress), get(otherPeerAddress)
+	pool.Put(first)
+	now = now.Add(time.Second)
+	pool.Put(second)
+	pool.Put(third)
+	if pool.idleCount != 2 {
+		t.Errorf("expected 2 idle clients at most but got %d", pool.idleCount)
+	}
+	if reused := get(peerAddress); reused != second {
+		t.Errorf("expected least recently used client evicted and most recently used one reused")
+	}
+
+	pool.Close()
+	if pool.idleCount != 0 || len(pool.idleClients) != 0 {
+		t.Errorf("expected no idle clients after Close but got %d", pool.idleCount)
+	}
+	pool.Put(second)
+	if reused := get(peerAddress); reused == second {
+		t.Errorf("expected client put back after Close not reused")
+	}
+}
@@ -0,0 +1,684 @@
+package audiostrike
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/mux"
+)
+
+// TestDownloadTracksResume tests that a client resumes a track download after the bytes it already has,
+// and that it downloads the whole track again if those bytes do not match or the peer ignores ranges.
+func TestDownloadTracksResume(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	err = fileServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID}
+	err = fileServer.StoreTrack(track, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	payload := bytes.Repeat([]byte("0123456789"), 100)
+	err = fileServer.StoreTrackPayload(track, payload)
+	if err != nil {
+		t.Fatalf("StoreTrackPayload error: %v", err)
+	}
+
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	var isDropping, isIgnoringRanges, isFlipping bool
+	testRouter := mux.NewRouter()
+	testRouter.HandleFunc("/art/{artist:[^/]*}/{track:.*}", func(w http.ResponseWriter, req *http.Request) {
+		if isFlipping {
+			// Flip a byte in the middle of the stream after sending the first half intact.
+			flippedPayload := append([]byte{}, payload...)
+			flippedPayload[len(payload)/2] ^= 0xff
+			w.Write(flippedPayload[:len(payload)/2])
+			w.(http.Flusher).Flush()
+			w.Write(flippedPayload[len(payload)/2:])
+			return
+		}
+		if isDropping {
+			// Drop the connection after half the track.
+			isDropping = false
+			w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+			w.Write(payload[:len(payload)/2])
+			return
+		}
+		if isIgnoringRanges {
+			w.Write(payload)
+			return
+		}
+		austkServer.getArtHandler(w, req)
+	}).Methods("GET")
+	testHttpServer := httptest.NewServer(testRouter)
+	defer testHttpServer.Close()
+	testUrl, _ := url.Parse(testHttpServer.URL)
+
+	localDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(localDir)
+	localStorage, err := NewFileServer(localDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", localDir, err)
+	}
+	err = localStorage.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	err = localStorage.StorePeer(&art.Peer{Pubkey: mockPubkey, Host: testUrl.Hostname()}, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StorePeer error: %v", err)
+	}
+	client := &Client{
+		peerAddress: testUrl.Host,
+		httpClient:  &http.Client{},
+		publisher:   mockLightningNode,
+		ctx:         context.Background(),
+		logger:      componentLogger("client"),
+	}
+	partFilename := localStorage.TrackFilePath(track) + ".part"
+
+	tests := []struct {
+		name             string
+		downloaded       []byte
+		isDropping       bool
+		isIgnoringRanges bool
+	}{
+		{"new download", nil, false, false},
+		{"resumed download", payload[:300], false, false},
+		{"mismatched prefix", bytes.Repeat([]byte("x"), 300), false, false},
+		{"dropped connection", nil, true, false},
+		{"peer ignores ranges", payload[:300], false, true},
+	}
+	for _, test := range tests {
+		os.Remove(localStorage.TrackFilePath(track))
+		if test.downloaded != nil {
+			err = writePayloadFile(partFilename, test.downloaded)
+			if err != nil {
+				t.Fatalf("%s: writePayloadFile error: %v", test.name, err)
+			}
+		}
+		isDropping, isIgnoringRanges = test.isDropping, test.isIgnoringRanges
+
+		err = client.DownloadTracks([]*art.Track{track}, localStorage)
+		if err != nil {
+			t.Errorf("%s: DownloadTracks error: %v", test.name, err)
+		}
+		downloadedPayload, err := ioutil.ReadFile(localStorage.TrackFilePath(track))
+		if err != nil || !bytes.Equal(downloadedPayload, payload) {
+			t.Errorf("%s: expected %d-byte payload but got %d bytes, error: %v",
+				test.name, len(payload), len(downloadedPayload), err)
+		}
+		_, err = os.Stat(partFilename)
+		if !os.IsNotExist(err) {
+			t.Errorf("%s: expected %s to be removed after download but got %v", test.name, partFilename, err)
+		}
+	}
+
+	// Reject bytes that do not match the published payload hash, even after another track failed to download.
+	os.Remove(localStorage.TrackFilePath(track))
+	otherHash := sha256.Sum256([]byte("other payload"))
+	tamperedTrack := &art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID, PayloadSha256: otherHash[:]}
+	missingTrack := &art.Track{ArtistId: mockArtistID, ArtistTrackId: unknownID}
+	err = client.DownloadTracks([]*art.Track{missingTrack, tamperedTrack}, localStorage)
+	if !errors.Is(err, ErrPayloadMismatch) {
+		t.Errorf("expected ErrPayloadMismatch for tampered payload but got %v", err)
+	}
+	for _, filename := range []string{localStorage.TrackFilePath(track), partFilename} {
+		_, err = os.Stat(filename)
+		if !os.IsNotExist(err) {
+			t.Errorf("expected no %s for tampered payload but got %v", filename, err)
+		}
+	}
+
+	// Reject a peer that flips a byte mid-stream of a track published with its payload hash.
+	payloadHash := sha256.Sum256(payload)
+	hashedTrack := &art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID, PayloadSha256: payloadHash[:]}
+	isFlipping = true
+	err = client.DownloadTracks([]*art.Track{hashedTrack}, localStorage)
+	isFlipping = false
+	if !errors.Is(err, ErrPayloadMismatch) {
+		t.Errorf("expected ErrPayloadMismatch for a flipped byte but got %v", err)
+	}
+	for _, filename := range []string{localStorage.TrackFilePath(track), partFilename} {
+		_, err = os.Stat(filename)
+		if !os.IsNotExist(err) {
+			t.Errorf("expected no %s for a flipped byte but got %v", filename, err)
+		}
+	}
+	err = client.DownloadTracks([]*art.Track{hashedTrack}, localStorage)
+	if err != nil {
+		t.Errorf("DownloadTracks of intact payload with its hash, error: %v", err)
+	}
+	downloadedPayload, err := ioutil.ReadFile(localStorage.TrackFilePath(track))
+	if err != nil || !bytes.Equal(downloadedPayload, payload) {
+		t.Errorf("expected %d-byte payload matching its hash but got %d bytes, error: %v",
+			len(payload), len(downloadedPayload), err)
+	}
+
+	// Fetch a paid track pinned in IPFS without paying the peer, and from the peer if IPFS has other bytes.
+	ipfs := &fakeIPFS{
+		content: map[string][]byte{"bafkpinned": payload, "bafktampered": []byte("other payload")},
+		pinned:  make(map[string]bool),
+	}
+	ipfsServer := httptest.NewServer(ipfs)
+	defer ipfsServer.Close()
+	gatewayCfg := *cfg
+	gatewayCfg.IPFSGateway = ipfsServer.URL
+	client.ipfs, err = NewIPFSNode(&gatewayCfg)
+	if err != nil {
+		t.Fatalf("NewIPFSNode error: %v", err)
+	}
+	pinnedTrack := proto.Clone(hashedTrack).(*art.Track)
+	pinnedTrack.PayloadCid = "bafkpinned"
+	pinnedTrack.EffectivePriceSats = 1000
+	os.Remove(localStorage.TrackFilePath(track))
+	isFlipping = true
+	err = client.DownloadTracks([]*art.Track{pinnedTrack}, localStorage)
+	isFlipping = false
+	downloadedPayload, _ = ioutil.ReadFile(localStorage.TrackFilePath(track))
+	if err != nil || !bytes.Equal(downloadedPayload, payload) {
+		t.Errorf("expected payload fetched from ipfs without purchase but got %d bytes, error: %v",
+			len(downloadedPayload), err)
+	}
+	tamperedPinnedTrack := proto.Clone(hashedTrack).(*art.Track)
+	tamperedPinnedTrack.PayloadCid = "bafktampered"
+	os.Remove(localStorage.TrackFilePath(track))
+	err = client.DownloadTracks([]*art.Track{tamperedPinnedTrack}, localStorage)
+	downloadedPayload, _ = ioutil.ReadFile(localStorage.TrackFilePath(track))
+	if err != nil || !bytes.Equal(downloadedPayload, payload) {
+		t.Errorf("expected payload downloaded from the peer after ipfs mismatch but got %d bytes, error: %v",
+			len(downloadedPayload), err)
+	}
+	client.ipfs = nil
+
+	// A partial download, of any container, does not stop the next FileServer from reading the art directory.
+	for _, filename := range []string{partFilename, filepath.Join(localDir, mockArtistID, "recording.wav.part")} {
+		err = writePayloadFile(filename, payload[:300])
+		if err != nil {
+			t.Fatalf("writePayloadFile error: %v", err)
+		}
+	}
+	_, err = NewFileServer(localDir)
+	if err != nil {
+		t.Errorf("NewFileServer(%s) with partial download, error: %v", localDir, err)
+	}
+}
+
+// TestDownloadAlbumArt tests that a client downloads and stores the cover art of albums from its peer,
+// rejecting an image that does not match the hash published for the album.
+func TestDownloadAlbumArt(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	err = fileServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	album := &art.Album{ArtistId: mockArtistID, ArtistAlbumId: "album", Title: "Album"}
+	err = fileServer.StoreAlbum(album, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreAlbum error: %v", err)
+	}
+	err = fileServer.StoreAlbumArt(album, []byte("cover"), "image/jpeg")
+	if err != nil {
+		t.Fatalf("StoreAlbumArt error: %v", err)
+	}
+
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	testRouter := mux.NewRouter()
+	testRouter.HandleFunc("/cover/{artist:[^/]*}/{album:.*}", austkServer.albumArtHandler).Methods("GET")
+	testHttpServer := httptest.NewServer(testRouter)
+	defer testHttpServer.Close()
+	testUrl, _ := url.Parse(testHttpServer.URL)
+
+	localDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(localDir)
+	localStorage, err := NewFileServer(localDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", localDir, err)
+	}
+	err = localStorage.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	syncedAlbum := proto.Clone(album).(*art.Album)
+	err = localStorage.StoreAlbum(syncedAlbum, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreAlbum error: %v", err)
+	}
+	client := &Client{
+		peerAddress: testUrl.Host,
+		httpClient:  &http.Client{},
+		publisher:   mockLightningNode,
+		ctx:         context.Background(),
+		logger:      componentLogger("client"),
+	}
+
+	err = client.DownloadAlbumArt([]*art.Album{syncedAlbum}, localStorage)
+	if err != nil {
+		t.Errorf("DownloadAlbumArt error: %v", err)
+	}
+	image, mime, err := localStorage.AlbumArt(mockArtistID, "album")
+	if err != nil || string(image) != "cover" || mime != "image/jpeg" {
+		t.Errorf("expected jpeg cover but got %s %s, error: %v", mime, image, err)
+	}
+
+	otherHash := sha256.Sum256([]byte("other cover"))
+	tamperedAlbum := &art.Album{ArtistId: mockArtistID, ArtistAlbumId: "album", CoverArtMime: "image/jpeg", CoverArtSha256: otherHash[:]}
+	err = client.DownloadAlbumArt([]*art.Album{tamperedAlbum}, localStorage)
+	if !errors.Is(err, ErrPayloadMismatch) {
+		t.Errorf("expected ErrPayloadMismatch for tampered cover art but got %v", err)
+	}
+
+	_, _, err = client.GetAlbumArt(&art.Album{ArtistId: mockArtistID, ArtistAlbumId: unknownID})
+	if !errors.Is(err, ErrArtNotFound) {
+		t.Errorf("expected ErrArtNotFound for cover art of unknown album but got %v", err)
+	}
+
+	response, err := http.Get(testHttpServer.URL + "/cover/" + mockArtistID + "/album")
+	if err != nil || response.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("expected cover art served with nosniff but got %v, error: %v", response, err)
+	}
+	err = fileServer.StoreAlbumArt(album, []byte("<script>alert(1)</script>"), "text/html")
+	if err != nil {
+		t.Fatalf("StoreAlbumArt error: %v", err)
+	}
+	_, _, err = client.GetAlbumArt(album)
+	if !errors.Is(err, ErrArtNotFound) {
+		t.Errorf("expected ErrArtNotFound for html cover art but got %v", err)
+	}
+	htmlAlbum := &art.Album{ArtistId: mockArtistID, ArtistAlbumId: "album", CoverArtMime: "text/html"}
+	err = client.DownloadAlbumArt([]*art.Album{htmlAlbum}, localStorage)
+	if err == nil {
+		t.Errorf("expected html cover art to be refused")
+	}
+}
+
+// TestSyncAlbumFromPeer tests that a client syncs only the art of the requested album from its peer,
+// keeping the art it synced before, and that a request for an unknown artist fails with ErrArtNotFound.
+func TestSyncAlbumFromPeer(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	err = fileServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	for _, albumID := range []string{"dirt", "facelift"} {
+		err = fileServer.StoreAlbum(&art.Album{ArtistId: mockArtistID, ArtistAlbumId: albumID}, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreAlbum %s error: %v", albumID, err)
+		}
+		track := &art.Track{ArtistId: mockArtistID, ArtistAlbumId: albumID, ArtistTrackId: albumID + "/track"}
+		err = fileServer.StoreTrack(track, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreTrack %s error: %v", track.ArtistTrackId, err)
+		}
+	}
+
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	testHttpServer := httptest.NewServer(http.HandlerFunc(austkServer.getAllArtHandler))
+	defer testHttpServer.Close()
+	testUrl, _ := url.Parse(testHttpServer.URL)
+
+	localDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(localDir)
+	localStorage, err := NewFileServer(localDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", localDir, err)
+	}
+	client, err := NewClient(context.Background(), TorProxyDisabled, testUrl.Host, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	defer client.CloseConnection()
+
+	resources, err := client.SyncAlbumFromPeer(mockArtistID, "dirt", localStorage)
+	if err != nil {
+		t.Fatalf("SyncAlbumFromPeer error: %v", err)
+	}
+	if len(resources.Albums) != 1 || len(resources.Tracks) != 1 || len(resources.Peers) != 0 ||
+		resources.ScopeArtistId != mockArtistID || resources.ScopeAlbumId != "dirt" {
+		t.Errorf("expected only album dirt and its track but got %v", resources)
+	}
+	_, err = localStorage.Track(mockArtistID, "dirt/track")
+	if err != nil {
+		t.Errorf("expected track of synced album but got error %v", err)
+	}
+	_, err = localStorage.Track(mockArtistID, "facelift/track")
+	if err != ErrArtNotFound {
+		t.Errorf("expected no track of other album but got error %v", err)
+	}
+	cursor, err := localStorage.SyncCursor(mockPubkey)
+	if err != nil || cursor != 0 {
+		t.Errorf("expected no sync cursor after scoped sync but got %d, error: %v", cursor, err)
+	}
+
+	_, err = client.SyncArtistFromPeer(mockArtistID, localStorage)
+	if err != nil {
+		t.Fatalf("SyncArtistFromPeer error: %v", err)
+	}
+	for _, trackID := range []string{"dirt/track", "facelift/track"} {
+		_, err = localStorage.Track(mockArtistID, trackID)
+		if err != nil {
+			t.Errorf("expected track %s of synced artist but got error %v", trackID, err)
+		}
+	}
+
+	_, err = client.SyncArtistFromPeer(unknownID, localStorage)
+	if !errors.Is(err, ErrArtNotFound) {
+		t.Errorf("expected ErrArtNotFound syncing unknown artist but got %v", err)
+	}
+	_, err = client.SyncAlbumFromPeer(mockArtistID, unknownID, localStorage)
+	if !errors.Is(err, ErrArtNotFound) {
+		t.Errorf("expected ErrArtNotFound syncing unknown album but got %v", err)
+	}
+}
+
+// TestSyncArtistPublications tests that a client syncs each artist hosted by its peer from the artist's own
+// publication, and syncs again only the publications updated since their last sync.
+func TestSyncArtistPublications(t *testing.T) {
+	const hostedArtistID = "hostedartist"
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	hostingCfg := *cfg
+	hostingCfg.HostedArtistIDs = []string{hostedArtistID}
+	mockLightningNode, err := NewMockLightningNode(&hostingCfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(&hostingCfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	for _, artistID := range []string{mockArtistID, hostedArtistID} {
+		track := &art.Track{ArtistId: artistID, ArtistTrackId: artistID + "track", Title: "Track by " + artistID}
+		err = fileServer.StoreTrack(track, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreTrack %s error: %v", track.ArtistTrackId, err)
+		}
+		err = austkServer.publish(artistID)
+		if err != nil {
+			t.Fatalf("publish %s error: %v", artistID, err)
+		}
+	}
+	// Each artist's publication has only that artist's art, so a restart indexes each from its own .art file.
+	restartedServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s) again, error: %v", artDir, err)
+	}
+	_, err = restartedServer.Track(hostedArtistID, hostedArtistID+"track")
+	if err != nil {
+		t.Errorf("expected track of hosted artist published on its own but got error %v", err)
+	}
+
+	testRouter := mux.NewRouter()
+	testRouter.HandleFunc("/handshake", austkServer.handshakeHandler).Methods("POST")
+	testRouter.HandleFunc("/publications", austkServer.publicationsHandler).Methods("GET")
+	testRouter.HandleFunc("/publication/{artist}", austkServer.artistPublicationHandler).Methods("GET")
+	testHttpServer := httptest.NewServer(testRouter)
+	defer testHttpServer.Close()
+	testUrl, _ := url.Parse(testHttpServer.URL)
+
+	localStorage := NewMemoryArtServer()
+	client, err := NewClient(context.Background(), TorProxyDisabled, testUrl.Host, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	defer client.CloseConnection()
+
+	listings, err := client.ListPublications()
+	if err != nil || len(listings) != 2 || listings[0].ArtistID != mockArtistID || listings[1].ArtistID != hostedArtistID {
+		t.Fatalf("expected publications of %s and %s but got %v, error: %v", mockArtistID, hostedArtistID, listings, err)
+	}
+	publication, err := client.GetArtistPublicationByTor(hostedArtistID, 0)
+	if err != nil {
+		t.Fatalf("GetArtistPublicationByTor error: %v", err)
+	}
+	resources, _ := read(publication)
+	if publication.Artist.ArtistId != hostedArtistID || len(resources.Tracks) != 1 || len(resources.Peers) != 0 ||
+		isPartialResources(resources) {
+		t.Errorf("expected all the art of only %s signed by that artist but got %v", hostedArtistID, resources)
+	}
+	_, err = client.GetArtistPublicationByTor(unknownID, 0)
+	if !errors.Is(err, ErrArtNotFound) {
+		t.Errorf("expected ErrArtNotFound getting publication of unhosted artist but got %v", err)
+	}
+
+	resources, err = client.SyncFromPeer(mockPubkey, localStorage)
+	if err != nil {
+		t.Fatalf("SyncFromPeer error: %v", err)
+	}
+	if len(resources.Tracks) != 2 {
+		t.Errorf("expected the tracks of both artists synced but got %v", resources.Tracks)
+	}
+	for _, listing := range listings {
+		cursor, err := localStorage.SyncCursor(artistSyncCursorKey(mockPubkey, listing.ArtistID))
+		if err != nil || cursor != listing.AsOf {
+			t.Errorf("expected sync cursor of %s at %d but got %d, error: %v", listing.ArtistID, listing.AsOf, cursor, err)
+		}
+	}
+
+	// Rewind the cursor of the hosted artist as if its art were updated after the last sync.
+	hostedCursorKey := artistSyncCursorKey(mockPubkey, hostedArtistID)
+	err = localStorage.StoreSyncCursor(hostedCursorKey, listings[1].AsOf-1)
+	if err != nil {
+		t.Fatalf("StoreSyncCursor error: %v", err)
+	}
+	resources, err = client.SyncFromPeer(mockPubkey, localStorage)
+	if err != nil {
+		t.Fatalf("SyncFromPeer again, error: %v", err)
+	}
+	if len(resources.Tracks) != 1 || resources.Tracks[0].ArtistId != hostedArtistID {
+		t.Errorf("expected only the art of %s synced again but got %v", hostedArtistID, resources)
+	}
+}
+
+// TestNewClientRoute tests that a client dials only .onion peers over tor unless tor is disabled,
+// and that its connection errors tell which way it dialed.
+func TestNewClientRoute(t *testing.T) {
+	const torProxy = "socks5://127.0.0.1:9050"
+	tests := []struct {
+		torProxy    string
+		peerAddress string
+		isOverTor   bool
+	}{
+		{torProxy, "27oxo32rz47oiokfmlnt6ig7qmp6xtq7hgbq67pypfonxs7ubvsualid.onion:53545", true},
+		{torProxy, "27OXO32RZ47OIOKFMLNT6IG7QMP6XTQ7HGBQ67PYPFONXS7UBVSUALID.ONION:53545", true},
+		{torProxy, "192.168.1.2:53545", false},
+		{torProxy, "music.example.com:53545", false},
+		{TorProxyDisabled, "27oxo32rz47oiokfmlnt6ig7qmp6xtq7hgbq67pypfonxs7ubvsualid.onion:53545", false},
+		{"", "27oxo32rz47oiokfmlnt6ig7qmp6xtq7hgbq67pypfonxs7ubvsualid.onion:53545", false},
+	}
+	for _, test := range tests {
+		client, err := NewClient(context.Background(), test.torProxy, test.peerAddress, &mockPublisher)
+		if err != nil {
+			t.Fatalf("NewClient(%s, %s), error: %v", test.torProxy, test.peerAddress, err)
+		}
+		isOverTor := client.torProxy != ""
+		if isOverTor != test.isOverTor {
+			t.Errorf("expected client with proxy %q to %s over tor: %t but got %t",
+				test.torProxy, test.peerAddress, test.isOverTor, isOverTor)
+		}
+		client.CloseConnection()
+	}
+
+	// Nothing listens on the reserved port 0, so a direct dial fails.
+	client, err := NewClient(context.Background(), torProxy, "127.0.0.1:0", &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	defer client.CloseConnection()
+	_, err = client.GetAllArtByTor(0)
+	if err == nil || !strings.Contains(err.Error(), "directly") {
+		t.Errorf("expected error connecting directly but got %v", err)
+	}
+}
+
+// TestGossipedPeers verifies that a client lists each peer gossiped by its peer once, unless already stored.
+func TestGossipedPeers(t *testing.T) {
+	storedPeer := &art.Peer{Pubkey: "storedpubkey", Host: "stored.onion", Port: 53545}
+	localStorage := &MockArtServer{peers: map[string]*art.Peer{storedPeer.Pubkey: storedPeer}}
+	gossipedPeer := &art.Peer{Pubkey: "gossipedpubkey", Host: "gossiped.onion", Port: 53545}
+	resources := &art.ArtResources{Peers: []*art.Peer{storedPeer, gossipedPeer, gossipedPeer}}
+
+	client, err := NewClient(context.Background(), TorProxyDisabled, "127.0.0.1:0", &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	defer client.CloseConnection()
+	peers, err := client.GossipedPeers(resources, localStorage)
+	if err != nil {
+		t.Fatalf("GossipedPeers error: %v", err)
+	}
+	if len(peers) != 1 || peers[0].Pubkey != gossipedPeer.Pubkey {
+		t.Errorf("expected only gossiped peer %s but got %v", gossipedPeer.Pubkey, peers)
+	}
+}
+
+// TestConnectCatalogDownloadTrack tests that a client from Connect gets the peer's catalog, buys and downloads
+// a priced track from it, and fails with typed errors for a tampered payload and an unreachable peer.
+func TestConnectCatalogDownloadTrack(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	err = fileServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID, Price: &art.Price{Sats: 100}}
+	err = fileServer.StoreTrack(track, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	payload := bytes.Repeat([]byte("0123456789"), 100)
+	err = fileServer.StoreTrackPayload(track, payload)
+	if err != nil {
+		t.Fatalf("StoreTrackPayload error: %v", err)
+	}
+
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	testRouter := mux.NewRouter()
+	testRouter.HandleFunc("/", austkServer.getAllArtHandler).Methods("GET")
+	testRouter.HandleFunc("/handshake", austkServer.handshakeHandler).Methods("POST")
+	testRouter.HandleFunc("/art/{artist:[^/]*}/{track:.*}", austkServer.getArtHandler).Methods("GET")
+	testRouter.HandleFunc("/invoice/{artist:[^/]*}/{track:.*}", austkServer.createInvoiceHandler).Methods("POST")
+	testHttpServer := httptest.NewServer(testRouter)
+	defer testHttpServer.Close()
+	testUrl, _ := url.Parse(testHttpServer.URL)
+
+	client, err := Connect(context.Background(), TorProxyDisabled, testUrl.Host, mockLightningNode)
+	if err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+	defer client.CloseConnection()
+	resources, err := client.Catalog()
+	if err != nil {
+		t.Fatalf("Catalog error: %v", err)
+	}
+	if len(resources.Tracks) != 1 || resources.Tracks[0].EffectivePriceSats != 100 {
+		t.Fatalf("expected the priced track in the catalog but got %v", resources)
+	}
+	catalogTrack := resources.Tracks[0]
+
+	downloadedPayload, err := client.DownloadTrack(catalogTrack)
+	if err != nil || !bytes.Equal(downloadedPayload, payload) {
+		t.Errorf("expected %d downloaded bytes but got %d, error: %v", len(payload), len(downloadedPayload), err)
+	}
+	catalogTrack.PayloadSha256 = []byte("tampered")
+	_, err = client.DownloadTrack(catalogTrack)
+	if !errors.Is(err, ErrPayloadMismatch) {
+		t.Errorf("expected ErrPayloadMismatch for a payload with another hash but got %v", err)
+	}
+
+	testHttpServer.Close()
+	_, err = Connect(context.Background(), TorProxyDisabled, testUrl.Host, mockLightningNode)
+	if !errors.Is(err, ErrPeerUnreachable) {
+		t.Errorf("expected ErrPeerUnreachable connecting to a stopped peer but got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package audiostrike
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codecs to compress the art a peer serves to sync, named as http content codings
+// and, for the Handshake, as features of the sync protocol.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+	CompressionNone = "none"
+)
+
+// maxPublicationBytes limits the art a client reads from a peer, decompressed,
+// so that a small compressed reply cannot expand to exhaust its memory.
+const maxPublicationBytes = 64 << 20
+
+// validateCompression checks that codec is gzip, zstd, or none.
+func validateCompression(codec string) error {
+	switch codec {
+	case CompressionGzip, CompressionZstd, CompressionNone:
+		return nil
+	default:
+		return fmt.Errorf("invalid sync compression %q: use gzip, zstd, or none", codec)
+	}
+}
+
+// compressionCodec gets the codec with which to ask the client's peer to compress its art:
+// the configured one if the protocol negotiated with the peer supports it, or else gzip if the peer supports that.
+// It gets "" to ask for none, e.g. before the handshake.
+func (client *Client) compressionCodec() string {
+	if client.protocol == nil || client.compression == CompressionNone {
+		return ""
+	}
+	for _, codec := range []string{client.compression, CompressionGzip} {
+		if client.protocol.Supports(codec) {
+			return codec
+		}
+	}
+	return ""
+}
+
+// acceptedCodec gets the codec of this node that the request accepts in Accept-Encoding, zstd first, or "" for none.
+func acceptedCodec(req *http.Request) string {
+	accepted := make(map[string]bool)
+	for _, coding := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		// Ignore any q-value but a refusal with q=0.
+		parts := strings.SplitN(strings.TrimSpace(coding), ";", 2)
+		if len(parts) == 2 && strings.ReplaceAll(parts[1], " ", "") == "q=0" {
+			continue
+		}
+		accepted[strings.ToLower(parts[0])] = true
+	}
+	for _, codec := range []string{CompressionZstd, CompressionGzip} {
+		if accepted[codec] {
+			return codec
+		}
+	}
+	return ""
+}
+
+// compress compresses data with codec.
+func compress(codec string, data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	var writer io.WriteCloser
+	var err error
+	switch codec {
+	case CompressionGzip:
+		writer = gzip.NewWriter(&compressed)
+	case CompressionZstd:
+		writer, err = zstd.NewWriter(&compressed)
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", codec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = writer.Write(data)
+	if err != nil {
+		writer.Close()
+		return nil, err
+	}
+	err = writer.Close()
+	return compressed.Bytes(), err
+}
+
+// writeCompressed replies with data, compressed with the codec the request accepts, if any.
+// It is for art listings, which compress well, and not for track payloads, which are compressed audio already.
+func (server *AustkServer) writeCompressed(w http.ResponseWriter, req *http.Request, data []byte) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if codec := acceptedCodec(req); codec != "" {
+		compressed, err := compress(codec, data)
+		if err != nil {
+			server.logger.Error("failed to compress reply", "compression", codec, "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Encoding", codec)
+		data = compressed
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// readDecompressed reads the body of response, decompressing it as its Content-Encoding says.
+// It fails if the body decompresses to more than maxBytes.
+func readDecompressed(response *http.Response, maxBytes int64) ([]byte, error) {
+	var reader io.Reader = response.Body
+	switch codec := response.Header.Get("Content-Encoding"); codec {
+	case "", "identity":
+	case CompressionGzip:
+		gzipReader, err := gzip.NewReader(response.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case CompressionZstd:
+		zstdReader, err := zstd.NewReader(response.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer zstdReader.Close()
+		reader = zstdReader
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", codec)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(reader, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, fmt.Errorf("reply of %s exceeds %d bytes decompressed", response.Request.URL, maxBytes)
+	}
+	return data, nil
+}
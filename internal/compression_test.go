@@ -0,0 +1,117 @@
+package audiostrike
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/gorilla/mux"
+)
+
+// countingResponseWriter counts the bytes of the replies written through it.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	bytes *int
+}
+
+func (w countingResponseWriter) Write(data []byte) (int, error) {
+	*w.bytes += len(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// TestSyncCompression verifies that a client syncs the same art from its peer compressed with the codec
+// negotiated by the handshake, in far fewer bytes than uncompressed.
+func TestSyncCompression(t *testing.T) {
+	artServer := NewMemoryArtServer()
+	err := artServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	const trackCount = 200
+	for i := 0; i < trackCount; i++ {
+		track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: fmt.Sprintf("track%d", i),
+			Title: fmt.Sprintf("Track %d", i)}
+		err = artServer.StoreTrack(track, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreTrack error: %v", err)
+		}
+	}
+	mockLightningNode, err := NewMockLightningNode(cfg, artServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, artServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	servedBytes := 0
+	testRouter := mux.NewRouter()
+	testRouter.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		austkServer.getAllArtHandler(countingResponseWriter{ResponseWriter: w, bytes: &servedBytes}, req)
+	}).Methods("GET")
+	testRouter.HandleFunc("/publication/{artist}", func(w http.ResponseWriter, req *http.Request) {
+		austkServer.artistPublicationHandler(countingResponseWriter{ResponseWriter: w, bytes: &servedBytes}, req)
+	}).Methods("GET")
+	testRouter.HandleFunc("/publications", austkServer.publicationsHandler).Methods("GET")
+	testRouter.HandleFunc("/handshake", austkServer.handshakeHandler).Methods("POST")
+	testHttpServer := httptest.NewServer(testRouter)
+	defer testHttpServer.Close()
+	testUrl, _ := url.Parse(testHttpServer.URL)
+
+	bytesByCodec := make(map[string]int)
+	for _, codec := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		client, err := NewClient(context.Background(), TorProxyDisabled, testUrl.Host, mockLightningNode)
+		if err != nil {
+			t.Fatalf("NewClient error: %v", err)
+		}
+		client.compression = codec
+		servedBytes = 0
+		resources, err := client.SyncFromPeer(mockPubkey, NewMemoryArtServer())
+		client.CloseConnection()
+		if err != nil {
+			t.Fatalf("SyncFromPeer with %s compression error: %v", codec, err)
+		}
+		if len(resources.Tracks) != trackCount {
+			t.Errorf("expected %d tracks synced with %s compression but got %d", trackCount, codec, len(resources.Tracks))
+		}
+		bytesByCodec[codec] = servedBytes
+	}
+	t.Logf("bytes served to sync %d tracks: %v", trackCount, bytesByCodec)
+	for _, codec := range []string{CompressionGzip, CompressionZstd} {
+		if bytesByCodec[codec]*3 > bytesByCodec[CompressionNone] {
+			t.Errorf("expected %s to compress art to under a third but got %d of %d bytes",
+				codec, bytesByCodec[codec], bytesByCodec[CompressionNone])
+		}
+	}
+}
+
+// TestReadDecompressedLimit verifies that a reply is refused once it decompresses to more than the limit.
+func TestReadDecompressedLimit(t *testing.T) {
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	gzipWriter.Write(make([]byte, 1<<20))
+	gzipWriter.Close()
+	reply := func() *http.Response {
+		return &http.Response{
+			Header:  http.Header{"Content-Encoding": []string{CompressionGzip}},
+			Body:    ioutil.NopCloser(bytes.NewReader(compressed.Bytes())),
+			Request: httptest.NewRequest("GET", "/publications", nil),
+		}
+	}
+
+	data, err := readDecompressed(reply(), 1<<20)
+	if err != nil || len(data) != 1<<20 {
+		t.Errorf("expected %d bytes within the limit but got %d, error: %v", 1<<20, len(data), err)
+	}
+	_, err = readDecompressed(reply(), 1<<20-1)
+	if err == nil {
+		t.Errorf("expected error for %d compressed bytes that decompress past the limit", compressed.Len())
+	}
+}
@@ -2,15 +2,20 @@ package audiostrike
 
 import (
 	"bufio"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	flags "github.com/jessevdk/go-flags"
-	"log"
+	"io"
+	"log/slog"
 	"net"
 	"os"
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -19,11 +24,43 @@ const (
 	defaultRESTPort     = 53545 // 0xd129 from Unicode symbol 0x1d129 for multi-measure rest
 	defaultRPCPort      = 53308 // 0xd03c from Unicode symbol 0x1d03c for Byzantine musical symbol rapisma
 	defaultArtDirName   = "art"
+	defaultDbFilename   = "austk.db"
+	defaultDbHost       = "localhost"
 	defaultTorProxy     = "socks5://127.0.0.1:9050"
 	defaultTLSCertPath  = "./tls.cert"
 	defaultMacaroonPath = "./admin.macaroon"
 	defaultLndHost      = "127.0.0.1" // "27oxo32rz47oiokfmlnt6ig7qmp6xtq7hgbq67pypfonxs7ubvsualid.onion"
 	defaultLndGrpcPort  = 10009
+	defaultLndTimeout   = 30 * time.Second
+	defaultPrice        = 1000 // satoshis to charge for a track with no price set
+	defaultMaxPeerHops  = 2
+	defaultMaxPeers     = 100
+	defaultMaxIdlePeers = 16
+	defaultPeerIdleTime = 5 * time.Minute
+	defaultSyncWorkers  = 4
+	// defaultMaxPeerDials limits the gossiped peers dialed in each sync, since peers may gossip peers that never answer.
+	defaultMaxPeerDials = 20
+	// defaultInvoiceExpirySeconds leaves a buyer reaching the node over tor time to pay,
+	// while an unpaid invoice goes stale well before lnd's default hour.
+	defaultInvoiceExpirySeconds = 15 * 60
+	// defaultInvoiceMemo names the track by its ids, so that the invoices in lnd identify what each sold.
+	defaultInvoiceMemo = "{artistId}/{trackId} by {artistName}"
+	// defaultPreviewSeconds is long enough to hear a track's hook without giving the track away.
+	defaultPreviewSeconds = 30
+	// defaultShutdownTimeout is how long the daemon waits on SIGINT for downloads and streams to finish.
+	defaultShutdownTimeout = 30 * time.Second
+	// defaultRequestsPerSecond and defaultBytesPerSecond limit each client only enough to stop one hogging the node.
+	defaultRequestsPerSecond = 20
+	defaultBytesPerSecond    = 8 << 20
+	defaultQuotaPeriod       = QuotaPeriodCalendar
+	defaultSyncCompression   = CompressionGzip
+	// defaultNetwork is regtest to avoid risking real funds and to avoid relying on testnet miners/bandwidth.
+	defaultNetwork = NetworkRegtest
+
+	// Bitcoin networks that lnd may run on, to find its macaroon.
+	NetworkRegtest = "regtest"
+	NetworkTestnet = "testnet"
+	NetworkMainnet = "mainnet"
 
 	osMacOS   = "darwin"
 	osWindows = "windows"
@@ -32,30 +69,172 @@ const (
 var (
 	defaultDir    = defaultAppDir()
 	defaultArtDir = filepath.Join(defaultDir, defaultArtDirName)
+	defaultDbFile = filepath.Join(defaultDir, defaultDbFilename)
 )
 
 // Config for austk server.
-// These settings are specified in defaults, a config file, or the command line.
-// (Config file not yet implemented)
+// Each setting on the command line overrides the same setting in the config file (austk.config or -config),
+// which overrides the default, e.g. defaultPrice for DefaultPrice.
+// A setting of 0 is a value like any other, so -defaultprice 0 makes tracks with no price set free.
 type Config struct {
-	ArtistID       string `long:"artist" description:"artist id for publishing tracks"`
-	ArtistName     string `long:"name" description:"artist name with proper case, punctuation, spacing, etc."`
-	ConfigFilename string `long:"config" description:"config file"`
-	AddMp3Filename string `long:"add" description:"mp3 file to add"`
-	ArtDir         string `long:"dir" description:"directory storing music art/artist/album/track"`
-	TorProxy       string `long:"torproxy" description:"onion-routing proxy"`
-	PeerAddress    string `long:"peer" description:"audiostrike server peer to connect"`
-	Pubkey         string `long:"pubkey"`
-	RestHost       string `long:"host" description:"ip/tor address for this audiostrike service"`
-	RestPort       int    `long:"port" description:"port where audiostrike protocol is exposed"`
-	ListenOn       string // ip address and port to listen, e.g. 0.0.0.0:53545
-	TlsCertPath    string `long:"tlscert" description:"file path for tls cert"`
-	MacaroonPath   string `long:"macaroon" description:"file path for macaroon"`
-	LndHost        string `long:"lndhost" description:"ip/onion address of lnd"`
-	LndGrpcPort    int    `long:"lndport" description:"port where lnd exposes grpc"`
-
-	PlayMp3     bool `long:"play" description:"play imported mp3 file (requires -file)"`
-	RunAsDaemon bool `long:"daemon" description:"run as daemon until quit signal (e.g. SIGINT)"`
+	ArtistID        string   `long:"artist" description:"artist id for publishing tracks"`
+	ArtistName      string   `long:"name" description:"artist name with proper case, punctuation, spacing, etc."`
+	HostedArtistIDs []string `long:"hostartist" description:"id of another artist to publish and sell from this node's lnd (may be repeated)"`
+	ConfigFilename  string   `long:"config" description:"config file"`
+	AddMp3Filename  string   `long:"add" description:"mp3, flac, ogg, opus, or wav file to add, or a directory of them to add recursively"`
+	Price           *uint64  `long:"price" description:"price in satoshis to charge for the added track (requires -add)"`
+	AlbumPrice      *uint64  `long:"albumprice" description:"price in satoshis to charge for each track without its own price on the added track's album (requires -add)"`
+	DefaultPrice    uint64   `long:"defaultprice" description:"price in satoshis to charge for tracks with no price set, 0 for free (default 1000)"`
+	ArtDir          string   `long:"dir" description:"directory storing music art/artist/album/track"`
+	PayloadDir      string   `long:"payloaddir" description:"directory storing track payloads, e.g. on a bigger volume than -dir (default -dir)"`
+	DbEngine        string   `long:"dbengine" description:"database to store art: sqlite, mysql, postgres, or memory to lose art on exit (default stores art in files under -dir)"`
+	DbFile          string   `long:"dbfile" description:"sqlite database file (requires -dbengine=sqlite)"`
+	DbHost          string   `long:"dbhost" description:"mysql or postgres database host"`
+	DbPort          int      `long:"dbport" description:"mysql or postgres database port (default 3306 for mysql, 5432 for postgres)"`
+	DbName          string   `long:"dbname" description:"mysql or postgres database name"`
+	DbUser          string   `long:"dbuser" description:"mysql or postgres database user"`
+	DbPass          string   `long:"dbpass" description:"mysql or postgres database password" secret:"true"`
+	DbInit          bool     `long:"dbinit" description:"create the database tables if missing and apply pending schema migrations (requires -dbengine)"`
+	TorProxy        string   `long:"torproxy" description:"onion-routing proxy to dial .onion peers, or disabled (or empty) to dial every peer directly"`
+	PeerAddress     string   `long:"peer" description:"audiostrike server peer to connect"`
+	Tip             uint64   `long:"tip" description:"satoshis to tip the artist of the peer (requires -peer)"`
+	Pubkey          string   `long:"pubkey"`
+	RestHost        string   `long:"host" description:"ip/tor address for this audiostrike service to advertise to peers"`
+	RestPort        int      `long:"port" description:"port where audiostrike protocol is exposed, advertised to peers"`
+	ListenAddress   string   `long:"listen" description:"ip address to bind to serve the audiostrike protocol, e.g. 127.0.0.1 for a tor hidden service (default all interfaces)"`
+	ListenPort      int      `long:"listenport" description:"port to bind to serve the audiostrike protocol, if not the advertised -port (default -port)"`
+	TlsCertPath     string   `long:"tlscert" description:"file path for tls cert"`
+	MacaroonPath    string   `long:"macaroon" description:"file path for macaroon (default ~/.lnd/data/chain/bitcoin/{network}/admin.macaroon)"`
+	Network         string   `long:"network" description:"bitcoin network of lnd: regtest, testnet, or mainnet (default regtest)"`
+	LndHost         string   `long:"lndhost" description:"ip/onion address of lnd"`
+	LndGrpcPort     int      `long:"lndport" description:"port where lnd exposes grpc"`
+	MetricsPort     int      `long:"metrics" description:"port to serve prometheus /metrics (default off)"`
+	LogLevel        string   `long:"loglevel" description:"least severe level to log: debug, info, warn, or error"`
+
+	// Containers may pass the lnd credentials in the environment rather than mount their files.
+	MacaroonBase64 string `long:"macaroonbase64" env:"AUSTK_MACAROON_BASE64" description:"base64 of the lnd macaroon, used instead of -macaroon (env or config file only)" secret:"true" noarg:"true"`
+	TlsCertBase64  string `long:"tlscertbase64" env:"AUSTK_TLS_CERT_BASE64" description:"base64 of the lnd tls cert, used instead of -tlscert"`
+
+	// Scoped macaroons, e.g. lnd's invoice.macaroon and readonly.macaroon, limit what a leaked macaroon allows.
+	// Each lnd call uses the macaroon of its scope if configured, else the default -macaroon.
+	SignMacaroonPath     string `long:"signmacaroon" description:"file path for an lnd macaroon permitting message:write, used to sign publications"`
+	InvoiceMacaroonPath  string `long:"invoicemacaroon" description:"file path for an lnd macaroon permitting invoices:read and invoices:write, used to create and look up invoices"`
+	ReadOnlyMacaroonPath string `long:"readonlymacaroon" description:"file path for an lnd macaroon permitting info:read, message:read, and offchain:read, used for lnd info, verifying signatures, and looking up payments"`
+
+	// Invoices for tracks expire unpaid after InvoiceExpirySeconds and describe the track with the InvoiceMemo template.
+	InvoiceExpirySeconds int64  `long:"invoiceexpiry" description:"seconds until an unpaid invoice expires (default 900)"`
+	InvoiceMemo          string `long:"invoicememo" description:"memo of track invoices with {artistName}, {artistId}, {trackTitle}, {trackId}, {albumId}, or {sats} filled in (default \"{artistId}/{trackId} by {artistName}\")"`
+
+	// LndTimeout limits each call to lnd so that a hung lnd cannot block the node.
+	LndTimeout time.Duration `long:"lndtimeout" description:"longest time to wait for each call to lnd, e.g. 30s"`
+
+	// A JSON config file sets any setting by its flag name, e.g. {"artist": "alicetheartist", "lndtimeout": "1m"}.
+	JSONConfigFilename string `long:"configfile" description:"JSON config file, whose settings override those of -config"`
+	DumpConfig         bool   `long:"dumpconfig" description:"print the config resolved from defaults, config files, and flags as JSON, then exit"`
+
+	ShowVersion bool `long:"version" description:"print the version, git commit, and build date of austk, then exit"`
+
+	// AdminToken authenticates admin requests, e.g. to stream /events, besides the lnd macaroon.
+	AdminToken string `long:"admintoken" env:"AUSTK_ADMIN_TOKEN" description:"bearer token for admin requests such as GET /events" secret:"true"`
+
+	// Logger logs for each component, labelled by component.
+	// LoadConfig sets it to log to stderr at LogLevel, publishing its events to Events.
+	Logger *slog.Logger `no-flag:"true"`
+	Events *EventLog    `no-flag:"true"`
+
+	PlayMp3     bool   `long:"play" description:"play imported mp3 file (requires -file)"`
+	DryRun      bool   `long:"dryrun" description:"print the art that -add would store for the file without storing it"`
+	Transcode   string `long:"transcode" description:"format to store added wav files in: flac (default stores wav as added)"`
+	Force       bool   `long:"force" description:"store tracks that -add would skip as already stored, overwriting any with a different payload"`
+	Reanalyze   bool   `long:"reanalyze" description:"measure the loudness and duration of stored tracks added without them, then publish them"`
+	RunAsDaemon bool   `long:"daemon" description:"run as daemon until quit signal (e.g. SIGINT)"`
+	Search      string `long:"search" description:"print stored artists and tracks whose name or title contains this text, then exit"`
+	Genre       string `long:"genre" description:"search only for tracks tagged with this genre"`
+	Years       string `long:"years" description:"search only for tracks released in this year or range of years, e.g. 1992 or 1990-1999"`
+	Verify      bool   `long:"verify" description:"check stored art for tracks without payloads, albums without tracks, and payloads without tracks, then exit"`
+	Repair      bool   `long:"repair" description:"remove payload files without tracks (requires -verify)"`
+	Reindex     bool   `long:"reindex" description:"store the tracks, albums, and artists missing for the payload files of hosted artists and correct stored tracks from their files, then publish them"`
+	Rehash      bool   `long:"rehash" description:"overwrite the hash of stored tracks whose payload files have another hash (requires -reindex)"`
+	MergeArtist string `long:"mergeartist" description:"{from artist id}/{to artist id} of a duplicate artist whose albums and tracks to move to the other artist, then publish"`
+	Stats       int    `long:"stats" description:"print the plays and purchases of this many most played tracks, then exit"`
+
+	// PreviewSeconds of the start of each added track are clipped to serve free, to drive purchases.
+	PreviewSeconds uint32 `long:"preview" description:"seconds of the start of each added track to serve free as a preview, 0 for none (default 30)"`
+	Repreview      bool   `long:"repreview" description:"clip the -preview of each stored track again, e.g. after changing its length, then publish them"`
+
+	// AlbumSeparator splits the title of an added album into the levels of its ArtistAlbumId, e.g. "Anthology / Disc 1".
+	AlbumSeparator string `long:"albumseparator" description:"text that separates the levels of an added album's title in its id, e.g. \" - \" (default \"/\")"`
+
+	Playlist string   `long:"playlist" description:"title of a playlist to create of the -track tracks, then publish"`
+	Tracks   []string `long:"track" description:"{artist id}/{track id} of a track for the -playlist, repeated for each track in order"`
+
+	ExportFilename string `long:"export" description:"file to write the signed publication of the stored art to, e.g. to carry to an air-gapped node"`
+	ImportFilename string `long:"import" description:"file of a signed publication to validate and store, e.g. exported by an air-gapped node"`
+	Resign         bool   `long:"resign" description:"sign the publications of the hosted artists again with lnd's current key, stored as their pubkey, e.g. after rotating lnd's identity key"`
+
+	// A rotated key is linked from the old key, so peers accept the hosted artists' new pubkey.
+	LinkPubkey          string `long:"linkpubkey" description:"pubkey of the lnd node to rotate to, to print the signature by lnd's current key linking to it, then exit"`
+	PubkeyLinkSignature string `long:"pubkeylinksig" description:"signature printed by -linkpubkey on the node with the old key, for -resign to publish so peers accept the new pubkey"`
+
+	ListPeers  bool          `long:"listpeers" description:"print the stored peers with when each was last seen and last synced, then exit"`
+	RemovePeer string        `long:"removepeer" description:"pubkey of a stored peer to remove, then publish"`
+	PrunePeers time.Duration `long:"prunepeers" description:"remove the stored peers not synced within this long, e.g. 720h, then publish"`
+
+	// Track payloads may be stored in a bucket of an S3-compatible service, e.g. AWS S3 or MinIO,
+	// with the other art in the -dbengine database.
+	S3Endpoint  string `long:"s3endpoint" description:"url of the s3-compatible service storing track payloads in -s3bucket, e.g. http://localhost:9000 for minio (requires -dbengine; default stores payloads under -payloaddir)"`
+	S3Bucket    string `long:"s3bucket" description:"s3 bucket storing track payloads, created by -dbinit if missing"`
+	S3Region    string `long:"s3region" description:"region of -s3bucket (default us-east-1)"`
+	S3AccessKey string `long:"s3accesskey" env:"AUSTK_S3_ACCESS_KEY" description:"access key id to sign s3 requests"`
+	S3SecretKey string `long:"s3secretkey" env:"AUSTK_S3_SECRET_KEY" description:"secret access key to sign s3 requests (env only)" secret:"true" noarg:"true" no-ini:"true"`
+
+	// Track payloads may be pinned in IPFS, so the network helps distribute them, with the other art in the -dbengine database.
+	IPFSAPI     string `long:"ipfsapi" description:"url of the RPC api of a local IPFS node, e.g. http://127.0.0.1:5001, to fetch synced payloads by CID and, with -dbengine, to pin stored payloads (public to anyone with the CID)"`
+	IPFSGateway string `long:"ipfsgateway" description:"url of an IPFS gateway, e.g. https://ipfs.io, to fetch synced payloads by CID without -ipfsapi"`
+
+	// An artist may sign the publication on an air-gapped node: prepare the art, sign it there, then attach the signature.
+	PrepareSigningFilename  string `long:"preparesigning" description:"file to write the stored art to, unsigned, for an air-gapped node to sign with -signprepared"`
+	SignPreparedFilename    string `long:"signprepared" description:"file of art written by -preparesigning to sign with this node's lnd, writing the signature to {file}.sig"`
+	AttachSignatureFilename string `long:"attachsignature" description:"file of art written by -preparesigning to publish with the signature in {file}.sig"`
+
+	// Peers gossip the peers they store, to discover more peers to sync from.
+	MaxPeerHops int `long:"maxpeerhops" description:"most gossip hops away to discover peers to sync from, 0 to sync only from stored peers (default 2)"`
+	MaxPeers    int `long:"maxpeers" description:"most peers to store, past which gossiped peers are not synced (default 100)"`
+
+	// Each sync dials only so many gossiped peers, backing off from those that did not answer.
+	MaxPeerDials int `long:"maxpeerdials" description:"most gossiped peers to dial in each sync (default 20)"`
+
+	// Connections to peers are kept idle to reuse, since a tor circuit is slow to build.
+	MaxIdlePeers    int           `long:"maxidlepeers" description:"most idle peer connections to keep for reuse, 0 to close each after syncing (default 16)"`
+	PeerIdleTimeout time.Duration `long:"peeridletimeout" description:"longest time to keep a peer connection idle for reuse, e.g. 5m"`
+
+	SyncWorkers int `long:"syncworkers" description:"most peers to sync from at once (default 4)"`
+	// MaxStorageBytes caps the payloads stored, past which the payloads of synced tracks are evicted after a sync.
+	MaxStorageBytes uint64 `long:"maxstorage" description:"most bytes of track payloads to store, past which the synced tracks least recently played are evicted, 0 for no limit"`
+	// SyncInterval is how often the daemon syncs from its peers again after the sync at startup.
+	SyncInterval time.Duration `long:"syncinterval" description:"how often the daemon syncs from its peers again, e.g. 30m, 0 to sync only at startup"`
+	// SyncCompression is the codec in which to ask peers that support it for their art, though not track payloads.
+	SyncCompression string `long:"synccompression" description:"gzip, zstd, or none to compress the art synced from peers (default gzip)"`
+
+	InvoiceHash string `long:"invoice" description:"hex hash of an invoice to print whether lnd was paid for it, then exit"`
+	PaymentHash string `long:"payment" description:"hex hash of a payment to print whether lnd sent it, then exit"`
+
+	// ShutdownTimeout limits how long the daemon drains the requests in flight when it quits.
+	ShutdownTimeout time.Duration `long:"shutdowntimeout" description:"longest time to wait on quitting for downloads and streams in flight to finish, e.g. 30s"`
+
+	// Each connection and each peer pubkey is throttled past these limits on downloads and catalogs.
+	RequestsPerSecond float64 `long:"ratelimit" description:"most requests per second to serve each client, 0 for no limit (default 20)"`
+	BytesPerSecond    int64   `long:"bandwidthlimit" description:"most bytes per second to serve each client on average, 0 for no limit (default 8388608)"`
+
+	// The bytes of payloads served to each peer pubkey are counted, and refused past any monthly quota.
+	PeerMonthlyQuota uint64 `long:"peerquota" description:"most bytes of payloads to serve each peer per month, 0 for no quota (default 0)"`
+	QuotaPeriod      string `long:"quotaperiod" description:"calendar to reset each peer quota on the first of each month (UTC), or rolling to count the last 30 days"`
+
+	// A private node serves only the listed peers, each proving its pubkey by signing a challenge with its lnd.
+	AllowedPeers []string `long:"allowpeer" description:"pubkey of a peer allowed to sync from this node, which then serves no other peer (may be repeated; default serves every peer)"`
+
+	// The plays and purchases of each track are counted privately, unless listed in the catalog.
+	CatalogStats bool `long:"catalogstats" description:"list the plays and purchases of each track in the JSON catalog"`
 
 	Listeners     []net.Addr
 	RESTListeners []net.Addr
@@ -98,29 +277,57 @@ func defaultAppDir() string {
 	return "."
 }
 
-// LoadConfig reads each config value from command line or config file or defaults.
+// LoadConfig reads each config value from command line or config files or defaults.
+// A command-line flag overrides the JSON config file (-configfile), which overrides the config file (-config),
+// which overrides the default.
 func LoadConfig() (*Config, error) {
-	const logPrefix = "config LoadConfig "
-
-	cfg := getDefaultConfig()
-
 	userInputReader := bufio.NewReader(os.Stdin)
 
-	// Parse command line initially to define flags and check for an alternate config file.
-	// Then parse the config file, then override any settings with command-line args.
-	_, err := flags.Parse(cfg)
+	cfg, unknownKeys, err := parseConfig(os.Args[1:])
+	if err != nil || cfg.ShowVersion {
+		return cfg, err
+	}
+
+	cfg.PayloadDir = cfg.payloadDir()
+	cfg.Logger, err = NewLogger(os.Stderr, cfg.LogLevel)
 	if err != nil {
-		isShowingHelp := (err.(*flags.Error).Type == flags.ErrHelp)
-		if isShowingHelp {
-			return cfg, err
-		}
-		log.Fatalf(logPrefix+"Error parsing flags: %v\n", err)
+		return cfg, err
 	}
-	err = flags.IniParse(cfg.ConfigFilename, cfg)
+	cfg.Events = NewEventLog()
+	cfg.Logger = slog.New(cfg.Events.Handler(cfg.Logger.Handler()))
+	for _, key := range unknownKeys {
+		cfg.Logger.Warn("ignore unknown setting in config", "path", cfg.JSONConfigFilename, "key", key)
+	}
+	err = validateNetwork(cfg.Network)
+	if err != nil {
+		return cfg, err
+	}
+	err = validateQuotaPeriod(cfg.QuotaPeriod)
+	if err != nil {
+		return cfg, err
+	}
+	err = validateCompression(cfg.SyncCompression)
+	if err != nil {
+		return cfg, err
+	}
+	err = validatePubkeys(cfg.AllowedPeers)
 	if err != nil {
-		log.Fatalf(logPrefix+"Error parsing config: %v", err)
+		return cfg, err
+	}
+	err = validateInvoiceMemo(cfg.InvoiceMemo)
+	if err != nil {
+		return cfg, err
+	}
+	err = cfg.validateS3()
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.RunAsDaemon {
+		err = cfg.validateListen()
+		if err != nil {
+			return cfg, err
+		}
 	}
-	flags.Parse(cfg)
 
 	// The artist should configure ArtistId by specifying the `artist` flag in austk.config,
 	// or in an alternate config file specified by -config, or by command-line flag `-artist`.
@@ -132,28 +339,313 @@ func LoadConfig() (*Config, error) {
 				" with no punctuation or spaces (for example, alicetheartist): ")
 		inputArtistID, err := userInputReader.ReadString('\n')
 		if err != nil {
-			log.Printf(logPrefix+"Error reading ArtistId from stdin: %v", err)
-			return cfg, err
+			return cfg, fmt.Errorf("error reading artist id from stdin: %w", err)
 		}
-		artistID := strings.Replace(inputArtistID, "\n", "", 1)
-		artistID = strings.ReplaceAll(artistID, " ", "")
-		// TODO: strip other whitespace, punctuation, etc.
-		artistID = strings.ToLower(artistID)
+		inputArtistID = strings.TrimSpace(inputArtistID)
+		artistID := NameToID(inputArtistID)
 		if artistID == "" {
-			log.Fatalf(logPrefix + "No artist id. Specify your artist id to publish your music.")
+			return cfg, errors.New("no artist id. Specify your artist id to publish your music")
+		}
+		if artistID != inputArtistID {
+			fmt.Printf("Using artist id %s\n", artistID)
 		}
 		cfg.ArtistID = artistID
+	} else {
+		cfg.ArtistID, err = confirmArtistID(cfg.ArtistID, userInputReader, os.Stdout)
+		if err != nil {
+			return cfg, err
+		}
 	}
 
 	return cfg, err
 }
 
+// parseConfig parses the config from the command-line args, config files, and defaults, in that precedence.
+// It returns the keys of the JSON config file that name no setting.
+func parseConfig(args []string) (cfg *Config, unknownKeys []string, err error) {
+	cfg = getDefaultConfig()
+	err = rejectNoArgs(cfg, args)
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	// Parse command line initially to define flags and check for alternate config files.
+	// Then parse the config files, then override any settings with command-line args.
+	_, err = flags.ParseArgs(cfg, args)
+	if err != nil {
+		isShowingHelp := (err.(*flags.Error).Type == flags.ErrHelp)
+		if isShowingHelp {
+			return cfg, nil, err
+		}
+		return cfg, nil, fmt.Errorf("error parsing flags: %w", err)
+	}
+	err = flags.IniParse(cfg.ConfigFilename, cfg)
+	// A node configured by a JSON config file needs no austk.conf.
+	isConfiguredByJSON := cfg.JSONConfigFilename != "" && cfg.ConfigFilename == defaultConfFilename
+	if err != nil && !(isConfiguredByJSON && os.IsNotExist(err)) {
+		return cfg, nil, fmt.Errorf("error parsing config %s: %w", cfg.ConfigFilename, err)
+	}
+	if cfg.JSONConfigFilename != "" {
+		unknownKeys, err = readJSONConfig(cfg, cfg.JSONConfigFilename)
+		if err != nil {
+			return cfg, nil, err
+		}
+	}
+	// Parsing again replaces, rather than appends to, any list set by a config file.
+	_, err = flags.ParseArgs(cfg, args)
+	return cfg, unknownKeys, err
+}
+
+// rejectNoArgs returns an error if args set a setting of cfg tagged noarg:"true",
+// which must be set in the environment or a config file instead, or only in the environment if tagged no-ini.
+func rejectNoArgs(cfg *Config, args []string) error {
+	options := configOptions(cfg)
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)[0]
+		if options[name].isEnvOnly {
+			return options[name].envOnlyError(name)
+		}
+		if options[name].isNoArg {
+			return fmt.Errorf("set -%s in the environment or a config file, not on the command line, "+
+				"where other users of this host can read it", name)
+		}
+	}
+	return nil
+}
+
+// confirmArtistID checks that artistID is already an id as NameToID makes it, since it names the artist's
+// directory under ArtDir and begins the hierarchy of the artist's albums and tracks.
+// If artistID has upper-case letters, spaces, or punctuation, it asks whether to use the id NameToID makes instead,
+// reading the answer from userInputReader, and returns an error unless the answer is yes.
+func confirmArtistID(artistID string, userInputReader *bufio.Reader, out io.Writer) (string, error) {
+	normalizedID := NameToID(artistID)
+	if normalizedID == artistID {
+		return artistID, nil
+	}
+	invalidErr := fmt.Errorf("invalid artist id %q: use only lower-case letters, numbers, periods, and dashes", artistID)
+	if normalizedID == "" {
+		return "", invalidErr
+	}
+
+	fmt.Fprintf(out, "Artist id %q may only have lower-case letters, numbers, periods, and dashes.\n"+
+		"Use %s instead? [y/N]: ", artistID, normalizedID)
+	answer, err := userInputReader.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("error reading answer from stdin: %w", err)
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		return "", invalidErr
+	}
+	fmt.Fprintf(out, "Using artist id %s\n", normalizedID)
+	return normalizedID, nil
+}
+
+// validateNetwork checks that network is regtest, testnet, or mainnet.
+func validateNetwork(network string) error {
+	switch network {
+	case NetworkRegtest, NetworkTestnet, NetworkMainnet:
+		return nil
+	}
+	return fmt.Errorf("invalid network %q: use %s, %s, or %s", network, NetworkRegtest, NetworkTestnet, NetworkMainnet)
+}
+
+// validateQuotaPeriod checks that quotaPeriod is calendar or rolling.
+func validateQuotaPeriod(quotaPeriod string) error {
+	switch quotaPeriod {
+	case QuotaPeriodCalendar, QuotaPeriodRolling:
+		return nil
+	}
+	return fmt.Errorf("invalid quota period %q: use %s or %s", quotaPeriod, QuotaPeriodCalendar, QuotaPeriodRolling)
+}
+
+// validatePubkeys checks that each of pubkeys is the hex of a compressed public key, as lnd names nodes.
+func validatePubkeys(pubkeys []string) error {
+	for _, pubkey := range pubkeys {
+		keyBytes, err := hex.DecodeString(pubkey)
+		if err != nil || len(keyBytes) != 33 {
+			return fmt.Errorf("invalid pubkey %q: use the 66 hex digits of a node's pubkey", pubkey)
+		}
+	}
+	return nil
+}
+
+// validateListen checks that the daemon can bind the configured listen address and port,
+// and that peers could reach the advertised host there.
+// Only an onion host, mapped by tor to a local address, or a loopback host may be served from a loopback address.
+func (cfg *Config) validateListen() error {
+	if cfg.RestHost == "" {
+		return errors.New("no -host to advertise to peers")
+	}
+	if cfg.RestPort <= 0 || cfg.RestPort > 65535 {
+		return fmt.Errorf("invalid -port %d", cfg.RestPort)
+	}
+	if cfg.ListenPort < 0 || cfg.ListenPort > 65535 {
+		return fmt.Errorf("invalid -listenport %d", cfg.ListenPort)
+	}
+	if cfg.ListenAddress == "" {
+		return nil
+	}
+	listenIP := net.ParseIP(cfg.ListenAddress)
+	if listenIP == nil {
+		return fmt.Errorf("invalid -listen %q: use an ip address of this host", cfg.ListenAddress)
+	}
+	hostIP := net.ParseIP(cfg.RestHost)
+	isLoopbackHost := cfg.RestHost == "localhost" || (hostIP != nil && hostIP.IsLoopback())
+	if listenIP.IsLoopback() && !isLoopbackHost && !isOnionAddress(cfg.RestHost) {
+		return fmt.Errorf("peers cannot reach -host %s served only on loopback address -listen %s: "+
+			"advertise an onion -host mapped to %s, or listen on another address", cfg.RestHost, cfg.ListenAddress,
+			net.JoinHostPort(cfg.ListenAddress, strconv.Itoa(cfg.listenPort())))
+	}
+	return nil
+}
+
+// listenPort gets the configured ListenPort, or the advertised RestPort if none is configured.
+func (cfg *Config) listenPort() int {
+	if cfg.ListenPort == 0 {
+		return cfg.RestPort
+	}
+	return cfg.ListenPort
+}
+
+// listenAddress gets the address for the daemon to bind, e.g. "127.0.0.1:53545",
+// or ":53545" to bind every interface if no ListenAddress is configured.
+func (cfg *Config) listenAddress() string {
+	return net.JoinHostPort(cfg.ListenAddress, strconv.Itoa(cfg.listenPort()))
+}
+
 func getDefaultConfig() *Config {
 	return &Config{
 		ConfigFilename: defaultConfFilename,
 		ArtDir:         defaultArtDir,
+		DbFile:         defaultDbFile,
+		DbHost:         defaultDbHost,
 		TorProxy:       defaultTorProxy,
 		RestHost:       defaultRESTHost,
 		RestPort:       defaultRESTPort,
+		DefaultPrice:   defaultPrice,
+		LogLevel:       defaultLogLevel,
+		LndTimeout:     defaultLndTimeout,
+		Network:        defaultNetwork,
+		MaxPeerHops:    defaultMaxPeerHops,
+		MaxPeers:       defaultMaxPeers,
+		MaxPeerDials:   defaultMaxPeerDials,
+		MaxIdlePeers:   defaultMaxIdlePeers,
+		PreviewSeconds: defaultPreviewSeconds,
+		AlbumSeparator: DefaultHierarchySeparator,
+
+		InvoiceExpirySeconds: defaultInvoiceExpirySeconds,
+		InvoiceMemo:          defaultInvoiceMemo,
+
+		PeerIdleTimeout: defaultPeerIdleTime,
+		SyncWorkers:     defaultSyncWorkers,
+		ShutdownTimeout: defaultShutdownTimeout,
+
+		RequestsPerSecond: defaultRequestsPerSecond,
+		BytesPerSecond:    defaultBytesPerSecond,
+		QuotaPeriod:       defaultQuotaPeriod,
+		SyncCompression:   defaultSyncCompression,
+	}
+}
+
+// lndTimeout gets the configured LndTimeout, or the default if none is configured.
+func (cfg *Config) lndTimeout() time.Duration {
+	if cfg.LndTimeout <= 0 {
+		return defaultLndTimeout
+	}
+	return cfg.LndTimeout
+}
+
+// invoiceExpirySeconds gets the configured InvoiceExpirySeconds, or the default if none is configured.
+func (cfg *Config) invoiceExpirySeconds() int64 {
+	if cfg.InvoiceExpirySeconds <= 0 {
+		return defaultInvoiceExpirySeconds
+	}
+	return cfg.InvoiceExpirySeconds
+}
+
+// hierarchyRules gets the rules to normalize album titles into ids with the configured AlbumSeparator,
+// or the default if none is configured.
+func (cfg *Config) hierarchyRules() HierarchyRules {
+	return HierarchyRules{Separator: cfg.AlbumSeparator}
+}
+
+// invoiceMemo gets the configured InvoiceMemo template, or the default if none is configured.
+func (cfg *Config) invoiceMemo() string {
+	if cfg.InvoiceMemo == "" {
+		return defaultInvoiceMemo
+	}
+	return cfg.InvoiceMemo
+}
+
+// validateS3 checks that an -s3endpoint is configured with the bucket and credentials to use it,
+// and with a database to store the other art, since only DbServer stores payloads in a bucket.
+func (cfg *Config) validateS3() error {
+	if cfg.S3Endpoint == "" {
+		return nil
+	}
+	switch {
+	case cfg.S3Bucket == "":
+		return fmt.Errorf("-s3endpoint requires -s3bucket")
+	case cfg.S3AccessKey == "" || cfg.S3SecretKey == "":
+		return fmt.Errorf("-s3endpoint requires -s3accesskey and -s3secretkey, or AUSTK_S3_ACCESS_KEY and AUSTK_S3_SECRET_KEY")
+	case cfg.DbEngine != DbEngineSqlite && cfg.DbEngine != DbEngineMysql && cfg.DbEngine != DbEnginePostgres:
+		return fmt.Errorf("-s3endpoint requires -dbengine sqlite, mysql, or postgres")
+	case cfg.IPFSAPI != "":
+		return fmt.Errorf("-s3endpoint and -ipfsapi cannot both store payloads, so configure only one")
+	}
+	return nil
+}
+
+// payloadDir gets the configured PayloadDir, or the ArtDir if none is configured.
+func (cfg *Config) payloadDir() string {
+	if cfg.PayloadDir == "" {
+		return cfg.ArtDir
+	}
+	return cfg.PayloadDir
+}
+
+// network gets the configured Network, or the default if none is configured.
+func (cfg *Config) network() string {
+	if cfg.Network == "" {
+		return defaultNetwork
+	}
+	return cfg.Network
+}
+
+// peerIdleTimeout gets the configured PeerIdleTimeout, or the default if none is configured.
+func (cfg *Config) peerIdleTimeout() time.Duration {
+	if cfg.PeerIdleTimeout <= 0 {
+		return defaultPeerIdleTime
+	}
+	return cfg.PeerIdleTimeout
+}
+
+// shutdownTimeout gets the configured ShutdownTimeout, or the default if none is configured.
+func (cfg *Config) shutdownTimeout() time.Duration {
+	if cfg.ShutdownTimeout <= 0 {
+		return defaultShutdownTimeout
+	}
+	return cfg.ShutdownTimeout
+}
+
+// PublishingArtistIDs gets the ids of the artists that publish from this node:
+// the configured -artist, who signs by default, then each -hostartist not already listed.
+func (cfg *Config) PublishingArtistIDs() []string {
+	var artistIDs []string
+	isListed := make(map[string]bool)
+	for _, artistID := range append([]string{cfg.ArtistID}, cfg.HostedArtistIDs...) {
+		if artistID == "" || isListed[artistID] {
+			continue
+		}
+		isListed[artistID] = true
+		artistIDs = append(artistIDs, artistID)
 	}
+	return artistIDs
 }
@@ -0,0 +1,202 @@
+package audiostrike
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// redacted replaces the value of each secret setting in a dumped config.
+const redacted = "***"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// configOption is a setting of a Config: the field that holds it, addressable to set,
+// whether it is tagged secret:"true", e.g. a password, and whether it is tagged noarg:"true",
+// e.g. a credential that other users could read in the process list if it were a command-line arg.
+// A noarg setting also tagged no-ini:"true" is env-only: it is read only from its env variable, envName.
+type configOption struct {
+	field     reflect.Value
+	isSecret  bool
+	isNoArg   bool
+	isEnvOnly bool
+	envName   string
+}
+
+// configOptions maps the long flag name of each setting of cfg, e.g. "dbuser", onto the setting.
+func configOptions(cfg *Config) map[string]configOption {
+	options := make(map[string]configOption)
+	value := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		structField := value.Type().Field(i)
+		if name := structField.Tag.Get("long"); name != "" {
+			isNoArg := structField.Tag.Get("noarg") == "true"
+			options[name] = configOption{
+				field:     value.Field(i),
+				isSecret:  structField.Tag.Get("secret") == "true",
+				isNoArg:   isNoArg,
+				isEnvOnly: isNoArg && structField.Tag.Get("no-ini") != "",
+				envName:   structField.Tag.Get("env"),
+			}
+		}
+	}
+	return options
+}
+
+// readJSONConfig sets each setting of cfg that the JSON config file at filename sets,
+// like applyJSONConfig.
+func readJSONConfig(cfg *Config, filename string) (unknownKeys []string, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	unknownKeys, err = applyJSONConfig(cfg, data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %w", filename, err)
+	}
+	return unknownKeys, nil
+}
+
+// applyJSONConfig sets each setting of cfg that the JSON object in data sets, keyed by its long flag name,
+// e.g. {"artist": "alicetheartist", "dbport": 3306, "lndtimeout": "1m", "hostartist": ["bob"]}.
+// Durations are strings like "30s". It leaves the other settings as they were.
+// It returns the keys of data that name no setting, sorted, rather than fail for them,
+// so one config file can serve nodes of different versions.
+func applyJSONConfig(cfg *Config, data []byte) (unknownKeys []string, err error) {
+	var settings map[string]json.RawMessage
+	err = json.Unmarshal(data, &settings)
+	if err != nil {
+		return nil, err
+	}
+	options := configOptions(cfg)
+	for name, rawValue := range settings {
+		option, isOption := options[name]
+		if !isOption {
+			unknownKeys = append(unknownKeys, name)
+			continue
+		}
+		if option.isEnvOnly {
+			return nil, option.envOnlyError(name)
+		}
+		field := option.field
+		if field.Type() == durationType {
+			var text string
+			err = json.Unmarshal(rawValue, &text)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a duration like \"30s\": %w", name, err)
+			}
+			duration, err := time.ParseDuration(text)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a duration like \"30s\": %w", name, err)
+			}
+			field.SetInt(int64(duration))
+			continue
+		}
+		// Decode into a new value so that a list replaces, rather than merges with, the list set before.
+		setting := reflect.New(field.Type())
+		err = json.Unmarshal(rawValue, setting.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		field.Set(setting.Elem())
+	}
+	sort.Strings(unknownKeys)
+	return unknownKeys, nil
+}
+
+// WriteJSON writes the settings of cfg to w as a JSON config file that applyJSONConfig can read,
+// with the value of each secret setting replaced by "***" and without the env-only settings.
+func (cfg *Config) WriteJSON(w io.Writer) error {
+	settings := make(map[string]interface{})
+	for name, option := range configOptions(cfg) {
+		if !option.isEnvOnly {
+			settings[name] = option.redactedValue()
+		}
+	}
+	dump, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", dump)
+	return err
+}
+
+// String describes the settings of cfg that are not zero, by flag name, with secrets replaced by "***",
+// e.g. "artist=alicetheartist dbpass=*** dbuser=alice".
+func (cfg *Config) String() string {
+	var settings []string
+	for _, attr := range cfg.LogValue().Group() {
+		settings = append(settings, fmt.Sprintf("%s=%v", attr.Key, attr.Value))
+	}
+	return strings.Join(settings, " ")
+}
+
+// LogValue logs the settings of cfg that are not zero, sorted by flag name, with secrets replaced by "***".
+func (cfg *Config) LogValue() slog.Value {
+	options := configOptions(cfg)
+	var names []string
+	for name, option := range options {
+		if !option.field.IsZero() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	attrs := make([]slog.Attr, 0, len(names))
+	for _, name := range names {
+		attrs = append(attrs, slog.Any(name, options[name].redactedValue()))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// envOnlyError gets the error for the env-only setting name set elsewhere than in its env variable.
+func (option configOption) envOnlyError(name string) error {
+	return fmt.Errorf("set -%s only in the environment as %s, not on the command line or in a config file",
+		name, option.envName)
+}
+
+// redactedValue gets the value of the setting to show: "***" if it is a secret that is set,
+// a string like "30s" for a duration, or else the value, dereferenced if it is a pointer.
+func (option configOption) redactedValue() interface{} {
+	field := option.field
+	switch {
+	case option.isSecret && !field.IsZero():
+		return redacted
+	case field.Type() == durationType:
+		return time.Duration(field.Int()).String()
+	case field.Kind() == reflect.Ptr && !field.IsNil():
+		return field.Elem().Interface()
+	default:
+		return field.Interface()
+	}
+}
+
+// redactError gets err with the value of each secret setting of cfg replaced by "***" in its message,
+// e.g. for an error of a database driver that quotes the data source name with its password.
+// The error still wraps err, to check with errors.Is.
+func (cfg *Config) redactError(err error) error {
+	message := err.Error()
+	for _, option := range configOptions(cfg) {
+		if option.isSecret && option.field.Kind() == reflect.String && option.field.String() != "" {
+			message = strings.ReplaceAll(message, option.field.String(), redacted)
+		}
+	}
+	if message == err.Error() {
+		return err
+	}
+	return &redactedError{message: message, err: err}
+}
+
+// redactedError is an error with secrets redacted from its message.
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (err *redactedError) Error() string { return err.message }
+func (err *redactedError) Unwrap() error { return err.err }
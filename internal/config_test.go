@@ -0,0 +1,242 @@
+package audiostrike
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestConfirmArtistID verifies that a valid artist id is kept without asking,
+// and that an invalid one is normalized only if the artist answers yes.
+func TestConfirmArtistID(t *testing.T) {
+	tests := []struct {
+		artistID   string
+		answer     string
+		expectedID string
+		expectErr  bool
+	}{
+		{"aliceinchains", "", "aliceinchains", false},
+		{"Alice in Chains", "y\n", "aliceinchains", false},
+		{"Alice in Chains", "YES\n", "aliceinchains", false},
+		{"Alice in Chains", "n\n", "", true},
+		{"Alice in Chains", "", "", true}, // stdin closed without an answer
+		{"!!!", "y\n", "", true},          // nothing left to normalize
+	}
+	for _, test := range tests {
+		reader := bufio.NewReader(strings.NewReader(test.answer))
+		artistID, err := confirmArtistID(test.artistID, reader, ioutil.Discard)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("expected error confirming %q answering %q but got %q", test.artistID, test.answer, artistID)
+			}
+			continue // to next test
+		}
+		if err != nil || artistID != test.expectedID {
+			t.Errorf("expected %q confirming %q answering %q but got %q, error: %v",
+				test.expectedID, test.artistID, test.answer, artistID, err)
+		}
+	}
+}
+
+// TestNetworkMacaroonPath verifies that the default macaroon path is for the configured network, regtest by default,
+// and that only known networks are valid.
+func TestNetworkMacaroonPath(t *testing.T) {
+	tests := []struct {
+		network     string
+		expectedDir string
+	}{
+		{"", "/.lnd/data/chain/bitcoin/regtest/"},
+		{NetworkRegtest, "/.lnd/data/chain/bitcoin/regtest/"},
+		{NetworkTestnet, "/.lnd/data/chain/bitcoin/testnet/"},
+		{NetworkMainnet, "/.lnd/data/chain/bitcoin/mainnet/"},
+	}
+	for _, test := range tests {
+		path, err := macaroonPath(&Config{Network: test.network})
+		if err != nil || !strings.HasSuffix(path, test.expectedDir+"admin.macaroon") {
+			t.Errorf("expected %q network macaroon in %s but got %s, error: %v", test.network, test.expectedDir, path, err)
+		}
+	}
+	path, err := macaroonPath(&Config{Network: NetworkMainnet, MacaroonPath: "./admin.macaroon"})
+	if err != nil || path != "./admin.macaroon" {
+		t.Errorf("expected configured macaroon path but got %s, error: %v", path, err)
+	}
+
+	for _, network := range []string{NetworkRegtest, NetworkTestnet, NetworkMainnet} {
+		if err := validateNetwork(network); err != nil {
+			t.Errorf("expected network %s valid but got error %v", network, err)
+		}
+	}
+	for _, network := range []string{"", "simnet", "Mainnet"} {
+		if err := validateNetwork(network); err == nil {
+			t.Errorf("expected network %q invalid", network)
+		}
+	}
+}
+
+// TestValidateListen verifies that the daemon binds the listen address and port apart from the host it advertises,
+// and that a host peers could not reach at the listen address is invalid.
+func TestValidateListen(t *testing.T) {
+	tests := []struct {
+		cfg             Config
+		expectedAddress string
+		isValid         bool
+	}{
+		{Config{RestHost: "localhost", RestPort: 53545}, ":53545", true},
+		{Config{RestHost: "example.onion", RestPort: 80, ListenAddress: "127.0.0.1", ListenPort: 53545}, "127.0.0.1:53545", true},
+		{Config{RestHost: "203.0.113.7", RestPort: 53545, ListenAddress: "192.168.1.7"}, "192.168.1.7:53545", true},
+		{Config{RestHost: "203.0.113.7", RestPort: 53545, ListenAddress: "::1"}, "[::1]:53545", false},
+		{Config{RestHost: "example.onion", RestPort: 80, ListenAddress: "example.onion"}, "example.onion:80", false},
+		{Config{RestHost: "", RestPort: 53545}, ":53545", false},
+		{Config{RestHost: "localhost", RestPort: 53545, ListenPort: 70000}, ":70000", false},
+	}
+	for _, test := range tests {
+		err := test.cfg.validateListen()
+		if test.isValid && err != nil {
+			t.Errorf("expected %+v valid but got error %v", test.cfg, err)
+		} else if !test.isValid && err == nil {
+			t.Errorf("expected %+v invalid", test.cfg)
+		}
+		if address := test.cfg.listenAddress(); address != test.expectedAddress {
+			t.Errorf("expected %+v to listen on %s but got %s", test.cfg, test.expectedAddress, address)
+		}
+	}
+}
+
+// TestParseConfigPrecedence verifies that flags override the JSON config file, which overrides the defaults,
+// and that unknown keys in the JSON config file are returned rather than failing.
+func TestParseConfigPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	jsonFilename := filepath.Join(dir, "austk.json")
+	err = ioutil.WriteFile(jsonFilename, []byte(`{"artist": "fileartist", "dbuser": "fileuser", "dbpass": "s3cret",
+		"lndtimeout": "1m", "hostartist": ["filehosted"], "defaultprice": 0, "futuresetting": true}`), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile %s error: %v", jsonFilename, err)
+	}
+
+	cfg, unknownKeys, err := parseConfig([]string{"--configfile", jsonFilename, "--artist", "flagartist", "--hostartist", "flaghosted"})
+	if err != nil {
+		t.Fatalf("parseConfig error: %v", err)
+	}
+	if cfg.ArtistID != "flagartist" || cfg.DbUser != "fileuser" || cfg.LndTimeout != time.Minute || cfg.DefaultPrice != 0 {
+		t.Errorf("expected flags over file over defaults but got %+v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.HostedArtistIDs, []string{"flaghosted"}) {
+		t.Errorf("expected -hostartist to replace the hosted artists of the file but got %v", cfg.HostedArtistIDs)
+	}
+	if cfg.RestPort != defaultRESTPort {
+		t.Errorf("expected default port %d but got %d", defaultRESTPort, cfg.RestPort)
+	}
+	if !reflect.DeepEqual(unknownKeys, []string{"futuresetting"}) {
+		t.Errorf("expected unknown key futuresetting but got %v", unknownKeys)
+	}
+
+	var dump bytes.Buffer
+	err = cfg.WriteJSON(&dump)
+	if err != nil {
+		t.Fatalf("WriteJSON error: %v", err)
+	}
+	if strings.Contains(dump.String(), "s3cret") || !strings.Contains(dump.String(), `"dbpass": "***"`) {
+		t.Errorf("expected dumped config to redact dbpass but got %s", dump.String())
+	}
+	dumpedCfg := getDefaultConfig()
+	_, err = applyJSONConfig(dumpedCfg, dump.Bytes())
+	if err != nil || dumpedCfg.ArtistID != "flagartist" || dumpedCfg.LndTimeout != time.Minute {
+		t.Errorf("expected dumped config to read back but got %+v, error: %v", dumpedCfg, err)
+	}
+
+	_, err = applyJSONConfig(getDefaultConfig(), []byte(`{"lndtimeout": "soon"}`))
+	if err == nil {
+		t.Errorf("expected error for malformed duration")
+	}
+}
+
+// TestParseConfigRejectsNoArgs verifies that -macaroonbase64 is refused on the command line
+// and -s3secretkey anywhere but the environment, from which both are read.
+func TestParseConfigRejectsNoArgs(t *testing.T) {
+	for _, args := range [][]string{{"--macaroonbase64", "c2VjcmV0"}, {"--artist", "alicetheartist", "--macaroonbase64=c2VjcmV0"}} {
+		_, _, err := parseConfig(args)
+		if err == nil || !strings.Contains(err.Error(), "-macaroonbase64") || strings.Contains(err.Error(), "c2VjcmV0") {
+			t.Errorf("%v: expected error naming -macaroonbase64 but got %v", args, err)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	jsonFilename := filepath.Join(dir, "austk.json")
+	err = ioutil.WriteFile(jsonFilename, []byte(`{}`), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile %s error: %v", jsonFilename, err)
+	}
+	os.Setenv("AUSTK_MACAROON_BASE64", "c2VjcmV0")
+	defer os.Unsetenv("AUSTK_MACAROON_BASE64")
+	os.Setenv("AUSTK_S3_SECRET_KEY", "s3cr3tk3y")
+	defer os.Unsetenv("AUSTK_S3_SECRET_KEY")
+	cfg, _, err := parseConfig([]string{"--configfile", jsonFilename, "--artist", "alicetheartist"})
+	if err != nil || cfg.MacaroonBase64 != "c2VjcmV0" || cfg.S3SecretKey != "s3cr3tk3y" {
+		t.Errorf("expected macaroon and s3 secret key read from the environment but got %q and %q, error: %v",
+			cfg.MacaroonBase64, cfg.S3SecretKey, err)
+	}
+
+	// The s3 secret key is read only from the environment, not from a config file either.
+	_, _, err = parseConfig([]string{"--configfile", jsonFilename, "--s3secretkey", "s3cr3tk3y"})
+	if err == nil || !strings.Contains(err.Error(), "AUSTK_S3_SECRET_KEY") {
+		t.Errorf("expected error naming AUSTK_S3_SECRET_KEY for -s3secretkey flag but got %v", err)
+	}
+	_, err = applyJSONConfig(getDefaultConfig(), []byte(`{"s3secretkey": "s3cr3tk3y"}`))
+	if err == nil || !strings.Contains(err.Error(), "AUSTK_S3_SECRET_KEY") {
+		t.Errorf("expected error naming AUSTK_S3_SECRET_KEY for s3secretkey in JSON config but got %v", err)
+	}
+	var dump bytes.Buffer
+	err = cfg.WriteJSON(&dump)
+	if err != nil || strings.Contains(dump.String(), "s3secretkey") {
+		t.Errorf("expected dumped config without s3secretkey but got %s, error: %v", dump.String(), err)
+	}
+}
+
+// TestConfigRedactsSecrets verifies that the database password is shown as *** when the config is
+// printed, logged, or dumped, and is redacted from errors that quote it.
+func TestConfigRedactsSecrets(t *testing.T) {
+	const password = "3x4mpl3mysqlp455w0rd"
+	secretCfg := &Config{ArtistID: "alicetheartist", DbUser: "alice", DbPass: password, LndTimeout: time.Minute}
+
+	var logged bytes.Buffer
+	logger, err := NewLogger(&logged, "info")
+	if err != nil {
+		t.Fatalf("NewLogger error: %v", err)
+	}
+	logger.Info("loaded config", "config", secretCfg)
+	var dumped bytes.Buffer
+	err = secretCfg.WriteJSON(&dumped)
+	if err != nil {
+		t.Fatalf("WriteJSON error: %v", err)
+	}
+	for _, output := range []string{secretCfg.String(), fmt.Sprint(secretCfg), logged.String(), dumped.String()} {
+		if strings.Contains(output, password) || !strings.Contains(output, "***") {
+			t.Errorf("expected password shown as *** but got %s", output)
+		}
+	}
+	if description := secretCfg.String(); description != "artist=alicetheartist dbpass=*** dbuser=alice lndtimeout=1m0s" {
+		t.Errorf("expected config described by its settings but got %s", description)
+	}
+
+	driverErr := errors.New("cannot connect to alice:" + password + "@tcp(localhost:3306)/austk")
+	err = secretCfg.redactError(driverErr)
+	if strings.Contains(err.Error(), password) || !errors.Is(err, driverErr) {
+		t.Errorf("expected password redacted from error wrapping the driver error but got %v", err)
+	}
+}
@@ -0,0 +1,1197 @@
+package audiostrike
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	conformanceArtistID = "conformanceartist"
+	conformancePubkey   = "02c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0c0"
+	conformanceAlbumID  = "conformancealbum"
+	conformanceTrackID  = "conformancetrack"
+	unknownID           = "unknownid"
+)
+
+// conformancePublisher publishes as the conformance artist without a lightning node.
+type conformancePublisher struct{}
+
+func (publisher *conformancePublisher) Artist() (*art.Artist, error) {
+	return &art.Artist{ArtistId: conformanceArtistID, Name: "Conformance Artist", Pubkey: conformancePubkey}, nil
+}
+
+func (publisher *conformancePublisher) PublishingArtist(artistID string) (*art.Artist, error) {
+	if artistID != conformanceArtistID {
+		return nil, ErrArtNotFound
+	}
+	return publisher.Artist()
+}
+
+func (publisher *conformancePublisher) Pubkey(ctx context.Context) (string, error) {
+	return conformancePubkey, nil
+}
+
+func (publisher *conformancePublisher) Sign(ctx context.Context, artistID string, resources *art.ArtResources) (*art.ArtistPublication, error) {
+	artist, err := publisher.PublishingArtist(artistID)
+	if err != nil {
+		return nil, err
+	}
+	marshaledResources, err := proto.Marshal(resources)
+	if err != nil {
+		return nil, err
+	}
+	return &art.ArtistPublication{
+		Artist:                 artist,
+		Signature:              "conformance signature",
+		SerializedArtResources: marshaledResources,
+	}, nil
+}
+
+func (publisher *conformancePublisher) ValidatePublication(ctx context.Context, publication *art.ArtistPublication) (*art.ArtResources, error) {
+	return read(publication)
+}
+
+func (publisher *conformancePublisher) SignMessage(ctx context.Context, message []byte) (string, error) {
+	return fmt.Sprintf("conformance signature %x", sha256.Sum256(message)), nil
+}
+
+func (publisher *conformancePublisher) VerifyMessage(ctx context.Context, message []byte, signature string) (string, error) {
+	if signature != fmt.Sprintf("conformance signature %x", sha256.Sum256(message)) {
+		return "", ErrSignatureInvalid
+	}
+	return conformancePubkey, nil
+}
+
+func (publisher *conformancePublisher) AddInvoice(ctx context.Context, memo string, sats uint64) (string, []byte, error) {
+	return memo, []byte(memo), nil
+}
+
+func (publisher *conformancePublisher) PayInvoice(ctx context.Context, paymentRequest string, maxSats uint64) ([]byte, error) {
+	return []byte(paymentRequest), nil
+}
+
+func (publisher *conformancePublisher) VerifyPayment(ctx context.Context, invoiceHash, preimage []byte) (bool, error) {
+	return bytes.Equal(invoiceHash, preimage), nil
+}
+
+func (publisher *conformancePublisher) Keysend(ctx context.Context, pubkey string, sats uint64) error {
+	return nil
+}
+
+// peerPublication publishes the peer record of a node by an artist with the node's pubkey,
+// since a node vouches only for its own peer record.
+func peerPublication(peer *art.Peer) *art.ArtistPublication {
+	artist := &art.Artist{ArtistId: peer.Pubkey, Pubkey: peer.Pubkey}
+	marshaledResources, _ := proto.Marshal(&art.ArtResources{Artists: []*art.Artist{artist}, Peers: []*art.Peer{peer}})
+	return &art.ArtistPublication{Artist: artist, Signature: "conformance signature", SerializedArtResources: marshaledResources}
+}
+
+// runArtServerConformance checks that ArtServer implementations behave the same way.
+// Each test of an ArtServer implementation calls this with newServer to make an empty server
+// (or one holding only art from earlier runs of this suite) for each part of the contract.
+func runArtServerConformance(t *testing.T, newServer func() ArtServer) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, artServer ArtServer)
+	}{
+		{"Artists", testConformanceArtists},
+		{"Albums", testConformanceAlbums},
+		{"AlbumArt", testConformanceAlbumArt},
+		{"Tracks", testConformanceTracks},
+		{"UnsafeIDs", testConformanceUnsafeIDs},
+		{"TrackPreviews", testConformanceTrackPreviews},
+		{"Playlists", testConformancePlaylists},
+		{"Payloads", testConformancePayloads},
+		{"Evictions", testConformanceEvictions},
+		{"Deletes", testConformanceDeletes},
+		{"Peers", testConformancePeers},
+		{"Publications", testConformancePublications},
+		{"SyncCursors", testConformanceSyncCursors},
+		{"PublicationSequences", testConformancePublicationSequences},
+		{"Tombstones", testConformanceTombstones},
+		{"PeerReputations", testConformancePeerReputations},
+		{"PeerBandwidths", testConformancePeerBandwidths},
+		{"TrackStats", testConformanceTrackStats},
+		{"IssuedInvoices", testConformanceIssuedInvoices},
+		{"Search", testConformanceSearch},
+		{"RecentTracks", testConformanceRecentTracks},
+		{"Pages", testConformancePages},
+	}
+	for _, test := range tests {
+		artServer := newServer()
+		t.Run(test.name, func(t *testing.T) { test.test(t, artServer) })
+	}
+}
+
+func storeConformanceArtist(t *testing.T, artServer ArtServer) {
+	artist, _ := (&conformancePublisher{}).Artist()
+	err := artServer.StoreArtist(artist)
+	if err != nil {
+		t.Fatalf("StoreArtist %v, error: %v", artist, err)
+	}
+}
+
+func testConformanceArtists(t *testing.T, artServer ArtServer) {
+	_, err := artServer.Artist(unknownID)
+	if err != ErrArtNotFound {
+		t.Errorf("expected ErrArtNotFound for unknown artist but got %v", err)
+	}
+
+	err = artServer.StoreArtist(&art.Artist{ArtistId: unknownID, Name: "No Pubkey"})
+	if err == nil {
+		t.Errorf("expected StoreArtist to reject artist without pubkey")
+	}
+	_, err = artServer.Artist(unknownID)
+	if err != ErrArtNotFound {
+		t.Errorf("expected rejected artist not to be stored but got %v", err)
+	}
+
+	storeConformanceArtist(t, artServer)
+	artists, err := artServer.Artists()
+	if err != nil || artists[conformanceArtistID] == nil {
+		t.Errorf("expected Artists to include %s but got %v, error: %v", conformanceArtistID, artists, err)
+	}
+	updatedAt := artists[conformanceArtistID].GetUpdatedAt()
+	if updatedAt == 0 {
+		t.Errorf("expected stored artist to be stamped with UpdatedAt")
+	}
+
+	// Storing the same art again keeps the stamp so peers do not sync it again.
+	storeConformanceArtist(t, artServer)
+	artist, err := artServer.Artist(conformanceArtistID)
+	if err != nil || artist.UpdatedAt != updatedAt {
+		t.Errorf("expected unchanged artist to keep UpdatedAt %d but got %v, error: %v", updatedAt, artist, err)
+	}
+
+	// Overwrite the artist.
+	err = artServer.StoreArtist(&art.Artist{ArtistId: conformanceArtistID, Name: "Renamed Artist", Pubkey: conformancePubkey})
+	if err != nil {
+		t.Fatalf("StoreArtist to overwrite, error: %v", err)
+	}
+	artist, err = artServer.Artist(conformanceArtistID)
+	if err != nil || artist.Name != "Renamed Artist" || artist.Pubkey != conformancePubkey {
+		t.Errorf("expected overwritten artist but got %v, error: %v", artist, err)
+	}
+}
+
+func testConformanceAlbums(t *testing.T, artServer ArtServer) {
+	storeConformanceArtist(t, artServer)
+	publisher := &conformancePublisher{}
+
+	err := artServer.SetAlbumPrice(&art.Album{ArtistId: conformanceArtistID, ArtistAlbumId: unknownID}, 1)
+	if err != ErrArtNotFound {
+		t.Errorf("expected ErrArtNotFound pricing unknown album but got %v", err)
+	}
+
+	album := &art.Album{ArtistId: conformanceArtistID, ArtistAlbumId: conformanceAlbumID, Title: "Conformance Album"}
+	err = artServer.StoreAlbum(album, publisher)
+	if err != nil {
+		t.Fatalf("StoreAlbum %v, error: %v", album, err)
+	}
+	err = artServer.SetAlbumPrice(album, 700)
+	if err != nil {
+		t.Fatalf("SetAlbumPrice %v, error: %v", album, err)
+	}
+
+	// Overwrite the album without a price, which keeps the price already set.
+	err = artServer.StoreAlbum(&art.Album{ArtistId: conformanceArtistID, ArtistAlbumId: conformanceAlbumID, Title: "Retitled Album"}, publisher)
+	if err != nil {
+		t.Fatalf("StoreAlbum to overwrite, error: %v", err)
+	}
+	albums, err := artServer.Albums(conformanceArtistID)
+	if err != nil {
+		t.Fatalf("Albums %s, error: %v", conformanceArtistID, err)
+	}
+	storedAlbum := albums[conformanceAlbumID]
+	if storedAlbum == nil || storedAlbum.Title != "Retitled Album" || storedAlbum.GetPrice().GetSats() != 700 {
+		t.Errorf("expected retitled album priced 700 but got %v", storedAlbum)
+	}
+
+	albums, err = artServer.Albums(unknownID)
+	if err != nil || len(albums) != 0 {
+		t.Errorf("expected no albums for unknown artist but got %v, error: %v", albums, err)
+	}
+}
+
+func testConformanceAlbumArt(t *testing.T, artServer ArtServer) {
+	storeConformanceArtist(t, artServer)
+	publisher := &conformancePublisher{}
+
+	unknownAlbum := &art.Album{ArtistId: conformanceArtistID, ArtistAlbumId: unknownID}
+	err := artServer.StoreAlbumArt(unknownAlbum, []byte("cover"), "image/jpeg")
+	if err != ErrArtNotFound {
+		t.Errorf("expected ErrArtNotFound storing cover art of unknown album but got %v", err)
+	}
+	_, _, err = artServer.AlbumArt(conformanceArtistID, unknownID)
+	if err != ErrArtNotFound {
+		t.Errorf("expected ErrArtNotFound for cover art of unknown album but got %v", err)
+	}
+
+	album := &art.Album{ArtistId: conformanceArtistID, ArtistAlbumId: conformanceAlbumID, Title: "Conformance Album"}
+	err = artServer.StoreAlbum(album, publisher)
+	if err != nil {
+		t.Fatalf("StoreAlbum %v, error: %v", album, err)
+	}
+	for _, cover := range []struct{ image, mime string }{{"first cover", "image/jpeg"}, {"overwritten cover", "image/png"}} {
+		err = artServer.StoreAlbumArt(album, []byte(cover.image), cover.mime)
+		if err != nil {
+			t.Fatalf("StoreAlbumArt %v, error: %v", album, err)
+		}
+		image, mime, err := artServer.AlbumArt(conformanceArtistID, conformanceAlbumID)
+		if err != nil || string(image) != cover.image || mime != cover.mime {
+			t.Errorf("expected %s cover art %s but got %s %s, error: %v", cover.mime, cover.image, mime, image, err)
+		}
+	}
+
+	// Overwrite the album without cover art, which keeps the cover art already stored.
+	err = artServer.StoreAlbum(&art.Album{ArtistId: conformanceArtistID, ArtistAlbumId: conformanceAlbumID, Title: "Retitled Album"}, publisher)
+	if err != nil {
+		t.Fatalf("StoreAlbum to overwrite, error: %v", err)
+	}
+	albums, err := artServer.Albums(conformanceArtistID)
+	if err != nil {
+		t.Fatalf("Albums %s, error: %v", conformanceArtistID, err)
+	}
+	imageHash := sha256.Sum256([]byte("overwritten cover"))
+	storedAlbum := albums[conformanceAlbumID]
+	if storedAlbum == nil || storedAlbum.CoverArtMime != "image/png" || !bytes.Equal(storedAlbum.CoverArtSha256, imageHash[:]) {
+		t.Errorf("expected album with png cover art hash %x but got %v", imageHash, storedAlbum)
+	}
+}
+
+func testConformanceTrackPreviews(t *testing.T, artServer ArtServer) {
+	storeConformanceArtist(t, artServer)
+	publisher := &conformancePublisher{}
+
+	unknownTrack := &art.Track{ArtistId: conformanceArtistID, ArtistTrackId: unknownID, PreviewSeconds: 30}
+	err := artServer.StoreTrackPreview(unknownTrack, []byte("preview"))
+	if err != ErrArtNotFound {
+		t.Errorf("expected ErrArtNotFound storing preview of unknown track but got %v", err)
+	}
+	track := &art.Track{ArtistId: conformanceArtistID, ArtistTrackId: "previewed", Title: "Previewed"}
+	err = artServer.StoreTrack(track, publisher)
+	if err != nil {
+		t.Fatalf("StoreTrack %v, error: %v", track, err)
+	}
+	_, err = artServer.TrackPreview(conformanceArtistID, "previewed")
+	if err != ErrArtNotFound {
+		t.Errorf("expected ErrArtNotFound for track without preview but got %v", err)
+	}
+
+	for _, preview := range []struct {
+		clip    string
+		seconds uint32
+	}{{"first preview", 30}, {"shorter preview", 10}} {
+		track.PreviewSeconds = preview.seconds
+		err = artServer.StoreTrackPreview(track, []byte(preview.clip))
+		if err != nil {
+			t.Fatalf("StoreTrackPreview %v, error: %v", track, err)
+		}
+		clip, err := artServer.TrackPreview(conformanceArtistID, "previewed")
+		if err != nil || string(clip) != preview.clip {
+			t.Errorf("expected preview %s but got %s, error: %v", preview.clip, clip, err)
+		}
+	}
+	clipHash := sha256.Sum256([]byte("shorter preview"))
+	storedTrack, err := artServer.Track(conformanceArtistID, "previewed")
+	if err != nil || storedTrack.PreviewSeconds != 10 || !bytes.Equal(storedTrack.PreviewSha256, clipHash[:]) {
+		t.Errorf("expected track with 10 second preview hash %x but got %v, error: %v", clipHash, storedTrack, err)
+	}
+	if !bytes.Equal(track.PreviewSha256, clipHash[:]) {
+		t.Errorf("expected preview hash %x recorded on stored track %v", clipHash, track)
+	}
+
+	err = artServer.DeleteTrack(track)
+	if err != nil {
+		t.Fatalf("DeleteTrack %v, error: %v", track, err)
+	}
+	_, err = artServer.TrackPreview(conformanceArtistID, "previewed")
+	if err != ErrArtNotFound {
+		t.Errorf("expected ErrArtNotFound for preview of deleted track but got %v", err)
+	}
+}
+
+func testConformancePlaylists(t *testing.T, artServer ArtServer) {
+	storeConformanceArtist(t, artServer)
+	publisher := &conformancePublisher{}
+
+	_, err := artServer.Playlist(conformanceArtistID, unknownID)
+	if err != ErrArtNotFound {
+		t.Errorf("expected ErrArtNotFound for unknown playlist but got %v", err)
+	}
+	err = artServer.StorePlaylist(&art.Playlist{ArtistId: conformanceArtistID}, publisher)
+	if err == nil {
+		t.Errorf("expected StorePlaylist to reject playlist without id")
+	}
+
+	playlist := &art.Playlist{
+		ArtistId:         conformanceArtistID,
+		ArtistPlaylistId: "conformanceplaylist",
+		Title:            "Conformance Playlist",
+		Tracks: []*art.TrackReference{
+			&art.TrackReference{ArtistId: unknownID, ArtistTrackId: "othertrack"},
+			&art.TrackReference{ArtistId: conformanceArtistID, ArtistTrackId: conformanceTrackID},
+		},
+	}
+	err = artServer.StorePlaylist(playlist, publisher)
+	if err != nil {
+		t.Fatalf("StorePlaylist %v, error: %v", playlist, err)
+	}
+	storedPlaylist, err := artServer.Playlist(conformanceArtistID, "conformanceplaylist")
+	if err != nil || len(storedPlaylist.Tracks) != 2 || storedPlaylist.Tracks[0].ArtistTrackId != "othertrack" ||
+		storedPlaylist.UpdatedAt == 0 {
+		t.Errorf("expected stamped playlist with tracks in order but got %v, error: %v", storedPlaylist, err)
+	}
+
+	// Overwrite the playlist with its tracks reordered.
+	playlist = proto.Clone(playlist).(*art.Playlist)
+	playlist.Tracks[0], playlist.Tracks[1] = playlist.Tracks[1], playlist.Tracks[0]
+	err = artServer.StorePlaylist(playlist, publisher)
+	if err != nil {
+		t.Fatalf("StorePlaylist to overwrite, error: %v", err)
+	}
+	playlists, err := artServer.Playlists(conformanceArtistID)
+	if err != nil || len(playlists) != 1 || playlists["conformanceplaylist"].GetTracks()[0].GetArtistTrackId() != conformanceTrackID {
+		t.Errorf("expected reordered playlist but got %v, error: %v", playlists, err)
+	}
+
+	playlists, err = artServer.Playlists(unknownID)
+	if err != nil || len(playlists) != 0 {
+		t.Errorf("expected no playlists for unknown artist but got %v, error: %v", playlists, err)
+	}
+}
+
+func testConformanceTracks(t *testing.T, artServer ArtServer) {
+	storeConformanceArtist(t, artServer)
+	publisher := &conformancePublisher{}
+
+	_, err := artServer.Track(conformanceArtistID, unknownID)
+	if err != ErrArtNotFound {
+		t.Errorf("expected ErrArtNotFound for unknown track but got %v", err)
+	}
+	err = artServer.SetTrackPrice(&art.Track{ArtistId: conformanceArtistID, ArtistTrackId: unknownID}, 1)
+	if err != ErrArtNotFound {
+		t.Errorf("expected ErrArtNotFound pricing unknown track but got %v", err)
+	}
+
+	// Store a track whose album is not stored yet.
+	track := &art.Track{
+		ArtistId:         conformanceArtistID,
+		ArtistAlbumId:    "albumnotyetstored",
+		ArtistTrackId:    conformanceTrackID,
+		AlbumTrackNumber: 1,
+		Title:            "Conformance Track",
+	}
+	err = artServer.StoreTrack(track, publisher)
+	if err != nil {
+		t.Fatalf("StoreTrack %v with album not yet stored, error: %v", track, err)
+	}
+	storedTrack, err := artServer.Track(conformanceArtistID, conformanceTrackID)
+	if err != nil || storedTrack.Title != track.Title || storedTrack.ArtistAlbumId != track.ArtistAlbumId {
+		t.Errorf("expected track %v but got %v, error: %v", track, storedTrack, err)
+	}
+
+	// Overwrite the track.
+	err = artServer.StoreTrack(&art.Track{ArtistId: conformanceArtistID, ArtistTrackId: conformanceTrackID, Title: "Retitled Track"}, publisher)
+	if err != nil {
+		t.Fatalf("StoreTrack to overwrite, error: %v", err)
+	}
+	err = artServer.SetTrackPrice(&art.Track{ArtistId: conformanceArtistID, ArtistTrackId: conformanceTrackID}, 1200)
+	if err != nil {
+		t.Fatalf("SetTrackPrice, error: %v", err)
+	}
+	tracks, err := artServer.Tracks(conformanceArtistID)
+	if err != nil {
+		t.Fatalf("Tracks %s, error: %v", conformanceArtistID, err)
+	}
+	storedTrack = tracks[conformanceTrackID]
+	if storedTrack == nil || storedTrack.Title != "Retitled Track" || storedTrack.GetPrice().GetSats() != 1200 {
+		t.Errorf("expected retitled track priced 1200 but got %v", storedTrack)
+	}
+}
+
+// testConformanceUnsafeIDs checks that tracks and albums whose ids or container, e.g. published by a malicious peer,
+// would name a file outside the artist's directory are refused.
+func testConformanceUnsafeIDs(t *testing.T, artServer ArtServer) {
+	storeConformanceArtist(t, artServer)
+	publisher := &conformancePublisher{}
+
+	unsafeTracks := []*art.Track{
+		{ArtistId: conformanceArtistID, ArtistTrackId: "../../etc/passwd"},
+		{ArtistId: conformanceArtistID, ArtistTrackId: "album/../../escaped"},
+		{ArtistId: conformanceArtistID, ArtistTrackId: "/absolute"},
+		{ArtistId: "..", ArtistTrackId: conformanceTrackID},
+		{ArtistId: conformanceArtistID, ArtistTrackId: conformanceTrackID, Container: "mp3/../../escaped"},
+		{ArtistId: conformanceArtistID, ArtistTrackId: conformanceTrackID, Container: "exe"},
+	}
+	for _, track := range unsafeTracks {
+		err := artServer.StoreTrack(track, publisher)
+		if !errors.Is(err, ErrArtIDInvalid) {
+			t.Errorf("expected ErrArtIDInvalid storing track %s/%s.%s but got %v",
+				track.ArtistId, track.ArtistTrackId, track.Container, err)
+		}
+	}
+	album := &art.Album{ArtistId: conformanceArtistID, ArtistAlbumId: "../escaped", Title: "Escaped"}
+	err := artServer.StoreAlbum(album, publisher)
+	if !errors.Is(err, ErrArtIDInvalid) {
+		t.Errorf("expected ErrArtIDInvalid storing album %s but got %v", album.ArtistAlbumId, err)
+	}
+	tracks, err := artServer.Tracks(conformanceArtistID)
+	if err != nil && err != ErrArtNotFound || len(tracks) != 0 {
+		t.Errorf("expected no unsafe tracks stored but got %v, error: %v", tracks, err)
+	}
+}
+
+func testConformancePayloads(t *testing.T, artServer ArtServer) {
+	storeConformanceArtist(t, artServer)
+	track := &art.Track{ArtistId: conformanceArtistID, ArtistTrackId: conformanceTrackID, Container: "mp3"}
+	err := artServer.StoreTrack(track, &conformancePublisher{})
+	if err != nil {
+		t.Fatalf("StoreTrack %v, error: %v", track, err)
+	}
+	for _, payload := range [][]byte{[]byte("first payload"), []byte("overwritten payload")} {
+		err := artServer.StoreTrackPayload(track, payload)
+		if err != nil {
+			t.Fatalf("StoreTrackPayload %v, error: %v", track, err)
+		}
+		payloadReader, err := artServer.TrackFilePartialReader(track, 0)
+		if err != nil {
+			t.Fatalf("TrackFilePartialReader %v, error: %v", track, err)
+		}
+		storedPayload, err := ioutil.ReadAll(payloadReader)
+		payloadReader.Close()
+		if err != nil || !bytes.Equal(storedPayload, payload) {
+			t.Errorf("expected payload %s but got %s, error: %v", payload, storedPayload, err)
+		}
+
+		payloadHash := sha256.Sum256(payload)
+		storedTrack, err := artServer.Track(conformanceArtistID, conformanceTrackID)
+		if err != nil || !bytes.Equal(storedTrack.GetPayloadSha256(), payloadHash[:]) {
+			t.Errorf("expected stored track with payload hash %x but got %v, error: %v", payloadHash, storedTrack, err)
+		}
+		err = artServer.VerifyStoredTrack(track)
+		if err != nil {
+			t.Errorf("VerifyStoredTrack %v, error: %v", track, err)
+		}
+	}
+
+	// Detect corruption of the stored payload, if it is stored in a file to corrupt.
+	if artServer.TrackFilePath(track) == "" {
+		return
+	}
+	err = ioutil.WriteFile(artServer.TrackFilePath(track), []byte("corrupted payload"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile to corrupt payload, error: %v", err)
+	}
+	err = artServer.VerifyStoredTrack(track)
+	if !errors.Is(err, ErrPayloadMismatch) {
+		t.Errorf("expected ErrPayloadMismatch for corrupted payload but got %v", err)
+	}
+}
+
+func testConformanceEvictions(t *testing.T, artServer ArtServer) {
+	storeConformanceArtist(t, artServer)
+	track := &art.Track{ArtistId: conformanceArtistID, ArtistTrackId: "evictedtrack", Container: "mp3"}
+	err := artServer.StoreTrack(track, &conformancePublisher{})
+	if err != nil {
+		t.Fatalf("StoreTrack %v, error: %v", track, err)
+	}
+	err = artServer.StoreTrackPayload(track, []byte("evicted payload"))
+	if err != nil {
+		t.Fatalf("StoreTrackPayload %v, error: %v", track, err)
+	}
+
+	err = artServer.EvictTrack(track)
+	if err != nil {
+		t.Fatalf("EvictTrack %v, error: %v", track, err)
+	}
+	// A payload unpinned from IPFS stays readable until the IPFS node collects garbage.
+	var isPinned bool
+	if dbServer, isDbServer := artServer.(*DbServer); isDbServer {
+		_, isPinned = dbServer.payloadStore.(*IPFSNode)
+	}
+	if !isPinned {
+		if payloadReader, err := artServer.TrackFilePartialReader(track, 0); err == nil {
+			payloadReader.Close()
+			t.Errorf("expected no payload to read after EvictTrack")
+		}
+	}
+	storedTrack, err := artServer.Track(conformanceArtistID, "evictedtrack")
+	if err != nil || storedTrack == nil {
+		t.Errorf("expected evicted track still stored but got %v, error: %v", storedTrack, err)
+	}
+	err = artServer.EvictTrack(&art.Track{ArtistId: conformanceArtistID, ArtistTrackId: unknownID})
+	if !errors.Is(err, ErrArtNotFound) {
+		t.Errorf("expected ErrArtNotFound evicting unknown track but got %v", err)
+	}
+}
+
+func testConformanceDeletes(t *testing.T, artServer ArtServer) {
+	storeConformanceArtist(t, artServer)
+	publisher := &conformancePublisher{}
+	album := &art.Album{ArtistId: conformanceArtistID, ArtistAlbumId: "deletedalbum", Title: "Deleted Album"}
+	err := artServer.StoreAlbum(album, publisher)
+	if err != nil {
+		t.Fatalf("StoreAlbum %v, error: %v", album, err)
+	}
+	err = artServer.StoreAlbumArt(album, []byte("cover"), "image/jpeg")
+	if err != nil {
+		t.Fatalf("StoreAlbumArt %v, error: %v", album, err)
+	}
+	track := &art.Track{ArtistId: conformanceArtistID, ArtistTrackId: "deletedalbum/deletedtrack",
+		ArtistAlbumId: "deletedalbum", AlbumTrackNumber: 1, Container: "mp3"}
+	err = artServer.StoreTrack(track, publisher)
+	if err != nil {
+		t.Fatalf("StoreTrack %v, error: %v", track, err)
+	}
+	err = artServer.StoreTrackPayload(track, []byte("deleted payload"))
+	if err != nil {
+		t.Fatalf("StoreTrackPayload %v, error: %v", track, err)
+	}
+
+	err = artServer.DeleteAlbum(album)
+	if !errors.Is(err, ErrAlbumNotEmpty) {
+		t.Errorf("expected ErrAlbumNotEmpty deleting album with a track but got %v", err)
+	}
+	err = artServer.DeleteTrack(track)
+	if err != nil {
+		t.Fatalf("DeleteTrack %v, error: %v", track, err)
+	}
+	_, err = artServer.Track(conformanceArtistID, track.ArtistTrackId)
+	if err != ErrArtNotFound {
+		t.Errorf("expected ErrArtNotFound for deleted track but got %v", err)
+	}
+	if payloadReader, err := artServer.TrackFilePartialReader(track, 0); err == nil {
+		payloadReader.Close()
+		t.Errorf("expected no payload for deleted track")
+	}
+	if filename := artServer.TrackFilePath(track); filename != "" {
+		if _, err := os.Stat(filename); !os.IsNotExist(err) {
+			t.Errorf("expected payload file %s of deleted track removed but got %v", filename, err)
+		}
+	}
+
+	err = artServer.DeleteAlbum(album)
+	if err != nil {
+		t.Fatalf("DeleteAlbum %v, error: %v", album, err)
+	}
+	albums, err := artServer.Albums(conformanceArtistID)
+	if err != nil || albums["deletedalbum"] != nil {
+		t.Errorf("expected deleted album gone but got %v, error: %v", albums["deletedalbum"], err)
+	}
+	_, _, err = artServer.AlbumArt(conformanceArtistID, "deletedalbum")
+	if err != ErrArtNotFound {
+		t.Errorf("expected ErrArtNotFound for cover art of deleted album but got %v", err)
+	}
+	if err = artServer.DeleteTrack(track); err != ErrArtNotFound {
+		t.Errorf("expected ErrArtNotFound deleting unknown track but got %v", err)
+	}
+	if err = artServer.DeleteAlbum(album); err != ErrArtNotFound {
+		t.Errorf("expected ErrArtNotFound deleting unknown album but got %v", err)
+	}
+}
+
+func testConformancePeers(t *testing.T, artServer ArtServer) {
+	publisher := &conformancePublisher{}
+
+	_, err := artServer.Peer(unknownID)
+	if err != ErrPeerNotFound {
+		t.Errorf("expected ErrPeerNotFound for unknown peer but got %v", err)
+	}
+
+	// Only the publisher's own peer is stored.
+	err = artServer.StorePeer(&art.Peer{Pubkey: unknownID, Host: "localhost", Port: 53545}, publisher)
+	if err != nil {
+		t.Errorf("StorePeer for other pubkey, error: %v", err)
+	}
+	_, err = artServer.Peer(unknownID)
+	if err != ErrPeerNotFound {
+		t.Errorf("expected peer for other pubkey not to be stored but got %v", err)
+	}
+
+	for _, port := range []uint32{53545, 53546} {
+		peer := &art.Peer{Pubkey: conformancePubkey, Host: "localhost", Port: port}
+		err = artServer.StorePeer(peer, publisher)
+		if err != nil {
+			t.Fatalf("StorePeer %v, error: %v", peer, err)
+		}
+		storedPeer, err := artServer.Peer(conformancePubkey)
+		if err != nil || storedPeer.Host != peer.Host || storedPeer.Port != peer.Port {
+			t.Errorf("expected peer %v but got %v, error: %v", peer, storedPeer, err)
+		}
+	}
+	// A peer is stored normalized, however its pubkey and host are written.
+	err = artServer.StorePeer(&art.Peer{Pubkey: strings.ToUpper(conformancePubkey), Host: "[2001:DB8:0::7]", Port: 53545}, publisher)
+	if err != nil {
+		t.Fatalf("StorePeer with IPv6 host, error: %v", err)
+	}
+	normalizedPeer, err := artServer.Peer(conformancePubkey)
+	if err != nil || normalizedPeer.Pubkey != conformancePubkey || normalizedPeer.Host != "2001:db8::7" {
+		t.Errorf("expected peer stored with host 2001:db8::7 but got %v, error: %v", normalizedPeer, err)
+	}
+	peers, err := artServer.Peers()
+	if err != nil || peers[conformancePubkey] == nil {
+		t.Errorf("expected Peers to include %s but got %v, error: %v", conformancePubkey, peers, err)
+	}
+
+	err = artServer.DeletePeer(unknownID)
+	if err != ErrPeerNotFound {
+		t.Errorf("expected ErrPeerNotFound deleting unknown peer but got %v", err)
+	}
+	storedPeer := peers[conformancePubkey]
+	err = artServer.StoreSyncCursor(conformancePubkey, 1234)
+	if err != nil {
+		t.Fatalf("StoreSyncCursor error: %v", err)
+	}
+	err = artServer.StorePeerReputation(&art.PeerReputation{Pubkey: conformancePubkey, FailureCount: 3})
+	if err != nil {
+		t.Fatalf("StorePeerReputation error: %v", err)
+	}
+	err = artServer.StorePeerBandwidth(&art.PeerBandwidth{Pubkey: conformancePubkey, TotalBytes: 1000})
+	if err != nil {
+		t.Fatalf("StorePeerBandwidth error: %v", err)
+	}
+	err = artServer.DeletePeer(conformancePubkey)
+	if err != nil {
+		t.Fatalf("DeletePeer %s, error: %v", conformancePubkey, err)
+	}
+	_, err = artServer.Peer(conformancePubkey)
+	if err != ErrPeerNotFound {
+		t.Errorf("expected deleted peer not found but got %v", err)
+	}
+	// The records of the deleted peer are deleted with it.
+	asOf, err := artServer.SyncCursor(conformancePubkey)
+	if err != nil || asOf != 0 {
+		t.Errorf("expected no sync cursor of deleted peer but got %d, error: %v", asOf, err)
+	}
+	reputation, err := artServer.PeerReputation(conformancePubkey)
+	if err != nil || reputation.FailureCount != 0 {
+		t.Errorf("expected no reputation of deleted peer but got %v, error: %v", reputation, err)
+	}
+	bandwidth, err := artServer.PeerBandwidth(conformancePubkey)
+	if err != nil || bandwidth.TotalBytes != 0 {
+		t.Errorf("expected no bandwidth of deleted peer but got %v, error: %v", bandwidth, err)
+	}
+	// Store the peer again for the tests that follow.
+	err = artServer.StorePeer(storedPeer, publisher)
+	if err != nil {
+		t.Fatalf("StorePeer %v, error: %v", storedPeer, err)
+	}
+}
+
+func testConformancePublications(t *testing.T, artServer ArtServer) {
+	publisher := &conformancePublisher{}
+	artist, _ := publisher.Artist()
+	resources := &art.ArtResources{
+		Artists: []*art.Artist{artist},
+		Albums: []*art.Album{
+			&art.Album{ArtistId: conformanceArtistID, ArtistAlbumId: conformanceAlbumID, Title: "Published Album"},
+		},
+		Tracks: []*art.Track{
+			&art.Track{ArtistId: conformanceArtistID, ArtistAlbumId: conformanceAlbumID, ArtistTrackId: "publishedtrack", Title: "Published Track"},
+		},
+		Peers: []*art.Peer{
+			&art.Peer{Pubkey: conformancePubkey, Host: "published.onion", Port: 53545},
+		},
+	}
+	publication, err := publisher.Sign(context.Background(), conformanceArtistID, resources)
+	if err != nil {
+		t.Fatalf("Sign %v, error: %v", resources, err)
+	}
+	err = artServer.StorePublication(publication)
+	if err != nil {
+		t.Fatalf("StorePublication, error: %v", err)
+	}
+
+	storedArtist, err := artServer.Artist(conformanceArtistID)
+	if err != nil || storedArtist.Pubkey != conformancePubkey {
+		t.Errorf("expected published artist but got %v, error: %v", storedArtist, err)
+	}
+	albums, err := artServer.Albums(conformanceArtistID)
+	if err != nil || albums[conformanceAlbumID].GetTitle() != "Published Album" {
+		t.Errorf("expected published album but got %v, error: %v", albums, err)
+	}
+	track, err := artServer.Track(conformanceArtistID, "publishedtrack")
+	if err != nil || track.Title != "Published Track" {
+		t.Errorf("expected published track but got %v, error: %v", track, err)
+	}
+	peer, err := artServer.Peer(conformancePubkey)
+	if err != nil || peer.Host != "published.onion" {
+		t.Errorf("expected published peer but got %v, error: %v", peer, err)
+	}
+
+	// Another node gossips the published peer at another host, and a peer not stored yet.
+	gossipedPeers := []*art.Peer{
+		&art.Peer{Pubkey: conformancePubkey, Host: "redirected.onion", Port: 53545},
+		&art.Peer{Pubkey: unknownID, Host: "gossiped.onion", Port: 53545},
+	}
+	gossipPublication := peerPublication(&art.Peer{Pubkey: "gossip", Host: "gossip.onion", Port: 53545})
+	gossipResources, _ := read(gossipPublication)
+	gossipResources.Peers = append(gossipResources.Peers, gossipedPeers...)
+	gossipPublication.SerializedArtResources, _ = proto.Marshal(gossipResources)
+	err = artServer.StorePublication(gossipPublication)
+	if err != nil {
+		t.Fatalf("StorePublication of gossip, error: %v", err)
+	}
+	peer, err = artServer.Peer("gossip")
+	if err != nil || peer.Host != "gossip.onion" {
+		t.Errorf("expected own peer record of gossiping node but got %v, error: %v", peer, err)
+	}
+	peer, err = artServer.Peer(conformancePubkey)
+	if err != nil || peer.Host != "published.onion" {
+		t.Errorf("expected stored peer kept despite gossip but got %v, error: %v", peer, err)
+	}
+	_, err = artServer.Peer(unknownID)
+	if err != ErrPeerNotFound {
+		t.Errorf("expected gossiped peer not stored but got error %v", err)
+	}
+}
+
+func testConformanceSyncCursors(t *testing.T, artServer ArtServer) {
+	asOf, err := artServer.SyncCursor(unknownID)
+	if err != nil || asOf != 0 {
+		t.Errorf("expected no sync cursor for unsynced peer but got %d, error: %v", asOf, err)
+	}
+
+	for _, asOf := range []uint64{1600000000, 1600000060} {
+		err = artServer.StoreSyncCursor(conformancePubkey, asOf)
+		if err != nil {
+			t.Fatalf("StoreSyncCursor %d, error: %v", asOf, err)
+		}
+		storedAsOf, err := artServer.SyncCursor(conformancePubkey)
+		if err != nil || storedAsOf != asOf {
+			t.Errorf("expected sync cursor %d but got %d, error: %v", asOf, storedAsOf, err)
+		}
+	}
+}
+
+func testConformancePublicationSequences(t *testing.T, artServer ArtServer) {
+	sequence, err := artServer.PublicationSequence(unknownID)
+	if err != nil || sequence != 0 {
+		t.Errorf("expected no sequence for an artist never validated but got %d, error: %v", sequence, err)
+	}
+
+	for _, sequence := range []uint64{1600000000000000000, 1600000000000000001} {
+		err = artServer.StorePublicationSequence(conformancePubkey, sequence)
+		if err != nil {
+			t.Fatalf("StorePublicationSequence %d, error: %v", sequence, err)
+		}
+		storedSequence, err := artServer.PublicationSequence(conformancePubkey)
+		if err != nil || storedSequence != sequence {
+			t.Errorf("expected publication sequence %d but got %d, error: %v", sequence, storedSequence, err)
+		}
+	}
+}
+
+func testConformanceTombstones(t *testing.T, artServer ArtServer) {
+	tombstones := []*art.Tombstone{
+		{ArtistId: conformanceArtistID, ArtistAlbumId: "withdrawn", DeletedAt: 1600000000},
+		{ArtistId: conformanceArtistID, ArtistTrackId: "withdrawn", DeletedAt: 1600000001},
+		{ArtistId: conformanceArtistID, ArtistTrackId: "withdrawn", DeletedAt: 1600000002},
+	}
+	for _, tombstone := range tombstones {
+		err := artServer.StoreTombstone(tombstone)
+		if err != nil {
+			t.Fatalf("StoreTombstone %v, error: %v", tombstone, err)
+		}
+	}
+	storedTombstones, err := artServer.Tombstones()
+	if err != nil {
+		t.Fatalf("Tombstones error: %v", err)
+	}
+	var artistTombstones []*art.Tombstone
+	for _, tombstone := range storedTombstones {
+		if tombstone.ArtistId == conformanceArtistID {
+			artistTombstones = append(artistTombstones, tombstone)
+		}
+	}
+	// The later tombstone of the track replaces the earlier, and the track sorts before the album with the same id.
+	if len(artistTombstones) != 2 ||
+		!proto.Equal(artistTombstones[0], tombstones[2]) || !proto.Equal(artistTombstones[1], tombstones[0]) {
+		t.Errorf("expected tombstones of the track then the album but got %v", artistTombstones)
+	}
+
+	err = artServer.DeleteExpiredTombstones(1600000001)
+	if err != nil {
+		t.Fatalf("DeleteExpiredTombstones error: %v", err)
+	}
+	storedTombstones, err = artServer.Tombstones()
+	if err != nil {
+		t.Fatalf("Tombstones error: %v", err)
+	}
+	artistTombstones = nil
+	for _, tombstone := range storedTombstones {
+		if tombstone.ArtistId == conformanceArtistID {
+			artistTombstones = append(artistTombstones, tombstone)
+		}
+	}
+	if len(artistTombstones) != 1 || !proto.Equal(artistTombstones[0], tombstones[2]) {
+		t.Errorf("expected only the tombstone of the track deleted later but got %v", artistTombstones)
+	}
+}
+
+func testConformancePeerReputations(t *testing.T, artServer ArtServer) {
+	reputation, err := artServer.PeerReputation(unknownID)
+	if err != nil || reputation.Pubkey != unknownID || reputation.FailureCount != 0 {
+		t.Errorf("expected no failures for unknown peer but got %v, error: %v", reputation, err)
+	}
+
+	for _, failureCount := range []uint32{1, 0} {
+		reputation = &art.PeerReputation{Pubkey: conformancePubkey, FailureCount: failureCount, LastFailureAt: 1600000000,
+			LastSeenAt: 1600000000, LastReachableAt: 1500000000}
+		err = artServer.StorePeerReputation(reputation)
+		if err != nil {
+			t.Fatalf("StorePeerReputation %v, error: %v", reputation, err)
+		}
+		storedReputation, err := artServer.PeerReputation(conformancePubkey)
+		if err != nil || !proto.Equal(storedReputation, reputation) {
+			t.Errorf("expected peer reputation %v but got %v, error: %v", reputation, storedReputation, err)
+		}
+	}
+}
+
+func testConformancePeerBandwidths(t *testing.T, artServer ArtServer) {
+	bandwidth, err := artServer.PeerBandwidth(unknownID)
+	if err != nil || bandwidth.Pubkey != unknownID || bandwidth.TotalBytes != 0 {
+		t.Errorf("expected no bytes served to unknown peer but got %v, error: %v", bandwidth, err)
+	}
+
+	for _, totalBytes := range []uint64{1000, 3000} {
+		bandwidth = &art.PeerBandwidth{Pubkey: conformancePubkey, TotalBytes: totalBytes,
+			Days: []*art.DailyBandwidth{{Day: 18500, Bytes: 1000}, {Day: 18501, Bytes: totalBytes - 1000}}}
+		err = artServer.StorePeerBandwidth(bandwidth)
+		if err != nil {
+			t.Fatalf("StorePeerBandwidth %v, error: %v", bandwidth, err)
+		}
+		storedBandwidth, err := artServer.PeerBandwidth(conformancePubkey)
+		if err != nil || !proto.Equal(storedBandwidth, bandwidth) {
+			t.Errorf("expected peer bandwidth %v but got %v, error: %v", bandwidth, storedBandwidth, err)
+		}
+	}
+}
+
+func testConformanceTrackStats(t *testing.T, artServer ArtServer) {
+	stats, err := artServer.TrackStats(conformanceArtistID, unknownID)
+	if err != nil || stats.ArtistTrackId != unknownID || stats.Plays != 0 || stats.Purchases != 0 {
+		t.Errorf("expected no plays or purchases of unknown track but got %v, error: %v", stats, err)
+	}
+
+	// Played more than anything else counted, so these are the top tracks even on a server reused from earlier runs.
+	const most = 1000000000
+	for _, stats := range []*art.TrackStats{
+		{ArtistId: conformanceArtistID, ArtistTrackId: "statsc", Plays: most, Purchases: 1},
+		{ArtistId: conformanceArtistID, ArtistTrackId: "statsb", Plays: most + 1, Purchases: 5},
+		{ArtistId: conformanceArtistID, ArtistTrackId: "statsd", Plays: most, Purchases: 2},
+		{ArtistId: conformanceArtistID, ArtistTrackId: "statsa", Plays: most + 1, Purchases: 5},
+	} {
+		err = artServer.StoreTrackStats(stats)
+		if err != nil {
+			t.Fatalf("StoreTrackStats %v, error: %v", stats, err)
+		}
+	}
+	stats = &art.TrackStats{ArtistId: conformanceArtistID, ArtistTrackId: "statsc", Plays: most, Purchases: 3}
+	err = artServer.StoreTrackStats(stats)
+	if err != nil {
+		t.Fatalf("StoreTrackStats %v, error: %v", stats, err)
+	}
+	storedStats, err := artServer.TrackStats(conformanceArtistID, "statsc")
+	if err != nil || !proto.Equal(storedStats, stats) {
+		t.Errorf("expected track stats %v but got %v, error: %v", stats, storedStats, err)
+	}
+
+	topStats, err := artServer.TopTrackStats(3)
+	var trackIDs []string
+	for _, stats := range topStats {
+		trackIDs = append(trackIDs, stats.ArtistTrackId)
+	}
+	if err != nil || strings.Join(trackIDs, ",") != "statsa,statsb,statsc" {
+		t.Errorf("expected top tracks statsa,statsb,statsc but got %v, error: %v", trackIDs, err)
+	}
+	topStats, err = artServer.TopTrackStats(-1)
+	if err != nil || len(topStats) < 4 || topStats[3].ArtistTrackId != "statsd" {
+		t.Errorf("expected all track stats to end the top 4 with statsd but got %v, error: %v", topStats, err)
+	}
+
+	// Added stats accumulate, starting from none for a track never counted, and keep the later LastPlayedAt.
+	addedID := fmt.Sprintf("added%d", time.Now().UnixNano())
+	added := &art.TrackStats{ArtistId: conformanceArtistID, ArtistTrackId: addedID, Plays: 2, LastPlayedAt: 200}
+	err = artServer.AddTrackStats(added)
+	if err != nil {
+		t.Fatalf("AddTrackStats %v, error: %v", added, err)
+	}
+	added.Plays = 1000
+	err = artServer.AddTrackStats(&art.TrackStats{ArtistId: conformanceArtistID, ArtistTrackId: addedID, Plays: 1, Purchases: 1, LastPlayedAt: 100})
+	if err != nil {
+		t.Fatalf("AddTrackStats error: %v", err)
+	}
+	expectedStats := &art.TrackStats{ArtistId: conformanceArtistID, ArtistTrackId: addedID, Plays: 3, Purchases: 1, LastPlayedAt: 200}
+	storedStats, err = artServer.TrackStats(conformanceArtistID, addedID)
+	if err != nil || !proto.Equal(storedStats, expectedStats) {
+		t.Errorf("expected added track stats %v but got %v, error: %v", expectedStats, storedStats, err)
+	}
+
+	err = artServer.DeleteTrackStats(conformanceArtistID, addedID)
+	if err != nil {
+		t.Fatalf("DeleteTrackStats error: %v", err)
+	}
+	storedStats, err = artServer.TrackStats(conformanceArtistID, addedID)
+	if err != nil || storedStats.Plays != 0 || storedStats.Purchases != 0 {
+		t.Errorf("expected no plays or purchases after deleting track stats but got %v, error: %v", storedStats, err)
+	}
+	err = artServer.DeleteTrackStats(conformanceArtistID, addedID)
+	if err != nil {
+		t.Errorf("expected deleting track stats again to succeed but got %v", err)
+	}
+}
+
+func testConformanceIssuedInvoices(t *testing.T, artServer ArtServer) {
+	_, err := artServer.IssuedInvoice([]byte(unknownID))
+	if err != ErrArtNotFound {
+		t.Errorf("expected ErrArtNotFound for unknown invoice but got %v", err)
+	}
+
+	tracks := []*art.TrackReference{{ArtistId: conformanceArtistID, ArtistTrackId: conformanceTrackID}}
+	unpaid := &art.IssuedInvoice{InvoiceHash: []byte("unpaid"), Tracks: tracks, ExpiresAt: 100}
+	settled := &art.IssuedInvoice{InvoiceHash: []byte("settled"), Tracks: tracks, ExpiresAt: 100, SettledAt: 90}
+	pending := &art.IssuedInvoice{InvoiceHash: []byte("pending"), Tracks: tracks, ExpiresAt: 300}
+	for _, invoice := range []*art.IssuedInvoice{unpaid, settled, pending} {
+		err = artServer.StoreIssuedInvoice(invoice)
+		if err != nil {
+			t.Fatalf("StoreIssuedInvoice %s, error: %v", invoice.InvoiceHash, err)
+		}
+	}
+	storedInvoice, err := artServer.IssuedInvoice([]byte("settled"))
+	if err != nil || !proto.Equal(storedInvoice, settled) {
+		t.Errorf("expected issued invoice %v but got %v, error: %v", settled, storedInvoice, err)
+	}
+
+	err = artServer.DeleteExpiredInvoices(200)
+	if err != nil {
+		t.Fatalf("DeleteExpiredInvoices error: %v", err)
+	}
+	_, err = artServer.IssuedInvoice([]byte("unpaid"))
+	if err != ErrArtNotFound {
+		t.Errorf("expected invoice expired unpaid to be deleted but got error %v", err)
+	}
+	for _, invoice := range []*art.IssuedInvoice{settled, pending} {
+		_, err = artServer.IssuedInvoice(invoice.InvoiceHash)
+		if err != nil {
+			t.Errorf("expected invoice %s settled or not expired to be kept but got error %v", invoice.InvoiceHash, err)
+		}
+	}
+}
+
+func testConformanceSearch(t *testing.T, artServer ArtServer) {
+	storeConformanceArtist(t, artServer)
+	publisher := &conformancePublisher{}
+
+	artists, err := artServer.SearchArtists("FORMANCE art")
+	if err != nil || len(artists) == 0 || artists[0].ArtistId != conformanceArtistID {
+		t.Errorf("expected SearchArtists to match %s ignoring case but got %v, error: %v", conformanceArtistID, artists, err)
+	}
+
+	for _, track := range []*art.Track{
+		&art.Track{ArtistId: conformanceArtistID, ArtistTrackId: "searchd", Title: "D 100 Searchable"},
+		&art.Track{ArtistId: conformanceArtistID, ArtistTrackId: "searchb", Title: "b searchable song"},
+		&art.Track{ArtistId: conformanceArtistID, ArtistTrackId: "searchc", Title: "C 100% Searchable"},
+		&art.Track{ArtistId: conformanceArtistID, ArtistTrackId: "searcha", Title: "A Searchable Tune"},
+		&art.Track{ArtistId: conformanceArtistID, ArtistTrackId: "searche", Title: "E Searchable",
+			Genres: []string{"Alternative Metal", "Grunge"}, Year: 1992},
+		&art.Track{ArtistId: conformanceArtistID, ArtistTrackId: "searchf", Title: "F Searchable",
+			Genres: []string{"grunge rock"}, Year: 1995},
+		&art.Track{ArtistId: conformanceArtistID, ArtistTrackId: "searchg", Title: "G Searchable",
+			Genres: []string{"Grunge"}},
+	} {
+		err = artServer.StoreTrack(track, publisher)
+		if err != nil {
+			t.Fatalf("StoreTrack %v, error: %v", track, err)
+		}
+	}
+
+	tests := []struct {
+		query    string
+		filter   TrackFilter
+		trackIDs []string
+	}{
+		{"SEARCHABLE", TrackFilter{}, []string{"searcha", "searchb", "searchc", "searchd", "searche", "searchf", "searchg"}},
+		{"0% s", TrackFilter{}, []string{"searchc"}},
+		{"unsearchable", TrackFilter{}, nil},
+		{"searchable", TrackFilter{Genre: "GRUNGE"}, []string{"searche", "searchg"}},
+		{"searchable", TrackFilter{Genre: "alternative metal", MaxYear: 1992}, []string{"searche"}},
+		{"searchable", TrackFilter{MinYear: 1990, MaxYear: 1999}, []string{"searche", "searchf"}},
+		{"searchable", TrackFilter{MinYear: 1993}, []string{"searchf"}},
+		{"searchable", TrackFilter{Genre: "grunge", MinYear: 1993}, nil},
+	}
+	for _, test := range tests {
+		tracks, err := artServer.SearchTracks(test.query, test.filter)
+		if err != nil {
+			t.Errorf("SearchTracks %s, error: %v", test.query, err)
+			continue
+		}
+		var trackIDs []string
+		for _, track := range tracks {
+			trackIDs = append(trackIDs, track.ArtistTrackId)
+		}
+		if strings.Join(trackIDs, ",") != strings.Join(test.trackIDs, ",") {
+			t.Errorf("expected SearchTracks %s %+v to get %v but got %v", test.query, test.filter, test.trackIDs, trackIDs)
+		}
+	}
+}
+
+func testConformanceRecentTracks(t *testing.T, artServer ArtServer) {
+	storeConformanceArtist(t, artServer)
+	publisher := &conformancePublisher{}
+
+	// Created in the last seconds, so these are the newest tracks even on a server reused from earlier runs.
+	recent := nowUnix() - 2
+	for _, track := range []*art.Track{
+		&art.Track{ArtistId: conformanceArtistID, ArtistTrackId: "recentc", Title: "Old", CreatedAt: recent},
+		&art.Track{ArtistId: conformanceArtistID, ArtistTrackId: "recentb", Title: "Tied", CreatedAt: recent + 2},
+		&art.Track{ArtistId: conformanceArtistID, ArtistTrackId: "recentd", Title: "Middle", CreatedAt: recent + 1},
+		&art.Track{ArtistId: conformanceArtistID, ArtistTrackId: "recenta", Title: "Tied", CreatedAt: recent + 2},
+	} {
+		err := artServer.StoreTrack(track, publisher)
+		if err != nil {
+			t.Fatalf("StoreTrack %v, error: %v", track, err)
+		}
+	}
+	// Updating a track keeps the time it was created.
+	err := artServer.StoreTrack(&art.Track{ArtistId: conformanceArtistID, ArtistTrackId: "recentc", Title: "Retitled"}, publisher)
+	if err != nil {
+		t.Fatalf("StoreTrack recentc, error: %v", err)
+	}
+
+	tests := []struct {
+		limit    int
+		trackIDs []string
+	}{
+		{4, []string{"recenta", "recentb", "recentd", "recentc"}},
+		{2, []string{"recenta", "recentb"}},
+		{0, nil},
+	}
+	for _, test := range tests {
+		tracks, err := artServer.RecentTracks(test.limit)
+		if err != nil {
+			t.Errorf("RecentTracks %d, error: %v", test.limit, err)
+			continue
+		}
+		var trackIDs []string
+		for _, track := range tracks {
+			trackIDs = append(trackIDs, track.ArtistTrackId)
+		}
+		if strings.Join(trackIDs, ",") != strings.Join(test.trackIDs, ",") {
+			t.Errorf("expected RecentTracks %d to get %v but got %v", test.limit, test.trackIDs, trackIDs)
+		}
+	}
+	tracks, err := artServer.RecentTracks(-1)
+	if err != nil || len(tracks) < 4 || tracks[3].ArtistTrackId != "recentc" || tracks[3].Title != "Retitled" {
+		t.Errorf("expected all RecentTracks to end the newest with retitled recentc but got %v, error: %v", tracks, err)
+	}
+
+	// A track claiming to be created in the future, e.g. by a peer's clock, is created now instead.
+	futureTrack := &art.Track{ArtistId: conformanceArtistID, ArtistTrackId: "recentfuture", Title: "Future",
+		CreatedAt: 4000000000}
+	err = artServer.StoreTrack(futureTrack, publisher)
+	if err != nil {
+		t.Fatalf("StoreTrack %v, error: %v", futureTrack, err)
+	}
+	storedTrack, err := artServer.Track(conformanceArtistID, "recentfuture")
+	if err != nil || storedTrack.CreatedAt > nowUnix() {
+		t.Errorf("expected track created in the future stored as created now but got %v, error: %v", storedTrack, err)
+	}
+}
+
+func testConformancePages(t *testing.T, artServer ArtServer) {
+	publisher := &conformancePublisher{}
+	artist, _ := publisher.Artist()
+	resources := &art.ArtResources{Artists: []*art.Artist{artist}}
+	pageIDs := []string{"page3", "page1", "page2"}
+	for _, id := range pageIDs {
+		resources.Albums = append(resources.Albums, &art.Album{ArtistId: conformanceArtistID, ArtistAlbumId: id})
+		resources.Tracks = append(resources.Tracks, &art.Track{ArtistId: conformanceArtistID, ArtistTrackId: id})
+	}
+	publication, err := publisher.Sign(context.Background(), conformanceArtistID, resources)
+	if err != nil {
+		t.Fatalf("Sign %v, error: %v", resources, err)
+	}
+	err = artServer.StorePublication(publication)
+	if err != nil {
+		t.Fatalf("StorePublication, error: %v", err)
+	}
+	for _, id := range pageIDs {
+		err = artServer.StorePublication(peerPublication(&art.Peer{Pubkey: id, Host: id + ".onion", Port: 53545}))
+		if err != nil {
+			t.Fatalf("StorePublication of peer %s, error: %v", id, err)
+		}
+	}
+
+	// Page through each kind of record two at a time, expecting each id once in order.
+	pagers := []struct {
+		name     string
+		pageKeys func(offset int, limit int) ([]string, error)
+	}{
+		{"AlbumsPage", func(offset int, limit int) ([]string, error) {
+			albums, err := artServer.AlbumsPage(conformanceArtistID, offset, limit)
+			var keys []string
+			for _, album := range albums {
+				keys = append(keys, album.ArtistAlbumId)
+			}
+			return keys, err
+		}},
+		{"TracksPage", func(offset int, limit int) ([]string, error) {
+			tracks, err := artServer.TracksPage(conformanceArtistID, offset, limit)
+			var keys []string
+			for _, track := range tracks {
+				keys = append(keys, track.ArtistTrackId)
+			}
+			return keys, err
+		}},
+		{"PeersPage", func(offset int, limit int) ([]string, error) {
+			peers, err := artServer.PeersPage(offset, limit)
+			var keys []string
+			for _, peer := range peers {
+				keys = append(keys, peer.Pubkey)
+			}
+			return keys, err
+		}},
+	}
+	for _, pager := range pagers {
+		var pagedKeys []string
+		for offset := 0; ; offset += 2 {
+			keys, err := pager.pageKeys(offset, 2)
+			if err != nil {
+				t.Fatalf("%s at %d, error: %v", pager.name, offset, err)
+			}
+			if len(keys) > 2 {
+				t.Errorf("expected %s to get at most 2 records but got %v", pager.name, keys)
+			}
+			pagedKeys = append(pagedKeys, keys...)
+			if len(keys) < 2 {
+				break
+			}
+		}
+		var pagedIDs []string
+		for i, key := range pagedKeys {
+			if i > 0 && key <= pagedKeys[i-1] {
+				t.Errorf("expected %s to order records but got %v", pager.name, pagedKeys)
+			}
+			if strings.HasPrefix(key, "page") {
+				pagedIDs = append(pagedIDs, key)
+			}
+		}
+		if strings.Join(pagedIDs, ",") != "page1,page2,page3" {
+			t.Errorf("expected %s to get page1,page2,page3 but got %v", pager.name, pagedIDs)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package audiostrike
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// pictureTypeFrontCover is the picture type of a front cover in ID3 APIC frames and flac picture blocks.
+	pictureTypeFrontCover = 3
+
+	// flacPictureBlockType identifies the metadata block holding a flac picture.
+	flacPictureBlockType = 6
+
+	// vorbisPictureField is the vorbis comment field holding a base64-encoded flac picture block, e.g. in ogg files.
+	vorbisPictureField = "METADATA_BLOCK_PICTURE"
+
+	// id3PictureLinkMime is the mime type of an APIC frame whose data is a URL to the picture, not the picture itself.
+	id3PictureLinkMime = "-->"
+
+	// maxAlbumArtBytes limits the cover art read from a peer.
+	maxAlbumArtBytes = 16 << 20
+)
+
+// albumArtMimes are the mime types of cover art served and synced: images that browsers display without running them.
+var albumArtMimes = map[string]bool{"image/jpeg": true, "image/png": true, "image/gif": true, "image/webp": true}
+
+// isAlbumArtMime tells whether mime is the type of an image served as cover art.
+func isAlbumArtMime(mime string) bool {
+	return albumArtMimes[mime]
+}
+
+// Picture is an image embedded in the tags of an audio file, such as the cover art of its album.
+type Picture struct {
+	// Type is the ID3 picture type, e.g. pictureTypeFrontCover.
+	Type byte
+	Mime string
+	Data []byte
+}
+
+// coverPicture gets the picture to use as album cover art: the first front cover or else the first picture.
+// It returns nil if there are no pictures.
+func coverPicture(pictures []Picture) *Picture {
+	for i := range pictures {
+		if pictures[i].Type == pictureTypeFrontCover {
+			return &pictures[i]
+		}
+	}
+	if len(pictures) > 0 {
+		return &pictures[0]
+	}
+	return nil
+}
+
+// pictureMime gets the mime type of a picture tagged with mime, e.g. "image/png",
+// detecting it from data if the tag does not name one.
+func pictureMime(mime string, data []byte) string {
+	if strings.Contains(mime, "/") {
+		return strings.ToLower(mime)
+	}
+	return http.DetectContentType(data)
+}
+
+// parseFlacPicture parses the data of a flac picture metadata block.
+func parseFlacPicture(block []byte) (Picture, error) {
+	reader := bytes.NewReader(block)
+	var pictureType uint32
+	err := binary.Read(reader, binary.BigEndian, &pictureType)
+	if err != nil {
+		return Picture{}, err
+	}
+	mime, err := readFlacPictureField(reader)
+	if err != nil {
+		return Picture{}, err
+	}
+	_, err = readFlacPictureField(reader) // description
+	if err != nil {
+		return Picture{}, err
+	}
+	// Skip the width, height, color depth, and number of colors.
+	_, err = reader.Seek(16, io.SeekCurrent)
+	if err != nil {
+		return Picture{}, err
+	}
+	data, err := readFlacPictureField(reader)
+	if err != nil {
+		return Picture{}, err
+	}
+	return Picture{
+		Type: byte(pictureType),
+		Mime: pictureMime(string(mime), data),
+		Data: data,
+	}, nil
+}
+
+// readFlacPictureField reads a field of a flac picture block prefixed by its 32-bit length.
+func readFlacPictureField(reader *bytes.Reader) ([]byte, error) {
+	var length uint32
+	err := binary.Read(reader, binary.BigEndian, &length)
+	if err != nil {
+		return nil, err
+	}
+	if int64(length) > int64(reader.Len()) {
+		return nil, fmt.Errorf("flac picture field length %d exceeds block", length)
+	}
+	field := make([]byte, length)
+	_, err = io.ReadFull(reader, field)
+	return field, err
+}
+
+// vorbisCommentPictures parses the base64-encoded flac picture blocks of METADATA_BLOCK_PICTURE comments.
+func vorbisCommentPictures(values []string) ([]Picture, error) {
+	var pictures []Picture
+	for _, value := range values {
+		block, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s comment: %w", vorbisPictureField, err)
+		}
+		picture, err := parseFlacPicture(block)
+		if err != nil {
+			return nil, err
+		}
+		pictures = append(pictures, picture)
+	}
+	return pictures, nil
+}
+
+// parseID3Picture parses the body of an ID3v2 APIC frame.
+func parseID3Picture(frame []byte) (Picture, error) {
+	if len(frame) < 1 {
+		return Picture{}, fmt.Errorf("empty APIC frame")
+	}
+	encoding := frame[0]
+	mimeEnd := bytes.IndexByte(frame[1:], 0)
+	if mimeEnd < 0 {
+		return Picture{}, fmt.Errorf("APIC frame lacks mime type terminator")
+	}
+	mime := string(frame[1 : 1+mimeEnd])
+	if mime == id3PictureLinkMime {
+		return Picture{}, fmt.Errorf("APIC frame links to its picture instead of embedding it")
+	}
+	rest := frame[1+mimeEnd+1:]
+	if len(rest) < 1 {
+		return Picture{}, fmt.Errorf("APIC frame lacks picture type")
+	}
+	pictureType := rest[0]
+
+	// The description ends with a null character, which takes two bytes in the UTF-16 encodings.
+	description := rest[1:]
+	descriptionEnd := -1
+	switch encoding {
+	case 1, 2: // UTF-16 with or without byte order mark
+		for i := 0; i+1 < len(description); i += 2 {
+			if description[i] == 0 && description[i+1] == 0 {
+				descriptionEnd = i + 2
+				break
+			}
+		}
+	default: // ISO-8859-1 or UTF-8
+		if i := bytes.IndexByte(description, 0); i >= 0 {
+			descriptionEnd = i + 1
+		}
+	}
+	if descriptionEnd < 0 {
+		return Picture{}, fmt.Errorf("APIC frame lacks description terminator")
+	}
+	data := description[descriptionEnd:]
+	return Picture{
+		Type: pictureType,
+		Mime: pictureMime(mime, data),
+		Data: data,
+	}, nil
+}
@@ -0,0 +1,116 @@
+package audiostrike
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+)
+
+// pngMagic begins the bytes of a png image, enough for http.DetectContentType to recognize it.
+const pngMagic = "\x89PNG\r\n\x1a\n"
+
+// flacPicture builds a flac picture block of pictureType holding data of the mime type.
+func flacPicture(pictureType uint32, mime string, data []byte) []byte {
+	var block bytes.Buffer
+	binary.Write(&block, binary.BigEndian, pictureType)
+	binary.Write(&block, binary.BigEndian, uint32(len(mime)))
+	block.WriteString(mime)
+	binary.Write(&block, binary.BigEndian, uint32(0)) // empty description
+	block.Write(make([]byte, 16))                     // width, height, color depth, and number of colors
+	binary.Write(&block, binary.BigEndian, uint32(len(data)))
+	block.Write(data)
+	return block.Bytes()
+}
+
+// flacWithPictures builds the metadata header of a flac file with the given vorbis comments
+// followed by the given picture blocks.
+func flacWithPictures(comments []string, pictureBlocks ...[]byte) []byte {
+	flac := flacWithComments(comments...)
+	// Clear the last-block flag of the comment block, after the marker and the STREAMINFO block.
+	flac[len(flacMagic)+4+34] &^= 0x80
+	for i, block := range pictureBlocks {
+		blockType := byte(flacPictureBlockType)
+		if i == len(pictureBlocks)-1 {
+			blockType |= 0x80
+		}
+		flac = append(flac, blockType, byte(len(block)>>16), byte(len(block)>>8), byte(len(block)))
+		flac = append(flac, block...)
+	}
+	return flac
+}
+
+// TestReadFlacPictures verifies that a front cover is preferred over other pictures in a flac file.
+func TestReadFlacPictures(t *testing.T) {
+	flac := flacWithPictures([]string{"TITLE=Would?"},
+		flacPicture(4, "image/jpeg", []byte("back cover")),
+		flacPicture(pictureTypeFrontCover, "image/PNG", []byte(pngMagic+"front cover")))
+	tags, pictures, err := readFlacTags(bytes.NewReader(flac))
+	if err != nil {
+		t.Fatalf("readFlacTags error: %v", err)
+	}
+	if tags["Title"] != "Would?" {
+		t.Errorf("expected title Would? but got %v", tags)
+	}
+	cover := coverPicture(pictures)
+	if len(pictures) != 2 || cover == nil || cover.Mime != "image/png" || string(cover.Data) != pngMagic+"front cover" {
+		t.Errorf("expected png front cover of 2 pictures but got %v from %v", cover, pictures)
+	}
+
+	_, pictures, err = readFlacTags(bytes.NewReader(flacWithComments("TITLE=Would?")))
+	if err != nil || coverPicture(pictures) != nil {
+		t.Errorf("expected no cover picture but got %v, error: %v", pictures, err)
+	}
+}
+
+// TestReadOggPictures verifies that pictures are read from METADATA_BLOCK_PICTURE comments of an ogg stream.
+func TestReadOggPictures(t *testing.T) {
+	pictureComment := vorbisPictureField + "=" +
+		base64.StdEncoding.EncodeToString(flacPicture(pictureTypeFrontCover, "image/jpeg", []byte("front cover")))
+	ogg := oggWithComments(CodecVorbis, "TITLE=Would?", pictureComment)
+	_, _, pictures, err := readOggTags(bytes.NewReader(ogg))
+	if err != nil {
+		t.Fatalf("readOggTags error: %v", err)
+	}
+	cover := coverPicture(pictures)
+	if cover == nil || cover.Mime != "image/jpeg" || string(cover.Data) != "front cover" {
+		t.Errorf("expected jpeg front cover but got %v", pictures)
+	}
+
+	ogg = oggWithComments(CodecVorbis, "TITLE=Would?", vorbisPictureField+"=not base64!")
+	_, _, _, err = readOggTags(bytes.NewReader(ogg))
+	if err == nil {
+		t.Errorf("expected error reading malformed picture comment")
+	}
+}
+
+// TestParseID3Picture verifies that the picture is parsed from APIC frames with each text encoding.
+func TestParseID3Picture(t *testing.T) {
+	tests := []struct {
+		name         string
+		frame        string
+		expectedType byte
+		expectedMime string
+		expectedData string
+	}{
+		{"latin-1 description", "\x00image/jpeg\x00\x03cover\x00jpeg data", pictureTypeFrontCover, "image/jpeg", "jpeg data"},
+		{"utf-16 description", "\x01image/jpeg\x00\x04\xff\xfec\x00\x00\x00jpeg data", 4, "image/jpeg", "jpeg data"},
+		{"empty utf-8 description", "\x03image/png\x00\x03\x00png data", pictureTypeFrontCover, "image/png", "png data"},
+		{"mime type detected", "\x00PNG\x00\x03\x00" + pngMagic, pictureTypeFrontCover, "image/png", pngMagic},
+	}
+	for _, test := range tests {
+		picture, err := parseID3Picture([]byte(test.frame))
+		if err != nil {
+			t.Errorf("%s: parseID3Picture error: %v", test.name, err)
+		} else if picture.Type != test.expectedType || picture.Mime != test.expectedMime || string(picture.Data) != test.expectedData {
+			t.Errorf("%s: expected %s picture of type %d but got %v", test.name, test.expectedMime, test.expectedType, picture)
+		}
+	}
+
+	for _, frame := range []string{"", "\x00image/jpeg", "\x00-->\x00\x03\x00http://example.com/cover.jpg", "\x01image/jpeg\x00\x03c\x00"} {
+		_, err := parseID3Picture([]byte(frame))
+		if err == nil {
+			t.Errorf("expected error parsing APIC frame %q", frame)
+		}
+	}
+}
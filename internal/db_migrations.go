@@ -0,0 +1,374 @@
+package audiostrike
+
+import (
+	"database/sql"
+	"fmt"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+)
+
+// dbMigration evolves the schema of a database from the previous version to the next.
+// A migration may be run again after failing partway, so it skips any change already made.
+type dbMigration func(db *sql.DB, dialect *dbDialect) error
+
+// dbMigrations evolve the schema in order. Version n of the schema has the first n migrations applied,
+// so append new migrations to the end and never change or reorder those that nodes may have applied.
+var dbMigrations = []dbMigration{
+	createArtTables,
+	createSyncCursors,
+	addSearchColumns,
+	createPeerReputations,
+	createPlaylists,
+	createPeerBandwidths,
+	addTrackCreatedAt,
+	createTrackStats,
+	addTrackGenresAndYear,
+	createPublicationSequences,
+	createTombstones,
+	createIssuedInvoices,
+	addTrackStatsLastPlayedAt,
+	addTombstoneDeletedAt,
+}
+
+// createArtTables creates the tables of the first schema.
+func createArtTables(db *sql.DB, dialect *dbDialect) error {
+	blobType := dialect.blobType
+	return execStatements(db,
+		"CREATE TABLE IF NOT EXISTS artists ("+
+			"artist_id VARCHAR(255) NOT NULL PRIMARY KEY, "+
+			"art "+blobType+" NOT NULL)",
+		"CREATE TABLE IF NOT EXISTS albums ("+
+			"artist_id VARCHAR(255) NOT NULL, "+
+			"artist_album_id VARCHAR(255) NOT NULL, "+
+			"art "+blobType+" NOT NULL, "+
+			"PRIMARY KEY (artist_id, artist_album_id))",
+		"CREATE TABLE IF NOT EXISTS tracks ("+
+			"artist_id VARCHAR(255) NOT NULL, "+
+			"artist_track_id VARCHAR(255) NOT NULL, "+
+			"artist_album_id VARCHAR(255) NOT NULL, "+
+			"art "+blobType+" NOT NULL, "+
+			"PRIMARY KEY (artist_id, artist_track_id))",
+		"CREATE TABLE IF NOT EXISTS peers ("+
+			"pubkey VARCHAR(255) NOT NULL PRIMARY KEY, "+
+			"art "+blobType+" NOT NULL)",
+		"CREATE TABLE IF NOT EXISTS publications ("+
+			"artist_id VARCHAR(255) NOT NULL, "+
+			"pubkey VARCHAR(255) NOT NULL, "+
+			"art "+blobType+" NOT NULL, "+
+			"PRIMARY KEY (artist_id, pubkey))")
+}
+
+// createSyncCursors creates the table of when art was last synced from each peer.
+func createSyncCursors(db *sql.DB, dialect *dbDialect) error {
+	return execStatements(db,
+		"CREATE TABLE IF NOT EXISTS sync_cursors ("+
+			"pubkey VARCHAR(255) NOT NULL PRIMARY KEY, "+
+			"art "+dialect.blobType+" NOT NULL)")
+}
+
+// addSearchColumns adds the artist name and track title columns to search
+// and fills them from the art already stored.
+func addSearchColumns(db *sql.DB, dialect *dbDialect) error {
+	err := addColumn(db, "artists", "name", "VARCHAR(255) NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = addColumn(db, "tracks", "title", "VARCHAR(255) NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+
+	artists, err := selectStoredArt(db, "SELECT art FROM artists", newArtist)
+	if err != nil {
+		return err
+	}
+	for _, message := range artists {
+		artist := message.(*art.Artist)
+		_, err = db.Exec(dialect.rebind("UPDATE artists SET name = ? WHERE artist_id = ?"),
+			artist.Name, artist.ArtistId)
+		if err != nil {
+			return err
+		}
+	}
+	tracks, err := selectStoredArt(db, "SELECT art FROM tracks", newTrack)
+	if err != nil {
+		return err
+	}
+	for _, message := range tracks {
+		track := message.(*art.Track)
+		_, err = db.Exec(dialect.rebind("UPDATE tracks SET title = ? WHERE artist_id = ? AND artist_track_id = ?"),
+			track.Title, track.ArtistId, track.ArtistTrackId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createPeerReputations creates the table of failures recorded for each peer.
+func createPeerReputations(db *sql.DB, dialect *dbDialect) error {
+	return execStatements(db,
+		"CREATE TABLE IF NOT EXISTS peer_reputations ("+
+			"pubkey VARCHAR(255) NOT NULL PRIMARY KEY, "+
+			"art "+dialect.blobType+" NOT NULL)")
+}
+
+// createPlaylists creates the table of the playlists curated by each artist.
+func createPlaylists(db *sql.DB, dialect *dbDialect) error {
+	return execStatements(db,
+		"CREATE TABLE IF NOT EXISTS playlists ("+
+			"artist_id VARCHAR(255) NOT NULL, "+
+			"artist_playlist_id VARCHAR(255) NOT NULL, "+
+			"art "+dialect.blobType+" NOT NULL, "+
+			"PRIMARY KEY (artist_id, artist_playlist_id))")
+}
+
+// createPeerBandwidths creates the table of the bytes served to each peer.
+func createPeerBandwidths(db *sql.DB, dialect *dbDialect) error {
+	return execStatements(db,
+		"CREATE TABLE IF NOT EXISTS peer_bandwidths ("+
+			"pubkey VARCHAR(255) NOT NULL PRIMARY KEY, "+
+			"art "+dialect.blobType+" NOT NULL)")
+}
+
+// addTrackCreatedAt adds the column of when each track was created, to list the newest tracks,
+// and fills it from the tracks already stored, which were created when first updated if not recorded.
+func addTrackCreatedAt(db *sql.DB, dialect *dbDialect) error {
+	err := addColumn(db, "tracks", "created_at", "BIGINT NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	tracks, err := selectStoredArt(db, "SELECT art FROM tracks", newTrack)
+	if err != nil {
+		return err
+	}
+	for _, message := range tracks {
+		track := message.(*art.Track)
+		if track.CreatedAt == 0 {
+			track.CreatedAt = track.UpdatedAt
+		}
+		data, err := proto.Marshal(track)
+		if err != nil {
+			return err
+		}
+		_, err = db.Exec(dialect.rebind("UPDATE tracks SET created_at = ?, art = ? WHERE artist_id = ? AND artist_track_id = ?"),
+			track.CreatedAt, data, track.ArtistId, track.ArtistTrackId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createTrackStats creates the table of the plays and purchases counted for each track.
+func createTrackStats(db *sql.DB, dialect *dbDialect) error {
+	return execStatements(db,
+		"CREATE TABLE IF NOT EXISTS track_stats ("+
+			"artist_id VARCHAR(255) NOT NULL, "+
+			"artist_track_id VARCHAR(255) NOT NULL, "+
+			"plays BIGINT NOT NULL DEFAULT 0, "+
+			"purchases BIGINT NOT NULL DEFAULT 0, "+
+			"art "+dialect.blobType+" NOT NULL, "+
+			"PRIMARY KEY (artist_id, artist_track_id))")
+}
+
+// addTrackGenresAndYear adds the columns of the genres and release year of each track, to filter searches,
+// and fills them from the tracks already stored.
+func addTrackGenresAndYear(db *sql.DB, dialect *dbDialect) error {
+	err := addColumn(db, "tracks", "genres", "VARCHAR(1024) NOT NULL DEFAULT ''")
+	if err != nil {
+		return err
+	}
+	err = addColumn(db, "tracks", "release_year", "INTEGER NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	tracks, err := selectStoredArt(db, "SELECT art FROM tracks", newTrack)
+	if err != nil {
+		return err
+	}
+	for _, message := range tracks {
+		track := message.(*art.Track)
+		_, err = db.Exec(dialect.rebind("UPDATE tracks SET genres = ?, release_year = ? WHERE artist_id = ? AND artist_track_id = ?"),
+			genresColumn(track.Genres), track.Year, track.ArtistId, track.ArtistTrackId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createPublicationSequences creates the table of the latest publication sequence validated from each artist pubkey.
+func createPublicationSequences(db *sql.DB, dialect *dbDialect) error {
+	return execStatements(db,
+		"CREATE TABLE IF NOT EXISTS publication_sequences ("+
+			"pubkey VARCHAR(255) NOT NULL PRIMARY KEY, "+
+			"art "+dialect.blobType+" NOT NULL)")
+}
+
+// createTombstones creates the table of the tracks and albums deleted from the hosted art.
+// A tombstone of a track has an empty artist_album_id, and one of an album an empty artist_track_id.
+func createTombstones(db *sql.DB, dialect *dbDialect) error {
+	return execStatements(db,
+		"CREATE TABLE IF NOT EXISTS tombstones ("+
+			"artist_id VARCHAR(255) NOT NULL, "+
+			"artist_album_id VARCHAR(255) NOT NULL, "+
+			"artist_track_id VARCHAR(255) NOT NULL, "+
+			"art "+dialect.blobType+" NOT NULL, "+
+			"PRIMARY KEY (artist_id, artist_album_id, artist_track_id))")
+}
+
+// createIssuedInvoices creates the table of the invoices issued for tracks and albums,
+// with the columns to find those expired unpaid.
+func createIssuedInvoices(db *sql.DB, dialect *dbDialect) error {
+	return execStatements(db,
+		"CREATE TABLE IF NOT EXISTS issued_invoices ("+
+			"invoice_hash VARCHAR(64) NOT NULL PRIMARY KEY, "+
+			"expires_at BIGINT NOT NULL DEFAULT 0, "+
+			"settled_at BIGINT NOT NULL DEFAULT 0, "+
+			"art "+dialect.blobType+" NOT NULL)")
+}
+
+// addTrackStatsLastPlayedAt adds the column of when each track was last played,
+// so plays are added to the stats in sql, and fills it from the stats already stored.
+func addTrackStatsLastPlayedAt(db *sql.DB, dialect *dbDialect) error {
+	err := addColumn(db, "track_stats", "last_played_at", "BIGINT NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	trackStats, err := selectStoredArt(db, "SELECT art FROM track_stats", newTrackStats)
+	if err != nil {
+		return err
+	}
+	for _, message := range trackStats {
+		stats := message.(*art.TrackStats)
+		_, err = db.Exec(dialect.rebind("UPDATE track_stats SET last_played_at = ? WHERE artist_id = ? AND artist_track_id = ?"),
+			stats.LastPlayedAt, stats.ArtistId, stats.ArtistTrackId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addTombstoneDeletedAt adds the column of when the art of each tombstone was deleted, to delete expired tombstones,
+// and fills it from the tombstones already stored.
+func addTombstoneDeletedAt(db *sql.DB, dialect *dbDialect) error {
+	err := addColumn(db, "tombstones", "deleted_at", "BIGINT NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	tombstones, err := selectStoredArt(db, "SELECT art FROM tombstones", newTombstone)
+	if err != nil {
+		return err
+	}
+	for _, message := range tombstones {
+		tombstone := message.(*art.Tombstone)
+		_, err = db.Exec(dialect.rebind("UPDATE tombstones SET deleted_at = ? "+
+			"WHERE artist_id = ? AND artist_album_id = ? AND artist_track_id = ?"),
+			tombstone.DeletedAt, tombstone.ArtistId, tombstone.ArtistAlbumId, tombstone.ArtistTrackId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execStatements executes each statement in order.
+func execStatements(db *sql.DB, statements ...string) error {
+	for _, statement := range statements {
+		_, err := db.Exec(statement)
+		if err != nil {
+			return fmt.Errorf("exec %s, error: %w", statement, err)
+		}
+	}
+	return nil
+}
+
+// hasColumn checks whether table exists with column, or with any columns if column is "*".
+func hasColumn(db *sql.DB, table string, column string) bool {
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM %s WHERE 1 = 0", column, table))
+	if err != nil {
+		return false
+	}
+	rows.Close()
+	return true
+}
+
+// addColumn adds column with the given definition to table unless table already has column.
+func addColumn(db *sql.DB, table string, column string, definition string) error {
+	if hasColumn(db, table, column) {
+		return nil
+	}
+	return execStatements(db, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+}
+
+// selectStoredArt gets the art messages selected by query, reading all the rows before returning
+// so the caller may update the same table.
+func selectStoredArt(db *sql.DB, query string, newMessage func() proto.Message) ([]proto.Message, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var messages []proto.Message
+	for rows.Next() {
+		var data []byte
+		err = rows.Scan(&data)
+		if err != nil {
+			return nil, err
+		}
+		message := newMessage()
+		err = proto.Unmarshal(data, message)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// schemaVersion gets the version of the schema, which is 0 if no migration was recorded.
+// It creates the schema_version table to record migrations if the table is missing.
+func schemaVersion(db *sql.DB) (int, error) {
+	err := execStatements(db, "CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL PRIMARY KEY)")
+	if err != nil {
+		return 0, err
+	}
+	var version sql.NullInt64
+	err = db.QueryRow("SELECT MAX(version) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// migrateSchema applies the pending migrations up to targetVersion in order,
+// recording the version after each so an interrupted upgrade resumes where it stopped.
+func migrateSchema(db *sql.DB, dialect *dbDialect, targetVersion int) error {
+	logger := componentLogger("dbServer")
+
+	version, err := schemaVersion(db)
+	if err != nil {
+		logger.Error("failed to get schema version", "error", err)
+		return err
+	}
+	if version > len(dbMigrations) {
+		return fmt.Errorf("db schema version %d is newer than version %d of this austk", version, len(dbMigrations))
+	}
+	for ; version < targetVersion; version++ {
+		logger.Info("migrate schema", "from_version", version, "to_version", version+1)
+		err = dbMigrations[version](db, dialect)
+		if err != nil {
+			logger.Error("failed to migrate schema", "to_version", version+1, "error", err)
+			return err
+		}
+		_, err = db.Exec(dialect.rebind("INSERT INTO schema_version (version) VALUES (?)"), version+1)
+		if err != nil {
+			logger.Error("failed to record schema version", "version", version+1, "error", err)
+			return err
+		}
+	}
+	return nil
+}
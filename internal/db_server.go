@@ -0,0 +1,1360 @@
+package audiostrike
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	art "github.com/audiostrike/music/pkg/art"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/golang/protobuf/proto"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	DbEngineSqlite   = "sqlite"
+	DbEngineMysql    = "mysql"
+	DbEnginePostgres = "postgres"
+
+	defaultMysqlPort    = 3306
+	defaultPostgresPort = 5432
+)
+
+// dbDialect describes how to connect and write sql for a database engine.
+type dbDialect struct {
+	driverName string
+	// blobType is the column type for serialized art.
+	blobType string
+	// numberedBindVars is true for engines with $1, $2, ... placeholders rather than ?.
+	numberedBindVars bool
+	// upsertStatement gets the statement to insert a row into table or update the row with the same primary key.
+	upsertStatement func(table string, columns []string) string
+	// dataSourceName gets the data source name to open the configured database.
+	dataSourceName func(cfg *Config) string
+}
+
+// dbPrimaryKeys has the primary key columns of each table.
+var dbPrimaryKeys = map[string][]string{
+	"artists":               {"artist_id"},
+	"albums":                {"artist_id", "artist_album_id"},
+	"tracks":                {"artist_id", "artist_track_id"},
+	"peers":                 {"pubkey"},
+	"sync_cursors":          {"pubkey"},
+	"peer_reputations":      {"pubkey"},
+	"peer_bandwidths":       {"pubkey"},
+	"publications":          {"artist_id", "pubkey"},
+	"publication_sequences": {"pubkey"},
+	"playlists":             {"artist_id", "artist_playlist_id"},
+	"track_stats":           {"artist_id", "artist_track_id"},
+	"tombstones":            {"artist_id", "artist_album_id", "artist_track_id"},
+	"issued_invoices":       {"invoice_hash"},
+}
+
+// replaceStatement gets a REPLACE statement, which sqlite and mysql use to upsert.
+func replaceStatement(table string, columns []string) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	return fmt.Sprintf("REPLACE INTO %s (%s) VALUES (%s)", table, strings.Join(columns, ", "), placeholders)
+}
+
+// onConflictStatement gets an INSERT ... ON CONFLICT statement, which postgres uses to upsert.
+func onConflictStatement(table string, columns []string) string {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	keyColumns := dbPrimaryKeys[table]
+	var updates []string
+	for _, column := range columns[len(keyColumns):] {
+		updates = append(updates, column+" = EXCLUDED."+column)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT (%s) DO UPDATE SET %s",
+		table, strings.Join(columns, ", "), placeholders, strings.Join(keyColumns, ", "), strings.Join(updates, ", "))
+}
+
+// rebind replaces each ? placeholder in query with $1, $2, ... for engines that number them.
+func (dialect *dbDialect) rebind(query string) string {
+	if !dialect.numberedBindVars {
+		return query
+	}
+	var rebound strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			rebound.WriteString("$" + strconv.Itoa(n))
+		} else {
+			rebound.WriteRune(c)
+		}
+	}
+	return rebound.String()
+}
+
+// dbHostPort gets the configured database host:port, using defaultPort if no port is configured.
+func dbHostPort(cfg *Config, defaultPort int) string {
+	port := cfg.DbPort
+	if port == 0 {
+		port = defaultPort
+	}
+	return net.JoinHostPort(cfg.DbHost, strconv.Itoa(port))
+}
+
+var dbDialects = map[string]*dbDialect{
+	DbEngineSqlite: &dbDialect{
+		driverName:      "sqlite3",
+		blobType:        "BLOB",
+		upsertStatement: replaceStatement,
+		dataSourceName: func(cfg *Config) string {
+			return cfg.DbFile
+		},
+	},
+	DbEngineMysql: &dbDialect{
+		driverName:      "mysql",
+		blobType:        "LONGBLOB",
+		upsertStatement: replaceStatement,
+		dataSourceName: func(cfg *Config) string {
+			return fmt.Sprintf("%s:%s@tcp(%s)/%s",
+				cfg.DbUser, cfg.DbPass, dbHostPort(cfg, defaultMysqlPort), cfg.DbName)
+		},
+	},
+	DbEnginePostgres: &dbDialect{
+		driverName:       "postgres",
+		blobType:         "BYTEA",
+		numberedBindVars: true,
+		upsertStatement:  onConflictStatement,
+		dataSourceName: func(cfg *Config) string {
+			dataSourceURL := url.URL{
+				Scheme: "postgres",
+				User:   url.UserPassword(cfg.DbUser, cfg.DbPass),
+				Host:   dbHostPort(cfg, defaultPostgresPort),
+				Path:   "/" + cfg.DbName,
+			}
+			return dataSourceURL.String()
+		},
+	},
+}
+
+// PayloadStore stores track payloads apart from the art in a DbServer, e.g. in an s3 bucket or pinned in IPFS.
+type PayloadStore interface {
+	// StorePayload stores the payload of track, recording on track where it is stored if the store names it,
+	// e.g. its PayloadCid.
+	StorePayload(track *art.Track, payload []byte) error
+	// OpenPayload opens the stored payload of track to read from the byte at offset.
+	OpenPayload(track *art.Track, offset int64) (io.ReadCloser, error)
+	// PayloadSize gets the length in bytes of the stored payload of track.
+	PayloadSize(track *art.Track) (int64, error)
+	// DeletePayload removes the stored payload of track, if any.
+	DeletePayload(track *art.Track) error
+}
+
+// DbServer stores art in a sql database and serves it.
+// Each record is stored as its marshaled art message beside the columns that identify it,
+// so fields added to the art messages are stored without changing the schema.
+// Track payloads are stored as files under payloadDir, or in payloadStore if configured,
+// and album cover art under rootPath, like FileServer.
+// Only the payloads of free tracks are pinned in IPFS, where anyone with the CID can fetch them,
+// so the payloads of paid tracks stay in files even with -ipfsapi.
+type DbServer struct {
+	db         *sql.DB
+	dialect    *dbDialect
+	rootPath   string
+	payloadDir string
+
+	// payloadStore stores the track payloads if -s3endpoint or -ipfsapi is configured, or else is nil.
+	payloadStore PayloadStore
+	// defaultPriceSats is the price of a track with no price set for it or its album,
+	// to pin only the payloads of free tracks in IPFS.
+	defaultPriceSats uint64
+
+	logger *slog.Logger
+}
+
+// NewDbServer opens the configured database to store and serve art
+// and applies any pending schema migrations, so a database from an earlier austk keeps its art.
+// With cfg.DbInit, this also creates the tables of an empty database.
+func NewDbServer(cfg *Config) (*DbServer, error) {
+	logger := cfg.componentLogger("dbServer").With("db_engine", cfg.DbEngine)
+
+	dialect := dbDialects[cfg.DbEngine]
+	if dialect == nil {
+		return nil, fmt.Errorf("unsupported db engine %s", cfg.DbEngine)
+	}
+	// The data source name has the database password, so redact it from driver errors.
+	db, err := sql.Open(dialect.driverName, dialect.dataSourceName(cfg))
+	if err != nil {
+		err = cfg.redactError(err)
+		logger.Error("failed to open db", "error", err)
+		return nil, err
+	}
+	err = db.Ping()
+	if err != nil {
+		err = cfg.redactError(err)
+		logger.Error("failed to connect to db", "error", err)
+		db.Close()
+		return nil, err
+	}
+
+	dbServer := &DbServer{
+		db:         db,
+		dialect:    dialect,
+		rootPath:   cfg.ArtDir,
+		payloadDir: cfg.payloadDir(),
+		logger:     logger,
+
+		defaultPriceSats: cfg.DefaultPrice,
+	}
+	if cfg.S3Endpoint != "" {
+		var s3Store *S3PayloadStore
+		s3Store, err = NewS3PayloadStore(cfg)
+		if err == nil && cfg.DbInit {
+			err = s3Store.InitBucket()
+		}
+		if err != nil {
+			logger.Error("failed to open s3 payload store", "error", err)
+			db.Close()
+			return nil, err
+		}
+		dbServer.payloadStore = s3Store
+	} else if cfg.IPFSAPI != "" {
+		var ipfsNode *IPFSNode
+		ipfsNode, err = NewIPFSNode(cfg)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		dbServer.payloadStore = ipfsNode
+	}
+	// Without -dbinit, only upgrade a database that already has the art tables.
+	if !cfg.DbInit && !hasColumn(db, "artists", "*") {
+		db.Close()
+		return nil, fmt.Errorf("%s db has no art tables, so run with -dbinit to create them", cfg.DbEngine)
+	}
+	err = migrateSchema(db, dialect, len(dbMigrations))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return dbServer, nil
+}
+
+// Close closes the database.
+func (dbServer *DbServer) Close() error {
+	return dbServer.db.Close()
+}
+
+// execer executes sql statements in a *sql.DB or in a *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// replace inserts the marshaled message into table or replaces the row with the same primary key.
+// The columns, starting with the primary key columns of table, have the given values.
+func replace(db execer, dialect *dbDialect, table string, columns []string, message proto.Message, values ...interface{}) error {
+	data, err := proto.Marshal(message)
+	if err != nil {
+		componentLogger("dbServer").Error("failed to marshal art", "table", table, "error", err)
+		return err
+	}
+	statement := dialect.rebind(dialect.upsertStatement(table, append(columns, "art")))
+	_, err = db.Exec(statement, append(values, data)...)
+	if err != nil {
+		componentLogger("dbServer").Error("failed to store art", "table", table, "statement", statement, "error", err)
+	}
+	return err
+}
+
+// selectArt selects the marshaled art from rows of table matching the query after WHERE
+// and unmarshals each into a message from newMessage.
+func (dbServer *DbServer) selectArt(table string, where string, newMessage func() proto.Message, args ...interface{}) ([]proto.Message, error) {
+	query := "SELECT art FROM " + table
+	if where != "" {
+		query += " WHERE " + where
+	}
+	return dbServer.queryArt(table, query, newMessage, args...)
+}
+
+// selectArtPage selects a page of at most limit rows from table, like selectArt,
+// ordered by the orderBy columns and starting at offset.
+func (dbServer *DbServer) selectArtPage(table string, where string, orderBy string, offset int, limit int, newMessage func() proto.Message, args ...interface{}) ([]proto.Message, error) {
+	query := "SELECT art FROM " + table
+	if where != "" {
+		query += " WHERE " + where
+	}
+	query += " ORDER BY " + orderBy + " LIMIT ? OFFSET ?"
+	return dbServer.queryArt(table, query, newMessage, append(args, limit, offset)...)
+}
+
+// queryArt queries the marshaled art from rows of table and unmarshals each into a message from newMessage.
+func (dbServer *DbServer) queryArt(table string, query string, newMessage func() proto.Message, args ...interface{}) ([]proto.Message, error) {
+	query = dbServer.dialect.rebind(query)
+	rows, err := dbServer.db.Query(query, args...)
+	if err != nil {
+		dbServer.logger.Error("failed to query art", "table", table, "query", query, "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []proto.Message
+	for rows.Next() {
+		var data []byte
+		err = rows.Scan(&data)
+		if err != nil {
+			return nil, err
+		}
+		message := newMessage()
+		err = proto.Unmarshal(data, message)
+		if err != nil {
+			dbServer.logger.Error("failed to unmarshal art", "table", table, "error", err)
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+func newArtist() proto.Message              { return &art.Artist{} }
+func newAlbum() proto.Message               { return &art.Album{} }
+func newTrack() proto.Message               { return &art.Track{} }
+func newPeer() proto.Message                { return &art.Peer{} }
+func newSyncCursor() proto.Message          { return &art.SyncCursor{} }
+func newPeerReputation() proto.Message      { return &art.PeerReputation{} }
+func newPublicationSequence() proto.Message { return &art.PublicationSequence{} }
+func newTombstone() proto.Message           { return &art.Tombstone{} }
+func newPlaylist() proto.Message            { return &art.Playlist{} }
+func newPeerBandwidth() proto.Message       { return &art.PeerBandwidth{} }
+func newTrackStats() proto.Message          { return &art.TrackStats{} }
+func newIssuedInvoice() proto.Message       { return &art.IssuedInvoice{} }
+
+// StoreArtist validates the given artist and stores it in the database.
+func (dbServer *DbServer) StoreArtist(artist *art.Artist) error {
+	if artist.Pubkey == "" {
+		dbServer.logger.Warn("reject artist missing pubkey", "artist_id", artist.ArtistId)
+		return fmt.Errorf("Failed to store artist missing Pubkey")
+	}
+	previousArtist, err := dbServer.Artist(artist.ArtistId)
+	if err != nil && err != ErrArtNotFound {
+		return err
+	}
+	stampUpdatedAt(previousArtist, artist, nowUnix())
+	return dbServer.putArtist(artist)
+}
+
+func (dbServer *DbServer) putArtist(artist *art.Artist) error {
+	return replaceArtist(dbServer.db, dbServer.dialect, artist)
+}
+
+// replaceArtist stores artist with its name in a column to search.
+func replaceArtist(db execer, dialect *dbDialect, artist *art.Artist) error {
+	return replace(db, dialect, "artists", []string{"artist_id", "name"}, artist, artist.ArtistId, artist.Name)
+}
+
+// SearchArtists gets the artists whose names contain query, ignoring case, ordered by name.
+func (dbServer *DbServer) SearchArtists(query string) ([]*art.Artist, error) {
+	messages, err := dbServer.selectArt("artists", "LOWER(name) LIKE ? ESCAPE '!' ORDER BY LOWER(name), artist_id",
+		newArtist, likePattern(query))
+	if err != nil {
+		return nil, err
+	}
+	artists := make([]*art.Artist, len(messages))
+	for i, message := range messages {
+		artists[i] = message.(*art.Artist)
+	}
+	return artists, nil
+}
+
+func (dbServer *DbServer) Artists() (map[string]*art.Artist, error) {
+	messages, err := dbServer.selectArt("artists", "", newArtist)
+	if err != nil {
+		return nil, err
+	}
+	artists := make(map[string]*art.Artist)
+	for _, message := range messages {
+		artist := message.(*art.Artist)
+		artists[artist.ArtistId] = artist
+	}
+	return artists, nil
+}
+
+func (dbServer *DbServer) Artist(artistID string) (*art.Artist, error) {
+	messages, err := dbServer.selectArt("artists", "artist_id = ?", newArtist, artistID)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrArtNotFound
+	}
+	return messages[0].(*art.Artist), nil
+}
+
+// StoreAlbum stores the album if its artist is the publishing artist.
+func (dbServer *DbServer) StoreAlbum(album *art.Album, publisher Publisher) error {
+	logger := dbServer.logger.With("artist_id", album.ArtistId, "album_id", album.ArtistAlbumId)
+
+	err := checkAlbumPath(album)
+	if err != nil {
+		logger.Warn("reject album with unsafe id", "error", err)
+		return err
+	}
+	publishingArtist, err := publisher.Artist()
+	if err != nil {
+		logger.Error("failed to get publishing artist", "error", err)
+		return err
+	}
+	albumArtist, err := dbServer.Artist(album.ArtistId)
+	if err != nil {
+		logger.Error("failed to get album artist", "error", err)
+		return err
+	}
+	if publishingArtist.Pubkey != albumArtist.Pubkey {
+		logger.Info("skip album of artist with another pubkey than the publisher's",
+			"pubkey", albumArtist.Pubkey, "publishing_pubkey", publishingArtist.Pubkey)
+		return nil
+	}
+	if album.ArtistId == "" || album.ArtistAlbumId == "" {
+		return fmt.Errorf("malformed album %v", album)
+	}
+
+	previousAlbum, err := dbServer.album(album.ArtistId, album.ArtistAlbumId)
+	if err != nil && err != ErrArtNotFound {
+		return err
+	}
+	// Keep the price and cover art already set for the album when storing it again, e.g. to add another track.
+	keepAlbumSettings(previousAlbum, album)
+	stampUpdatedAt(previousAlbum, album, nowUnix())
+	return dbServer.putAlbum(album)
+}
+
+func (dbServer *DbServer) putAlbum(album *art.Album) error {
+	return replace(dbServer.db, dbServer.dialect, "albums", []string{"artist_id", "artist_album_id"}, album,
+		album.ArtistId, album.ArtistAlbumId)
+}
+
+func (dbServer *DbServer) album(artistID string, artistAlbumID string) (*art.Album, error) {
+	messages, err := dbServer.selectArt("albums", "artist_id = ? AND artist_album_id = ?", newAlbum,
+		artistID, artistAlbumID)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrArtNotFound
+	}
+	return messages[0].(*art.Album), nil
+}
+
+func (dbServer *DbServer) Albums(artistID string) (map[string]*art.Album, error) {
+	messages, err := dbServer.selectArt("albums", "artist_id = ?", newAlbum, artistID)
+	if err != nil {
+		return nil, err
+	}
+	albums := make(map[string]*art.Album)
+	for _, message := range messages {
+		album := message.(*art.Album)
+		albums[album.ArtistAlbumId] = album
+	}
+	return albums, nil
+}
+
+// AlbumsPage gets the page of the artist's albums starting at offset, ordered by ArtistAlbumId.
+func (dbServer *DbServer) AlbumsPage(artistID string, offset int, limit int) ([]*art.Album, error) {
+	messages, err := dbServer.selectArtPage("albums", "artist_id = ?", "artist_album_id", offset, limit, newAlbum, artistID)
+	if err != nil {
+		return nil, err
+	}
+	albums := make([]*art.Album, len(messages))
+	for i, message := range messages {
+		albums[i] = message.(*art.Album)
+	}
+	return albums, nil
+}
+
+// SetAlbumPrice sets the price in satoshis to charge for each track of the stored album
+// that has no price of its own.
+func (dbServer *DbServer) SetAlbumPrice(album *art.Album, sats uint64) error {
+	storedAlbum, err := dbServer.album(album.ArtistId, album.ArtistAlbumId)
+	if err != nil {
+		return err
+	}
+	storedAlbum.Price = &art.Price{Sats: sats}
+	storedAlbum.UpdatedAt = nowUnix()
+	album.Price = storedAlbum.Price
+	return dbServer.putAlbum(storedAlbum)
+}
+
+// StoreAlbumArt stores image as the cover art of the stored album in a file
+// and records its mime type and hash on the stored album.
+func (dbServer *DbServer) StoreAlbumArt(album *art.Album, image []byte, mime string) error {
+	storedAlbum, err := dbServer.album(album.ArtistId, album.ArtistAlbumId)
+	if err != nil {
+		return err
+	}
+	err = writePayloadFile(albumArtPath(dbServer.rootPath, storedAlbum), image)
+	if err != nil {
+		return err
+	}
+	isChanged := setAlbumArt(storedAlbum, image, mime)
+	album.CoverArtMime = storedAlbum.CoverArtMime
+	album.CoverArtSha256 = storedAlbum.CoverArtSha256
+	if !isChanged {
+		return nil
+	}
+	return dbServer.putAlbum(storedAlbum)
+}
+
+// DeleteAlbum removes the album and its cover art file, or fails with ErrAlbumNotEmpty if it has tracks.
+func (dbServer *DbServer) DeleteAlbum(album *art.Album) error {
+	storedAlbum, err := dbServer.album(album.ArtistId, album.ArtistAlbumId)
+	if err != nil {
+		return err
+	}
+	albumTracks, err := dbServer.selectArt("tracks", "artist_id = ? AND artist_album_id = ?", newTrack,
+		album.ArtistId, album.ArtistAlbumId)
+	if err != nil {
+		return err
+	}
+	if len(albumTracks) > 0 {
+		return fmt.Errorf("%w: %s/%s", ErrAlbumNotEmpty, album.ArtistId, album.ArtistAlbumId)
+	}
+	_, err = dbServer.db.Exec(dbServer.dialect.rebind("DELETE FROM albums WHERE artist_id = ? AND artist_album_id = ?"),
+		album.ArtistId, album.ArtistAlbumId)
+	if err != nil {
+		return err
+	}
+	return removePayloadFile(albumArtPath(dbServer.rootPath, storedAlbum))
+}
+
+// AlbumArt gets the cover art image of the album and its mime type, or ErrArtNotFound if it has none.
+func (dbServer *DbServer) AlbumArt(artistID string, artistAlbumID string) ([]byte, string, error) {
+	album, err := dbServer.album(artistID, artistAlbumID)
+	if err != nil {
+		return nil, "", err
+	}
+	return readAlbumArtFile(dbServer.rootPath, album)
+}
+
+// StoreTrack stores track metadata in the database.
+func (dbServer *DbServer) StoreTrack(track *art.Track, publisher Publisher) error {
+	err := checkTrackPath(track)
+	if err != nil {
+		dbServer.logger.Warn("reject track with unsafe id", "error", err)
+		return err
+	}
+	previousTrack, err := dbServer.Track(track.ArtistId, track.ArtistTrackId)
+	if err != nil && err != ErrArtNotFound {
+		return err
+	}
+	now := nowUnix()
+	stampCreatedAt(previousTrack, track, now)
+	stampUpdatedAt(previousTrack, track, now)
+	return replaceTrack(dbServer.db, dbServer.dialect, track)
+}
+
+// replaceTrack stores track with its title in a column to search and when it was created in a column to order by.
+func replaceTrack(db execer, dialect *dbDialect, track *art.Track) error {
+	return replace(db, dialect, "tracks",
+		[]string{"artist_id", "artist_track_id", "artist_album_id", "title", "created_at", "genres", "release_year"}, track,
+		track.ArtistId, track.ArtistTrackId, track.ArtistAlbumId, track.Title, track.CreatedAt,
+		genresColumn(track.Genres), track.Year)
+}
+
+// recentTracksOrder orders the newest tracks first, like recentTracks.
+const recentTracksOrder = "created_at DESC, artist_id, artist_track_id"
+
+// RecentTracks gets at most limit tracks by any artists, newest first, or all of them if limit is negative.
+func (dbServer *DbServer) RecentTracks(limit int) ([]*art.Track, error) {
+	var messages []proto.Message
+	var err error
+	if limit < 0 {
+		messages, err = dbServer.queryArt("tracks", "SELECT art FROM tracks ORDER BY "+recentTracksOrder, newTrack)
+	} else {
+		messages, err = dbServer.selectArtPage("tracks", "", recentTracksOrder, 0, limit, newTrack)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tracks := make([]*art.Track, len(messages))
+	for i, message := range messages {
+		tracks[i] = message.(*art.Track)
+	}
+	return tracks, nil
+}
+
+// SearchTracks gets the tracks whose titles contain query, ignoring case, and that pass filter,
+// ordered by artist then by title.
+func (dbServer *DbServer) SearchTracks(query string, filter TrackFilter) ([]*art.Track, error) {
+	where := "LOWER(title) LIKE ? ESCAPE '!'"
+	args := []interface{}{likePattern(query)}
+	if filter.Genre != "" {
+		where += " AND genres LIKE ? ESCAPE '!'"
+		args = append(args, likePattern("|"+filter.Genre+"|"))
+	}
+	if filter.MinYear > 0 || filter.MaxYear > 0 {
+		where += " AND release_year > 0"
+	}
+	if filter.MinYear > 0 {
+		where += " AND release_year >= ?"
+		args = append(args, filter.MinYear)
+	}
+	if filter.MaxYear > 0 {
+		where += " AND release_year <= ?"
+		args = append(args, filter.MaxYear)
+	}
+	messages, err := dbServer.selectArt("tracks", where+" ORDER BY artist_id, LOWER(title), artist_track_id",
+		newTrack, args...)
+	if err != nil {
+		return nil, err
+	}
+	tracks := make([]*art.Track, len(messages))
+	for i, message := range messages {
+		tracks[i] = message.(*art.Track)
+	}
+	return tracks, nil
+}
+
+// StoreTrackPayload stores the mp3 or flac bytes of the given track in a file or in the payload store
+// and records their SHA-256 hash, and any CID where they are pinned, on the stored track to publish with it.
+// The payload of a paid track is stored in a file rather than pinned in IPFS.
+func (dbServer *DbServer) StoreTrackPayload(track *art.Track, payload []byte) error {
+	storedTrack, err := dbServer.Track(track.ArtistId, track.ArtistTrackId)
+	if err != nil && err != ErrArtNotFound {
+		return err
+	}
+	_, isIPFS := dbServer.payloadStore.(*IPFSNode)
+	isPinnable := true
+	if isIPFS {
+		priceTrack := track
+		if storedTrack != nil {
+			priceTrack = storedTrack
+		}
+		var priceSats uint64
+		priceSats, err = dbServer.effectivePrice(priceTrack)
+		if err != nil {
+			return err
+		}
+		isPinnable = priceSats == 0
+	}
+	if dbServer.payloadStore != nil && isPinnable {
+		err = dbServer.payloadStore.StorePayload(track, payload)
+	} else {
+		if !isPinnable {
+			track.PayloadCid = ""
+		}
+		err = writePayloadFile(payloadPath(dbServer.payloadDir, track), payload)
+	}
+	if err != nil {
+		return err
+	}
+
+	payloadHash := sha256.Sum256(payload)
+	track.PayloadSha256 = payloadHash[:]
+	if storedTrack == nil {
+		return nil
+	}
+	// Unpin the payload this replaces, e.g. the free payload of a track since priced.
+	if isIPFS && storedTrack.PayloadCid != "" && storedTrack.PayloadCid != track.PayloadCid {
+		err = dbServer.deletePayload(storedTrack)
+		if err != nil {
+			dbServer.logger.Warn("failed to unpin replaced payload",
+				"artist_id", track.ArtistId, "track_id", track.ArtistTrackId, "cid", storedTrack.PayloadCid, "error", err)
+		}
+	}
+	if bytes.Equal(storedTrack.PayloadSha256, payloadHash[:]) && storedTrack.PayloadCid == track.PayloadCid {
+		return nil
+	}
+	storedTrack.PayloadSha256 = payloadHash[:]
+	storedTrack.PayloadCid = track.PayloadCid
+	return dbServer.StoreTrack(storedTrack, nil)
+}
+
+// StoreTrackPreview stores preview as the free preview clip of the stored track in a file
+// and records its length, track.PreviewSeconds, and its hash on the stored track.
+func (dbServer *DbServer) StoreTrackPreview(track *art.Track, preview []byte) error {
+	storedTrack, err := dbServer.Track(track.ArtistId, track.ArtistTrackId)
+	if err != nil {
+		return err
+	}
+	err = writePayloadFile(previewPath(dbServer.rootPath, storedTrack), preview)
+	if err != nil {
+		return err
+	}
+	isChanged := setTrackPreview(storedTrack, preview, track.PreviewSeconds)
+	track.PreviewSeconds = storedTrack.PreviewSeconds
+	track.PreviewSha256 = storedTrack.PreviewSha256
+	if !isChanged {
+		return nil
+	}
+	return replaceTrack(dbServer.db, dbServer.dialect, storedTrack)
+}
+
+// TrackPreview gets the preview clip of the track, or ErrArtNotFound if it has none.
+func (dbServer *DbServer) TrackPreview(artistID string, artistTrackID string) ([]byte, error) {
+	track, err := dbServer.Track(artistID, artistTrackID)
+	if err != nil {
+		return nil, err
+	}
+	return readPreviewFile(dbServer.rootPath, track)
+}
+
+// effectivePrice gets the price in satoshis of track: its own price, else the price of its album,
+// else the default price.
+func (dbServer *DbServer) effectivePrice(track *art.Track) (uint64, error) {
+	if track.Price != nil {
+		return track.Price.Sats, nil
+	}
+	if track.ArtistAlbumId != "" {
+		album, err := dbServer.album(track.ArtistId, track.ArtistAlbumId)
+		if err == nil && album.Price != nil {
+			return album.Price.Sats, nil
+		} else if err != nil && err != ErrArtNotFound {
+			return 0, err
+		}
+	}
+	return dbServer.defaultPriceSats, nil
+}
+
+// trackPayloadStore gets the payload store of storedTrack, or nil if its payload is in a file under payloadDir:
+// always for a node without -s3endpoint or -ipfsapi, and for a track with no pinned payload with -ipfsapi.
+func (dbServer *DbServer) trackPayloadStore(storedTrack *art.Track) PayloadStore {
+	if _, isIPFS := dbServer.payloadStore.(*IPFSNode); isIPFS && storedTrack.PayloadCid == "" {
+		return nil
+	}
+	return dbServer.payloadStore
+}
+
+// VerifyStoredTrack checks that the payload of track still matches the hash recorded when it was stored.
+func (dbServer *DbServer) VerifyStoredTrack(track *art.Track) error {
+	storedTrack, err := dbServer.Track(track.ArtistId, track.ArtistTrackId)
+	if err != nil {
+		return err
+	}
+	if payloadStore := dbServer.trackPayloadStore(storedTrack); payloadStore != nil {
+		payloadReader, err := payloadStore.OpenPayload(storedTrack, 0)
+		if err != nil {
+			return err
+		}
+		defer payloadReader.Close()
+		return verifyPayloadHash(payloadReader, objectKey(storedTrack), storedTrack)
+	}
+	return verifyPayloadFile(payloadPath(dbServer.payloadDir, storedTrack), storedTrack)
+}
+
+// TracksPage gets the page of the artist's tracks starting at offset, ordered by ArtistTrackId.
+func (dbServer *DbServer) TracksPage(artistID string, offset int, limit int) ([]*art.Track, error) {
+	messages, err := dbServer.selectArtPage("tracks", "artist_id = ?", "artist_track_id", offset, limit, newTrack, artistID)
+	if err != nil {
+		return nil, err
+	}
+	tracks := make([]*art.Track, len(messages))
+	for i, message := range messages {
+		tracks[i] = message.(*art.Track)
+	}
+	return tracks, nil
+}
+
+func (dbServer *DbServer) Tracks(artistID string) (map[string]*art.Track, error) {
+	messages, err := dbServer.selectArt("tracks", "artist_id = ?", newTrack, artistID)
+	if err != nil {
+		return nil, err
+	}
+	tracks := make(map[string]*art.Track)
+	for _, message := range messages {
+		track := message.(*art.Track)
+		tracks[track.ArtistTrackId] = track
+	}
+	return tracks, nil
+}
+
+func (dbServer *DbServer) Track(artistID string, artistTrackID string) (*art.Track, error) {
+	messages, err := dbServer.selectArt("tracks", "artist_id = ? AND artist_track_id = ?", newTrack,
+		artistID, artistTrackID)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrArtNotFound
+	}
+	return messages[0].(*art.Track), nil
+}
+
+// TrackFilePath gets the path of the payload file of track, or "" if its payload is stored in a payload store.
+func (dbServer *DbServer) TrackFilePath(track *art.Track) string {
+	if _, isIPFS := dbServer.payloadStore.(*IPFSNode); isIPFS {
+		// The CID of a pinned payload is recorded on the stored track, not on a track named by a request.
+		storedTrack, err := dbServer.Track(track.ArtistId, track.ArtistTrackId)
+		if err != nil || storedTrack.PayloadCid != "" {
+			return ""
+		}
+	} else if dbServer.payloadStore != nil {
+		return ""
+	}
+	return payloadPath(dbServer.payloadDir, track)
+}
+
+// TrackFilePartialReader opens the payload of track to read from offset.
+func (dbServer *DbServer) TrackFilePartialReader(track *art.Track, offset int64) (io.ReadCloser, error) {
+	if dbServer.payloadStore != nil {
+		// The CID of a pinned payload is recorded on the stored track, not on a track named by a request.
+		storedTrack, err := dbServer.Track(track.ArtistId, track.ArtistTrackId)
+		if err != nil {
+			return nil, err
+		}
+		if payloadStore := dbServer.trackPayloadStore(storedTrack); payloadStore != nil {
+			return payloadStore.OpenPayload(storedTrack, offset)
+		}
+	}
+	return openPayloadFile(payloadPath(dbServer.payloadDir, track), offset)
+}
+
+// SetTrackPrice sets the price in satoshis to charge for the stored track.
+func (dbServer *DbServer) SetTrackPrice(track *art.Track, sats uint64) error {
+	storedTrack, err := dbServer.Track(track.ArtistId, track.ArtistTrackId)
+	if err != nil {
+		return err
+	}
+	storedTrack.Price = &art.Price{Sats: sats}
+	track.Price = storedTrack.Price
+	return dbServer.StoreTrack(storedTrack, nil)
+}
+
+// DeleteTrack removes the track from the database and its payload.
+func (dbServer *DbServer) DeleteTrack(track *art.Track) error {
+	storedTrack, err := dbServer.Track(track.ArtistId, track.ArtistTrackId)
+	if err != nil {
+		return err
+	}
+	_, err = dbServer.db.Exec(dbServer.dialect.rebind("DELETE FROM tracks WHERE artist_id = ? AND artist_track_id = ?"),
+		track.ArtistId, track.ArtistTrackId)
+	if err != nil {
+		return err
+	}
+	err = removePayloadFile(previewPath(dbServer.rootPath, storedTrack))
+	if err != nil {
+		return err
+	}
+	if dbServer.trackPayloadStore(storedTrack) != nil {
+		return dbServer.deletePayload(storedTrack)
+	}
+	return removePayloadFile(payloadPath(dbServer.payloadDir, storedTrack))
+}
+
+// EvictTrack removes the payload of track from its file or the payload store, keeping the track.
+func (dbServer *DbServer) EvictTrack(track *art.Track) error {
+	storedTrack, err := dbServer.Track(track.ArtistId, track.ArtistTrackId)
+	if err != nil {
+		return err
+	}
+	if dbServer.trackPayloadStore(storedTrack) != nil {
+		return dbServer.deletePayload(storedTrack)
+	}
+	return removePayloadFile(payloadPath(dbServer.payloadDir, storedTrack))
+}
+
+// deletePayload removes the payload of the deleted or evicted storedTrack from the payload store,
+// unless another of the artist's tracks has the same pinned payload, e.g. the track moved to a new id.
+func (dbServer *DbServer) deletePayload(storedTrack *art.Track) error {
+	if storedTrack.PayloadCid != "" {
+		tracks, err := dbServer.Tracks(storedTrack.ArtistId)
+		if err != nil {
+			return err
+		}
+		for _, track := range tracks {
+			if track.ArtistTrackId != storedTrack.ArtistTrackId && track.PayloadCid == storedTrack.PayloadCid {
+				return nil
+			}
+		}
+	}
+	return dbServer.payloadStore.DeletePayload(storedTrack)
+}
+
+// TrackPayloadSize gets the length in bytes of the stored payload of track.
+func (dbServer *DbServer) TrackPayloadSize(track *art.Track) (int64, error) {
+	if dbServer.payloadStore != nil {
+		storedTrack, err := dbServer.Track(track.ArtistId, track.ArtistTrackId)
+		if err != nil {
+			return 0, err
+		}
+		if payloadStore := dbServer.trackPayloadStore(storedTrack); payloadStore != nil {
+			return payloadStore.PayloadSize(storedTrack)
+		}
+	}
+	fileInfo, err := os.Stat(payloadPath(dbServer.payloadDir, track))
+	if err != nil {
+		return 0, err
+	}
+	return fileInfo.Size(), nil
+}
+
+// StorePlaylist stores the playlist if its curating artist is the publishing artist.
+func (dbServer *DbServer) StorePlaylist(playlist *art.Playlist, publisher Publisher) error {
+	logger := dbServer.logger.With("artist_id", playlist.ArtistId, "playlist_id", playlist.ArtistPlaylistId)
+
+	err := validatePlaylist(playlist)
+	if err != nil {
+		logger.Warn("reject malformed playlist", "error", err)
+		return err
+	}
+	publishingArtist, err := publisher.Artist()
+	if err != nil {
+		logger.Error("failed to get publishing artist", "error", err)
+		return err
+	}
+	playlistArtist, err := dbServer.Artist(playlist.ArtistId)
+	if err != nil {
+		logger.Error("failed to get playlist artist", "error", err)
+		return err
+	}
+	if publishingArtist.Pubkey != playlistArtist.Pubkey {
+		logger.Info("skip playlist of artist with another pubkey than the publisher's",
+			"pubkey", playlistArtist.Pubkey, "publishing_pubkey", publishingArtist.Pubkey)
+		return nil
+	}
+
+	previousPlaylist, err := dbServer.Playlist(playlist.ArtistId, playlist.ArtistPlaylistId)
+	if err != nil && err != ErrArtNotFound {
+		return err
+	}
+	stampUpdatedAt(previousPlaylist, playlist, nowUnix())
+	return replacePlaylist(dbServer.db, dbServer.dialect, playlist)
+}
+
+func replacePlaylist(db execer, dialect *dbDialect, playlist *art.Playlist) error {
+	return replace(db, dialect, "playlists", []string{"artist_id", "artist_playlist_id"}, playlist,
+		playlist.ArtistId, playlist.ArtistPlaylistId)
+}
+
+// Playlists gets the artist's playlists indexed by ArtistPlaylistId.
+func (dbServer *DbServer) Playlists(artistID string) (map[string]*art.Playlist, error) {
+	messages, err := dbServer.selectArt("playlists", "artist_id = ?", newPlaylist, artistID)
+	if err != nil {
+		return nil, err
+	}
+	playlists := make(map[string]*art.Playlist)
+	for _, message := range messages {
+		playlist := message.(*art.Playlist)
+		playlists[playlist.ArtistPlaylistId] = playlist
+	}
+	return playlists, nil
+}
+
+// Playlist gets the artist's playlist with artistPlaylistID, or ErrArtNotFound if it is not stored.
+func (dbServer *DbServer) Playlist(artistID string, artistPlaylistID string) (*art.Playlist, error) {
+	messages, err := dbServer.selectArt("playlists", "artist_id = ? AND artist_playlist_id = ?", newPlaylist,
+		artistID, artistPlaylistID)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrArtNotFound
+	}
+	return messages[0].(*art.Playlist), nil
+}
+
+// StorePeer stores the peer, normalized, if it has the publisher's pubkey.
+func (dbServer *DbServer) StorePeer(peer *art.Peer, publisher Publisher) error {
+	peer = normalizePeer(peer)
+	publishingArtist, err := publisher.Artist()
+	if err != nil {
+		dbServer.logger.Error("failed to get publishing artist", "peer", peer.Pubkey, "error", err)
+		return err
+	}
+	if publishingArtist.Pubkey != peer.Pubkey {
+		dbServer.logger.Info("skip peer with another pubkey than the publishing artist's",
+			"peer", peer.Pubkey, "publishing_artist_id", publishingArtist.ArtistId)
+		return nil
+	}
+	previousPeer, err := dbServer.Peer(peer.Pubkey)
+	if err != nil && err != ErrPeerNotFound {
+		return err
+	}
+	stampUpdatedAt(previousPeer, peer, nowUnix())
+	return dbServer.putPeer(peer)
+}
+
+// DeletePeer removes the peer with pubkey, with its sync cursor, reputation, and bandwidth.
+func (dbServer *DbServer) DeletePeer(pubkey string) error {
+	tx, err := dbServer.db.Begin()
+	if err != nil {
+		return err
+	}
+	result, err := tx.Exec(dbServer.dialect.rebind("DELETE FROM peers WHERE pubkey = ?"), pubkey)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if deleted == 0 {
+		tx.Rollback()
+		return ErrPeerNotFound
+	}
+	for _, table := range []string{"sync_cursors", "peer_reputations", "peer_bandwidths"} {
+		_, err = tx.Exec(dbServer.dialect.rebind("DELETE FROM "+table+" WHERE pubkey = ?"), pubkey)
+		if err != nil {
+			dbServer.logger.Error("failed to delete peer records", "table", table, "peer", pubkey, "error", err)
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (dbServer *DbServer) putPeer(peer *art.Peer) error {
+	return replace(dbServer.db, dbServer.dialect, "peers", []string{"pubkey"}, peer, peer.Pubkey)
+}
+
+// Peers gets all the peers, page by page, indexed by pubkey.
+func (dbServer *DbServer) Peers() (map[string]*art.Peer, error) {
+	return collectPeers(dbServer)
+}
+
+// PeersPage gets the page of peers starting at offset, ordered by pubkey.
+func (dbServer *DbServer) PeersPage(offset int, limit int) ([]*art.Peer, error) {
+	messages, err := dbServer.selectArtPage("peers", "", "pubkey", offset, limit, newPeer)
+	if err != nil {
+		return nil, err
+	}
+	peers := make([]*art.Peer, len(messages))
+	for i, message := range messages {
+		peers[i] = message.(*art.Peer)
+	}
+	return peers, nil
+}
+
+func (dbServer *DbServer) Peer(pubkey string) (*art.Peer, error) {
+	messages, err := dbServer.selectArt("peers", "pubkey = ?", newPeer, pubkey)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrPeerNotFound
+	}
+	return messages[0].(*art.Peer), nil
+}
+
+// SyncCursor gets the AsOf time of the resources last synced from the peer with pubkey, or 0 if never synced.
+func (dbServer *DbServer) SyncCursor(pubkey string) (uint64, error) {
+	messages, err := dbServer.selectArt("sync_cursors", "pubkey = ?", newSyncCursor, pubkey)
+	if err != nil {
+		return 0, err
+	}
+	if len(messages) == 0 {
+		return 0, nil
+	}
+	return messages[0].(*art.SyncCursor).AsOf, nil
+}
+
+// StoreSyncCursor stores the AsOf time of the resources synced from the peer with pubkey.
+func (dbServer *DbServer) StoreSyncCursor(pubkey string, asOf uint64) error {
+	return replace(dbServer.db, dbServer.dialect, "sync_cursors", []string{"pubkey"},
+		&art.SyncCursor{Pubkey: pubkey, AsOf: asOf}, pubkey)
+}
+
+// PublicationSequence gets the Sequence of the latest publication validated from the artist with pubkey,
+// or 0 if none was.
+func (dbServer *DbServer) PublicationSequence(pubkey string) (uint64, error) {
+	messages, err := dbServer.selectArt("publication_sequences", "pubkey = ?", newPublicationSequence, pubkey)
+	if err != nil {
+		return 0, err
+	}
+	if len(messages) == 0 {
+		return 0, nil
+	}
+	return messages[0].(*art.PublicationSequence).Sequence, nil
+}
+
+// StorePublicationSequence stores the Sequence of the latest publication validated from the artist with pubkey.
+func (dbServer *DbServer) StorePublicationSequence(pubkey string, sequence uint64) error {
+	return replace(dbServer.db, dbServer.dialect, "publication_sequences", []string{"pubkey"},
+		&art.PublicationSequence{Pubkey: pubkey, Sequence: sequence}, pubkey)
+}
+
+// StoreTombstone stores the tombstone of a deleted track or album, replacing any earlier one of it.
+func (dbServer *DbServer) StoreTombstone(tombstone *art.Tombstone) error {
+	return replace(dbServer.db, dbServer.dialect, "tombstones",
+		[]string{"artist_id", "artist_album_id", "artist_track_id", "deleted_at"},
+		tombstone, tombstone.ArtistId, tombstone.ArtistAlbumId, tombstone.ArtistTrackId, tombstone.DeletedAt)
+}
+
+// Tombstones gets the stored tombstones in the order of sortTombstones.
+func (dbServer *DbServer) Tombstones() ([]*art.Tombstone, error) {
+	messages, err := dbServer.selectArt("tombstones", "", newTombstone)
+	if err != nil {
+		return nil, err
+	}
+	tombstones := make([]*art.Tombstone, len(messages))
+	for i, message := range messages {
+		tombstones[i] = message.(*art.Tombstone)
+	}
+	sortTombstones(tombstones)
+	return tombstones, nil
+}
+
+// DeleteExpiredTombstones deletes the tombstones of art deleted before deletedBefore.
+func (dbServer *DbServer) DeleteExpiredTombstones(deletedBefore uint64) error {
+	_, err := dbServer.db.Exec(dbServer.dialect.rebind("DELETE FROM tombstones WHERE deleted_at < ?"), deletedBefore)
+	return err
+}
+
+// PeerReputation gets the reputation of the peer with pubkey, which has no failures if none were stored.
+func (dbServer *DbServer) PeerReputation(pubkey string) (*art.PeerReputation, error) {
+	messages, err := dbServer.selectArt("peer_reputations", "pubkey = ?", newPeerReputation, pubkey)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return &art.PeerReputation{Pubkey: pubkey}, nil
+	}
+	return messages[0].(*art.PeerReputation), nil
+}
+
+// StorePeerReputation stores the reputation of a peer.
+func (dbServer *DbServer) StorePeerReputation(reputation *art.PeerReputation) error {
+	return replace(dbServer.db, dbServer.dialect, "peer_reputations", []string{"pubkey"}, reputation, reputation.Pubkey)
+}
+
+// PeerBandwidth gets the bytes served to the peer with pubkey, which are none if none were stored.
+func (dbServer *DbServer) PeerBandwidth(pubkey string) (*art.PeerBandwidth, error) {
+	messages, err := dbServer.selectArt("peer_bandwidths", "pubkey = ?", newPeerBandwidth, pubkey)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return &art.PeerBandwidth{Pubkey: pubkey}, nil
+	}
+	return messages[0].(*art.PeerBandwidth), nil
+}
+
+// StorePeerBandwidth stores the bytes served to a peer.
+func (dbServer *DbServer) StorePeerBandwidth(bandwidth *art.PeerBandwidth) error {
+	return replace(dbServer.db, dbServer.dialect, "peer_bandwidths", []string{"pubkey"}, bandwidth, bandwidth.Pubkey)
+}
+
+// trackStatsColumns are the columns of track_stats read into a TrackStats.
+// The counts are read from their columns, not the art, since AddTrackStats adds to the columns only.
+const trackStatsColumns = "artist_id, artist_track_id, plays, purchases, last_played_at"
+
+// queryTrackStats queries the trackStatsColumns of track_stats and scans each row into a TrackStats.
+func (dbServer *DbServer) queryTrackStats(query string, args ...interface{}) ([]*art.TrackStats, error) {
+	query = dbServer.dialect.rebind(query)
+	rows, err := dbServer.db.Query(query, args...)
+	if err != nil {
+		dbServer.logger.Error("failed to query track stats", "query", query, "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var trackStats []*art.TrackStats
+	for rows.Next() {
+		stats := &art.TrackStats{}
+		err = rows.Scan(&stats.ArtistId, &stats.ArtistTrackId, &stats.Plays, &stats.Purchases, &stats.LastPlayedAt)
+		if err != nil {
+			return nil, err
+		}
+		trackStats = append(trackStats, stats)
+	}
+	return trackStats, rows.Err()
+}
+
+// TrackStats gets the plays and purchases counted for a track, which are none if none were stored.
+func (dbServer *DbServer) TrackStats(artistID string, artistTrackID string) (*art.TrackStats, error) {
+	trackStats, err := dbServer.queryTrackStats(
+		"SELECT "+trackStatsColumns+" FROM track_stats WHERE artist_id = ? AND artist_track_id = ?",
+		artistID, artistTrackID)
+	if err != nil {
+		return nil, err
+	}
+	if len(trackStats) == 0 {
+		return &art.TrackStats{ArtistId: artistID, ArtistTrackId: artistTrackID}, nil
+	}
+	return trackStats[0], nil
+}
+
+// StoreTrackStats stores the plays and purchases counted for a track, with the counts in columns to order by.
+func (dbServer *DbServer) StoreTrackStats(stats *art.TrackStats) error {
+	return replace(dbServer.db, dbServer.dialect, "track_stats",
+		[]string{"artist_id", "artist_track_id", "plays", "purchases", "last_played_at"}, stats,
+		stats.ArtistId, stats.ArtistTrackId, stats.Plays, stats.Purchases, stats.LastPlayedAt)
+}
+
+// AddTrackStats adds the plays and purchases of stats to those stored for its track, keeping the later LastPlayedAt.
+// It adds them in sql so concurrent additions are each counted.
+func (dbServer *DbServer) AddTrackStats(stats *art.TrackStats) error {
+	addStatement := dbServer.dialect.rebind("UPDATE track_stats SET plays = plays + ?, purchases = purchases + ?, " +
+		"last_played_at = CASE WHEN last_played_at < ? THEN ? ELSE last_played_at END " +
+		"WHERE artist_id = ? AND artist_track_id = ?")
+	add := func() (bool, error) {
+		result, err := dbServer.db.Exec(addStatement, stats.Plays, stats.Purchases, stats.LastPlayedAt, stats.LastPlayedAt,
+			stats.ArtistId, stats.ArtistTrackId)
+		if err != nil {
+			return false, err
+		}
+		added, err := result.RowsAffected()
+		return added > 0, err
+	}
+	added, err := add()
+	if err != nil || added {
+		return err
+	}
+
+	data, err := proto.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	_, err = dbServer.db.Exec(dbServer.dialect.rebind("INSERT INTO track_stats "+
+		"(artist_id, artist_track_id, plays, purchases, last_played_at, art) VALUES (?, ?, ?, ?, ?, ?)"),
+		stats.ArtistId, stats.ArtistTrackId, stats.Plays, stats.Purchases, stats.LastPlayedAt, data)
+	if err == nil {
+		return nil
+	}
+	// The track's stats were stored since they were not found to add to, so add to those.
+	added, addErr := add()
+	if addErr != nil || !added {
+		dbServer.logger.Error("failed to add track stats",
+			"artist_id", stats.ArtistId, "track_id", stats.ArtistTrackId, "error", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteTrackStats deletes the stats of a track, if any.
+func (dbServer *DbServer) DeleteTrackStats(artistID string, artistTrackID string) error {
+	_, err := dbServer.db.Exec(dbServer.dialect.rebind("DELETE FROM track_stats WHERE artist_id = ? AND artist_track_id = ?"),
+		artistID, artistTrackID)
+	return err
+}
+
+// topTrackStatsOrder orders the most played tracks first, like topTrackStats.
+const topTrackStatsOrder = "plays DESC, purchases DESC, artist_id, artist_track_id"
+
+// TopTrackStats gets the stats of at most limit tracks, most played first, or of all if limit is negative.
+func (dbServer *DbServer) TopTrackStats(limit int) ([]*art.TrackStats, error) {
+	query := "SELECT " + trackStatsColumns + " FROM track_stats ORDER BY " + topTrackStatsOrder
+	if limit < 0 {
+		return dbServer.queryTrackStats(query)
+	}
+	return dbServer.queryTrackStats(query+" LIMIT ?", limit)
+}
+
+// StorePublication stores the publication and the artists, albums, tracks, and peers it publishes.
+// Of the peers, only the publishing node's own record and records already stored are stored.
+func (dbServer *DbServer) StorePublication(publication *art.ArtistPublication) error {
+	logger := dbServer.logger.With("artist_id", publication.Artist.ArtistId)
+
+	publishedResources, err := read(publication)
+	if err != nil {
+		logger.Error("failed to read publication", "error", err)
+		return err
+	}
+	now := nowUnix()
+	previousArtist, err := dbServer.Artist(publication.Artist.ArtistId)
+	if err != nil && err != ErrArtNotFound {
+		return err
+	}
+	stampUpdatedAt(previousArtist, publication.Artist, now)
+	err = keepVouchedPeers(dbServer, publication.Artist.Pubkey, publishedResources)
+	if err != nil {
+		return err
+	}
+	err = stampResources(dbServer, publishedResources, now)
+	if err != nil {
+		return err
+	}
+
+	tx, err := dbServer.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = storePublication(tx, dbServer.dialect, publication, publishedResources)
+	if err != nil {
+		logger.Error("failed to store publication", "error", err)
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// storePublication stores the publication and the resources it publishes in the transaction tx.
+func storePublication(tx execer, dialect *dbDialect, publication *art.ArtistPublication, resources *art.ArtResources) error {
+	err := replace(tx, dialect, "publications", []string{"artist_id", "pubkey"}, publication,
+		publication.Artist.ArtistId, publication.Artist.Pubkey)
+	if err != nil {
+		return err
+	}
+	// Drop the publications signed with the artist's old pubkeys, e.g. before a rotation.
+	_, err = tx.Exec(dialect.rebind("DELETE FROM publications WHERE artist_id = ? AND pubkey <> ?"),
+		publication.Artist.ArtistId, publication.Artist.Pubkey)
+	if err != nil {
+		return err
+	}
+	err = replaceArtist(tx, dialect, publication.Artist)
+	if err != nil {
+		return err
+	}
+	for _, artist := range resources.Artists {
+		err = replaceArtist(tx, dialect, artist)
+		if err != nil {
+			return err
+		}
+	}
+	for _, album := range resources.Albums {
+		err = replace(tx, dialect, "albums", []string{"artist_id", "artist_album_id"}, album,
+			album.ArtistId, album.ArtistAlbumId)
+		if err != nil {
+			return err
+		}
+	}
+	for _, track := range resources.Tracks {
+		err = replaceTrack(tx, dialect, track)
+		if err != nil {
+			return err
+		}
+	}
+	for _, peer := range resources.Peers {
+		err = replace(tx, dialect, "peers", []string{"pubkey"}, peer, peer.Pubkey)
+		if err != nil {
+			return err
+		}
+	}
+	for _, playlist := range resources.Playlists {
+		err = replacePlaylist(tx, dialect, playlist)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StoreIssuedInvoice stores the invoice, replacing any stored with its hash,
+// with when it expires and was settled in columns to delete those expired unpaid.
+func (dbServer *DbServer) StoreIssuedInvoice(invoice *art.IssuedInvoice) error {
+	return replace(dbServer.db, dbServer.dialect, "issued_invoices",
+		[]string{"invoice_hash", "expires_at", "settled_at"}, invoice,
+		issuedInvoiceKey(invoice.InvoiceHash), invoice.ExpiresAt, invoice.SettledAt)
+}
+
+// IssuedInvoice gets the invoice issued with invoiceHash, or ErrArtNotFound.
+func (dbServer *DbServer) IssuedInvoice(invoiceHash []byte) (*art.IssuedInvoice, error) {
+	messages, err := dbServer.selectArt("issued_invoices", "invoice_hash = ?", newIssuedInvoice,
+		issuedInvoiceKey(invoiceHash))
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrArtNotFound
+	}
+	return messages[0].(*art.IssuedInvoice), nil
+}
+
+// DeleteExpiredInvoices deletes the invoices never settled that expired before expiredBefore.
+func (dbServer *DbServer) DeleteExpiredInvoices(expiredBefore uint64) error {
+	_, err := dbServer.db.Exec(dbServer.dialect.rebind(
+		"DELETE FROM issued_invoices WHERE settled_at = 0 AND expires_at < ?"), expiredBefore)
+	return err
+}
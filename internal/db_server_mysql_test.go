@@ -0,0 +1,30 @@
+// +build mysql
+
+package audiostrike
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// TestMysqlServer runs the ArtServer conformance tests on DbServer with `go test -tags mysql`
+// against a local mysql db named austk_test that the audiostrike user may use without password.
+func TestMysqlServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk-mysql")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	runArtServerConformance(t, func() ArtServer {
+		dbCfg := *cfg
+		dbCfg.DbEngine = DbEngineMysql
+		dbCfg.DbHost = "localhost"
+		dbCfg.DbName = "austk_test"
+		dbCfg.DbUser = "audiostrike"
+		dbCfg.DbInit = true
+		dbCfg.ArtDir = dir
+		return newTestDbServer(t, &dbCfg)
+	})
+}
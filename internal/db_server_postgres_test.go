@@ -0,0 +1,30 @@
+// +build postgres
+
+package audiostrike
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// TestPostgresServer runs the ArtServer conformance tests on DbServer with `go test -tags postgres`
+// against a local postgres db named austk_test that the audiostrike user may use without password.
+func TestPostgresServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk-postgres")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	runArtServerConformance(t, func() ArtServer {
+		dbCfg := *cfg
+		dbCfg.DbEngine = DbEnginePostgres
+		dbCfg.DbHost = "localhost"
+		dbCfg.DbName = "austk_test"
+		dbCfg.DbUser = "audiostrike"
+		dbCfg.DbInit = true
+		dbCfg.ArtDir = dir
+		return newTestDbServer(t, &dbCfg)
+	})
+}
@@ -0,0 +1,201 @@
+package audiostrike
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+)
+
+func TestSqliteServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk-sqlite")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	runArtServerConformance(t, func() ArtServer {
+		serverDir, err := ioutil.TempDir(dir, "server")
+		if err != nil {
+			t.Fatalf("TempDir error: %v", err)
+		}
+		dbCfg := *cfg
+		dbCfg.DbEngine = DbEngineSqlite
+		dbCfg.DbFile = filepath.Join(serverDir, "austk.db")
+		dbCfg.DbInit = true
+		dbCfg.ArtDir = filepath.Join(serverDir, "art")
+		return newTestDbServer(t, &dbCfg)
+	})
+}
+
+// newTestDbServer opens a DbServer for dbCfg and closes it when the test finishes.
+func newTestDbServer(t *testing.T, dbCfg *Config) *DbServer {
+	dbServer, err := NewDbServer(dbCfg)
+	if err != nil {
+		t.Fatalf("NewDbServer error: %v", err)
+	}
+	t.Cleanup(func() { dbServer.Close() })
+	return dbServer
+}
+
+// TestMigrateSchema tests that a database with the first version of the schema
+// is migrated to the current version without losing its art.
+func TestMigrateSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk-sqlite")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	dbCfg := *cfg
+	dbCfg.DbEngine = DbEngineSqlite
+	dbCfg.DbFile = filepath.Join(dir, "austk.db")
+	dbCfg.ArtDir = filepath.Join(dir, "art")
+
+	_, err = NewDbServer(&dbCfg)
+	if err == nil {
+		t.Errorf("expected error opening a db without art tables or -dbinit")
+	}
+
+	// Store art in a version 1 database.
+	sqlite := dbDialects[DbEngineSqlite]
+	db, err := sql.Open(sqlite.driverName, dbCfg.DbFile)
+	if err != nil {
+		t.Fatalf("sql.Open error: %v", err)
+	}
+	err = migrateSchema(db, sqlite, 1)
+	if err != nil {
+		t.Fatalf("migrateSchema to version 1, error: %v", err)
+	}
+	artist := &art.Artist{ArtistId: mockArtistID, Name: "Alice the Artist", Pubkey: mockPubkey}
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID, Title: "Test Track"}
+	artistData, _ := proto.Marshal(artist)
+	trackData, _ := proto.Marshal(track)
+	_, err = db.Exec("INSERT INTO artists (artist_id, art) VALUES (?, ?)", artist.ArtistId, artistData)
+	if err != nil {
+		t.Fatalf("insert version 1 artist, error: %v", err)
+	}
+	_, err = db.Exec("INSERT INTO tracks (artist_id, artist_track_id, artist_album_id, art) VALUES (?, ?, ?, ?)",
+		track.ArtistId, track.ArtistTrackId, "", trackData)
+	if err != nil {
+		t.Fatalf("insert version 1 track, error: %v", err)
+	}
+	db.Close()
+
+	// Opening the database migrates it, and opening it again with -dbinit applies nothing more.
+	for _, isInit := range []bool{false, true} {
+		dbCfg.DbInit = isInit
+		dbServer := newTestDbServer(t, &dbCfg)
+		version, err := schemaVersion(dbServer.db)
+		if err != nil || version != len(dbMigrations) {
+			t.Errorf("expected schema version %d but got %d, error: %v", len(dbMigrations), version, err)
+		}
+		artists, err := dbServer.SearchArtists("alice")
+		if err != nil || len(artists) != 1 || !proto.Equal(artists[0], artist) {
+			t.Errorf("expected to find migrated artist %v but got %v, error: %v", artist, artists, err)
+		}
+		tracks, err := dbServer.SearchTracks("test", TrackFilter{})
+		if err != nil || len(tracks) != 1 || !proto.Equal(tracks[0], track) {
+			t.Errorf("expected to find migrated track %v but got %v, error: %v", track, tracks, err)
+		}
+		err = dbServer.StorePeerReputation(&art.PeerReputation{Pubkey: mockPubkey, FailureCount: 1})
+		if err != nil {
+			t.Errorf("StorePeerReputation after migration, error: %v", err)
+		}
+		dbServer.Close()
+	}
+}
+
+// TestPostgresStatements tests postgres upserts, and that every art table has its primary key in
+// dbPrimaryKeys so postgres upserts into it on conflict with that key.
+func TestPostgresStatements(t *testing.T) {
+	postgres := dbDialects[DbEnginePostgres]
+	statement := postgres.rebind(postgres.upsertStatement("tracks",
+		[]string{"artist_id", "artist_track_id", "artist_album_id", "art"}))
+	expected := "INSERT INTO tracks (artist_id, artist_track_id, artist_album_id, art) VALUES ($1, $2, $3, $4)" +
+		" ON CONFLICT (artist_id, artist_track_id) DO UPDATE SET artist_album_id = EXCLUDED.artist_album_id, art = EXCLUDED.art"
+	if statement != expected {
+		t.Errorf("expected %s but got %s", expected, statement)
+	}
+
+	statement = postgres.rebind(postgres.upsertStatement("peer_bandwidths", []string{"pubkey", "art"}))
+	expected = "INSERT INTO peer_bandwidths (pubkey, art) VALUES ($1, $2)" +
+		" ON CONFLICT (pubkey) DO UPDATE SET art = EXCLUDED.art"
+	if statement != expected {
+		t.Errorf("expected %s but got %s", expected, statement)
+	}
+
+	// Check the keys of every table in the migrated schema.
+	dir, err := ioutil.TempDir("", "austk-sqlite")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	sqlite := dbDialects[DbEngineSqlite]
+	db, err := sql.Open(sqlite.driverName, filepath.Join(dir, "austk.db"))
+	if err != nil {
+		t.Fatalf("sql.Open error: %v", err)
+	}
+	defer db.Close()
+	err = migrateSchema(db, sqlite, len(dbMigrations))
+	if err != nil {
+		t.Fatalf("migrateSchema error: %v", err)
+	}
+
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name != 'schema_version'")
+	if err != nil {
+		t.Fatalf("query tables, error: %v", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			t.Fatalf("scan table, error: %v", err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	if len(tables) == 0 {
+		t.Fatalf("expected migrated tables")
+	}
+
+	for _, table := range tables {
+		primaryKey, err := sqlitePrimaryKey(db, table)
+		if err != nil {
+			t.Fatalf("primary key of %s, error: %v", table, err)
+		}
+		keyColumns := dbPrimaryKeys[table]
+		if strings.Join(keyColumns, ", ") != strings.Join(primaryKey, ", ") {
+			t.Errorf("expected primary key %v of %s in dbPrimaryKeys but got %v", primaryKey, table, keyColumns)
+			continue
+		}
+		statement := postgres.upsertStatement(table, append(append([]string{}, keyColumns...), "art"))
+		onConflict := " ON CONFLICT (" + strings.Join(keyColumns, ", ") + ") DO UPDATE SET art = EXCLUDED.art"
+		if !strings.HasSuffix(statement, onConflict) {
+			t.Errorf("expected upsert into %s to end with%s but got %s", table, onConflict, statement)
+		}
+	}
+}
+
+// sqlitePrimaryKey returns the primary key columns of table in key order.
+func sqlitePrimaryKey(db *sql.DB, table string) ([]string, error) {
+	rows, err := db.Query("SELECT name, pk FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var columns []string
+	for rows.Next() {
+		var column string
+		var position int
+		if err := rows.Scan(&column, &position); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
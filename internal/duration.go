@@ -0,0 +1,53 @@
+package audiostrike
+
+import (
+	"fmt"
+	"time"
+)
+
+// samplesDuration gets the length of samples per channel at sampleRate.
+func samplesDuration(samples int64, sampleRate int64) time.Duration {
+	seconds := samples / sampleRate
+	remainder := samples % sampleRate
+	return time.Duration(seconds)*time.Second + time.Duration(remainder)*time.Second/time.Duration(sampleRate)
+}
+
+// decodedDuration decodes all of audio to count its samples,
+// for formats whose headers do not record the length of their audio, e.g. mp3.
+func decodedDuration(audio AudioFile) (time.Duration, error) {
+	streamer, format, err := audio.Decode()
+	if err != nil {
+		return 0, err
+	}
+	defer streamer.Close()
+	if format.SampleRate <= 0 {
+		return 0, fmt.Errorf("cannot count samples at %d Hz", format.SampleRate)
+	}
+
+	var length int64
+	samples := make([][2]float64, 4096)
+	for {
+		n, ok := streamer.Stream(samples)
+		length += int64(n)
+		if !ok {
+			break
+		}
+	}
+	err = streamer.Err()
+	if err != nil {
+		return 0, err
+	}
+	return samplesDuration(length, int64(format.SampleRate)), nil
+}
+
+// measureDuration measures the length of audio in milliseconds to record on its track.
+func measureDuration(audio AudioFile) (uint32, error) {
+	duration, err := audio.Duration()
+	if err != nil {
+		return 0, err
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("no audio to measure in %s", audio.Title())
+	}
+	return uint32(duration / time.Millisecond), nil
+}
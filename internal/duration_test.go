@@ -0,0 +1,166 @@
+package audiostrike
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// flacWithStreamInfo builds a flac file like flacWithComments whose STREAMINFO block records
+// the sample rate and total samples of its audio.
+func flacWithStreamInfo(sampleRate uint32, totalSamples uint64, comments ...string) []byte {
+	flac := flacWithComments(comments...)
+	streamInfo := flac[len(flacMagic)+4:]
+	streamInfo[10] = byte(sampleRate >> 12)
+	streamInfo[11] = byte(sampleRate >> 4)
+	streamInfo[12] = byte(sampleRate<<4) | 1<<1 // stereo, the low channel bit
+	streamInfo[13] = byte(totalSamples>>32) & 0x0f
+	binary.BigEndian.PutUint32(streamInfo[14:18], uint32(totalSamples))
+	return flac
+}
+
+// withGranule sets the granule position of an ogg page built by oggPage.
+func withGranule(page []byte, granule int64) []byte {
+	binary.LittleEndian.PutUint64(page[6:14], uint64(granule))
+	return page
+}
+
+// TestReadFlacDuration verifies that the duration of a flac file is read from its STREAMINFO block.
+func TestReadFlacDuration(t *testing.T) {
+	sampleRate, totalSamples, err := readFlacDuration(bytes.NewReader(flacWithStreamInfo(44100, 441000*30+22050)))
+	if err != nil || sampleRate != 44100 || totalSamples != 441000*30+22050 {
+		t.Errorf("expected %d samples at 44100 Hz but got %d at %d, error: %v", 441000*30+22050, totalSamples, sampleRate, err)
+	}
+	if duration := samplesDuration(totalSamples, sampleRate); duration != 300*time.Second+500*time.Millisecond {
+		t.Errorf("expected 300.5s but got %v", duration)
+	}
+
+	_, _, err = readFlacDuration(bytes.NewReader(flacWithComments("TITLE=Unknown rate")))
+	if err == nil {
+		t.Errorf("expected error reading duration without a sample rate")
+	}
+}
+
+// TestReadWavDuration verifies that the duration of a wav file is read from the lengths of its chunks
+// whichever order they are in.
+func TestReadWavDuration(t *testing.T) {
+	format := make([]byte, 16)
+	binary.LittleEndian.PutUint16(format[0:], 1)      // PCM
+	binary.LittleEndian.PutUint16(format[2:], 2)      // channels
+	binary.LittleEndian.PutUint32(format[4:], 44100)  // sample rate
+	binary.LittleEndian.PutUint32(format[8:], 176400) // byte rate
+	data := riffChunk("data", make([]byte, 176400*3/2))
+	tests := []struct {
+		name   string
+		chunks []byte
+	}{
+		{"fmt then data", append(riffChunk("fmt ", format), data...)},
+		{"data then fmt", append(append([]byte{}, data...), riffChunk("fmt ", format)...)},
+	}
+	for _, test := range tests {
+		wav := riffChunk(riffMagic, append([]byte(waveMagic), test.chunks...))
+		duration, err := readWavDuration(bytes.NewReader(wav))
+		if err != nil || duration != 1500*time.Millisecond {
+			t.Errorf("%s: expected 1.5s but got %v, error: %v", test.name, duration, err)
+		}
+	}
+
+	wav := riffChunk(riffMagic, append([]byte(waveMagic), riffChunk("fmt ", format)...))
+	_, err := readWavDuration(bytes.NewReader(wav))
+	if err == nil {
+		t.Errorf("expected error reading duration of wav without data")
+	}
+}
+
+// TestReadOggDuration verifies that the duration of an ogg file is read from the granule position of the last page
+// of its audio stream, less the pre-skip of an Opus stream, ignoring pages of other streams.
+func TestReadOggDuration(t *testing.T) {
+	vorbisIdentification := []byte(vorbisIdentificationHeader + "\x00\x00\x00\x00\x02")
+	vorbisIdentification = binary.LittleEndian.AppendUint32(vorbisIdentification, 44100)
+	opusIdentification := []byte(opusIdentificationHeader + "\x01\x02")
+	opusIdentification = binary.LittleEndian.AppendUint16(opusIdentification, 312)
+	tests := []struct {
+		codec          string
+		identification []byte
+		lastGranule    int64
+		expected       time.Duration
+	}{
+		{CodecVorbis, vorbisIdentification, 44100 * 90, 90 * time.Second},
+		{CodecOpus, opusIdentification, 312 + 48000*4 + 24000, 4500 * time.Millisecond},
+	}
+	for _, test := range tests {
+		var ogg bytes.Buffer
+		skeleton := []byte("fishead\x00")
+		ogg.Write(oggPage(7, oggBeginningOfStream, lacing(skeleton), skeleton))
+		ogg.Write(oggPage(1, oggBeginningOfStream, lacing(test.identification), test.identification))
+		audio := make([]byte, 100)
+		ogg.Write(withGranule(oggPage(1, 0, lacing(audio), audio), test.lastGranule/2))
+		ogg.Write(withGranule(oggPage(1, 0, lacing(audio), audio), -1))
+		ogg.Write(withGranule(oggPage(7, 0, lacing(audio), audio), test.lastGranule*10))
+		ogg.Write(withGranule(oggPage(1, 4, lacing(audio), audio), test.lastGranule))
+
+		duration, err := readOggDuration(&ogg)
+		if err != nil || duration != test.expected {
+			t.Errorf("expected %s duration %v but got %v, error: %v", test.codec, test.expected, duration, err)
+		}
+	}
+}
+
+// TestDecodedDuration verifies that the duration of audio whose headers lack it is counted by decoding it.
+func TestDecodedDuration(t *testing.T) {
+	audio := sineAudio{frequency: 440, amplitude: 0.5, sampleRate: 8000, channels: 2, length: 8000*7 + 2000}
+	duration, err := decodedDuration(audio)
+	if err != nil || duration != 7250*time.Millisecond {
+		t.Errorf("expected 7.25s but got %v, error: %v", duration, err)
+	}
+}
+
+// TestReanalyzeDuration verifies that reanalysis measures the duration of a stored track added without it
+// even if its loudness cannot be measured.
+func TestReanalyzeDuration(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	filename := filepath.Join(artDir, "Timed.flac")
+	flac := flacWithStreamInfo(48000, 48000*200+12, "ARTIST=Alice the Artist", "TITLE=Timed")
+	err = ioutil.WriteFile(filename, flac, 0644)
+	if err != nil {
+		t.Fatalf("WriteFile %s error: %v", filename, err)
+	}
+	_, _, err = austkServer.ImportAudioFile(filename)
+	if err != nil {
+		t.Fatalf("ImportAudioFile %s error: %v", filename, err)
+	}
+	storedTrack, err := fileServer.Track(mockArtistID, "timed")
+	if err != nil || storedTrack.DurationMs != 200000 {
+		t.Fatalf("expected 200000 ms measured at ingest but got %v, error: %v", storedTrack, err)
+	}
+	storedTrack.DurationMs = 0
+
+	measured, err := austkServer.ReanalyzeTracks()
+	if err != nil || measured != 1 {
+		t.Errorf("expected 1 track measured but got %d, error: %v", measured, err)
+	}
+	storedTrack, err = fileServer.Track(mockArtistID, "timed")
+	if err != nil || storedTrack.DurationMs != 200000 || storedTrack.Loudness != nil {
+		t.Errorf("expected 200000 ms and no loudness stored but got %v, error: %v", storedTrack, err)
+	}
+}
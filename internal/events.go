@@ -0,0 +1,234 @@
+package audiostrike
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Kinds of server events, logged with the key "event" to stream them from /events.
+const (
+	EventSyncStarted    = "sync_started"
+	EventSyncFinished   = "sync_finished"
+	EventInvoiceCreated = "invoice_created"
+	EventPaymentSettled = "payment_settled"
+	EventPeerAdded      = "peer_added"
+)
+
+const (
+	eventKey = "event"
+	// eventLogCapacity is how many recent events an EventLog keeps for streams that start or resume,
+	// and eventSubscriberQueue how many it queues for each stream before dropping the oldest.
+	eventLogCapacity     = 256
+	eventSubscriberQueue = 64
+	// eventKeepAlive is how often an idle event stream sends a comment.
+	eventKeepAlive = 30 * time.Second
+)
+
+// Event is a record logged with an "event" key: the kind of event, the log message, and its other attributes.
+type Event struct {
+	ID      uint64                 `json:"id"`
+	Time    time.Time              `json:"time"`
+	Kind    string                 `json:"event"`
+	Message string                 `json:"message"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// EventLog keeps the recent events logged through its Handler and streams them to subscribers.
+// A subscriber too slow to keep up loses its oldest unsent events rather than block logging.
+// It is safe for concurrent use.
+type EventLog struct {
+	mutex       sync.Mutex
+	recent      []Event
+	lastID      uint64
+	subscribers map[*eventSubscriber]bool
+}
+
+// eventSubscriber queues the events for one stream, counting those dropped since it last sent.
+type eventSubscriber struct {
+	events  chan Event
+	dropped int
+}
+
+// NewEventLog creates an EventLog keeping the last 256 events.
+func NewEventLog() *EventLog {
+	return &EventLog{subscribers: make(map[*eventSubscriber]bool)}
+}
+
+// publish keeps event, numbered after the last, and queues it for each subscriber.
+func (events *EventLog) publish(event Event) {
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+	events.lastID++
+	event.ID = events.lastID
+	if len(events.recent) >= eventLogCapacity {
+		events.recent = events.recent[1:]
+	}
+	events.recent = append(events.recent, event)
+	for subscriber := range events.subscribers {
+		select {
+		case subscriber.events <- event:
+		default:
+			// Drop the oldest queued event for the newest. Only publish adds to the queue, so then it has room.
+			select {
+			case <-subscriber.events:
+				subscriber.dropped++
+			default:
+			}
+			subscriber.events <- event
+		}
+	}
+}
+
+// subscribe gets the recent events after the event numbered afterID, and a subscriber queueing those to come.
+func (events *EventLog) subscribe(afterID uint64) ([]Event, *eventSubscriber) {
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+	var backlog []Event
+	for _, event := range events.recent {
+		if event.ID > afterID {
+			backlog = append(backlog, event)
+		}
+	}
+	subscriber := &eventSubscriber{events: make(chan Event, eventSubscriberQueue)}
+	events.subscribers[subscriber] = true
+	return backlog, subscriber
+}
+
+func (events *EventLog) unsubscribe(subscriber *eventSubscriber) {
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+	delete(events.subscribers, subscriber)
+}
+
+// takeDropped gets and resets how many events subscriber dropped.
+func (events *EventLog) takeDropped(subscriber *eventSubscriber) int {
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+	dropped := subscriber.dropped
+	subscriber.dropped = 0
+	return dropped
+}
+
+// Handler wraps next to also publish each record with an "event" key to the EventLog.
+// It publishes events at info level and above even if next logs only more severe records.
+func (events *EventLog) Handler(next slog.Handler) slog.Handler {
+	return &eventHandler{next: next, events: events}
+}
+
+// eventHandler is the slog.Handler of an EventLog, with the attributes added by Logger.With.
+type eventHandler struct {
+	next   slog.Handler
+	events *EventLog
+	attrs  []slog.Attr
+}
+
+func (handler *eventHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo || handler.next.Enabled(ctx, level)
+}
+
+func (handler *eventHandler) Handle(ctx context.Context, record slog.Record) error {
+	var kind string
+	attrs := make(map[string]interface{})
+	addAttr := func(attr slog.Attr) bool {
+		if attr.Key == eventKey {
+			kind = attr.Value.String()
+		} else {
+			attrs[attr.Key] = attr.Value.Resolve().Any()
+		}
+		return true
+	}
+	for _, attr := range handler.attrs {
+		addAttr(attr)
+	}
+	record.Attrs(addAttr)
+	if kind != "" {
+		if err, isError := attrs["error"].(error); isError {
+			attrs["error"] = err.Error()
+		}
+		handler.events.publish(Event{Time: record.Time, Kind: kind, Message: record.Message, Attrs: attrs})
+	}
+	if !handler.next.Enabled(ctx, record.Level) {
+		return nil
+	}
+	return handler.next.Handle(ctx, record)
+}
+
+func (handler *eventHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &eventHandler{
+		next:   handler.next.WithAttrs(attrs),
+		events: handler.events,
+		attrs:  append(append([]slog.Attr{}, handler.attrs...), attrs...),
+	}
+}
+
+// WithGroup groups the attributes logged next, though events keep them ungrouped.
+func (handler *eventHandler) WithGroup(name string) slog.Handler {
+	return &eventHandler{next: handler.next.WithGroup(name), events: handler.events, attrs: handler.attrs}
+}
+
+// eventsHandler streams the server's events as server-sent events, starting with the recent events
+// after the Last-Event-ID if the client resumes, and reporting how many events it dropped if it fell behind.
+func (server *AustkServer) eventsHandler(w http.ResponseWriter, req *http.Request) {
+	if server.events == nil {
+		http.Error(w, "event log not enabled", http.StatusNotFound)
+		return
+	}
+	flusher, isFlusher := w.(http.Flusher)
+	if !isFlusher {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	lastEventID, _ := strconv.ParseUint(req.Header.Get("Last-Event-ID"), 10, 64)
+	backlog, subscriber := server.events.subscribe(lastEventID)
+	defer server.events.unsubscribe(subscriber)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for _, event := range backlog {
+		if writeEvent(w, event) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event := <-subscriber.events:
+			if dropped := server.events.takeDropped(subscriber); dropped > 0 {
+				fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", dropped)
+			}
+			if writeEvent(w, event) != nil {
+				return
+			}
+		case <-keepAlive.C:
+			// Keep proxies, e.g. tor, from closing an idle stream.
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-req.Context().Done():
+			return
+		case <-server.quitChannel:
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes event to w as a server-sent event with its id, kind, and JSON.
+func writeEvent(w http.ResponseWriter, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Kind, data)
+	return err
+}
@@ -0,0 +1,107 @@
+package audiostrike
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestEventsStream verifies that /events refuses requests without the admin token or lnd macaroon,
+// and streams events logged before and after the admin connects, but not other log records.
+func TestEventsStream(t *testing.T) {
+	eventsCfg := *cfg
+	eventsCfg.AdminToken = "s3cr3t"
+	eventsCfg.Events = NewEventLog()
+	// Events are published even though the log shows only warnings.
+	eventsCfg.Logger = slog.New(eventsCfg.Events.Handler(slog.NewTextHandler(ioutil.Discard, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	austkServer, err := NewAustkServer(&eventsCfg, NewMemoryArtServer(), &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	httpServer := httptest.NewServer(austkServer.adminOnly(austkServer.eventsHandler))
+	defer httpServer.Close()
+	getEvents := func(header string, value string) *http.Response {
+		request, _ := http.NewRequest("GET", httpServer.URL+"/events", nil)
+		if header != "" {
+			request.Header.Set(header, value)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("GET /events error: %v", err)
+		}
+		return response
+	}
+
+	for _, auth := range [][2]string{{"", ""}, {"Authorization", "Bearer wrong"}, {MacaroonHeader, "00"}} {
+		response := getEvents(auth[0], auth[1])
+		response.Body.Close()
+		if response.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected %s %q refused but got %d", auth[0], auth[1], response.StatusCode)
+		}
+	}
+	lndMacaroon, err := macaroonFromFile(&eventsCfg)
+	if err != nil {
+		t.Fatalf("macaroonFromFile error: %v", err)
+	}
+	macaroonBytes, _ := lndMacaroon.MarshalBinary()
+	response := getEvents(MacaroonHeader, hex.EncodeToString(macaroonBytes))
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Errorf("expected lnd macaroon accepted but got %d", response.StatusCode)
+	}
+
+	austkServer.logger.Info("created invoice", "event", EventInvoiceCreated, "sats", 100)
+	austkServer.logger.Info("not an event")
+	response = getEvents("Authorization", "Bearer s3cr3t")
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected event stream but got %d %s", response.StatusCode, response.Header.Get("Content-Type"))
+	}
+	reader := bufio.NewReader(response.Body)
+	readEvent := func() string {
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("failed to read event: %v", err)
+			}
+			if line == "\n" {
+				return strings.Join(lines, "")
+			}
+			lines = append(lines, line)
+		}
+	}
+	event := readEvent()
+	if !strings.HasPrefix(event, "id: 1\nevent: invoice_created\n") || !strings.Contains(event, `"sats":100`) {
+		t.Errorf("expected invoice event logged before connecting but got %q", event)
+	}
+	austkServer.logger.With("peer", mockPubkey).Info("discover gossiped peer", "event", EventPeerAdded)
+	event = readEvent()
+	if !strings.HasPrefix(event, "id: 2\nevent: peer_added\n") || !strings.Contains(event, mockPubkey) {
+		t.Errorf("expected peer event logged while connected but got %q", event)
+	}
+}
+
+// TestEventLogDropsOldest verifies that a subscriber too slow to keep up loses its oldest queued events.
+func TestEventLogDropsOldest(t *testing.T) {
+	events := NewEventLog()
+	_, subscriber := events.subscribe(0)
+	for i := 0; i < eventSubscriberQueue+2; i++ {
+		events.publish(Event{Kind: EventSyncStarted})
+	}
+	if dropped := events.takeDropped(subscriber); dropped != 2 {
+		t.Errorf("expected 2 events dropped but got %d", dropped)
+	}
+	if event := <-subscriber.events; event.ID != 3 {
+		t.Errorf("expected oldest queued event 3 but got %d", event.ID)
+	}
+	backlog, _ := events.subscribe(eventSubscriberQueue)
+	if len(backlog) != 2 {
+		t.Errorf("expected 2 recent events after the last seen but got %d", len(backlog))
+	}
+}
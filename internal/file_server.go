@@ -2,19 +2,28 @@ package audiostrike
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"fmt"
 	art "github.com/audiostrike/music/pkg/art"
 	"github.com/golang/protobuf/proto"
+	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 )
 
+// FileServer stores art in files under rootPath, and track payloads under payloadDir, and indexes the art in memory.
+// All its methods are safe for concurrent use: its indexes are locked while read or written,
+// maps of art are copied before returning, and stored art is replaced rather than updated in place,
+// so that art returned to one goroutine does not change while another stores art.
 type FileServer struct {
 	rootPath string
+	// payloadDir is the directory of the track payload files, e.g. on a bigger volume than rootPath.
+	payloadDir string
 	// peers indexed by pubkey
 	peers map[string]*art.Peer
 	// artists indexed by ArtistId
@@ -25,6 +34,30 @@ type FileServer struct {
 	tracks map[string]map[string]*art.Track
 	// tracks indexed by ArtistId then by ArtistAlbumId then by AlbumTrackNumber
 	albumTracks map[string]map[string]map[uint32]*art.Track
+	// playlists indexed by ArtistId then by ArtistPlaylistId
+	playlists map[string]map[string]*art.Playlist
+	// syncCursors indexed by peer pubkey, saved in the .sync file of rootPath
+	syncCursors map[string]*art.SyncCursor
+	// publicationSequences indexed by artist pubkey, saved in the .sequence file of rootPath
+	publicationSequences map[string]*art.PublicationSequence
+	// tombstones indexed by tombstoneKey, saved in the .tombstone file of rootPath
+	tombstones map[string]*art.Tombstone
+	// peerReputations indexed by peer pubkey, saved in the .reputation file of rootPath
+	peerReputations map[string]*art.PeerReputation
+	// peerBandwidths indexed by peer pubkey, saved in the .bandwidth file of rootPath
+	peerBandwidths map[string]*art.PeerBandwidth
+	// trackStats indexed by artist id and track id joined by a slash, saved in the .stats file of rootPath
+	trackStats map[string]*art.TrackStats
+	// issuedInvoices indexed by hex invoice hash, saved in the .invoices file of rootPath
+	issuedInvoices map[string]*art.IssuedInvoice
+
+	// mutex locks the maps above and the .sync, .sequence, .tombstone, .reputation, .bandwidth, .stats,
+	// and .invoices files saved from them.
+	mutex sync.RWMutex
+	// publicationMutex serializes StorePublication, which merges the resources it saves with the .art file.
+	publicationMutex sync.Mutex
+
+	logger *slog.Logger
 }
 
 const (
@@ -36,56 +69,121 @@ const (
 )
 
 var (
-	artistDirRegexp      *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")$")
-	artistFileRegexp     *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")/(?P<file>" + hierarchyRegex + ")$")
-	artistArtFileRegexp  *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")/[.]art$")
-	artistPubFileRegexp  *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")/(?P<Pubkey>" + hexValueRegex + ")[.]pub$")
-	artistTrackMp3Regexp *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")/(?P<ArtistTrackID>" + hierarchyRegex + ")[.]mp3$")
-	albumDirRegexp       *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")/(?P<album>" + hierarchyRegex + ")$")
-	albumFileRegexp      *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")/(?P<album>" + hierarchyRegex + ")/(?P<file>" + simpleIDRegex + ")$")
+	artistDirRegexp            *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")$")
+	artistFileRegexp           *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")/(?P<file>" + hierarchyRegex + ")$")
+	artistArtFileRegexp        *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")/[.]art$")
+	artistPubFileRegexp        *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")/(?P<Pubkey>" + hexValueRegex + ")[.]pub$")
+	atomicTempFileRegexp       *regexp.Regexp = regexp.MustCompile("[.]tmp[0-9]+$")
+	artistTrackPayloadRegexp   *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")/(?P<ArtistTrackID>" + hierarchyRegex + ")[.](?P<Container>mp3|flac|ogg|wav)$")
+	artistPartialPayloadRegexp *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")/(?P<ArtistTrackID>" + hierarchyRegex + ")[.](?P<Container>mp3|flac|ogg|wav)[.]part$")
+	albumDirRegexp             *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")/(?P<album>" + hierarchyRegex + ")$")
+	albumFileRegexp            *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")/(?P<album>" + hierarchyRegex + ")/(?P<file>" + simpleIDRegex + ")$")
+	albumArtFileRegexp         *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")/(?P<album>" + hierarchyRegex + ")/[.]cover$")
+	trackPreviewFileRegexp     *regexp.Regexp = regexp.MustCompile("^/(?P<ArtistID>" + simpleIDRegex + ")/(?P<ArtistTrackID>" + hierarchyRegex + ")[.]preview$")
+
+	// simpleIDRegexp and hierarchyRegexp check ids joined into paths. They ignore case, which cannot escape a directory,
+	// to keep art stored with upper-case ids by earlier versions.
+	simpleIDRegexp  *regexp.Regexp = regexp.MustCompile("(?i)^" + simpleIDRegex + "$")
+	hierarchyRegexp *regexp.Regexp = regexp.MustCompile("(?i)^" + hierarchyRegex + "$")
 )
 
 // NewFileServer creates a new FileServer to save and serve art in sudirectories of artDirPath.
 func NewFileServer(artDirPath string) (*FileServer, error) {
-	const logPrefix = "NewFileServer "
+	return NewFileServerWithPayloadDir(artDirPath, artDirPath)
+}
 
+// NewFileServerWithPayloadDir creates a new FileServer to save and serve art in subdirectories of artDirPath,
+// except the track payloads, which it saves in subdirectories of payloadDirPath.
+func NewFileServerWithPayloadDir(artDirPath string, payloadDirPath string) (*FileServer, error) {
 	fileServer := FileServer{
 		rootPath:    artDirPath,
+		payloadDir:  payloadDirPath,
 		artists:     make(map[string]*art.Artist),
 		tracks:      make(map[string]map[string]*art.Track),
 		albums:      make(map[string]map[string]*art.Album),
 		albumTracks: make(map[string]map[string]map[uint32]*art.Track),
+		playlists:   make(map[string]map[string]*art.Playlist),
 		peers:       make(map[string]*art.Peer),
+		syncCursors: make(map[string]*art.SyncCursor),
+
+		publicationSequences: make(map[string]*art.PublicationSequence),
+		tombstones:           make(map[string]*art.Tombstone),
+
+		peerReputations: make(map[string]*art.PeerReputation),
+		peerBandwidths:  make(map[string]*art.PeerBandwidth),
+		trackStats:      make(map[string]*art.TrackStats),
+		issuedInvoices:  make(map[string]*art.IssuedInvoice),
+
+		logger: componentLogger("fileServer"),
 	}
 
 	_ = os.MkdirAll(artDirPath, 0755)
+	_ = os.MkdirAll(payloadDirPath, 0755)
 
-	err := filepath.Walk(artDirPath, fileServer.readFile)
+	err := fileServer.readSyncCursors()
+	if err != nil {
+		fileServer.logger.Error("failed to read sync cursors", "path", fileServer.syncPath(), "error", err)
+		return nil, err
+	}
+	err = fileServer.readPublicationSequences()
+	if err != nil {
+		fileServer.logger.Error("failed to read publication sequences", "path", fileServer.sequencePath(), "error", err)
+		return nil, err
+	}
+	err = fileServer.readTombstones()
+	if err != nil {
+		fileServer.logger.Error("failed to read tombstones", "path", fileServer.tombstonePath(), "error", err)
+		return nil, err
+	}
+	err = fileServer.readPeerReputations()
+	if err != nil {
+		fileServer.logger.Error("failed to read peer reputations", "path", fileServer.reputationPath(), "error", err)
+		return nil, err
+	}
+	err = fileServer.readPeerBandwidths()
 	if err != nil {
-		log.Fatalf(logPrefix+"Failed to read art directory, error: %v", err)
+		fileServer.logger.Error("failed to read peer bandwidths", "path", fileServer.bandwidthPath(), "error", err)
 		return nil, err
 	}
+	err = fileServer.readTrackStats()
+	if err != nil {
+		fileServer.logger.Error("failed to read track stats", "path", fileServer.statsPath(), "error", err)
+		return nil, err
+	}
+	err = fileServer.readIssuedInvoices()
+	if err != nil {
+		fileServer.logger.Error("failed to read issued invoices", "path", fileServer.invoicesPath(), "error", err)
+		return nil, err
+	}
+
+	err = filepath.Walk(artDirPath, fileServer.readFile)
+	if err != nil {
+		fileServer.logger.Error("failed to read art directory", "path", artDirPath, "error", err)
+		return nil, fmt.Errorf("failed to read art directory %s: %w", artDirPath, err)
+	}
 	return &fileServer, nil
 }
 
 func (fileServer *FileServer) readFile(prefixedPath string, fileInfo os.FileInfo, err error) error {
-	const logPrefix = "FileServer readFile "
-
+	if err != nil {
+		return err
+	}
+	logger := fileServer.logger.With("path", prefixedPath)
 	if !strings.HasPrefix(prefixedPath, fileServer.rootPath) {
-		log.Printf(logPrefix+"path %s lacks expected prefix %s", prefixedPath, fileServer.rootPath)
+		logger.Warn("path lacks expected prefix", "prefix", fileServer.rootPath)
 		return filepath.SkipDir
 	}
 	relativePath := prefixedPath[len(fileServer.rootPath):]
 
 	if fileInfo.IsDir() {
 		if relativePath == "" {
-			log.Printf(logPrefix+"processing root path %s", prefixedPath)
+			logger.Debug("read root directory")
 			return nil
 		}
 		if artistDirRegexp.MatchString(relativePath) {
 			artistDirMatchGroups := artistDirRegexp.FindStringSubmatch(relativePath)
 			artistID := artistDirMatchGroups[1]
-			log.Printf(logPrefix+"processing artist %s dir %s", artistID, prefixedPath)
+			logger.Debug("read artist directory", "artist_id", artistID)
 			return nil
 		}
 
@@ -93,22 +191,23 @@ func (fileServer *FileServer) readFile(prefixedPath string, fileInfo os.FileInfo
 			albumDirMatchGroups := albumDirRegexp.FindStringSubmatch(relativePath)
 			artistID := albumDirMatchGroups[1]
 			artistAlbumID := albumDirMatchGroups[2]
-			log.Printf(logPrefix+"processing dir %s for artist %s, album %s", prefixedPath, artistID, artistAlbumID)
+			logger.Debug("read album directory", "artist_id", artistID, "album_id", artistAlbumID)
 			return nil
 		}
-		log.Printf(logPrefix+"unexpected directory %s does not look like an artist or album directory", prefixedPath)
+		logger.Warn("skip unexpected directory that does not look like an artist or album directory")
 		return filepath.SkipDir
 	}
 
 	// All the files to read are owned by the Artist whose artistID is the file's directory name.
 	// Identify that artistID by the name of the directory.
 	if !artistFileRegexp.MatchString(relativePath) {
-		log.Printf(logPrefix+"skip non-artist file: %s", prefixedPath)
+		logger.Debug("skip non-artist file")
 		return nil
 	}
 	artistFileMatchGroups := artistFileRegexp.FindStringSubmatch(relativePath)
 	artistID := artistFileMatchGroups[1]
-	log.Printf(logPrefix+"reading file %s for artist %s", relativePath, artistID)
+	logger = logger.With("artist_id", artistID)
+	logger.Debug("read artist file")
 
 	// if this is the [pubkey].pub file
 	if artistPubFileRegexp.MatchString(relativePath) {
@@ -120,25 +219,32 @@ func (fileServer *FileServer) readFile(prefixedPath string, fileInfo os.FileInfo
 				pubFileArtistID, prefixedPath, artistID)
 		}
 		pubkey := pubFileMatchGroups[2]
-		log.Printf(logPrefix+"pub file %s for artistId: %s, pubkey: %s}", prefixedPath, artistID, pubkey)
+		logger = logger.With("pubkey", pubkey)
 
+		// The artist's .art file has the published resources with the times this server updated them,
+		// so index the resources from the signed publication only if the .art file is missing.
+		_, err := os.Stat(filepath.Join(fileServer.rootPath, artistID, ".art"))
+		if err == nil {
+			logger.Debug("skip publication indexed from .art file")
+			return nil
+		}
 		publication, err := fileServer.readPublication(artistID, pubkey, prefixedPath)
 		if err != nil {
-			log.Fatalf("failed to read artist %s publication %s, error: %v", artistID, prefixedPath, err)
+			logger.Error("failed to read publication", "error", err)
 			return err
 		}
 		resources, err := read(publication)
 		if err != nil {
-			log.Printf(logPrefix+"failed to read resources from publication, error: %v", err)
+			logger.Error("failed to read resources from publication", "error", err)
 			return err
 		}
 		err = fileServer.indexResources(resources)
 		if err != nil {
-			log.Printf(logPrefix+"failed to index resources from publication, error: %v", err)
+			logger.Error("failed to index resources from publication", "error", err)
 			return err
 		}
 
-		log.Printf(logPrefix+"read and indexed resources from publication at %s", relativePath)
+		logger.Debug("indexed resources from publication")
 		return nil
 	}
 
@@ -154,28 +260,53 @@ func (fileServer *FileServer) readFile(prefixedPath string, fileInfo os.FileInfo
 
 		err := fileServer.readArtFile(artistID, prefixedPath)
 		if err != nil {
-			log.Fatalf("failed to read artist %s resources %s, error: %v", artistID, prefixedPath, err)
+			logger.Error("failed to read .art file", "error", err)
 			return err
 		}
 
 		return nil
 	}
 
-	// Finally, check whether this is an .mp3 file published by the artist.
-	if artistTrackMp3Regexp.MatchString(relativePath) {
-		artistTrackMp3MatchGroups := artistTrackMp3Regexp.FindStringSubmatch(relativePath)
+	// Remove a temporary file left by a write interrupted before it replaced its file.
+	if atomicTempFileRegexp.MatchString(relativePath) {
+		logger.Warn("remove temporary file of interrupted write")
+		return os.Remove(prefixedPath)
+	}
+
+	// Skip the partial payload of a track whose download may yet be resumed.
+	if artistPartialPayloadRegexp.MatchString(relativePath) {
+		logger.Debug("skip partial download")
+		return nil
+	}
+
+	// Skip the cover art of an album, which AlbumArt reads when requested.
+	if albumArtFileRegexp.MatchString(relativePath) {
+		logger.Debug("skip album cover art", "album_id", albumArtFileRegexp.FindStringSubmatch(relativePath)[2])
+		return nil
+	}
+
+	// Skip the preview clip of a track, which TrackPreview reads when requested.
+	if trackPreviewFileRegexp.MatchString(relativePath) {
+		logger.Debug("skip track preview", "track_id", trackPreviewFileRegexp.FindStringSubmatch(relativePath)[2])
+		return nil
+	}
+
+	// Finally, check whether this is an .mp3, .flac, .ogg, or .wav file published by the artist.
+	if artistTrackPayloadRegexp.MatchString(relativePath) {
+		artistTrackPayloadMatchGroups := artistTrackPayloadRegexp.FindStringSubmatch(relativePath)
 		// trackID may be simple identifier composed of letters, numbers, periods, and dashes,
 		// or it may optionally include album or other slash-separated hierarchy.
 		// Optionally order tracks and albums with numeric prefixes.
-		trackID := artistTrackMp3MatchGroups[2]
+		trackID := artistTrackPayloadMatchGroups[2]
 		track, err := fileServer.Track(artistID, trackID)
-		if err != nil {
-			log.Printf(logPrefix+"failed to retrieve artist %s track %s for file %s, error: %v",
-				artistID, trackID, relativePath, err)
+		if err == ErrArtNotFound {
+			logger.Info("skip payload of unpublished track", "track_id", trackID)
+			return nil
+		} else if err != nil {
+			logger.Error("failed to get track for payload", "track_id", trackID, "error", err)
 			return err
 		}
-		log.Printf(logPrefix+"matched mp3 %s as track %v",
-			prefixedPath, track)
+		logger.Debug("matched track payload", "track_id", track.ArtistTrackId, "container", artistTrackPayloadMatchGroups[3])
 	} else {
 		return fmt.Errorf("Unknown file type: %s", prefixedPath)
 	}
@@ -183,8 +314,10 @@ func (fileServer *FileServer) readFile(prefixedPath string, fileInfo os.FileInfo
 }
 
 // savePublishedResources saves an .art file with the given resources and a .pub file with the given publication.
+// The resources may be stamped with update times or merged with resources published earlier, so they may differ
+// from the resources serialized and signed in the publication.
 func (fileServer *FileServer) savePublishedResources(publication *art.ArtistPublication, resources *art.ArtResources) error {
-	const logPrefix = "FileServer savePublishedResources "
+	logger := fileServer.logger.With("artist_id", publication.Artist.ArtistId)
 
 	// Ensure that this artist has a directory.
 	artistDirectory := filepath.Join(fileServer.rootPath, publication.Artist.ArtistId)
@@ -194,14 +327,19 @@ func (fileServer *FileServer) savePublishedResources(publication *art.ArtistPubl
 	artPath := fileServer.artPath(publication.Artist)
 	_, err := os.Stat(artPath)
 	if os.IsNotExist(err) {
-		log.Printf(logPrefix+"publishing %v to %s", resources, artPath)
+		logger.Debug("publish resources", "path", artPath, "resources", resources)
 	} else {
-		log.Printf(logPrefix+"republishing %v to %s", resources, artPath)
+		logger.Debug("republish resources", "path", artPath, "resources", resources)
 	}
 
-	err = ioutil.WriteFile(artPath, publication.SerializedArtResources, 0644)
+	marshaledResources, err := proto.Marshal(resources)
 	if err != nil {
-		log.Printf(logPrefix+"failed to write resources to %s, error: %v", artPath, err)
+		logger.Error("failed to marshal resources", "error", err)
+		return err
+	}
+	err = ioutil.WriteFile(artPath, marshaledResources, 0644)
+	if err != nil {
+		logger.Error("failed to write resources", "path", artPath, "error", err)
 		return err
 	}
 
@@ -209,74 +347,152 @@ func (fileServer *FileServer) savePublishedResources(publication *art.ArtistPubl
 	// Verify that the .art file saved successfully.
 	publishedBytes, err := ioutil.ReadFile(artPath)
 	if err != nil {
-		log.Printf(logPrefix+"failed to read resources from %s, error: %v", artPath, err)
+		logger.Error("failed to read resources", "path", artPath, "error", err)
 		return err
 	}
-	if bytes.Compare(publishedBytes, publication.SerializedArtResources) != 0 {
-		log.Fatalf(logPrefix+"mismatched bytes, published at %s: %v, serialized: %v",
-			artPath, publishedBytes, publication.SerializedArtResources)
-		return fmt.Errorf("bytes on disk out of sync")
+	if bytes.Compare(publishedBytes, marshaledResources) != 0 {
+		logger.Error("resources on disk do not match the serialized resources", "path", artPath)
+		return fmt.Errorf("bytes on disk out of sync at %s", artPath)
 	}
 
 	// Write the signed publication to the artist's [pubkey].pub file.
 	marshaledPublication, err := proto.Marshal(publication)
 	if err != nil {
-		log.Printf(logPrefix+"failed to marshal %v, error: %v", publication, err)
+		logger.Error("failed to marshal publication", "error", err)
 		return err
 	}
 
-	pubPath := fileServer.publicationPath(publication.Artist)
+	pubPath, err := fileServer.publicationPath(publication.Artist)
+	if err != nil {
+		logger.Error("no publication path", "error", err)
+		return err
+	}
 	err = ioutil.WriteFile(pubPath, marshaledPublication, 0644)
 	if err != nil {
-		log.Printf(logPrefix+"failed to write publication to %s, error: %v", pubPath, err)
+		logger.Error("failed to write publication", "path", pubPath, "error", err)
+		return err
+	}
+
+	// Remove the publications signed with the artist's old pubkeys, e.g. before a rotation,
+	// so none is indexed instead of this one without the .art file.
+	pubPaths, err := filepath.Glob(filepath.Join(filepath.Dir(pubPath), "*.pub"))
+	if err != nil {
 		return err
 	}
+	for _, oldPubPath := range pubPaths {
+		if oldPubPath == pubPath {
+			continue // to next publication
+		}
+		err = os.Remove(oldPubPath)
+		if err != nil && !os.IsNotExist(err) {
+			logger.Error("failed to remove publication with old pubkey", "path", oldPubPath, "error", err)
+			return err
+		}
+	}
 
 	return nil
 }
 
 func (fileServer *FileServer) readPublication(artistID string, pubkey string, publicationPath string) (*art.ArtistPublication, error) {
-	const logPrefix = "FileServer readPublication "
-
 	publishedData, err := ioutil.ReadFile(publicationPath)
 	if err != nil {
-		log.Printf(logPrefix+"ReadFile %s error: %v", publicationPath, err)
 		return nil, err
 	}
 
 	publication := art.ArtistPublication{}
 	err = proto.Unmarshal(publishedData, &publication)
 	if err != nil {
-		log.Printf(logPrefix+"failed to unmarshal publication, error: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("malformed publication %s: %w", publicationPath, err)
 	}
 
 	return &publication, err
 }
 
-func (fileServer *FileServer) readArtFile(artistID string, artFilePath string) error {
-	const logPrefix = "FileServer readArtFile "
+// readSavedResources reads the resources saved in the .art file of artist, if any.
+func (fileServer *FileServer) readSavedResources(artist *art.Artist) (*art.ArtResources, error) {
+	resources := art.ArtResources{}
+	artData, err := ioutil.ReadFile(fileServer.artPath(artist))
+	if os.IsNotExist(err) {
+		return &resources, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = proto.Unmarshal(artData, &resources)
+	if err != nil {
+		return nil, err
+	}
+	return &resources, nil
+}
 
+func (fileServer *FileServer) readArtFile(artistID string, artFilePath string) error {
 	artData, err := ioutil.ReadFile(artFilePath)
 	if err != nil {
-		log.Printf(logPrefix+"ReadFile %s, error: %v", artFilePath, err)
 		return err
 	}
 
 	resources := art.ArtResources{}
 	err = proto.Unmarshal(artData, &resources)
 	if err != nil {
-		return err
+		return fmt.Errorf("malformed art file %s: %w", artFilePath, err)
 	}
 
-	return fileServer.indexResources(&resources)
+	return fileServer.indexResources(fileServer.withoutSelfPublishedArt(artistID, &resources))
+}
+
+// withoutSelfPublishedArt gets the resources from the .art file of the artist with artistID without the art
+// of other artists that have their own .art file. That file has their art as they last published it,
+// and this one may have an older copy, e.g. from a publication of all a node's art by the node's artist.
+func (fileServer *FileServer) withoutSelfPublishedArt(artistID string, resources *art.ArtResources) *art.ArtResources {
+	isSelfPublished := make(map[string]bool)
+	isKept := func(recordArtistID string) bool {
+		if recordArtistID == artistID {
+			return true
+		}
+		selfPublished, isChecked := isSelfPublished[recordArtistID]
+		if !isChecked {
+			_, err := os.Stat(filepath.Join(fileServer.rootPath, recordArtistID, ".art"))
+			selfPublished = err == nil
+			isSelfPublished[recordArtistID] = selfPublished
+		}
+		return !selfPublished
+	}
+	keptResources := &art.ArtResources{AsOf: resources.AsOf, Peers: resources.Peers}
+	for _, artist := range resources.Artists {
+		if isKept(artist.ArtistId) {
+			keptResources.Artists = append(keptResources.Artists, artist)
+		}
+	}
+	for _, album := range resources.Albums {
+		if isKept(album.ArtistId) {
+			keptResources.Albums = append(keptResources.Albums, album)
+		}
+	}
+	for _, track := range resources.Tracks {
+		if isKept(track.ArtistId) {
+			keptResources.Tracks = append(keptResources.Tracks, track)
+		}
+	}
+	for _, playlist := range resources.Playlists {
+		if isKept(playlist.ArtistId) {
+			keptResources.Playlists = append(keptResources.Playlists, playlist)
+		}
+	}
+	return keptResources
 }
 
 func (fileServer *FileServer) Artists() (map[string]*art.Artist, error) {
-	return fileServer.artists, nil
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	artists := make(map[string]*art.Artist, len(fileServer.artists))
+	for artistID, artist := range fileServer.artists {
+		artists[artistID] = artist
+	}
+	return artists, nil
 }
 
 func (fileServer *FileServer) Artist(artistID string) (*art.Artist, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
 	artist := fileServer.artists[artistID]
 	if artist == nil {
 		return nil, ErrArtNotFound
@@ -284,21 +500,58 @@ func (fileServer *FileServer) Artist(artistID string) (*art.Artist, error) {
 	return artist, nil
 }
 
+// SearchArtists gets the artists whose names contain query, ignoring case, ordered by name.
+func (fileServer *FileServer) SearchArtists(query string) ([]*art.Artist, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	return searchArtists(fileServer.artists, query), nil
+}
+
 func (fileServer *FileServer) Albums(artistId string) (map[string]*art.Album, error) {
-	albums, found := fileServer.albums[artistId]
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	artistAlbums, found := fileServer.albums[artistId]
 	if !found {
-		// Read album info from file system.
-		fmt.Errorf("not implemented")
+		return nil, nil
+	}
+	albums := make(map[string]*art.Album, len(artistAlbums))
+	for albumID, album := range artistAlbums {
+		albums[albumID] = album
 	}
-
 	return albums, nil
 }
 
+// AlbumsPage gets the page of the artist's albums starting at offset, ordered by ArtistAlbumId.
+func (fileServer *FileServer) AlbumsPage(artistID string, offset int, limit int) ([]*art.Album, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	return pageAlbums(fileServer.albums[artistID], offset, limit), nil
+}
+
+// TracksPage gets the page of the artist's tracks starting at offset, ordered by ArtistTrackId.
+func (fileServer *FileServer) TracksPage(artistID string, offset int, limit int) ([]*art.Track, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	return pageTracks(fileServer.tracks[artistID], offset, limit), nil
+}
+
 func (fileServer *FileServer) Tracks(artistID string) (map[string]*art.Track, error) {
-	return fileServer.tracks[artistID], nil
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	artistTracks, found := fileServer.tracks[artistID]
+	if !found {
+		return nil, nil
+	}
+	tracks := make(map[string]*art.Track, len(artistTracks))
+	for trackID, track := range artistTracks {
+		tracks[trackID] = track
+	}
+	return tracks, nil
 }
 
 func (fileServer *FileServer) AlbumTracks(artistID string, albumID string) (map[uint32]*art.Track, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
 	albumTracksForArtist := fileServer.albumTracks[artistID]
 	if albumTracksForArtist == nil {
 		return nil, ErrArtNotFound
@@ -307,45 +560,74 @@ func (fileServer *FileServer) AlbumTracks(artistID string, albumID string) (map[
 	if tracksForArtistAlbum == nil {
 		return nil, ErrArtNotFound
 	}
-	return tracksForArtistAlbum, nil
+	tracks := make(map[uint32]*art.Track, len(tracksForArtistAlbum))
+	for trackNumber, track := range tracksForArtistAlbum {
+		tracks[trackNumber] = track
+	}
+	return tracks, nil
 }
 
 // StorePublication saves a file with the published artist details, albums, tracks, and peers.
+// Of the peers, only the publishing node's own record and records already stored are saved.
 func (fileServer *FileServer) StorePublication(publication *art.ArtistPublication) error {
-	const logPrefix = "fileServer StorePublication "
+	fileServer.publicationMutex.Lock()
+	defer fileServer.publicationMutex.Unlock()
 
 	artistId := publication.Artist.ArtistId
-	previouslyPublishedArtist := fileServer.artists[artistId]
+	previouslyPublishedArtist, _ := fileServer.Artist(artistId)
 	if previouslyPublishedArtist != nil &&
 		previouslyPublishedArtist.Pubkey != publication.Artist.Pubkey &&
 		previouslyPublishedArtist.Pubkey != "" {
-		log.Printf(logPrefix+"update pubkey for /%s from %s to %s",
-			artistId, previouslyPublishedArtist.Pubkey, publication.Artist.Pubkey)
-		// TODO: validate that it's safe to replace
+		// Clients store a publication with a new pubkey only if the old pubkey linked to it, see checkPubkeyLink.
+		fileServer.logger.Info("update artist pubkey", "artist_id", artistId,
+			"old_pubkey", previouslyPublishedArtist.Pubkey, "pubkey", publication.Artist.Pubkey)
 	}
+	now := nowUnix()
+	stampUpdatedAt(previouslyPublishedArtist, publication.Artist, now)
+	fileServer.mutex.Lock()
 	fileServer.artists[artistId] = publication.Artist
+	fileServer.mutex.Unlock()
 
 	// Read the resources from the publication.
 	publishedResources, err := read(publication)
 	if err != nil {
-		log.Fatalf(logPrefix+"failed to read publication %v, error: %v", publication, err)
+		fileServer.logger.Error("failed to read publication", "artist_id", artistId, "error", err)
+		return err
+	}
+	err = keepVouchedPeers(fileServer, publication.Artist.Pubkey, publishedResources)
+	if err != nil {
+		return err
+	}
+	err = stampResources(fileServer, publishedResources, now)
+	if err != nil {
 		return err
 	}
 
-	err = fileServer.savePublishedResources(publication, publishedResources)
+	// Resources published since an earlier publication or in the scope of an artist or album
+	// update the resources saved from earlier publications.
+	savedResources := publishedResources
+	if isPartialResources(publishedResources) {
+		previousResources, err := fileServer.readSavedResources(publication.Artist)
+		if err != nil {
+			return err
+		}
+		savedResources = mergeResources(previousResources, publishedResources)
+	}
+	err = fileServer.savePublishedResources(publication, savedResources)
 	if err != nil {
 		return err
 	}
 
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
 	err = fileServer.indexResources(publishedResources)
 
 	return err
 }
 
-// indexResources indexes the resources for fast retrieval
+// indexResources indexes the resources for fast retrieval.
+// The caller must hold fileServer.mutex unless no other goroutine has the FileServer yet.
 func (fileServer *FileServer) indexResources(resources *art.ArtResources) error {
-	const logPrefix = "FileServer indexResources "
-
 	for _, artist := range resources.Artists {
 		fileServer.artists[artist.ArtistId] = artist
 	}
@@ -366,6 +648,15 @@ func (fileServer *FileServer) indexResources(resources *art.ArtResources) error
 		artistTracks[track.ArtistTrackId] = track
 	}
 
+	for _, playlist := range resources.Playlists {
+		artistPlaylists := fileServer.playlists[playlist.ArtistId]
+		if artistPlaylists == nil {
+			artistPlaylists = make(map[string]*art.Playlist)
+			fileServer.playlists[playlist.ArtistId] = artistPlaylists
+		}
+		artistPlaylists[playlist.ArtistPlaylistId] = playlist
+	}
+
 	for _, peer := range resources.Peers {
 		fileServer.peers[peer.Pubkey] = peer
 	}
@@ -375,79 +666,234 @@ func (fileServer *FileServer) indexResources(resources *art.ArtResources) error
 
 // StoreArtist validates the given artist and stores it in memory.
 func (fileServer *FileServer) StoreArtist(artist *art.Artist) error {
-	const logPrefix = "FileServer StoreArtist "
-
 	// validate the artist
 	if artist.Pubkey == "" {
-		log.Printf("FileServer StoreArtist reject artist missing Pubkey: %v", *artist)
+		fileServer.logger.Warn("reject artist missing pubkey", "artist_id", artist.ArtistId)
 		return fmt.Errorf("Failed to store artist missing Pubkey")
 	}
 
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	stampUpdatedAt(fileServer.artists[artist.ArtistId], artist, nowUnix())
 	fileServer.artists[artist.ArtistId] = artist
 
 	return nil
 }
 
 func (fileServer *FileServer) StoreAlbum(album *art.Album, publisher Publisher) error {
-	const logPrefix = "FileServer StoreAlbum "
+	logger := fileServer.logger.With("artist_id", album.ArtistId, "album_id", album.ArtistAlbumId)
+
+	if album.ArtistId == "" || album.ArtistAlbumId == "" {
+		logger.Warn("reject malformed album")
+		return fmt.Errorf("malformed album %v missing artist or album id", album)
+	}
+	err := checkAlbumPath(album)
+	if err != nil {
+		logger.Warn("reject album with unsafe id", "error", err)
+		return err
+	}
 
 	publishingArtist, err := publisher.Artist()
 	if err != nil {
-		log.Fatalf(logPrefix+"failed to get Artist for publisher %v, error: %v", publisher, err)
+		logger.Error("failed to get publishing artist", "error", err)
 		return err
 	}
 
 	albumArtist, err := fileServer.Artist(album.ArtistId)
 	if err != nil {
-		log.Fatalf(logPrefix+"failed to get artist %s for album %v, error: %v",
-			album.ArtistId, album, err)
+		logger.Error("failed to get album artist", "error", err)
 		return err
 	}
 
 	if publishingArtist.Pubkey != albumArtist.Pubkey {
-		log.Printf(logPrefix+"skip StoreAlbum %v because publishing pubkey %v does not match album artist pubkey %s, error: %v",
-			album, publishingArtist.Pubkey, albumArtist.Pubkey, err)
+		logger.Info("skip album of artist with another pubkey than the publisher's",
+			"pubkey", albumArtist.Pubkey, "publishing_pubkey", publishingArtist.Pubkey)
 		return err
 	}
 
-	if album.ArtistId == "" || album.ArtistAlbumId == "" {
-		log.Fatalf(logPrefix+"malformed album %v", album)
-	}
-
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
 	artistAlbums := fileServer.albums[album.ArtistId]
 	if artistAlbums == nil {
 		artistAlbums = make(map[string]*art.Album)
 		fileServer.albums[album.ArtistId] = artistAlbums
 	}
 
+	// Keep the price and cover art already set for the album when storing it again, e.g. to add another track.
+	previousAlbum := artistAlbums[album.ArtistAlbumId]
+	keepAlbumSettings(previousAlbum, album)
+	stampUpdatedAt(previousAlbum, album, nowUnix())
 	artistAlbums[album.ArtistAlbumId] = album
-	log.Printf(logPrefix+"stored album %v for publishing artist %v", album, publishingArtist)
+	logger.Debug("stored album", "publishing_artist_id", publishingArtist.ArtistId)
+
+	return nil
+}
 
+// SetAlbumPrice sets the price in satoshis to charge for each track of the stored album
+// that has no price of its own. Tracks with a price set keep their price.
+func (fileServer *FileServer) SetAlbumPrice(album *art.Album, sats uint64) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	storedAlbum := fileServer.albums[album.ArtistId][album.ArtistAlbumId]
+	if storedAlbum == nil {
+		fileServer.logger.Warn("no album to price", "artist_id", album.ArtistId, "album_id", album.ArtistAlbumId)
+		return ErrArtNotFound
+	}
+	pricedAlbum := proto.Clone(storedAlbum).(*art.Album)
+	pricedAlbum.Price = &art.Price{Sats: sats}
+	pricedAlbum.UpdatedAt = nowUnix()
+	fileServer.albums[album.ArtistId][album.ArtistAlbumId] = pricedAlbum
+	album.Price = pricedAlbum.Price
+	return nil
+}
+
+// StoreAlbumArt stores image as the cover art of the stored album and records its mime type and hash on the album.
+// Like SetAlbumPrice, this updates the in-memory database; publish the resources to persist the album.
+func (fileServer *FileServer) StoreAlbumArt(album *art.Album, image []byte, mime string) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	storedAlbum := fileServer.albums[album.ArtistId][album.ArtistAlbumId]
+	if storedAlbum == nil {
+		fileServer.logger.Warn("no album for cover art", "artist_id", album.ArtistId, "album_id", album.ArtistAlbumId)
+		return ErrArtNotFound
+	}
+	err := writePayloadFile(albumArtPath(fileServer.rootPath, storedAlbum), image)
+	if err != nil {
+		return err
+	}
+	coveredAlbum := proto.Clone(storedAlbum).(*art.Album)
+	setAlbumArt(coveredAlbum, image, mime)
+	fileServer.albums[album.ArtistId][album.ArtistAlbumId] = coveredAlbum
+	album.CoverArtMime = coveredAlbum.CoverArtMime
+	album.CoverArtSha256 = coveredAlbum.CoverArtSha256
+	return nil
+}
+
+// DeleteAlbum removes the album and its cover art file, or fails with ErrAlbumNotEmpty if it has tracks.
+// Like StoreAlbum, this updates the in-memory database; publish the resources to persist the removal.
+func (fileServer *FileServer) DeleteAlbum(album *art.Album) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	storedAlbum := fileServer.albums[album.ArtistId][album.ArtistAlbumId]
+	if storedAlbum == nil {
+		return ErrArtNotFound
+	}
+	if len(fileServer.albumTracks[album.ArtistId][album.ArtistAlbumId]) > 0 {
+		return fmt.Errorf("%w: %s/%s", ErrAlbumNotEmpty, album.ArtistId, album.ArtistAlbumId)
+	}
+	err := removePayloadFile(albumArtPath(fileServer.rootPath, storedAlbum))
+	if err != nil {
+		return err
+	}
+	delete(fileServer.albums[album.ArtistId], album.ArtistAlbumId)
+	delete(fileServer.albumTracks[album.ArtistId], album.ArtistAlbumId)
+	return nil
+}
+
+// AlbumArt gets the cover art image of the album and its mime type, or ErrArtNotFound if it has none.
+func (fileServer *FileServer) AlbumArt(artistID string, artistAlbumID string) ([]byte, string, error) {
+	fileServer.mutex.RLock()
+	album := fileServer.albums[artistID][artistAlbumID]
+	fileServer.mutex.RUnlock()
+	if album == nil {
+		return nil, "", ErrArtNotFound
+	}
+	return readAlbumArtFile(fileServer.rootPath, album)
+}
+
+// StorePlaylist stores the playlist if its curating artist is the publishing artist.
+func (fileServer *FileServer) StorePlaylist(playlist *art.Playlist, publisher Publisher) error {
+	logger := fileServer.logger.With("artist_id", playlist.ArtistId, "playlist_id", playlist.ArtistPlaylistId)
+
+	err := validatePlaylist(playlist)
+	if err != nil {
+		logger.Warn("reject malformed playlist", "error", err)
+		return err
+	}
+
+	publishingArtist, err := publisher.Artist()
+	if err != nil {
+		logger.Error("failed to get publishing artist", "error", err)
+		return err
+	}
+	playlistArtist, err := fileServer.Artist(playlist.ArtistId)
+	if err != nil {
+		logger.Error("failed to get playlist artist", "error", err)
+		return err
+	}
+	if publishingArtist.Pubkey != playlistArtist.Pubkey {
+		logger.Info("skip playlist of artist with another pubkey than the publisher's",
+			"pubkey", playlistArtist.Pubkey, "publishing_pubkey", publishingArtist.Pubkey)
+		return nil
+	}
+
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	artistPlaylists := fileServer.playlists[playlist.ArtistId]
+	if artistPlaylists == nil {
+		artistPlaylists = make(map[string]*art.Playlist)
+		fileServer.playlists[playlist.ArtistId] = artistPlaylists
+	}
+	stampUpdatedAt(artistPlaylists[playlist.ArtistPlaylistId], playlist, nowUnix())
+	artistPlaylists[playlist.ArtistPlaylistId] = playlist
+	logger.Debug("stored playlist", "tracks", len(playlist.Tracks))
 	return nil
 }
 
-// StorePeer stores the peer in the in-memory database.
+// Playlists gets the artist's playlists indexed by ArtistPlaylistId.
+func (fileServer *FileServer) Playlists(artistID string) (map[string]*art.Playlist, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	artistPlaylists, found := fileServer.playlists[artistID]
+	if !found {
+		return nil, nil
+	}
+	playlists := make(map[string]*art.Playlist, len(artistPlaylists))
+	for playlistID, playlist := range artistPlaylists {
+		playlists[playlistID] = playlist
+	}
+	return playlists, nil
+}
+
+// Playlist gets the artist's playlist with artistPlaylistID, or ErrArtNotFound if it is not stored.
+func (fileServer *FileServer) Playlist(artistID string, artistPlaylistID string) (*art.Playlist, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	playlist := fileServer.playlists[artistID][artistPlaylistID]
+	if playlist == nil {
+		return nil, ErrArtNotFound
+	}
+	return playlist, nil
+}
+
+// StorePeer stores the peer, normalized, in the in-memory database.
 func (fileServer *FileServer) StorePeer(peer *art.Peer, publisher Publisher) error {
-	const logPrefix = "FileServer StorePeer "
+	peer = normalizePeer(peer)
+	logger := fileServer.logger.With("peer", peer.Pubkey)
 
 	publishingArtist, err := publisher.Artist()
 	if err != nil {
-		log.Fatalf(logPrefix+"failed to get Artist for publisher %v, error: %v", publisher, err)
+		logger.Error("failed to get publishing artist", "error", err)
 		return err
 	}
 
-	log.Printf("FileServer StorePeer %v for publishing artist %v", peer, publishingArtist)
+	logger.Debug("store peer", "host", peer.Host, "port", peer.Port, "publishing_artist_id", publishingArtist.ArtistId)
 	if publishingArtist.Pubkey == peer.Pubkey {
+		fileServer.mutex.Lock()
+		defer fileServer.mutex.Unlock()
+		stampUpdatedAt(fileServer.peers[peer.Pubkey], peer, nowUnix())
 		fileServer.peers[peer.Pubkey] = peer
 	} else {
-		log.Printf(logPrefix+"skip StorePeer %v because pubkey does not match artist %v, error: %v",
-			peer, publishingArtist, err)
+		logger.Info("skip peer with another pubkey than the publishing artist's",
+			"publishing_artist_id", publishingArtist.ArtistId)
 		return err
 	}
 	return nil
 }
 
 func (fileServer *FileServer) Peer(pubkey string) (*art.Peer, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
 	peer := fileServer.peers[pubkey]
 	if peer == nil {
 		return nil, ErrPeerNotFound
@@ -455,19 +901,112 @@ func (fileServer *FileServer) Peer(pubkey string) (*art.Peer, error) {
 	return peer, nil
 }
 
+// DeletePeer removes the peer with pubkey, with its sync cursor, reputation, and bandwidth,
+// also from the .art file of each artist whose publication listed it, so that it is not read again on restart.
+func (fileServer *FileServer) DeletePeer(pubkey string) error {
+	fileServer.publicationMutex.Lock()
+	defer fileServer.publicationMutex.Unlock()
+
+	fileServer.mutex.Lock()
+	if fileServer.peers[pubkey] == nil {
+		fileServer.mutex.Unlock()
+		return ErrPeerNotFound
+	}
+	delete(fileServer.peers, pubkey)
+	err := fileServer.deletePeerRecords(pubkey)
+	artists := make([]*art.Artist, 0, len(fileServer.artists))
+	for _, artist := range fileServer.artists {
+		artists = append(artists, artist)
+	}
+	fileServer.mutex.Unlock()
+	if err != nil {
+		fileServer.logger.Error("failed to delete records of peer", "peer", pubkey, "error", err)
+		return err
+	}
+
+	for _, artist := range artists {
+		resources, err := fileServer.readSavedResources(artist)
+		if err != nil {
+			return err
+		}
+		var keptPeers []*art.Peer
+		for _, peer := range resources.Peers {
+			if peer.Pubkey != pubkey {
+				keptPeers = append(keptPeers, peer)
+			}
+		}
+		if len(keptPeers) == len(resources.Peers) {
+			continue // to next artist, whose art does not list the peer
+		}
+		resources.Peers = keptPeers
+		marshaledResources, err := proto.Marshal(resources)
+		if err != nil {
+			return err
+		}
+		err = writeFileAtomically(fileServer.artPath(artist), marshaledResources)
+		if err != nil {
+			fileServer.logger.Error("failed to write resources without peer", "artist_id", artist.ArtistId, "peer", pubkey, "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePeerRecords removes the sync cursor, reputation, and bandwidth of the peer with pubkey,
+// saving each file that had a record of it. The caller must hold fileServer.mutex.
+func (fileServer *FileServer) deletePeerRecords(pubkey string) error {
+	if _, isStored := fileServer.syncCursors[pubkey]; isStored {
+		delete(fileServer.syncCursors, pubkey)
+		err := fileServer.writeSyncCursors()
+		if err != nil {
+			return err
+		}
+	}
+	if _, isStored := fileServer.peerReputations[pubkey]; isStored {
+		delete(fileServer.peerReputations, pubkey)
+		err := fileServer.writePeerReputations()
+		if err != nil {
+			return err
+		}
+	}
+	if _, isStored := fileServer.peerBandwidths[pubkey]; isStored {
+		delete(fileServer.peerBandwidths, pubkey)
+		return fileServer.writePeerBandwidths()
+	}
+	return nil
+}
+
+// Peers gets all the peers, page by page, indexed by pubkey.
 func (fileServer *FileServer) Peers() (map[string]*art.Peer, error) {
-	return fileServer.peers, nil
+	return collectPeers(fileServer)
 }
 
-// StoreTrack stores track metadata in the in-memory database.
-func (fileServer *FileServer) StoreTrack(track *art.Track, publisher Publisher) error {
-	const logPrefix = "FileServer StoreTrack "
+// PeersPage gets the page of peers starting at offset, ordered by pubkey.
+func (fileServer *FileServer) PeersPage(offset int, limit int) ([]*art.Peer, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	return pagePeers(fileServer.peers, offset, limit), nil
+}
 
+// StoreTrack stores a copy of track metadata in the in-memory database,
+// so that the caller may update track, e.g. with StoreTrackPayload, while others read the stored track.
+func (fileServer *FileServer) StoreTrack(track *art.Track, publisher Publisher) error {
+	err := checkTrackPath(track)
+	if err != nil {
+		fileServer.logger.Warn("reject track with unsafe id", "error", err)
+		return err
+	}
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
 	tracksForArtist := fileServer.tracks[track.ArtistId]
 	if tracksForArtist == nil {
 		tracksForArtist = make(map[string]*art.Track)
 		fileServer.tracks[track.ArtistId] = tracksForArtist
 	}
+	now := nowUnix()
+	stampCreatedAt(tracksForArtist[track.ArtistTrackId], track, now)
+	stampUpdatedAt(tracksForArtist[track.ArtistTrackId], track, now)
+	track = proto.Clone(track).(*art.Track)
 	tracksForArtist[track.ArtistTrackId] = track
 	if track.ArtistAlbumId != "" || track.AlbumTrackNumber > 0 {
 		albumTracksForArtist := fileServer.albumTracks[track.ArtistId]
@@ -486,47 +1025,862 @@ func (fileServer *FileServer) StoreTrack(track *art.Track, publisher Publisher)
 	return nil
 }
 
-// StoreTrackPayload stores the mp3 bytes of the given track.
+// StoreTrackPayload stores the mp3 or flac bytes of the given track
+// and records their SHA-256 hash on the track to publish with it.
 func (fileServer *FileServer) StoreTrackPayload(track *art.Track, payload []byte) error {
-	const logPrefix = "FileServer StoreTrackPayload "
-
-	filename := fileServer.mp3Filename(track)
-	containerDirectory := filepath.Dir(filename)
-
-	err := os.MkdirAll(containerDirectory, 0755)
+	err := writePayloadFile(fileServer.payloadFilename(track), payload)
 	if err != nil {
-		log.Printf(logPrefix+"Failed to make directory %s, error: %v", containerDirectory, err)
 		return err
 	}
 
-	err = ioutil.WriteFile(filename, payload, 0644)
-	return err
+	payloadHash := sha256.Sum256(payload)
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	storedTrack := fileServer.tracks[track.ArtistId][track.ArtistTrackId]
+	if storedTrack != nil && !bytes.Equal(storedTrack.PayloadSha256, payloadHash[:]) {
+		fileServer.replaceTrack(storedTrack, func(updatedTrack *art.Track) {
+			updatedTrack.PayloadSha256 = payloadHash[:]
+			updatedTrack.UpdatedAt = nowUnix()
+		})
+	}
+	track.PayloadSha256 = payloadHash[:]
+	return nil
 }
 
-func (fileServer *FileServer) Track(artistID string, trackID string) (*art.Track, error) {
-	return fileServer.tracks[artistID][trackID], nil
+// VerifyStoredTrack checks that the stored payload of track still matches the hash recorded when it was stored.
+func (fileServer *FileServer) VerifyStoredTrack(track *art.Track) error {
+	storedTrack, err := fileServer.Track(track.ArtistId, track.ArtistTrackId)
+	if err != nil {
+		return err
+	}
+	return verifyPayloadFile(fileServer.payloadFilename(storedTrack), storedTrack)
 }
 
-func (fileServer *FileServer) TrackFilePath(track *art.Track) string {
-	return fileServer.mp3Filename(track)
+// verifyPayloadFile checks that the bytes of filename have the PayloadSha256 hash of track.
+// It wraps ErrPayloadMismatch if they do not.
+func verifyPayloadFile(filename string, track *art.Track) error {
+	if len(track.PayloadSha256) == 0 {
+		return fmt.Errorf("track %s/%s has no payload hash to verify", track.ArtistId, track.ArtistTrackId)
+	}
+	payloadFile, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer payloadFile.Close()
+	return verifyPayloadHash(payloadFile, filename, track)
 }
 
-func (fileServer *FileServer) artPath(artist *art.Artist) string {
-	return filepath.Join(fileServer.rootPath, artist.ArtistId, ".art")
+// verifyPayloadHash checks that the bytes read from payload, named source in the error, have the PayloadSha256 hash
+// of track. It wraps ErrPayloadMismatch if they do not.
+func verifyPayloadHash(payload io.Reader, source string, track *art.Track) error {
+	payloadHash, err := hashPayload(payload)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(payloadHash, track.PayloadSha256) {
+		return fmt.Errorf("%w: %s has hash %x, not %x for %s/%s", ErrPayloadMismatch,
+			source, payloadHash, track.PayloadSha256, track.ArtistId, track.ArtistTrackId)
+	}
+	return nil
 }
 
-func (fileServer *FileServer) publicationPath(artist *art.Artist) string {
-	// TODO: validate params.
-	if artist.ArtistId == "" {
-		log.Fatalf("FileServer publicationPath failed for missing artist id in %v", artist)
+// hashPayload gets the SHA-256 hash of the bytes read from payload without reading them all into memory.
+func hashPayload(payload io.Reader) ([]byte, error) {
+	hash := sha256.New()
+	_, err := io.Copy(hash, payload)
+	if err != nil {
+		return nil, err
 	}
-	if artist.Pubkey == "" {
-		log.Fatalf("FileServer publicationPath no known pubkey for artist %s", artist.ArtistId)
+	return hash.Sum(nil), nil
+}
+
+// writePayloadFile writes the payload of a track to filename, making its directory if needed.
+func writePayloadFile(filename string, payload []byte) error {
+	containerDirectory := filepath.Dir(filename)
+	err := os.MkdirAll(containerDirectory, 0755)
+	if err != nil {
+		return err
 	}
-	return filepath.Join(fileServer.rootPath, artist.ArtistId, artist.Pubkey+".pub")
+
+	err = ioutil.WriteFile(filename, payload, 0644)
+	return err
 }
 
-func (fileServer *FileServer) mp3Filename(track *art.Track) (filename string) {
-	// TODO: sanitize filepath so peer cannot write outside the base path dir sandbox.
-	return filepath.Join(fileServer.rootPath, track.ArtistId, track.ArtistTrackId+".mp3")
+// writeFileAtomically writes data to filename through a temporary file renamed over it,
+// so that a crash while writing leaves the previous version of the file rather than part of the new one.
+func writeFileAtomically(filename string, data []byte) error {
+	tempFile, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tempFile.Write(data)
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempFile.Name(), 0644)
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return err
+	}
+	return os.Rename(tempFile.Name(), filename)
+}
+
+// SetTrackPrice sets the price in satoshis to charge for the stored track.
+// Like StoreTrack, this updates the in-memory database; publish the resources to persist the price.
+func (fileServer *FileServer) SetTrackPrice(track *art.Track, sats uint64) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	storedTrack := fileServer.tracks[track.ArtistId][track.ArtistTrackId]
+	if storedTrack == nil {
+		fileServer.logger.Warn("no track to price", "artist_id", track.ArtistId, "track_id", track.ArtistTrackId)
+		return ErrArtNotFound
+	}
+	pricedTrack := fileServer.replaceTrack(storedTrack, func(updatedTrack *art.Track) {
+		updatedTrack.Price = &art.Price{Sats: sats}
+		updatedTrack.UpdatedAt = nowUnix()
+	})
+	track.Price = pricedTrack.Price
+	return nil
+}
+
+// StoreTrackPreview stores preview as the free preview clip of the stored track
+// and records its length, track.PreviewSeconds, and its hash on the track.
+// Like SetTrackPrice, this updates the in-memory database; publish the resources to persist the track.
+func (fileServer *FileServer) StoreTrackPreview(track *art.Track, preview []byte) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	storedTrack := fileServer.tracks[track.ArtistId][track.ArtistTrackId]
+	if storedTrack == nil {
+		fileServer.logger.Warn("no track for preview", "artist_id", track.ArtistId, "track_id", track.ArtistTrackId)
+		return ErrArtNotFound
+	}
+	err := writePayloadFile(previewPath(fileServer.rootPath, storedTrack), preview)
+	if err != nil {
+		return err
+	}
+	previewedTrack := fileServer.replaceTrack(storedTrack, func(updatedTrack *art.Track) {
+		setTrackPreview(updatedTrack, preview, track.PreviewSeconds)
+	})
+	track.PreviewSeconds = previewedTrack.PreviewSeconds
+	track.PreviewSha256 = previewedTrack.PreviewSha256
+	return nil
+}
+
+// TrackPreview gets the preview clip of the track, or ErrArtNotFound if it has none.
+func (fileServer *FileServer) TrackPreview(artistID string, artistTrackID string) ([]byte, error) {
+	fileServer.mutex.RLock()
+	track := fileServer.tracks[artistID][artistTrackID]
+	fileServer.mutex.RUnlock()
+	if track == nil {
+		return nil, ErrArtNotFound
+	}
+	return readPreviewFile(fileServer.rootPath, track)
+}
+
+// DeleteTrack removes the track and its payload and preview files.
+// Like StoreTrack, this updates the in-memory database; publish the resources to persist the removal.
+func (fileServer *FileServer) DeleteTrack(track *art.Track) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	storedTrack := fileServer.tracks[track.ArtistId][track.ArtistTrackId]
+	if storedTrack == nil {
+		return ErrArtNotFound
+	}
+	err := removePayloadFile(fileServer.payloadFilename(storedTrack))
+	if err != nil {
+		return err
+	}
+	err = removePayloadFile(previewPath(fileServer.rootPath, storedTrack))
+	if err != nil {
+		return err
+	}
+	delete(fileServer.tracks[track.ArtistId], track.ArtistTrackId)
+	// Published art is indexed again in place of the stored track, so match the album track by id.
+	albumTracks := fileServer.albumTracks[storedTrack.ArtistId][storedTrack.ArtistAlbumId]
+	if albumTracks[storedTrack.AlbumTrackNumber].GetArtistTrackId() == storedTrack.ArtistTrackId {
+		delete(albumTracks, storedTrack.AlbumTrackNumber)
+	}
+	return nil
+}
+
+// EvictTrack removes the payload file of track, keeping the track.
+func (fileServer *FileServer) EvictTrack(track *art.Track) error {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	storedTrack := fileServer.tracks[track.ArtistId][track.ArtistTrackId]
+	if storedTrack == nil {
+		return ErrArtNotFound
+	}
+	return removePayloadFile(fileServer.payloadFilename(storedTrack))
+}
+
+// removePayloadFile removes the file with the payload of a track or an album's cover art, if it is stored.
+func removePayloadFile(filename string) error {
+	err := os.Remove(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// replaceTrack indexes a copy of storedTrack updated by update in place of storedTrack,
+// so that goroutines reading storedTrack do not see it change. It returns the updated copy.
+// The caller must hold fileServer.mutex.
+func (fileServer *FileServer) replaceTrack(storedTrack *art.Track, update func(*art.Track)) *art.Track {
+	updatedTrack := proto.Clone(storedTrack).(*art.Track)
+	update(updatedTrack)
+	fileServer.tracks[storedTrack.ArtistId][storedTrack.ArtistTrackId] = updatedTrack
+	albumTracks := fileServer.albumTracks[storedTrack.ArtistId][storedTrack.ArtistAlbumId]
+	if albumTracks[storedTrack.AlbumTrackNumber] == storedTrack {
+		albumTracks[storedTrack.AlbumTrackNumber] = updatedTrack
+	}
+	return updatedTrack
+}
+
+func (fileServer *FileServer) Track(artistID string, trackID string) (*art.Track, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	track := fileServer.tracks[artistID][trackID]
+	if track == nil {
+		return nil, ErrArtNotFound
+	}
+	return track, nil
+}
+
+// SearchTracks gets the tracks whose titles contain query, ignoring case, and that pass filter,
+// ordered by artist then by title.
+func (fileServer *FileServer) SearchTracks(query string, filter TrackFilter) ([]*art.Track, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	return searchTracks(fileServer.tracks, query, filter), nil
+}
+
+// RecentTracks gets at most limit tracks, newest first, ordered like recentTracks.
+func (fileServer *FileServer) RecentTracks(limit int) ([]*art.Track, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	return recentTracks(fileServer.tracks, limit), nil
+}
+
+func (fileServer *FileServer) TrackFilePath(track *art.Track) string {
+	return fileServer.payloadFilename(track)
+}
+
+// TrackFilePartialReader opens the stored payload of track to read from the byte at offset,
+// so a client can resume an interrupted download.
+func (fileServer *FileServer) TrackFilePartialReader(track *art.Track, offset int64) (io.ReadCloser, error) {
+	return openPayloadFile(fileServer.payloadFilename(track), offset)
+}
+
+// openPayloadFile opens the payload file of a track to read from offset.
+func openPayloadFile(filename string, offset int64) (io.ReadCloser, error) {
+	payloadFile, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	_, err = payloadFile.Seek(offset, io.SeekStart)
+	if err != nil {
+		payloadFile.Close()
+		return nil, err
+	}
+	return payloadFile, nil
+}
+
+// SyncCursor gets the AsOf time of the resources last synced from the peer with pubkey, or 0 if never synced.
+func (fileServer *FileServer) SyncCursor(pubkey string) (uint64, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	return fileServer.syncCursors[pubkey].GetAsOf(), nil
+}
+
+// StoreSyncCursor saves the AsOf time of the resources synced from the peer with pubkey in the .sync file.
+func (fileServer *FileServer) StoreSyncCursor(pubkey string, asOf uint64) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	fileServer.syncCursors[pubkey] = &art.SyncCursor{Pubkey: pubkey, AsOf: asOf}
+	return fileServer.writeSyncCursors()
+}
+
+// writeSyncCursors saves the sync cursor of every peer in the .sync file. The caller must hold fileServer.mutex.
+func (fileServer *FileServer) writeSyncCursors() error {
+	syncCursors := art.SyncCursors{}
+	for _, syncCursor := range fileServer.syncCursors {
+		syncCursors.SyncCursors = append(syncCursors.SyncCursors, syncCursor)
+	}
+	marshaledSyncCursors, err := proto.Marshal(&syncCursors)
+	if err != nil {
+		fileServer.logger.Error("failed to marshal sync cursors", "error", err)
+		return err
+	}
+	return writeFileAtomically(fileServer.syncPath(), marshaledSyncCursors)
+}
+
+// readSyncCursors reads the sync cursors from the .sync file, if any.
+func (fileServer *FileServer) readSyncCursors() error {
+	syncData, err := ioutil.ReadFile(fileServer.syncPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	syncCursors := art.SyncCursors{}
+	err = proto.Unmarshal(syncData, &syncCursors)
+	if err != nil {
+		return err
+	}
+	for _, syncCursor := range syncCursors.SyncCursors {
+		fileServer.syncCursors[syncCursor.Pubkey] = syncCursor
+	}
+	return nil
+}
+
+// PublicationSequence gets the Sequence of the latest publication validated from the artist with pubkey,
+// or 0 if none was.
+func (fileServer *FileServer) PublicationSequence(pubkey string) (uint64, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	return fileServer.publicationSequences[pubkey].GetSequence(), nil
+}
+
+// StorePublicationSequence saves the Sequence of the latest publication validated from the artist with pubkey
+// in the .sequence file.
+func (fileServer *FileServer) StorePublicationSequence(pubkey string, sequence uint64) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	fileServer.publicationSequences[pubkey] = &art.PublicationSequence{Pubkey: pubkey, Sequence: sequence}
+	publicationSequences := art.PublicationSequences{}
+	for _, publicationSequence := range fileServer.publicationSequences {
+		publicationSequences.PublicationSequences = append(publicationSequences.PublicationSequences, publicationSequence)
+	}
+	marshaledSequences, err := proto.Marshal(&publicationSequences)
+	if err != nil {
+		fileServer.logger.Error("failed to marshal publication sequences", "error", err)
+		return err
+	}
+	return writeFileAtomically(fileServer.sequencePath(), marshaledSequences)
+}
+
+// readPublicationSequences reads the publication sequences from the .sequence file, if any.
+func (fileServer *FileServer) readPublicationSequences() error {
+	sequenceData, err := ioutil.ReadFile(fileServer.sequencePath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	publicationSequences := art.PublicationSequences{}
+	err = proto.Unmarshal(sequenceData, &publicationSequences)
+	if err != nil {
+		return err
+	}
+	for _, publicationSequence := range publicationSequences.PublicationSequences {
+		fileServer.publicationSequences[publicationSequence.Pubkey] = publicationSequence
+	}
+	return nil
+}
+
+// StoreTombstone saves the tombstone of a deleted track or album in the .tombstone file,
+// replacing any earlier one of it.
+func (fileServer *FileServer) StoreTombstone(tombstone *art.Tombstone) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	fileServer.tombstones[tombstoneKey(tombstone)] = tombstone
+	return fileServer.writeTombstones()
+}
+
+// DeleteExpiredTombstones deletes the tombstones of art deleted before deletedBefore
+// and saves the rest in the .tombstone file, if any were deleted.
+func (fileServer *FileServer) DeleteExpiredTombstones(deletedBefore uint64) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	isDeleted := false
+	for key, tombstone := range fileServer.tombstones {
+		if tombstone.DeletedAt < deletedBefore {
+			delete(fileServer.tombstones, key)
+			isDeleted = true
+		}
+	}
+	if !isDeleted {
+		return nil
+	}
+	return fileServer.writeTombstones()
+}
+
+// writeTombstones saves the tombstones in the .tombstone file. The caller must hold the mutex.
+func (fileServer *FileServer) writeTombstones() error {
+	tombstones := art.Tombstones{}
+	for _, storedTombstone := range fileServer.tombstones {
+		tombstones.Tombstones = append(tombstones.Tombstones, storedTombstone)
+	}
+	sortTombstones(tombstones.Tombstones)
+	marshaledTombstones, err := proto.Marshal(&tombstones)
+	if err != nil {
+		fileServer.logger.Error("failed to marshal tombstones", "error", err)
+		return err
+	}
+	return ioutil.WriteFile(fileServer.tombstonePath(), marshaledTombstones, 0644)
+}
+
+// Tombstones gets the stored tombstones in the order of sortTombstones.
+func (fileServer *FileServer) Tombstones() ([]*art.Tombstone, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	tombstones := make([]*art.Tombstone, 0, len(fileServer.tombstones))
+	for _, tombstone := range fileServer.tombstones {
+		tombstones = append(tombstones, tombstone)
+	}
+	sortTombstones(tombstones)
+	return tombstones, nil
+}
+
+// readTombstones reads the tombstones from the .tombstone file, if any.
+func (fileServer *FileServer) readTombstones() error {
+	tombstoneData, err := ioutil.ReadFile(fileServer.tombstonePath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	tombstones := art.Tombstones{}
+	err = proto.Unmarshal(tombstoneData, &tombstones)
+	if err != nil {
+		return err
+	}
+	for _, tombstone := range tombstones.Tombstones {
+		fileServer.tombstones[tombstoneKey(tombstone)] = tombstone
+	}
+	return nil
+}
+
+// PeerReputation gets the reputation of the peer with pubkey, which has no failures if none were stored.
+// The reputation is a copy, to update and store again.
+func (fileServer *FileServer) PeerReputation(pubkey string) (*art.PeerReputation, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	reputation := fileServer.peerReputations[pubkey]
+	if reputation == nil {
+		return &art.PeerReputation{Pubkey: pubkey}, nil
+	}
+	return proto.Clone(reputation).(*art.PeerReputation), nil
+}
+
+// StorePeerReputation saves the reputation of a peer in the .reputation file.
+func (fileServer *FileServer) StorePeerReputation(reputation *art.PeerReputation) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	fileServer.peerReputations[reputation.Pubkey] = reputation
+	return fileServer.writePeerReputations()
+}
+
+// writePeerReputations saves the reputation of every peer in the .reputation file.
+// The caller must hold fileServer.mutex.
+func (fileServer *FileServer) writePeerReputations() error {
+	peerReputations := art.PeerReputations{}
+	for _, peerReputation := range fileServer.peerReputations {
+		peerReputations.PeerReputations = append(peerReputations.PeerReputations, peerReputation)
+	}
+	marshaledReputations, err := proto.Marshal(&peerReputations)
+	if err != nil {
+		fileServer.logger.Error("failed to marshal peer reputations", "error", err)
+		return err
+	}
+	return writeFileAtomically(fileServer.reputationPath(), marshaledReputations)
+}
+
+// readPeerReputations reads the peer reputations from the .reputation file, if any.
+func (fileServer *FileServer) readPeerReputations() error {
+	reputationData, err := ioutil.ReadFile(fileServer.reputationPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	peerReputations := art.PeerReputations{}
+	err = proto.Unmarshal(reputationData, &peerReputations)
+	if err != nil {
+		return err
+	}
+	for _, reputation := range peerReputations.PeerReputations {
+		fileServer.peerReputations[reputation.Pubkey] = reputation
+	}
+	return nil
+}
+
+// PeerBandwidth gets the bytes served to the peer with pubkey, which are none if none were stored.
+// The bandwidth is a copy, to update and store again.
+func (fileServer *FileServer) PeerBandwidth(pubkey string) (*art.PeerBandwidth, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	bandwidth := fileServer.peerBandwidths[pubkey]
+	if bandwidth == nil {
+		return &art.PeerBandwidth{Pubkey: pubkey}, nil
+	}
+	return proto.Clone(bandwidth).(*art.PeerBandwidth), nil
+}
+
+// StorePeerBandwidth saves the bytes served to a peer in the .bandwidth file.
+func (fileServer *FileServer) StorePeerBandwidth(bandwidth *art.PeerBandwidth) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	fileServer.peerBandwidths[bandwidth.Pubkey] = bandwidth
+	return fileServer.writePeerBandwidths()
+}
+
+// writePeerBandwidths saves the bytes served to every peer in the .bandwidth file.
+// The caller must hold fileServer.mutex.
+func (fileServer *FileServer) writePeerBandwidths() error {
+	peerBandwidths := art.PeerBandwidths{}
+	for _, peerBandwidth := range fileServer.peerBandwidths {
+		peerBandwidths.PeerBandwidths = append(peerBandwidths.PeerBandwidths, peerBandwidth)
+	}
+	marshaledBandwidths, err := proto.Marshal(&peerBandwidths)
+	if err != nil {
+		fileServer.logger.Error("failed to marshal peer bandwidths", "error", err)
+		return err
+	}
+	return writeFileAtomically(fileServer.bandwidthPath(), marshaledBandwidths)
+}
+
+// readPeerBandwidths reads the bytes served to each peer from the .bandwidth file, if any.
+func (fileServer *FileServer) readPeerBandwidths() error {
+	bandwidthData, err := ioutil.ReadFile(fileServer.bandwidthPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	peerBandwidths := art.PeerBandwidths{}
+	err = proto.Unmarshal(bandwidthData, &peerBandwidths)
+	if err != nil {
+		return err
+	}
+	for _, bandwidth := range peerBandwidths.PeerBandwidths {
+		fileServer.peerBandwidths[bandwidth.Pubkey] = bandwidth
+	}
+	return nil
+}
+
+// TrackStats gets the plays and purchases counted for a track, which are none if none were stored.
+// The stats are a copy, to update and store again.
+func (fileServer *FileServer) TrackStats(artistID string, artistTrackID string) (*art.TrackStats, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	stats := fileServer.trackStats[artistID+"/"+artistTrackID]
+	if stats == nil {
+		return &art.TrackStats{ArtistId: artistID, ArtistTrackId: artistTrackID}, nil
+	}
+	return proto.Clone(stats).(*art.TrackStats), nil
+}
+
+// StoreTrackStats saves a copy of the plays and purchases counted for a track in the .stats file.
+func (fileServer *FileServer) StoreTrackStats(stats *art.TrackStats) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	fileServer.trackStats[stats.ArtistId+"/"+stats.ArtistTrackId] = proto.Clone(stats).(*art.TrackStats)
+	return fileServer.writeTrackStats()
+}
+
+// AddTrackStats adds the plays and purchases of stats to those saved for its track in the .stats file.
+func (fileServer *FileServer) AddTrackStats(stats *art.TrackStats) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	key := stats.ArtistId + "/" + stats.ArtistTrackId
+	storedStats := fileServer.trackStats[key]
+	if storedStats == nil {
+		storedStats = &art.TrackStats{ArtistId: stats.ArtistId, ArtistTrackId: stats.ArtistTrackId}
+		fileServer.trackStats[key] = storedStats
+	}
+	addTrackStats(storedStats, stats)
+	return fileServer.writeTrackStats()
+}
+
+// DeleteTrackStats deletes the stats of a track from the .stats file, if any.
+func (fileServer *FileServer) DeleteTrackStats(artistID string, artistTrackID string) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	key := artistID + "/" + artistTrackID
+	if fileServer.trackStats[key] == nil {
+		return nil
+	}
+	delete(fileServer.trackStats, key)
+	return fileServer.writeTrackStats()
+}
+
+// writeTrackStats saves the stats of every track in the .stats file, replacing it at once
+// so a crash mid-write leaves the previous stats. The caller must hold fileServer.mutex.
+func (fileServer *FileServer) writeTrackStats() error {
+	trackStatsList := art.TrackStatsList{}
+	for _, trackStats := range fileServer.trackStats {
+		trackStatsList.TrackStats = append(trackStatsList.TrackStats, trackStats)
+	}
+	marshaledStats, err := proto.Marshal(&trackStatsList)
+	if err != nil {
+		fileServer.logger.Error("failed to marshal track stats", "error", err)
+		return err
+	}
+	return writeFileAtomically(fileServer.statsPath(), marshaledStats)
+}
+
+// TopTrackStats gets copies of the stats of at most limit tracks, ordered like topTrackStats.
+func (fileServer *FileServer) TopTrackStats(limit int) ([]*art.TrackStats, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	stats := make([]*art.TrackStats, 0, len(fileServer.trackStats))
+	for _, trackStats := range fileServer.trackStats {
+		stats = append(stats, proto.Clone(trackStats).(*art.TrackStats))
+	}
+	return topTrackStats(stats, limit), nil
+}
+
+// readTrackStats reads the plays and purchases counted for each track from the .stats file, if any.
+// The stats are local analytics, so a malformed .stats file is set aside, to count again from none,
+// rather than keep the art from being served.
+func (fileServer *FileServer) readTrackStats() error {
+	statsData, err := ioutil.ReadFile(fileServer.statsPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	trackStatsList := art.TrackStatsList{}
+	err = proto.Unmarshal(statsData, &trackStatsList)
+	if err != nil {
+		malformedPath := fmt.Sprintf("%s.malformed-%d", fileServer.statsPath(), nowUnix())
+		fileServer.logger.Warn("set aside malformed track stats to count again", "path", malformedPath, "error", err)
+		return os.Rename(fileServer.statsPath(), malformedPath)
+	}
+	for _, stats := range trackStatsList.TrackStats {
+		fileServer.trackStats[stats.ArtistId+"/"+stats.ArtistTrackId] = stats
+	}
+	return nil
+}
+
+// StoreIssuedInvoice saves the invoice in the .invoices file, replacing any stored with its hash.
+func (fileServer *FileServer) StoreIssuedInvoice(invoice *art.IssuedInvoice) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	fileServer.issuedInvoices[issuedInvoiceKey(invoice.InvoiceHash)] = proto.Clone(invoice).(*art.IssuedInvoice)
+	return fileServer.writeIssuedInvoices()
+}
+
+// IssuedInvoice gets a copy of the invoice issued with invoiceHash, or ErrArtNotFound.
+func (fileServer *FileServer) IssuedInvoice(invoiceHash []byte) (*art.IssuedInvoice, error) {
+	fileServer.mutex.RLock()
+	defer fileServer.mutex.RUnlock()
+	invoice := fileServer.issuedInvoices[issuedInvoiceKey(invoiceHash)]
+	if invoice == nil {
+		return nil, ErrArtNotFound
+	}
+	return proto.Clone(invoice).(*art.IssuedInvoice), nil
+}
+
+// DeleteExpiredInvoices deletes the invoices never settled that expired before expiredBefore
+// and saves the rest in the .invoices file, if any were deleted.
+func (fileServer *FileServer) DeleteExpiredInvoices(expiredBefore uint64) error {
+	fileServer.mutex.Lock()
+	defer fileServer.mutex.Unlock()
+	isDeleted := false
+	for key, invoice := range fileServer.issuedInvoices {
+		if isExpiredInvoice(invoice, expiredBefore) {
+			delete(fileServer.issuedInvoices, key)
+			isDeleted = true
+		}
+	}
+	if !isDeleted {
+		return nil
+	}
+	return fileServer.writeIssuedInvoices()
+}
+
+// writeIssuedInvoices saves the issued invoices in the .invoices file. The caller must hold the mutex.
+func (fileServer *FileServer) writeIssuedInvoices() error {
+	issuedInvoices := art.IssuedInvoices{}
+	for _, invoice := range fileServer.issuedInvoices {
+		issuedInvoices.IssuedInvoices = append(issuedInvoices.IssuedInvoices, invoice)
+	}
+	marshaledInvoices, err := proto.Marshal(&issuedInvoices)
+	if err != nil {
+		fileServer.logger.Error("failed to marshal issued invoices", "error", err)
+		return err
+	}
+	return writeFileAtomically(fileServer.invoicesPath(), marshaledInvoices)
+}
+
+// readIssuedInvoices reads the issued invoices from the .invoices file, if any.
+func (fileServer *FileServer) readIssuedInvoices() error {
+	invoicesData, err := ioutil.ReadFile(fileServer.invoicesPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	issuedInvoices := art.IssuedInvoices{}
+	err = proto.Unmarshal(invoicesData, &issuedInvoices)
+	if err != nil {
+		return err
+	}
+	for _, invoice := range issuedInvoices.IssuedInvoices {
+		fileServer.issuedInvoices[issuedInvoiceKey(invoice.InvoiceHash)] = invoice
+	}
+	return nil
+}
+
+func (fileServer *FileServer) invoicesPath() string {
+	return filepath.Join(fileServer.rootPath, ".invoices")
+}
+
+func (fileServer *FileServer) statsPath() string {
+	return filepath.Join(fileServer.rootPath, ".stats")
+}
+
+func (fileServer *FileServer) bandwidthPath() string {
+	return filepath.Join(fileServer.rootPath, ".bandwidth")
+}
+
+func (fileServer *FileServer) reputationPath() string {
+	return filepath.Join(fileServer.rootPath, ".reputation")
+}
+
+func (fileServer *FileServer) sequencePath() string {
+	return filepath.Join(fileServer.rootPath, ".sequence")
+}
+
+func (fileServer *FileServer) tombstonePath() string {
+	return filepath.Join(fileServer.rootPath, ".tombstone")
+}
+
+func (fileServer *FileServer) syncPath() string {
+	return filepath.Join(fileServer.rootPath, ".sync")
+}
+
+func (fileServer *FileServer) artPath(artist *art.Artist) string {
+	return filepath.Join(fileServer.rootPath, artist.ArtistId, ".art")
+}
+
+// publicationPath gets the path of the [pubkey].pub file for the publication signed by artist,
+// or an error if the artist has no id or pubkey.
+func (fileServer *FileServer) publicationPath(artist *art.Artist) (string, error) {
+	if artist.ArtistId == "" {
+		return "", fmt.Errorf("no artist id for publication path of %v", artist)
+	}
+	if artist.Pubkey == "" {
+		return "", fmt.Errorf("no known pubkey for publication path of artist %s", artist.ArtistId)
+	}
+	return filepath.Join(fileServer.rootPath, artist.ArtistId, artist.Pubkey+".pub"), nil
+}
+
+func (fileServer *FileServer) payloadFilename(track *art.Track) (filename string) {
+	return payloadPath(fileServer.payloadDir, track)
+}
+
+// payloadPath gets the path under payloadDir of the file with the payload of track,
+// or "" if checkTrackPath finds that the track's ids or container, which a peer may publish, would escape it.
+func payloadPath(payloadDir string, track *art.Track) string {
+	if checkTrackPath(track) != nil {
+		return ""
+	}
+	return filepath.Join(payloadDir, track.ArtistId, track.ArtistTrackId+"."+TrackContainer(track))
+}
+
+// checkTrackPath checks that the ids and container of track name a file inside its artist's directory:
+// a simple artist id, a hierarchy of simple ids for the track without "." or ".." levels, and a known container.
+// It returns an error wrapping ErrArtIDInvalid otherwise.
+func checkTrackPath(track *art.Track) error {
+	err := checkArtPath(track.ArtistId, track.ArtistTrackId)
+	if err != nil {
+		return err
+	}
+	switch TrackContainer(track) {
+	case ContainerMp3, ContainerFlac, ContainerOgg, ContainerWav:
+		return nil
+	}
+	return fmt.Errorf("%w: container %q of track %s/%s", ErrArtIDInvalid, track.Container, track.ArtistId, track.ArtistTrackId)
+}
+
+// checkAlbumPath checks that the ids of album name a directory inside its artist's directory, like checkTrackPath.
+func checkAlbumPath(album *art.Album) error {
+	return checkArtPath(album.ArtistId, album.ArtistAlbumId)
+}
+
+// checkArtPath checks that artistID is a simple id and id a hierarchy of simple ids, none of them "." or "..",
+// so that joining them into a path stays inside the directory of the artist's art.
+func checkArtPath(artistID string, id string) error {
+	if !simpleIDRegexp.MatchString(artistID) || isDotLevel(artistID) {
+		return fmt.Errorf("%w: artist id %q", ErrArtIDInvalid, artistID)
+	}
+	if !hierarchyRegexp.MatchString(id) {
+		return fmt.Errorf("%w: id %q of artist %s", ErrArtIDInvalid, id, artistID)
+	}
+	for _, level := range strings.Split(id, "/") {
+		if isDotLevel(level) {
+			return fmt.Errorf("%w: id %q of artist %s", ErrArtIDInvalid, id, artistID)
+		}
+	}
+	return nil
+}
+
+// isDotLevel tells whether level names the current or parent directory in a path.
+func isDotLevel(level string) bool {
+	return level == "." || level == ".."
+}
+
+// albumArtPath gets the path under rootPath of the file with the cover art image of album,
+// in the album's directory beside the payloads of its tracks.
+func albumArtPath(rootPath string, album *art.Album) string {
+	return filepath.Join(rootPath, album.ArtistId, album.ArtistAlbumId, ".cover")
+}
+
+// readAlbumArtFile reads the cover art image of album stored under rootPath,
+// returning ErrArtNotFound if the album has no cover art or its image is not stored.
+func readAlbumArtFile(rootPath string, album *art.Album) ([]byte, string, error) {
+	if album.CoverArtMime == "" {
+		return nil, "", ErrArtNotFound
+	}
+	image, err := ioutil.ReadFile(albumArtPath(rootPath, album))
+	if os.IsNotExist(err) {
+		return nil, "", ErrArtNotFound
+	} else if err != nil {
+		return nil, "", err
+	}
+	return image, album.CoverArtMime, nil
+}
+
+// setAlbumArt records the mime type and hash of the cover art image on album,
+// stamping the album updated now if they changed. It returns whether they changed.
+func setAlbumArt(album *art.Album, image []byte, mime string) bool {
+	imageHash := sha256.Sum256(image)
+	if album.CoverArtMime == mime && bytes.Equal(album.CoverArtSha256, imageHash[:]) {
+		return false
+	}
+	album.CoverArtMime = mime
+	album.CoverArtSha256 = imageHash[:]
+	album.UpdatedAt = nowUnix()
+	return true
+}
+
+// keepAlbumSettings copies the price, cover art, genres, and year set for the previously stored version of an album
+// onto album if it has none of its own. previous is nil if no version of the album is stored yet.
+func keepAlbumSettings(previous, album *art.Album) {
+	if previous == nil {
+		return
+	}
+	if album.Price == nil {
+		album.Price = previous.Price
+	}
+	if album.CoverArtMime == "" {
+		album.CoverArtMime = previous.CoverArtMime
+		album.CoverArtSha256 = previous.CoverArtSha256
+	}
+	if len(album.Genres) == 0 {
+		album.Genres = previous.Genres
+	}
+	if album.Year == 0 {
+		album.Year = previous.Year
+	}
 }
@@ -1,7 +1,13 @@
 package audiostrike
 
 import (
+	"context"
 	"github.com/golang/protobuf/proto"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
 
 	art "github.com/audiostrike/music/pkg/art"
@@ -23,11 +29,21 @@ func (s *MockPublisher) Artist() (*art.Artist, error) {
 	return &mockArtist, nil
 }
 
-func (s *MockPublisher) Pubkey() (string, error) {
+func (s *MockPublisher) PublishingArtist(artistID string) (*art.Artist, error) {
+	if artistID != mockArtistID {
+		return nil, ErrArtNotFound
+	}
+	return &mockArtist, nil
+}
+
+func (s *MockPublisher) Pubkey(ctx context.Context) (string, error) {
 	return mockPubkey, nil
 }
 
-func (s *MockPublisher) Sign(resources *art.ArtResources) (*art.ArtistPublication, error) {
+func (s *MockPublisher) Sign(ctx context.Context, artistID string, resources *art.ArtResources) (*art.ArtistPublication, error) {
+	if artistID != mockArtistID {
+		return nil, ErrArtNotFound
+	}
 	marshaledResources, err := proto.Marshal(resources)
 	if err != nil {
 		log.Printf("Marshal %v, error: %v", resources, err)
@@ -40,12 +56,145 @@ func (s *MockPublisher) Sign(resources *art.ArtResources) (*art.ArtistPublicatio
 	}, nil
 }
 
-func (s *MockPublisher) Verify(publication *art.ArtistPublication) (*art.ArtResources, error) {
-	return &art.ArtResources{}, nil
+func (s *MockPublisher) ValidatePublication(ctx context.Context, publication *art.ArtistPublication) (*art.ArtResources, error) {
+	return read(publication)
+}
+
+func (s *MockPublisher) SignMessage(ctx context.Context, message []byte) (string, error) {
+	return mockSignature(message), nil
+}
+
+func (s *MockPublisher) VerifyMessage(ctx context.Context, message []byte, signature string) (string, error) {
+	if signature != mockSignature(message) {
+		return "", ErrSignatureInvalid
+	}
+	return mockPubkey, nil
+}
+
+func (s *MockPublisher) AddInvoice(ctx context.Context, memo string, sats uint64) (string, []byte, error) {
+	return "lnbcrt" + memo, []byte(memo), nil
+}
+
+func (s *MockPublisher) PayInvoice(ctx context.Context, paymentRequest string, maxSats uint64) ([]byte, error) {
+	return []byte(paymentRequest), nil
+}
+
+func (s *MockPublisher) VerifyPayment(ctx context.Context, invoiceHash, preimage []byte) (bool, error) {
+	return true, nil
+}
+
+func (s *MockPublisher) Keysend(ctx context.Context, pubkey string, sats uint64) error {
+	return nil
 }
 
 var mockPublisher MockPublisher
 
+func TestFileServerConformance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk-files")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	runArtServerConformance(t, func() ArtServer {
+		serverDir, err := ioutil.TempDir(dir, "art")
+		if err != nil {
+			t.Fatalf("TempDir error: %v", err)
+		}
+		fileServer, err := NewFileServer(serverDir)
+		if err != nil {
+			t.Fatalf("NewFileServer error: %v", err)
+		}
+		return fileServer
+	})
+}
+
+// TestFileServerConcurrentAccess stores and reads art from many goroutines at once.
+// Run it with -race to check that FileServer is safe for concurrent use.
+func TestFileServerConcurrentAccess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk-files")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fileServer, err := NewFileServer(dir)
+	if err != nil {
+		t.Fatalf("NewFileServer error: %v", err)
+	}
+	err = fileServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+
+	const goroutines, iterations = 8, 50
+	var waitGroup sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		waitGroup.Add(2)
+		go func(g int) {
+			defer waitGroup.Done()
+			for i := 0; i < iterations; i++ {
+				track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "track" + strconv.Itoa(i%10),
+					Title: "Track", ArtistAlbumId: "album", AlbumTrackNumber: uint32(i % 10)}
+				err := fileServer.StoreTrack(track, &mockPublisher)
+				if err != nil {
+					t.Errorf("StoreTrack error: %v", err)
+					return
+				}
+				err = fileServer.StoreTrackPayload(track, []byte("payload "+strconv.Itoa(g)))
+				if err != nil {
+					t.Errorf("StoreTrackPayload error: %v", err)
+					return
+				}
+				err = fileServer.SetTrackPrice(track, uint64(i))
+				if err != nil {
+					t.Errorf("SetTrackPrice error: %v", err)
+					return
+				}
+				err = fileServer.StorePeer(&art.Peer{Pubkey: mockPubkey, Host: "host" + strconv.Itoa(g)}, &mockPublisher)
+				if err != nil {
+					t.Errorf("StorePeer error: %v", err)
+					return
+				}
+				err = fileServer.StorePeerReputation(&art.PeerReputation{Pubkey: mockPubkey, FailureCount: uint32(i)})
+				if err != nil {
+					t.Errorf("StorePeerReputation error: %v", err)
+					return
+				}
+			}
+		}(g)
+		go func() {
+			defer waitGroup.Done()
+			for i := 0; i < iterations; i++ {
+				tracks, err := fileServer.Tracks(mockArtistID)
+				if err != nil {
+					t.Errorf("Tracks error: %v", err)
+					return
+				}
+				for _, track := range tracks {
+					_ = track.GetPrice().GetSats() + uint64(len(track.PayloadSha256))
+				}
+				_, _ = fileServer.AlbumTracks(mockArtistID, "album")
+				_, _ = fileServer.SearchTracks("track", TrackFilter{})
+				_, _ = fileServer.TracksPage(mockArtistID, 0, 5)
+				_, _ = fileServer.Artists()
+				_, _ = fileServer.Peers()
+				reputation, err := fileServer.PeerReputation(mockPubkey)
+				if err != nil {
+					t.Errorf("PeerReputation error: %v", err)
+					return
+				}
+				reputation.FailureCount++
+			}
+		}()
+	}
+	waitGroup.Wait()
+
+	tracks, err := fileServer.Tracks(mockArtistID)
+	if err != nil || len(tracks) != 10 {
+		t.Errorf("expected 10 tracks stored but got %d, error: %v", len(tracks), err)
+	}
+}
+
 func TestSaveAndLoadFromPub(t *testing.T) {
 	savingFileServer, err := NewFileServer(rootPath)
 	if err != nil {
@@ -61,7 +210,7 @@ func TestSaveAndLoadFromPub(t *testing.T) {
 		Artists: []*art.Artist{&mockArtist},
 		Tracks:  []*art.Track{&mockTrack},
 	}
-	publication, err := mockPublisher.Sign(resources)
+	publication, err := mockPublisher.Sign(context.Background(), mockArtistID, resources)
 	if err != nil {
 		t.Errorf("failed to sign resources %v, error: %v", resources, err)
 	}
@@ -86,6 +235,98 @@ func TestSaveAndLoadFromPub(t *testing.T) {
 
 }
 
+// TestNewFileServerMalformedArtFile tests that NewFileServer returns an error rather than exiting
+// when an artist's .art file cannot be read as art resources.
+func TestNewFileServerMalformedArtFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk-files")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	artistDir := filepath.Join(dir, mockArtistID)
+	err = os.Mkdir(artistDir, 0755)
+	if err != nil {
+		t.Fatalf("Mkdir error: %v", err)
+	}
+	// Field number 0 is invalid in protobuf, so these bytes cannot unmarshal.
+	err = ioutil.WriteFile(filepath.Join(artistDir, ".art"), []byte{0x00, 0x00}, 0644)
+	if err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	fileServer, err := NewFileServer(dir)
+	if err == nil {
+		t.Errorf("expected error reading malformed .art file but got file server %v", fileServer)
+	} else if fileServer != nil {
+		t.Errorf("expected no file server with error %v", err)
+	}
+}
+
+// TestFileServerPayloadDir verifies that a FileServer with a separate payload directory stores payloads there,
+// keeping the rest of the art in its art directory, and serves them again after it restarts.
+func TestFileServerPayloadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk-files")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	artDir := filepath.Join(dir, "ssd")
+	payloadDir := filepath.Join(dir, "hdd")
+	fileServer, err := NewFileServerWithPayloadDir(artDir, payloadDir)
+	if err != nil {
+		t.Fatalf("NewFileServerWithPayloadDir error: %v", err)
+	}
+	err = fileServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID, Title: "Test Track"}
+	err = fileServer.StoreTrack(track, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	err = fileServer.StoreTrackPayload(track, []byte("payload"))
+	if err != nil {
+		t.Fatalf("StoreTrackPayload error: %v", err)
+	}
+	if path := fileServer.TrackFilePath(track); filepath.Dir(filepath.Dir(path)) != payloadDir {
+		t.Errorf("expected payload under %s but got %s", payloadDir, path)
+	}
+	if _, err = os.Stat(payloadPath(artDir, track)); !os.IsNotExist(err) {
+		t.Errorf("expected no payload under the art directory but got %v", err)
+	}
+	resources := &art.ArtResources{Artists: []*art.Artist{&mockArtist}, Tracks: []*art.Track{track}}
+	publication, err := mockPublisher.Sign(context.Background(), mockArtistID, resources)
+	if err != nil {
+		t.Fatalf("Sign error: %v", err)
+	}
+	err = fileServer.StorePublication(publication)
+	if err != nil {
+		t.Fatalf("StorePublication error: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(artDir, mockArtistID, ".art")); err != nil {
+		t.Errorf("expected .art file under the art directory but got %v", err)
+	}
+
+	restartedServer, err := NewFileServerWithPayloadDir(artDir, payloadDir)
+	if err != nil {
+		t.Fatalf("NewFileServerWithPayloadDir error: %v", err)
+	}
+	reader, err := restartedServer.TrackFilePartialReader(track, 0)
+	if err != nil {
+		t.Fatalf("TrackFilePartialReader error: %v", err)
+	}
+	payload, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(payload) != "payload" {
+		t.Errorf("expected stored payload after restart but got %q, error: %v", payload, err)
+	}
+	report, err := VerifyArt(restartedServer, payloadDir, false)
+	if err != nil || !report.OK() {
+		t.Errorf("expected verified art but got %v, error: %v", report, err)
+	}
+}
+
 // TODO: test that TestNameToID is used for all IDs created from external input.
 
 // TestNameToID verifies that TitleToID converts the given name to lower case, strips white space and punctuation,
@@ -113,6 +354,29 @@ func TestTitleToHierarchy(t *testing.T) {
 	}
 }
 
+// TestHierarchyRules verifies that album titles split into levels at the configured separator
+// and that levels left empty by normalization are dropped.
+func TestHierarchyRules(t *testing.T) {
+	tests := []struct {
+		separator string
+		title     string
+		expected  string
+	}{
+		{"", "Anthology / Disc 1", "anthology/disc1"},
+		{"/", "AC/DC Live", "ac/dclive"},
+		{" - ", "AC/DC Live - Disc 1", "acdclive/disc1"},
+		{" - ", "Anthology -  - Disc 1", "anthology/disc1"},
+		{"/", "/ Anthology // ?! / Disc 1 /", "anthology/disc1"},
+	}
+	for _, test := range tests {
+		hierarchy := HierarchyRules{Separator: test.separator}.Normalize(test.title)
+		if hierarchy != test.expected {
+			t.Errorf("expected %q separated by %q to normalize to %s but got %s",
+				test.title, test.separator, test.expected, hierarchy)
+		}
+	}
+}
+
 // TestStoreTrack verifies that a Track sent to StoreTrack is retrieved by its unique ArtistId and ArtistTrackId.
 func TestStoreTrack(t *testing.T) {
 	fileServer, err := NewFileServer(rootPath)
@@ -221,3 +485,156 @@ func TestPeers(t *testing.T) {
 			fetchedPeer.Pubkey, mockPubkey)
 	}
 }
+
+// TestDeletePeerFromArtFile verifies that a FileServer deleting a peer rewrites the .art files that list it,
+// and that a temporary file left beside an .art file by an interrupted write does not keep it from reopening.
+func TestDeletePeerFromArtFile(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	err = fileServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	err = fileServer.StorePeer(&art.Peer{Pubkey: mockPubkey, Host: "localhost", Port: 53545}, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StorePeer error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	err = austkServer.publish(mockArtistID)
+	if err != nil {
+		t.Fatalf("publish error: %v", err)
+	}
+	err = fileServer.DeletePeer(mockPubkey)
+	if err != nil {
+		t.Fatalf("DeletePeer error: %v", err)
+	}
+	tempPath := filepath.Join(artDir, mockArtistID, ".art.tmp123456")
+	err = ioutil.WriteFile(tempPath, []byte("interrupted"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	reopenedServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("expected the temporary file skipped but got NewFileServer error: %v", err)
+	}
+	_, err = reopenedServer.Peer(mockPubkey)
+	if err != ErrPeerNotFound {
+		t.Errorf("expected deleted peer not read again but got %v", err)
+	}
+	if _, err = os.Stat(tempPath); !os.IsNotExist(err) {
+		t.Errorf("expected the temporary file removed but got %v", err)
+	}
+}
+
+func TestSetTrackPrice(t *testing.T) {
+	fileServer, err := NewFileServer(rootPath)
+	if err != nil {
+		t.Errorf("NewFileServer(%s), error: %v", rootPath, err)
+	}
+
+	track := art.Track{
+		ArtistId:      mockArtistID,
+		ArtistTrackId: "test-set-track-price",
+		Title:         "Test Set Track Price"}
+	err = fileServer.StoreTrack(&track, &mockPublisher)
+	if err != nil {
+		t.Errorf("StoreTrack %v, error: %v", track, err)
+	}
+
+	austkServer := &AustkServer{artServer: fileServer, config: &Config{DefaultPrice: 1000}, publisher: &mockPublisher,
+		logger: componentLogger("server")}
+	price, err := austkServer.EffectiveTrackPrice(&track)
+	if err != nil || price != 1000 {
+		t.Errorf("expected default price 1000 for unpriced track but got %d, error: %v", price, err)
+	}
+
+	err = fileServer.SetTrackPrice(&track, 0)
+	if err != nil {
+		t.Errorf("SetTrackPrice %v, error: %v", track, err)
+	}
+	storedTrack, err := fileServer.Track(mockArtistID, track.ArtistTrackId)
+	if err != nil || storedTrack.Price == nil || storedTrack.Price.Sats != 0 {
+		t.Errorf("expected stored track with price 0 but got %v, error: %v", storedTrack, err)
+	}
+	price, err = austkServer.EffectiveTrackPrice(storedTrack)
+	if err != nil || price != 0 {
+		t.Errorf("expected explicit price 0 for free track but got %d, error: %v", price, err)
+	}
+
+	err = fileServer.SetTrackPrice(&art.Track{ArtistId: mockArtistID, ArtistTrackId: "nosuchtrack"}, 100)
+	if err != ErrArtNotFound {
+		t.Errorf("expected ErrArtNotFound pricing unknown track but got %v", err)
+	}
+}
+
+func TestEffectiveTrackPriceFromAlbum(t *testing.T) {
+	fileServer, err := NewFileServer(rootPath)
+	if err != nil {
+		t.Errorf("NewFileServer(%s), error: %v", rootPath, err)
+	}
+	err = fileServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Errorf("StoreArtist %v, error: %v", mockArtist, err)
+	}
+
+	const testAlbumID = "test-album-price"
+	album := art.Album{ArtistId: mockArtistID, ArtistAlbumId: testAlbumID, Title: "Test Album Price"}
+	err = fileServer.StoreAlbum(&album, &mockPublisher)
+	if err != nil {
+		t.Errorf("StoreAlbum %v, error: %v", album, err)
+	}
+	albumTrack := art.Track{ArtistId: mockArtistID, ArtistAlbumId: testAlbumID, ArtistTrackId: testAlbumID + "/album-priced"}
+	pricedTrack := art.Track{ArtistId: mockArtistID, ArtistAlbumId: testAlbumID, ArtistTrackId: testAlbumID + "/track-priced",
+		PayloadCid: "bafkpinnedbeforepriced"}
+	for _, track := range []*art.Track{&albumTrack, &pricedTrack} {
+		err = fileServer.StoreTrack(track, &mockPublisher)
+		if err != nil {
+			t.Errorf("StoreTrack %v, error: %v", track, err)
+		}
+	}
+	err = fileServer.SetTrackPrice(&pricedTrack, 300)
+	if err != nil {
+		t.Errorf("SetTrackPrice %v, error: %v", pricedTrack, err)
+	}
+	err = fileServer.SetAlbumPrice(&album, 200)
+	if err != nil {
+		t.Errorf("SetAlbumPrice %v, error: %v", album, err)
+	}
+
+	austkServer := &AustkServer{artServer: fileServer, config: &Config{DefaultPrice: 1000}, publisher: &mockPublisher,
+		logger: componentLogger("server")}
+	expectedPrices := map[string]uint64{
+		albumTrack.ArtistTrackId:  200,
+		pricedTrack.ArtistTrackId: 300,
+	}
+	resources, err := austkServer.CollectResources()
+	if err != nil {
+		t.Errorf("CollectResources error: %v", err)
+	}
+	for _, track := range resources.Tracks {
+		expectedPrice, isExpected := expectedPrices[track.ArtistTrackId]
+		if isExpected && track.EffectivePriceSats != expectedPrice {
+			t.Errorf("expected published price %d for %s but got %d",
+				expectedPrice, track.ArtistTrackId, track.EffectivePriceSats)
+		}
+		if isExpected && track.PayloadCid != "" {
+			t.Errorf("expected no CID published for paid track %s but got %s", track.ArtistTrackId, track.PayloadCid)
+		}
+	}
+
+	storedTrack, _ := fileServer.Track(mockArtistID, pricedTrack.ArtistTrackId)
+	if storedTrack.Price == nil || storedTrack.Price.Sats != 300 {
+		t.Errorf("expected album price to keep track price 300 but got %v", storedTrack.Price)
+	}
+}
@@ -0,0 +1,300 @@
+package audiostrike
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/faiface/beep"
+	faifaceflac "github.com/faiface/beep/flac"
+)
+
+const (
+	flacMagic = "fLaC"
+
+	// flacStreamInfoBlockType identifies the metadata block, first in every flac file,
+	// that records the sample rate and length of its audio.
+	flacStreamInfoBlockType = 0
+	flacStreamInfoLength    = 34
+
+	// flacVorbisCommentBlockType identifies the metadata block holding the flac tags.
+	flacVorbisCommentBlockType = 4
+)
+
+// vorbisCommentTags maps vorbis comment field names onto the tag names used for mp3 ID3 tags
+// so that artist, album, title, and the other tags are read the same way regardless of the file format.
+var vorbisCommentTags = map[string]string{
+	"ARTIST":      "Artist",
+	"ALBUM":       "Album",
+	"TITLE":       "Title",
+	"TRACKNUMBER": "Track",
+	"GENRE":       "Genre",
+	"DATE":        "Year",
+}
+
+// Flac exposes the Tags (vorbis comments) and bytes of a given .flac file.
+type Flac struct {
+	path             string
+	buffer           []byte
+	Tags             map[string]string
+	pictures         []Picture
+	playbackFinished chan bool
+}
+
+// OpenFlacToRead opens a flac file to read its data and tags (metadata)
+func OpenFlacToRead(path string) (AudioFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tags, pictures, err := readFlacTags(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Flac{
+		path:     path,
+		Tags:     tags,
+		pictures: pictures,
+	}, nil
+}
+
+// readFlacTags reads the flac metadata blocks from reader and returns its vorbis comments
+// keyed by the same tag names that parseTags uses for mp3 files, and its embedded pictures.
+func readFlacTags(reader io.ReadSeeker) (map[string]string, []Picture, error) {
+	magic := make([]byte, len(flacMagic))
+	_, err := io.ReadFull(reader, magic)
+	if err != nil {
+		return nil, nil, err
+	}
+	if string(magic) != flacMagic {
+		return nil, nil, fmt.Errorf("not a flac file, missing %s marker", flacMagic)
+	}
+
+	tags := map[string]string{
+		"Artist": "",
+		"Album":  "",
+		"Title":  "",
+	}
+	var pictures []Picture
+	for isLastBlock := false; !isLastBlock; {
+		var blockHeader [4]byte
+		_, err = io.ReadFull(reader, blockHeader[:])
+		if err != nil {
+			return nil, nil, err
+		}
+		isLastBlock = blockHeader[0]&0x80 != 0
+		blockType := blockHeader[0] & 0x7f
+		blockLength := int64(blockHeader[1])<<16 | int64(blockHeader[2])<<8 | int64(blockHeader[3])
+
+		if blockType != flacVorbisCommentBlockType && blockType != flacPictureBlockType {
+			_, err = reader.Seek(blockLength, io.SeekCurrent)
+			if err != nil {
+				return nil, nil, err
+			}
+			continue // to next metadata block
+		}
+
+		block := make([]byte, blockLength)
+		_, err = io.ReadFull(reader, block)
+		if err != nil {
+			return nil, nil, err
+		}
+		if blockType == flacPictureBlockType {
+			picture, err := parseFlacPicture(block)
+			if err != nil {
+				return nil, nil, err
+			}
+			pictures = append(pictures, picture)
+			continue // to next metadata block
+		}
+
+		comments, err := parseVorbisComments(block)
+		if err != nil {
+			return nil, nil, err
+		}
+		setVorbisCommentTags(tags, comments)
+		commentPictures, err := vorbisCommentPictures(comments[vorbisPictureField])
+		if err != nil {
+			return nil, nil, err
+		}
+		pictures = append(pictures, commentPictures...)
+	}
+	return tags, pictures, nil
+}
+
+// readFlacDuration reads the sample rate and total samples per channel from the STREAMINFO block of a flac file.
+// The total is 0 if the encoder did not know the length of the audio.
+func readFlacDuration(reader io.Reader) (sampleRate int64, totalSamples int64, err error) {
+	magic := make([]byte, len(flacMagic))
+	_, err = io.ReadFull(reader, magic)
+	if err != nil {
+		return 0, 0, err
+	}
+	if string(magic) != flacMagic {
+		return 0, 0, fmt.Errorf("not a flac file, missing %s marker", flacMagic)
+	}
+	var block [4 + flacStreamInfoLength]byte
+	_, err = io.ReadFull(reader, block[:])
+	if err != nil {
+		return 0, 0, err
+	}
+	if block[0]&0x7f != flacStreamInfoBlockType {
+		return 0, 0, fmt.Errorf("flac file starts with metadata block type %d, not STREAMINFO", block[0]&0x7f)
+	}
+	// After the block and frame sizes, 20 bits of sample rate, 3 of channels, 5 of bits per sample,
+	// then 36 bits of total samples.
+	streamInfo := block[4:]
+	sampleRate = int64(streamInfo[10])<<12 | int64(streamInfo[11])<<4 | int64(streamInfo[12])>>4
+	totalSamples = int64(streamInfo[13]&0x0f)<<32 | int64(binary.BigEndian.Uint32(streamInfo[14:18]))
+	if sampleRate == 0 {
+		return 0, 0, fmt.Errorf("invalid flac sample rate 0")
+	}
+	return sampleRate, totalSamples, nil
+}
+
+// setVorbisCommentTags sets tags from the known fields of vorbis comments.
+// Several GENRE fields are joined to list each genre, but only the first value of other fields is kept.
+func setVorbisCommentTags(tags map[string]string, comments map[string][]string) {
+	for field, values := range comments {
+		tagName, isKnownTag := vorbisCommentTags[field]
+		if !isKnownTag {
+			continue // to next field
+		}
+		if tagName == "Genre" {
+			tags[tagName] = strings.Join(values, ";")
+		} else {
+			tags[tagName] = values[0]
+		}
+	}
+}
+
+// parseVorbisComments parses a vorbis comment block into a map of upper-case field names
+// to the values of each field in the order they appear.
+func parseVorbisComments(block []byte) (map[string][]string, error) {
+	reader := bytes.NewReader(block)
+	var vendorLength uint32
+	err := binary.Read(reader, binary.LittleEndian, &vendorLength)
+	if err != nil {
+		return nil, err
+	}
+	_, err = reader.Seek(int64(vendorLength), io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	var commentCount uint32
+	err = binary.Read(reader, binary.LittleEndian, &commentCount)
+	if err != nil {
+		return nil, err
+	}
+	comments := make(map[string][]string)
+	for i := uint32(0); i < commentCount; i++ {
+		var commentLength uint32
+		err = binary.Read(reader, binary.LittleEndian, &commentLength)
+		if err != nil {
+			return nil, err
+		}
+		if int64(commentLength) > int64(reader.Len()) {
+			return nil, fmt.Errorf("vorbis comment length %d exceeds block", commentLength)
+		}
+		comment := make([]byte, commentLength)
+		_, err = io.ReadFull(reader, comment)
+		if err != nil {
+			return nil, err
+		}
+		fieldAndValue := strings.SplitN(string(comment), "=", 2)
+		if len(fieldAndValue) != 2 {
+			continue // to next comment
+		}
+		field := strings.ToUpper(fieldAndValue[0])
+		comments[field] = append(comments[field], fieldAndValue[1])
+	}
+	return comments, nil
+}
+
+func (flac *Flac) ArtistName() string {
+	return flac.Tags["Artist"]
+}
+
+func (flac *Flac) AlbumTitle() (string, bool) {
+	albumTitle := flac.Tags["Album"]
+	return albumTitle, albumTitle != ""
+}
+
+func (flac *Flac) Title() string {
+	return flac.Tags["Title"]
+}
+
+func (flac *Flac) TrackNumber() uint32 {
+	return parseTrackNumber(flac.Tags["Track"])
+}
+
+func (flac *Flac) Genres() []string {
+	return parseGenres(flac.Tags["Genre"])
+}
+
+func (flac *Flac) Year() uint32 {
+	return parseYear(flac.Tags["Year"])
+}
+
+func (flac *Flac) Container() string {
+	return ContainerFlac
+}
+
+func (flac *Flac) Codec() string {
+	return CodecFlac
+}
+
+func (flac *Flac) CoverArt() *Picture {
+	return coverPicture(flac.pictures)
+}
+
+// Duration reads the length of the audio from the STREAMINFO block, decoding the file only if the block omits it.
+func (flac *Flac) Duration() (time.Duration, error) {
+	file, err := os.Open(flac.path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	sampleRate, totalSamples, err := readFlacDuration(file)
+	if err != nil {
+		return 0, err
+	}
+	if totalSamples == 0 {
+		return decodedDuration(flac)
+	}
+	return samplesDuration(totalSamples, sampleRate), nil
+}
+
+// ReadBytes returns the raw data from the .flac file.
+func (flac *Flac) ReadBytes() ([]byte, error) {
+	if flac.buffer != nil {
+		return flac.buffer, nil
+	}
+
+	buffer, err := ioutil.ReadFile(flac.path)
+	if err != nil {
+		return nil, err
+	}
+	flac.buffer = buffer
+	return flac.buffer, nil
+}
+
+func (flac *Flac) Decode() (beep.StreamSeekCloser, beep.Format, error) {
+	return decodeFile(flac.path, func(file *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+		return faifaceflac.Decode(file)
+	})
+}
+
+func (flac *Flac) PlayAndWait() error {
+	flac.playbackFinished = make(chan bool)
+	return playAndWait(flac.path, flac.Decode, flac.playbackFinished)
+}
@@ -0,0 +1,64 @@
+package audiostrike
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// vorbisComments builds a vorbis comment block with the given comments, as embedded in flac and ogg files.
+func vorbisComments(comments ...string) []byte {
+	var commentBlock bytes.Buffer
+	vendor := "audiostrike test"
+	binary.Write(&commentBlock, binary.LittleEndian, uint32(len(vendor)))
+	commentBlock.WriteString(vendor)
+	binary.Write(&commentBlock, binary.LittleEndian, uint32(len(comments)))
+	for _, comment := range comments {
+		binary.Write(&commentBlock, binary.LittleEndian, uint32(len(comment)))
+		commentBlock.WriteString(comment)
+	}
+	return commentBlock.Bytes()
+}
+
+// flacWithComments builds the metadata header of a flac file with the given vorbis comments.
+func flacWithComments(comments ...string) []byte {
+	commentBlock := bytes.NewBuffer(vorbisComments(comments...))
+
+	var flac bytes.Buffer
+	flac.WriteString(flacMagic)
+	// STREAMINFO block (type 0) of 34 zero bytes, which readFlacTags skips.
+	flac.Write([]byte{0, 0, 0, 34})
+	flac.Write(make([]byte, 34))
+	// Last metadata block: VORBIS_COMMENT (type 4).
+	blockLength := commentBlock.Len()
+	flac.Write([]byte{0x80 | flacVorbisCommentBlockType, byte(blockLength >> 16), byte(blockLength >> 8), byte(blockLength)})
+	flac.Write(commentBlock.Bytes())
+	return flac.Bytes()
+}
+
+// TestReadFlacTags verifies that vorbis comments map onto the same tags as mp3 ID3 tags.
+func TestReadFlacTags(t *testing.T) {
+	flac := flacWithComments("artist=Alice in Chains", "TITLE=Would?", "Album=Dirt", "GENRE=Grunge")
+	tags, _, err := readFlacTags(bytes.NewReader(flac))
+	if err != nil {
+		t.Fatalf("readFlacTags error: %v", err)
+	}
+	expectedTags := map[string]string{
+		"Artist": "Alice in Chains",
+		"Title":  "Would?",
+		"Album":  "Dirt",
+	}
+	for tagName, expected := range expectedTags {
+		if tags[tagName] != expected {
+			t.Errorf("expected %s tag %s but got %s", tagName, expected, tags[tagName])
+		}
+	}
+}
+
+// TestReadFlacTagsRejectsNonFlac verifies that a file without the flac marker is rejected.
+func TestReadFlacTagsRejectsNonFlac(t *testing.T) {
+	_, _, err := readFlacTags(bytes.NewReader([]byte("ID3\x03\x00\x00\x00\x00\x00\x00")))
+	if err == nil {
+		t.Errorf("expected error reading non-flac bytes")
+	}
+}
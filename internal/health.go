@@ -0,0 +1,74 @@
+package audiostrike
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// readinessCacheDuration is how long a readiness check is reused, so frequent probes do not hammer lnd.
+const readinessCacheDuration = 2 * time.Second
+
+// readiness caches the result of the last check whether the server is ready to serve.
+type readiness struct {
+	mutex     sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// lndChecker is a Publisher that can check its connection to lnd, rather than answer from what it cached.
+type lndChecker interface {
+	CheckLnd(ctx context.Context) error
+}
+
+// checkReady checks that lnd answers GetInfo and that the art storage can be read,
+// reusing the result of a check within the last readinessCacheDuration.
+func (server *AustkServer) checkReady(ctx context.Context) error {
+	server.readiness.mutex.Lock()
+	defer server.readiness.mutex.Unlock()
+
+	now := time.Now()
+	if !server.readiness.checkedAt.IsZero() && now.Sub(server.readiness.checkedAt) < readinessCacheDuration {
+		return server.readiness.err
+	}
+	server.readiness.checkedAt = now
+	server.readiness.err = nil
+
+	var err error
+	if checker, isChecker := server.publisher.(lndChecker); isChecker {
+		err = checker.CheckLnd(ctx)
+	} else {
+		_, err = server.publisher.Pubkey(ctx)
+	}
+	if err != nil {
+		server.readiness.err = fmt.Errorf("lnd unreachable: %v", err)
+		return server.readiness.err
+	}
+	_, err = server.artServer.PeersPage(0, 1)
+	if err != nil {
+		server.readiness.err = fmt.Errorf("storage unreachable: %v", err)
+	}
+	return server.readiness.err
+}
+
+// healthzHandler replies that the austk process is up, and which build of austk it runs.
+func (server *AustkServer) healthzHandler(w http.ResponseWriter, req *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok\nversion: " + VersionString() + "\n"))
+}
+
+// readyzHandler replies whether the server can serve art and sell it through lnd,
+// or 503 Service Unavailable with the reason it cannot.
+func (server *AustkServer) readyzHandler(w http.ResponseWriter, req *http.Request) {
+	err := server.checkReady(req.Context())
+	if err != nil {
+		server.logger.Warn("not ready", "error", err)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(err.Error() + "\n"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ready\n"))
+}
@@ -0,0 +1,59 @@
+package audiostrike
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// unreachablePublisher is a MockPublisher whose lnd may be unreachable.
+type unreachablePublisher struct {
+	MockPublisher
+	isUnreachable bool
+}
+
+func (publisher *unreachablePublisher) Pubkey(ctx context.Context) (string, error) {
+	if publisher.isUnreachable {
+		return "", errors.New("connection refused")
+	}
+	return publisher.MockPublisher.Pubkey(ctx)
+}
+
+// TestReadyz tests that /readyz reports 503 with the reason while lnd is unreachable,
+// reusing a recent check, while /healthz reports the process is up and its version.
+func TestReadyz(t *testing.T) {
+	publisher := &unreachablePublisher{}
+	austkServer, err := NewAustkServer(cfg, &mockArtServer, publisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	get := func(handler http.HandlerFunc) (int, string) {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest("GET", "/", nil))
+		body, _ := ioutil.ReadAll(recorder.Body)
+		return recorder.Code, string(body)
+	}
+
+	if status, _ := get(austkServer.readyzHandler); status != http.StatusOK {
+		t.Errorf("expected ready but got %d", status)
+	}
+
+	// A check within the cache duration reuses the last result.
+	publisher.isUnreachable = true
+	if status, _ := get(austkServer.readyzHandler); status != http.StatusOK {
+		t.Errorf("expected cached ready but got %d", status)
+	}
+
+	austkServer.readiness.checkedAt = austkServer.readiness.checkedAt.Add(-readinessCacheDuration)
+	status, body := get(austkServer.readyzHandler)
+	if status != http.StatusServiceUnavailable || !strings.Contains(body, "lnd unreachable") {
+		t.Errorf("expected 503 for unreachable lnd but got %d %s", status, body)
+	}
+	if status, body := get(austkServer.healthzHandler); status != http.StatusOK || !strings.Contains(body, VersionString()) {
+		t.Errorf("expected healthy process with its version but got %d %s", status, body)
+	}
+}
@@ -0,0 +1,108 @@
+package audiostrike
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// DefaultHierarchySeparator separates the levels of an album title, e.g. "Anthology / Disc 1", unless configured.
+const DefaultHierarchySeparator = "/"
+
+// HierarchyRules are the rules that normalize an album title into the hierarchy of its ArtistAlbumId:
+//
+//   - the title is split into levels at each Separator, e.g. "Anthology / Disc 1" into "Anthology " and " Disc 1";
+//   - each level is lowercased and stripped of every character but letters, digits, periods, and dashes,
+//     as NameToID does, so that slashes other than separators are stripped too;
+//   - levels left empty are dropped, and the others are joined with slashes, e.g. "anthology/disc1".
+//
+// Titles that differ only in what is stripped, e.g. "Live!" and "Live?", normalize to the same hierarchy,
+// which AlbumHierarchy disambiguates.
+type HierarchyRules struct {
+	// Separator splits a title into levels, e.g. "/" or " - ". If empty, DefaultHierarchySeparator does.
+	Separator string
+}
+
+// Normalize gets the hierarchy of the album titled title under these rules.
+func (rules HierarchyRules) Normalize(title string) string {
+	separator := rules.Separator
+	if separator == "" {
+		separator = DefaultHierarchySeparator
+	}
+	var levels []string
+	for _, level := range strings.Split(title, separator) {
+		level = NameToID(level)
+		if level != "" {
+			levels = append(levels, level)
+		}
+	}
+	return strings.Join(levels, "/")
+}
+
+// TitleToHierarchy converts an album title into the hierarchy of its ArtistAlbumId
+// under the HierarchyRules with the DefaultHierarchySeparator.
+func TitleToHierarchy(title string) string {
+	return HierarchyRules{}.Normalize(title)
+}
+
+// AlbumHierarchy gets the ArtistAlbumId of the album titled title by the artist with artistID.
+// An album stored with the same title, ignoring case and surrounding space, keeps the id it was stored with,
+// even if stored under other rules, e.g. another -albumseparator, so the stored albums record the id each title
+// maps to. If several are, the one with the title normalized by rules as its id is preferred, or else the first id.
+// Another title gets its normalized id, unless artServer stores a different album with that id. Then the id
+// gets the first suffix -2, -3, and so on that no stored album has.
+func AlbumHierarchy(artServer ArtServer, rules HierarchyRules, artistID string, title string) (string, error) {
+	albums, err := artServer.Albums(artistID)
+	if err != nil && err != ErrArtNotFound {
+		return "", err
+	}
+	hierarchy := rules.Normalize(title)
+	var sameTitleIDs []string
+	for albumID, album := range albums {
+		if isSameAlbumTitle(album.Title, title) {
+			if albumID == hierarchy {
+				return albumID, nil
+			}
+			sameTitleIDs = append(sameTitleIDs, albumID)
+		}
+	}
+	if len(sameTitleIDs) > 0 {
+		sort.Strings(sameTitleIDs)
+		return sameTitleIDs[0], nil
+	}
+	albumID := hierarchy
+	for n := 2; albums[albumID] != nil; n++ {
+		albumID = hierarchy + "-" + strconv.Itoa(n)
+	}
+	return albumID, nil
+}
+
+// isSameAlbumTitle checks whether two album titles name the same album, ignoring case and surrounding space.
+func isSameAlbumTitle(title string, otherTitle string) bool {
+	return strings.EqualFold(strings.TrimSpace(title), strings.TrimSpace(otherTitle))
+}
+
+// disambiguateAudioFileArt sets the ArtistAlbumId of album, the album of track derived by AudioFileArt,
+// to its title's hierarchy under the configured rules, disambiguated from the other stored albums
+// by AlbumHierarchy, and moves track under it.
+func (server *AustkServer) disambiguateAudioFileArt(album *art.Album, track *art.Track) error {
+	if album == nil {
+		return nil
+	}
+	rules := server.config.hierarchyRules()
+	albumID, err := AlbumHierarchy(server.artServer, rules, album.ArtistId, album.Title)
+	if err != nil {
+		server.logger.Error("failed to get album id", "artist_id", album.ArtistId, "title", album.Title, "error", err)
+		return err
+	}
+	if albumID != rules.Normalize(album.Title) {
+		server.logger.Info("disambiguate album id", "artist_id", album.ArtistId, "album_id", albumID, "title", album.Title)
+	}
+	album.ArtistAlbumId = albumID
+	track.ArtistAlbumId = albumID
+	track.ArtistTrackId = filepath.Join(albumID, NameToID(track.Title))
+	return nil
+}
@@ -0,0 +1,375 @@
+package audiostrike
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// importExtensions are the file extensions of the audio files that ImportDirectory imports.
+var importExtensions = map[string]bool{
+	".mp3":  true,
+	".flac": true,
+	".ogg":  true,
+	".oga":  true,
+	".opus": true,
+	".wav":  true,
+}
+
+// ImportFailure is an audio file that ImportDirectory failed to import and why.
+type ImportFailure struct {
+	Filename string
+	Err      error
+}
+
+// ImportResult tells what importing an audio file did with its track.
+type ImportResult int
+
+const (
+	// ImportStored means the track was stored and its art published, as a new track or overwritten with -force.
+	ImportStored ImportResult = iota
+	// ImportSkipped means the track was already stored with the same payload, so it was not stored or published again.
+	ImportSkipped
+)
+
+// ImportReport summarizes the audio files found by ImportDirectory.
+type ImportReport struct {
+	// Imported are the files stored as tracks.
+	Imported []string
+	// Skipped are the files whose tracks were already stored with the same payload.
+	// Files whose tracks were stored with a different payload fail with ErrTrackCollision unless -force is set.
+	Skipped []string
+	// Failed are the files that could not be read or stored.
+	Failed []ImportFailure
+}
+
+// ImportAudioFile reads tags from the audio file named filename
+// and stores an art record for the track, for the artist, and for the album if relevant,
+// then publishes the art signed by the track's artist if hosted or else by the default artist.
+// This lets the austk node host the track for the artist and collect payments to download/stream it.
+//
+// A track already stored with the same payload is skipped unless -force is set.
+// A track stored with a different payload for the same id is kept, returning an error wrapping ErrTrackCollision,
+// unless -force is set to overwrite it.
+func (server *AustkServer) ImportAudioFile(filename string) (AudioFile, ImportResult, error) {
+	audio, err := OpenAudioFile(filename)
+	if err != nil {
+		return nil, ImportStored, err
+	}
+	track, result, err := server.importNewAudioFile(filename, audio)
+	if err != nil || result == ImportSkipped {
+		return audio, result, err
+	}
+	err = server.publish(server.signingArtistID(track.ArtistId))
+	if err != nil {
+		return nil, result, err
+	}
+	return audio, result, nil
+}
+
+// ImportDirectory walks dir recursively to store a track for each mp3, flac, ogg, opus, or wav file,
+// skipping tracks already stored with the same payload, then publishes the art once for each signing artist.
+// It continues past files it fails to import and reports them, returning an error only if dir cannot be read.
+// Symlinks are followed, but each directory is walked only once so symlink loops end.
+func (server *AustkServer) ImportDirectory(dir string) (ImportReport, error) {
+	var report ImportReport
+	_, err := ioutil.ReadDir(dir)
+	if err != nil {
+		server.logger.Error("failed to read import directory", "path", dir, "error", err)
+		return report, err
+	}
+
+	signingArtistIDs := make(map[string]bool)
+	server.importDirectory(dir, make(map[string]bool), signingArtistIDs, &report)
+
+	for artistID := range signingArtistIDs {
+		err = server.publish(artistID)
+		if err != nil {
+			return report, err
+		}
+	}
+	server.logger.Info("imported directory", "path", dir,
+		"imported", len(report.Imported), "skipped", len(report.Skipped), "failed", len(report.Failed))
+	return report, nil
+}
+
+// importDirectory imports the audio files in dir and its subdirectories into report,
+// adding the id of the artist to sign each imported track to signingArtistIDs.
+// visitedDirs has the resolved paths of the directories already walked.
+func (server *AustkServer) importDirectory(dir string, visitedDirs map[string]bool, signingArtistIDs map[string]bool, report *ImportReport) {
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		report.Failed = append(report.Failed, ImportFailure{dir, err})
+		return
+	}
+	if visitedDirs[resolvedDir] {
+		return // already walked through another path, e.g. a symlink loop
+	}
+	visitedDirs[resolvedDir] = true
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		report.Failed = append(report.Failed, ImportFailure{dir, err})
+		return
+	}
+	for _, entry := range entries {
+		filename := filepath.Join(dir, entry.Name())
+		// Stat rather than use entry to follow symlinks.
+		fileInfo, err := os.Stat(filename)
+		if err != nil {
+			report.Failed = append(report.Failed, ImportFailure{filename, err})
+			continue // to next entry
+		}
+		if fileInfo.IsDir() {
+			server.importDirectory(filename, visitedDirs, signingArtistIDs, report)
+			continue // to next entry
+		}
+		if !importExtensions[strings.ToLower(filepath.Ext(filename))] {
+			continue // to next entry, e.g. cover art or a partial download
+		}
+
+		audio, err := OpenAudioFile(filename)
+		if err != nil {
+			report.Failed = append(report.Failed, ImportFailure{filename, err})
+			continue // to next entry
+		}
+		track, result, err := server.importNewAudioFile(filename, audio)
+		if err != nil {
+			report.Failed = append(report.Failed, ImportFailure{filename, err})
+		} else if result == ImportSkipped {
+			report.Skipped = append(report.Skipped, filename)
+		} else {
+			report.Imported = append(report.Imported, filename)
+			signingArtistIDs[server.signingArtistID(track.ArtistId)] = true
+		}
+	}
+}
+
+// importNewAudioFile stores the track of audio, read from the file named filename, unless it is already stored
+// with the same payload or, without -force, with a different payload.
+func (server *AustkServer) importNewAudioFile(filename string, audio AudioFile) (*art.Track, ImportResult, error) {
+	_, album, track := AudioFileArt(audio)
+	err := server.disambiguateAudioFileArt(album, track)
+	if err != nil {
+		return nil, ImportStored, err
+	}
+	logger := server.logger.With("artist_id", track.ArtistId, "track_id", track.ArtistTrackId, "path", filename)
+	storedTrack, err := server.artServer.Track(track.ArtistId, track.ArtistTrackId)
+	if err != nil && err != ErrArtNotFound {
+		return nil, ImportStored, err
+	}
+	// A transcoded track is recognized by the hash of the file added, not of its stored payload.
+	storedHash := storedTrack.GetPayloadSha256()
+	if len(storedTrack.GetOriginalSha256()) > 0 {
+		storedHash = storedTrack.OriginalSha256
+	}
+	if len(storedHash) > 0 {
+		payload, err := audio.ReadBytes()
+		if err != nil {
+			return nil, ImportStored, err
+		}
+		payloadHash := sha256.Sum256(payload)
+		isSamePayload := bytes.Equal(payloadHash[:], storedHash)
+		switch {
+		case server.config.Force:
+			logger.Info("overwrite stored track with -force", "same_payload", isSamePayload)
+		case isSamePayload:
+			logger.Info("skip track already stored with the same payload")
+			return storedTrack, ImportSkipped, nil
+		default:
+			logger.Warn("keep stored track with a different payload for the same id")
+			return nil, ImportStored, fmt.Errorf("%w: %s/%s differs from %s, so add it with -force to overwrite it",
+				ErrTrackCollision, track.ArtistId, track.ArtistTrackId, filename)
+		}
+	}
+
+	track, err = server.storeAudioFile(filename, audio)
+	return track, ImportStored, err
+}
+
+// storeAudioFile stores the art derived from the tags of audio, read from the file named filename,
+// and its payload, pricing the track or album if configured.
+// An album whose title normalizes to the id of another stored album is stored with a disambiguated id.
+// A wav file is transcoded to store its payload in the -transcode format if configured.
+func (server *AustkServer) storeAudioFile(filename string, audio AudioFile) (*art.Track, error) {
+	taggedArtist, album, track := AudioFileArt(audio)
+	err := server.disambiguateAudioFileArt(album, track)
+	if err != nil {
+		return nil, err
+	}
+	artistID := taggedArtist.ArtistId
+	logger := server.logger.With("artist_id", artistID, "track_id", track.ArtistTrackId)
+	logger.Info("store audio file", "path", filename, "title", track.Title, "artist", taggedArtist.Name,
+		"album", album.GetTitle(), "container", track.Container)
+
+	// Read and transcode the payload first so a file that fails stores nothing.
+	trackPayload, err := audio.ReadBytes()
+	if err != nil {
+		logger.Error("failed to read audio file", "path", filename, "error", err)
+		return nil, err
+	}
+	if server.config.Transcode != "" && track.Container == ContainerWav {
+		originalHash := sha256.Sum256(trackPayload)
+		trackPayload, err = Transcode(audio, server.config.Transcode)
+		if err != nil {
+			logger.Error("failed to transcode audio file", "path", filename, "target", server.config.Transcode, "error", err)
+			return nil, err
+		}
+		logger.Info("transcoded audio file", "path", filename, "target", server.config.Transcode, "bytes", len(trackPayload))
+		track.OriginalContainer, track.OriginalCodec, track.OriginalSha256 = track.Container, track.Codec, originalHash[:]
+		track.Container, track.Codec = server.config.Transcode, transcodeCodecs[server.config.Transcode]
+	}
+
+	// Store the artist if not yet known
+	artist, err := server.artServer.Artist(artistID)
+	if err != nil && err != ErrArtNotFound {
+		logger.Error("failed to get artist", "error", err)
+		return nil, err
+	}
+	if artist == nil {
+		artist = taggedArtist
+		if _, err := server.PublishingArtist(artistID); err == nil {
+			logger.Info("store artist with pubkey from lnd")
+			artist.Pubkey, err = server.Pubkey(server.ctx)
+			if err != nil {
+				logger.Error("failed to get pubkey", "error", err)
+				return nil, err
+			}
+		} else {
+			logger.Info("store artist without pubkey")
+		}
+		err = server.artServer.StoreArtist(artist)
+		if err != nil {
+			logger.Error("failed to store artist", "error", err)
+			return nil, err
+		}
+	}
+
+	if album != nil {
+		err = server.artServer.StoreAlbum(album, server)
+		if err != nil {
+			logger.Error("failed to store album", "album_id", album.ArtistAlbumId, "error", err)
+			return nil, err
+		}
+		err = server.storeAlbumCover(album, audio.CoverArt())
+		if err != nil {
+			logger.Error("failed to store album cover art", "album_id", album.ArtistAlbumId, "error", err)
+			return nil, err
+		}
+	}
+
+	// Measure loudness once at ingest. Tracks that cannot be decoded, e.g. opus, are stored without it.
+	track.Loudness, err = measureLoudness(audio)
+	if err != nil {
+		logger.Warn("store track without loudness", "error", err)
+	}
+	// Likewise measure the duration, which mp3 files must be decoded to count.
+	track.DurationMs, err = measureDuration(audio)
+	if err != nil {
+		logger.Warn("store track without duration", "error", err)
+	}
+
+	err = server.artServer.StoreTrack(track, server)
+	if err != nil {
+		logger.Error("failed to store track", "error", err)
+		return nil, err
+	}
+
+	if server.config.Price != nil {
+		err = server.artServer.SetTrackPrice(track, *server.config.Price)
+		if err != nil {
+			logger.Error("failed to set track price", "sats", *server.config.Price, "error", err)
+			return nil, err
+		}
+	}
+	if server.config.AlbumPrice != nil {
+		if album == nil {
+			logger.Warn("skip -albumprice for track without album")
+		} else {
+			err = server.artServer.SetAlbumPrice(album, *server.config.AlbumPrice)
+			if err != nil {
+				logger.Error("failed to set album price", "album_id", album.ArtistAlbumId,
+					"sats", *server.config.AlbumPrice, "error", err)
+				return nil, err
+			}
+		}
+	}
+
+	err = server.artServer.StoreTrackPayload(track, trackPayload)
+	if err != nil {
+		logger.Error("failed to store track payload", "bytes", len(trackPayload), "error", err)
+		return nil, err
+	}
+	// Clip a free preview if configured. Tracks that cannot be decoded are stored without one.
+	if server.config.PreviewSeconds > 0 {
+		err = server.storePreview(track, audio)
+		if err != nil {
+			logger.Warn("store track without preview", "error", err)
+		}
+	}
+	tracksStoredTotal.Inc()
+	return track, nil
+}
+
+// storeAlbumCover stores picture, embedded in a track of the stored album, as the album's cover art.
+// Tracks of an album may embed different pictures. Cover art already stored for the album is kept
+// unless picture is a front cover, and either way the conflict is logged.
+func (server *AustkServer) storeAlbumCover(album *art.Album, picture *Picture) error {
+	if picture == nil {
+		return nil
+	}
+	logger := server.logger.With("artist_id", album.ArtistId, "album_id", album.ArtistAlbumId)
+	pictureHash := sha256.Sum256(picture.Data)
+	if len(album.CoverArtSha256) > 0 && !bytes.Equal(album.CoverArtSha256, pictureHash[:]) {
+		if picture.Type != pictureTypeFrontCover {
+			logger.Warn("keep album cover art that differs from track picture", "picture_type", picture.Type)
+			return nil
+		}
+		logger.Warn("replace album cover art with differing front cover of track")
+	}
+	return server.artServer.StoreAlbumArt(album, picture.Data, picture.Mime)
+}
+
+// signingArtistID gets the id of the artist to sign the art of artistID:
+// the artist if hosted by this server or else the default artist.
+func (server *AustkServer) signingArtistID(artistID string) string {
+	if _, err := server.PublishingArtist(artistID); err == nil {
+		return artistID
+	}
+	return server.config.ArtistID
+}
+
+// publish signs the stored art of the artist with artistID as that artist and stores the publication,
+// leaving the publications of the other hosted artists as they are.
+func (server *AustkServer) publish(artistID string) error {
+	logger := server.logger.With("artist_id", artistID)
+
+	publication, _, err := server.ArtistPublication(server.ctx, artistID, 0)
+	if err != nil {
+		logger.Error("failed to sign resources", "error", err)
+		return err
+	}
+	err = server.artServer.StorePublication(publication)
+	if err != nil {
+		logger.Error("failed to store publication", "error", err)
+		return err
+	}
+	return nil
+}
+
+// String summarizes the report with the reason each failed file failed.
+func (report ImportReport) String() string {
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "imported %d, skipped %d already stored, failed %d",
+		len(report.Imported), len(report.Skipped), len(report.Failed))
+	for _, failure := range report.Failed {
+		fmt.Fprintf(&summary, "\nfailed %s: %v", failure.Filename, failure.Err)
+	}
+	return summary.String()
+}
@@ -0,0 +1,367 @@
+package audiostrike
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// TestImportDirectory tests that ImportDirectory imports the audio files under a directory,
+// reports the files it fails to import, survives a symlink loop, and skips tracks already stored.
+func TestImportDirectory(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+
+	importDir, err := ioutil.TempDir("", "austk-import")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(importDir)
+	albumDir := filepath.Join(importDir, "album")
+	err = os.Mkdir(albumDir, 0755)
+	if err != nil {
+		t.Fatalf("Mkdir error: %v", err)
+	}
+	files := map[string][]byte{
+		filepath.Join(importDir, "single.flac"): flacWithComments("ARTIST=Alice the Artist", "TITLE=Single"),
+		filepath.Join(albumDir, "first.flac"):   flacWithComments("ARTIST=Alice the Artist", "TITLE=First", "ALBUM=Album"),
+		filepath.Join(albumDir, "second.flac"):  flacWithComments("ARTIST=Alice the Artist", "TITLE=Second", "ALBUM=Album"),
+		filepath.Join(albumDir, "cover.jpg"):    []byte("not audio"),
+		filepath.Join(albumDir, "broken.flac"):  []byte("????"),
+	}
+	for filename, contents := range files {
+		err = ioutil.WriteFile(filename, contents, 0644)
+		if err != nil {
+			t.Fatalf("WriteFile %s error: %v", filename, err)
+		}
+	}
+	err = os.Symlink(importDir, filepath.Join(albumDir, "loop"))
+	if err != nil {
+		t.Fatalf("Symlink error: %v", err)
+	}
+
+	report, err := austkServer.ImportDirectory(importDir)
+	if err != nil {
+		t.Fatalf("ImportDirectory error: %v", err)
+	}
+	if len(report.Imported) != 3 || len(report.Skipped) != 0 || len(report.Failed) != 1 {
+		t.Errorf("expected 3 imported and 1 failed but got %v", report)
+	} else if report.Failed[0].Filename != filepath.Join(albumDir, "broken.flac") {
+		t.Errorf("expected broken.flac to fail but got %v", report)
+	}
+	for _, artistTrackID := range []string{"single", filepath.Join("album", "first"), filepath.Join("album", "second")} {
+		track, err := fileServer.Track(mockArtistID, artistTrackID)
+		if err != nil {
+			t.Errorf("expected imported track %s but got error: %v", artistTrackID, err)
+		} else if err = fileServer.VerifyStoredTrack(track); err != nil {
+			t.Errorf("VerifyStoredTrack %s error: %v", artistTrackID, err)
+		}
+	}
+
+	report, err = austkServer.ImportDirectory(importDir)
+	if err != nil {
+		t.Fatalf("ImportDirectory again, error: %v", err)
+	}
+	if len(report.Imported) != 0 || len(report.Skipped) != 3 {
+		t.Errorf("expected 3 tracks skipped as already stored but got %v", report)
+	}
+
+	_, err = austkServer.ImportDirectory(filepath.Join(importDir, "missing"))
+	if err == nil {
+		t.Errorf("expected error importing missing directory")
+	}
+}
+
+// TestImportAlbumCover tests that the cover art of an album is stored from the pictures embedded in its tracks,
+// preferring a front cover over other pictures, and that the art directory with cover art can be read again.
+func TestImportAlbumCover(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+
+	importDir, err := ioutil.TempDir("", "austk-import")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(importDir)
+	tracks := []struct {
+		title   string
+		picture []byte
+	}{
+		{"First", flacPicture(4, "image/jpeg", []byte("back cover"))},
+		{"Second", flacPicture(pictureTypeFrontCover, "image/jpeg", []byte("front cover"))},
+		{"Third", flacPicture(4, "image/jpeg", []byte("other back cover"))},
+	}
+	for _, track := range tracks {
+		filename := filepath.Join(importDir, track.title+".flac")
+		comments := []string{"ARTIST=Alice the Artist", "ALBUM=Album", "TITLE=" + track.title}
+		err = ioutil.WriteFile(filename, flacWithPictures(comments, track.picture), 0644)
+		if err != nil {
+			t.Fatalf("WriteFile %s error: %v", filename, err)
+		}
+		_, _, err = austkServer.ImportAudioFile(filename)
+		if err != nil {
+			t.Fatalf("ImportAudioFile %s error: %v", filename, err)
+		}
+	}
+
+	image, mime, err := fileServer.AlbumArt(mockArtistID, "album")
+	if err != nil || string(image) != "front cover" || mime != "image/jpeg" {
+		t.Errorf("expected jpeg front cover but got %s %s, error: %v", mime, image, err)
+	}
+
+	rereadFileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s) with cover art, error: %v", artDir, err)
+	}
+	image, _, err = rereadFileServer.AlbumArt(mockArtistID, "album")
+	if err != nil || string(image) != "front cover" {
+		t.Errorf("expected front cover after reading art directory again but got %s, error: %v", image, err)
+	}
+}
+
+// TestImportDuplicateTrack tests that adding a file again skips its track without publishing it again,
+// that a different file for the same track fails without -force, and that -force overwrites it.
+func TestImportDuplicateTrack(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	forceCfg := *cfg
+	forceCfg.Force = true
+	forceServer, err := NewAustkServer(&forceCfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer with -force error: %v", err)
+	}
+
+	filename := filepath.Join(artDir, "single.flac")
+	err = ioutil.WriteFile(filename, flacWithComments("ARTIST=Alice the Artist", "TITLE=Single"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile %s error: %v", filename, err)
+	}
+	_, result, err := austkServer.ImportAudioFile(filename)
+	if err != nil || result != ImportStored {
+		t.Fatalf("expected track stored but got result %v, error: %v", result, err)
+	}
+	_, result, err = austkServer.ImportAudioFile(filename)
+	if err != nil || result != ImportSkipped {
+		t.Errorf("expected track skipped when added again but got result %v, error: %v", result, err)
+	}
+	_, result, err = forceServer.ImportAudioFile(filename)
+	if err != nil || result != ImportStored {
+		t.Errorf("expected track stored again with -force but got result %v, error: %v", result, err)
+	}
+
+	err = ioutil.WriteFile(filename, flacWithComments("ARTIST=Alice the Artist", "TITLE=Single", "GENRE=Remix"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile %s error: %v", filename, err)
+	}
+	_, _, err = austkServer.ImportAudioFile(filename)
+	if !errors.Is(err, ErrTrackCollision) {
+		t.Errorf("expected ErrTrackCollision adding different file for the same track but got %v", err)
+	}
+	_, result, err = forceServer.ImportAudioFile(filename)
+	if err != nil || result != ImportStored {
+		t.Errorf("expected different file stored with -force but got result %v, error: %v", result, err)
+	}
+	track, err := fileServer.Track(mockArtistID, "single")
+	if err != nil {
+		t.Fatalf("Track error: %v", err)
+	}
+	if err = fileServer.VerifyStoredTrack(track); err != nil {
+		t.Errorf("expected overwritten payload to match its track but got error: %v", err)
+	}
+}
+
+// TestImportTranscodedWav tests that a wav file added with -transcode flac is stored as flac,
+// recording the format added, and is recognized as already stored when added again.
+func TestImportTranscodedWav(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	defer fakeFlacEncoder(t, artDir)()
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	transcodeCfg := *cfg
+	transcodeCfg.Transcode = ContainerFlac
+	austkServer, err := NewAustkServer(&transcodeCfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+
+	filename := filepath.Join(artDir, "master.wav")
+	err = ioutil.WriteFile(filename, wavWithInfo("IART", "Alice the Artist", "INAM", "Master"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile %s error: %v", filename, err)
+	}
+	_, result, err := austkServer.ImportAudioFile(filename)
+	if err != nil || result != ImportStored {
+		t.Fatalf("expected wav stored but got result %v, error: %v", result, err)
+	}
+	track, err := fileServer.Track(mockArtistID, "master")
+	if err != nil {
+		t.Fatalf("Track error: %v", err)
+	}
+	if track.Container != ContainerFlac || track.Codec != CodecFlac ||
+		track.OriginalContainer != ContainerWav || track.OriginalCodec != CodecPcm || len(track.OriginalSha256) == 0 {
+		t.Errorf("expected flac track transcoded from wav but got %v", track)
+	}
+	payload, err := ioutil.ReadFile(fileServer.TrackFilePath(track))
+	if err != nil || !bytes.HasPrefix(payload, []byte(flacMagic)) {
+		t.Errorf("expected flac payload stored but got %q, error: %v", payload, err)
+	}
+
+	_, result, err = austkServer.ImportAudioFile(filename)
+	if err != nil || result != ImportSkipped {
+		t.Errorf("expected wav skipped when added again but got result %v, error: %v", result, err)
+	}
+}
+
+// TestImportAlbumCollision tests that two albums whose titles normalize to the same id are both stored,
+// the second with a disambiguated id, that their tracks with the same title do not overwrite each other,
+// that adding a file of the second album again finds its track under the disambiguated id,
+// and that a title matches the id an album was stored with under other rules.
+func TestImportAlbumCollision(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+
+	importDir, err := ioutil.TempDir("", "austk-import")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(importDir)
+	tests := []struct {
+		filename        string
+		albumTitle      string
+		expectedAlbumID string
+	}{
+		{"live.flac", "Live!", "live"},
+		{"live-again.flac", "Live?", "live-2"},
+		{"live-once-more.flac", "LIVE!", "live"},
+	}
+	for _, test := range tests {
+		filename := filepath.Join(importDir, test.filename)
+		err = ioutil.WriteFile(filename,
+			flacWithComments("ARTIST=Alice the Artist", "TITLE=Intro", "ALBUM="+test.albumTitle, "COMMENT="+test.filename), 0644)
+		if err != nil {
+			t.Fatalf("WriteFile %s error: %v", filename, err)
+		}
+	}
+
+	for _, test := range tests[:2] {
+		_, _, err = austkServer.ImportAudioFile(filepath.Join(importDir, test.filename))
+		if err != nil {
+			t.Fatalf("ImportAudioFile %s error: %v", test.filename, err)
+		}
+		albums, err := fileServer.Albums(mockArtistID)
+		album := albums[test.expectedAlbumID]
+		if err != nil || album == nil || album.Title != test.albumTitle {
+			t.Errorf("expected album %q stored as %s but got %v, error: %v", test.albumTitle, test.expectedAlbumID, albums, err)
+		}
+		trackID := filepath.Join(test.expectedAlbumID, "intro")
+		track, err := fileServer.Track(mockArtistID, trackID)
+		if err != nil || track.ArtistAlbumId != test.expectedAlbumID {
+			t.Errorf("expected track %s on album %s but got %v, error: %v", trackID, test.expectedAlbumID, track, err)
+		}
+	}
+
+	_, result, err := austkServer.ImportAudioFile(filepath.Join(importDir, tests[1].filename))
+	if err != nil || result != ImportSkipped {
+		t.Errorf("expected track of disambiguated album skipped as already stored but got %v, error: %v", result, err)
+	}
+	// The same album titled in other case is the album already stored, so its track collides with that album's.
+	_, _, err = austkServer.ImportAudioFile(filepath.Join(importDir, tests[2].filename))
+	if !errors.Is(err, ErrTrackCollision) {
+		t.Errorf("expected ErrTrackCollision adding another track to the same album but got %v", err)
+	}
+
+	albumID, err := AlbumHierarchy(fileServer, HierarchyRules{}, mockArtistID, "Live.")
+	if err != nil || albumID != "live." {
+		t.Errorf("expected album id live. for a title without a collision but got %s, error: %v", albumID, err)
+	}
+	albumID, err = AlbumHierarchy(fileServer, HierarchyRules{}, mockArtistID, "Live")
+	if err != nil || albumID != "live-3" {
+		t.Errorf("expected album id live-3 for a third album titled the same but got %s, error: %v", albumID, err)
+	}
+
+	// An album stored under another separator keeps its id for its title.
+	err = fileServer.StoreAlbum(&art.Album{ArtistId: mockArtistID, ArtistAlbumId: "anthology/disc1",
+		Title: "Anthology - Disc 1"}, mockLightningNode)
+	if err != nil {
+		t.Fatalf("StoreAlbum error: %v", err)
+	}
+	albumID, err = AlbumHierarchy(fileServer, HierarchyRules{}, mockArtistID, "anthology - disc 1")
+	if err != nil || albumID != "anthology/disc1" {
+		t.Errorf("expected album id anthology/disc1 stored for the title but got %s, error: %v", albumID, err)
+	}
+}
@@ -0,0 +1,54 @@
+package audiostrike
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// maxInvoiceMemoBytes is the longest memo lnd accepts on an invoice, so longer resolved memos are cut short.
+const maxInvoiceMemoBytes = 1024
+
+// invoiceMemoFieldRegex matches a {field} of an invoice memo template.
+var invoiceMemoFieldRegex = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// invoiceMemoFields resolve each field that a -invoicememo template may use from the track sold, its artist,
+// and its price.
+var invoiceMemoFields = map[string]func(artist *art.Artist, track *art.Track, sats uint64) string{
+	"artistName": func(artist *art.Artist, track *art.Track, sats uint64) string { return artist.Name },
+	"artistId":   func(artist *art.Artist, track *art.Track, sats uint64) string { return track.ArtistId },
+	"trackTitle": func(artist *art.Artist, track *art.Track, sats uint64) string { return track.Title },
+	"trackId":    func(artist *art.Artist, track *art.Track, sats uint64) string { return track.ArtistTrackId },
+	"albumId":    func(artist *art.Artist, track *art.Track, sats uint64) string { return track.ArtistAlbumId },
+	"sats":       func(artist *art.Artist, track *art.Track, sats uint64) string { return strconv.FormatUint(sats, 10) },
+}
+
+// validateInvoiceMemo checks that the memo template uses only the fields of invoiceMemoFields.
+func validateInvoiceMemo(template string) error {
+	for _, match := range invoiceMemoFieldRegex.FindAllStringSubmatch(template, -1) {
+		if _, isKnown := invoiceMemoFields[match[1]]; !isKnown {
+			return fmt.Errorf("invalid -invoicememo %q: unknown field {%s}, use {artistName}, {artistId}, "+
+				"{trackTitle}, {trackId}, {albumId}, or {sats}", template, match[1])
+		}
+	}
+	return nil
+}
+
+// resolveInvoiceMemo fills the fields of the memo template for track by artist sold for sats,
+// cutting the memo to the length lnd accepts. Unknown fields, which validateInvoiceMemo rejects, are left as is.
+func resolveInvoiceMemo(template string, artist *art.Artist, track *art.Track, sats uint64) string {
+	memo := invoiceMemoFieldRegex.ReplaceAllStringFunc(template, func(field string) string {
+		resolve, isKnown := invoiceMemoFields[field[1:len(field)-1]]
+		if !isKnown {
+			return field
+		}
+		return resolve(artist, track, sats)
+	})
+	if len(memo) > maxInvoiceMemoBytes {
+		memo = strings.ToValidUTF8(memo[:maxInvoiceMemoBytes], "")
+	}
+	return memo
+}
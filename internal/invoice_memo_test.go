@@ -0,0 +1,48 @@
+package audiostrike
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// TestInvoiceMemo verifies that an invoice memo template resolves its fields from the track sold,
+// that a memo too long for lnd is cut to a valid length, and that a template with an unknown field is invalid.
+func TestInvoiceMemo(t *testing.T) {
+	artist := &art.Artist{ArtistId: mockArtistID, Name: "Alice"}
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID, ArtistAlbumId: "album", Title: "Song"}
+	tests := []struct {
+		template     string
+		expectedMemo string
+	}{
+		{defaultInvoiceMemo, mockArtistID + "/" + mockTrackID + " by Alice"},
+		{"{trackTitle} ({albumId}) by {artistId} for {sats} sats", "Song (album) by " + mockArtistID + " for 1000 sats"},
+		{"{trackId}", mockTrackID},
+		{"audiostrike", "audiostrike"},
+	}
+	for _, test := range tests {
+		err := validateInvoiceMemo(test.template)
+		if err != nil {
+			t.Errorf("expected %q valid but got error %v", test.template, err)
+		}
+		if memo := resolveInvoiceMemo(test.template, artist, track, 1000); memo != test.expectedMemo {
+			t.Errorf("expected %q to resolve to %q but got %q", test.template, test.expectedMemo, memo)
+		}
+	}
+
+	longTrack := *track
+	longTrack.Title = strings.Repeat("é", maxInvoiceMemoBytes)
+	memo := resolveInvoiceMemo("{trackTitle}", artist, &longTrack, 1000)
+	if len(memo) > maxInvoiceMemoBytes || !utf8.ValidString(memo) || !strings.HasPrefix(longTrack.Title, memo) {
+		t.Errorf("expected memo cut to %d bytes of valid utf-8 but got %d bytes", maxInvoiceMemoBytes, len(memo))
+	}
+
+	for _, template := range []string{"{artistName} - {title}", "{}"} {
+		err := validateInvoiceMemo(template)
+		if err == nil || !strings.Contains(err.Error(), "-invoicememo") {
+			t.Errorf("expected -invoicememo %q invalid but got error %v", template, err)
+		}
+	}
+}
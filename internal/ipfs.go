@@ -0,0 +1,266 @@
+package audiostrike
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// ipfsTimeout limits each request to the IPFS node or gateway, including reading its reply,
+// so a stalled fetch falls back to the peer rather than blocking a sync.
+const ipfsTimeout = 10 * time.Minute
+
+// IPFSNode pins track payloads in IPFS with the RPC api of a local IPFS node, e.g. kubo,
+// and fetches pinned payloads by their CID from that node or else from an IPFS gateway.
+// A payload pinned in IPFS is public to anyone who knows its CID, which is published with its track,
+// so only the payloads of free tracks are pinned.
+type IPFSNode struct {
+	// apiURL is the url of the RPC api of the local IPFS node, e.g. http://127.0.0.1:5001, or nil.
+	apiURL *url.URL
+	// gatewayURL is the url of the IPFS gateway to fetch payloads from if there is no local node, or nil.
+	gatewayURL *url.URL
+	httpClient *http.Client
+
+	logger *slog.Logger
+}
+
+// NewIPFSNode creates an IPFSNode for the configured -ipfsapi and -ipfsgateway,
+// or gets nil if neither is configured, to store and fetch payloads without IPFS.
+func NewIPFSNode(cfg *Config) (*IPFSNode, error) {
+	if cfg.IPFSAPI == "" && cfg.IPFSGateway == "" {
+		return nil, nil
+	}
+	ipfsNode := &IPFSNode{
+		httpClient: &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone(), Timeout: ipfsTimeout},
+		logger:     cfg.componentLogger("ipfsNode"),
+	}
+	var err error
+	if cfg.IPFSAPI != "" {
+		ipfsNode.apiURL, err = parseIPFSURL("ipfs api", cfg.IPFSAPI)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.IPFSGateway != "" {
+		ipfsNode.gatewayURL, err = parseIPFSURL("ipfs gateway", cfg.IPFSGateway)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ipfsNode, nil
+}
+
+func parseIPFSURL(name string, rawURL string) (*url.URL, error) {
+	parsedURL, err := url.Parse(strings.TrimSuffix(rawURL, "/"))
+	if err != nil || parsedURL.Host == "" || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") {
+		return nil, fmt.Errorf("invalid %s url %q: use a url like http://127.0.0.1:5001", name, rawURL)
+	}
+	return parsedURL, nil
+}
+
+// StorePayload adds the payload of track to the local IPFS node, pins it, and records its CID as track.PayloadCid.
+func (ipfsNode *IPFSNode) StorePayload(track *art.Track, payload []byte) error {
+	if ipfsNode.apiURL == nil {
+		return fmt.Errorf("no -ipfsapi node to pin the payload of %s/%s", track.ArtistId, track.ArtistTrackId)
+	}
+	var form bytes.Buffer
+	formWriter := multipart.NewWriter(&form)
+	fileWriter, err := formWriter.CreateFormFile("file", objectKey(track))
+	if err != nil {
+		return err
+	}
+	fileWriter.Write(payload)
+	formWriter.Close()
+
+	// CIDv1 with raw leaves names the same bytes with the same CID on every node that adds them so.
+	query := url.Values{"pin": {"true"}, "cid-version": {"1"}, "raw-leaves": {"true"}}
+	response, err := ipfsNode.callAPI("add", query, formWriter.FormDataContentType(), &form)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	var added struct {
+		Hash string
+	}
+	err = json.NewDecoder(response.Body).Decode(&added)
+	if err != nil || added.Hash == "" {
+		return fmt.Errorf("failed to read CID added to ipfs for %s/%s: %v", track.ArtistId, track.ArtistTrackId, err)
+	}
+	track.PayloadCid = added.Hash
+	ipfsNode.logger.Debug("pinned payload", "artist_id", track.ArtistId, "track_id", track.ArtistTrackId,
+		"cid", added.Hash, "bytes", len(payload))
+	return nil
+}
+
+// OpenPayload opens the payload of track, by its PayloadCid, to read from the byte at offset.
+// It wraps ErrArtNotFound if track has no CID.
+func (ipfsNode *IPFSNode) OpenPayload(track *art.Track, offset int64) (io.ReadCloser, error) {
+	if track.PayloadCid == "" {
+		return nil, fmt.Errorf("no payload cid for track %s/%s: %w", track.ArtistId, track.ArtistTrackId, ErrArtNotFound)
+	}
+	if ipfsNode.apiURL != nil {
+		query := url.Values{"arg": {track.PayloadCid}}
+		if offset > 0 {
+			query.Set("offset", strconv.FormatInt(offset, 10))
+		}
+		response, err := ipfsNode.callAPI("cat", query, "", nil)
+		if err != nil {
+			return nil, err
+		}
+		return response.Body, nil
+	}
+
+	header := make(http.Header)
+	if offset > 0 {
+		header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	response, err := ipfsNode.getGateway("GET", track.PayloadCid, header)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// A range starting at the end of the payload reads nothing, like a file read from its end.
+		response.Body.Close()
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}
+	if offset > 0 && response.StatusCode != http.StatusPartialContent {
+		response.Body.Close()
+		return nil, fmt.Errorf("ipfs gateway ignored range from %d of %s", offset, track.PayloadCid)
+	}
+	return response.Body, nil
+}
+
+// PayloadSize gets the length in bytes of the payload of track, by its PayloadCid.
+func (ipfsNode *IPFSNode) PayloadSize(track *art.Track) (int64, error) {
+	if track.PayloadCid == "" {
+		return 0, fmt.Errorf("no payload cid for track %s/%s: %w", track.ArtistId, track.ArtistTrackId, ErrArtNotFound)
+	}
+	if ipfsNode.apiURL != nil {
+		response, err := ipfsNode.callAPI("files/stat", url.Values{"arg": {"/ipfs/" + track.PayloadCid}}, "", nil)
+		if err != nil {
+			return 0, err
+		}
+		defer response.Body.Close()
+		var stat struct {
+			Size int64
+		}
+		err = json.NewDecoder(response.Body).Decode(&stat)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read size of %s from ipfs: %w", track.PayloadCid, err)
+		}
+		return stat.Size, nil
+	}
+	response, err := ipfsNode.getGateway("HEAD", track.PayloadCid, nil)
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+	return response.ContentLength, nil
+}
+
+// DeletePayload unpins the payload of track from the local IPFS node, for its garbage collection to remove.
+// A payload that is not pinned has nothing to unpin.
+func (ipfsNode *IPFSNode) DeletePayload(track *art.Track) error {
+	if track.PayloadCid == "" || ipfsNode.apiURL == nil {
+		return nil
+	}
+	response, err := ipfsNode.callAPI("pin/rm", url.Values{"arg": {track.PayloadCid}}, "", nil)
+	if err != nil {
+		if strings.Contains(err.Error(), "not pinned") {
+			return nil
+		}
+		return err
+	}
+	response.Body.Close()
+	ipfsNode.logger.Debug("unpinned payload", "artist_id", track.ArtistId, "track_id", track.ArtistTrackId,
+		"cid", track.PayloadCid)
+	return nil
+}
+
+// Download fetches the payload of track by its PayloadCid into filename, for a client to store it
+// as if downloaded from the peer that published it.
+func (ipfsNode *IPFSNode) Download(track *art.Track, filename string) error {
+	payloadReader, err := ipfsNode.OpenPayload(track, 0)
+	if err != nil {
+		return err
+	}
+	defer payloadReader.Close()
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, payloadReader)
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// callAPI posts body to the command of the local node's RPC api with the query,
+// getting the response if the command succeeded or else an error with its message.
+func (ipfsNode *IPFSNode) callAPI(command string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	commandURL := *ipfsNode.apiURL
+	commandURL.Path += "/api/v0/" + command
+	commandURL.RawQuery = query.Encode()
+	req, err := http.NewRequest("POST", commandURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	response, err := ipfsNode.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		var failure struct {
+			Message string
+		}
+		json.NewDecoder(io.LimitReader(response.Body, 4096)).Decode(&failure)
+		return nil, fmt.Errorf("ipfs %s failed: %s %s", command, response.Status, failure.Message)
+	}
+	return response, nil
+}
+
+// getGateway sends a request with method for the content with cid to the IPFS gateway.
+func (ipfsNode *IPFSNode) getGateway(method string, cid string, header http.Header) (*http.Response, error) {
+	if ipfsNode.gatewayURL == nil {
+		return nil, fmt.Errorf("no -ipfsapi node or -ipfsgateway to fetch %s", cid)
+	}
+	req, err := http.NewRequest(method, ipfsNode.gatewayURL.String()+"/ipfs/"+url.PathEscape(cid), nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	response, err := ipfsNode.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusPartialContent, http.StatusRequestedRangeNotSatisfiable:
+		return response, nil
+	case http.StatusNotFound:
+		response.Body.Close()
+		return nil, fmt.Errorf("ipfs gateway has no %s: %w", cid, ErrArtNotFound)
+	default:
+		response.Body.Close()
+		return nil, fmt.Errorf("failed to get %s from ipfs gateway: %s", cid, response.Status)
+	}
+}
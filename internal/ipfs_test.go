@@ -0,0 +1,231 @@
+package audiostrike
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// fakeIPFS serves the add, cat, files/stat, and pin/rm commands of the RPC api of an IPFS node,
+// and an IPFS gateway, with content named by a fake CID of its hash.
+type fakeIPFS struct {
+	mutex   sync.Mutex
+	content map[string][]byte
+	pinned  map[string]bool
+}
+
+func (ipfs *fakeIPFS) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ipfs.mutex.Lock()
+	defer ipfs.mutex.Unlock()
+	if strings.HasPrefix(req.URL.Path, "/ipfs/") {
+		content, isStored := ipfs.content[strings.TrimPrefix(req.URL.Path, "/ipfs/")]
+		if !isStored {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(content))
+		return
+	}
+	arg := strings.TrimPrefix(req.URL.Query().Get("arg"), "/ipfs/")
+	content, isStored := ipfs.content[arg]
+	fail := func(message string) {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"Message": message})
+	}
+	switch req.URL.Path {
+	case "/api/v0/add":
+		file, _, err := req.FormFile("file")
+		if err != nil {
+			fail(err.Error())
+			return
+		}
+		content, _ := ioutil.ReadAll(file)
+		contentHash := sha256.Sum256(content)
+		cid := "bafk" + hex.EncodeToString(contentHash[:16])
+		ipfs.content[cid] = content
+		ipfs.pinned[cid] = req.URL.Query().Get("pin") == "true"
+		json.NewEncoder(w).Encode(map[string]string{"Hash": cid, "Size": strconv.Itoa(len(content))})
+	case "/api/v0/cat":
+		offset, _ := strconv.Atoi(req.URL.Query().Get("offset"))
+		if !isStored || offset > len(content) {
+			fail("block was not found locally")
+			return
+		}
+		w.Write(content[offset:])
+	case "/api/v0/files/stat":
+		if !isStored {
+			fail("block was not found locally")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]int{"Size": len(content)})
+	case "/api/v0/pin/rm":
+		if !ipfs.pinned[arg] {
+			fail("not pinned or pinned indirectly")
+			return
+		}
+		delete(ipfs.pinned, arg)
+		json.NewEncoder(w).Encode(map[string][]string{"Pins": {arg}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// TestIPFSPayloadStore runs the ArtServer conformance tests on a sqlite DbServer pinning payloads in a fake IPFS node,
+// then verifies that a stored track records the CID of its payload, which stays pinned while another track has it,
+// and that the payload of a paid track is kept in a file rather than pinned.
+func TestIPFSPayloadStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk-ipfs")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ipfs := &fakeIPFS{content: make(map[string][]byte), pinned: make(map[string]bool)}
+	ipfsServer := httptest.NewServer(ipfs)
+	defer ipfsServer.Close()
+
+	newIPFSDbServer := func() *DbServer {
+		serverDir, err := ioutil.TempDir(dir, "server")
+		if err != nil {
+			t.Fatalf("TempDir error: %v", err)
+		}
+		dbCfg := *cfg
+		dbCfg.DbEngine = DbEngineSqlite
+		dbCfg.DbFile = filepath.Join(serverDir, "austk.db")
+		dbCfg.DbInit = true
+		dbCfg.ArtDir = filepath.Join(serverDir, "art")
+		dbCfg.IPFSAPI = ipfsServer.URL
+		return newTestDbServer(t, &dbCfg)
+	}
+	runArtServerConformance(t, func() ArtServer { return newIPFSDbServer() })
+
+	dbServer := newIPFSDbServer()
+	err = dbServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	original := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "original", Title: "Original"}
+	duplicate := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "duplicate", Title: "Duplicate"}
+	for _, track := range []*art.Track{original, duplicate} {
+		err = dbServer.StoreTrack(track, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreTrack error: %v", err)
+		}
+		err = dbServer.StoreTrackPayload(track, []byte("pinned payload"))
+		if err != nil {
+			t.Fatalf("StoreTrackPayload error: %v", err)
+		}
+	}
+	storedTrack, err := dbServer.Track(mockArtistID, "original")
+	if err != nil || storedTrack.PayloadCid == "" || !ipfs.pinned[storedTrack.PayloadCid] {
+		t.Fatalf("expected stored track with the CID of its pinned payload but got %v, error: %v", storedTrack, err)
+	}
+	cid := storedTrack.PayloadCid
+	if size, err := dbServer.TrackPayloadSize(original); err != nil || size != int64(len("pinned payload")) {
+		t.Errorf("expected size of pinned payload but got %d, error: %v", size, err)
+	}
+
+	err = dbServer.DeleteTrack(original)
+	if err != nil || !ipfs.pinned[cid] {
+		t.Errorf("expected payload kept pinned for the track with the same payload, error: %v", err)
+	}
+	err = dbServer.DeleteTrack(duplicate)
+	if err != nil || ipfs.pinned[cid] {
+		t.Errorf("expected payload unpinned with its last track, error: %v", err)
+	}
+
+	// The payload of a paid track stays in a file, and a free payload pinned before the track was priced is unpinned.
+	paidTrack := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "paid", Title: "Paid"}
+	err = dbServer.StoreTrack(paidTrack, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	err = dbServer.StoreTrackPayload(paidTrack, []byte("free payload"))
+	if err != nil {
+		t.Fatalf("StoreTrackPayload error: %v", err)
+	}
+	storedTrack, _ = dbServer.Track(mockArtistID, "paid")
+	freeCid := storedTrack.PayloadCid
+	err = dbServer.SetTrackPrice(paidTrack, 1000)
+	if err != nil {
+		t.Fatalf("SetTrackPrice error: %v", err)
+	}
+	err = dbServer.StoreTrackPayload(paidTrack, []byte("paid payload"))
+	if err != nil {
+		t.Fatalf("StoreTrackPayload error: %v", err)
+	}
+	storedTrack, err = dbServer.Track(mockArtistID, "paid")
+	if err != nil || storedTrack.PayloadCid != "" || ipfs.pinned[freeCid] {
+		t.Errorf("expected paid track with no pinned payload but got %v, error: %v", storedTrack, err)
+	}
+	for cid, content := range ipfs.content {
+		if string(content) == "paid payload" {
+			t.Errorf("expected paid payload not added to ipfs but got it as %s", cid)
+		}
+	}
+	payloadReader, err := dbServer.TrackFilePartialReader(paidTrack, 0)
+	if err != nil {
+		t.Fatalf("TrackFilePartialReader error: %v", err)
+	}
+	payload, _ := ioutil.ReadAll(payloadReader)
+	payloadReader.Close()
+	if string(payload) != "paid payload" || dbServer.TrackFilePath(paidTrack) == "" {
+		t.Errorf("expected paid payload read from its file but got %q", payload)
+	}
+	if err = dbServer.VerifyStoredTrack(paidTrack); err != nil {
+		t.Errorf("VerifyStoredTrack of paid track, error: %v", err)
+	}
+	err = dbServer.DeleteTrack(paidTrack)
+	if _, statErr := os.Stat(payloadPath(dbServer.payloadDir, paidTrack)); err != nil || !os.IsNotExist(statErr) {
+		t.Errorf("expected paid payload file removed with its track, error: %v, %v", err, statErr)
+	}
+}
+
+// TestIPFSGateway verifies that an IPFSNode without a local node fetches a payload from the gateway by its CID,
+// and that without either it is not configured.
+func TestIPFSGateway(t *testing.T) {
+	ipfs := &fakeIPFS{content: map[string][]byte{"bafkgateway": []byte("gateway payload")}, pinned: make(map[string]bool)}
+	ipfsServer := httptest.NewServer(ipfs)
+	defer ipfsServer.Close()
+	gatewayCfg := *cfg
+	gatewayCfg.IPFSGateway = ipfsServer.URL
+	ipfsNode, err := NewIPFSNode(&gatewayCfg)
+	if err != nil {
+		t.Fatalf("NewIPFSNode error: %v", err)
+	}
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID, PayloadCid: "bafkgateway"}
+
+	reader, err := ipfsNode.OpenPayload(track, 8)
+	if err != nil {
+		t.Fatalf("OpenPayload error: %v", err)
+	}
+	payload, _ := ioutil.ReadAll(reader)
+	reader.Close()
+	if string(payload) != "payload" {
+		t.Errorf("expected payload from offset 8 but got %q", payload)
+	}
+	filename := filepath.Join(t.TempDir(), "track.part")
+	err = ipfsNode.Download(track, filename)
+	if payload, _ = ioutil.ReadFile(filename); err != nil || string(payload) != "gateway payload" {
+		t.Errorf("expected payload downloaded from the gateway but got %q, error: %v", payload, err)
+	}
+	if err = ipfsNode.StorePayload(track, payload); err == nil {
+		t.Errorf("expected no payload pinned without an ipfs api")
+	}
+
+	if ipfsNode, err = NewIPFSNode(cfg); ipfsNode != nil || err != nil {
+		t.Errorf("expected no IPFS node configured but got %v, error: %v", ipfsNode, err)
+	}
+}
@@ -0,0 +1,77 @@
+package audiostrike
+
+import (
+	"encoding/hex"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// unpaidInvoiceGracePeriod is how long after an invoice expires unpaid its record is kept. lnd refuses to settle
+// an expired invoice, but one paid just before it expired still needs its record for its preimage to get the tracks.
+const unpaidInvoiceGracePeriod = 24 * time.Hour
+
+// issuedInvoiceKey gets the key of an invoice issued with invoiceHash: the hash in hex.
+func issuedInvoiceKey(invoiceHash []byte) string {
+	return hex.EncodeToString(invoiceHash)
+}
+
+// isExpiredInvoice tells whether invoice was never settled and expired before the unix time expiredBefore.
+func isExpiredInvoice(invoice *art.IssuedInvoice, expiredBefore uint64) bool {
+	return invoice.SettledAt == 0 && invoice.ExpiresAt < expiredBefore
+}
+
+// recordInvoice stores the tracks sold by the invoice issued with invoiceHash, for its preimage to get them,
+// and deletes the records of invoices that expired unpaid over unpaidInvoiceGracePeriod ago.
+// Records of settled invoices are kept, one per sale, for their buyers to get the tracks again.
+func (server *AustkServer) recordInvoice(invoiceHash []byte, tracks []*art.Track) error {
+	now := time.Now()
+	invoice := &art.IssuedInvoice{
+		InvoiceHash: invoiceHash,
+		ExpiresAt:   uint64(now.Unix() + server.config.invoiceExpirySeconds()),
+	}
+	for _, track := range tracks {
+		invoice.Tracks = append(invoice.Tracks, &art.TrackReference{ArtistId: track.ArtistId, ArtistTrackId: track.ArtistTrackId})
+	}
+	err := server.artServer.StoreIssuedInvoice(invoice)
+	if err != nil {
+		server.logger.Error("failed to store issued invoice", "invoice_hash", issuedInvoiceKey(invoiceHash), "error", err)
+		return err
+	}
+	err = server.artServer.DeleteExpiredInvoices(uint64(now.Add(-unpaidInvoiceGracePeriod).Unix()))
+	if err != nil {
+		// Keep the new invoice payable; the expired ones are deleted with the next one issued.
+		server.logger.Warn("failed to delete expired invoices", "error", err)
+	}
+	return nil
+}
+
+// invoicedTracks gets the tracks sold by invoice, or none if invoice is nil because this server issued none.
+func invoicedTracks(invoice *art.IssuedInvoice) []*art.Track {
+	tracks := make([]*art.Track, 0, len(invoice.GetTracks()))
+	for _, reference := range invoice.GetTracks() {
+		tracks = append(tracks, &art.Track{ArtistId: reference.ArtistId, ArtistTrackId: reference.ArtistTrackId})
+	}
+	return tracks
+}
+
+// settleInvoice records that payment of the invoice issued with invoiceHash was proven, and tells whether
+// it was proven for the first time, to count each payment once.
+func (server *AustkServer) settleInvoice(invoiceHash []byte) (isNewlySettled bool, err error) {
+	server.invoiceMutex.Lock()
+	defer server.invoiceMutex.Unlock()
+	invoice, err := server.artServer.IssuedInvoice(invoiceHash)
+	if err != nil {
+		return false, err
+	}
+	if invoice.SettledAt != 0 {
+		return false, nil
+	}
+	invoice.SettledAt = nowUnix()
+	err = server.artServer.StoreIssuedInvoice(invoice)
+	if err != nil {
+		server.logger.Error("failed to store settled invoice", "invoice_hash", issuedInvoiceKey(invoiceHash), "error", err)
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,93 @@
+package audiostrike
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// TestIssuedInvoicesSurviveRestart verifies that the preimage of an invoice paid before the node restarts
+// still gets its track after, counted as purchased once, and that invoices expired unpaid are deleted.
+func TestIssuedInvoicesSurviveRestart(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	pricedCfg := *cfg
+	pricedCfg.DefaultPrice = 1500
+	newServer := func() (*AustkServer, *FileServer) {
+		fileServer, err := NewFileServer(artDir)
+		if err != nil {
+			t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+		}
+		err = fileServer.StoreArtist(&mockArtist)
+		if err != nil {
+			t.Fatalf("StoreArtist error: %v", err)
+		}
+		mockLightningNode, err := NewMockLightningNode(&pricedCfg, fileServer)
+		if err != nil {
+			t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+		}
+		austkServer, err := NewAustkServer(&pricedCfg, fileServer, mockLightningNode)
+		if err != nil {
+			t.Fatalf("NewAustkServer error: %v", err)
+		}
+		return austkServer, fileServer
+	}
+	austkServer, fileServer := newServer()
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "would", Title: "Would?"}
+	err = fileServer.StoreTrack(track, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	expiredHash := sha256.Sum256([]byte("expired unpaid"))
+	err = fileServer.StoreIssuedInvoice(&art.IssuedInvoice{InvoiceHash: expiredHash[:],
+		ExpiresAt: uint64(time.Now().Add(-2 * unpaidInvoiceGracePeriod).Unix())})
+	if err != nil {
+		t.Fatalf("StoreIssuedInvoice error: %v", err)
+	}
+
+	paymentRequest, _, err := austkServer.CreateTrackInvoice(context.Background(), track)
+	if err != nil {
+		t.Fatalf("CreateTrackInvoice error: %v", err)
+	}
+	// The mock lightning node hashes the invoice memo, encoded in its payment request, as the preimage.
+	var sats int64
+	var memo []byte
+	_, err = fmt.Sscanf(paymentRequest, "lnbcrtmock%d:%x", &sats, &memo)
+	if err != nil {
+		t.Fatalf("malformed mock payment request %s, error: %v", paymentRequest, err)
+	}
+	preimage := hex.EncodeToString(memo)
+	err = austkServer.checkPayment(context.Background(), track, preimage)
+	if err != nil {
+		t.Fatalf("checkPayment error: %v", err)
+	}
+	_, err = fileServer.IssuedInvoice(expiredHash[:])
+	if err != ErrArtNotFound {
+		t.Errorf("expected invoice expired unpaid to be deleted but got error %v", err)
+	}
+
+	austkServer, fileServer = newServer()
+	err = austkServer.checkPayment(context.Background(), track, preimage)
+	if err != nil {
+		t.Errorf("expected preimage of invoice paid before restart to get its track but got %v", err)
+	}
+	austkServer.trackStats.flush()
+	stats, err := fileServer.TrackStats(mockArtistID, "would")
+	if err != nil || stats.Purchases != 1 {
+		t.Errorf("expected 1 purchase counted once but got %v, error: %v", stats, err)
+	}
+	err = austkServer.checkPayment(context.Background(), &art.Track{ArtistId: mockArtistID, ArtistTrackId: "other"}, preimage)
+	if err == nil {
+		t.Errorf("expected preimage of invoice for another track to be refused")
+	}
+}
@@ -1,173 +1,613 @@
 package audiostrike
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 
 	art "github.com/audiostrike/music/pkg/art"
 	"github.com/golang/protobuf/proto"
 	"github.com/lightningnetwork/lnd/lnrpc"
-	"github.com/lightningnetwork/lnd/macaroons"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 	"gopkg.in/macaroon.v2"
-	"log"
+	"log/slog"
 	"os/user"
+	"strings"
+	"sync"
+	"time"
 )
 
+// keysendRecordType is the custom TLV record type carrying the preimage of a keysend payment.
+const keysendRecordType = 5482373484
+
+// SignatureSchemeLnd is the scheme of publications signed by lnd's SignMessage, a zbase32-encoded
+// recoverable ECDSA signature of the message prefixed by "Lightning Signed Message:".
+// The message signed is the scheme and the marshaled resources, as made by signedMessage,
+// so that the scheme stamped on a publication cannot be changed without breaking its signature.
+const SignatureSchemeLnd = "lnd-signmessage/2"
+
+// signatureSchemeLndUnbound is the scheme of publications signed by lnd's SignMessage over the
+// marshaled resources alone. Publications signed before schemes were stamped have no scheme
+// and were signed the same way.
+const signatureSchemeLndUnbound = "lnd-signmessage/1"
+
+var (
+	ErrInvoiceNotFound = errors.New("lnd has no invoice for the hash")
+	ErrPaymentNotFound = errors.New("lnd has sent no payment for the hash")
+
+	ErrSignatureSchemeUnsupported = errors.New("publication signature scheme is not supported")
+	ErrMacaroonDenied             = errors.New("lnd denied the macaroon configured for the call")
+)
+
+// LndClient is the part of lnd's grpc Lightning service that a LightningNode calls,
+// implemented by lnrpc.LightningClient and by fakes that let tests sign and invoice without lnd.
+type LndClient interface {
+	GetInfo(ctx context.Context, in *lnrpc.GetInfoRequest, opts ...grpc.CallOption) (*lnrpc.GetInfoResponse, error)
+	SignMessage(ctx context.Context, in *lnrpc.SignMessageRequest, opts ...grpc.CallOption) (*lnrpc.SignMessageResponse, error)
+	VerifyMessage(ctx context.Context, in *lnrpc.VerifyMessageRequest, opts ...grpc.CallOption) (*lnrpc.VerifyMessageResponse, error)
+	AddInvoice(ctx context.Context, in *lnrpc.Invoice, opts ...grpc.CallOption) (*lnrpc.AddInvoiceResponse, error)
+	LookupInvoice(ctx context.Context, in *lnrpc.PaymentHash, opts ...grpc.CallOption) (*lnrpc.Invoice, error)
+	DecodePayReq(ctx context.Context, in *lnrpc.PayReqString, opts ...grpc.CallOption) (*lnrpc.PayReq, error)
+	SendPaymentSync(ctx context.Context, in *lnrpc.SendRequest, opts ...grpc.CallOption) (*lnrpc.SendResponse, error)
+	ListPayments(ctx context.Context, in *lnrpc.ListPaymentsRequest, opts ...grpc.CallOption) (*lnrpc.ListPaymentsResponse, error)
+}
+
 type LightningNode struct {
-	lightningClient  lnrpc.LightningClient
-	publishingArtist *art.Artist
+	lightningClient LndClient
+	// lndConn is the connection to lnd's grpc for lightningClient, closed by Close.
+	lndConn io.Closer
+
+	// publishingArtist signs by default, and publishingArtists maps the id of each artist
+	// hosted by this node, including the default, to the stored Artist. Both are guarded by publishingMutex.
+	publishingArtist  *art.Artist
+	publishingArtists map[string]*art.Artist
+	publishingMutex   sync.RWMutex
+
+	// cachedPubkey is lnd's identity pubkey once fetched, which does not change,
+	// guarded by pubkeyMutex.
+	cachedPubkey string
+	pubkeyMutex  sync.Mutex
+
+	// rpcTimeout limits how long each lnd call may take before it fails with context.DeadlineExceeded.
+	rpcTimeout time.Duration
+	// invoiceExpirySeconds is how long each invoice added to lnd may go unpaid, or lnd's default if 0.
+	invoiceExpirySeconds int64
+
+	logger *slog.Logger
 }
 
+// NewLightningNode dials the configured lnd and gets a LightningNode calling it for the configured artists.
 func NewLightningNode(cfg *Config, localStorage ArtServer) (*LightningNode, error) {
-	const logPrefix = "lightningNode NewLightningNode "
+	logger := cfg.componentLogger("lightningNode")
 
 	// Get the TLS credentials for the lnd server.
-	tlsCertFilePath, err := tlsCertPath(cfg)
+	lndTlsCreds, err := lndTLSCredentials(cfg)
 	if err != nil {
-		log.Fatalf(logPrefix+"failed to get tls cert path, error: %v", err)
+		logger.Error("failed to get tls credentials", "error", err)
 		return nil, err
 	}
-	// The second paramater here is serverNameOverride, set to ""
-	// except to override the virtual host name of authority in test requests.
-	lndTlsCreds, err := credentials.NewClientTLSFromFile(tlsCertFilePath, "")
+
+	lndMacaroon, err := macaroonFromFile(cfg)
 	if err != nil {
-		log.Fatalf(logPrefix+"failed to get tls credentials from %s, error: %v",
-			tlsCertFilePath, err)
+		if cfg.MacaroonBase64 != "" {
+			logger.Error("failed to get macaroon", "macaroon", "-macaroonbase64", "error", err)
+		} else {
+			macaroonFilePath, _ := macaroonPath(cfg)
+			logger.Error("failed to get macaroon", "macaroon", macaroonFilePath, "network", cfg.network(), "error", err)
+		}
 		return nil, err
 	}
 
-	lndMacaroon, err := macaroonFromFile(cfg)
+	lndCredential, err := newScopedMacaroonCredential(cfg, lndMacaroon)
 	if err != nil {
-		log.Printf(logPrefix+"UnmarchalBinary macaroon error: %v\n", err)
+		logger.Error("failed to get scoped macaroon", "error", err)
 		return nil, err
 	}
 
 	lndOpts := []grpc.DialOption{
 		grpc.WithTransportCredentials(lndTlsCreds),
-		grpc.WithPerRPCCredentials(macaroons.NewMacaroonCredential(lndMacaroon)),
+		grpc.WithPerRPCCredentials(lndCredential),
 	}
 
 	lndGrpcEndpoint := fmt.Sprintf("%v:%d", cfg.LndHost, cfg.LndGrpcPort)
-	log.Printf(logPrefix+"Dial lnd grpc at %v...", lndGrpcEndpoint)
-	lndConn, err := grpc.Dial(lndGrpcEndpoint, lndOpts...)
+	logger.Info("dial lnd grpc", "lnd", lndGrpcEndpoint, "network", cfg.network())
+	lndClient, err := newReconnectingLightningClient(func() (LndClient, io.Closer, error) {
+		lndConn, err := grpc.Dial(lndGrpcEndpoint, lndOpts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return lnrpc.NewLightningClient(lndConn), lndConn, nil
+	}, logger.With("lnd", lndGrpcEndpoint))
 	if err != nil {
-		log.Printf(logPrefix+"Dial lnd error: %v", err)
+		logger.Error("failed to dial lnd", "lnd", lndGrpcEndpoint, "error", err)
 		return nil, err
 	}
-	lndClient := lnrpc.NewLightningClient(lndConn)
 
-	// Set the publishing Artist for this lightningNode with the configured ArtistID and Name.
+	// Fail fast on a scoped macaroon that lnd denies, rather than at the first invoice or signature.
+	err = checkMacaroonScopes(lndClient, lndCredential, cfg.lndTimeout(), logger)
+	if err != nil {
+		lndClient.Close()
+		logger.Error("lnd denied a scoped macaroon", "lnd", lndGrpcEndpoint, "error", err)
+		return nil, err
+	}
+
+	lightningNode, err := NewLightningNodeWithClient(cfg, localStorage, lndClient)
+	if err != nil {
+		lndClient.Close()
+		return nil, err
+	}
+	return lightningNode, nil
+}
+
+// NewLightningNodeWithClient gets a LightningNode calling lndClient for the configured artists,
+// storing any that are not stored yet with the pubkey of lndClient.
+// If lndClient is an io.Closer, Close closes it.
+func NewLightningNodeWithClient(cfg *Config, localStorage ArtServer, lndClient LndClient) (*LightningNode, error) {
+	logger := cfg.componentLogger("lightningNode")
+	rpcTimeout := cfg.lndTimeout()
+
+	// Set the publishing Artists for this lightningNode with the configured ArtistID and Name
+	// and any hosted artist ids.
 	if cfg.ArtistID == "" {
-		log.Fatalf(logPrefix + "No artist configured")
-		return nil, ErrArtNotFound
+		logger.Error("no artist configured")
+		return nil, fmt.Errorf("%w: no artist configured", ErrArtNotFound)
 	}
-	publishingArtist, err := localStorage.Artist(cfg.ArtistID)
-	if err == ErrArtNotFound {
-		pubkey, err := pubkey(lndClient)
-		if err != nil {
-			log.Fatalf(logPrefix+"failed to get pubkey from lnd %s, error: %v", lndGrpcEndpoint, err)
+	publishingArtists := make(map[string]*art.Artist)
+	var lndPubkey string
+	for _, artistID := range cfg.PublishingArtistIDs() {
+		publishingArtist, err := localStorage.Artist(artistID)
+		if err == ErrArtNotFound {
+			if lndPubkey == "" {
+				ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+				lndPubkey, err = pubkey(ctx, lndClient)
+				cancel()
+				if err != nil {
+					logger.Error("failed to get pubkey from lnd", "error", err)
+					if !errors.Is(err, ErrLndUnavailable) && isLndUnreachable(err) {
+						err = fmt.Errorf("%w: %w", ErrLndUnavailable, err)
+					}
+					return nil, err
+				}
+			}
+			pubkey := lndPubkey
+			if cfg.Pubkey == "" {
+				cfg.Pubkey = pubkey
+			} else if cfg.Pubkey != pubkey {
+				logger.Error("lnd pubkey does not match the configured pubkey",
+					"pubkey", pubkey, "artist_id", artistID, "configured_pubkey", cfg.Pubkey)
+				return nil, fmt.Errorf("%w: lnd has pubkey %s but artist %s configured pubkey %s",
+					ErrPubkeyMismatch, pubkey, artistID, cfg.Pubkey)
+			}
+			// The artist is not yet stored, so store the artist.
+			// Only the default artist has a configured name, so name any other hosted artist by id.
+			publishingArtist = &art.Artist{ArtistId: artistID, Name: artistID, Pubkey: pubkey}
+			if artistID == cfg.ArtistID {
+				publishingArtist.Name = cfg.ArtistName
+			}
+			err = localStorage.StoreArtist(publishingArtist)
+			if err != nil {
+				logger.Error("failed to store artist", "artist_id", artistID, "error", err)
+				return nil, err
+			}
+			logger.Info("stored publishing artist", "artist_id", artistID, "pubkey", pubkey)
+		} else if err != nil {
+			logger.Error("failed to get artist from storage", "artist_id", artistID, "error", err)
 			return nil, err
 		}
-		if cfg.Pubkey == "" {
-			cfg.Pubkey = pubkey
-		} else if cfg.Pubkey != pubkey {
-			log.Fatalf(logPrefix+"lnd %s has pubkey %s but artist %v configured pubkey %s",
-				lndGrpcEndpoint, pubkey, publishingArtist, cfg.Pubkey)
-			return nil, fmt.Errorf("misconfigured pubkey")
-		}
-		// The configured artist is not yet stored, so store the artist.
-		publishingArtist = &art.Artist{ArtistId: cfg.ArtistID, Name: cfg.ArtistName, Pubkey: pubkey}
-		err = localStorage.StoreArtist(publishingArtist)
-		if err != nil {
-			log.Fatalf(logPrefix+"failed to store artist %v, error: %v",
-				publishingArtist, err)
-			return nil, err
-		}
-		log.Printf(logPrefix+"stored %v", publishingArtist)
-	} else if err != nil {
-		log.Fatalf(logPrefix+"failed to get artist %s from storage, error: %v", cfg.ArtistID, err)
-		return nil, ErrArtNotFound
+		publishingArtists[artistID] = publishingArtist
 	}
 
+	lndConn, _ := lndClient.(io.Closer)
 	return &LightningNode{
-		lightningClient:  lndClient,
-		publishingArtist: publishingArtist,
+		lightningClient:   lndClient,
+		lndConn:           lndConn,
+		publishingArtist:  publishingArtists[cfg.ArtistID],
+		publishingArtists: publishingArtists,
+		cachedPubkey:      lndPubkey,
+		rpcTimeout:        rpcTimeout,
+
+		invoiceExpirySeconds: cfg.invoiceExpirySeconds(),
+		logger:               logger,
 	}, nil
 }
 
+// Close closes the connection to lnd.
+func (lightningNode *LightningNode) Close() error {
+	if lightningNode.lndConn == nil {
+		return nil
+	}
+	return lightningNode.lndConn.Close()
+}
+
+// rpcContext derives the context for one lnd call from ctx, cancelled after the node's rpcTimeout.
+func (lightningNode *LightningNode) rpcContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, lightningNode.rpcTimeout)
+}
+
+// Artist gets the default Artist publishing from this lightningNode.
 func (lightningNode *LightningNode) Artist() (*art.Artist, error) {
+	lightningNode.publishingMutex.RLock()
+	defer lightningNode.publishingMutex.RUnlock()
 	return lightningNode.publishingArtist, nil
 }
 
-// getAllArtHandler handles a request to get all the art from the ArtService.
-func (lightningNode *LightningNode) Sign(resources *art.ArtResources) (*art.ArtistPublication, error) {
-	const logPrefix = "lightning Sign "
+// PublishingArtist gets the Artist with artistID if hosted by this lightningNode
+// or else ErrArtNotFound.
+func (lightningNode *LightningNode) PublishingArtist(artistID string) (*art.Artist, error) {
+	lightningNode.publishingMutex.RLock()
+	defer lightningNode.publishingMutex.RUnlock()
+	publishingArtist, isHosted := lightningNode.publishingArtists[artistID]
+	if !isHosted {
+		return nil, fmt.Errorf("%w: artist %s is not hosted by this node", ErrArtNotFound, artistID)
+	}
+	return publishingArtist, nil
+}
+
+// UpdatePublishingArtist replaces the hosted artist with the id of artist, e.g. to sign as the artist
+// with a new pubkey after lnd's identity key is rotated.
+// It returns an error wrapping ErrArtNotFound if the artist is not hosted by this lightningNode.
+func (lightningNode *LightningNode) UpdatePublishingArtist(artist *art.Artist) error {
+	lightningNode.publishingMutex.Lock()
+	defer lightningNode.publishingMutex.Unlock()
+	previousArtist, isHosted := lightningNode.publishingArtists[artist.ArtistId]
+	if !isHosted {
+		return fmt.Errorf("%w: artist %s is not hosted by this node", ErrArtNotFound, artist.ArtistId)
+	}
+	lightningNode.publishingArtists[artist.ArtistId] = artist
+	if lightningNode.publishingArtist == previousArtist {
+		lightningNode.publishingArtist = artist
+	}
+	return nil
+}
+
+// Sign signs the resources with lnd into a publication by the hosted artist with artistID.
+func (lightningNode *LightningNode) Sign(ctx context.Context, artistID string, resources *art.ArtResources) (*art.ArtistPublication, error) {
+	logger := lightningNode.logger.With("artist_id", artistID)
+
+	publishingArtist, err := lightningNode.PublishingArtist(artistID)
+	if err != nil {
+		logger.Warn("cannot sign for artist", "error", err)
+		return nil, err
+	}
 
-	ctx := context.Background()
-	marshaledResources, err := proto.Marshal(resources)
+	ctx, cancel := lightningNode.rpcContext(ctx)
+	defer cancel()
+	marshaledResources, err := prepareForSigning(resources)
 	if err != nil {
-		log.Printf(logPrefix+"Marshal %v, error: %v", resources, err)
+		logger.Error("failed to marshal resources", "error", err)
 		return nil, err
 	}
-	signMessageInput := lnrpc.SignMessageRequest{Msg: marshaledResources}
+	signMessageInput := lnrpc.SignMessageRequest{Msg: signedMessage(SignatureSchemeLnd, marshaledResources)}
 	signMessageResult, err := lightningNode.lightningClient.SignMessage(ctx, &signMessageInput)
 	if err != nil {
-		log.Printf(logPrefix+"SignMessage error: %v", err)
+		logger.Error("lnd SignMessage failed", "error", err)
 		return nil, err
 	}
 	publicationSignature := signMessageResult.Signature
-	log.Printf(logPrefix+"Signed message %v, signature: %v", resources, publicationSignature)
+	logger.Debug("signed resources", "resources", resources, "signature", publicationSignature)
 
-	return &art.ArtistPublication{
-		Artist:                 lightningNode.publishingArtist,
-		Signature:              publicationSignature,
-		SerializedArtResources: marshaledResources,
-	}, nil
+	return attachSignature(publishingArtist, marshaledResources, publicationSignature), nil
+}
+
+// ValidatePublication verifies that the publishing artist's pubkey signed the publication
+// and returns the resources it publishes.
+// It returns ErrSignatureInvalid for a bad signature or ErrPubkeyMismatch for another signer's signature,
+// and ErrSignatureSchemeUnsupported for a signature made by a scheme it cannot verify.
+func (lightningNode *LightningNode) ValidatePublication(ctx context.Context, publication *art.ArtistPublication) (*art.ArtResources, error) {
+	logger := lightningNode.logger.With("artist_id", publication.Artist.GetArtistId())
+
+	var err error
+	switch publication.SignatureScheme {
+	case "", signatureSchemeLndUnbound, SignatureSchemeLnd:
+		err = lightningNode.verifyLndSignature(ctx, logger, publication)
+	default:
+		logger.Warn("unsupported publication signature scheme", "signature_scheme", publication.SignatureScheme)
+		err = fmt.Errorf("%w: %q", ErrSignatureSchemeUnsupported, publication.SignatureScheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	artResources := art.ArtResources{}
+	err = proto.Unmarshal(publication.SerializedArtResources, &artResources)
+	if err != nil {
+		logger.Warn("failed to unmarshal published resources", "error", err)
+		return nil, err
+	}
+	return &artResources, nil
 }
 
-func (lightningNode *LightningNode) ValidatePublication(publication *art.ArtistPublication) (*art.ArtResources, error) {
-	const logPrefix = "lightningNode ValidatePublication "
+// verifyLndSignature verifies with lnd's VerifyMessage that the publishing artist's pubkey signed publication
+// by lnd's SignMessage over the message signedMessage makes for its scheme.
+func (lightningNode *LightningNode) verifyLndSignature(ctx context.Context, logger *slog.Logger, publication *art.ArtistPublication) error {
+	message := signedMessage(publication.SignatureScheme, publication.SerializedArtResources)
+	signerPubkey, err := lightningNode.VerifyMessage(ctx, message, publication.Signature)
+	if err != nil {
+		logger.Warn("invalid publication signature", "signature", publication.Signature, "error", err)
+		return err
+	}
+	if signerPubkey != publication.Artist.Pubkey {
+		logger.Warn("publication signed by another pubkey than the artist's",
+			"signer_pubkey", signerPubkey, "pubkey", publication.Artist.Pubkey)
+		return ErrPubkeyMismatch
+	}
+	return nil
+}
+
+// SignMessage signs message with lnd's identity key.
+func (lightningNode *LightningNode) SignMessage(ctx context.Context, message []byte) (string, error) {
+	ctx, cancel := lightningNode.rpcContext(ctx)
+	defer cancel()
+	signMessageResult, err := lightningNode.lightningClient.SignMessage(ctx, &lnrpc.SignMessageRequest{Msg: message})
+	if err != nil {
+		lightningNode.logger.Error("lnd SignMessage failed", "error", err)
+		return "", err
+	}
+	return signMessageResult.Signature, nil
+}
 
-	ctx := context.Background()
+// VerifyMessage verifies with lnd's VerifyMessage that signature signs message and gets the signer's pubkey.
+// It returns ErrSignatureInvalid for a bad signature.
+func (lightningNode *LightningNode) VerifyMessage(ctx context.Context, message []byte, signature string) (string, error) {
+	ctx, cancel := lightningNode.rpcContext(ctx)
+	defer cancel()
 	verifyMessageRequest := lnrpc.VerifyMessageRequest{
-		Msg:       publication.SerializedArtResources,
-		Signature: publication.Signature,
+		Msg:       message,
+		Signature: signature,
 	}
 	verifyMessageResponse, err := lightningNode.lightningClient.VerifyMessage(ctx, &verifyMessageRequest)
 	if err != nil {
-		log.Printf(logPrefix+"failed to verify message, error: %v", err)
-		return nil, err
+		lightningNode.logger.Error("lnd VerifyMessage failed", "error", err)
+		return "", err
 	}
 	if !verifyMessageResponse.Valid {
-		log.Printf(logPrefix+"Signature %s is not valid for message %v", publication.Signature, publication.SerializedArtResources)
-		return nil, fmt.Errorf("Signature failed verification")
+		return "", ErrSignatureInvalid
 	}
-	if verifyMessageResponse.Pubkey != publication.Artist.Pubkey {
-		log.Printf(logPrefix+"Signature pubkey %s does not match pubkey for publishing artist %v",
-			verifyMessageResponse.Pubkey, publication.Artist)
+	return verifyMessageResponse.Pubkey, nil
+}
+
+// AddInvoice adds an invoice to lnd for sats with memo to describe what is bought.
+// It returns the payment request for the buyer to pay and the invoice hash to look up the payment.
+func (lightningNode *LightningNode) AddInvoice(ctx context.Context, memo string, sats uint64) (paymentRequest string, invoiceHash []byte, err error) {
+	ctx, cancel := lightningNode.rpcContext(ctx)
+	defer cancel()
+	invoice := lnrpc.Invoice{
+		Memo:   memo,
+		Value:  int64(sats),
+		Expiry: lightningNode.invoiceExpirySeconds,
+	}
+	addInvoiceResponse, err := lightningNode.lightningClient.AddInvoice(ctx, &invoice)
+	if err != nil {
+		lightningNode.logger.Error("lnd AddInvoice failed", "memo", memo, "sats", sats, "error", err)
+		return "", nil, err
+	}
+	return addInvoiceResponse.PaymentRequest, addInvoiceResponse.RHash, nil
+}
+
+// PayInvoice pays the given payment request through lnd and returns the preimage as proof of payment.
+// It refuses to pay an invoice for more than maxSats or for an unspecified amount.
+func (lightningNode *LightningNode) PayInvoice(ctx context.Context, paymentRequest string, maxSats uint64) (preimage []byte, err error) {
+	decodeCtx, cancel := lightningNode.rpcContext(ctx)
+	defer cancel()
+	payReq, err := lightningNode.lightningClient.DecodePayReq(decodeCtx, &lnrpc.PayReqString{PayReq: paymentRequest})
+	if err != nil {
+		lightningNode.logger.Warn("lnd DecodePayReq failed", "payment_request", paymentRequest, "error", err)
 		return nil, err
 	}
+	if payReq.NumSatoshis <= 0 || uint64(payReq.NumSatoshis) > maxSats {
+		return nil, fmt.Errorf("invoice for %d sats (%s) does not match price of at most %d sats",
+			payReq.NumSatoshis, payReq.Description, maxSats)
+	}
 
-	artResources := art.ArtResources{}
-	err = proto.Unmarshal(publication.SerializedArtResources, &artResources)
+	// Wait for the payment without rpcTimeout: lnd keeps paying after the call gives up,
+	// so a caller told it failed could pay again for what lnd went on to pay.
+	sendResponse, err := lightningNode.lightningClient.SendPaymentSync(ctx, &lnrpc.SendRequest{PaymentRequest: paymentRequest})
 	if err != nil {
-		log.Printf(logPrefix+"Unmarshal error: %v", err)
+		lightningNode.logger.Error("lnd SendPaymentSync failed", "payment_request", paymentRequest, "error", err)
 		return nil, err
 	}
-	return &artResources, nil
+	if sendResponse.PaymentError != "" {
+		lightningNode.logger.Warn("payment failed", "payment_request", paymentRequest, "error", sendResponse.PaymentError)
+		return nil, fmt.Errorf("payment failed: %s", sendResponse.PaymentError)
+	}
+	return sendResponse.PaymentPreimage, nil
+}
+
+// Keysend pays sats spontaneously to the lnd node with pubkey without an invoice, e.g. to tip an artist.
+// The destination must accept keysend payments (lnd --accept-keysend).
+func (lightningNode *LightningNode) Keysend(ctx context.Context, pubkey string, sats uint64) error {
+	destination, err := hex.DecodeString(pubkey)
+	if err != nil {
+		return fmt.Errorf("malformed pubkey %s, error: %v", pubkey, err)
+	}
+	preimage := make([]byte, 32)
+	_, err = rand.Read(preimage)
+	if err != nil {
+		return err
+	}
+	paymentHash := sha256.Sum256(preimage)
+
+	// Wait for the payment without rpcTimeout, like PayInvoice, so a keysend that lnd completes is not sent again.
+	sendResponse, err := lightningNode.lightningClient.SendPaymentSync(ctx, &lnrpc.SendRequest{
+		Dest:              destination,
+		Amt:               int64(sats),
+		PaymentHash:       paymentHash[:],
+		DestCustomRecords: map[uint64][]byte{keysendRecordType: preimage},
+	})
+	if err != nil {
+		lightningNode.logger.Error("lnd SendPaymentSync keysend failed", "pubkey", pubkey, "sats", sats, "error", err)
+		return err
+	}
+	if sendResponse.PaymentError != "" {
+		lightningNode.logger.Warn("keysend payment failed", "pubkey", pubkey, "sats", sats, "error", sendResponse.PaymentError)
+		if strings.Contains(sendResponse.PaymentError, "IncorrectOrUnknownPaymentDetails") {
+			return fmt.Errorf("%s rejected keysend payment; it may not accept spontaneous payments", pubkey)
+		}
+		return fmt.Errorf("keysend payment failed: %s", sendResponse.PaymentError)
+	}
+	return nil
+}
+
+// VerifyPayment checks that preimage is the secret for invoiceHash
+// and that lnd has settled the invoice, i.e. received payment for it.
+func (lightningNode *LightningNode) VerifyPayment(ctx context.Context, invoiceHash, preimage []byte) (bool, error) {
+	preimageHash := sha256.Sum256(preimage)
+	if !bytes.Equal(preimageHash[:], invoiceHash) {
+		lightningNode.logger.Info("preimage does not match invoice", "invoice_hash", hex.EncodeToString(invoiceHash))
+		return false, nil
+	}
+
+	ctx, cancel := lightningNode.rpcContext(ctx)
+	defer cancel()
+	invoice, err := lightningNode.lightningClient.LookupInvoice(ctx, &lnrpc.PaymentHash{RHash: invoiceHash})
+	if err != nil {
+		lightningNode.logger.Error("lnd LookupInvoice failed", "invoice_hash", hex.EncodeToString(invoiceHash), "error", err)
+		return false, err
+	}
+	return invoice.State == lnrpc.Invoice_SETTLED, nil
+}
+
+// LookupInvoice gets the invoice that lnd added for invoiceHash, e.g. to check whether a buyer paid it.
+// It returns ErrInvoiceNotFound if lnd has no invoice for invoiceHash.
+func (lightningNode *LightningNode) LookupInvoice(ctx context.Context, invoiceHash []byte) (*lnrpc.Invoice, error) {
+	ctx, cancel := lightningNode.rpcContext(ctx)
+	defer cancel()
+	invoice, err := lightningNode.lightningClient.LookupInvoice(ctx, &lnrpc.PaymentHash{RHash: invoiceHash})
+	if isLndNotFound(err) {
+		return nil, ErrInvoiceNotFound
+	} else if err != nil {
+		lightningNode.logger.Error("lnd LookupInvoice failed", "invoice_hash", hex.EncodeToString(invoiceHash), "error", err)
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// LookupPayment gets the payment that lnd sent for paymentHash, including one still in flight or failed.
+// It returns ErrPaymentNotFound if lnd has sent no payment for paymentHash.
+func (lightningNode *LightningNode) LookupPayment(ctx context.Context, paymentHash []byte) (*lnrpc.Payment, error) {
+	// lnd looks up payments only by listing them, so list them a page at a time, newest first,
+	// since a payment looked up is usually recent.
+	paymentHashHex := hex.EncodeToString(paymentHash)
+	var indexOffset uint64
+	for {
+		listPaymentsResponse, err := lightningNode.listPaymentsPage(ctx, indexOffset)
+		if err != nil {
+			lightningNode.logger.Error("lnd ListPayments failed", "payment_hash", paymentHashHex, "error", err)
+			return nil, err
+		}
+		for _, payment := range listPaymentsResponse.Payments {
+			if payment.PaymentHash == paymentHashHex {
+				return payment, nil
+			}
+		}
+		if len(listPaymentsResponse.Payments) < paymentsPageSize || listPaymentsResponse.FirstIndexOffset <= 1 {
+			return nil, ErrPaymentNotFound
+		}
+		indexOffset = listPaymentsResponse.FirstIndexOffset
+	}
+}
+
+// paymentsPageSize is how many payments LookupPayment lists from lnd at a time.
+const paymentsPageSize = 1000
+
+// listPaymentsPage lists up to paymentsPageSize of the payments lnd sent before the one at indexOffset,
+// or the latest if indexOffset is 0.
+func (lightningNode *LightningNode) listPaymentsPage(ctx context.Context, indexOffset uint64) (*lnrpc.ListPaymentsResponse, error) {
+	ctx, cancel := lightningNode.rpcContext(ctx)
+	defer cancel()
+	return lightningNode.lightningClient.ListPayments(ctx, &lnrpc.ListPaymentsRequest{
+		IncludeIncomplete: true,
+		IndexOffset:       indexOffset,
+		MaxPayments:       paymentsPageSize,
+		Reversed:          true,
+	})
+}
+
+// isLndNotFound reports whether err is lnd's answer to a lookup of something it does not have.
+// Older lnd versions answer with an Unknown status whose message says it is unable to locate it.
+func isLndNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	return status.Code(err) == codes.NotFound || strings.Contains(err.Error(), "unable to locate")
 }
 
 // Pubkey returns the pubkey for the lnd server,
 // which clients can use to authenticate publications from this node.
-func (lightningNode *LightningNode) Pubkey() (string, error) {
-	return pubkey(lightningNode.lightningClient)
+// It asks lnd only until lnd first answers and then returns the same pubkey.
+// While lnd is unreachable, e.g. when the daemon starts before lnd, it returns the pubkey stored
+// for the default artist, which lnd gave when the artist was stored, and asks lnd again at the next call.
+func (lightningNode *LightningNode) Pubkey(ctx context.Context) (string, error) {
+	lightningNode.pubkeyMutex.Lock()
+	defer lightningNode.pubkeyMutex.Unlock()
+
+	if lightningNode.cachedPubkey != "" {
+		return lightningNode.cachedPubkey, nil
+	}
+	pubkey, err := lightningNode.fetchPubkey(ctx)
+	if err != nil && (errors.Is(err, ErrLndUnavailable) || isLndUnreachable(err)) {
+		artist, _ := lightningNode.Artist()
+		if artist != nil && artist.Pubkey != "" {
+			lightningNode.logger.Warn("use the stored pubkey of the artist until lnd is reachable",
+				"artist_id", artist.ArtistId, "pubkey", artist.Pubkey, "error", err)
+			return artist.Pubkey, nil
+		}
+	}
+	return pubkey, err
+}
+
+// isLndUnreachable reports whether err is from a call that did not reach lnd,
+// e.g. while lnd is down or before its grpc connection is ready.
+func isLndUnreachable(err error) bool {
+	return status.Code(err) == codes.Unavailable || errors.Is(err, context.DeadlineExceeded)
+}
+
+// RefreshPubkey asks lnd for its pubkey again, e.g. after lnd is replaced, and caches it for Pubkey.
+func (lightningNode *LightningNode) RefreshPubkey(ctx context.Context) (string, error) {
+	lightningNode.pubkeyMutex.Lock()
+	defer lightningNode.pubkeyMutex.Unlock()
+
+	return lightningNode.fetchPubkey(ctx)
+}
+
+// fetchPubkey gets the pubkey from lnd and caches it. The caller must hold pubkeyMutex.
+func (lightningNode *LightningNode) fetchPubkey(ctx context.Context) (string, error) {
+	ctx, cancel := lightningNode.rpcContext(ctx)
+	defer cancel()
+	pubkey, err := pubkey(ctx, lightningNode.lightningClient)
+	if err != nil {
+		lightningNode.logger.Error("lnd GetInfo failed", "error", err)
+		return "", err
+	}
+	lightningNode.cachedPubkey = pubkey
+	return pubkey, nil
+}
+
+// CheckLnd asks lnd for its info to check that it answers, without waiting out a reconnection to lnd.
+// It gets why lnd is unavailable and since when, if it is.
+func (lightningNode *LightningNode) CheckLnd(ctx context.Context) error {
+	ctx, cancel := lightningNode.rpcContext(ctx)
+	defer cancel()
+	if client, isReconnecting := lightningNode.lightningClient.(*reconnectingLightningClient); isReconnecting {
+		return client.probe(ctx)
+	}
+	_, err := pubkey(ctx, lightningNode.lightningClient)
+	return err
 }
 
-func pubkey(lightningClient lnrpc.LightningClient) (string, error) {
-	ctx := context.Background()
+// pubkey gets the identity pubkey of the lnd node from lightningClient.
+func pubkey(ctx context.Context, lightningClient LndClient) (string, error) {
 	getInfoRequest := lnrpc.GetInfoRequest{}
 	getInfoResponse, err := lightningClient.GetInfo(ctx, &getInfoRequest)
 	if err != nil {
@@ -178,6 +618,40 @@ func pubkey(lightningClient lnrpc.LightningClient) (string, error) {
 	return pubkey, nil
 }
 
+// lndTLSCredentials gets the credentials to dial lnd over TLS, trusting the cert configured by TlsCertBase64
+// if any, otherwise the cert in the file at tlsCertPath.
+func lndTLSCredentials(cfg *Config) (credentials.TransportCredentials, error) {
+	if cfg.TlsCertBase64 != "" {
+		certPEM, err := decodeBase64Setting(cfg.TlsCertBase64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed -tlscertbase64: %w", err)
+		}
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(certPEM) {
+			return nil, errors.New("malformed -tlscertbase64: no PEM certificate in the decoded base64")
+		}
+		return credentials.NewClientTLSFromCert(certPool, ""), nil
+	}
+
+	tlsCertFilePath, err := tlsCertPath(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// The second paramater here is serverNameOverride, set to ""
+	// except to override the virtual host name of authority in test requests.
+	lndTlsCreds, err := credentials.NewClientTLSFromFile(tlsCertFilePath, "")
+	if err != nil {
+		return nil, fmt.Errorf("tls cert %s: %w", tlsCertFilePath, err)
+	}
+	return lndTlsCreds, nil
+}
+
+// decodeBase64Setting decodes the standard base64 of a setting, ignoring whitespace,
+// e.g. the newlines that the base64 command wraps its output with.
+func decodeBase64Setting(setting string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(setting), ""))
+}
+
 // tlsCertPath gets the TlsCertPath from the given Config.
 // If TlsCertPath is "" (not configured), this defaults to the user's ~/.lnd/tls.cert file.
 func tlsCertPath(cfg *Config) (string, error) {
@@ -193,48 +667,57 @@ func tlsCertPath(cfg *Config) (string, error) {
 }
 
 // macaroonFromFile gets a Macaroon with the contents of the configured or default lnd macaroon.
-// The default is the Macaroon in the user's ~/.lnd/data/chain/bitcoin/regtest/admin.macaroon file.
+// The base64 of MacaroonBase64 is used if configured, so the macaroon need not be written to disk.
+// The default is the Macaroon in the user's ~/.lnd/data/chain/bitcoin/{network}/admin.macaroon file.
+// The macaroon grants whoever holds it access to lnd, so errors name the file but never quote its bytes.
 func macaroonFromFile(cfg *Config) (*macaroon.Macaroon, error) {
-	const logPrefix = "lightningnode macaroonFromFile "
-
-	// Get the macaroon for lnd grpc requests.
-	// This macaroon must support creating invoices and signing messages.
+	// Get the default macaroon for lnd grpc requests.
+	// This macaroon must support every call not given a macaroon of its own scope, e.g. paying invoices.
+	if cfg.MacaroonBase64 != "" {
+		macaroonData, err := decodeBase64Setting(cfg.MacaroonBase64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed -macaroonbase64: %w", err)
+		}
+		lndMacaroon := macaroon.Macaroon{}
+		err = lndMacaroon.UnmarshalBinary(macaroonData)
+		if err != nil {
+			return nil, fmt.Errorf("malformed macaroon in -macaroonbase64: %w", err)
+		}
+		return &lndMacaroon, nil
+	}
 	macaroonFilePath, err := macaroonPath(cfg)
 	if err != nil {
-		log.Fatalf(logPrefix+"failed to get macaroon from config %v, error: %v",
-			cfg, err)
 		return nil, err
 	}
+	return readMacaroonFile(macaroonFilePath)
+}
+
+// readMacaroonFile gets the Macaroon in the file at macaroonFilePath.
+func readMacaroonFile(macaroonFilePath string) (*macaroon.Macaroon, error) {
 	macaroonData, err := ioutil.ReadFile(macaroonFilePath)
 	if err != nil {
-		log.Printf(logPrefix+"ReadFile %s, error: %v", cfg.MacaroonPath, err)
 		return nil, err
 	}
 
 	lndMacaroon := macaroon.Macaroon{}
 	err = lndMacaroon.UnmarshalBinary(macaroonData)
 	if err != nil {
-		log.Printf(logPrefix+"UnmarshalBinary macaroon error: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("malformed macaroon %s: %w", macaroonFilePath, err)
 	}
 	return &lndMacaroon, nil
 }
 
 // macaroonPath gets the MacaroonPath from the given Config.
 // If MacaroonPath is "" (not configured), this defaults to the user's ~/.lnd admin macaroon
-// for a local bitcoin regtest network so devs/testers can mine their own blocks to pay with free coins.
+// for the configured Network, by default a local bitcoin regtest network
+// so devs/testers can mine their own blocks to pay with free coins.
 func macaroonPath(cfg *Config) (string, error) {
 	if cfg.MacaroonPath == "" {
 		currentUser, err := user.Current()
 		if err != nil {
 			return "", err
 		}
-		// Hardcode network to regtest for now
-		// to avoid risking real funds and to avoid relying on testnet miners/bandwidth.
-		// Later this should become a configurable parameter defaulting to testnet.
-		// Default to mainnet only in production releases.
-		network := "regtest"
-		macaroonPath := currentUser.HomeDir + "/.lnd/data/chain/bitcoin/" + network + "/admin.macaroon"
+		macaroonPath := currentUser.HomeDir + "/.lnd/data/chain/bitcoin/" + cfg.network() + "/admin.macaroon"
 		return macaroonPath, nil
 	}
 	return cfg.MacaroonPath, nil
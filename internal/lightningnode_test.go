@@ -3,11 +3,25 @@
 package audiostrike
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	art "github.com/audiostrike/music/pkg/art"
 	"github.com/golang/protobuf/proto"
+	"github.com/lightningnetwork/lnd/lnrpc"
 	"testing"
 )
 
+// payerCfg configures a second regtest lnd with a channel to the lnd of cfg to pay its invoices.
+var payerCfg *Config = &Config{
+	ArtistID:     "bobthelistener",
+	ArtDir:       "testart",
+	TlsCertPath:  "regtest.payer.tls.cert",
+	MacaroonPath: "regtest.payer.macaroon",
+	LndHost:      "192.168.122.73",
+	LndGrpcPort:  12009, // regtest
+}
+
 // TODO: split this into integration tests using regtest lightning node and unit tests using mock lightning
 // These unit tests verify conformance to expectated Lightning behavior simulated by a mock Lightning nnode.
 // These integration tests verify expectations about Lightning behavior on regtest to test integration.
@@ -26,7 +40,7 @@ func TestValidatePublication(t *testing.T) {
 		Signature:              testSignature,
 		SerializedArtResources: testMarshaledResources,
 	}
-	validatedResources, err := lightningNode.ValidatePublication(&publication)
+	validatedResources, err := lightningNode.ValidatePublication(context.Background(), &publication)
 	if err != nil {
 		t.Errorf("failed to validate publication, error: %v", err)
 	} else if len(validatedResources.Artists) != 1 {
@@ -43,7 +57,7 @@ func TestSign(t *testing.T) {
 	resources := art.ArtResources{
 		Artists: []*art.Artist{&mockArtist},
 	}
-	_, err = lightningNode.Sign(&resources)
+	_, err = lightningNode.Sign(context.Background(), cfg.ArtistID, &resources)
 	if err != nil {
 		t.Errorf("lightning node is not operational. Sign error: %v", err)
 	}
@@ -64,3 +78,48 @@ func TestSign(t *testing.T) {
 		t.Error("no austk server returned")
 	}
 }
+
+// TestVerifyPayment verifies that only the preimage of a settled invoice proves payment.
+func TestVerifyPayment(t *testing.T) {
+	lightningNode, err := NewLightningNode(cfg, &mockArtServer)
+	if err != nil {
+		t.Fatalf("failed to instantiate lightning node, error: %v", err)
+	}
+	payerNode, err := NewLightningNode(payerCfg, &mockArtServer)
+	if err != nil {
+		t.Fatalf("failed to instantiate payer lightning node, error: %v", err)
+	}
+
+	// Add an invoice with a known preimage to test verification before and after payment.
+	preimage := make([]byte, 32)
+	_, err = rand.Read(preimage)
+	if err != nil {
+		t.Fatalf("rand.Read error: %v", err)
+	}
+	invoiceHash := sha256.Sum256(preimage)
+	addInvoiceResponse, err := lightningNode.lightningClient.AddInvoice(context.Background(),
+		&lnrpc.Invoice{Memo: mockArtistID + "/" + mockTrackID, RPreimage: preimage, Value: 10})
+	if err != nil {
+		t.Fatalf("AddInvoice error: %v", err)
+	}
+
+	isPaid, err := lightningNode.VerifyPayment(context.Background(), invoiceHash[:], preimage)
+	if err != nil || isPaid {
+		t.Errorf("expected unsettled invoice to be unpaid but got %v, error: %v", isPaid, err)
+	}
+
+	paidPreimage, err := payerNode.PayInvoice(context.Background(), addInvoiceResponse.PaymentRequest, 10)
+	if err != nil {
+		t.Fatalf("PayInvoice %s error: %v", addInvoiceResponse.PaymentRequest, err)
+	}
+	isPaid, err = lightningNode.VerifyPayment(context.Background(), invoiceHash[:], paidPreimage)
+	if err != nil || !isPaid {
+		t.Errorf("expected settled invoice to be paid but got %v, error: %v", isPaid, err)
+	}
+
+	wrongPreimage := make([]byte, 32)
+	isPaid, err = lightningNode.VerifyPayment(context.Background(), invoiceHash[:], wrongPreimage)
+	if err != nil || isPaid {
+		t.Errorf("expected wrong preimage not to prove payment but got %v, error: %v", isPaid, err)
+	}
+}
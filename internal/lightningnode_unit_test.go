@@ -0,0 +1,601 @@
+package audiostrike
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/macaroon.v2"
+)
+
+// TestNewLightningNodeErrors tests that NewLightningNode returns an error rather than exiting
+// when lnd credentials or the artist are misconfigured.
+func TestNewLightningNodeErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk-lnd")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tlsCertPath := filepath.Join(dir, "tls.cert")
+	writeTestTLSCert(t, tlsCertPath)
+	macaroonPath := filepath.Join(dir, "admin.macaroon")
+	writeTestMacaroon(t, macaroonPath)
+	malformedMacaroonPath := filepath.Join(dir, "malformed.macaroon")
+	err = ioutil.WriteFile(malformedMacaroonPath, []byte("not a macaroon"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		tlsCertPath  string
+		macaroonPath string
+		artistID     string
+		expectedErr  error
+	}{
+		{"missing tls cert", filepath.Join(dir, "missing.cert"), macaroonPath, mockArtistID, nil},
+		{"missing macaroon", tlsCertPath, filepath.Join(dir, "missing.macaroon"), mockArtistID, nil},
+		{"malformed macaroon", tlsCertPath, malformedMacaroonPath, mockArtistID, nil},
+		{"no artist", tlsCertPath, macaroonPath, "", ErrArtNotFound},
+	}
+	for _, test := range tests {
+		testCfg := &Config{
+			ArtistID:     test.artistID,
+			TlsCertPath:  test.tlsCertPath,
+			MacaroonPath: test.macaroonPath,
+			LndHost:      "127.0.0.1",
+			LndGrpcPort:  1, // never dialed: each case fails first
+		}
+		lightningNode, err := NewLightningNode(testCfg, &mockArtServer)
+		if err == nil {
+			t.Errorf("%s: expected error but got lightning node %v", test.name, lightningNode)
+		} else if lightningNode != nil {
+			t.Errorf("%s: expected no lightning node with error %v", test.name, err)
+		} else if test.expectedErr != nil && !errors.Is(err, test.expectedErr) {
+			t.Errorf("%s: expected %v but got %v", test.name, test.expectedErr, err)
+		}
+	}
+}
+
+// TestBase64Credentials tests that the lnd macaroon and tls cert configured as base64 are used
+// instead of files, and that malformed base64 is reported without quoting it.
+func TestBase64Credentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk-lnd")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	tlsCertPath := filepath.Join(dir, "tls.cert")
+	writeTestTLSCert(t, tlsCertPath)
+	macaroonPath := filepath.Join(dir, "admin.macaroon")
+	writeTestMacaroon(t, macaroonPath)
+	readBase64 := func(path string) string {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile %s error: %v", path, err)
+		}
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	certBase64, macaroonBase64 := readBase64(tlsCertPath), readBase64(macaroonPath)
+
+	// The base64 is preferred to the missing files, and may be wrapped like the output of the base64 command.
+	missingPath := filepath.Join(dir, "missing")
+	base64Cfg := &Config{TlsCertPath: missingPath, MacaroonPath: missingPath,
+		TlsCertBase64: certBase64[:40] + "\n" + certBase64[40:], MacaroonBase64: macaroonBase64}
+	_, err = lndTLSCredentials(base64Cfg)
+	if err != nil {
+		t.Errorf("expected tls credentials from base64 but got error %v", err)
+	}
+	lndMacaroon, err := macaroonFromFile(base64Cfg)
+	if err != nil || string(lndMacaroon.Id()) != "id" {
+		t.Errorf("expected macaroon from base64 but got %v, error: %v", lndMacaroon, err)
+	}
+
+	malformedCfg := &Config{TlsCertBase64: "bm90IGEgY2VydA==", MacaroonBase64: "secret!macaroon"}
+	_, err = lndTLSCredentials(malformedCfg)
+	if err == nil || !strings.Contains(err.Error(), "-tlscertbase64") {
+		t.Errorf("expected malformed tls cert error but got %v", err)
+	}
+	_, err = macaroonFromFile(malformedCfg)
+	if err == nil || !strings.Contains(err.Error(), "-macaroonbase64") || strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected malformed macaroon error without the base64 but got %v", err)
+	}
+}
+
+// blockingLightningClient is an lnd client whose calls hang until their context is done,
+// like a hung lnd. Calls it does not override panic on the nil embedded client.
+type blockingLightningClient struct {
+	lnrpc.LightningClient
+}
+
+func (c blockingLightningClient) GetInfo(ctx context.Context, in *lnrpc.GetInfoRequest, opts ...grpc.CallOption) (*lnrpc.GetInfoResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c blockingLightningClient) SignMessage(ctx context.Context, in *lnrpc.SignMessageRequest, opts ...grpc.CallOption) (*lnrpc.SignMessageResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c blockingLightningClient) AddInvoice(ctx context.Context, in *lnrpc.Invoice, opts ...grpc.CallOption) (*lnrpc.AddInvoiceResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// slowPaymentClient is an lnd client that takes longer to send a payment than the node's rpcTimeout.
+type slowPaymentClient struct {
+	lnrpc.LightningClient
+	delay time.Duration
+}
+
+func (c slowPaymentClient) DecodePayReq(ctx context.Context, in *lnrpc.PayReqString, opts ...grpc.CallOption) (*lnrpc.PayReq, error) {
+	return &lnrpc.PayReq{NumSatoshis: 100}, nil
+}
+
+func (c slowPaymentClient) SendPaymentSync(ctx context.Context, in *lnrpc.SendRequest, opts ...grpc.CallOption) (*lnrpc.SendResponse, error) {
+	select {
+	case <-time.After(c.delay):
+		return &lnrpc.SendResponse{PaymentPreimage: []byte("preimage")}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// TestLightningNodeTimeout tests that calls to a hung lnd fail with context.DeadlineExceeded
+// after the node's rpcTimeout, that payments wait longer for lnd to settle them,
+// and that cancelling the caller's context cancels a call sooner.
+func TestLightningNodeTimeout(t *testing.T) {
+	lightningNode := &LightningNode{
+		lightningClient:   blockingLightningClient{},
+		publishingArtist:  &mockArtist,
+		publishingArtists: map[string]*art.Artist{mockArtistID: &mockArtist},
+		rpcTimeout:        10 * time.Millisecond,
+		logger:            componentLogger("lightningNode"),
+	}
+	ctx := context.Background()
+
+	_, err := lightningNode.RefreshPubkey(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected RefreshPubkey to exceed deadline but got %v", err)
+	}
+	pubkey, err := lightningNode.Pubkey(ctx)
+	if err != nil || pubkey != mockArtist.Pubkey {
+		t.Errorf("expected the stored pubkey %s from a hung lnd but got %s, error: %v", mockArtist.Pubkey, pubkey, err)
+	}
+	_, err = lightningNode.Sign(ctx, mockArtistID, &art.ArtResources{Artists: []*art.Artist{&mockArtist}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected Sign to exceed deadline but got %v", err)
+	}
+	_, _, err = lightningNode.AddInvoice(ctx, "memo", 100)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected AddInvoice to exceed deadline but got %v", err)
+	}
+
+	lightningNode.lightningClient = slowPaymentClient{delay: 5 * lightningNode.rpcTimeout}
+	preimage, err := lightningNode.PayInvoice(ctx, "lnbcrt1u", 100)
+	if err != nil || string(preimage) != "preimage" {
+		t.Errorf("expected a payment slower than rpcTimeout to settle but got %q, error: %v", preimage, err)
+	}
+	err = lightningNode.Keysend(ctx, mockPubkey, 100)
+	if err != nil {
+		t.Errorf("expected a keysend slower than rpcTimeout to settle but got error %v", err)
+	}
+	lightningNode.lightningClient = blockingLightningClient{}
+
+	lightningNode.rpcTimeout = time.Hour
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = lightningNode.Pubkey(cancelledCtx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Pubkey to be cancelled but got %v", err)
+	}
+}
+
+// countingLightningClient is an lnd client that counts its GetInfo calls.
+type countingLightningClient struct {
+	lnrpc.LightningClient
+	getInfoCalls int32
+}
+
+func (c *countingLightningClient) GetInfo(ctx context.Context, in *lnrpc.GetInfoRequest, opts ...grpc.CallOption) (*lnrpc.GetInfoResponse, error) {
+	atomic.AddInt32(&c.getInfoCalls, 1)
+	return &lnrpc.GetInfoResponse{IdentityPubkey: mockPubkey}, nil
+}
+
+// TestPubkeyCache tests that concurrent Pubkey calls ask lnd once between them
+// and that RefreshPubkey asks lnd again.
+func TestPubkeyCache(t *testing.T) {
+	lightningClient := &countingLightningClient{}
+	lightningNode := &LightningNode{
+		lightningClient: lightningClient,
+		rpcTimeout:      time.Second,
+		logger:          componentLogger("lightningNode"),
+	}
+	ctx := context.Background()
+
+	var waitGroup sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			pubkey, err := lightningNode.Pubkey(ctx)
+			if err != nil || pubkey != mockPubkey {
+				t.Errorf("expected pubkey %s but got %s, error: %v", mockPubkey, pubkey, err)
+			}
+		}()
+	}
+	waitGroup.Wait()
+	if calls := atomic.LoadInt32(&lightningClient.getInfoCalls); calls != 1 {
+		t.Errorf("expected 1 GetInfo call but got %d", calls)
+	}
+
+	_, err := lightningNode.RefreshPubkey(ctx)
+	if err != nil {
+		t.Errorf("RefreshPubkey error: %v", err)
+	}
+	if calls := atomic.LoadInt32(&lightningClient.getInfoCalls); calls != 2 {
+		t.Errorf("expected RefreshPubkey to call GetInfo again but got %d calls", calls)
+	}
+}
+
+// lookupLightningClient is an lnd client holding one settled invoice and payments indexed from 1.
+// Like lnd, it answers a lookup of any other invoice with a NotFound status.
+type lookupLightningClient struct {
+	lnrpc.LightningClient
+	invoice  *lnrpc.Invoice
+	payments []*lnrpc.Payment
+}
+
+func (c lookupLightningClient) LookupInvoice(ctx context.Context, in *lnrpc.PaymentHash, opts ...grpc.CallOption) (*lnrpc.Invoice, error) {
+	if !bytes.Equal(in.RHash, c.invoice.RHash) {
+		return nil, status.Error(codes.NotFound, "there are no existing invoices")
+	}
+	return c.invoice, nil
+}
+
+// ListPayments lists a page of payments before IndexOffset, newest first, like lnd with Reversed set.
+func (c lookupLightningClient) ListPayments(ctx context.Context, in *lnrpc.ListPaymentsRequest, opts ...grpc.CallOption) (*lnrpc.ListPaymentsResponse, error) {
+	end := uint64(len(c.payments))
+	if in.IndexOffset > 0 && in.IndexOffset-1 < end {
+		end = in.IndexOffset - 1
+	}
+	start := uint64(0)
+	if end > in.MaxPayments {
+		start = end - in.MaxPayments
+	}
+	page := c.payments[start:end]
+	if len(page) == 0 {
+		return &lnrpc.ListPaymentsResponse{}, nil
+	}
+	return &lnrpc.ListPaymentsResponse{Payments: page,
+		FirstIndexOffset: page[0].PaymentIndex, LastIndexOffset: page[len(page)-1].PaymentIndex}, nil
+}
+
+// TestLookupInvoiceAndPayment tests that invoices and payments are found by hash, even a payment listed
+// pages of payments ago, and that unknown hashes are not found rather than failing with lnd's error.
+func TestLookupInvoiceAndPayment(t *testing.T) {
+	knownHash := sha256.Sum256([]byte("would"))
+	unknownHash := sha256.Sum256([]byte("unknown"))
+	payments := []*lnrpc.Payment{{PaymentHash: hex.EncodeToString(knownHash[:]), ValueSat: 500, Status: lnrpc.Payment_SUCCEEDED}}
+	for i := 0; i < 2*paymentsPageSize+1; i++ {
+		laterHash := sha256.Sum256([]byte(fmt.Sprintf("later %d", i)))
+		payments = append(payments, &lnrpc.Payment{PaymentHash: hex.EncodeToString(laterHash[:]), ValueSat: 1})
+	}
+	for i, payment := range payments {
+		payment.PaymentIndex = uint64(i + 1)
+	}
+	lightningNode := &LightningNode{
+		lightningClient: lookupLightningClient{
+			invoice:  &lnrpc.Invoice{RHash: knownHash[:], Value: 1000, AmtPaidSat: 1000, State: lnrpc.Invoice_SETTLED},
+			payments: payments,
+		},
+		rpcTimeout: time.Second,
+		logger:     componentLogger("lightningNode"),
+	}
+	ctx := context.Background()
+
+	invoice, err := lightningNode.LookupInvoice(ctx, knownHash[:])
+	if err != nil || invoice.State != lnrpc.Invoice_SETTLED || invoice.AmtPaidSat != 1000 {
+		t.Errorf("expected settled invoice of 1000 sats but got %v, error: %v", invoice, err)
+	}
+	_, err = lightningNode.LookupInvoice(ctx, unknownHash[:])
+	if err != ErrInvoiceNotFound {
+		t.Errorf("expected ErrInvoiceNotFound but got %v", err)
+	}
+
+	payment, err := lightningNode.LookupPayment(ctx, knownHash[:])
+	if err != nil || payment.Status != lnrpc.Payment_SUCCEEDED || payment.ValueSat != 500 {
+		t.Errorf("expected succeeded payment of 500 sats but got %v, error: %v", payment, err)
+	}
+	_, err = lightningNode.LookupPayment(ctx, unknownHash[:])
+	if err != ErrPaymentNotFound {
+		t.Errorf("expected ErrPaymentNotFound but got %v", err)
+	}
+}
+
+// writeTestTLSCert writes a self-signed certificate for localhost to certPath.
+func writeTestTLSCert(t *testing.T, certPath string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"austk test"}},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate error: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	err = ioutil.WriteFile(certPath, certPEM, 0644)
+	if err != nil {
+		t.Fatalf("WriteFile %s error: %v", certPath, err)
+	}
+}
+
+// writeTestMacaroon writes a macaroon to macaroonPath in the binary format that lnd writes.
+func writeTestMacaroon(t *testing.T, macaroonPath string) {
+	testMacaroon, err := macaroon.New([]byte("root key"), []byte("id"), "lnd", macaroon.LatestVersion)
+	if err != nil {
+		t.Fatalf("macaroon.New error: %v", err)
+	}
+	macaroonData, err := testMacaroon.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary error: %v", err)
+	}
+	err = ioutil.WriteFile(macaroonPath, macaroonData, 0644)
+	if err != nil {
+		t.Fatalf("WriteFile %s error: %v", macaroonPath, err)
+	}
+}
+
+// scopeLightningClient is an lnd client that rejects the malformed probes of each macaroon scope,
+// denying those whose method is in denied.
+type scopeLightningClient struct {
+	lnrpc.LightningClient
+	denied map[string]bool
+}
+
+func (c scopeLightningClient) reply(method string, err error) error {
+	if c.denied[method] {
+		return status.Error(codes.Unknown, "permission denied")
+	}
+	return err
+}
+
+func (c scopeLightningClient) SignMessage(ctx context.Context, in *lnrpc.SignMessageRequest, opts ...grpc.CallOption) (*lnrpc.SignMessageResponse, error) {
+	return nil, c.reply("SignMessage", status.Error(codes.Unknown, "need a message to sign"))
+}
+
+func (c scopeLightningClient) AddInvoice(ctx context.Context, in *lnrpc.Invoice, opts ...grpc.CallOption) (*lnrpc.AddInvoiceResponse, error) {
+	panic("a macaroon probe added an invoice")
+}
+
+func (c scopeLightningClient) LookupInvoice(ctx context.Context, in *lnrpc.PaymentHash, opts ...grpc.CallOption) (*lnrpc.Invoice, error) {
+	return nil, c.reply("LookupInvoice", status.Error(codes.Unknown, "unable to locate invoice"))
+}
+
+func (c scopeLightningClient) GetInfo(ctx context.Context, in *lnrpc.GetInfoRequest, opts ...grpc.CallOption) (*lnrpc.GetInfoResponse, error) {
+	err := c.reply("GetInfo", nil)
+	if err != nil {
+		return nil, err
+	}
+	return &lnrpc.GetInfoResponse{IdentityPubkey: mockPubkey}, nil
+}
+
+func (c scopeLightningClient) VerifyMessage(ctx context.Context, in *lnrpc.VerifyMessageRequest, opts ...grpc.CallOption) (*lnrpc.VerifyMessageResponse, error) {
+	return nil, c.reply("VerifyMessage", status.Error(codes.Unknown, "need a message to verify"))
+}
+
+func (c scopeLightningClient) DecodePayReq(ctx context.Context, in *lnrpc.PayReqString, opts ...grpc.CallOption) (*lnrpc.PayReq, error) {
+	return nil, c.reply("DecodePayReq", status.Error(codes.Unknown, "invalid payment request"))
+}
+
+// TestMacaroonScopes tests that each lnd call gets the macaroon configured for its scope or else the default,
+// and that a scoped macaroon that lnd denies for its calls is refused at startup.
+func TestMacaroonScopes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk-lnd")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	invoiceMacaroonPath := filepath.Join(dir, "invoice.macaroon")
+	writeTestMacaroon(t, invoiceMacaroonPath)
+	defaultMacaroon, err := macaroon.New([]byte("root key"), []byte("admin"), "lnd", macaroon.LatestVersion)
+	if err != nil {
+		t.Fatalf("macaroon.New error: %v", err)
+	}
+
+	defaultCredential, err := newScopedMacaroonCredential(&Config{}, defaultMacaroon)
+	if err != nil {
+		t.Fatalf("newScopedMacaroonCredential error: %v", err)
+	}
+	if defaultCredential.credentialFor("/lnrpc.Lightning/AddInvoice") != defaultCredential.defaultCredential {
+		t.Errorf("expected the default macaroon for AddInvoice without scoped macaroons")
+	}
+	invoiceCredential, err := newScopedMacaroonCredential(&Config{InvoiceMacaroonPath: invoiceMacaroonPath}, defaultMacaroon)
+	if err != nil {
+		t.Fatalf("newScopedMacaroonCredential with -invoicemacaroon error: %v", err)
+	}
+	for method, isScoped := range map[string]bool{
+		"/lnrpc.Lightning/AddInvoice":      true,
+		"/lnrpc.Lightning/LookupInvoice":   true,
+		"/lnrpc.Lightning/SignMessage":     false,
+		"/lnrpc.Lightning/SendPaymentSync": false,
+	} {
+		isDefault := invoiceCredential.credentialFor(method) == invoiceCredential.defaultCredential
+		if isDefault == isScoped {
+			t.Errorf("expected %s to use the invoice macaroon %v but got default %v", method, isScoped, isDefault)
+		}
+	}
+	_, err = newScopedMacaroonCredential(&Config{SignMacaroonPath: filepath.Join(dir, "missing.macaroon")}, defaultMacaroon)
+	if err == nil || !strings.Contains(err.Error(), "-signmacaroon") {
+		t.Errorf("expected -signmacaroon error for a missing file but got %v", err)
+	}
+
+	allScopesCfg := &Config{
+		SignMacaroonPath:     invoiceMacaroonPath,
+		InvoiceMacaroonPath:  invoiceMacaroonPath,
+		ReadOnlyMacaroonPath: invoiceMacaroonPath,
+	}
+	allScopesCredential, err := newScopedMacaroonCredential(allScopesCfg, defaultMacaroon)
+	if err != nil {
+		t.Fatalf("newScopedMacaroonCredential with all scopes error: %v", err)
+	}
+	logger := componentLogger("lightningNode")
+	tests := []struct {
+		name          string
+		credential    *scopedMacaroonCredential
+		denied        string
+		expectedScope string
+	}{
+		{"permitted", allScopesCredential, "", ""},
+		{"sign denied", allScopesCredential, "SignMessage", "-signmacaroon"},
+		{"invoice denied", allScopesCredential, "LookupInvoice", "-invoicemacaroon"},
+		{"read-only denied", allScopesCredential, "DecodePayReq", "-readonlymacaroon"},
+		{"unscoped call denied", invoiceCredential, "SignMessage", ""},
+	}
+	for _, test := range tests {
+		client := scopeLightningClient{denied: map[string]bool{test.denied: true}}
+		err = checkMacaroonScopes(client, test.credential, time.Second, logger)
+		if test.expectedScope == "" {
+			if err != nil {
+				t.Errorf("%s: expected no error but got %v", test.name, err)
+			}
+		} else if !errors.Is(err, ErrMacaroonDenied) || !strings.Contains(err.Error(), test.expectedScope) {
+			t.Errorf("%s: expected ErrMacaroonDenied for %s but got %v", test.name, test.expectedScope, err)
+		}
+	}
+}
+
+// fakeLndClient is an LndClient whose node has pubkey, signing a message with the pubkey and hash of the message
+// so that any fakeLndClient verifies the signature and recovers the pubkey, as lnd does.
+type fakeLndClient struct {
+	pubkey string
+}
+
+func (c fakeLndClient) GetInfo(ctx context.Context, in *lnrpc.GetInfoRequest, opts ...grpc.CallOption) (*lnrpc.GetInfoResponse, error) {
+	return &lnrpc.GetInfoResponse{IdentityPubkey: c.pubkey}, nil
+}
+
+func (c fakeLndClient) SignMessage(ctx context.Context, in *lnrpc.SignMessageRequest, opts ...grpc.CallOption) (*lnrpc.SignMessageResponse, error) {
+	return &lnrpc.SignMessageResponse{Signature: fmt.Sprintf("%s:%x", c.pubkey, sha256.Sum256(in.Msg))}, nil
+}
+
+func (c fakeLndClient) VerifyMessage(ctx context.Context, in *lnrpc.VerifyMessageRequest, opts ...grpc.CallOption) (*lnrpc.VerifyMessageResponse, error) {
+	separator := strings.LastIndex(in.Signature, ":")
+	if separator < 0 || in.Signature[separator+1:] != fmt.Sprintf("%x", sha256.Sum256(in.Msg)) {
+		return &lnrpc.VerifyMessageResponse{Valid: false}, nil
+	}
+	return &lnrpc.VerifyMessageResponse{Valid: true, Pubkey: in.Signature[:separator]}, nil
+}
+
+func (c fakeLndClient) AddInvoice(ctx context.Context, in *lnrpc.Invoice, opts ...grpc.CallOption) (*lnrpc.AddInvoiceResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "fake lnd adds no invoices")
+}
+
+func (c fakeLndClient) LookupInvoice(ctx context.Context, in *lnrpc.PaymentHash, opts ...grpc.CallOption) (*lnrpc.Invoice, error) {
+	return nil, status.Error(codes.NotFound, "unable to locate invoice")
+}
+
+func (c fakeLndClient) DecodePayReq(ctx context.Context, in *lnrpc.PayReqString, opts ...grpc.CallOption) (*lnrpc.PayReq, error) {
+	return nil, status.Error(codes.Unimplemented, "fake lnd decodes no payment requests")
+}
+
+func (c fakeLndClient) SendPaymentSync(ctx context.Context, in *lnrpc.SendRequest, opts ...grpc.CallOption) (*lnrpc.SendResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "fake lnd sends no payments")
+}
+
+func (c fakeLndClient) ListPayments(ctx context.Context, in *lnrpc.ListPaymentsRequest, opts ...grpc.CallOption) (*lnrpc.ListPaymentsResponse, error) {
+	return &lnrpc.ListPaymentsResponse{}, nil
+}
+
+// TestNewLightningNodeWithClient tests that a node built on a fake lnd stores its artist with the fake's pubkey,
+// signs publications that validate, and tells a tampered or another node's publication from its own.
+func TestNewLightningNodeWithClient(t *testing.T) {
+	alicePubkey := "02" + strings.Repeat("a1", 32)
+	bobPubkey := "03" + strings.Repeat("b2", 32)
+	aliceCfg := &Config{ArtistID: "alice", ArtistName: "Alice"}
+	aliceStorage := NewMemoryArtServer()
+	aliceNode, err := NewLightningNodeWithClient(aliceCfg, aliceStorage, fakeLndClient{pubkey: alicePubkey})
+	if err != nil {
+		t.Fatalf("NewLightningNodeWithClient error: %v", err)
+	}
+	artist, err := aliceStorage.Artist("alice")
+	if err != nil || artist.Pubkey != alicePubkey || artist.Name != "Alice" {
+		t.Errorf("expected Alice stored with pubkey %s but got %v, error: %v", alicePubkey, artist, err)
+	}
+	ctx := context.Background()
+	pubkey, err := aliceNode.Pubkey(ctx)
+	if err != nil || pubkey != alicePubkey {
+		t.Errorf("expected pubkey %s but got %s, error: %v", alicePubkey, pubkey, err)
+	}
+
+	resources := &art.ArtResources{Artists: []*art.Artist{artist},
+		Tracks: []*art.Track{{ArtistId: "alice", ArtistTrackId: "song", Title: "Song"}}}
+	publication, err := aliceNode.Sign(ctx, "alice", resources)
+	if err != nil {
+		t.Fatalf("Sign error: %v", err)
+	}
+	validatedResources, err := aliceNode.ValidatePublication(ctx, publication)
+	if err != nil || len(validatedResources.Tracks) != 1 || validatedResources.Tracks[0].Title != "Song" {
+		t.Errorf("expected the signed track validated but got %v, error: %v", validatedResources, err)
+	}
+	tamperedPublication := proto.Clone(publication).(*art.ArtistPublication)
+	tamperedPublication.SerializedArtResources = append(tamperedPublication.SerializedArtResources, 0)
+	_, err = aliceNode.ValidatePublication(ctx, tamperedPublication)
+	if !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected ErrSignatureInvalid for tampered resources but got %v", err)
+	}
+
+	bobNode, err := NewLightningNodeWithClient(&Config{ArtistID: "bob"}, NewMemoryArtServer(), fakeLndClient{pubkey: bobPubkey})
+	if err != nil {
+		t.Fatalf("NewLightningNodeWithClient for bob error: %v", err)
+	}
+	forgedPublication, err := bobNode.Sign(ctx, "bob", resources)
+	if err != nil {
+		t.Fatalf("Sign for bob error: %v", err)
+	}
+	forgedPublication.Artist = artist
+	_, err = aliceNode.ValidatePublication(ctx, forgedPublication)
+	if !errors.Is(err, ErrPubkeyMismatch) {
+		t.Errorf("expected ErrPubkeyMismatch for alice's art signed by bob but got %v", err)
+	}
+
+	_, err = NewLightningNodeWithClient(&Config{ArtistID: "carol", Pubkey: alicePubkey}, NewMemoryArtServer(),
+		fakeLndClient{pubkey: bobPubkey})
+	if !errors.Is(err, ErrPubkeyMismatch) {
+		t.Errorf("expected ErrPubkeyMismatch for lnd with another pubkey than configured but got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package audiostrike
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/macaroons"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"gopkg.in/macaroon.v2"
+)
+
+// macaroonScope is a set of lnd calls that one macaroon may be configured for,
+// with the least privilege that permits them.
+type macaroonScope struct {
+	// flag names the setting of the macaroon file for the scope.
+	flag string
+	// macaroonPath gets the configured macaroon file for the scope, if any.
+	macaroonPath func(cfg *Config) string
+	// methods are the full grpc names of the lnd methods called with the macaroon of the scope.
+	methods []string
+	// probes make calls of the scope that only read, or that lnd rejects after checking the macaroon,
+	// so they change nothing but fail with a denial if the macaroon does not permit the calls of the scope.
+	// No probe adds an invoice, lest lnd add one, so a macaroon that may read invoices but not add them
+	// is denied only at the first invoice.
+	probes []func(ctx context.Context, client LndClient) error
+}
+
+// macaroonScopes are the scopes with macaroons of their own, from the most to the least privileged.
+// Calls in no scope, such as paying invoices, use the default -macaroon.
+var macaroonScopes = []macaroonScope{
+	{
+		flag:         "signmacaroon",
+		macaroonPath: func(cfg *Config) string { return cfg.SignMacaroonPath },
+		methods:      []string{"/lnrpc.Lightning/SignMessage"},
+		probes: []func(ctx context.Context, client LndClient) error{
+			func(ctx context.Context, client LndClient) error {
+				_, err := client.SignMessage(ctx, &lnrpc.SignMessageRequest{})
+				return err
+			},
+		},
+	},
+	{
+		flag:         "invoicemacaroon",
+		macaroonPath: func(cfg *Config) string { return cfg.InvoiceMacaroonPath },
+		methods:      []string{"/lnrpc.Lightning/AddInvoice", "/lnrpc.Lightning/LookupInvoice"},
+		probes: []func(ctx context.Context, client LndClient) error{
+			func(ctx context.Context, client LndClient) error {
+				_, err := client.LookupInvoice(ctx, &lnrpc.PaymentHash{RHash: make([]byte, 32)})
+				return err
+			},
+		},
+	},
+	{
+		flag:         "readonlymacaroon",
+		macaroonPath: func(cfg *Config) string { return cfg.ReadOnlyMacaroonPath },
+		methods: []string{"/lnrpc.Lightning/GetInfo", "/lnrpc.Lightning/VerifyMessage",
+			"/lnrpc.Lightning/DecodePayReq", "/lnrpc.Lightning/ListPayments"},
+		probes: []func(ctx context.Context, client LndClient) error{
+			func(ctx context.Context, client LndClient) error {
+				_, err := client.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+				return err
+			},
+			func(ctx context.Context, client LndClient) error {
+				_, err := client.VerifyMessage(ctx, &lnrpc.VerifyMessageRequest{})
+				return err
+			},
+			func(ctx context.Context, client LndClient) error {
+				_, err := client.DecodePayReq(ctx, &lnrpc.PayReqString{})
+				return err
+			},
+		},
+	},
+}
+
+// scopedMacaroonCredential sends with each lnd call the macaroon configured for the scope of its method,
+// or else the default macaroon, so that each call carries the least privilege configured for it.
+type scopedMacaroonCredential struct {
+	defaultCredential credentials.PerRPCCredentials
+	// methodCredentials maps the full grpc name of each method in a configured scope to its macaroon.
+	methodCredentials map[string]credentials.PerRPCCredentials
+	// configuredScopes are the scopes configured with macaroons of their own.
+	configuredScopes []macaroonScope
+}
+
+// newScopedMacaroonCredential gets the credential sending the scoped macaroons of cfg, if any,
+// or else defaultMacaroon.
+func newScopedMacaroonCredential(cfg *Config, defaultMacaroon *macaroon.Macaroon) (*scopedMacaroonCredential, error) {
+	credential := &scopedMacaroonCredential{
+		defaultCredential: macaroons.NewMacaroonCredential(defaultMacaroon),
+		methodCredentials: make(map[string]credentials.PerRPCCredentials),
+	}
+	for _, scope := range macaroonScopes {
+		macaroonFilePath := scope.macaroonPath(cfg)
+		if macaroonFilePath == "" {
+			continue // to next scope, which uses the default macaroon
+		}
+		scopeMacaroon, err := readMacaroonFile(macaroonFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("-%s: %w", scope.flag, err)
+		}
+		for _, method := range scope.methods {
+			credential.methodCredentials[method] = macaroons.NewMacaroonCredential(scopeMacaroon)
+		}
+		credential.configuredScopes = append(credential.configuredScopes, scope)
+	}
+	return credential, nil
+}
+
+// credentialFor gets the credential to call the lnd method with the given full grpc name.
+func (credential *scopedMacaroonCredential) credentialFor(method string) credentials.PerRPCCredentials {
+	if methodCredential, isScoped := credential.methodCredentials[method]; isScoped {
+		return methodCredential
+	}
+	return credential.defaultCredential
+}
+
+// GetRequestMetadata gets the macaroon metadata for the lnd method being called.
+func (credential *scopedMacaroonCredential) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	var method string
+	if requestInfo, isKnown := credentials.RequestInfoFromContext(ctx); isKnown {
+		method = requestInfo.Method
+	}
+	return credential.credentialFor(method).GetRequestMetadata(ctx, uri...)
+}
+
+// RequireTransportSecurity reports that macaroons are sent only over TLS.
+func (credential *scopedMacaroonCredential) RequireTransportSecurity() bool {
+	return true
+}
+
+// checkMacaroonScopes probes lnd with client for each scope configured in credential,
+// returning an error wrapping ErrMacaroonDenied if lnd denies the macaroon of a scope.
+// Failures other than a denial, e.g. while lnd is unavailable, are left for the calls to report.
+func checkMacaroonScopes(client LndClient, credential *scopedMacaroonCredential, timeout time.Duration, logger *slog.Logger) error {
+	for _, scope := range credential.configuredScopes {
+		for _, probe := range scope.probes {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			err := probe(ctx, client)
+			cancel()
+			if isLndPermissionDenied(err) {
+				return fmt.Errorf("%w: -%s for %s: %v", ErrMacaroonDenied, scope.flag, strings.Join(scope.methods, ", "), err)
+			}
+			if status.Code(err) == codes.Unavailable || errors.Is(err, context.DeadlineExceeded) {
+				logger.Warn("failed to check scoped macaroons", "macaroon", "-"+scope.flag, "error", err)
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// isLndPermissionDenied reports whether err is lnd's rejection of a macaroon that does not permit the call,
+// or that lnd did not bake.
+func isLndPermissionDenied(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return true
+	}
+	return strings.Contains(err.Error(), "permission denied") || strings.Contains(err.Error(), "verification failed")
+}
@@ -0,0 +1,263 @@
+package audiostrike
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// lndMinBackoff is how long to wait before the first re-dial of an unavailable lnd,
+	// doubling for each further re-dial up to lndMaxBackoff.
+	lndMinBackoff = 250 * time.Millisecond
+	lndMaxBackoff = 30 * time.Second
+)
+
+// lndDialer dials lnd for a client and the connection to close when done with it.
+type lndDialer func() (LndClient, io.Closer, error)
+
+// reconnectingLightningClient is an lnd client that re-dials lnd when a call fails because lnd is Unavailable,
+// e.g. while lnd restarts, waiting with exponential backoff between dials.
+//
+// It retries calls that are safe to repeat until they succeed or their context is done.
+// AddInvoice and SendPaymentSync are not retried, since lnd may have added the invoice or sent the payment
+// before the connection dropped: they fail with the Unavailable error, and the caller decides what to do.
+type reconnectingLightningClient struct {
+	dial lndDialer
+
+	// mutex guards the client and connection of the current dial, their generation counting the dials,
+	// and since when lnd has been unavailable, zero while lnd answers.
+	mutex            sync.Mutex
+	client           LndClient
+	conn             io.Closer
+	generation       int
+	unavailableSince time.Time
+	unavailableErr   error
+	backoff          time.Duration
+
+	// now gets the current time, and sleep waits d or until ctx is done.
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration) error
+	logger *slog.Logger
+}
+
+// newReconnectingLightningClient dials lnd with dial for a client that re-dials with dial when lnd is unavailable.
+func newReconnectingLightningClient(dial lndDialer, logger *slog.Logger) (*reconnectingLightningClient, error) {
+	client, conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	return &reconnectingLightningClient{
+		dial:    dial,
+		client:  client,
+		conn:    conn,
+		backoff: lndMinBackoff,
+		now:     time.Now,
+		sleep:   sleepContext,
+		logger:  logger,
+	}, nil
+}
+
+// sleepContext waits d, or returns the error of ctx if it is done sooner.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// current gets the client of the current dial and its generation.
+func (c *reconnectingLightningClient) current() (LndClient, int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.client, c.generation
+}
+
+// call makes rpc with the current client, re-dialing lnd if it fails as Unavailable.
+// If isRetryable, it waits a backoff before each re-dial and makes rpc again with each new client
+// until rpc succeeds or fails otherwise, or until ctx is done, when it returns lnd's last error.
+// Otherwise it re-dials at once and returns the error, without keeping the caller waiting for a backoff.
+func (c *reconnectingLightningClient) call(ctx context.Context, method string, isRetryable bool, rpc func(LndClient) error) error {
+	for {
+		client, generation := c.current()
+		err := rpc(client)
+		if status.Code(err) != codes.Unavailable {
+			c.markAvailable(generation)
+			return err
+		}
+		backoff := c.markUnavailable(generation, err)
+		if !isRetryable {
+			c.logger.Warn("lnd unavailable", "method", method, "error", err)
+			c.redial(generation)
+			return fmt.Errorf("%w: %w", ErrLndUnavailable, err)
+		}
+		c.logger.Warn("lnd unavailable", "method", method, "backoff", backoff, "error", err)
+		if c.sleep(ctx, backoff) != nil {
+			return fmt.Errorf("%w: %w", ErrLndUnavailable, err)
+		}
+		c.redial(generation)
+	}
+}
+
+// markAvailable notes that lnd answered a call with the client of generation.
+func (c *reconnectingLightningClient) markAvailable(generation int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if generation != c.generation || c.unavailableSince.IsZero() {
+		return
+	}
+	c.logger.Info("lnd reconnected", "unavailable_for", c.now().Sub(c.unavailableSince))
+	c.unavailableSince = time.Time{}
+	c.unavailableErr = nil
+	c.backoff = lndMinBackoff
+}
+
+// markUnavailable notes that the client of generation found lnd unavailable with err,
+// and gets how long to wait before re-dialing.
+func (c *reconnectingLightningClient) markUnavailable(generation int, err error) time.Duration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.unavailableSince.IsZero() {
+		c.unavailableSince = c.now()
+	}
+	c.unavailableErr = err
+	return c.backoff
+}
+
+// redial replaces the client of generation with a new dial, unless a concurrent call has already replaced it,
+// and doubles the backoff before the next re-dial.
+func (c *reconnectingLightningClient) redial(generation int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if generation != c.generation {
+		return
+	}
+	c.backoff *= 2
+	if c.backoff > lndMaxBackoff {
+		c.backoff = lndMaxBackoff
+	}
+	client, conn, err := c.dial()
+	if err != nil {
+		c.logger.Error("failed to redial lnd", "error", err)
+		return
+	}
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.client, c.conn = client, conn
+	c.generation++
+}
+
+// connectionError gets why lnd is unavailable and for how long, or nil if it answered the last call.
+func (c *reconnectingLightningClient) connectionError() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.unavailableSince.IsZero() {
+		return nil
+	}
+	return fmt.Errorf("%w since %s, reconnecting: %w",
+		ErrLndUnavailable, c.unavailableSince.Format(time.RFC3339), c.unavailableErr)
+}
+
+// probe asks lnd for its info once, re-dialing but not retrying if lnd is unavailable,
+// and gets the error of the connection if any.
+func (c *reconnectingLightningClient) probe(ctx context.Context) error {
+	err := c.call(ctx, "GetInfo", false, func(client LndClient) error {
+		_, err := client.GetInfo(ctx, &lnrpc.GetInfoRequest{})
+		return err
+	})
+	if errors.Is(err, ErrLndUnavailable) {
+		return c.connectionError()
+	}
+	return err
+}
+
+// Close closes the connection of the current dial.
+func (c *reconnectingLightningClient) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+func (c *reconnectingLightningClient) GetInfo(ctx context.Context, in *lnrpc.GetInfoRequest, opts ...grpc.CallOption) (response *lnrpc.GetInfoResponse, err error) {
+	err = c.call(ctx, "GetInfo", true, func(client LndClient) error {
+		response, err = client.GetInfo(ctx, in, opts...)
+		return err
+	})
+	return response, err
+}
+
+// SignMessage is retried: signing charges nothing, so signing twice only signs the same message again.
+func (c *reconnectingLightningClient) SignMessage(ctx context.Context, in *lnrpc.SignMessageRequest, opts ...grpc.CallOption) (response *lnrpc.SignMessageResponse, err error) {
+	err = c.call(ctx, "SignMessage", true, func(client LndClient) error {
+		response, err = client.SignMessage(ctx, in, opts...)
+		return err
+	})
+	return response, err
+}
+
+func (c *reconnectingLightningClient) VerifyMessage(ctx context.Context, in *lnrpc.VerifyMessageRequest, opts ...grpc.CallOption) (response *lnrpc.VerifyMessageResponse, err error) {
+	err = c.call(ctx, "VerifyMessage", true, func(client LndClient) error {
+		response, err = client.VerifyMessage(ctx, in, opts...)
+		return err
+	})
+	return response, err
+}
+
+// AddInvoice is not retried, lest a buyer be handed one invoice while lnd also added another.
+func (c *reconnectingLightningClient) AddInvoice(ctx context.Context, in *lnrpc.Invoice, opts ...grpc.CallOption) (response *lnrpc.AddInvoiceResponse, err error) {
+	err = c.call(ctx, "AddInvoice", false, func(client LndClient) error {
+		response, err = client.AddInvoice(ctx, in, opts...)
+		return err
+	})
+	return response, err
+}
+
+func (c *reconnectingLightningClient) DecodePayReq(ctx context.Context, in *lnrpc.PayReqString, opts ...grpc.CallOption) (response *lnrpc.PayReq, err error) {
+	err = c.call(ctx, "DecodePayReq", true, func(client LndClient) error {
+		response, err = client.DecodePayReq(ctx, in, opts...)
+		return err
+	})
+	return response, err
+}
+
+// SendPaymentSync is not retried, lest a payment that lnd sent before the connection dropped be sent twice.
+func (c *reconnectingLightningClient) SendPaymentSync(ctx context.Context, in *lnrpc.SendRequest, opts ...grpc.CallOption) (response *lnrpc.SendResponse, err error) {
+	err = c.call(ctx, "SendPaymentSync", false, func(client LndClient) error {
+		response, err = client.SendPaymentSync(ctx, in, opts...)
+		return err
+	})
+	return response, err
+}
+
+func (c *reconnectingLightningClient) LookupInvoice(ctx context.Context, in *lnrpc.PaymentHash, opts ...grpc.CallOption) (response *lnrpc.Invoice, err error) {
+	err = c.call(ctx, "LookupInvoice", true, func(client LndClient) error {
+		response, err = client.LookupInvoice(ctx, in, opts...)
+		return err
+	})
+	return response, err
+}
+
+func (c *reconnectingLightningClient) ListPayments(ctx context.Context, in *lnrpc.ListPaymentsRequest, opts ...grpc.CallOption) (response *lnrpc.ListPaymentsResponse, err error) {
+	err = c.call(ctx, "ListPayments", true, func(client LndClient) error {
+		response, err = client.ListPayments(ctx, in, opts...)
+		return err
+	})
+	return response, err
+}
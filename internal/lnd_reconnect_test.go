@@ -0,0 +1,108 @@
+package audiostrike
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// droppedLightningClient is an lnd client on a connection that dropped,
+// answering every call with an Unavailable status, or else on a live connection.
+type droppedLightningClient struct {
+	lnrpc.LightningClient
+	isDropped    bool
+	invoiceCalls *int
+}
+
+func (c droppedLightningClient) GetInfo(ctx context.Context, in *lnrpc.GetInfoRequest, opts ...grpc.CallOption) (*lnrpc.GetInfoResponse, error) {
+	if c.isDropped {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+	return &lnrpc.GetInfoResponse{IdentityPubkey: mockPubkey}, nil
+}
+
+func (c droppedLightningClient) AddInvoice(ctx context.Context, in *lnrpc.Invoice, opts ...grpc.CallOption) (*lnrpc.AddInvoiceResponse, error) {
+	*c.invoiceCalls++
+	if c.isDropped {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+	return &lnrpc.AddInvoiceResponse{PaymentRequest: "lnbcrt1"}, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// TestReconnectLnd verifies that calls on a dropped connection to lnd re-dial it with exponential backoff,
+// that GetInfo is retried on the new connection after waiting the backoff but AddInvoice fails at once,
+// and that the node reports lnd unavailable until it answers again.
+func TestReconnectLnd(t *testing.T) {
+	invoiceCalls := 0
+	droppedDials := 4
+	dials := 0
+	dial := func() (LndClient, io.Closer, error) {
+		dials++
+		return droppedLightningClient{isDropped: dials <= droppedDials, invoiceCalls: &invoiceCalls}, nopCloser{}, nil
+	}
+	lndClient, err := newReconnectingLightningClient(dial, componentLogger("lightningNode"))
+	if err != nil {
+		t.Fatalf("newReconnectingLightningClient error: %v", err)
+	}
+	var backoffs []time.Duration
+	lndClient.sleep = func(ctx context.Context, d time.Duration) error {
+		backoffs = append(backoffs, d)
+		return nil
+	}
+	lightningNode := &LightningNode{
+		lightningClient: lndClient,
+		lndConn:         lndClient,
+		rpcTimeout:      time.Second,
+		logger:          componentLogger("lightningNode"),
+	}
+	ctx := context.Background()
+
+	err = lightningNode.CheckLnd(ctx)
+	if !errors.Is(err, ErrLndUnavailable) || !strings.Contains(err.Error(), "lnd unavailable since") {
+		t.Errorf("expected lnd unavailable but got %v", err)
+	}
+	_, _, err = lightningNode.AddInvoice(ctx, "memo", 100)
+	if status.Code(err) != codes.Unavailable || !errors.Is(err, ErrLndUnavailable) || invoiceCalls != 1 {
+		t.Errorf("expected AddInvoice to fail once without retry but got %d calls, error: %v", invoiceCalls, err)
+	}
+	if dials != 3 {
+		t.Errorf("expected lnd re-dialed after each failed call but got %d dials", dials)
+	}
+	if len(backoffs) != 0 {
+		t.Errorf("expected calls that are not retried to fail without waiting but got backoffs %v", backoffs)
+	}
+
+	pubkey, err := lightningNode.RefreshPubkey(ctx)
+	if err != nil || pubkey != mockPubkey {
+		t.Errorf("expected GetInfo to succeed on a new connection but got %s, error: %v", pubkey, err)
+	}
+	if len(backoffs) != 2 || backoffs[0] != 4*lndMinBackoff || backoffs[1] != 8*lndMinBackoff {
+		t.Errorf("expected exponential backoff before each re-dial but got %v", backoffs)
+	}
+	if err = lightningNode.CheckLnd(ctx); err != nil {
+		t.Errorf("expected lnd reconnected but got %v", err)
+	}
+
+	// A retried call gives up with lnd's error once its context is done.
+	droppedDials = 10
+	lndClient.redial(lndClient.generation)
+	lndClient.sleep = sleepContext
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = lightningNode.RefreshPubkey(ctx)
+	if status.Code(err) != codes.Unavailable || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected GetInfo to fail with Unavailable once cancelled but got %v", err)
+	}
+}
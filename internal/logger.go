@@ -0,0 +1,53 @@
+package audiostrike
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Log levels for -loglevel, from most to least verbose.
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+
+	defaultLogLevel = LogLevelInfo
+)
+
+// NewLogger creates a logger writing key=value records at level and above to w.
+// level is debug, info, warn, or error.
+func NewLogger(w io.Writer, level string) (*slog.Logger, error) {
+	var slogLevel slog.Level
+	switch strings.ToLower(level) {
+	case LogLevelDebug:
+		slogLevel = slog.LevelDebug
+	case LogLevelInfo, "":
+		slogLevel = slog.LevelInfo
+	case LogLevelWarn, "warning":
+		slogLevel = slog.LevelWarn
+	case LogLevelError:
+		slogLevel = slog.LevelError
+	default:
+		return nil, fmt.Errorf("unknown log level %q, expected debug, info, warn, or error", level)
+	}
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slogLevel})), nil
+}
+
+// componentLogger gets the configured logger, or the default logger if none is configured,
+// with records labelled by component.
+func (cfg *Config) componentLogger(component string) *slog.Logger {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With("component", component)
+}
+
+// componentLogger gets the default logger with records labelled by component
+// for code constructed without a Config. main sets the default to the configured logger.
+func componentLogger(component string) *slog.Logger {
+	return slog.Default().With("component", component)
+}
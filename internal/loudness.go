@@ -0,0 +1,270 @@
+package audiostrike
+
+import (
+	"fmt"
+	"math"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+)
+
+// Loudness is measured as ITU-R BS.1770-4 specifies: the mean square of K-weighted samples
+// over 400 ms blocks that overlap by 75%, gated to ignore silence and quiet passages.
+const (
+	// loudnessStepsPerBlock is the number of 100 ms steps in each 400 ms block.
+	loudnessStepsPerBlock = 4
+	// absoluteGateLUFS is the loudness below which blocks are ignored as silence.
+	absoluteGateLUFS = -70.0
+	// relativeGateLU is the loudness relative to the blocks above the absolute gate
+	// below which blocks are ignored as quiet passages.
+	relativeGateLU = -10.0
+)
+
+// biquad is a second-order IIR filter with coefficients normalized so that a0 is 1.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	// z1 and z2 hold the state of the filter between samples, in transposed direct form II.
+	z1, z2 float64
+}
+
+func (filter *biquad) process(x float64) float64 {
+	y := filter.b0*x + filter.z1
+	filter.z1 = filter.b1*x - filter.a1*y + filter.z2
+	filter.z2 = filter.b2*x - filter.a2*y
+	return y
+}
+
+// kWeightingFilters gets the two stages of the BS.1770 K-weighting filter for sampleRate:
+// a high shelf that models the acoustic effect of the head, then a high-pass filter.
+// The coefficients are derived from the analog prototype of each stage, as libebur128 derives them,
+// so they match the coefficients that BS.1770 tabulates for 48 kHz and apply to any other sample rate.
+func kWeightingFilters(sampleRate float64) (shelf, highPass biquad) {
+	const (
+		shelfFrequency = 1681.974450955533
+		shelfGainDB    = 3.999843853973347
+		shelfQ         = 0.7071752369554196
+		highPassFreq   = 38.13547087602444
+		highPassQ      = 0.5003270373238773
+	)
+	k := math.Tan(math.Pi * shelfFrequency / sampleRate)
+	vh := math.Pow(10, shelfGainDB/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/shelfQ + k*k
+	shelf = biquad{
+		b0: (vh + vb*k/shelfQ + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/shelfQ + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/shelfQ + k*k) / a0,
+	}
+
+	k = math.Tan(math.Pi * highPassFreq / sampleRate)
+	a0 = 1 + k/highPassQ + k*k
+	highPass = biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/highPassQ + k*k) / a0,
+	}
+	return shelf, highPass
+}
+
+// loudnessMeter accumulates the K-weighted energy of audio samples in 100 ms steps.
+type loudnessMeter struct {
+	channels   int
+	filters    [2][2]biquad // shelf then high-pass filter of each channel
+	stepLength int          // samples per channel in each 100 ms step
+	stepSum    float64      // sum of the squared K-weighted samples of all channels in the current step
+	stepCount  int          // samples per channel so far in the current step
+	// steps has the mean square energy of each whole step, summed over channels.
+	steps []float64
+	// peak is the largest absolute sample value.
+	peak float64
+}
+
+// newLoudnessMeter creates a meter for audio with one (mono) or two (stereo) channels at sampleRate.
+func newLoudnessMeter(sampleRate float64, channels int) *loudnessMeter {
+	if channels != 1 {
+		channels = 2
+	}
+	meter := &loudnessMeter{
+		channels:   channels,
+		stepLength: int(sampleRate / 10),
+	}
+	for channel := range meter.filters {
+		shelf, highPass := kWeightingFilters(sampleRate)
+		meter.filters[channel] = [2]biquad{shelf, highPass}
+	}
+	return meter
+}
+
+// add measures stereo samples, of which only the first channel is measured for mono audio.
+func (meter *loudnessMeter) add(samples [][2]float64) {
+	for _, sample := range samples {
+		for channel := 0; channel < meter.channels; channel++ {
+			x := sample[channel]
+			meter.peak = math.Max(meter.peak, math.Abs(x))
+			filters := &meter.filters[channel]
+			y := filters[1].process(filters[0].process(x))
+			meter.stepSum += y * y
+		}
+		meter.stepCount++
+		if meter.stepCount == meter.stepLength {
+			meter.steps = append(meter.steps, meter.stepSum/float64(meter.stepLength))
+			meter.stepSum, meter.stepCount = 0, 0
+		}
+	}
+}
+
+// blockLoudness gets the loudness in LUFS of the mean square energy of a block.
+func blockLoudness(energy float64) float64 {
+	return -0.691 + 10*math.Log10(energy)
+}
+
+// integratedLoudness gets the gated loudness in LUFS of the samples added to meter.
+// It returns an error if there are no blocks above the absolute gate, i.e. the audio is silent or too short.
+func (meter *loudnessMeter) integratedLoudness() (float64, error) {
+	var blocks []float64
+	for i := 0; i+loudnessStepsPerBlock <= len(meter.steps); i++ {
+		energy := 0.0
+		for _, stepEnergy := range meter.steps[i : i+loudnessStepsPerBlock] {
+			energy += stepEnergy
+		}
+		energy /= loudnessStepsPerBlock
+		if energy > 0 && blockLoudness(energy) > absoluteGateLUFS {
+			blocks = append(blocks, energy)
+		}
+	}
+	if len(blocks) == 0 {
+		return 0, fmt.Errorf("audio is too short or quiet to measure loudness")
+	}
+
+	relativeGate := blockLoudness(meanEnergy(blocks)) + relativeGateLU
+	var gatedBlocks []float64
+	for _, energy := range blocks {
+		if blockLoudness(energy) > relativeGate {
+			gatedBlocks = append(gatedBlocks, energy)
+		}
+	}
+	return blockLoudness(meanEnergy(gatedBlocks)), nil
+}
+
+func meanEnergy(blocks []float64) float64 {
+	sum := 0.0
+	for _, energy := range blocks {
+		sum += energy
+	}
+	return sum / float64(len(blocks))
+}
+
+// AnalyzeLoudness decodes audio to measure its integrated loudness in LUFS per ITU-R BS.1770
+// and its sample peak, the largest absolute sample value where 1.0 is full scale.
+// Players can use these to normalize the volume of tracks from different artists.
+func AnalyzeLoudness(audio AudioFile) (lufs float64, peak float64, err error) {
+	streamer, format, err := audio.Decode()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer streamer.Close()
+
+	meter := newLoudnessMeter(float64(format.SampleRate), format.NumChannels)
+	samples := make([][2]float64, 4096)
+	for {
+		n, ok := streamer.Stream(samples)
+		meter.add(samples[:n])
+		if !ok {
+			break
+		}
+	}
+	err = streamer.Err()
+	if err != nil {
+		return 0, 0, err
+	}
+	lufs, err = meter.integratedLoudness()
+	if err != nil {
+		return 0, 0, err
+	}
+	return lufs, meter.peak, nil
+}
+
+// measureLoudness measures the loudness of audio to record on its track.
+func measureLoudness(audio AudioFile) (*art.Loudness, error) {
+	lufs, peak, err := AnalyzeLoudness(audio)
+	if err != nil {
+		return nil, err
+	}
+	return &art.Loudness{IntegratedLufs: lufs, SamplePeak: peak}, nil
+}
+
+// ReanalyzeTracks measures the loudness and duration of stored tracks that lack them, e.g. tracks added before
+// they were measured at ingest, then publishes the measured tracks. Only tracks of the artists
+// this node publishes are measured, not tracks synced from the nodes of other artists.
+// Measurements that fail, e.g. the loudness of opus tracks, which cannot be decoded, are logged and skipped.
+// It returns the number of tracks measured.
+func (server *AustkServer) ReanalyzeTracks() (int, error) {
+	artists, err := server.artServer.Artists()
+	if err != nil {
+		server.logger.Error("failed to get artists", "error", err)
+		return 0, err
+	}
+
+	measured := 0
+	signingArtistIDs := make(map[string]bool)
+	for artistID, artist := range artists {
+		if _, err := server.PublishingArtist(artistID); err != nil && artist.Pubkey != "" {
+			continue // to next artist, whose own node publishes its tracks
+		}
+		tracks, err := server.artServer.Tracks(artistID)
+		if err != nil {
+			server.logger.Error("failed to get tracks", "artist_id", artistID, "error", err)
+			return measured, err
+		}
+		for _, track := range tracks {
+			if track.Loudness != nil && track.DurationMs != 0 {
+				continue // to next track
+			}
+			logger := server.logger.With("artist_id", artistID, "track_id", track.ArtistTrackId)
+			audio, closeAudio, err := OpenTrackAudio(server.artServer, track)
+			if err != nil {
+				logger.Warn("skip track whose payload cannot be opened", "error", err)
+				continue // to next track
+			}
+
+			measuredTrack := proto.Clone(track).(*art.Track)
+			if track.Loudness == nil {
+				measuredTrack.Loudness, err = measureLoudness(audio)
+				if err != nil {
+					logger.Warn("skip loudness that cannot be measured", "error", err)
+				}
+			}
+			if track.DurationMs == 0 {
+				measuredTrack.DurationMs, err = measureDuration(audio)
+				if err != nil {
+					logger.Warn("skip duration that cannot be measured", "error", err)
+				}
+			}
+			closeAudio()
+			if proto.Equal(measuredTrack, track) {
+				continue // to next track, of which nothing more could be measured
+			}
+			err = server.artServer.StoreTrack(measuredTrack, server)
+			if err != nil {
+				logger.Error("failed to store track", "error", err)
+				return measured, err
+			}
+			logger.Info("measured track", "lufs", measuredTrack.GetLoudness().GetIntegratedLufs(),
+				"peak", measuredTrack.GetLoudness().GetSamplePeak(), "duration_ms", measuredTrack.DurationMs)
+			measured++
+			signingArtistIDs[server.signingArtistID(artistID)] = true
+		}
+	}
+
+	for artistID := range signingArtistIDs {
+		err = server.publish(artistID)
+		if err != nil {
+			return measured, err
+		}
+	}
+	return measured, nil
+}
@@ -0,0 +1,161 @@
+package audiostrike
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/faiface/beep"
+)
+
+// sineAudio is an AudioFile whose audio is a sine wave of frequency and amplitude, without a file or tags.
+// Calls it does not override panic on the nil embedded AudioFile.
+type sineAudio struct {
+	AudioFile
+	frequency  float64
+	amplitude  float64
+	sampleRate beep.SampleRate
+	channels   int
+	length     int // samples per channel
+}
+
+func (audio sineAudio) Decode() (beep.StreamSeekCloser, beep.Format, error) {
+	format := beep.Format{SampleRate: audio.sampleRate, NumChannels: audio.channels, Precision: 2}
+	return &sineStreamer{audio: audio}, format, nil
+}
+
+// sineStreamer streams the samples of a sineAudio.
+type sineStreamer struct {
+	audio    sineAudio
+	position int
+}
+
+func (streamer *sineStreamer) Stream(samples [][2]float64) (int, bool) {
+	if streamer.position >= streamer.audio.length {
+		return 0, false
+	}
+	n := 0
+	for ; n < len(samples) && streamer.position < streamer.audio.length; n++ {
+		phase := 2 * math.Pi * streamer.audio.frequency * float64(streamer.position) / float64(streamer.audio.sampleRate)
+		x := streamer.audio.amplitude * math.Sin(phase)
+		samples[n] = [2]float64{x, x}
+		streamer.position++
+	}
+	return n, true
+}
+
+func (streamer *sineStreamer) Err() error       { return nil }
+func (streamer *sineStreamer) Len() int         { return streamer.audio.length }
+func (streamer *sineStreamer) Position() int    { return streamer.position }
+func (streamer *sineStreamer) Seek(p int) error { streamer.position = p; return nil }
+func (streamer *sineStreamer) Close() error     { return nil }
+
+// TestKWeightingFilters verifies that the K-weighting filter at 48 kHz has the coefficients tabulated in BS.1770.
+func TestKWeightingFilters(t *testing.T) {
+	shelf, highPass := kWeightingFilters(48000)
+	tests := []struct {
+		name     string
+		actual   float64
+		expected float64
+	}{
+		{"shelf b0", shelf.b0, 1.53512485958697},
+		{"shelf b1", shelf.b1, -2.69169618940638},
+		{"shelf b2", shelf.b2, 1.19839281085285},
+		{"shelf a1", shelf.a1, -1.69065929318241},
+		{"shelf a2", shelf.a2, 0.73248077421585},
+		{"high-pass a1", highPass.a1, -1.99004745483398},
+		{"high-pass a2", highPass.a2, 0.99007225036621},
+	}
+	for _, test := range tests {
+		if math.Abs(test.actual-test.expected) > 1e-6 {
+			t.Errorf("expected %s coefficient %.14f but got %.14f", test.name, test.expected, test.actual)
+		}
+	}
+}
+
+// TestAnalyzeLoudness verifies the loudness of sine waves against BS.1770, which reads a full-scale 997 Hz sine
+// on one channel as -3.01 LUFS, and that silent or short audio is not measured.
+func TestAnalyzeLoudness(t *testing.T) {
+	tests := []struct {
+		name         string
+		audio        sineAudio
+		expectedLufs float64
+	}{
+		{"full-scale mono", sineAudio{nil, 997, 1, 48000, 1, 5 * 48000}, -3.01},
+		{"full-scale stereo", sineAudio{nil, 997, 1, 48000, 2, 5 * 48000}, 0},
+		{"-20 dBFS stereo at 44.1 kHz", sineAudio{nil, 997, 0.1, 44100, 2, 5 * 44100}, -20},
+	}
+	for _, test := range tests {
+		lufs, peak, err := AnalyzeLoudness(test.audio)
+		if err != nil {
+			t.Errorf("%s: AnalyzeLoudness error: %v", test.name, err)
+			continue // to next test
+		}
+		if math.Abs(lufs-test.expectedLufs) > 0.05 {
+			t.Errorf("%s: expected %.2f LUFS but got %.2f", test.name, test.expectedLufs, lufs)
+		}
+		if math.Abs(peak-test.audio.amplitude) > 0.001 {
+			t.Errorf("%s: expected peak %.3f but got %.3f", test.name, test.audio.amplitude, peak)
+		}
+	}
+
+	for _, audio := range []sineAudio{
+		{nil, 997, 0, 48000, 2, 5 * 48000},      // silent
+		{nil, 997, 1, 48000, 2, 48000 * 3 / 10}, // shorter than one 400 ms block
+	} {
+		_, _, err := AnalyzeLoudness(audio)
+		if err == nil {
+			t.Errorf("expected error measuring %v", audio)
+		}
+	}
+}
+
+// TestReanalyzeTracks verifies that reanalysis skips tracks already measured and tracks it cannot decode
+// without failing.
+func TestReanalyzeTracks(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	for _, title := range []string{"Measured", "Undecodable"} {
+		filename := filepath.Join(artDir, title+".flac")
+		err = ioutil.WriteFile(filename, flacWithComments("ARTIST=Alice the Artist", "TITLE="+title), 0644)
+		if err != nil {
+			t.Fatalf("WriteFile %s error: %v", filename, err)
+		}
+		_, _, err = austkServer.ImportAudioFile(filename)
+		if err != nil {
+			t.Fatalf("ImportAudioFile %s error: %v", filename, err)
+		}
+	}
+	measuredTrack, err := fileServer.Track(mockArtistID, "measured")
+	if err != nil {
+		t.Fatalf("Track error: %v", err)
+	}
+	measuredTrack.Loudness = &art.Loudness{IntegratedLufs: -14, SamplePeak: 0.9}
+
+	measured, err := austkServer.ReanalyzeTracks()
+	if err != nil || measured != 0 {
+		t.Errorf("expected no tracks measured but got %d, error: %v", measured, err)
+	}
+	measuredTrack, err = fileServer.Track(mockArtistID, "measured")
+	if err != nil || measuredTrack.GetLoudness().GetIntegratedLufs() != -14 {
+		t.Errorf("expected loudness kept for measured track but got %v, error: %v", measuredTrack, err)
+	}
+}
@@ -0,0 +1,896 @@
+package audiostrike
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"sync"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+)
+
+// DbEngineMemory configured as the -dbengine stores art in a MemoryArtServer, e.g. for a demo seed node.
+const DbEngineMemory = "memory"
+
+// MemoryArtServer stores art only in memory, e.g. for hermetic tests or an ephemeral seed node for demos.
+// Its art is lost when the process exits. Payloads are kept in memory too, so TrackFilePath is empty:
+// read payloads with TrackFilePartialReader.
+// All its methods are safe for concurrent use, like those of FileServer.
+type MemoryArtServer struct {
+	catalog memoryCatalog
+	mutex   sync.RWMutex
+
+	logger *slog.Logger
+}
+
+// memoryCatalog is the art of a MemoryArtServer, indexed like the art of a FileServer.
+type memoryCatalog struct {
+	artists     map[string]*art.Artist
+	albums      map[string]map[string]*art.Album
+	tracks      map[string]map[string]*art.Track
+	playlists   map[string]map[string]*art.Playlist
+	peers       map[string]*art.Peer
+	syncCursors map[string]uint64
+	// publicationSequences are indexed by artist pubkey.
+	publicationSequences map[string]uint64
+	peerReputations      map[string]*art.PeerReputation
+	peerBandwidths       map[string]*art.PeerBandwidth
+	// trackStats, payloads, previews, and albumArt are indexed by artist id and track or album id joined by a slash.
+	trackStats    map[string]*art.TrackStats
+	payloads      map[string][]byte
+	previews      map[string][]byte
+	albumArt      map[string][]byte
+	albumArtMimes map[string]string
+
+	// tombstones are indexed by tombstoneKey.
+	tombstones map[string]*art.Tombstone
+	// issuedInvoices are indexed by hex invoice hash.
+	issuedInvoices map[string]*art.IssuedInvoice
+}
+
+// MemorySnapshot is a copy of the art stored in a MemoryArtServer, to restore it later.
+type MemorySnapshot struct {
+	catalog memoryCatalog
+}
+
+// NewMemoryArtServer creates a MemoryArtServer storing no art yet.
+func NewMemoryArtServer() *MemoryArtServer {
+	return &MemoryArtServer{
+		catalog: newMemoryCatalog(),
+		logger:  componentLogger("memoryServer"),
+	}
+}
+
+func newMemoryCatalog() memoryCatalog {
+	return memoryCatalog{
+		artists:              make(map[string]*art.Artist),
+		albums:               make(map[string]map[string]*art.Album),
+		tracks:               make(map[string]map[string]*art.Track),
+		playlists:            make(map[string]map[string]*art.Playlist),
+		peers:                make(map[string]*art.Peer),
+		syncCursors:          make(map[string]uint64),
+		publicationSequences: make(map[string]uint64),
+		tombstones:           make(map[string]*art.Tombstone),
+		peerReputations:      make(map[string]*art.PeerReputation),
+		peerBandwidths:       make(map[string]*art.PeerBandwidth),
+		trackStats:           make(map[string]*art.TrackStats),
+		payloads:             make(map[string][]byte),
+		previews:             make(map[string][]byte),
+		albumArt:             make(map[string][]byte),
+		albumArtMimes:        make(map[string]string),
+		issuedInvoices:       make(map[string]*art.IssuedInvoice),
+	}
+}
+
+// clone copies catalog deeply, so that neither copy changes when art is stored in the other.
+func (catalog *memoryCatalog) clone() memoryCatalog {
+	copied := newMemoryCatalog()
+	for artistID, artist := range catalog.artists {
+		copied.artists[artistID] = proto.Clone(artist).(*art.Artist)
+	}
+	for artistID, artistAlbums := range catalog.albums {
+		copied.albums[artistID] = make(map[string]*art.Album, len(artistAlbums))
+		for albumID, album := range artistAlbums {
+			copied.albums[artistID][albumID] = proto.Clone(album).(*art.Album)
+		}
+	}
+	for artistID, artistTracks := range catalog.tracks {
+		copied.tracks[artistID] = make(map[string]*art.Track, len(artistTracks))
+		for trackID, track := range artistTracks {
+			copied.tracks[artistID][trackID] = proto.Clone(track).(*art.Track)
+		}
+	}
+	for artistID, artistPlaylists := range catalog.playlists {
+		copied.playlists[artistID] = make(map[string]*art.Playlist, len(artistPlaylists))
+		for playlistID, playlist := range artistPlaylists {
+			copied.playlists[artistID][playlistID] = proto.Clone(playlist).(*art.Playlist)
+		}
+	}
+	for pubkey, peer := range catalog.peers {
+		copied.peers[pubkey] = proto.Clone(peer).(*art.Peer)
+	}
+	for pubkey, asOf := range catalog.syncCursors {
+		copied.syncCursors[pubkey] = asOf
+	}
+	for pubkey, sequence := range catalog.publicationSequences {
+		copied.publicationSequences[pubkey] = sequence
+	}
+	for key, tombstone := range catalog.tombstones {
+		copied.tombstones[key] = proto.Clone(tombstone).(*art.Tombstone)
+	}
+	for pubkey, reputation := range catalog.peerReputations {
+		copied.peerReputations[pubkey] = proto.Clone(reputation).(*art.PeerReputation)
+	}
+	for pubkey, bandwidth := range catalog.peerBandwidths {
+		copied.peerBandwidths[pubkey] = proto.Clone(bandwidth).(*art.PeerBandwidth)
+	}
+	for key, stats := range catalog.trackStats {
+		copied.trackStats[key] = proto.Clone(stats).(*art.TrackStats)
+	}
+	for key, invoice := range catalog.issuedInvoices {
+		copied.issuedInvoices[key] = proto.Clone(invoice).(*art.IssuedInvoice)
+	}
+	// Payloads and images are replaced rather than updated in place, so they can be shared.
+	for key, payload := range catalog.payloads {
+		copied.payloads[key] = payload
+	}
+	for key, preview := range catalog.previews {
+		copied.previews[key] = preview
+	}
+	for key, image := range catalog.albumArt {
+		copied.albumArt[key] = image
+	}
+	for key, mime := range catalog.albumArtMimes {
+		copied.albumArtMimes[key] = mime
+	}
+	return copied
+}
+
+// Snapshot copies the art stored so far, e.g. to seed each test with a known catalog quickly.
+func (memoryServer *MemoryArtServer) Snapshot() *MemorySnapshot {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	return &MemorySnapshot{catalog: memoryServer.catalog.clone()}
+}
+
+// Restore replaces the art stored with a copy of the art in snapshot.
+// The snapshot is unchanged, so it may be restored again.
+func (memoryServer *MemoryArtServer) Restore(snapshot *MemorySnapshot) {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	memoryServer.catalog = snapshot.catalog.clone()
+}
+
+// memoryKey joins the id of an artist and of a track or album to index payloads and album art.
+func memoryKey(artistID string, id string) string {
+	return artistID + "/" + id
+}
+
+func (memoryServer *MemoryArtServer) StoreArtist(artist *art.Artist) error {
+	if artist.Pubkey == "" {
+		memoryServer.logger.Warn("reject artist missing pubkey", "artist_id", artist.ArtistId)
+		return fmt.Errorf("Failed to store artist missing Pubkey")
+	}
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	stampUpdatedAt(memoryServer.catalog.artists[artist.ArtistId], artist, nowUnix())
+	memoryServer.catalog.artists[artist.ArtistId] = proto.Clone(artist).(*art.Artist)
+	return nil
+}
+
+func (memoryServer *MemoryArtServer) Artists() (map[string]*art.Artist, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	artists := make(map[string]*art.Artist, len(memoryServer.catalog.artists))
+	for artistID, artist := range memoryServer.catalog.artists {
+		artists[artistID] = artist
+	}
+	return artists, nil
+}
+
+func (memoryServer *MemoryArtServer) Artist(artistID string) (*art.Artist, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	artist := memoryServer.catalog.artists[artistID]
+	if artist == nil {
+		return nil, ErrArtNotFound
+	}
+	return artist, nil
+}
+
+// SearchArtists gets the artists whose names contain query, ignoring case, ordered by name.
+func (memoryServer *MemoryArtServer) SearchArtists(query string) ([]*art.Artist, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	return searchArtists(memoryServer.catalog.artists, query), nil
+}
+
+// StoreAlbum stores the album if its artist is the publishing artist.
+func (memoryServer *MemoryArtServer) StoreAlbum(album *art.Album, publisher Publisher) error {
+	logger := memoryServer.logger.With("artist_id", album.ArtistId, "album_id", album.ArtistAlbumId)
+	if album.ArtistId == "" || album.ArtistAlbumId == "" {
+		logger.Warn("reject malformed album")
+		return fmt.Errorf("malformed album %v missing artist or album id", album)
+	}
+	err := checkAlbumPath(album)
+	if err != nil {
+		logger.Warn("reject album with unsafe id", "error", err)
+		return err
+	}
+	publishingArtist, err := publisher.Artist()
+	if err != nil {
+		logger.Error("failed to get publishing artist", "error", err)
+		return err
+	}
+	albumArtist, err := memoryServer.Artist(album.ArtistId)
+	if err != nil {
+		logger.Error("failed to get album artist", "error", err)
+		return err
+	}
+	if publishingArtist.Pubkey != albumArtist.Pubkey {
+		logger.Info("skip album of artist with another pubkey than the publisher's",
+			"pubkey", albumArtist.Pubkey, "publishing_pubkey", publishingArtist.Pubkey)
+		return nil
+	}
+
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	artistAlbums := memoryServer.catalog.albums[album.ArtistId]
+	if artistAlbums == nil {
+		artistAlbums = make(map[string]*art.Album)
+		memoryServer.catalog.albums[album.ArtistId] = artistAlbums
+	}
+	// Keep the price and cover art already set for the album when storing it again.
+	previousAlbum := artistAlbums[album.ArtistAlbumId]
+	keepAlbumSettings(previousAlbum, album)
+	stampUpdatedAt(previousAlbum, album, nowUnix())
+	artistAlbums[album.ArtistAlbumId] = proto.Clone(album).(*art.Album)
+	return nil
+}
+
+func (memoryServer *MemoryArtServer) Albums(artistID string) (map[string]*art.Album, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	albums := make(map[string]*art.Album, len(memoryServer.catalog.albums[artistID]))
+	for albumID, album := range memoryServer.catalog.albums[artistID] {
+		albums[albumID] = album
+	}
+	return albums, nil
+}
+
+// AlbumsPage gets the page of the artist's albums starting at offset, ordered by ArtistAlbumId.
+func (memoryServer *MemoryArtServer) AlbumsPage(artistID string, offset int, limit int) ([]*art.Album, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	return pageAlbums(memoryServer.catalog.albums[artistID], offset, limit), nil
+}
+
+// SetAlbumPrice sets the price in satoshis to charge for each track of the stored album
+// that has no price of its own.
+func (memoryServer *MemoryArtServer) SetAlbumPrice(album *art.Album, sats uint64) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	storedAlbum := memoryServer.catalog.albums[album.ArtistId][album.ArtistAlbumId]
+	if storedAlbum == nil {
+		memoryServer.logger.Warn("no album to price", "artist_id", album.ArtistId, "album_id", album.ArtistAlbumId)
+		return ErrArtNotFound
+	}
+	pricedAlbum := proto.Clone(storedAlbum).(*art.Album)
+	pricedAlbum.Price = &art.Price{Sats: sats}
+	pricedAlbum.UpdatedAt = nowUnix()
+	memoryServer.catalog.albums[album.ArtistId][album.ArtistAlbumId] = pricedAlbum
+	album.Price = pricedAlbum.Price
+	return nil
+}
+
+// StoreAlbumArt stores image as the cover art of the stored album and records its mime type and hash on the album.
+func (memoryServer *MemoryArtServer) StoreAlbumArt(album *art.Album, image []byte, mime string) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	storedAlbum := memoryServer.catalog.albums[album.ArtistId][album.ArtistAlbumId]
+	if storedAlbum == nil {
+		memoryServer.logger.Warn("no album for cover art", "artist_id", album.ArtistId, "album_id", album.ArtistAlbumId)
+		return ErrArtNotFound
+	}
+	key := memoryKey(album.ArtistId, album.ArtistAlbumId)
+	memoryServer.catalog.albumArt[key] = append([]byte(nil), image...)
+	memoryServer.catalog.albumArtMimes[key] = mime
+	coveredAlbum := proto.Clone(storedAlbum).(*art.Album)
+	setAlbumArt(coveredAlbum, image, mime)
+	memoryServer.catalog.albums[album.ArtistId][album.ArtistAlbumId] = coveredAlbum
+	album.CoverArtMime = coveredAlbum.CoverArtMime
+	album.CoverArtSha256 = coveredAlbum.CoverArtSha256
+	return nil
+}
+
+// DeleteAlbum removes the album and its cover art, or fails with ErrAlbumNotEmpty if it has tracks.
+func (memoryServer *MemoryArtServer) DeleteAlbum(album *art.Album) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	if memoryServer.catalog.albums[album.ArtistId][album.ArtistAlbumId] == nil {
+		return ErrArtNotFound
+	}
+	for _, track := range memoryServer.catalog.tracks[album.ArtistId] {
+		if track.ArtistAlbumId == album.ArtistAlbumId {
+			return fmt.Errorf("%w: %s/%s", ErrAlbumNotEmpty, album.ArtistId, album.ArtistAlbumId)
+		}
+	}
+	key := memoryKey(album.ArtistId, album.ArtistAlbumId)
+	delete(memoryServer.catalog.albumArt, key)
+	delete(memoryServer.catalog.albumArtMimes, key)
+	delete(memoryServer.catalog.albums[album.ArtistId], album.ArtistAlbumId)
+	return nil
+}
+
+// AlbumArt gets the cover art image of the album and its mime type, or ErrArtNotFound if it has none.
+func (memoryServer *MemoryArtServer) AlbumArt(artistID string, artistAlbumID string) ([]byte, string, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	key := memoryKey(artistID, artistAlbumID)
+	image, isStored := memoryServer.catalog.albumArt[key]
+	if memoryServer.catalog.albums[artistID][artistAlbumID] == nil || !isStored {
+		return nil, "", ErrArtNotFound
+	}
+	return image, memoryServer.catalog.albumArtMimes[key], nil
+}
+
+// StorePlaylist stores the playlist if its curating artist is the publishing artist.
+func (memoryServer *MemoryArtServer) StorePlaylist(playlist *art.Playlist, publisher Publisher) error {
+	logger := memoryServer.logger.With("artist_id", playlist.ArtistId, "playlist_id", playlist.ArtistPlaylistId)
+	err := validatePlaylist(playlist)
+	if err != nil {
+		logger.Warn("reject malformed playlist", "error", err)
+		return err
+	}
+	publishingArtist, err := publisher.Artist()
+	if err != nil {
+		logger.Error("failed to get publishing artist", "error", err)
+		return err
+	}
+	playlistArtist, err := memoryServer.Artist(playlist.ArtistId)
+	if err != nil {
+		logger.Error("failed to get playlist artist", "error", err)
+		return err
+	}
+	if publishingArtist.Pubkey != playlistArtist.Pubkey {
+		logger.Info("skip playlist of artist with another pubkey than the publisher's",
+			"pubkey", playlistArtist.Pubkey, "publishing_pubkey", publishingArtist.Pubkey)
+		return nil
+	}
+
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	artistPlaylists := memoryServer.catalog.playlists[playlist.ArtistId]
+	if artistPlaylists == nil {
+		artistPlaylists = make(map[string]*art.Playlist)
+		memoryServer.catalog.playlists[playlist.ArtistId] = artistPlaylists
+	}
+	stampUpdatedAt(artistPlaylists[playlist.ArtistPlaylistId], playlist, nowUnix())
+	artistPlaylists[playlist.ArtistPlaylistId] = proto.Clone(playlist).(*art.Playlist)
+	return nil
+}
+
+// Playlists gets the artist's playlists indexed by ArtistPlaylistId.
+func (memoryServer *MemoryArtServer) Playlists(artistID string) (map[string]*art.Playlist, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	playlists := make(map[string]*art.Playlist, len(memoryServer.catalog.playlists[artistID]))
+	for playlistID, playlist := range memoryServer.catalog.playlists[artistID] {
+		playlists[playlistID] = playlist
+	}
+	return playlists, nil
+}
+
+// Playlist gets the artist's playlist with artistPlaylistID, or ErrArtNotFound if it is not stored.
+func (memoryServer *MemoryArtServer) Playlist(artistID string, artistPlaylistID string) (*art.Playlist, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	playlist := memoryServer.catalog.playlists[artistID][artistPlaylistID]
+	if playlist == nil {
+		return nil, ErrArtNotFound
+	}
+	return playlist, nil
+}
+
+// StoreTrack stores a copy of track metadata.
+func (memoryServer *MemoryArtServer) StoreTrack(track *art.Track, publisher Publisher) error {
+	err := checkTrackPath(track)
+	if err != nil {
+		memoryServer.logger.Warn("reject track with unsafe id", "error", err)
+		return err
+	}
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	artistTracks := memoryServer.catalog.tracks[track.ArtistId]
+	if artistTracks == nil {
+		artistTracks = make(map[string]*art.Track)
+		memoryServer.catalog.tracks[track.ArtistId] = artistTracks
+	}
+	now := nowUnix()
+	stampCreatedAt(artistTracks[track.ArtistTrackId], track, now)
+	stampUpdatedAt(artistTracks[track.ArtistTrackId], track, now)
+	artistTracks[track.ArtistTrackId] = proto.Clone(track).(*art.Track)
+	return nil
+}
+
+// StoreTrackPayload stores the audio bytes of the given track
+// and records their SHA-256 hash on the track to publish with it.
+func (memoryServer *MemoryArtServer) StoreTrackPayload(track *art.Track, payload []byte) error {
+	payloadHash := sha256.Sum256(payload)
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	memoryServer.catalog.payloads[memoryKey(track.ArtistId, track.ArtistTrackId)] = append([]byte(nil), payload...)
+	storedTrack := memoryServer.catalog.tracks[track.ArtistId][track.ArtistTrackId]
+	if storedTrack != nil && !bytes.Equal(storedTrack.PayloadSha256, payloadHash[:]) {
+		hashedTrack := proto.Clone(storedTrack).(*art.Track)
+		hashedTrack.PayloadSha256 = payloadHash[:]
+		hashedTrack.UpdatedAt = nowUnix()
+		memoryServer.catalog.tracks[track.ArtistId][track.ArtistTrackId] = hashedTrack
+	}
+	track.PayloadSha256 = payloadHash[:]
+	return nil
+}
+
+// StoreTrackPreview stores preview as the free preview clip of the stored track
+// and records its length, track.PreviewSeconds, and its hash on the track.
+func (memoryServer *MemoryArtServer) StoreTrackPreview(track *art.Track, preview []byte) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	storedTrack := memoryServer.catalog.tracks[track.ArtistId][track.ArtistTrackId]
+	if storedTrack == nil {
+		return ErrArtNotFound
+	}
+	memoryServer.catalog.previews[memoryKey(track.ArtistId, track.ArtistTrackId)] = append([]byte(nil), preview...)
+	previewedTrack := proto.Clone(storedTrack).(*art.Track)
+	if setTrackPreview(previewedTrack, preview, track.PreviewSeconds) {
+		memoryServer.catalog.tracks[track.ArtistId][track.ArtistTrackId] = previewedTrack
+	}
+	track.PreviewSeconds = previewedTrack.PreviewSeconds
+	track.PreviewSha256 = previewedTrack.PreviewSha256
+	return nil
+}
+
+// TrackPreview gets the preview clip of the track, or ErrArtNotFound if it has none.
+func (memoryServer *MemoryArtServer) TrackPreview(artistID string, artistTrackID string) ([]byte, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	track := memoryServer.catalog.tracks[artistID][artistTrackID]
+	preview, isStored := memoryServer.catalog.previews[memoryKey(artistID, artistTrackID)]
+	if track == nil || track.PreviewSeconds == 0 || !isStored {
+		return nil, ErrArtNotFound
+	}
+	return preview, nil
+}
+
+func (memoryServer *MemoryArtServer) Tracks(artistID string) (map[string]*art.Track, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	tracks := make(map[string]*art.Track, len(memoryServer.catalog.tracks[artistID]))
+	for trackID, track := range memoryServer.catalog.tracks[artistID] {
+		tracks[trackID] = track
+	}
+	return tracks, nil
+}
+
+// TracksPage gets the page of the artist's tracks starting at offset, ordered by ArtistTrackId.
+func (memoryServer *MemoryArtServer) TracksPage(artistID string, offset int, limit int) ([]*art.Track, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	return pageTracks(memoryServer.catalog.tracks[artistID], offset, limit), nil
+}
+
+func (memoryServer *MemoryArtServer) Track(artistID string, artistTrackID string) (*art.Track, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	track := memoryServer.catalog.tracks[artistID][artistTrackID]
+	if track == nil {
+		return nil, ErrArtNotFound
+	}
+	return track, nil
+}
+
+// SearchTracks gets the tracks whose titles contain query, ignoring case, and that pass filter,
+// ordered by artist then by title.
+func (memoryServer *MemoryArtServer) SearchTracks(query string, filter TrackFilter) ([]*art.Track, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	return searchTracks(memoryServer.catalog.tracks, query, filter), nil
+}
+
+// RecentTracks gets at most limit tracks, newest first, ordered like recentTracks.
+func (memoryServer *MemoryArtServer) RecentTracks(limit int) ([]*art.Track, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	return recentTracks(memoryServer.catalog.tracks, limit), nil
+}
+
+// TrackFilePath is empty, since no payload is stored in a file.
+func (memoryServer *MemoryArtServer) TrackFilePath(track *art.Track) string {
+	return ""
+}
+
+// TrackFilePartialReader reads the stored payload of track from the byte at offset.
+func (memoryServer *MemoryArtServer) TrackFilePartialReader(track *art.Track, offset int64) (io.ReadCloser, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	payload, isStored := memoryServer.catalog.payloads[memoryKey(track.ArtistId, track.ArtistTrackId)]
+	if !isStored {
+		return nil, fmt.Errorf("no payload stored for track %s/%s: %w", track.ArtistId, track.ArtistTrackId, ErrArtNotFound)
+	}
+	if offset < 0 || offset > int64(len(payload)) {
+		return nil, fmt.Errorf("offset %d outside %d byte payload of track %s/%s",
+			offset, len(payload), track.ArtistId, track.ArtistTrackId)
+	}
+	return ioutil.NopCloser(bytes.NewReader(payload[offset:])), nil
+}
+
+// TrackPayloadSize gets the length in bytes of the stored payload of track.
+func (memoryServer *MemoryArtServer) TrackPayloadSize(track *art.Track) (int64, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	payload, isStored := memoryServer.catalog.payloads[memoryKey(track.ArtistId, track.ArtistTrackId)]
+	if !isStored {
+		return 0, fmt.Errorf("no payload stored for track %s/%s: %w", track.ArtistId, track.ArtistTrackId, ErrArtNotFound)
+	}
+	return int64(len(payload)), nil
+}
+
+// VerifyStoredTrack checks that the stored payload of track still matches the hash recorded when it was stored.
+func (memoryServer *MemoryArtServer) VerifyStoredTrack(track *art.Track) error {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	storedTrack := memoryServer.catalog.tracks[track.ArtistId][track.ArtistTrackId]
+	if storedTrack == nil {
+		return ErrArtNotFound
+	}
+	if len(storedTrack.PayloadSha256) == 0 {
+		return fmt.Errorf("track %s/%s has no payload hash to verify", track.ArtistId, track.ArtistTrackId)
+	}
+	payload, isStored := memoryServer.catalog.payloads[memoryKey(track.ArtistId, track.ArtistTrackId)]
+	if !isStored {
+		return fmt.Errorf("no payload stored for track %s/%s: %w", track.ArtistId, track.ArtistTrackId, ErrArtNotFound)
+	}
+	payloadHash := sha256.Sum256(payload)
+	if !bytes.Equal(payloadHash[:], storedTrack.PayloadSha256) {
+		return fmt.Errorf("%w: stored payload has hash %x, not %x for %s/%s", ErrPayloadMismatch,
+			payloadHash, storedTrack.PayloadSha256, track.ArtistId, track.ArtistTrackId)
+	}
+	return nil
+}
+
+// SetTrackPrice sets the price in satoshis to charge for the stored track.
+func (memoryServer *MemoryArtServer) SetTrackPrice(track *art.Track, sats uint64) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	storedTrack := memoryServer.catalog.tracks[track.ArtistId][track.ArtistTrackId]
+	if storedTrack == nil {
+		memoryServer.logger.Warn("no track to price", "artist_id", track.ArtistId, "track_id", track.ArtistTrackId)
+		return ErrArtNotFound
+	}
+	pricedTrack := proto.Clone(storedTrack).(*art.Track)
+	pricedTrack.Price = &art.Price{Sats: sats}
+	pricedTrack.UpdatedAt = nowUnix()
+	memoryServer.catalog.tracks[track.ArtistId][track.ArtistTrackId] = pricedTrack
+	track.Price = pricedTrack.Price
+	return nil
+}
+
+// DeleteTrack removes the track and its payload.
+func (memoryServer *MemoryArtServer) DeleteTrack(track *art.Track) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	if memoryServer.catalog.tracks[track.ArtistId][track.ArtistTrackId] == nil {
+		return ErrArtNotFound
+	}
+	delete(memoryServer.catalog.payloads, memoryKey(track.ArtistId, track.ArtistTrackId))
+	delete(memoryServer.catalog.previews, memoryKey(track.ArtistId, track.ArtistTrackId))
+	delete(memoryServer.catalog.tracks[track.ArtistId], track.ArtistTrackId)
+	return nil
+}
+
+// EvictTrack removes the payload of track, keeping the track.
+func (memoryServer *MemoryArtServer) EvictTrack(track *art.Track) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	if memoryServer.catalog.tracks[track.ArtistId][track.ArtistTrackId] == nil {
+		return ErrArtNotFound
+	}
+	delete(memoryServer.catalog.payloads, memoryKey(track.ArtistId, track.ArtistTrackId))
+	return nil
+}
+
+// StorePeer stores the peer, normalized, if it is the publishing artist's own node.
+func (memoryServer *MemoryArtServer) StorePeer(peer *art.Peer, publisher Publisher) error {
+	peer = normalizePeer(peer)
+	logger := memoryServer.logger.With("peer", peer.Pubkey)
+	publishingArtist, err := publisher.Artist()
+	if err != nil {
+		logger.Error("failed to get publishing artist", "error", err)
+		return err
+	}
+	if publishingArtist.Pubkey != peer.Pubkey {
+		logger.Info("skip peer with another pubkey than the publishing artist's",
+			"publishing_artist_id", publishingArtist.ArtistId)
+		return nil
+	}
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	stampUpdatedAt(memoryServer.catalog.peers[peer.Pubkey], peer, nowUnix())
+	memoryServer.catalog.peers[peer.Pubkey] = peer
+	return nil
+}
+
+// DeletePeer removes the peer with pubkey, with its sync cursor, reputation, and bandwidth.
+func (memoryServer *MemoryArtServer) DeletePeer(pubkey string) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	if memoryServer.catalog.peers[pubkey] == nil {
+		return ErrPeerNotFound
+	}
+	delete(memoryServer.catalog.peers, pubkey)
+	delete(memoryServer.catalog.syncCursors, pubkey)
+	delete(memoryServer.catalog.peerReputations, pubkey)
+	delete(memoryServer.catalog.peerBandwidths, pubkey)
+	return nil
+}
+
+// Peers gets all the peers, page by page, indexed by pubkey.
+func (memoryServer *MemoryArtServer) Peers() (map[string]*art.Peer, error) {
+	return collectPeers(memoryServer)
+}
+
+// PeersPage gets the page of peers starting at offset, ordered by pubkey.
+func (memoryServer *MemoryArtServer) PeersPage(offset int, limit int) ([]*art.Peer, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	return pagePeers(memoryServer.catalog.peers, offset, limit), nil
+}
+
+func (memoryServer *MemoryArtServer) Peer(pubkey string) (*art.Peer, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	peer := memoryServer.catalog.peers[pubkey]
+	if peer == nil {
+		return nil, ErrPeerNotFound
+	}
+	return peer, nil
+}
+
+// StorePublication stores the published artist details, albums, tracks, playlists, and peers.
+// Of the peers, only the publishing node's own record and records already stored are stored.
+func (memoryServer *MemoryArtServer) StorePublication(publication *art.ArtistPublication) error {
+	resources, err := read(publication)
+	if err != nil {
+		memoryServer.logger.Error("failed to read publication", "artist_id", publication.Artist.ArtistId, "error", err)
+		return err
+	}
+	err = keepVouchedPeers(memoryServer, publication.Artist.Pubkey, resources)
+	if err != nil {
+		return err
+	}
+	now := nowUnix()
+	previousArtist, _ := memoryServer.Artist(publication.Artist.ArtistId)
+	stampUpdatedAt(previousArtist, publication.Artist, now)
+	err = stampResources(memoryServer, resources, now)
+	if err != nil {
+		return err
+	}
+
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	catalog := &memoryServer.catalog
+	catalog.artists[publication.Artist.ArtistId] = proto.Clone(publication.Artist).(*art.Artist)
+	for _, artist := range resources.Artists {
+		catalog.artists[artist.ArtistId] = artist
+	}
+	for _, album := range resources.Albums {
+		if catalog.albums[album.ArtistId] == nil {
+			catalog.albums[album.ArtistId] = make(map[string]*art.Album)
+		}
+		catalog.albums[album.ArtistId][album.ArtistAlbumId] = album
+	}
+	for _, track := range resources.Tracks {
+		if catalog.tracks[track.ArtistId] == nil {
+			catalog.tracks[track.ArtistId] = make(map[string]*art.Track)
+		}
+		catalog.tracks[track.ArtistId][track.ArtistTrackId] = track
+	}
+	for _, playlist := range resources.Playlists {
+		if catalog.playlists[playlist.ArtistId] == nil {
+			catalog.playlists[playlist.ArtistId] = make(map[string]*art.Playlist)
+		}
+		catalog.playlists[playlist.ArtistId][playlist.ArtistPlaylistId] = playlist
+	}
+	for _, peer := range resources.Peers {
+		catalog.peers[peer.Pubkey] = peer
+	}
+	return nil
+}
+
+// SyncCursor gets the AsOf time of the resources last synced from the peer with pubkey, or 0 if never synced.
+func (memoryServer *MemoryArtServer) SyncCursor(pubkey string) (uint64, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	return memoryServer.catalog.syncCursors[pubkey], nil
+}
+
+// StoreSyncCursor stores the AsOf time of the resources synced from the peer with pubkey.
+func (memoryServer *MemoryArtServer) StoreSyncCursor(pubkey string, asOf uint64) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	memoryServer.catalog.syncCursors[pubkey] = asOf
+	return nil
+}
+
+// PublicationSequence gets the Sequence of the latest publication validated from the artist with pubkey,
+// or 0 if none was.
+func (memoryServer *MemoryArtServer) PublicationSequence(pubkey string) (uint64, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	return memoryServer.catalog.publicationSequences[pubkey], nil
+}
+
+// StorePublicationSequence stores the Sequence of the latest publication validated from the artist with pubkey.
+func (memoryServer *MemoryArtServer) StorePublicationSequence(pubkey string, sequence uint64) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	memoryServer.catalog.publicationSequences[pubkey] = sequence
+	return nil
+}
+
+// StoreTombstone stores the tombstone of a deleted track or album, replacing any earlier one of it.
+func (memoryServer *MemoryArtServer) StoreTombstone(tombstone *art.Tombstone) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	memoryServer.catalog.tombstones[tombstoneKey(tombstone)] = tombstone
+	return nil
+}
+
+// Tombstones gets the stored tombstones in the order of sortTombstones.
+func (memoryServer *MemoryArtServer) Tombstones() ([]*art.Tombstone, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	tombstones := make([]*art.Tombstone, 0, len(memoryServer.catalog.tombstones))
+	for _, tombstone := range memoryServer.catalog.tombstones {
+		tombstones = append(tombstones, tombstone)
+	}
+	sortTombstones(tombstones)
+	return tombstones, nil
+}
+
+// DeleteExpiredTombstones deletes the tombstones of art deleted before deletedBefore.
+func (memoryServer *MemoryArtServer) DeleteExpiredTombstones(deletedBefore uint64) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	for key, tombstone := range memoryServer.catalog.tombstones {
+		if tombstone.DeletedAt < deletedBefore {
+			delete(memoryServer.catalog.tombstones, key)
+		}
+	}
+	return nil
+}
+
+// PeerReputation gets a copy of the reputation of the peer with pubkey, which has no failures if none were stored.
+func (memoryServer *MemoryArtServer) PeerReputation(pubkey string) (*art.PeerReputation, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	reputation := memoryServer.catalog.peerReputations[pubkey]
+	if reputation == nil {
+		return &art.PeerReputation{Pubkey: pubkey}, nil
+	}
+	return proto.Clone(reputation).(*art.PeerReputation), nil
+}
+
+// StorePeerReputation stores the reputation of a peer.
+func (memoryServer *MemoryArtServer) StorePeerReputation(reputation *art.PeerReputation) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	memoryServer.catalog.peerReputations[reputation.Pubkey] = proto.Clone(reputation).(*art.PeerReputation)
+	return nil
+}
+
+// PeerBandwidth gets a copy of the bytes served to the peer with pubkey, which are none if none were stored.
+func (memoryServer *MemoryArtServer) PeerBandwidth(pubkey string) (*art.PeerBandwidth, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	bandwidth := memoryServer.catalog.peerBandwidths[pubkey]
+	if bandwidth == nil {
+		return &art.PeerBandwidth{Pubkey: pubkey}, nil
+	}
+	return proto.Clone(bandwidth).(*art.PeerBandwidth), nil
+}
+
+// StorePeerBandwidth stores the bytes served to a peer.
+func (memoryServer *MemoryArtServer) StorePeerBandwidth(bandwidth *art.PeerBandwidth) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	memoryServer.catalog.peerBandwidths[bandwidth.Pubkey] = proto.Clone(bandwidth).(*art.PeerBandwidth)
+	return nil
+}
+
+// TrackStats gets a copy of the plays and purchases counted for a track, which are none if none were stored.
+func (memoryServer *MemoryArtServer) TrackStats(artistID string, artistTrackID string) (*art.TrackStats, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	stats := memoryServer.catalog.trackStats[memoryKey(artistID, artistTrackID)]
+	if stats == nil {
+		return &art.TrackStats{ArtistId: artistID, ArtistTrackId: artistTrackID}, nil
+	}
+	return proto.Clone(stats).(*art.TrackStats), nil
+}
+
+// StoreTrackStats stores the plays and purchases counted for a track.
+func (memoryServer *MemoryArtServer) StoreTrackStats(stats *art.TrackStats) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	memoryServer.catalog.trackStats[memoryKey(stats.ArtistId, stats.ArtistTrackId)] = proto.Clone(stats).(*art.TrackStats)
+	return nil
+}
+
+// AddTrackStats adds the plays and purchases of stats to those stored for its track.
+func (memoryServer *MemoryArtServer) AddTrackStats(stats *art.TrackStats) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	key := memoryKey(stats.ArtistId, stats.ArtistTrackId)
+	storedStats := memoryServer.catalog.trackStats[key]
+	if storedStats == nil {
+		storedStats = &art.TrackStats{ArtistId: stats.ArtistId, ArtistTrackId: stats.ArtistTrackId}
+		memoryServer.catalog.trackStats[key] = storedStats
+	}
+	addTrackStats(storedStats, stats)
+	return nil
+}
+
+// DeleteTrackStats deletes the stats of a track, if any.
+func (memoryServer *MemoryArtServer) DeleteTrackStats(artistID string, artistTrackID string) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	delete(memoryServer.catalog.trackStats, memoryKey(artistID, artistTrackID))
+	return nil
+}
+
+// TopTrackStats gets copies of the stats of at most limit tracks, ordered like topTrackStats.
+func (memoryServer *MemoryArtServer) TopTrackStats(limit int) ([]*art.TrackStats, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	stats := make([]*art.TrackStats, 0, len(memoryServer.catalog.trackStats))
+	for _, trackStats := range memoryServer.catalog.trackStats {
+		stats = append(stats, proto.Clone(trackStats).(*art.TrackStats))
+	}
+	return topTrackStats(stats, limit), nil
+}
+
+// StoreIssuedInvoice stores a copy of the invoice, replacing any stored with its hash.
+func (memoryServer *MemoryArtServer) StoreIssuedInvoice(invoice *art.IssuedInvoice) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	memoryServer.catalog.issuedInvoices[issuedInvoiceKey(invoice.InvoiceHash)] = proto.Clone(invoice).(*art.IssuedInvoice)
+	return nil
+}
+
+// IssuedInvoice gets a copy of the invoice issued with invoiceHash, or ErrArtNotFound.
+func (memoryServer *MemoryArtServer) IssuedInvoice(invoiceHash []byte) (*art.IssuedInvoice, error) {
+	memoryServer.mutex.RLock()
+	defer memoryServer.mutex.RUnlock()
+	invoice := memoryServer.catalog.issuedInvoices[issuedInvoiceKey(invoiceHash)]
+	if invoice == nil {
+		return nil, ErrArtNotFound
+	}
+	return proto.Clone(invoice).(*art.IssuedInvoice), nil
+}
+
+// DeleteExpiredInvoices deletes the invoices never settled that expired before expiredBefore.
+func (memoryServer *MemoryArtServer) DeleteExpiredInvoices(expiredBefore uint64) error {
+	memoryServer.mutex.Lock()
+	defer memoryServer.mutex.Unlock()
+	for key, invoice := range memoryServer.catalog.issuedInvoices {
+		if isExpiredInvoice(invoice, expiredBefore) {
+			delete(memoryServer.catalog.issuedInvoices, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package audiostrike
+
+import (
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+func TestMemoryArtServerConformance(t *testing.T) {
+	runArtServerConformance(t, func() ArtServer {
+		return NewMemoryArtServer()
+	})
+}
+
+// TestMemoryArtServerSnapshot verifies that restoring a snapshot undoes the art stored since
+// and that storing art after the snapshot does not change it.
+func TestMemoryArtServerSnapshot(t *testing.T) {
+	memoryServer := NewMemoryArtServer()
+	err := memoryServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID, Title: "Seeded Track"}
+	err = memoryServer.StoreTrack(track, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	err = memoryServer.StoreTrackPayload(track, []byte("seeded payload"))
+	if err != nil {
+		t.Fatalf("StoreTrackPayload error: %v", err)
+	}
+	snapshot := memoryServer.Snapshot()
+
+	for i := 0; i < 2; i++ {
+		err = memoryServer.SetTrackPrice(track, 5)
+		if err != nil {
+			t.Fatalf("SetTrackPrice error: %v", err)
+		}
+		err = memoryServer.StoreTrack(&art.Track{ArtistId: mockArtistID, ArtistTrackId: "othertrack"}, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreTrack error: %v", err)
+		}
+
+		memoryServer.Restore(snapshot)
+		tracks, err := memoryServer.Tracks(mockArtistID)
+		if err != nil || len(tracks) != 1 || tracks[mockTrackID].GetPrice() != nil {
+			t.Errorf("expected only the unpriced seeded track after restore but got %v, error: %v", tracks, err)
+		}
+		err = memoryServer.VerifyStoredTrack(track)
+		if err != nil {
+			t.Errorf("expected seeded payload restored but got error %v", err)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package audiostrike
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+)
+
+// ParseArtistMerge parses the -mergeartist value, {from artist id}/{to artist id}, into the ids of the artists to merge.
+func ParseArtistMerge(merge string) (fromID string, toID string, err error) {
+	fromID, toID, isSplit := strings.Cut(merge, "/")
+	if !isSplit || fromID == "" || toID == "" || strings.Contains(toID, "/") {
+		return "", "", fmt.Errorf("artist merge %q is not {from artist id}/{to artist id}", merge)
+	}
+	return fromID, toID, nil
+}
+
+// MergeArtist moves all the art of the artist with fromID to the artist with toID, e.g. a near-duplicate artist
+// "alice-in-chains" created by importing files tagged "Alice-In-Chains" beside "aliceinchains" tagged "Alice In Chains",
+// then publishes both again.
+// Each album moves with its cover art unless the target artist has an album with the same id, which gets its tracks.
+// Each track keeps its ArtistTrackId, with its payload and preview moved under the target artist and its plays and
+// purchases counted for it instead. Playlists of hosted artists that list a moved track list it under the target
+// artist. Tombstones of the moved tracks and albums are published for peers to delete the copies they synced.
+// Peers need no reassigning: they are stored by the pubkey of their node, which both artists must share.
+// The source artist keeps its record, without art, since stored artists are not deleted.
+// If a step of the merge fails, the steps done are undone, leaving the art of both artists as it was.
+//
+// It fails with ErrArtNotFound if either artist is not stored or this node does not publish the target artist,
+// with a *ForeignArtError if the source artist has another pubkey than the target artist,
+// and with ErrTrackCollision, before moving anything, if the target artist has a track with the id
+// of a track of the source artist.
+func (server *AustkServer) MergeArtist(fromID string, toID string) error {
+	logger := server.logger.With("artist_id", fromID, "to_artist_id", toID)
+	if fromID == toID {
+		return fmt.Errorf("cannot merge artist %s into itself", fromID)
+	}
+	toArtist, err := server.artServer.Artist(toID)
+	if err != nil {
+		logger.Warn("no artist to merge into", "error", err)
+		return err
+	}
+	// The moved art is signed by the target artist, so it must be hosted here rather than fall to the default artist.
+	_, err = server.PublishingArtist(toID)
+	if err != nil {
+		logger.Warn("refuse to merge into artist this node does not publish", "error", err)
+		return err
+	}
+	fromArtist, err := server.artServer.Artist(fromID)
+	if err != nil {
+		logger.Warn("no artist to merge", "error", err)
+		return err
+	}
+	if fromArtist.Pubkey != toArtist.Pubkey {
+		logger.Warn("refuse to merge artist with another pubkey", "pubkey", fromArtist.Pubkey)
+		return &ForeignArtError{Record: "artist", ArtistID: fromID}
+	}
+
+	tracks, err := server.artServer.Tracks(fromID)
+	if err != nil && !errors.Is(err, ErrArtNotFound) {
+		return err
+	}
+	for _, track := range tracks {
+		_, err = server.artServer.Track(toID, track.ArtistTrackId)
+		if err == nil {
+			logger.Warn("refuse to merge track whose id the target artist has", "track_id", track.ArtistTrackId)
+			return fmt.Errorf("%w: %s/%s is already stored", ErrTrackCollision, toID, track.ArtistTrackId)
+		} else if !errors.Is(err, ErrArtNotFound) {
+			return err
+		}
+	}
+
+	albums, err := server.artServer.Albums(fromID)
+	if err != nil && !errors.Is(err, ErrArtNotFound) {
+		return err
+	}
+
+	var rollback mergeRollback
+	err = server.mergeArt(fromID, toID, albums, tracks, &rollback)
+	if err != nil {
+		logger.Warn("roll back failed merge", "error", err)
+		rollback.run(logger)
+		return err
+	}
+	logger.Info("merged artist", "albums", len(albums), "tracks", len(tracks))
+
+	err = server.publish(server.signingArtistID(toID))
+	if err != nil {
+		return err
+	}
+	if server.signingArtistID(fromID) == server.signingArtistID(toID) {
+		return nil
+	}
+	return server.publish(server.signingArtistID(fromID))
+}
+
+// mergeRollback undoes the steps of a merge done so far if a later step fails.
+type mergeRollback []func() error
+
+// add records undo to undo the step just done.
+func (rollback *mergeRollback) add(undo func() error) {
+	*rollback = append(*rollback, undo)
+}
+
+// run undoes the steps done, the last first, logging any step that fails to undo and going on to the rest.
+func (rollback mergeRollback) run(logger *slog.Logger) {
+	for i := len(rollback) - 1; i >= 0; i-- {
+		err := rollback[i]()
+		if err != nil {
+			logger.Error("failed to roll back merge step", "step", i, "error", err)
+		}
+	}
+}
+
+// mergeArt moves the albums and tracks of the artist with fromID to the artist with toID, relists the moved tracks
+// in playlists, and stores the tombstones of the moved art, recording in rollback how to undo each step.
+func (server *AustkServer) mergeArt(fromID string, toID string, albums map[string]*art.Album,
+	tracks map[string]*art.Track, rollback *mergeRollback) error {
+	toAlbums, err := server.artServer.Albums(toID)
+	if err != nil && !errors.Is(err, ErrArtNotFound) {
+		return err
+	}
+	for _, album := range albums {
+		err := server.mergeAlbum(album, toID, rollback)
+		if err != nil {
+			return err
+		}
+	}
+	// Merge the tracks of each album in order, so those numbered after the tracks of an album
+	// the artist has already keep their order.
+	sortedTracks := make([]*art.Track, 0, len(tracks))
+	for _, track := range tracks {
+		sortedTracks = append(sortedTracks, track)
+	}
+	sort.Slice(sortedTracks, func(i, j int) bool {
+		if sortedTracks[i].ArtistAlbumId != sortedTracks[j].ArtistAlbumId {
+			return sortedTracks[i].ArtistAlbumId < sortedTracks[j].ArtistAlbumId
+		}
+		return sortedTracks[i].AlbumTrackNumber < sortedTracks[j].AlbumTrackNumber
+	})
+	for _, track := range sortedTracks {
+		err := server.mergeTrack(track, toID, toAlbums[track.ArtistAlbumId] != nil, rollback)
+		if err != nil {
+			return err
+		}
+	}
+	for _, album := range albums {
+		err := server.deleteMergedAlbum(album, rollback)
+		if err != nil {
+			return err
+		}
+	}
+	err = server.relistMergedTracks(fromID, toID, rollback)
+	if err != nil {
+		return err
+	}
+	// Tombstones of art stored again by the rollback are not published, so they need no undoing.
+	for _, track := range tracks {
+		err = server.storeTombstone(fromID, "", track.ArtistTrackId)
+		if err != nil {
+			return err
+		}
+	}
+	for _, album := range albums {
+		err = server.storeTombstone(fromID, album.ArtistAlbumId, "")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeAlbum stores album, with its cover art, under the artist with toID unless that artist has an album
+// with its id already.
+func (server *AustkServer) mergeAlbum(album *art.Album, toID string, rollback *mergeRollback) error {
+	logger := server.logger.With("artist_id", album.ArtistId, "album_id", album.ArtistAlbumId, "to_artist_id", toID)
+	toAlbums, err := server.artServer.Albums(toID)
+	if err != nil && !errors.Is(err, ErrArtNotFound) {
+		return err
+	}
+	if toAlbums[album.ArtistAlbumId] != nil {
+		logger.Info("merge album tracks into album of target artist")
+		return nil
+	}
+	mergedAlbum := proto.Clone(album).(*art.Album)
+	mergedAlbum.ArtistId = toID
+	err = server.artServer.StoreAlbum(mergedAlbum, server)
+	if err != nil {
+		logger.Error("failed to store merged album", "error", err)
+		return err
+	}
+	rollback.add(func() error {
+		return server.artServer.DeleteAlbum(mergedAlbum)
+	})
+	image, mime, err := server.artServer.AlbumArt(album.ArtistId, album.ArtistAlbumId)
+	if errors.Is(err, ErrArtNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	err = server.artServer.StoreAlbumArt(mergedAlbum, image, mime)
+	if err != nil {
+		logger.Error("failed to store merged cover art", "error", err)
+		return err
+	}
+	return nil
+}
+
+// deleteMergedAlbum deletes album, whose tracks were merged, with its cover art.
+func (server *AustkServer) deleteMergedAlbum(album *art.Album, rollback *mergeRollback) error {
+	logger := server.logger.With("artist_id", album.ArtistId, "album_id", album.ArtistAlbumId)
+	image, mime, err := server.artServer.AlbumArt(album.ArtistId, album.ArtistAlbumId)
+	if err != nil && !errors.Is(err, ErrArtNotFound) {
+		return err
+	}
+	err = server.artServer.DeleteAlbum(album)
+	if err != nil {
+		logger.Error("failed to delete merged album", "error", err)
+		return err
+	}
+	rollback.add(func() error {
+		err := server.artServer.StoreAlbum(album, server)
+		if err != nil || image == nil {
+			return err
+		}
+		return server.artServer.StoreAlbumArt(album, image, mime)
+	})
+	return nil
+}
+
+// mergeTrack moves track, with its payload, preview, and stats, to the artist with toID.
+// A track merged into an album the artist has already, with isAlbumStored, is numbered after its tracks.
+func (server *AustkServer) mergeTrack(track *art.Track, toID string, isAlbumStored bool, rollback *mergeRollback) error {
+	mergedTrack := proto.Clone(track).(*art.Track)
+	mergedTrack.ArtistId = toID
+	if isAlbumStored {
+		// Number the track after those of the album rather than take the number of one of them.
+		albumTrackNumber, err := server.nextAlbumTrackNumber(toID, track.ArtistAlbumId)
+		if err != nil {
+			return err
+		}
+		mergedTrack.AlbumTrackNumber = albumTrackNumber
+	}
+	err := server.moveTrack(track, mergedTrack)
+	if err != nil {
+		return err
+	}
+	rollback.add(func() error {
+		return server.moveTrack(mergedTrack, track)
+	})
+	return nil
+}
+
+// relistMergedTracks stores again each playlist of a hosted artist that lists a track of the artist with fromID,
+// listing it under the artist with toID instead.
+func (server *AustkServer) relistMergedTracks(fromID string, toID string, rollback *mergeRollback) error {
+	for _, artistID := range server.config.PublishingArtistIDs() {
+		playlists, err := server.artServer.Playlists(artistID)
+		if errors.Is(err, ErrArtNotFound) {
+			continue // to next artist, who has no playlists
+		} else if err != nil {
+			return err
+		}
+		for _, playlist := range playlists {
+			relistedPlaylist := proto.Clone(playlist).(*art.Playlist)
+			isRelisted := false
+			for _, trackReference := range relistedPlaylist.Tracks {
+				if trackReference.ArtistId == fromID {
+					trackReference.ArtistId = toID
+					isRelisted = true
+				}
+			}
+			if !isRelisted {
+				continue // to next playlist
+			}
+			err = server.artServer.StorePlaylist(relistedPlaylist, server)
+			if err != nil {
+				server.logger.Error("failed to relist merged tracks in playlist", "artist_id", artistID,
+					"playlist_id", playlist.ArtistPlaylistId, "error", err)
+				return err
+			}
+			playlist := playlist
+			rollback.add(func() error {
+				return server.artServer.StorePlaylist(playlist, server)
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package audiostrike
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// TestMergeArtist verifies that merging a duplicate artist moves its albums, cover art, tracks, payloads, previews,
+// and stats to the other artist, relists its tracks in playlists, and leaves no art, stats, or payload files under it,
+// that merging into an artist not stored or not published by this node, from an artist with another pubkey,
+// or onto a track id the other artist has is refused, and that a merge failing partway is rolled back.
+func TestMergeArtist(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	artServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	austkServer, err := NewAustkServer(cfg, artServer, &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	duplicateID := "artist-mctester"
+	for _, artist := range []*art.Artist{&mockArtist, {ArtistId: duplicateID, Name: "Artist-McTester", Pubkey: mockPubkey},
+		{ArtistId: "unhosted", Name: "Unhosted", Pubkey: mockPubkey}, {ArtistId: "foreign", Name: "Foreign", Pubkey: "foreignpubkey"}} {
+		err = artServer.StoreArtist(artist)
+		if err != nil {
+			t.Fatalf("StoreArtist %s error: %v", artist.ArtistId, err)
+		}
+	}
+	album := &art.Album{ArtistId: duplicateID, ArtistAlbumId: "dirt", Title: "Dirt"}
+	err = artServer.StoreAlbum(album, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreAlbum error: %v", err)
+	}
+	err = artServer.StoreAlbumArt(album, []byte("cover"), "image/jpeg")
+	if err != nil {
+		t.Fatalf("StoreAlbumArt error: %v", err)
+	}
+	single := &art.Track{ArtistId: duplicateID, ArtistTrackId: "single", Title: "Single"}
+	albumTrack := &art.Track{ArtistId: duplicateID, ArtistTrackId: "dirt/would", Title: "Would?",
+		ArtistAlbumId: "dirt", AlbumTrackNumber: 13}
+	for _, track := range []*art.Track{single, albumTrack} {
+		err = artServer.StoreTrack(track, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreTrack error: %v", err)
+		}
+		err = artServer.StoreTrackPayload(track, []byte("payload of "+track.Title))
+		if err != nil {
+			t.Fatalf("StoreTrackPayload error: %v", err)
+		}
+	}
+	albumTrack.PreviewSeconds = 30
+	err = artServer.StoreTrackPreview(albumTrack, []byte("preview of Would?"))
+	if err != nil {
+		t.Fatalf("StoreTrackPreview error: %v", err)
+	}
+	err = artServer.StoreTrackStats(&art.TrackStats{ArtistId: duplicateID, ArtistTrackId: "dirt/would", Plays: 3})
+	if err != nil {
+		t.Fatalf("StoreTrackStats error: %v", err)
+	}
+	playlist := &art.Playlist{ArtistId: mockArtistID, ArtistPlaylistId: "grunge", Title: "Grunge",
+		Tracks: []*art.TrackReference{{ArtistId: duplicateID, ArtistTrackId: "dirt/would"}}}
+	err = artServer.StorePlaylist(playlist, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StorePlaylist error: %v", err)
+	}
+
+	err = austkServer.MergeArtist(duplicateID, unknownID)
+	if !errors.Is(err, ErrArtNotFound) {
+		t.Errorf("expected ErrArtNotFound merging into an artist not stored but got %v", err)
+	}
+	err = austkServer.MergeArtist(duplicateID, "unhosted")
+	if !errors.Is(err, ErrArtNotFound) {
+		t.Errorf("expected ErrArtNotFound merging into an artist this node does not publish but got %v", err)
+	}
+	var foreignArtErr *ForeignArtError
+	err = austkServer.MergeArtist("foreign", mockArtistID)
+	if !errors.As(err, &foreignArtErr) || foreignArtErr.ArtistID != "foreign" {
+		t.Errorf("expected ForeignArtError merging an artist with another pubkey but got %v", err)
+	}
+	collidingTrack := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "single", Title: "Single"}
+	err = artServer.StoreTrack(collidingTrack, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	err = austkServer.MergeArtist(duplicateID, mockArtistID)
+	if !errors.Is(err, ErrTrackCollision) {
+		t.Errorf("expected ErrTrackCollision merging a track id the artist has but got %v", err)
+	}
+	_, err = artServer.Track(duplicateID, "dirt/would")
+	if err != nil {
+		t.Errorf("expected refused merge to move nothing but got error %v", err)
+	}
+	err = artServer.DeleteTrack(collidingTrack)
+	if err != nil {
+		t.Fatalf("DeleteTrack error: %v", err)
+	}
+
+	// A directory in the way of a moved payload fails the merge partway, which is rolled back.
+	blockedPath := artServer.TrackFilePath(&art.Track{ArtistId: mockArtistID, ArtistTrackId: "single"})
+	err = os.MkdirAll(blockedPath, 0755)
+	if err != nil {
+		t.Fatalf("MkdirAll error: %v", err)
+	}
+	err = austkServer.MergeArtist(duplicateID, mockArtistID)
+	if err == nil {
+		t.Errorf("expected error merging a payload onto a directory")
+	}
+	for _, track := range []*art.Track{single, albumTrack} {
+		err = artServer.VerifyStoredTrack(&art.Track{ArtistId: duplicateID, ArtistTrackId: track.ArtistTrackId})
+		if err != nil {
+			t.Errorf("expected track %s rolled back with its payload but got %v", track.ArtistTrackId, err)
+		}
+	}
+	albums, _ := artServer.Albums(mockArtistID)
+	if albums["dirt"] != nil {
+		t.Errorf("expected merged album rolled back but got %v", albums)
+	}
+	image, _, err := artServer.AlbumArt(duplicateID, "dirt")
+	if err != nil || string(image) != "cover" {
+		t.Errorf("expected cover art of rolled back album but got %q, error: %v", image, err)
+	}
+	preview, err := artServer.TrackPreview(duplicateID, "dirt/would")
+	if err != nil || string(preview) != "preview of Would?" {
+		t.Errorf("expected preview of rolled back track but got %q, error: %v", preview, err)
+	}
+	stats, err := artServer.TrackStats(duplicateID, "dirt/would")
+	if err != nil || stats.Plays != 3 {
+		t.Errorf("expected plays of rolled back track but got %v, error: %v", stats, err)
+	}
+	playlist, err = artServer.Playlist(mockArtistID, "grunge")
+	if err != nil || playlist.Tracks[0].ArtistId != duplicateID {
+		t.Errorf("expected playlist to list rolled back track under %s but got %v, error: %v", duplicateID, playlist, err)
+	}
+	err = os.RemoveAll(blockedPath)
+	if err != nil {
+		t.Fatalf("RemoveAll error: %v", err)
+	}
+
+	err = austkServer.MergeArtist(duplicateID, mockArtistID)
+	if err != nil {
+		t.Fatalf("MergeArtist error: %v", err)
+	}
+	tracks, _ := artServer.Tracks(duplicateID)
+	albums, _ = artServer.Albums(duplicateID)
+	if len(tracks) != 0 || len(albums) != 0 {
+		t.Errorf("expected no tracks or albums left under merged artist but got %v and %v", tracks, albums)
+	}
+	if _, err = os.Stat(filepath.Join(artDir, duplicateID, "single.mp3")); !os.IsNotExist(err) {
+		t.Errorf("expected no payload file left under merged artist but got error %v", err)
+	}
+	for _, track := range []*art.Track{single, albumTrack} {
+		err = artServer.VerifyStoredTrack(&art.Track{ArtistId: mockArtistID, ArtistTrackId: track.ArtistTrackId})
+		if err != nil {
+			t.Errorf("expected merged track %s to verify against its moved payload but got %v", track.ArtistTrackId, err)
+		}
+	}
+	preview, err = artServer.TrackPreview(mockArtistID, "dirt/would")
+	if err != nil || string(preview) != "preview of Would?" {
+		t.Errorf("expected preview of merged track but got %q, error: %v", preview, err)
+	}
+	image, _, err = artServer.AlbumArt(mockArtistID, "dirt")
+	if err != nil || string(image) != "cover" {
+		t.Errorf("expected cover art of merged album but got %q, error: %v", image, err)
+	}
+	stats, err = artServer.TrackStats(mockArtistID, "dirt/would")
+	if err != nil || stats.Plays != 3 {
+		t.Errorf("expected plays of merged track but got %v, error: %v", stats, err)
+	}
+	stats, err = artServer.TrackStats(duplicateID, "dirt/would")
+	if err != nil || stats.Plays != 0 {
+		t.Errorf("expected no plays left under merged artist but got %v, error: %v", stats, err)
+	}
+	playlist, err = artServer.Playlist(mockArtistID, "grunge")
+	if err != nil || playlist.Tracks[0].ArtistId != mockArtistID {
+		t.Errorf("expected playlist to list merged track under %s but got %v, error: %v", mockArtistID, playlist, err)
+	}
+	tombstones, err := artServer.Tombstones()
+	if err != nil || len(tombstones) != 3 {
+		t.Errorf("expected tombstones of 2 merged tracks and 1 album but got %v, error: %v", tombstones, err)
+	}
+	report, err := VerifyArt(artServer, artDir, false)
+	if err != nil || !report.OK() {
+		t.Errorf("expected no orphans after merge but got %v, error: %v", report, err)
+	}
+}
+
+// TestMergeArtistIntoAlbum verifies that tracks merged into an album the other artist has already
+// are numbered after its tracks, in their order, so every track stays listed in the album.
+func TestMergeArtistIntoAlbum(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	artServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	austkServer, err := NewAustkServer(cfg, artServer, &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	duplicateID := "artist-mctester"
+	for _, artist := range []*art.Artist{&mockArtist, {ArtistId: duplicateID, Name: "Artist-McTester", Pubkey: mockPubkey}} {
+		err = artServer.StoreArtist(artist)
+		if err != nil {
+			t.Fatalf("StoreArtist %s error: %v", artist.ArtistId, err)
+		}
+		err = artServer.StoreAlbum(&art.Album{ArtistId: artist.ArtistId, ArtistAlbumId: "dirt", Title: "Dirt"}, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreAlbum error: %v", err)
+		}
+	}
+	for _, track := range []*art.Track{
+		{ArtistId: mockArtistID, ArtistTrackId: "dirt/rooster", Title: "Rooster", ArtistAlbumId: "dirt", AlbumTrackNumber: 1},
+		{ArtistId: mockArtistID, ArtistTrackId: "dirt/them-bones", Title: "Them Bones", ArtistAlbumId: "dirt",
+			AlbumTrackNumber: 2},
+		{ArtistId: duplicateID, ArtistTrackId: "dirt/would", Title: "Would?", ArtistAlbumId: "dirt", AlbumTrackNumber: 1},
+		{ArtistId: duplicateID, ArtistTrackId: "dirt/down-in-a-hole", Title: "Down in a Hole", ArtistAlbumId: "dirt",
+			AlbumTrackNumber: 2},
+	} {
+		err = artServer.StoreTrack(track, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreTrack error: %v", err)
+		}
+	}
+
+	err = austkServer.MergeArtist(duplicateID, mockArtistID)
+	if err != nil {
+		t.Fatalf("MergeArtist error: %v", err)
+	}
+	albumTracks, err := artServer.AlbumTracks(mockArtistID, "dirt")
+	if err != nil {
+		t.Fatalf("AlbumTracks error: %v", err)
+	}
+	expectedTrackIDs := map[uint32]string{1: "dirt/rooster", 2: "dirt/them-bones", 3: "dirt/would", 4: "dirt/down-in-a-hole"}
+	if len(albumTracks) != len(expectedTrackIDs) {
+		t.Errorf("expected %d tracks listed in the album but got %v", len(expectedTrackIDs), albumTracks)
+	}
+	for number, trackID := range expectedTrackIDs {
+		if albumTracks[number].GetArtistTrackId() != trackID {
+			t.Errorf("expected track %s numbered %d in the album but got %v", trackID, number, albumTracks[number])
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package audiostrike
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// The metrics count what this node does for monitoring at /metrics.
+// Each is registered in metricsRegistry, so tests can read them without a listener.
+var (
+	tracksStoredTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "austk",
+		Name:      "tracks_stored_total",
+		Help:      "Track payloads stored, whether added locally or downloaded from peers.",
+	})
+	peersSyncedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "austk",
+		Name:      "peers_synced_total",
+		Help:      "Syncs that stored art from a peer.",
+	})
+	syncFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "austk",
+		Name:      "sync_failures_total",
+		Help:      "Syncs from a peer that failed, by reason.",
+	}, []string{"reason"})
+	syncDurationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "austk",
+		Name:      "sync_duration_seconds",
+		Help:      "Time to sync art from a peer, whether or not the sync failed.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	})
+	invoicesCreatedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "austk",
+		Name:      "invoices_created_total",
+		Help:      "Lightning invoices created to sell tracks.",
+	})
+	paymentsSettledTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "austk",
+		Name:      "payments_settled_total",
+		Help:      "Track invoices proven paid by a buyer's preimage.",
+	})
+	downloadBytesServedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "austk",
+		Name:      "download_bytes_served_total",
+		Help:      "Bytes of track payloads served to buyers and peers.",
+	})
+	peerBytesServedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "austk",
+		Name:      "peer_bytes_served_total",
+		Help:      "Bytes of track payloads downloaded and streamed to peers, counted against their quotas.",
+	})
+
+	publicationsSignedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "austk",
+		Name:      "publications_signed_total",
+		Help:      "Publications of art signed by lnd.",
+	})
+	publicationCacheHitsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "austk",
+		Name:      "publication_cache_hits_total",
+		Help:      "Publications of art served again from the cache without signing it again.",
+	})
+
+	metricsRegistry = newMetricsRegistry()
+)
+
+// newMetricsRegistry registers all the metrics of this node.
+func newMetricsRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		tracksStoredTotal,
+		peersSyncedTotal,
+		syncFailuresTotal,
+		syncDurationSeconds,
+		invoicesCreatedTotal,
+		paymentsSettledTotal,
+		downloadBytesServedTotal,
+		peerBytesServedTotal,
+		publicationsSignedTotal,
+		publicationCacheHitsTotal,
+	)
+	return registry
+}
+
+// MetricsHandler serves the metrics of this node in the prometheus text format.
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// recordPeerSync records a sync from a peer that took duration and failed with err unless err is nil.
+func recordPeerSync(duration time.Duration, err error) {
+	syncDurationSeconds.Observe(duration.Seconds())
+	if err != nil {
+		syncFailuresTotal.WithLabelValues(syncFailureReason(err)).Inc()
+	} else {
+		peersSyncedTotal.Inc()
+	}
+}
+
+// syncFailureReason classifies why a sync failed, to label sync_failures_total.
+func syncFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrSignatureInvalid):
+		return "signature_invalid"
+	case errors.Is(err, ErrPubkeyMismatch):
+		return "pubkey_mismatch"
+	case errors.Is(err, ErrPayloadMismatch):
+		return "payload_mismatch"
+	case errors.Is(err, ErrArtNotFound):
+		return "art_not_found"
+	default:
+		return "other"
+	}
+}
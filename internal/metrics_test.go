@@ -0,0 +1,73 @@
+package audiostrike
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestMetrics tests that invoices, settled payments, and syncs are counted and served at /metrics.
+func TestMetrics(t *testing.T) {
+	pricedCfg := *cfg
+	pricedCfg.DefaultPrice = 1500
+	mockLightningNode, err := NewMockLightningNode(&pricedCfg, &mockArtServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(&pricedCfg, &mockArtServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+
+	invoicesCreated := testutil.ToFloat64(invoicesCreatedTotal)
+	paymentsSettled := testutil.ToFloat64(paymentsSettledTotal)
+	track, _ := mockArtServer.Track(mockArtistID, mockTrackID)
+	_, _, err = austkServer.CreateTrackInvoice(context.Background(), track)
+	if err != nil {
+		t.Fatalf("CreateTrackInvoice error: %v", err)
+	}
+	// The mock lightning node hashes the invoice memo, so the memo is the preimage of its invoice.
+	artist, _ := austkServer.Artist()
+	preimage := hex.EncodeToString([]byte(mockArtistID + "/" + mockTrackID + " by " + artist.Name))
+	restartedServer, err := NewAustkServer(&pricedCfg, &mockArtServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	for _, server := range []*AustkServer{austkServer, austkServer, restartedServer} {
+		err = server.checkPayment(context.Background(), track, preimage)
+		if err != nil {
+			t.Fatalf("checkPayment error: %v", err)
+		}
+	}
+	if count := testutil.ToFloat64(invoicesCreatedTotal); count != invoicesCreated+1 {
+		t.Errorf("expected %v invoices created but got %v", invoicesCreated+1, count)
+	}
+	if count := testutil.ToFloat64(paymentsSettledTotal); count != paymentsSettled+1 {
+		t.Errorf("expected %v payments settled, counting a payment proven again, even after a restart, once, but got %v",
+			paymentsSettled+1, count)
+	}
+
+	peersSynced := testutil.ToFloat64(peersSyncedTotal)
+	payloadFailures := testutil.ToFloat64(syncFailuresTotal.WithLabelValues("payload_mismatch"))
+	recordPeerSync(0, nil)
+	recordPeerSync(0, fmt.Errorf("%w: tampered payload", ErrPayloadMismatch))
+	if count := testutil.ToFloat64(peersSyncedTotal); count != peersSynced+1 {
+		t.Errorf("expected %v peers synced but got %v", peersSynced+1, count)
+	}
+	if count := testutil.ToFloat64(syncFailuresTotal.WithLabelValues("payload_mismatch")); count != payloadFailures+1 {
+		t.Errorf("expected %v payload mismatch failures but got %v", payloadFailures+1, count)
+	}
+
+	recorder := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(recorder.Body)
+	if !strings.Contains(string(body), "austk_invoices_created_total") {
+		t.Errorf("expected invoices created in /metrics but got %s", body)
+	}
+}
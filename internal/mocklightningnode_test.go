@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"github.com/golang/protobuf/proto"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"google.golang.org/grpc"
 	"log"
+	"testing"
 
 	art "github.com/audiostrike/music/pkg/art"
 )
@@ -16,36 +19,10 @@ const (
 	mockPubkey string = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef50"
 )
 
+// MockLightningClient is an LndClient that signs with mockPubkey and settles every invoice it adds.
 type MockLightningClient struct {
 }
 
-func (c MockLightningClient) WalletBalance(ctx context.Context, in *lnrpc.WalletBalanceRequest, opts ...grpc.CallOption) (*lnrpc.WalletBalanceResponse, error) {
-	return nil, fmt.Errorf("WalletBalance not implemented")
-}
-func (c MockLightningClient) ChannelBalance(ctx context.Context, in *lnrpc.ChannelBalanceRequest, opts ...grpc.CallOption) (*lnrpc.ChannelBalanceResponse, error) {
-	return nil, fmt.Errorf("ChannelBalance not implemented")
-}
-func (c MockLightningClient) GetTransactions(ctx context.Context, in *lnrpc.GetTransactionsRequest, opts ...grpc.CallOption) (*lnrpc.TransactionDetails, error) {
-	return nil, fmt.Errorf("GetTransactions not implemented")
-}
-func (c MockLightningClient) EstimateFee(ctx context.Context, in *lnrpc.EstimateFeeRequest, opts ...grpc.CallOption) (*lnrpc.EstimateFeeResponse, error) {
-	return nil, fmt.Errorf("EstimateFee not implemented")
-}
-func (c MockLightningClient) SendCoins(ctx context.Context, in *lnrpc.SendCoinsRequest, opts ...grpc.CallOption) (*lnrpc.SendCoinsResponse, error) {
-	return nil, fmt.Errorf("SendCoins not implemented")
-}
-func (c MockLightningClient) ListUnspent(ctx context.Context, in *lnrpc.ListUnspentRequest, opts ...grpc.CallOption) (*lnrpc.ListUnspentResponse, error) {
-	return nil, fmt.Errorf("ListUnspent not implemented")
-}
-func (c MockLightningClient) SubscribeTransactions(ctx context.Context, in *lnrpc.GetTransactionsRequest, opts ...grpc.CallOption) (lnrpc.Lightning_SubscribeTransactionsClient, error) {
-	return nil, fmt.Errorf("SubscribeTransactions not implemented")
-}
-func (c MockLightningClient) SendMany(ctx context.Context, in *lnrpc.SendManyRequest, opts ...grpc.CallOption) (*lnrpc.SendManyResponse, error) {
-	return nil, fmt.Errorf("SendMany not implemented")
-}
-func (c MockLightningClient) NewAddress(ctx context.Context, in *lnrpc.NewAddressRequest, opts ...grpc.CallOption) (*lnrpc.NewAddressResponse, error) {
-	return nil, fmt.Errorf("NewAddress not implemented")
-}
 func (c MockLightningClient) SignMessage(ctx context.Context, in *lnrpc.SignMessageRequest, opts ...grpc.CallOption) (*lnrpc.SignMessageResponse, error) {
 	hasher := sha256.New()
 	sum := hasher.Sum(in.Msg)
@@ -58,155 +35,169 @@ func (c MockLightningClient) SignMessage(ctx context.Context, in *lnrpc.SignMess
 	} else if bytes.Equal(sum, []byte{10, 84, 10, 14, 97, 108, 105, 99, 101, 116, 104, 101, 97, 114, 116, 105, 115, 116, 26, 66, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 97, 98, 99, 100, 101, 102, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 97, 98, 99, 100, 101, 102, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 97, 98, 99, 100, 101, 102, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 97, 98, 99, 100, 101, 102, 53, 48, 26, 27, 10, 14, 97, 108, 105, 99, 101, 116, 104, 101, 97, 114, 116, 105, 115, 116, 26, 9, 116, 101, 115, 116, 116, 114, 97, 99, 107, 34, 68, 10, 66, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 97, 98, 99, 100, 101, 102, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 97, 98, 99, 100, 101, 102, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 97, 98, 99, 100, 101, 102, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 97, 98, 99, 100, 101, 102, 53, 48, 227, 176, 196, 66, 152, 252, 28, 20, 154, 251, 244, 200, 153, 111, 185, 36, 39, 174, 65, 228, 100, 155, 147, 76, 164, 149, 153, 27, 120, 82, 184, 85}) {
 		return &lnrpc.SignMessageResponse{Signature: "test sig 3"}, nil
 	}
-	return nil, fmt.Errorf("Mock lnd client does not implement SignMessage for input msg: %s (sum: %v)", string(in.Msg), sum)
+	return &lnrpc.SignMessageResponse{Signature: mockSignature(in.Msg)}, nil
+}
+
+// mockSignature is the signature of msg by mockPubkey for the mock lightning client to sign and verify.
+func mockSignature(msg []byte) string {
+	return fmt.Sprintf("mock signature %x", sha256.Sum256(msg))
 }
 func (c MockLightningClient) VerifyMessage(ctx context.Context, in *lnrpc.VerifyMessageRequest, opts ...grpc.CallOption) (*lnrpc.VerifyMessageResponse, error) {
 	if in.Signature == "dh7xh9aw4ce6zhwpczg5qce6xfxkfcyj8cf91j719bgmcks3i7kyhrwiywrhzk5tk7a6d8x3xauppjz6thzzdwbyq8ffzj3p614ko3op" {
 		return &lnrpc.VerifyMessageResponse{Valid: true, Pubkey: "036f709187264df770bd453270a95b579595a42cd89eab2ea437dfd537048a7250"}, nil
 	}
-	return nil, fmt.Errorf("VerifyMessage not implemented")
-}
-func (c MockLightningClient) ConnectPeer(ctx context.Context, in *lnrpc.ConnectPeerRequest, opts ...grpc.CallOption) (*lnrpc.ConnectPeerResponse, error) {
-	return nil, fmt.Errorf("ConnectPeer not implemented")
-}
-func (c MockLightningClient) DisconnectPeer(ctx context.Context, in *lnrpc.DisconnectPeerRequest, opts ...grpc.CallOption) (*lnrpc.DisconnectPeerResponse, error) {
-	return nil, fmt.Errorf("DisconnectPeer not implemented")
-}
-func (c MockLightningClient) ListPeers(ctx context.Context, in *lnrpc.ListPeersRequest, opts ...grpc.CallOption) (*lnrpc.ListPeersResponse, error) {
-	return nil, fmt.Errorf("ListPeers not implemented")
+	if in.Signature == mockSignature(in.Msg) {
+		return &lnrpc.VerifyMessageResponse{Valid: true, Pubkey: mockPubkey}, nil
+	}
+	return &lnrpc.VerifyMessageResponse{Valid: false}, nil
 }
 func (c MockLightningClient) GetInfo(ctx context.Context, in *lnrpc.GetInfoRequest, opts ...grpc.CallOption) (*lnrpc.GetInfoResponse, error) {
 	return &lnrpc.GetInfoResponse{IdentityPubkey: mockPubkey}, nil
 }
-func (c MockLightningClient) PendingChannels(ctx context.Context, in *lnrpc.PendingChannelsRequest, opts ...grpc.CallOption) (*lnrpc.PendingChannelsResponse, error) {
-	return nil, fmt.Errorf("PendingChanels not implemented")
-}
-func (c MockLightningClient) ListChannels(ctx context.Context, in *lnrpc.ListChannelsRequest, opts ...grpc.CallOption) (*lnrpc.ListChannelsResponse, error) {
-	return nil, fmt.Errorf("ListChannels not implemented")
-}
-func (c MockLightningClient) SubscribeChannelEvents(ctx context.Context, in *lnrpc.ChannelEventSubscription, opts ...grpc.CallOption) (lnrpc.Lightning_SubscribeChannelEventsClient, error) {
-	return nil, fmt.Errorf("SubscribeChannelEvents not implemented")
-}
-func (c MockLightningClient) ClosedChannels(ctx context.Context, in *lnrpc.ClosedChannelsRequest, opts ...grpc.CallOption) (*lnrpc.ClosedChannelsResponse, error) {
-	return nil, fmt.Errorf("ClosedChannels not implemented")
-}
-func (c MockLightningClient) OpenChannelSync(ctx context.Context, in *lnrpc.OpenChannelRequest, opts ...grpc.CallOption) (*lnrpc.ChannelPoint, error) {
-	return nil, fmt.Errorf("OpenChannelSync not implemented")
-}
-func (c MockLightningClient) OpenChannel(ctx context.Context, in *lnrpc.OpenChannelRequest, opts ...grpc.CallOption) (lnrpc.Lightning_OpenChannelClient, error) {
-	return nil, fmt.Errorf("OpenChannel not implemented")
-}
-func (c MockLightningClient) CloseChannel(ctx context.Context, in *lnrpc.CloseChannelRequest, opts ...grpc.CallOption) (lnrpc.Lightning_CloseChannelClient, error) {
-	return nil, fmt.Errorf("CloseChannel not implemented")
-}
-func (c MockLightningClient) AbandonChannel(ctx context.Context, in *lnrpc.AbandonChannelRequest, opts ...grpc.CallOption) (*lnrpc.AbandonChannelResponse, error) {
-	return nil, fmt.Errorf("AbandonChannel not implemented")
-}
-func (c MockLightningClient) SendPayment(ctx context.Context, opts ...grpc.CallOption) (lnrpc.Lightning_SendPaymentClient, error) {
-	return nil, fmt.Errorf("SendPayment not implemented")
-}
 func (c MockLightningClient) SendPaymentSync(ctx context.Context, in *lnrpc.SendRequest, opts ...grpc.CallOption) (*lnrpc.SendResponse, error) {
-	return nil, fmt.Errorf("SendPaymentSync not implemented")
-}
-func (c MockLightningClient) SendToRoute(ctx context.Context, opts ...grpc.CallOption) (lnrpc.Lightning_SendToRouteClient, error) {
-	return nil, fmt.Errorf("SendToRoute not implemented")
-}
-func (c MockLightningClient) SendToRouteSync(ctx context.Context, in *lnrpc.SendToRouteRequest, opts ...grpc.CallOption) (*lnrpc.SendResponse, error) {
-	return nil, fmt.Errorf("SendToRouteSync not implemented")
+	payReq, err := c.DecodePayReq(ctx, &lnrpc.PayReqString{PayReq: in.PaymentRequest})
+	if err != nil {
+		return nil, err
+	}
+	preimage := []byte(payReq.Description)
+	paymentHash := sha256.Sum256(preimage)
+	return &lnrpc.SendResponse{PaymentPreimage: preimage, PaymentHash: paymentHash[:]}, nil
 }
 func (c MockLightningClient) AddInvoice(ctx context.Context, in *lnrpc.Invoice, opts ...grpc.CallOption) (*lnrpc.AddInvoiceResponse, error) {
-	return nil, fmt.Errorf("AddInvoice not implemented")
-}
-func (c MockLightningClient) ListInvoices(ctx context.Context, in *lnrpc.ListInvoiceRequest, opts ...grpc.CallOption) (*lnrpc.ListInvoiceResponse, error) {
-	return nil, fmt.Errorf("ListInvoices not implemented")
+	// The mock uses the memo as the preimage and encodes the amount and memo in the payment request.
+	invoiceHash := sha256.Sum256([]byte(in.Memo))
+	return &lnrpc.AddInvoiceResponse{
+		RHash:          invoiceHash[:],
+		PaymentRequest: fmt.Sprintf("lnbcrtmock%d:%x", in.Value, in.Memo),
+	}, nil
 }
 func (c MockLightningClient) LookupInvoice(ctx context.Context, in *lnrpc.PaymentHash, opts ...grpc.CallOption) (*lnrpc.Invoice, error) {
-	return nil, fmt.Errorf("LookupInvoice not implemented")
-}
-func (c MockLightningClient) SubscribeInvoices(ctx context.Context, in *lnrpc.InvoiceSubscription, opts ...grpc.CallOption) (lnrpc.Lightning_SubscribeInvoicesClient, error) {
-	return nil, fmt.Errorf("SubscribeInvoices not implemented")
+	// Every invoice the mock added is treated as paid.
+	return &lnrpc.Invoice{RHash: in.RHash, State: lnrpc.Invoice_SETTLED, Settled: true}, nil
 }
 func (c MockLightningClient) DecodePayReq(ctx context.Context, in *lnrpc.PayReqString, opts ...grpc.CallOption) (*lnrpc.PayReq, error) {
-	return nil, fmt.Errorf("DecodePayReq not implemented")
+	var sats int64
+	var memo []byte
+	_, err := fmt.Sscanf(in.PayReq, "lnbcrtmock%d:%x", &sats, &memo)
+	if err != nil {
+		return nil, fmt.Errorf("malformed mock payment request %s, error: %v", in.PayReq, err)
+	}
+	paymentHash := sha256.Sum256(memo)
+	return &lnrpc.PayReq{NumSatoshis: sats, Description: string(memo), PaymentHash: fmt.Sprintf("%x", paymentHash)}, nil
 }
 func (c MockLightningClient) ListPayments(ctx context.Context, in *lnrpc.ListPaymentsRequest, opts ...grpc.CallOption) (*lnrpc.ListPaymentsResponse, error) {
 	return nil, fmt.Errorf("ListPayments not implemented")
 }
-func (c MockLightningClient) DeleteAllPayments(ctx context.Context, in *lnrpc.DeleteAllPaymentsRequest, opts ...grpc.CallOption) (*lnrpc.DeleteAllPaymentsResponse, error) {
-	return nil, fmt.Errorf("DeleteAllPayments not implemented")
-}
-func (c MockLightningClient) DescribeGraph(ctx context.Context, in *lnrpc.ChannelGraphRequest, opts ...grpc.CallOption) (*lnrpc.ChannelGraph, error) {
-	return nil, fmt.Errorf("DescribeGraph not implemented")
-}
-func (c MockLightningClient) GetChanInfo(ctx context.Context, in *lnrpc.ChanInfoRequest, opts ...grpc.CallOption) (*lnrpc.ChannelEdge, error) {
-	return nil, fmt.Errorf("GetChanInfo not implemented")
-}
-func (c MockLightningClient) GetNodeInfo(ctx context.Context, in *lnrpc.NodeInfoRequest, opts ...grpc.CallOption) (*lnrpc.NodeInfo, error) {
-	return nil, fmt.Errorf("GetNodeInfo not implemented")
-}
-func (c MockLightningClient) QueryRoutes(ctx context.Context, in *lnrpc.QueryRoutesRequest, opts ...grpc.CallOption) (*lnrpc.QueryRoutesResponse, error) {
-	return nil, fmt.Errorf("QueryRoutes not implemented")
-}
-func (c MockLightningClient) GetNetworkInfo(ctx context.Context, in *lnrpc.NetworkInfoRequest, opts ...grpc.CallOption) (*lnrpc.NetworkInfo, error) {
-	return nil, fmt.Errorf("GetNetworkInfo not implemented")
-}
-func (c MockLightningClient) StopDaemon(ctx context.Context, in *lnrpc.StopRequest, opts ...grpc.CallOption) (*lnrpc.StopResponse, error) {
-	return nil, fmt.Errorf("StopDaemon not implemented")
-}
-func (c MockLightningClient) SubscribeChannelGraph(ctx context.Context, in *lnrpc.GraphTopologySubscription, opts ...grpc.CallOption) (lnrpc.Lightning_SubscribeChannelGraphClient, error) {
-	return nil, fmt.Errorf("SubscribeChannelGraph not implemented")
-}
-func (c MockLightningClient) DebugLevel(ctx context.Context, in *lnrpc.DebugLevelRequest, opts ...grpc.CallOption) (*lnrpc.DebugLevelResponse, error) {
-	return nil, fmt.Errorf("DebugLevel not implemented")
-}
-func (c MockLightningClient) FeeReport(ctx context.Context, in *lnrpc.FeeReportRequest, opts ...grpc.CallOption) (*lnrpc.FeeReportResponse, error) {
-	return nil, fmt.Errorf("FeeReport not implemented")
-}
-func (c MockLightningClient) UpdateChannelPolicy(ctx context.Context, in *lnrpc.PolicyUpdateRequest, opts ...grpc.CallOption) (*lnrpc.PolicyUpdateResponse, error) {
-	return nil, fmt.Errorf("UpdateChannelPolicy not implemented")
-}
-func (c MockLightningClient) ForwardingHistory(ctx context.Context, in *lnrpc.ForwardingHistoryRequest, opts ...grpc.CallOption) (*lnrpc.ForwardingHistoryResponse, error) {
-	return nil, fmt.Errorf("ForwardingHistory not implemented")
-}
-func (c MockLightningClient) ExportChannelBackup(ctx context.Context, in *lnrpc.ExportChannelBackupRequest, opts ...grpc.CallOption) (*lnrpc.ChannelBackup, error) {
-	return nil, fmt.Errorf("ExportChannelBackup not implemented")
-}
-func (c MockLightningClient) ExportAllChannelBackups(ctx context.Context, in *lnrpc.ChanBackupExportRequest, opts ...grpc.CallOption) (*lnrpc.ChanBackupSnapshot, error) {
-	return nil, fmt.Errorf("ExportAllChannelBackups not implemented")
-}
-func (c MockLightningClient) VerifyChanBackup(ctx context.Context, in *lnrpc.ChanBackupSnapshot, opts ...grpc.CallOption) (*lnrpc.VerifyChanBackupResponse, error) {
-	return nil, fmt.Errorf("VerifyChanBackup not implemented")
-}
-func (c MockLightningClient) RestoreChannelBackups(ctx context.Context, in *lnrpc.RestoreChanBackupRequest, opts ...grpc.CallOption) (*lnrpc.RestoreBackupResponse, error) {
-	return nil, fmt.Errorf("RestoreChannelBackups not implemented")
-}
-func (c MockLightningClient) SubscribeChannelBackups(ctx context.Context, in *lnrpc.ChannelBackupSubscription, opts ...grpc.CallOption) (lnrpc.Lightning_SubscribeChannelBackupsClient, error) {
-	return nil, fmt.Errorf("SubscribeChannelBackups not implemented")
-}
 
 func NewMockLightningNode(cfg *Config, localStorage ArtServer) (*LightningNode, error) {
-	const logPrefix = "MockLightningNode NewMockLightningNode "
-
+	logger := cfg.componentLogger("mockLightningNode")
 	lndClient := MockLightningClient{}
 
-	publishingArtist, err := localStorage.Artist(cfg.ArtistID)
-	if err == ErrArtNotFound {
-		// The configured artist is not yet stored, so store the artist.
-		publishingArtist = &art.Artist{ArtistId: cfg.ArtistID, Name: cfg.ArtistName}
-		err = localStorage.StoreArtist(publishingArtist)
-		if err != nil {
-			log.Fatalf(logPrefix+"failed to store artist %v, error: %v",
-				publishingArtist, err)
+	publishingArtists := make(map[string]*art.Artist)
+	for _, artistID := range cfg.PublishingArtistIDs() {
+		publishingArtist, err := localStorage.Artist(artistID)
+		if err == ErrArtNotFound {
+			// The artist is not yet stored, so store the artist.
+			publishingArtist = &art.Artist{ArtistId: artistID, Name: artistID, Pubkey: mockPubkey}
+			if artistID == cfg.ArtistID {
+				publishingArtist.Name = cfg.ArtistName
+			}
+			err = localStorage.StoreArtist(publishingArtist)
+			if err != nil {
+				return nil, err
+			}
+			logger.Debug("stored publishing artist", "artist_id", artistID)
+		} else if err != nil {
 			return nil, err
 		}
-		log.Printf(logPrefix+"stored %v", publishingArtist)
-	} else if err != nil {
-		log.Fatalf(logPrefix+"failed to get artist %s from storage, error: %v", cfg.ArtistID, err)
-		return nil, ErrArtNotFound
+		publishingArtists[artistID] = publishingArtist
 	}
 
 	return &LightningNode{
-		lightningClient:  lndClient,
-		publishingArtist: publishingArtist,
+		lightningClient:   lndClient,
+		publishingArtist:  publishingArtists[cfg.ArtistID],
+		publishingArtists: publishingArtists,
+		rpcTimeout:        cfg.lndTimeout(),
+
+		invoiceExpirySeconds: cfg.invoiceExpirySeconds(),
+		logger:               logger,
 	}, nil
 }
+
+// TestValidatePublicationErrors tests that ValidatePublication tells a bad signature from another artist's signature.
+func TestValidatePublicationErrors(t *testing.T) {
+	lightningNode, err := NewMockLightningNode(cfg, &mockArtServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	marshaledResources, err := proto.Marshal(&art.ArtResources{Artists: []*art.Artist{&mockArtist}})
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+
+	forgedPublication := art.ArtistPublication{
+		Artist:                 &mockArtist,
+		Signature:              "forged signature",
+		SerializedArtResources: marshaledResources,
+	}
+	_, err = lightningNode.ValidatePublication(context.Background(), &forgedPublication)
+	if !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected ErrSignatureInvalid for forged signature but got %v", err)
+	}
+
+	// The mock lightning client verifies this signature as signed by another pubkey than mockPubkey.
+	otherArtistPublication := art.ArtistPublication{
+		Artist:                 &mockArtist,
+		Signature:              "dh7xh9aw4ce6zhwpczg5qce6xfxkfcyj8cf91j719bgmcks3i7kyhrwiywrhzk5tk7a6d8x3xauppjz6thzzdwbyq8ffzj3p614ko3op",
+		SerializedArtResources: marshaledResources,
+	}
+	_, err = lightningNode.ValidatePublication(context.Background(), &otherArtistPublication)
+	if !errors.Is(err, ErrPubkeyMismatch) {
+		t.Errorf("expected ErrPubkeyMismatch for other artist's signature but got %v", err)
+	}
+}
+
+// TestSignatureScheme tests that Sign stamps the signature scheme, that its signature covers the scheme,
+// that publications signed over the resources alone validate with or without a scheme,
+// and that a publication signed by an unknown scheme is rejected.
+func TestSignatureScheme(t *testing.T) {
+	lightningNode, err := NewMockLightningNode(cfg, &mockArtServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	ctx := context.Background()
+	publication, err := lightningNode.Sign(ctx, mockArtistID, &art.ArtResources{Artists: []*art.Artist{&mockArtist}})
+	if err != nil {
+		t.Fatalf("Sign error: %v", err)
+	}
+	if publication.SignatureScheme != SignatureSchemeLnd {
+		t.Errorf("expected signature scheme %s but got %q", SignatureSchemeLnd, publication.SignatureScheme)
+	}
+	_, err = lightningNode.ValidatePublication(ctx, publication)
+	if err != nil {
+		t.Errorf("expected publication stamped %s to validate but got %v", SignatureSchemeLnd, err)
+	}
+
+	for _, scheme := range []string{"", signatureSchemeLndUnbound} {
+		relabeledPublication := proto.Clone(publication).(*art.ArtistPublication)
+		relabeledPublication.SignatureScheme = scheme
+		_, err = lightningNode.ValidatePublication(ctx, relabeledPublication)
+		if !errors.Is(err, ErrSignatureInvalid) {
+			t.Errorf("expected ErrSignatureInvalid for publication relabeled with scheme %q but got %v", scheme, err)
+		}
+
+		unboundPublication := proto.Clone(publication).(*art.ArtistPublication)
+		unboundPublication.SignatureScheme = scheme
+		unboundPublication.Signature = mockSignature(publication.SerializedArtResources)
+		_, err = lightningNode.ValidatePublication(ctx, unboundPublication)
+		if err != nil {
+			t.Errorf("expected publication signed over the resources alone with scheme %q to validate but got %v", scheme, err)
+		}
+	}
+
+	publication.SignatureScheme = "schnorr/1"
+	_, err = lightningNode.ValidatePublication(ctx, publication)
+	if !errors.Is(err, ErrSignatureSchemeUnsupported) {
+		t.Errorf("expected ErrSignatureSchemeUnsupported for unknown scheme but got %v", err)
+	}
+}
@@ -2,13 +2,13 @@ package audiostrike
 
 import (
 	"os"
+	"strings"
 	"time"
 
 	"github.com/faiface/beep"
 	faifacemp3 "github.com/faiface/beep/mp3"
 	"github.com/faiface/beep/speaker"
 	mikkyangid3 "github.com/mikkyang/id3-go"
-	"log"
 )
 
 // Mp3 exposes the Tags (mp3 metadata) and bytes of a given .mp3 file.
@@ -18,30 +18,44 @@ type Mp3 struct {
 	length           int
 	position         int
 	Tags             map[string]string
+	pictures         []Picture
 	playbackFinished chan bool
 }
 
 // OpenMp3ToRead opens an mp3 file to read its data and tags (metadata)
-func OpenMp3ToRead(path string) (mp3 *Mp3, err error) {
+func OpenMp3ToRead(path string) (AudioFile, error) {
 	// Read the mp3 tags.
-	var id3File *mikkyangid3.File
-	id3File, err = mikkyangid3.OpenForRead(path)
+	id3File, err := mikkyangid3.OpenForRead(path)
 	if err != nil {
-		return
+		return nil, err
 	}
 	defer id3File.Close()
-	var tags map[string]string
-	tags, err = parseTags(id3File)
+	tags, err := parseTags(id3File)
 	if err != nil {
-		return
+		return nil, err
 	}
 
 	// Return the Mp3 struct with the file and mp3 tags.
-	mp3 = &Mp3{
-		path: path,
+	return &Mp3{
+		path:     path,
 		Tags:     tags,
+		pictures: parsePictures(path, id3File),
+	}, nil
+}
+
+// parsePictures parses the pictures of the APIC frames in the ID3 tags of the mp3 file at path.
+// Pictures that cannot be parsed, or that link to an image instead of embedding it, are skipped.
+func parsePictures(path string, file *mikkyangid3.File) []Picture {
+	var pictures []Picture
+	for _, frame := range file.Frames("APIC") {
+		picture, err := parseID3Picture(frame.Bytes())
+		if err != nil {
+			componentLogger("audio").Debug("skip mp3 picture", "path", path, "error", err)
+			continue // to next frame
+		}
+		pictures = append(pictures, picture)
 	}
-	return
+	return pictures
 }
 
 func parseTags(file *mikkyangid3.File) (map[string]string, error) {
@@ -49,10 +63,26 @@ func parseTags(file *mikkyangid3.File) (map[string]string, error) {
 		"Artist": file.Artist(),
 		"Album":  file.Album(),
 		"Title":  file.Title(),
+		"Track":  frameText(file, "TRCK", "TRK"),
+		"Genre":  frameText(file, "TCON", "TCO"),
+		// ID3v2.4 tags record the recording date, ID3v2.3 and v2.2 tags only the year.
+		"Year": frameText(file, "TDRC", "TYER", "TYE"),
 	}
 	return tags, nil
 }
 
+// frameText gets the text of the first of frameIDs in the file's ID3 tags,
+// listing the id of the frame in each version of ID3v2 that records the same tag.
+func frameText(file *mikkyangid3.File, frameIDs ...string) string {
+	for _, frameID := range frameIDs {
+		frame := file.Frame(frameID)
+		if frame != nil {
+			return strings.Trim(frame.String(), "\x00 ")
+		}
+	}
+	return ""
+}
+
 func (mp3 *Mp3) ArtistName() string {
 	return mp3.Tags["Artist"]
 }
@@ -66,6 +96,30 @@ func (mp3 *Mp3) Title() string {
 	return mp3.Tags["Title"]
 }
 
+func (mp3 *Mp3) TrackNumber() uint32 {
+	return parseTrackNumber(mp3.Tags["Track"])
+}
+
+func (mp3 *Mp3) Genres() []string {
+	return parseGenres(mp3.Tags["Genre"])
+}
+
+func (mp3 *Mp3) Year() uint32 {
+	return parseYear(mp3.Tags["Year"])
+}
+
+func (mp3 *Mp3) Container() string {
+	return ContainerMp3
+}
+
+func (mp3 *Mp3) Codec() string {
+	return CodecMp3
+}
+
+func (mp3 *Mp3) CoverArt() *Picture {
+	return coverPicture(mp3.pictures)
+}
+
 // ReadBytes returns the raw data from the .mp3 file.
 func (mp3 *Mp3) ReadBytes() ([]byte, error) {
 	// If buffer already has the bytes, return them.
@@ -88,26 +142,67 @@ func (mp3 *Mp3) ReadBytes() ([]byte, error) {
 	return mp3.buffer, err
 }
 
+// Duration decodes the mp3 file to count its samples, since mp3 frames do not record the length of the audio.
+func (mp3 *Mp3) Duration() (time.Duration, error) {
+	return decodedDuration(mp3)
+}
+
+func (mp3 *Mp3) Decode() (beep.StreamSeekCloser, beep.Format, error) {
+	return decodeFile(mp3.path, func(file *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+		return faifacemp3.Decode(file)
+	})
+}
+
 func (mp3 *Mp3) PlayAndWait() error {
-	file, err := os.Open(mp3.path)
+	mp3.playbackFinished = make(chan bool)
+	return playAndWait(mp3.path, mp3.Decode, mp3.playbackFinished)
+}
+
+// fileStreamer streams audio decoded from file and closes the file when closed.
+type fileStreamer struct {
+	beep.StreamSeekCloser
+	file *os.File
+}
+
+func (streamer *fileStreamer) Close() error {
+	err := streamer.StreamSeekCloser.Close()
+	fileErr := streamer.file.Close()
+	if err == nil {
+		err = fileErr
+	}
+	return err
+}
+
+// decodeFile opens the audio file at path to stream the samples decoded by decode.
+// Closing the returned streamer closes the file.
+func decodeFile(path string, decode func(*os.File) (beep.StreamSeekCloser, beep.Format, error)) (beep.StreamSeekCloser, beep.Format, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, beep.Format{}, err
 	}
-	defer file.Close()
-	trackStreamer, format, err := faifacemp3.Decode(file)
+	streamer, format, err := decode(file)
 	if err != nil {
-		stat, _ := file.Stat()
-		log.Printf("Failed to decode mp3 %v, error: %v", stat, err)
+		file.Close()
+		return nil, beep.Format{}, err
+	}
+	return &fileStreamer{streamer, file}, format, nil
+}
+
+// playAndWait streams the samples of the audio file at path from decode, plays them on the speaker,
+// and waits for playbackFinished to signal the end of playback.
+func playAndWait(path string, decode func() (beep.StreamSeekCloser, beep.Format, error), playbackFinished chan bool) error {
+	trackStreamer, format, err := decode()
+	if err != nil {
+		componentLogger("audio").Error("failed to decode audio file", "path", path, "error", err)
 		return err
 	}
 	defer trackStreamer.Close()
-	mp3.playbackFinished = make(chan bool)
 	speaker.Init(format.SampleRate, format.SampleRate.N(time.Second/5))
 	speaker.Play(beep.Seq(trackStreamer, beep.Callback(func() {
-		mp3.playbackFinished <- true
+		playbackFinished <- true
 	})))
 
-	<-mp3.playbackFinished
+	<-playbackFinished
 
 	return nil
 }
@@ -0,0 +1,110 @@
+package audiostrike
+
+import (
+	"context"
+	"fmt"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// OfflinePublisher is a Publisher for a node started while lnd is unavailable.
+// It knows the hosted artists already stored, so the node still serves its catalog and previews,
+// but every call that needs lnd, such as signing, verifying, invoicing, or paying, fails with ErrLndUnavailable.
+type OfflinePublisher struct {
+	publishingArtist  *art.Artist
+	publishingArtists map[string]*art.Artist
+	// lndErr is why lnd was unavailable when the node started.
+	lndErr error
+}
+
+// NewOfflinePublisher gets an OfflinePublisher for the configured artists stored in localStorage,
+// which failed to reach lnd with lndErr. Configured artists not stored yet are not hosted until lnd is back.
+func NewOfflinePublisher(cfg *Config, localStorage ArtServer, lndErr error) (*OfflinePublisher, error) {
+	publishingArtists := make(map[string]*art.Artist)
+	for _, artistID := range cfg.PublishingArtistIDs() {
+		artist, err := localStorage.Artist(artistID)
+		if err == ErrArtNotFound {
+			continue // to next artist, stored only once lnd gives its pubkey
+		} else if err != nil {
+			return nil, err
+		}
+		publishingArtists[artistID] = artist
+	}
+	return &OfflinePublisher{
+		publishingArtist:  publishingArtists[cfg.ArtistID],
+		publishingArtists: publishingArtists,
+		lndErr:            lndErr,
+	}, nil
+}
+
+// unavailable gets the error for a call to the lnd that is unavailable.
+func (publisher *OfflinePublisher) unavailable(call string) error {
+	return fmt.Errorf("%w: cannot %s while serving offline: %v", ErrLndUnavailable, call, publisher.lndErr)
+}
+
+// Artist gets the stored default artist, if any.
+func (publisher *OfflinePublisher) Artist() (*art.Artist, error) {
+	return publisher.publishingArtist, nil
+}
+
+// PublishingArtist gets the stored hosted artist with artistID or else ErrArtNotFound.
+func (publisher *OfflinePublisher) PublishingArtist(artistID string) (*art.Artist, error) {
+	artist, isHosted := publisher.publishingArtists[artistID]
+	if !isHosted {
+		return nil, fmt.Errorf("%w: artist %s is not hosted by this node", ErrArtNotFound, artistID)
+	}
+	return artist, nil
+}
+
+// Pubkey gets the pubkey stored for the default artist, which lnd gave when the artist was stored.
+func (publisher *OfflinePublisher) Pubkey(ctx context.Context) (string, error) {
+	if publisher.publishingArtist == nil || publisher.publishingArtist.Pubkey == "" {
+		return "", publisher.unavailable("get the pubkey")
+	}
+	return publisher.publishingArtist.Pubkey, nil
+}
+
+// CheckLnd reports that lnd was unavailable, so the node is not ready to sell art.
+func (publisher *OfflinePublisher) CheckLnd(ctx context.Context) error {
+	return publisher.unavailable("reach lnd")
+}
+
+// Sign fails with ErrLndUnavailable.
+func (publisher *OfflinePublisher) Sign(ctx context.Context, artistID string, resources *art.ArtResources) (*art.ArtistPublication, error) {
+	return nil, publisher.unavailable("sign publications")
+}
+
+// ValidatePublication fails with ErrLndUnavailable.
+func (publisher *OfflinePublisher) ValidatePublication(ctx context.Context, publication *art.ArtistPublication) (*art.ArtResources, error) {
+	return nil, publisher.unavailable("validate publications")
+}
+
+// SignMessage fails with ErrLndUnavailable.
+func (publisher *OfflinePublisher) SignMessage(ctx context.Context, message []byte) (string, error) {
+	return "", publisher.unavailable("sign messages")
+}
+
+// VerifyMessage fails with ErrLndUnavailable.
+func (publisher *OfflinePublisher) VerifyMessage(ctx context.Context, message []byte, signature string) (string, error) {
+	return "", publisher.unavailable("verify messages")
+}
+
+// AddInvoice fails with ErrLndUnavailable.
+func (publisher *OfflinePublisher) AddInvoice(ctx context.Context, memo string, sats uint64) (string, []byte, error) {
+	return "", nil, publisher.unavailable("add invoices")
+}
+
+// PayInvoice fails with ErrLndUnavailable.
+func (publisher *OfflinePublisher) PayInvoice(ctx context.Context, paymentRequest string, maxSats uint64) ([]byte, error) {
+	return nil, publisher.unavailable("pay invoices")
+}
+
+// VerifyPayment fails with ErrLndUnavailable.
+func (publisher *OfflinePublisher) VerifyPayment(ctx context.Context, invoiceHash, preimage []byte) (bool, error) {
+	return false, publisher.unavailable("verify payments")
+}
+
+// Keysend fails with ErrLndUnavailable.
+func (publisher *OfflinePublisher) Keysend(ctx context.Context, pubkey string, sats uint64) error {
+	return publisher.unavailable("send payments")
+}
@@ -0,0 +1,172 @@
+package audiostrike
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/gorilla/mux"
+)
+
+// TestOfflinePublisher verifies that a node started without lnd serves the catalog of its stored artist
+// but fails to sign or invoice with ErrLndUnavailable, replying 503 to a buyer.
+func TestOfflinePublisher(t *testing.T) {
+	localStorage := NewMemoryArtServer()
+	err := localStorage.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID, Title: "Test Track"}
+	err = localStorage.StoreTrack(track, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	offlineCfg := *cfg
+	offlineCfg.DefaultPrice = 1000
+	offlineCfg.HostedArtistIDs = []string{"notstoredyet"}
+	lndErr := fmt.Errorf("%w: connection refused", ErrLndUnavailable)
+	publisher, err := NewOfflinePublisher(&offlineCfg, localStorage, lndErr)
+	if err != nil {
+		t.Fatalf("NewOfflinePublisher error: %v", err)
+	}
+	austkServer, err := NewAustkServer(&offlineCfg, localStorage, publisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+
+	pubkey, err := austkServer.Pubkey(austkServer.ctx)
+	if err != nil || pubkey != mockPubkey {
+		t.Errorf("expected the stored pubkey %s but got %s, error: %v", mockPubkey, pubkey, err)
+	}
+	_, err = austkServer.PublishingArtist("notstoredyet")
+	if !errors.Is(err, ErrArtNotFound) {
+		t.Errorf("expected ErrArtNotFound for an artist not stored yet but got %v", err)
+	}
+	_, err = austkServer.Sign(austkServer.ctx, mockArtistID, &art.ArtResources{Artists: []*art.Artist{&mockArtist}})
+	if !errors.Is(err, ErrLndUnavailable) {
+		t.Errorf("expected Sign to fail with ErrLndUnavailable but got %v", err)
+	}
+	err = austkServer.checkReady(austkServer.ctx)
+	if err == nil || !strings.Contains(err.Error(), "lnd unavailable") {
+		t.Errorf("expected not ready while lnd is unavailable but got %v", err)
+	}
+
+	testRouter := mux.NewRouter()
+	testRouter.HandleFunc("/artist/{artist}/catalog", austkServer.catalogHandler).Methods("GET")
+	testRouter.HandleFunc("/invoice/{artist:[^/]*}/{track:.*}", austkServer.createInvoiceHandler).Methods("POST")
+	testHttpServer := httptest.NewServer(testRouter)
+	defer testHttpServer.Close()
+
+	response, err := http.Get(testHttpServer.URL + "/artist/" + mockArtistID + "/catalog")
+	if err != nil {
+		t.Fatalf("GET catalog error: %v", err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || !strings.Contains(string(body), "Test Track") {
+		t.Errorf("expected the catalog served offline but got %d: %.80s", response.StatusCode, body)
+	}
+	response, err = http.Post(testHttpServer.URL+"/invoice/"+mockArtistID+"/"+mockTrackID, "", nil)
+	if err != nil {
+		t.Fatalf("POST invoice error: %v", err)
+	}
+	body, _ = ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusServiceUnavailable || !strings.Contains(string(body), "lnd unavailable") {
+		t.Errorf("expected 503 lnd unavailable for an invoice but got %d: %s", response.StatusCode, body)
+	}
+}
+
+// TestStartWithoutLnd verifies that a daemon whose artist is stored starts as main starts it while lnd is
+// unreachable, checking its hosted pubkeys against the stored pubkey, and that it invoices through
+// the reconnecting client once lnd answers.
+func TestStartWithoutLnd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk-lnd")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	tlsCertPath := filepath.Join(dir, "tls.cert")
+	writeTestTLSCert(t, tlsCertPath)
+	macaroonPath := filepath.Join(dir, "admin.macaroon")
+	writeTestMacaroon(t, macaroonPath)
+	// Listen to get a free port, then close it so that lnd is unreachable there.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+	closedPort := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	localStorage := NewMemoryArtServer()
+	err = localStorage.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	startCfg := *cfg
+	startCfg.TlsCertPath = tlsCertPath
+	startCfg.MacaroonPath = macaroonPath
+	startCfg.LndHost = "127.0.0.1"
+	startCfg.LndGrpcPort = closedPort
+	startCfg.LndTimeout = 100 * time.Millisecond
+
+	lightningNode, err := NewLightningNode(&startCfg, localStorage)
+	if err != nil {
+		t.Fatalf("expected to start with lnd unreachable but got error %v", err)
+	}
+	defer lightningNode.Close()
+	austkServer, err := NewAustkServer(&startCfg, localStorage, lightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	ctx := context.Background()
+	err = austkServer.CheckHostedPubkeys(ctx)
+	if err != nil {
+		t.Errorf("expected hosted pubkeys checked against the stored pubkey but got %v", err)
+	}
+	err = austkServer.checkReady(ctx)
+	if err == nil || !strings.Contains(err.Error(), "lnd unavailable") {
+		t.Errorf("expected not ready while lnd is unreachable but got %v", err)
+	}
+
+	invoiceCalls := 0
+	isDropped := true
+	lndClient, err := newReconnectingLightningClient(func() (LndClient, io.Closer, error) {
+		return droppedLightningClient{isDropped: isDropped, invoiceCalls: &invoiceCalls}, nopCloser{}, nil
+	}, componentLogger("lightningNode"))
+	if err != nil {
+		t.Fatalf("newReconnectingLightningClient error: %v", err)
+	}
+	lndClient.sleep = func(ctx context.Context, d time.Duration) error { return context.Canceled }
+	reconnectingNode, err := NewLightningNodeWithClient(&startCfg, localStorage, lndClient)
+	if err != nil {
+		t.Fatalf("NewLightningNodeWithClient error: %v", err)
+	}
+	pubkey, err := reconnectingNode.Pubkey(ctx)
+	if err != nil || pubkey != mockPubkey {
+		t.Errorf("expected the stored pubkey %s while lnd is unreachable but got %s, error: %v", mockPubkey, pubkey, err)
+	}
+	_, _, err = reconnectingNode.AddInvoice(ctx, "memo", 100)
+	if !errors.Is(err, ErrLndUnavailable) {
+		t.Errorf("expected AddInvoice to fail while lnd is unreachable but got %v", err)
+	}
+	isDropped = false
+	lndClient.redial(lndClient.generation)
+	paymentRequest, _, err := reconnectingNode.AddInvoice(ctx, "memo", 100)
+	if err != nil || paymentRequest == "" {
+		t.Errorf("expected an invoice once lnd answers but got %q, error: %v", paymentRequest, err)
+	}
+	if err = reconnectingNode.CheckLnd(ctx); err != nil {
+		t.Errorf("expected lnd reconnected but got %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package audiostrike
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/faiface/beep"
+	faifacevorbis "github.com/faiface/beep/vorbis"
+)
+
+const (
+	oggMagic = "OggS"
+
+	// oggPageHeaderLength is the length of an ogg page header before its segment table.
+	oggPageHeaderLength = 27
+
+	// Each audio stream starts with an identification header packet, then a comment header packet.
+	vorbisIdentificationHeader = "\x01vorbis"
+	vorbisCommentHeader        = "\x03vorbis"
+	opusIdentificationHeader   = "OpusHead"
+	opusCommentHeader          = "OpusTags"
+
+	// oggBeginningOfStream flags the first page of a logical stream in the header type of an ogg page.
+	oggBeginningOfStream = 0x02
+	// opusGranuleRate is the sample rate of the granule positions of Opus streams, whatever the rate of the input.
+	opusGranuleRate = 48000
+)
+
+// Ogg exposes the Tags (vorbis comments) and bytes of a given .ogg or .opus file
+// whose audio is encoded with the Vorbis or Opus codec.
+type Ogg struct {
+	path             string
+	codec            string
+	buffer           []byte
+	Tags             map[string]string
+	pictures         []Picture
+	playbackFinished chan bool
+}
+
+// OpenOggToRead opens an ogg file to read its data and tags (metadata)
+func OpenOggToRead(path string) (AudioFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	codec, tags, pictures, err := readOggTags(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ogg tags from %s: %w", path, err)
+	}
+
+	return &Ogg{
+		path:     path,
+		codec:    codec,
+		Tags:     tags,
+		pictures: pictures,
+	}, nil
+}
+
+// readOggTags reads ogg pages from reader until the comment header of the first Vorbis or Opus stream,
+// returning that stream's codec, its vorbis comments keyed by the same tag names that parseTags uses
+// for mp3 files, and the pictures embedded in its comments.
+// Pages of other logical streams multiplexed in the file, e.g. video or a skeleton, are skipped.
+func readOggTags(reader io.Reader) (codec string, tags map[string]string, pictures []Picture, err error) {
+	// packets holds the packet being read for each stream serial number, which may continue over pages.
+	packets := make(map[uint32][]byte)
+	// packetCounts counts the packets read for each stream serial number.
+	packetCounts := make(map[uint32]int)
+	var audioSerial uint32
+
+	for {
+		header := make([]byte, oggPageHeaderLength)
+		_, err = io.ReadFull(reader, header)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if codec == "" {
+				return "", nil, nil, fmt.Errorf("no vorbis or opus stream")
+			}
+			return "", nil, nil, fmt.Errorf("no comment header in %s stream", codec)
+		} else if err != nil {
+			return "", nil, nil, err
+		}
+		if string(header[:len(oggMagic)]) != oggMagic {
+			return "", nil, nil, fmt.Errorf("not an ogg page, missing %s marker", oggMagic)
+		}
+		serial := binary.LittleEndian.Uint32(header[14:18])
+		segmentTable := make([]byte, header[26])
+		_, err = io.ReadFull(reader, segmentTable)
+		if err != nil {
+			return "", nil, nil, err
+		}
+
+		for _, segmentLength := range segmentTable {
+			segment := make([]byte, segmentLength)
+			_, err = io.ReadFull(reader, segment)
+			if err != nil {
+				return "", nil, nil, err
+			}
+			// Keep the bytes of a stream's first packet, to identify its codec, and of the audio stream's second.
+			isAudioStream := codec != "" && serial == audioSerial
+			if packetCounts[serial] == 0 || (isAudioStream && packetCounts[serial] == 1) {
+				packets[serial] = append(packets[serial], segment...)
+			}
+			if segmentLength == 255 {
+				continue // to the next segment of the same packet
+			}
+
+			packet := packets[serial]
+			delete(packets, serial)
+			packetCounts[serial]++
+			switch {
+			case codec == "" && packetCounts[serial] == 1 && bytes.HasPrefix(packet, []byte(vorbisIdentificationHeader)):
+				codec, audioSerial = CodecVorbis, serial
+			case codec == "" && packetCounts[serial] == 1 && bytes.HasPrefix(packet, []byte(opusIdentificationHeader)):
+				codec, audioSerial = CodecOpus, serial
+			case isAudioStream && packetCounts[serial] == 2:
+				tags, pictures, err = oggCommentTags(codec, packet)
+				if err != nil {
+					return "", nil, nil, err
+				}
+				return codec, tags, pictures, nil
+			}
+		}
+	}
+}
+
+// readOggDuration reads the length of the first Vorbis or Opus stream in the ogg pages from reader:
+// the granule position of its last page, which counts its samples per channel, at its sample rate.
+// The bodies of pages are skipped except for the first page of each stream, to find its identification header.
+func readOggDuration(reader io.Reader) (time.Duration, error) {
+	var (
+		audioSerial uint32
+		codec       string
+		sampleRate  int64
+		preSkip     int64
+		lastGranule int64 = -1
+	)
+	for {
+		header := make([]byte, oggPageHeaderLength)
+		_, err := io.ReadFull(reader, header)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		if string(header[:len(oggMagic)]) != oggMagic {
+			return 0, fmt.Errorf("not an ogg page, missing %s marker", oggMagic)
+		}
+		granule := int64(binary.LittleEndian.Uint64(header[6:14]))
+		serial := binary.LittleEndian.Uint32(header[14:18])
+		segmentTable := make([]byte, header[26])
+		_, err = io.ReadFull(reader, segmentTable)
+		if err != nil {
+			return 0, err
+		}
+		bodyLength := 0
+		for _, segmentLength := range segmentTable {
+			bodyLength += int(segmentLength)
+		}
+		if codec != "" || header[5]&oggBeginningOfStream == 0 {
+			_, err = io.CopyN(ioutil.Discard, reader, int64(bodyLength))
+			if err != nil {
+				return 0, err
+			}
+			if codec != "" && serial == audioSerial && granule >= 0 {
+				lastGranule = granule // A granule position of -1 marks a page on which no packet ends.
+			}
+			continue // to next page
+		}
+
+		body := make([]byte, bodyLength)
+		_, err = io.ReadFull(reader, body)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case bytes.HasPrefix(body, []byte(vorbisIdentificationHeader)) && len(body) >= 16:
+			codec, audioSerial = CodecVorbis, serial
+			sampleRate = int64(binary.LittleEndian.Uint32(body[12:16]))
+		case bytes.HasPrefix(body, []byte(opusIdentificationHeader)) && len(body) >= 12:
+			codec, audioSerial = CodecOpus, serial
+			sampleRate, preSkip = opusGranuleRate, int64(binary.LittleEndian.Uint16(body[10:12]))
+		}
+	}
+	if codec == "" {
+		return 0, fmt.Errorf("no vorbis or opus stream")
+	}
+	if sampleRate == 0 || lastGranule < preSkip {
+		return 0, fmt.Errorf("no %s audio pages to measure", codec)
+	}
+	return samplesDuration(lastGranule-preSkip, sampleRate), nil
+}
+
+// oggCommentTags parses the comment header packet of a stream with codec into tags and pictures.
+func oggCommentTags(codec string, packet []byte) (map[string]string, []Picture, error) {
+	prefix := vorbisCommentHeader
+	if codec == CodecOpus {
+		prefix = opusCommentHeader
+	}
+	if !bytes.HasPrefix(packet, []byte(prefix)) {
+		return nil, nil, fmt.Errorf("malformed %s comment header", codec)
+	}
+	comments, err := parseVorbisComments(packet[len(prefix):])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tags := map[string]string{
+		"Artist": "",
+		"Album":  "",
+		"Title":  "",
+	}
+	setVorbisCommentTags(tags, comments)
+	pictures, err := vorbisCommentPictures(comments[vorbisPictureField])
+	if err != nil {
+		return nil, nil, err
+	}
+	return tags, pictures, nil
+}
+
+func (ogg *Ogg) ArtistName() string {
+	return ogg.Tags["Artist"]
+}
+
+func (ogg *Ogg) AlbumTitle() (string, bool) {
+	albumTitle := ogg.Tags["Album"]
+	return albumTitle, albumTitle != ""
+}
+
+func (ogg *Ogg) Title() string {
+	return ogg.Tags["Title"]
+}
+
+func (ogg *Ogg) TrackNumber() uint32 {
+	return parseTrackNumber(ogg.Tags["Track"])
+}
+
+func (ogg *Ogg) Genres() []string {
+	return parseGenres(ogg.Tags["Genre"])
+}
+
+func (ogg *Ogg) Year() uint32 {
+	return parseYear(ogg.Tags["Year"])
+}
+
+func (ogg *Ogg) Container() string {
+	return ContainerOgg
+}
+
+// Codec gets the codec of the file's audio stream, "vorbis" or "opus".
+func (ogg *Ogg) Codec() string {
+	return ogg.codec
+}
+
+func (ogg *Ogg) CoverArt() *Picture {
+	return coverPicture(ogg.pictures)
+}
+
+// Duration reads the length of the audio from the granule position of the last page, without decoding it.
+func (ogg *Ogg) Duration() (time.Duration, error) {
+	file, err := os.Open(ogg.path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return readOggDuration(bufio.NewReader(file))
+}
+
+// ReadBytes returns the raw data from the .ogg file.
+func (ogg *Ogg) ReadBytes() ([]byte, error) {
+	if ogg.buffer != nil {
+		return ogg.buffer, nil
+	}
+
+	buffer, err := ioutil.ReadFile(ogg.path)
+	if err != nil {
+		return nil, err
+	}
+	ogg.buffer = buffer
+	return ogg.buffer, nil
+}
+
+// Decode streams the samples of a Vorbis file.
+// Opus files are stored and served but cannot yet be decoded, lacking a pure Go decoder.
+func (ogg *Ogg) Decode() (beep.StreamSeekCloser, beep.Format, error) {
+	if ogg.codec != CodecVorbis {
+		return nil, beep.Format{}, fmt.Errorf("cannot decode %s audio in %s", ogg.codec, ogg.path)
+	}
+	return decodeFile(ogg.path, func(file *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+		return faifacevorbis.Decode(file)
+	})
+}
+
+// PlayAndWait plays a Vorbis file on the speaker until it ends.
+func (ogg *Ogg) PlayAndWait() error {
+	ogg.playbackFinished = make(chan bool)
+	return playAndWait(ogg.path, ogg.Decode, ogg.playbackFinished)
+}
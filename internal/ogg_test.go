@@ -0,0 +1,126 @@
+package audiostrike
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// oggPage builds an ogg page of the logical stream with serial holding body laced by segmentTable.
+// headerType flags a continued packet (1) or the first page of a stream (2).
+func oggPage(serial uint32, headerType byte, segmentTable []byte, body []byte) []byte {
+	var page bytes.Buffer
+	page.WriteString(oggMagic)
+	page.WriteByte(0) // version
+	page.WriteByte(headerType)
+	page.Write(make([]byte, 8)) // granule position
+	binary.Write(&page, binary.LittleEndian, serial)
+	page.Write(make([]byte, 8)) // sequence number and checksum, which readOggTags does not check
+	page.WriteByte(byte(len(segmentTable)))
+	page.Write(segmentTable)
+	page.Write(body)
+	return page.Bytes()
+}
+
+// lacing gets the segment table to lace packet onto one page.
+func lacing(packet []byte) []byte {
+	var segmentTable []byte
+	length := len(packet)
+	for ; length >= 255; length -= 255 {
+		segmentTable = append(segmentTable, 255)
+	}
+	return append(segmentTable, byte(length))
+}
+
+// oggWithComments builds the header pages of an ogg file with one stream of codec tagged with the given comments.
+func oggWithComments(codec string, comments ...string) []byte {
+	identification, commentHeader := []byte(vorbisIdentificationHeader), []byte(vorbisCommentHeader)
+	if codec == CodecOpus {
+		identification, commentHeader = []byte(opusIdentificationHeader), []byte(opusCommentHeader)
+	}
+	commentPacket := append(commentHeader, vorbisComments(comments...)...)
+	var ogg bytes.Buffer
+	ogg.Write(oggPage(1, 2, lacing(identification), identification))
+	ogg.Write(oggPage(1, 0, lacing(commentPacket), commentPacket))
+	return ogg.Bytes()
+}
+
+// TestReadOggTags verifies that the codec and vorbis comments are read from Vorbis and Opus streams.
+func TestReadOggTags(t *testing.T) {
+	for _, codec := range []string{CodecVorbis, CodecOpus} {
+		ogg := oggWithComments(codec, "artist=Alice in Chains", "TITLE=Would?", "Album=Dirt", "GENRE=Grunge")
+		readCodec, tags, _, err := readOggTags(bytes.NewReader(ogg))
+		if err != nil {
+			t.Fatalf("readOggTags %s error: %v", codec, err)
+		}
+		if readCodec != codec {
+			t.Errorf("expected codec %s but got %s", codec, readCodec)
+		}
+		if tags["Artist"] != "Alice in Chains" || tags["Title"] != "Would?" || tags["Album"] != "Dirt" {
+			t.Errorf("expected %s tags of Would? by Alice in Chains on Dirt but got %v", codec, tags)
+		}
+	}
+}
+
+// TestReadOggTagsMultipleStreams verifies that the tags of the first audio stream are read
+// from a file that multiplexes it with another stream, even if its comment header spans pages.
+func TestReadOggTagsMultipleStreams(t *testing.T) {
+	video := []byte("\x80theora")
+	opusTags := append([]byte(opusCommentHeader), vorbisComments("ARTIST=Alice in Chains", "TITLE=Would?")...)
+	// Pad the comments past one segment so the packet is split over two pages.
+	opusTags = append(opusTags, make([]byte, 300)...)
+
+	var ogg bytes.Buffer
+	ogg.Write(oggPage(7, 2, lacing(video), video))
+	ogg.Write(oggPage(9, 2, lacing([]byte(opusIdentificationHeader)), []byte(opusIdentificationHeader)))
+	ogg.Write(oggPage(9, 0, []byte{255}, opusTags[:255]))
+	ogg.Write(oggPage(7, 0, lacing(video), video))
+	ogg.Write(oggPage(9, 1, lacing(opusTags[255:]), opusTags[255:]))
+
+	codec, tags, _, err := readOggTags(&ogg)
+	if err != nil {
+		t.Fatalf("readOggTags error: %v", err)
+	}
+	if codec != CodecOpus || tags["Title"] != "Would?" {
+		t.Errorf("expected opus tags of Would? but got %s %v", codec, tags)
+	}
+}
+
+// TestReadOggTagsRejectsNoAudio verifies that an ogg file without a Vorbis or Opus stream is rejected.
+func TestReadOggTagsRejectsNoAudio(t *testing.T) {
+	video := []byte("\x80theora")
+	_, _, _, err := readOggTags(bytes.NewReader(oggPage(7, 2, lacing(video), video)))
+	if err == nil {
+		t.Errorf("expected error reading ogg without audio")
+	}
+}
+
+// TestOggFileArt verifies that an opus file without an album tag is a track without an album
+// that records its ogg container and opus codec.
+func TestOggFileArt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "would.opus")
+	err = ioutil.WriteFile(path, oggWithComments(CodecOpus, "ARTIST=Alice in Chains", "TITLE=Would?"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile %s error: %v", path, err)
+	}
+
+	audio, err := OpenAudioFile(path)
+	if err != nil {
+		t.Fatalf("OpenAudioFile %s error: %v", path, err)
+	}
+	_, album, track := AudioFileArt(audio)
+	if album != nil || track.ArtistAlbumId != "" {
+		t.Errorf("expected no album but got %v for track %v", album, track)
+	}
+	if track.ArtistTrackId != "would" || track.Container != ContainerOgg || track.Codec != CodecOpus {
+		t.Errorf("expected opus track would in ogg container but got %v", track)
+	}
+}
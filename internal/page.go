@@ -0,0 +1,170 @@
+package audiostrike
+
+import (
+	"sort"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// pageSize is how many records to get per page when collecting all the records of an ArtServer.
+const pageSize = 100
+
+// sortedPage sorts keys and gets the page of at most limit keys starting at offset.
+// The sorted keys are the same from one page to the next, so paging neither skips nor repeats records.
+func sortedPage(keys []string, offset int, limit int) []string {
+	sort.Strings(keys)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(keys) {
+		offset = len(keys)
+	}
+	end := len(keys)
+	if limit >= 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return keys[offset:end]
+}
+
+// pagePeers gets the page of peers starting at offset, ordered by pubkey.
+func pagePeers(peers map[string]*art.Peer, offset int, limit int) []*art.Peer {
+	pubkeys := make([]string, 0, len(peers))
+	for pubkey := range peers {
+		pubkeys = append(pubkeys, pubkey)
+	}
+	page := make([]*art.Peer, 0)
+	for _, pubkey := range sortedPage(pubkeys, offset, limit) {
+		page = append(page, peers[pubkey])
+	}
+	return page
+}
+
+// pageAlbums gets the page of albums starting at offset, ordered by ArtistAlbumId.
+func pageAlbums(albums map[string]*art.Album, offset int, limit int) []*art.Album {
+	albumIDs := make([]string, 0, len(albums))
+	for albumID := range albums {
+		albumIDs = append(albumIDs, albumID)
+	}
+	page := make([]*art.Album, 0)
+	for _, albumID := range sortedPage(albumIDs, offset, limit) {
+		page = append(page, albums[albumID])
+	}
+	return page
+}
+
+// pageTracks gets the page of tracks starting at offset, ordered by ArtistTrackId.
+func pageTracks(tracks map[string]*art.Track, offset int, limit int) []*art.Track {
+	trackIDs := make([]string, 0, len(tracks))
+	for trackID := range tracks {
+		trackIDs = append(trackIDs, trackID)
+	}
+	page := make([]*art.Track, 0)
+	for _, trackID := range sortedPage(trackIDs, offset, limit) {
+		page = append(page, tracks[trackID])
+	}
+	return page
+}
+
+// pagePlaylists gets the page of playlists starting at offset, ordered by ArtistPlaylistId.
+func pagePlaylists(playlists map[string]*art.Playlist, offset int, limit int) []*art.Playlist {
+	playlistIDs := make([]string, 0, len(playlists))
+	for playlistID := range playlists {
+		playlistIDs = append(playlistIDs, playlistID)
+	}
+	page := make([]*art.Playlist, 0)
+	for _, playlistID := range sortedPage(playlistIDs, offset, limit) {
+		page = append(page, playlists[playlistID])
+	}
+	return page
+}
+
+// sortTracksInAlbumOrder sorts tracks by artist, then by album with singles last,
+// then in the order of their track numbers with unnumbered tracks last, then by title.
+func sortTracksInAlbumOrder(tracks []*art.Track) {
+	sort.SliceStable(tracks, func(i, j int) bool {
+		a, b := tracks[i], tracks[j]
+		if a.ArtistId != b.ArtistId {
+			return a.ArtistId < b.ArtistId
+		}
+		if a.ArtistAlbumId != b.ArtistAlbumId {
+			// Singles, which are on no album, sort after the tracks of albums.
+			if a.ArtistAlbumId == "" || b.ArtistAlbumId == "" {
+				return b.ArtistAlbumId == ""
+			}
+			return a.ArtistAlbumId < b.ArtistAlbumId
+		}
+		if a.AlbumTrackNumber != b.AlbumTrackNumber {
+			// Track number 0 means the track has none, so it sorts after numbered tracks.
+			return a.AlbumTrackNumber-1 < b.AlbumTrackNumber-1
+		}
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+		return a.ArtistTrackId < b.ArtistTrackId
+	})
+}
+
+// collectPeers gets all the peers of artServer, page by page, indexed by pubkey.
+func collectPeers(artServer ArtServer) (map[string]*art.Peer, error) {
+	peers := make(map[string]*art.Peer)
+	for offset := 0; ; offset += pageSize {
+		page, err := artServer.PeersPage(offset, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, peer := range page {
+			peers[peer.Pubkey] = peer
+		}
+		if len(page) < pageSize {
+			return peers, nil
+		}
+	}
+}
+
+// recentTracks gets at most limit of the tracks of each artist, or all of them if limit is negative,
+// newest first by CreatedAt. Tracks created in the same second are ordered by ArtistId and then by ArtistTrackId,
+// like the DbServer query, so the order is stable.
+func recentTracks(tracksByArtist map[string]map[string]*art.Track, limit int) []*art.Track {
+	recent := make([]*art.Track, 0)
+	for _, tracks := range tracksByArtist {
+		for _, track := range tracks {
+			recent = append(recent, track)
+		}
+	}
+	sort.Slice(recent, func(i, j int) bool {
+		iTrack, jTrack := recent[i], recent[j]
+		if iTrack.CreatedAt != jTrack.CreatedAt {
+			return iTrack.CreatedAt > jTrack.CreatedAt
+		}
+		if iTrack.ArtistId != jTrack.ArtistId {
+			return iTrack.ArtistId < jTrack.ArtistId
+		}
+		return iTrack.ArtistTrackId < jTrack.ArtistTrackId
+	})
+	if limit >= 0 && limit < len(recent) {
+		recent = recent[:limit]
+	}
+	return recent
+}
+
+// topTrackStats gets at most limit of stats, or all if limit is negative, ordered by most plays then most purchases,
+// then by artist id and track id to order ties the same way every time.
+func topTrackStats(stats []*art.TrackStats, limit int) []*art.TrackStats {
+	sorted := append([]*art.TrackStats(nil), stats...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Plays != sorted[j].Plays {
+			return sorted[i].Plays > sorted[j].Plays
+		}
+		if sorted[i].Purchases != sorted[j].Purchases {
+			return sorted[i].Purchases > sorted[j].Purchases
+		}
+		if sorted[i].ArtistId != sorted[j].ArtistId {
+			return sorted[i].ArtistId < sorted[j].ArtistId
+		}
+		return sorted[i].ArtistTrackId < sorted[j].ArtistTrackId
+	})
+	if limit >= 0 && limit < len(sorted) {
+		sorted = sorted[:limit]
+	}
+	return sorted
+}
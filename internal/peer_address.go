@@ -0,0 +1,114 @@
+package audiostrike
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+)
+
+// Errors returned by ParsePeerAddress for each malformed part of a peer address. Check for them with errors.Is.
+var (
+	ErrPeerAddressMalformed = errors.New("peer address is not pubkey@host:port")
+	ErrPeerPubkeyInvalid    = errors.New("peer pubkey is not the 66 hex digits of a node's pubkey")
+	ErrPeerHostInvalid      = errors.New("peer host is not a v3 onion address, an IP address, or a host name")
+	ErrPeerPortInvalid      = errors.New("peer port is not a number from 1 to 65535")
+)
+
+// onionV3Regexp matches the 56 base32 digits of a v3 onion service name, lowercased, before ".onion".
+var onionV3Regexp = regexp.MustCompile(`^[a-z2-7]{56}$`)
+
+// hostLabelRegexp matches one dot-separated label of a host name, lowercased.
+var hostLabelRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ParsePeerAddress parses a peer address, pubkey@host:port, into the Peer it names.
+// The host may be a v3 onion address, an IPv4 address, an IPv6 address in brackets, e.g. [2001:db8::7]:53545,
+// or a host name. The pubkey is lowercased and the host normalized by NormalizePeerHost.
+// It returns an error wrapping ErrPeerAddressMalformed, ErrPeerPubkeyInvalid, ErrPeerHostInvalid,
+// or ErrPeerPortInvalid for the part of address that is malformed.
+func ParsePeerAddress(address string) (*art.Peer, error) {
+	pubkey, hostPort, isSplit := strings.Cut(address, "@")
+	if !isSplit {
+		return nil, fmt.Errorf("%w: %q", ErrPeerAddressMalformed, address)
+	}
+	keyBytes, err := hex.DecodeString(pubkey)
+	if err != nil || len(keyBytes) != 33 {
+		return nil, fmt.Errorf("%w: %q", ErrPeerPubkeyInvalid, pubkey)
+	}
+	host, portString, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		if strings.Count(hostPort, ":") > 1 && !strings.HasPrefix(hostPort, "[") {
+			return nil, fmt.Errorf("%w: %q, put an IPv6 address in brackets, e.g. [::1]:53545", ErrPeerHostInvalid, hostPort)
+		}
+		return nil, fmt.Errorf("%w: %q: %v", ErrPeerAddressMalformed, hostPort, err)
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil || port == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrPeerPortInvalid, portString)
+	}
+	host, err = parsePeerHost(host)
+	if err != nil {
+		return nil, err
+	}
+	return &art.Peer{Pubkey: strings.ToLower(pubkey), Host: host, Port: uint32(port)}, nil
+}
+
+// PeerDialAddress gets the host:port address to dial peer at, with an IPv6 host in brackets,
+// e.g. [2001:db8::7]:53545, and the host normalized by NormalizePeerHost.
+func PeerDialAddress(peer *art.Peer) string {
+	return net.JoinHostPort(NormalizePeerHost(peer.Host), strconv.FormatUint(uint64(peer.Port), 10))
+}
+
+// NormalizePeerHost gets host in the form peers are stored and compared in: an IP address in its canonical form
+// without brackets, e.g. 2001:db8::7 for [2001:DB8:0::7], or a host name lowercased.
+func NormalizePeerHost(host string) string {
+	unbracketedHost := strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if ip := net.ParseIP(unbracketedHost); ip != nil {
+		return ip.String()
+	}
+	return strings.ToLower(host)
+}
+
+// normalizePeer gets a copy of peer in the form peers are stored, with its pubkey lowercased
+// and its host normalized by NormalizePeerHost, so that one peer is stored once however it was written.
+func normalizePeer(peer *art.Peer) *art.Peer {
+	normalized := proto.Clone(peer).(*art.Peer)
+	normalized.Pubkey = strings.ToLower(peer.Pubkey)
+	normalized.Host = NormalizePeerHost(peer.Host)
+	return normalized
+}
+
+// parsePeerHost checks that host is a v3 onion address, an IP address, or a host name,
+// and gets it normalized by NormalizePeerHost.
+func parsePeerHost(host string) (string, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	name := strings.ToLower(host)
+	if onionName, isOnion := strings.CutSuffix(name, ".onion"); isOnion {
+		if !onionV3Regexp.MatchString(onionName) {
+			return "", fmt.Errorf("%w: %q is not a v3 onion address of 56 base32 digits", ErrPeerHostInvalid, host)
+		}
+		return name, nil
+	}
+	if len(name) > 253 {
+		return "", fmt.Errorf("%w: %q is longer than 253 characters", ErrPeerHostInvalid, host)
+	}
+	labels := strings.Split(name, ".")
+	for _, label := range labels {
+		if !hostLabelRegexp.MatchString(label) {
+			return "", fmt.Errorf("%w: %q", ErrPeerHostInvalid, host)
+		}
+	}
+	// A name ending in a number, e.g. 203.0.113.256, is a malformed IPv4 address rather than a host name.
+	if _, err := strconv.Atoi(labels[len(labels)-1]); err == nil {
+		return "", fmt.Errorf("%w: %q is not a valid IPv4 address", ErrPeerHostInvalid, host)
+	}
+	return name, nil
+}
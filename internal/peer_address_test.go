@@ -0,0 +1,97 @@
+package audiostrike
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// TestParsePeerAddress tests that peer addresses with v3 onion, IPv4, IPv6, and named hosts parse,
+// and that each malformed part of an address fails with its own error.
+func TestParsePeerAddress(t *testing.T) {
+	onionV3 := "45o4k7vt75tgh4zwbkxl5ec6ccagaulr273piugh3tt2cfmcawzeiwqd.onion"
+	validTests := []struct {
+		address      string
+		expectedHost string
+		expectedPort uint32
+	}{
+		{mockPubkey + "@" + onionV3 + ":53545", onionV3, 53545},
+		{mockPubkey + "@" + strings.ToUpper(onionV3[:56]) + ".onion:80", onionV3, 80},
+		{mockPubkey + "@203.0.113.7:53545", "203.0.113.7", 53545},
+		{mockPubkey + "@[2001:db8::7]:53545", "2001:db8::7", 53545},
+		{mockPubkey + "@[::1]:1", "::1", 1},
+		{mockPubkey + "@[2001:DB8:0::0007]:53545", "2001:db8::7", 53545},
+		{mockPubkey + "@[::ffff:203.0.113.7]:53545", "203.0.113.7", 53545},
+		{mockPubkey + "@Peer.Example.com:65535", "peer.example.com", 65535},
+		{strings.ToUpper(mockPubkey) + "@localhost:53545", "localhost", 53545},
+	}
+	for _, test := range validTests {
+		peer, err := ParsePeerAddress(test.address)
+		if err != nil {
+			t.Errorf("ParsePeerAddress(%s) error: %v", test.address, err)
+			continue
+		}
+		if peer.Pubkey != mockPubkey || peer.Host != test.expectedHost || peer.Port != test.expectedPort {
+			t.Errorf("expected %s to parse as %s@%s:%d but got %v",
+				test.address, mockPubkey, test.expectedHost, test.expectedPort, peer)
+		}
+	}
+
+	malformedTests := []struct {
+		address       string
+		expectedError error
+	}{
+		{onionV3 + ":53545", ErrPeerAddressMalformed},
+		{mockPubkey + "@" + onionV3, ErrPeerAddressMalformed},
+		{mockPubkey[:64] + "@" + onionV3 + ":53545", ErrPeerPubkeyInvalid},
+		{"zz" + mockPubkey[2:] + "@" + onionV3 + ":53545", ErrPeerPubkeyInvalid},
+		{"@" + onionV3 + ":53545", ErrPeerPubkeyInvalid},
+		{mockPubkey + "@expyuzz4wqqyqhjn.onion:53545", ErrPeerHostInvalid},
+		{mockPubkey + "@" + onionV3[:55] + "1.onion:53545", ErrPeerHostInvalid},
+		{mockPubkey + "@2001:db8::7:53545", ErrPeerHostInvalid},
+		{mockPubkey + "@203.0.113.256:53545", ErrPeerHostInvalid},
+		{mockPubkey + "@peer_1.example.com:53545", ErrPeerHostInvalid},
+		{mockPubkey + "@:53545", ErrPeerHostInvalid},
+		{mockPubkey + "@" + onionV3 + ":0", ErrPeerPortInvalid},
+		{mockPubkey + "@" + onionV3 + ":65536", ErrPeerPortInvalid},
+		{mockPubkey + "@[::1]:port", ErrPeerPortInvalid},
+	}
+	for _, test := range malformedTests {
+		peer, err := ParsePeerAddress(test.address)
+		if !errors.Is(err, test.expectedError) {
+			t.Errorf("expected %v parsing %s but got %v, error: %v", test.expectedError, test.address, peer, err)
+		}
+	}
+}
+
+// TestPeerDialAddress tests that peers are dialed with IPv6 hosts in brackets and with hosts of each
+// address family normalized, however they were stored.
+func TestPeerDialAddress(t *testing.T) {
+	onionV3 := "45o4k7vt75tgh4zwbkxl5ec6ccagaulr273piugh3tt2cfmcawzeiwqd.onion"
+	tests := []struct {
+		host            string
+		expectedAddress string
+	}{
+		{onionV3, onionV3 + ":53545"},
+		{strings.ToUpper(onionV3), onionV3 + ":53545"},
+		{"203.0.113.7", "203.0.113.7:53545"},
+		{"::ffff:203.0.113.7", "203.0.113.7:53545"},
+		{"2001:db8::7", "[2001:db8::7]:53545"},
+		{"[2001:DB8:0:0::7]", "[2001:db8::7]:53545"},
+		{"::1", "[::1]:53545"},
+		{"Peer.Example.com", "peer.example.com:53545"},
+	}
+	for _, test := range tests {
+		peer := &art.Peer{Pubkey: mockPubkey, Host: test.host, Port: 53545}
+		if address := PeerDialAddress(peer); address != test.expectedAddress {
+			t.Errorf("expected %s to be dialed at %s but got %s", test.host, test.expectedAddress, address)
+		}
+		parsedPeer, err := ParsePeerAddress(mockPubkey + "@" + PeerDialAddress(peer))
+		if err != nil || parsedPeer.Host != NormalizePeerHost(test.host) {
+			t.Errorf("expected dial address of %s to parse as host %s but got %v, error: %v",
+				test.host, NormalizePeerHost(test.host), parsedPeer, err)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+package audiostrike
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ChallengeHeader is the http header in which a client of a private node names the challenge it signed.
+	ChallengeHeader = "X-Austk-Challenge"
+	// ChallengeSignatureHeader is the http header in which a client of a private node sends its lnd signature
+	// of the challenge and its SessionKeyHeader, proving the pubkey it names in PubkeyHeader.
+	ChallengeSignatureHeader = "X-Austk-Challenge-Signature"
+	// SessionKeyHeader is the http header in which a client of a private node sends the hex X25519 public key
+	// it agreed with the challenge's key on the key of its session.
+	SessionKeyHeader = "X-Austk-Session-Key"
+	// RequestSequenceHeader is the http header in which a client of a private node numbers each request
+	// of its session, from 1, so a request cannot be replayed.
+	RequestSequenceHeader = "X-Austk-Request-Sequence"
+	// RequestMacHeader is the http header in which a client of a private node sends the hex HMAC-SHA256
+	// of the method, URI, and sequence of each request, keyed by its session key.
+	RequestMacHeader = "X-Austk-Request-Mac"
+
+	// challengeBytes is the length of the random challenge a private node issues to a peer.
+	challengeBytes = 32
+	// challengeAnswerTimeout is how long a challenge stays valid before a peer proves its pubkey by it.
+	challengeAnswerTimeout = time.Minute
+	// challengeLifetime is how long the session of a peer stays valid after the peer proved its pubkey,
+	// so a client proves its pubkey once an hour for a sync session, even while idle in a ClientPool.
+	challengeLifetime = time.Hour
+	// challengeRenewal is how long a client uses a session before it signs a new challenge,
+	// early enough that its session does not expire between requests.
+	challengeRenewal = 50 * time.Minute
+	// maxChallenges limits the challenges a private node keeps valid at once.
+	maxChallenges = 4096
+	// maxChallengesPerAddress limits the challenges issued to one remote address that wait for an answer,
+	// so one host cannot crowd out the challenges of others.
+	maxChallengesPerAddress = 16
+	// replayWindow is how many requests of a session before the latest may still arrive, out of order.
+	replayWindow = 64
+	// challengeMessagePrefix is signed before a challenge, so that a peer cannot have a client sign
+	// a publication or any other message that is not a challenge.
+	challengeMessagePrefix = "audiostrike peer challenge "
+)
+
+// provenPubkeyKey is the context key of the pubkey that a request proved by a signed challenge.
+type provenPubkeyKey struct{}
+
+// withProvenPubkey gets req with the pubkey it proved by a signed challenge in its context.
+func withProvenPubkey(req *http.Request, pubkey string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), provenPubkeyKey{}, strings.ToLower(pubkey)))
+}
+
+// provenPubkey gets the pubkey that req proved to peersOnly by a signed challenge,
+// or "" if it proved none, e.g. on a public node, unlike the pubkey it claims in PubkeyHeader.
+func provenPubkey(req *http.Request) string {
+	pubkey, _ := req.Context().Value(provenPubkeyKey{}).(string)
+	return pubkey
+}
+
+// challengeMessage gets the message a client signs to prove its pubkey by challenge
+// and bind it to the client's hex X25519 sessionKey.
+func challengeMessage(challenge string, sessionKey string) []byte {
+	return []byte(challengeMessagePrefix + challenge + " " + sessionKey)
+}
+
+// sessionMacKey derives the key of a session from the X25519 key agreed by the node and the client for challenge.
+func sessionMacKey(privateKey *ecdh.PrivateKey, peerSessionKey string, challenge string) ([]byte, error) {
+	peerKeyBytes, err := hex.DecodeString(peerSessionKey)
+	if err != nil {
+		return nil, err
+	}
+	peerKey, err := ecdh.X25519().NewPublicKey(peerKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := privateKey.ECDH(peerKey)
+	if err != nil {
+		return nil, err
+	}
+	macKey := sha256.Sum256(append(shared, challenge...))
+	return macKey[:], nil
+}
+
+// requestMac gets the hex HMAC-SHA256, keyed by macKey, of the method, URI, and sequence of a request.
+// The body is not covered: requests to a private node send only small bodies, e.g. a handshake.
+func requestMac(macKey []byte, method string, requestURI string, sequence uint64) string {
+	mac := hmac.New(sha256.New, macKey)
+	fmt.Fprintf(mac, "%s %s %d", method, requestURI, sequence)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// peerAuthenticator issues challenges to peers of a private node and checks that each request is signed
+// by an allowed peer. It is safe for concurrent use.
+type peerAuthenticator struct {
+	publisher      Publisher
+	allowedPubkeys map[string]bool
+
+	// challenges maps each issued challenge to the session of the peer that proved its pubkey by it, if any yet.
+	challenges map[string]*issuedChallenge
+	mutex      sync.Mutex
+
+	// now gets the current time.
+	now func() time.Time
+}
+
+// issuedChallenge is a challenge a node issued to address, with the session of the peer that answered it, if any.
+type issuedChallenge struct {
+	address   string
+	issuedAt  time.Time
+	expiresAt time.Time
+	// privateKey is the node's X25519 key of the session, whose public key was issued with the challenge.
+	privateKey *ecdh.PrivateKey
+	// isVerifying is set while lnd verifies a signature of the challenge, which it does once.
+	isVerifying bool
+
+	pubkey string
+	macKey []byte
+	// maxSequence is the latest request sequence of the session, and seenSequences has bit i set
+	// for each request maxSequence-i seen, to refuse a replayed request.
+	maxSequence   uint64
+	seenSequences uint64
+}
+
+// isAnswered checks whether a peer proved its pubkey by the challenge.
+func (issued *issuedChallenge) isAnswered() bool {
+	return issued.macKey != nil
+}
+
+// acceptSequence records request sequence of the session and checks that it was not seen before
+// and is within replayWindow of the latest.
+func (issued *issuedChallenge) acceptSequence(sequence uint64) bool {
+	switch {
+	case sequence == 0:
+		return false
+	case sequence > issued.maxSequence:
+		if shift := sequence - issued.maxSequence; shift < replayWindow {
+			issued.seenSequences <<= shift
+		} else {
+			issued.seenSequences = 0
+		}
+		issued.seenSequences |= 1
+		issued.maxSequence = sequence
+		return true
+	case issued.maxSequence-sequence >= replayWindow:
+		return false
+	}
+	bit := uint64(1) << (issued.maxSequence - sequence)
+	if issued.seenSequences&bit != 0 {
+		return false
+	}
+	issued.seenSequences |= bit
+	return true
+}
+
+// newPeerAuthenticator creates a peerAuthenticator that verifies signatures with publisher
+// and allows only the peers with allowedPubkeys. It returns nil if no peer is listed, for a public node.
+func newPeerAuthenticator(publisher Publisher, allowedPubkeys []string) *peerAuthenticator {
+	if len(allowedPubkeys) == 0 {
+		return nil
+	}
+	authenticator := &peerAuthenticator{
+		publisher:      publisher,
+		allowedPubkeys: make(map[string]bool),
+		challenges:     make(map[string]*issuedChallenge),
+		now:            time.Now,
+	}
+	for _, pubkey := range allowedPubkeys {
+		authenticator.allowedPubkeys[strings.ToLower(pubkey)] = true
+	}
+	return authenticator
+}
+
+// issue creates a new random challenge for a peer at address to sign, with the hex X25519 public key
+// of the node's side of the session. It forgets the oldest challenge waiting for an answer
+// if address, or all addresses, have too many.
+func (authenticator *peerAuthenticator) issue(address string) (challenge string, sessionKey string, err error) {
+	randomBytes := make([]byte, challengeBytes)
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		return "", "", err
+	}
+	challenge = hex.EncodeToString(randomBytes)
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	authenticator.mutex.Lock()
+	defer authenticator.mutex.Unlock()
+	now := authenticator.now()
+	addressChallenges := 0
+	var oldest, oldestOfAddress string
+	for issued, issuedChallenge := range authenticator.challenges {
+		if !now.Before(issuedChallenge.expiresAt) {
+			delete(authenticator.challenges, issued)
+			continue
+		}
+		if issuedChallenge.isAnswered() {
+			continue
+		}
+		if oldest == "" || issuedChallenge.issuedAt.Before(authenticator.challenges[oldest].issuedAt) {
+			oldest = issued
+		}
+		if issuedChallenge.address == address {
+			addressChallenges++
+			if oldestOfAddress == "" || issuedChallenge.issuedAt.Before(authenticator.challenges[oldestOfAddress].issuedAt) {
+				oldestOfAddress = issued
+			}
+		}
+	}
+	if addressChallenges >= maxChallengesPerAddress {
+		delete(authenticator.challenges, oldestOfAddress)
+	} else if len(authenticator.challenges) >= maxChallenges {
+		if oldest == "" {
+			return "", "", errors.New("too many sessions outstanding")
+		}
+		delete(authenticator.challenges, oldest)
+	}
+	authenticator.challenges[challenge] = &issuedChallenge{
+		address:    address,
+		issuedAt:   now,
+		expiresAt:  now.Add(challengeAnswerTimeout),
+		privateKey: privateKey,
+	}
+	return challenge, hex.EncodeToString(privateKey.PublicKey().Bytes()), nil
+}
+
+// authenticate checks that req names an allowed pubkey, proven by its signature of a valid challenge,
+// and that its RequestMacHeader of a new RequestSequenceHeader is keyed by the session key agreed for the challenge.
+// lnd verifies the signature of a challenge once: a challenge whose signature fails is forgotten.
+// It returns ErrPeerNotAllowed for a pubkey that is not allowed, and ErrSignatureInvalid for a challenge
+// this node did not issue or let expire, a bad signature or mac, or a replayed request,
+// or ErrPubkeyMismatch for another signer's signature.
+func (authenticator *peerAuthenticator) authenticate(ctx context.Context, req *http.Request) error {
+	pubkey := strings.ToLower(req.Header.Get(PubkeyHeader))
+	if pubkey == "" || !authenticator.allowedPubkeys[pubkey] {
+		return fmt.Errorf("%w: pubkey %q is not allowed", ErrPeerNotAllowed, pubkey)
+	}
+	challenge := req.Header.Get(ChallengeHeader)
+	signature := req.Header.Get(ChallengeSignatureHeader)
+	sessionKey := req.Header.Get(SessionKeyHeader)
+	sequence, err := strconv.ParseUint(req.Header.Get(RequestSequenceHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: no request sequence", ErrSignatureInvalid)
+	}
+	mac, err := hex.DecodeString(req.Header.Get(RequestMacHeader))
+	if err != nil {
+		return fmt.Errorf("%w: malformed request mac", ErrSignatureInvalid)
+	}
+
+	authenticator.mutex.Lock()
+	issued := authenticator.challenges[challenge]
+	if issued == nil || !authenticator.now().Before(issued.expiresAt) {
+		authenticator.mutex.Unlock()
+		return fmt.Errorf("%w: unknown or expired challenge", ErrSignatureInvalid)
+	}
+	if issued.isAnswered() {
+		defer authenticator.mutex.Unlock()
+		return issued.checkRequest(req, pubkey, mac, sequence)
+	}
+	if signature == "" || issued.isVerifying {
+		authenticator.mutex.Unlock()
+		return fmt.Errorf("%w: challenge is not signed", ErrSignatureInvalid)
+	}
+	macKey, err := sessionMacKey(issued.privateKey, sessionKey, challenge)
+	if err != nil {
+		delete(authenticator.challenges, challenge)
+		authenticator.mutex.Unlock()
+		return fmt.Errorf("%w: malformed session key, error: %v", ErrSignatureInvalid, err)
+	}
+	issued.isVerifying = true
+	authenticator.mutex.Unlock()
+
+	// Verify the signature of the challenge through lnd, outside the lock.
+	signerPubkey, err := authenticator.publisher.VerifyMessage(ctx, challengeMessage(challenge, sessionKey), signature)
+	if err == nil && !strings.EqualFold(signerPubkey, pubkey) {
+		err = fmt.Errorf("%w: challenge signed by %s, not %s", ErrPubkeyMismatch, signerPubkey, pubkey)
+	}
+
+	authenticator.mutex.Lock()
+	defer authenticator.mutex.Unlock()
+	issued.isVerifying = false
+	if err != nil {
+		delete(authenticator.challenges, challenge)
+		return err
+	}
+	issued.pubkey = pubkey
+	issued.macKey = macKey
+	issued.expiresAt = authenticator.now().Add(challengeLifetime)
+	return issued.checkRequest(req, pubkey, mac, sequence)
+}
+
+// checkRequest checks that req, from the peer with pubkey, has the mac of its method, URI, and sequence
+// keyed by the session and that the session has not seen the sequence before.
+// The caller must hold the authenticator's mutex.
+func (issued *issuedChallenge) checkRequest(req *http.Request, pubkey string, mac []byte, sequence uint64) error {
+	if pubkey != issued.pubkey {
+		return fmt.Errorf("%w: challenge was answered by %s", ErrPubkeyMismatch, issued.pubkey)
+	}
+	expectedMac, _ := hex.DecodeString(requestMac(issued.macKey, req.Method, req.RequestURI, sequence))
+	if !hmac.Equal(mac, expectedMac) {
+		return fmt.Errorf("%w: bad request mac", ErrSignatureInvalid)
+	}
+	if !issued.acceptSequence(sequence) {
+		return fmt.Errorf("%w: replayed request %d", ErrSignatureInvalid, sequence)
+	}
+	return nil
+}
+
+// challengeHandler handles a peer's request for a challenge to sign, replying with it and the node's
+// X25519 session key as hex text separated by a space, or 404 Not Found from a public node, which needs no proof.
+func (server *AustkServer) challengeHandler(w http.ResponseWriter, req *http.Request) {
+	if server.peerAuthenticator == nil {
+		http.Error(w, "this node serves every peer", http.StatusNotFound)
+		return
+	}
+	address, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		address = req.RemoteAddr
+	}
+	challenge, sessionKey, err := server.peerAuthenticator.issue(address)
+	if err != nil {
+		server.logger.Warn("failed to issue challenge", "peer", req.Header.Get(PubkeyHeader), "error", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(challenge + " " + sessionKey))
+}
+
+// peersOnly wraps handler, on a private node, to reply 401 Unauthorized to a request that does not prove
+// its pubkey by a signed challenge and 403 Forbidden to a peer that is not allowed.
+// It passes the pubkey proven to handler, for provenPubkey to get.
+// The admin is let through without a challenge.
+func (server *AustkServer) peersOnly(handler http.HandlerFunc) http.HandlerFunc {
+	authenticator := server.peerAuthenticator
+	if authenticator == nil {
+		return handler
+	}
+	return func(w http.ResponseWriter, req *http.Request) {
+		pubkey := req.Header.Get(PubkeyHeader)
+		err := authenticator.authenticate(req.Context(), req)
+		if err == nil {
+			req = withProvenPubkey(req, pubkey)
+		} else if server.isAdmin(req) {
+			err = nil
+		}
+		switch {
+		case err == nil:
+			handler(w, req)
+		case errors.Is(err, ErrPeerNotAllowed):
+			server.logger.Info("reject peer that is not allowed", "url", req.URL.Path, "peer", pubkey, "remote_address", req.RemoteAddr)
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ErrSignatureInvalid) || errors.Is(err, ErrPubkeyMismatch):
+			server.logger.Info("reject unproven peer", "url", req.URL.Path, "peer", pubkey, "error", err)
+			http.Error(w, "sign a challenge from POST /challenge: "+err.Error(), http.StatusUnauthorized)
+		default:
+			server.logger.Warn("failed to verify peer", "peer", pubkey, "error", err)
+			http.Error(w, "failed to verify challenge", http.StatusServiceUnavailable)
+		}
+	}
+}
+
+// authenticate proves the pubkey of the client's node to its private peer by signing a challenge
+// that the peer issues, with the client's side of a new session key, to key the mac of each later request
+// of the client's session. The signature is bound to the session key, so it is no use to an eavesdropper.
+func (client *Client) authenticate() error {
+	if client.publisher == nil {
+		return fmt.Errorf("%w: peer %s is private, and no lnd key can prove this node's pubkey",
+			ErrPeerNotAllowed, client.peerAddress)
+	}
+	client.isPeerPrivate = true
+	client.challenge = ""
+	challengeURL := "http://" + client.peerAddress + "/challenge"
+	// Request the challenge without the headers of the session it renews.
+	request, err := http.NewRequest("POST", challengeURL, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set(VersionHeader, Version)
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		client.logger.Warn("failed to request challenge", "url", challengeURL, "route", client.route(), "error", err)
+		return client.connectionError(challengeURL, err)
+	}
+	defer response.Body.Close()
+	replyBytes, err := ioutil.ReadAll(io.LimitReader(response.Body, 8*challengeBytes))
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return client.replyError(response, replyBytes)
+	}
+	fields := strings.Fields(string(replyBytes))
+	if len(fields) != 2 {
+		return fmt.Errorf("malformed challenge from peer %s: %q", client.peerAddress, replyBytes)
+	}
+	challenge, peerSessionKey := fields[0], fields[1]
+	challengeBytesGot, err := hex.DecodeString(challenge)
+	if err != nil || len(challengeBytesGot) != challengeBytes {
+		return fmt.Errorf("malformed challenge from peer %s: %q", client.peerAddress, challenge)
+	}
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	macKey, err := sessionMacKey(privateKey, peerSessionKey, challenge)
+	if err != nil {
+		return fmt.Errorf("malformed session key from peer %s: %w", client.peerAddress, err)
+	}
+	sessionKey := hex.EncodeToString(privateKey.PublicKey().Bytes())
+	signature, err := client.publisher.SignMessage(client.ctx, challengeMessage(challenge, sessionKey))
+	if err != nil {
+		client.logger.Error("failed to sign challenge", "error", err)
+		return err
+	}
+	client.challenge = challenge
+	client.challengeSignature = signature
+	client.sessionKey = sessionKey
+	client.sessionMacKey = macKey
+	client.requestSequence = 0
+	client.authenticatedAt = time.Now()
+	client.logger.Debug("signed challenge of private peer")
+	return nil
+}
+
+// setSessionHeaders names the pubkey of the client's node in request, with the signed challenge and mac
+// of its session, renewing the session first if it is about to expire.
+func (client *Client) setSessionHeaders(request *http.Request) error {
+	if client.challenge == "" || time.Since(client.authenticatedAt) >= challengeRenewal {
+		err := client.authenticate()
+		if err != nil {
+			return err
+		}
+	}
+	if !client.isPubkeyGot {
+		client.isPubkeyGot = true
+		var err error
+		client.pubkey, err = client.publisher.Pubkey(client.ctx)
+		if err != nil {
+			client.logger.Debug("failed to get pubkey to name this node to peer", "error", err)
+		}
+	}
+	client.requestSequence++
+	request.Header.Set(PubkeyHeader, client.pubkey)
+	request.Header.Set(ChallengeHeader, client.challenge)
+	request.Header.Set(ChallengeSignatureHeader, client.challengeSignature)
+	request.Header.Set(SessionKeyHeader, client.sessionKey)
+	request.Header.Set(RequestSequenceHeader, strconv.FormatUint(client.requestSequence, 10))
+	request.Header.Set(RequestMacHeader,
+		requestMac(client.sessionMacKey, request.Method, request.URL.RequestURI(), client.requestSequence))
+	return nil
+}
@@ -0,0 +1,277 @@
+package audiostrike
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/gorilla/mux"
+)
+
+// testSession is the client's side of a session with a peerAuthenticator, to make requests of it in tests.
+type testSession struct {
+	challenge  string
+	sessionKey string
+	signature  string
+	macKey     []byte
+}
+
+// newTestSession answers challenge, issued with the node's peerSessionKey, for mockPubkey.
+func newTestSession(t *testing.T, challenge string, peerSessionKey string) *testSession {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey error: %v", err)
+	}
+	macKey, err := sessionMacKey(privateKey, peerSessionKey, challenge)
+	if err != nil {
+		t.Fatalf("sessionMacKey error: %v", err)
+	}
+	sessionKey := hex.EncodeToString(privateKey.PublicKey().Bytes())
+	return &testSession{
+		challenge:  challenge,
+		sessionKey: sessionKey,
+		signature:  mockSignature(challengeMessage(challenge, sessionKey)),
+		macKey:     macKey,
+	}
+}
+
+// request gets a request of the session from pubkey for uri, numbered sequence.
+func (session *testSession) request(pubkey string, uri string, sequence uint64) *http.Request {
+	request := httptest.NewRequest("GET", uri, nil)
+	request.Header.Set(PubkeyHeader, pubkey)
+	request.Header.Set(ChallengeHeader, session.challenge)
+	request.Header.Set(ChallengeSignatureHeader, session.signature)
+	request.Header.Set(SessionKeyHeader, session.sessionKey)
+	request.Header.Set(RequestSequenceHeader, strconv.FormatUint(sequence, 10))
+	request.Header.Set(RequestMacHeader, requestMac(session.macKey, "GET", uri, sequence))
+	return request
+}
+
+// TestPeerAuthenticator verifies that an allowed peer proves its pubkey by signing an issued challenge
+// and then numbers and macs each request of its session, and that other peers, forged signatures, replayed
+// or altered requests, and unknown or expired challenges are refused.
+func TestPeerAuthenticator(t *testing.T) {
+	if newPeerAuthenticator(&mockPublisher, nil) != nil {
+		t.Errorf("expected no authenticator for a public node")
+	}
+	authenticator := newPeerAuthenticator(&mockPublisher, []string{mockPubkey})
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	authenticator.now = func() time.Time { return now }
+	challenge, peerSessionKey, err := authenticator.issue("192.0.2.1")
+	if err != nil || len(challenge) != 2*challengeBytes {
+		t.Fatalf("expected a hex challenge but got %q, error: %v", challenge, err)
+	}
+	session := newTestSession(t, challenge, peerSessionKey)
+
+	otherPubkey := "03" + mockPubkey[2:]
+	altered := session.request(mockPubkey, "/", 9)
+	altered.RequestURI = "/art/" + mockArtistID + "/" + mockTrackID
+	tests := []struct {
+		name     string
+		request  *http.Request
+		expected error
+	}{
+		{"allowed peer", session.request(mockPubkey, "/", 1), nil},
+		{"next request", session.request(mockPubkey, "/publications", 2), nil},
+		{"replayed request", session.request(mockPubkey, "/publications", 2), ErrSignatureInvalid},
+		{"later request", session.request(mockPubkey, "/", 5), nil},
+		{"request out of order", session.request(mockPubkey, "/", 4), nil},
+		{"request out of the replay window", session.request(mockPubkey, "/", 5+replayWindow+1), nil},
+		{"request before the replay window", session.request(mockPubkey, "/", 5), ErrSignatureInvalid},
+		{"altered request", altered, ErrSignatureInvalid},
+		{"unnamed peer", session.request("", "/", 100), ErrPeerNotAllowed},
+		{"other peer", session.request(otherPubkey, "/", 100), ErrPeerNotAllowed},
+	}
+	unissued := newTestSession(t, "00"+challenge[2:], peerSessionKey)
+	tests = append(tests, struct {
+		name     string
+		request  *http.Request
+		expected error
+	}{"unissued challenge", unissued.request(mockPubkey, "/", 1), ErrSignatureInvalid})
+	for _, test := range tests {
+		err := authenticator.authenticate(context.Background(), test.request)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("%s: expected %v but got %v", test.name, test.expected, err)
+		}
+	}
+
+	// A challenge whose signature fails is forgotten, so lnd verifies a signature of each challenge once,
+	// while an unsigned request costs no lnd call and leaves the challenge to answer.
+	for _, test := range []struct {
+		name             string
+		forgedSignature  func(session *testSession) string
+		expectedAnswered error
+	}{
+		{"unsigned challenge", func(session *testSession) string { return "" }, nil},
+		{"signed bare challenge", func(session *testSession) string {
+			return mockSignature([]byte(session.challenge))
+		}, ErrSignatureInvalid},
+	} {
+		challenge, peerSessionKey, err := authenticator.issue("192.0.2.1")
+		if err != nil {
+			t.Fatalf("issue error: %v", err)
+		}
+		forgedSession := newTestSession(t, challenge, peerSessionKey)
+		signature := forgedSession.signature
+		forgedSession.signature = test.forgedSignature(forgedSession)
+		err = authenticator.authenticate(context.Background(), forgedSession.request(mockPubkey, "/", 1))
+		if !errors.Is(err, ErrSignatureInvalid) {
+			t.Errorf("%s: expected ErrSignatureInvalid but got %v", test.name, err)
+		}
+		forgedSession.signature = signature
+		err = authenticator.authenticate(context.Background(), forgedSession.request(mockPubkey, "/", 2))
+		if !errors.Is(err, test.expectedAnswered) {
+			t.Errorf("%s: expected %v answering the challenge after but got %v", test.name, test.expectedAnswered, err)
+		}
+	}
+
+	// A session expires an hour after it was proven, however recently it was used.
+	now = now.Add(challengeLifetime - time.Second)
+	err = authenticator.authenticate(context.Background(), session.request(mockPubkey, "/", 1000))
+	if err != nil {
+		t.Errorf("expected the session valid until it expires but got %v", err)
+	}
+	now = now.Add(time.Second)
+	err = authenticator.authenticate(context.Background(), session.request(mockPubkey, "/", 1001))
+	if !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected ErrSignatureInvalid for an expired session but got %v", err)
+	}
+
+	// A challenge not answered soon expires.
+	challenge, peerSessionKey, err = authenticator.issue("192.0.2.1")
+	if err != nil {
+		t.Fatalf("issue error: %v", err)
+	}
+	now = now.Add(challengeAnswerTimeout)
+	err = authenticator.authenticate(context.Background(), newTestSession(t, challenge, peerSessionKey).request(mockPubkey, "/", 1))
+	if !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected ErrSignatureInvalid for an expired challenge but got %v", err)
+	}
+}
+
+// TestChallengesPerAddress verifies that one address cannot keep more than maxChallengesPerAddress challenges
+// waiting for an answer, the oldest being forgotten first, and that the challenges of other addresses are kept.
+func TestChallengesPerAddress(t *testing.T) {
+	authenticator := newPeerAuthenticator(&mockPublisher, []string{mockPubkey})
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	authenticator.now = func() time.Time { return now }
+	otherChallenge, otherSessionKey, err := authenticator.issue("192.0.2.2")
+	if err != nil {
+		t.Fatalf("issue error: %v", err)
+	}
+	var challenges, sessionKeys []string
+	for i := 0; i <= maxChallengesPerAddress; i++ {
+		now = now.Add(time.Millisecond)
+		challenge, sessionKey, err := authenticator.issue("192.0.2.1")
+		if err != nil {
+			t.Fatalf("issue error: %v", err)
+		}
+		challenges = append(challenges, challenge)
+		sessionKeys = append(sessionKeys, sessionKey)
+	}
+	if len(authenticator.challenges) != maxChallengesPerAddress+1 {
+		t.Errorf("expected %d challenges kept but got %d", maxChallengesPerAddress+1, len(authenticator.challenges))
+	}
+	for i, test := range []struct {
+		challenge  string
+		sessionKey string
+		expected   error
+	}{
+		{challenges[0], sessionKeys[0], ErrSignatureInvalid},
+		{challenges[1], sessionKeys[1], nil},
+		{otherChallenge, otherSessionKey, nil},
+	} {
+		request := newTestSession(t, test.challenge, test.sessionKey).request(mockPubkey, "/", 1)
+		err = authenticator.authenticate(context.Background(), request)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("%d: expected %v but got %v", i, test.expected, err)
+		}
+	}
+}
+
+// TestPrivatePeerSync verifies that a private node serves its art to an allowed peer that proves its pubkey,
+// refuses a request without proof, and that a public node serves every peer.
+func TestPrivatePeerSync(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	err = fileServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	err = fileServer.StoreTrack(&art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID}, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+
+	for _, allowedPeers := range [][]string{{mockPubkey}, {"03" + mockPubkey[2:]}, nil} {
+		privateCfg := *cfg
+		privateCfg.AllowedPeers = allowedPeers
+		austkServer, err := NewAustkServer(&privateCfg, fileServer, mockLightningNode)
+		if err != nil {
+			t.Fatalf("NewAustkServer error: %v", err)
+		}
+		testRouter := mux.NewRouter()
+		testRouter.HandleFunc("/", austkServer.peersOnly(austkServer.getAllArtHandler)).Methods("GET")
+		testRouter.HandleFunc("/handshake", austkServer.handshakeHandler).Methods("POST")
+		testRouter.HandleFunc("/challenge", austkServer.challengeHandler).Methods("POST")
+		testHttpServer := httptest.NewServer(testRouter)
+		testUrl, _ := url.Parse(testHttpServer.URL)
+
+		isAllowed := len(allowedPeers) == 0 || allowedPeers[0] == mockPubkey
+		client, err := Connect(context.Background(), TorProxyDisabled, testUrl.Host, mockLightningNode)
+		if err != nil {
+			t.Fatalf("%v: Connect error: %v", allowedPeers, err)
+		}
+		resources, err := client.Catalog()
+		if isAllowed && (err != nil || len(resources.Tracks) != 1) {
+			t.Errorf("%v: expected the track in the catalog but got %v, error: %v", allowedPeers, resources, err)
+		} else if !isAllowed && !errors.Is(err, ErrPeerNotAllowed) {
+			t.Errorf("%v: expected ErrPeerNotAllowed but got %v", allowedPeers, err)
+		}
+		client.CloseConnection()
+
+		// A request without a signed challenge is refused unless the node is public.
+		request, _ := http.NewRequest("GET", testHttpServer.URL+"/", nil)
+		request.Header.Set(PubkeyHeader, mockPubkey)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("GET / error: %v", err)
+		}
+		replyBytes, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		expectedStatus := http.StatusUnauthorized
+		if len(allowedPeers) == 0 {
+			expectedStatus = http.StatusOK
+		} else if !isAllowed {
+			expectedStatus = http.StatusForbidden
+		}
+		if response.StatusCode != expectedStatus {
+			t.Errorf("%v: expected status %d without a challenge but got %d: %s",
+				allowedPeers, expectedStatus, response.StatusCode, bytes.TrimSpace(replyBytes))
+		}
+		testHttpServer.Close()
+	}
+}
@@ -0,0 +1,94 @@
+package audiostrike
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RemovePeer deletes the stored peer with pubkey and publishes the art of the hosted artists again without it.
+// It refuses to remove this node's own peer with ErrSelfPeer.
+// A peer still gossiped by other peers may be stored again after a later sync reaches it.
+func (server *AustkServer) RemovePeer(pubkey string) error {
+	selfPubkey, err := server.publisher.Pubkey(server.ctx)
+	if err != nil {
+		server.logger.Error("failed to get pubkey from lnd", "error", err)
+		return err
+	}
+	if pubkey == selfPubkey {
+		return fmt.Errorf("%w: %s", ErrSelfPeer, pubkey)
+	}
+	err = server.deletePeer(pubkey)
+	if err != nil {
+		return err
+	}
+	server.logger.Info("removed peer", "peer", pubkey)
+	return server.publishHosted()
+}
+
+// PrunePeers deletes the stored peers, other than this node's own, not reachable within window:
+// those last synced before then, or never synced and stored before then.
+// It publishes the art of the hosted artists again without them, and returns their pubkeys in order.
+func (server *AustkServer) PrunePeers(window time.Duration) ([]string, error) {
+	selfPubkey, err := server.publisher.Pubkey(server.ctx)
+	if err != nil {
+		server.logger.Error("failed to get pubkey from lnd", "error", err)
+		return nil, err
+	}
+	peers, err := server.artServer.Peers()
+	if err != nil {
+		return nil, err
+	}
+	var reachableAfter uint64
+	if now, windowSeconds := nowUnix(), uint64(window/time.Second); windowSeconds < now {
+		reachableAfter = now - windowSeconds
+	}
+
+	var prunedPubkeys []string
+	for pubkey, peer := range peers {
+		if pubkey == selfPubkey {
+			continue // to next peer, not pruning this node
+		}
+		reputation, err := server.artServer.PeerReputation(pubkey)
+		if err != nil {
+			return nil, err
+		}
+		lastReachableAt := reputation.LastReachableAt
+		if lastReachableAt == 0 {
+			lastReachableAt = peer.UpdatedAt
+		}
+		if lastReachableAt >= reachableAfter {
+			continue // to next peer, reachable recently
+		}
+		err = server.deletePeer(pubkey)
+		if err != nil {
+			server.logger.Error("failed to remove peer", "peer", pubkey, "error", err)
+			return nil, err
+		}
+		server.logger.Info("pruned peer", "peer", pubkey, "last_reachable_at", reputation.LastReachableAt)
+		prunedPubkeys = append(prunedPubkeys, pubkey)
+	}
+	sort.Strings(prunedPubkeys)
+	if len(prunedPubkeys) == 0 {
+		return nil, nil
+	}
+	return prunedPubkeys, server.publishHosted()
+}
+
+// deletePeer deletes the stored peer with pubkey and its records, dropping the bandwidth counted for it
+// and not stored yet so that it is not stored again.
+func (server *AustkServer) deletePeer(pubkey string) error {
+	server.bandwidth.forget(pubkey)
+	return server.artServer.DeletePeer(pubkey)
+}
+
+// publishHosted publishes the art of each hosted artist again, e.g. after the stored peers change.
+func (server *AustkServer) publishHosted() error {
+	for _, artistID := range server.config.PublishingArtistIDs() {
+		err := server.publish(artistID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
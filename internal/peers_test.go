@@ -0,0 +1,101 @@
+package audiostrike
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// TestPrunePeers verifies that the peers not synced recently are removed and stay removed after a restart,
+// and that this node's own peer is never removed.
+func TestPrunePeers(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	err = fileServer.StorePeer(&art.Peer{Pubkey: mockPubkey, Host: "self.onion", Port: 53545}, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StorePeer error: %v", err)
+	}
+	recentPeer, stalePeer, lostPeer := "02"+strings.Repeat("aa", 32), "02"+strings.Repeat("bb", 32), "02"+strings.Repeat("cc", 32)
+	now := nowUnix()
+	lastReachableAt := map[string]uint64{
+		recentPeer: now - 3600,
+		stalePeer:  now - 90*24*3600,
+		lostPeer:   0,
+	}
+	for pubkey, reachableAt := range lastReachableAt {
+		err = fileServer.StorePublication(peerPublication(&art.Peer{Pubkey: pubkey, Host: "peer.onion", Port: 53545}))
+		if err != nil {
+			t.Fatalf("StorePublication of peer %s error: %v", pubkey, err)
+		}
+		err = fileServer.StorePeerReputation(&art.PeerReputation{Pubkey: pubkey, LastReachableAt: reachableAt})
+		if err != nil {
+			t.Fatalf("StorePeerReputation of peer %s error: %v", pubkey, err)
+		}
+	}
+	// A peer never synced is kept while it was stored recently.
+	fileServer.peers[lostPeer].UpdatedAt = now - 60*24*3600
+
+	prunedPubkeys, err := austkServer.PrunePeers(30 * 24 * time.Hour)
+	if err != nil || !reflect.DeepEqual(prunedPubkeys, []string{stalePeer, lostPeer}) {
+		t.Errorf("expected the stale and lost peers pruned but got %v, error: %v", prunedPubkeys, err)
+	}
+
+	err = austkServer.RemovePeer(mockPubkey)
+	if !errors.Is(err, ErrSelfPeer) {
+		t.Errorf("expected ErrSelfPeer removing this node but got %v", err)
+	}
+	err = austkServer.RemovePeer(stalePeer)
+	if !errors.Is(err, ErrPeerNotFound) {
+		t.Errorf("expected ErrPeerNotFound removing a pruned peer but got %v", err)
+	}
+
+	restartedFileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s) after prune, error: %v", artDir, err)
+	}
+	peers, err := restartedFileServer.Peers()
+	if err != nil {
+		t.Fatalf("Peers error: %v", err)
+	}
+	if peers[recentPeer] == nil || peers[stalePeer] != nil || peers[lostPeer] != nil {
+		t.Errorf("expected only the recent peer of the peers stored after restart but got %v", peers)
+	}
+
+	// The records of a removed peer go with it, even the bandwidth counted and not stored yet.
+	austkServer.bandwidth.record(recentPeer, 1000)
+	austkServer.bandwidth.record(recentPeer, 1000)
+	err = austkServer.RemovePeer(recentPeer)
+	if err != nil {
+		t.Fatalf("RemovePeer error: %v", err)
+	}
+	austkServer.bandwidth.flush()
+	bandwidth, err := fileServer.PeerBandwidth(recentPeer)
+	if err != nil || bandwidth.TotalBytes != 0 {
+		t.Errorf("expected no bandwidth of removed peer but got %v, error: %v", bandwidth, err)
+	}
+	reputation, err := fileServer.PeerReputation(recentPeer)
+	if err != nil || reputation.LastReachableAt != 0 {
+		t.Errorf("expected no reputation of removed peer but got %v, error: %v", reputation, err)
+	}
+}
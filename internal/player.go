@@ -0,0 +1,87 @@
+package audiostrike
+
+import (
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/gorilla/mux"
+)
+
+// playerAssets are the html and js of the web player, served at / to browsers and under /player/.
+//
+//go:embed player
+var playerAssets embed.FS
+
+// PlayerInvoice is the JSON view of an invoice for a track, for web clients that do not decode protobuf.
+type PlayerInvoice struct {
+	ArtistID       string `json:"artistId"`
+	ArtistTrackID  string `json:"artistTrackId"`
+	PaymentRequest string `json:"paymentRequest"`
+	// InvoiceHash is the hex hash of the invoice.
+	InvoiceHash string `json:"invoiceHash"`
+	Sats        uint64 `json:"sats"`
+}
+
+// acceptsHTML reports whether req is from a browser that accepts an html page, rather than from a peer,
+// which requests art at the same urls without an Accept header.
+func acceptsHTML(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "text/html")
+}
+
+// acceptsJSON reports whether req asks for a JSON reply rather than protobuf.
+func acceptsJSON(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "application/json")
+}
+
+// playerAssetsHandler gets the handler serving the embedded web player assets under /player/.
+func playerAssetsHandler() http.Handler {
+	assets, err := fs.Sub(playerAssets, "player")
+	if err != nil {
+		panic(err) // The embedded player directory is always there.
+	}
+	return http.StripPrefix("/player/", http.FileServer(http.FS(assets)))
+}
+
+// handlePlayer routes the web player on httpRouter, ahead of the art that peers get at /.
+func (server *AustkServer) handlePlayer(httpRouter *mux.Router) {
+	httpRouter.HandleFunc("/", server.rateLimited(server.playerHandler)).Methods("GET").MatcherFunc(
+		func(req *http.Request, match *mux.RouteMatch) bool { return acceptsHTML(req) })
+	httpRouter.PathPrefix("/player/").Handler(server.rateLimited(playerAssetsHandler().ServeHTTP)).Methods("GET")
+}
+
+// playerHandler serves the web player page to a browser.
+func (server *AustkServer) playerHandler(w http.ResponseWriter, req *http.Request) {
+	page, err := playerAssets.ReadFile("player/index.html")
+	if err != nil {
+		server.logger.Error("failed to read player page", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(page)
+}
+
+// writeInvoiceJSON replies with invoice as a PlayerInvoice.
+func (server *AustkServer) writeInvoiceJSON(w http.ResponseWriter, invoice *art.Invoice) {
+	responseData, err := json.Marshal(PlayerInvoice{
+		ArtistID:       invoice.ArtistId,
+		ArtistTrackID:  invoice.ArtistTrackId,
+		PaymentRequest: invoice.PaymentRequest,
+		InvoiceHash:    hex.EncodeToString(invoice.InvoiceHash),
+		Sats:           invoice.Sats,
+	})
+	if err != nil {
+		server.logger.Error("failed to marshal invoice", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseData)
+}
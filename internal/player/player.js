@@ -0,0 +1,115 @@
+// The web player lists the tracks at /recent, plays their free previews, and plays a track bought
+// through POST /invoice once the listener pastes the preimage of the paid invoice.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+let adminKey = "";
+let adminKeyType = "token";
+let invoicedTrack = null;
+
+function setStatus(text) {
+  $("status").textContent = text;
+}
+
+function trackPath(track) {
+  return encodeURIComponent(track.artistId) + "/" + encodeURIComponent(track.artistTrackId);
+}
+
+// adminHeaders authenticates an admin request with the -admintoken, or with the hex lnd macaroon
+// if the admin chose that type of key, since a token may be hex too.
+function adminHeaders() {
+  if (adminKeyType === "macaroon") {
+    return { "Grpc-Metadata-Macaroon": adminKey };
+  }
+  return { "Authorization": "Bearer " + adminKey };
+}
+
+async function playTrack(track, preimage) {
+  const headers = preimage ? { "X-Austk-Preimage": preimage } : {};
+  const response = await fetch("/art/" + trackPath(track), { headers });
+  if (!response.ok) {
+    setStatus("failed to get " + track.title + ": " + (await response.text()));
+    return;
+  }
+  const audio = $("audio");
+  if (audio.src.startsWith("blob:")) {
+    URL.revokeObjectURL(audio.src);
+  }
+  audio.src = URL.createObjectURL(await response.blob());
+  audio.play();
+  setStatus("playing " + track.title);
+}
+
+async function buyTrack(track) {
+  const response = await fetch("/invoice/" + trackPath(track), { method: "POST", headers: { "Accept": "application/json" } });
+  if (!response.ok) {
+    setStatus("failed to get an invoice for " + track.title);
+    return;
+  }
+  const invoice = await response.json();
+  invoicedTrack = track;
+  $("payment-request").textContent = invoice.paymentRequest;
+  $("payment-request").href = "lightning:" + invoice.paymentRequest;
+  $("invoice").hidden = false;
+  setStatus("invoiced " + invoice.sats + " sats for " + track.title);
+}
+
+async function deleteTrack(track, item) {
+  if (!confirm("Delete " + track.title + "?")) {
+    return;
+  }
+  const response = await fetch("/art/" + trackPath(track), { method: "DELETE", headers: adminHeaders() });
+  if (response.ok) {
+    item.remove();
+  }
+  setStatus(response.ok ? "deleted " + track.title : "failed to delete " + track.title + ": " + (await response.text()));
+}
+
+function button(label, onClick, className) {
+  const element = document.createElement("button");
+  element.textContent = label;
+  element.onclick = onClick;
+  if (className) {
+    element.className = className;
+  }
+  return element;
+}
+
+async function listTracks() {
+  const response = await fetch("/recent?limit=100");
+  if (!response.ok) {
+    setStatus("failed to list tracks: " + (await response.text()));
+    return;
+  }
+  const catalog = await response.json();
+  for (const track of catalog.tracks) {
+    const item = document.createElement("li");
+    item.textContent = track.artistId + ": " + track.title;
+    if (track.previewSeconds) {
+      item.append(button("Preview", () => {
+        $("audio").src = "/preview/" + trackPath(track);
+        $("audio").play();
+        setStatus("previewing " + track.title);
+      }));
+    }
+    if (track.priceSats > 0) {
+      item.append(button("Buy " + track.priceSats + " sats", () => buyTrack(track)));
+    } else {
+      item.append(button("Play", () => playTrack(track)));
+    }
+    item.append(button("Delete", () => deleteTrack(track, item), "admin"));
+    $("tracks").append(item);
+  }
+}
+
+$("play-paid").onclick = () => {
+  if (invoicedTrack) {
+    playTrack(invoicedTrack, $("preimage").value.trim());
+  }
+};
+$("admin-login").onclick = () => {
+  adminKey = $("admin-key").value.trim();
+  adminKeyType = $("admin-key-type").value;
+  document.body.classList.toggle("is-admin", adminKey !== "");
+};
+listTracks();
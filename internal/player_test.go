@@ -0,0 +1,74 @@
+package audiostrike
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// TestWebPlayer verifies that a browser gets the web player at / while a peer still gets the art there,
+// and that the player's script and a JSON invoice for it are served.
+func TestWebPlayer(t *testing.T) {
+	invoiceCfg := *cfg
+	invoiceCfg.DefaultPrice = 1500
+	mockLightningNode, err := NewMockLightningNode(&invoiceCfg, &mockArtServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(&invoiceCfg, &mockArtServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	testRouter := mux.NewRouter()
+	austkServer.handlePlayer(testRouter)
+	testRouter.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) { w.Write([]byte("art")) }).Methods("GET")
+	testRouter.HandleFunc("/invoice/{artist:[^/]*}/{track:.*}", austkServer.createInvoiceHandler).Methods("POST")
+	testHttpServer := httptest.NewServer(testRouter)
+	defer testHttpServer.Close()
+
+	get := func(path string, accept string) (*http.Response, string) {
+		request, _ := http.NewRequest("GET", testHttpServer.URL+path, nil)
+		if accept != "" {
+			request.Header.Set("Accept", accept)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("GET %s error: %v", path, err)
+		}
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		return response, string(body)
+	}
+	response, body := get("/", "text/html,application/xhtml+xml,*/*;q=0.8")
+	if response.StatusCode != http.StatusOK || !strings.Contains(body, "/player/player.js") {
+		t.Errorf("expected the player page for a browser but got %d: %.80s", response.StatusCode, body)
+	}
+	_, body = get("/", "")
+	if body != "art" {
+		t.Errorf("expected the art for a peer but got %.80s", body)
+	}
+	response, body = get("/player/player.js", "")
+	if response.StatusCode != http.StatusOK || !strings.Contains(body, "/recent") {
+		t.Errorf("expected the player script but got %d: %.80s", response.StatusCode, body)
+	}
+
+	invoiceUrl := fmt.Sprintf("%s/invoice/%s/%s", testHttpServer.URL, mockArtistID, mockTrackID)
+	request, _ := http.NewRequest("POST", invoiceUrl, nil)
+	request.Header.Set("Accept", "application/json")
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("POST %s error: %v", invoiceUrl, err)
+	}
+	defer response.Body.Close()
+	var invoice PlayerInvoice
+	err = json.NewDecoder(response.Body).Decode(&invoice)
+	if err != nil || invoice.Sats != 1500 || invoice.PaymentRequest == "" || invoice.ArtistTrackID != mockTrackID {
+		t.Errorf("expected JSON invoice for 1500 sats but got %+v, error: %v", invoice, err)
+	}
+}
@@ -0,0 +1,92 @@
+package audiostrike
+
+import (
+	"fmt"
+	"strings"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// validatePlaylist checks that playlist has the ids to store it and to find each of its tracks.
+func validatePlaylist(playlist *art.Playlist) error {
+	if playlist.ArtistId == "" || playlist.ArtistPlaylistId == "" {
+		return fmt.Errorf("malformed playlist %v missing artist or playlist id", playlist)
+	}
+	for i, trackReference := range playlist.Tracks {
+		if trackReference.ArtistId == "" || trackReference.ArtistTrackId == "" {
+			return fmt.Errorf("malformed playlist %s/%s missing artist or track id of track %d",
+				playlist.ArtistId, playlist.ArtistPlaylistId, i)
+		}
+	}
+	return nil
+}
+
+// ParseTrackReference parses a reference to a track written as {artist id}/{artist track id},
+// e.g. "aliceinchains/dirt/would" for the track "dirt/would" of the artist "aliceinchains".
+func ParseTrackReference(reference string) (*art.TrackReference, error) {
+	parts := strings.SplitN(reference, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("track reference %q is not {artist id}/{track id}", reference)
+	}
+	return &art.TrackReference{ArtistId: parts[0], ArtistTrackId: parts[1]}, nil
+}
+
+// UnresolvedPlaylistTracks gets the references to tracks of playlist that are not stored in artServer,
+// e.g. tracks of artists not yet synced from their peers.
+func UnresolvedPlaylistTracks(playlist *art.Playlist, artServer ArtServer) ([]*art.TrackReference, error) {
+	var unresolved []*art.TrackReference
+	for _, trackReference := range playlist.Tracks {
+		_, err := artServer.Track(trackReference.ArtistId, trackReference.ArtistTrackId)
+		if err == ErrArtNotFound {
+			unresolved = append(unresolved, trackReference)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return unresolved, nil
+}
+
+// CreatePlaylist stores a playlist titled title of the referenced tracks, in order, curated by this server's
+// artist, then publishes it. The tracks may be by any artists, including tracks not stored here yet,
+// which peers can sync from the nodes of their artists.
+func (server *AustkServer) CreatePlaylist(title string, trackReferences []string) (*art.Playlist, error) {
+	artist, err := server.Artist()
+	if err != nil {
+		server.logger.Error("failed to get artist to curate playlist", "error", err)
+		return nil, err
+	}
+	playlist := &art.Playlist{
+		ArtistId:         artist.ArtistId,
+		ArtistPlaylistId: NameToID(title),
+		Title:            title,
+	}
+	logger := server.logger.With("artist_id", playlist.ArtistId, "playlist_id", playlist.ArtistPlaylistId)
+	for _, reference := range trackReferences {
+		trackReference, err := ParseTrackReference(reference)
+		if err != nil {
+			return nil, err
+		}
+		playlist.Tracks = append(playlist.Tracks, trackReference)
+	}
+
+	unresolved, err := UnresolvedPlaylistTracks(playlist, server.artServer)
+	if err != nil {
+		logger.Error("failed to resolve playlist tracks", "error", err)
+		return nil, err
+	}
+	for _, trackReference := range unresolved {
+		logger.Info("playlist track is not stored yet", "track_artist_id", trackReference.ArtistId,
+			"track_id", trackReference.ArtistTrackId)
+	}
+
+	err = server.artServer.StorePlaylist(playlist, server)
+	if err != nil {
+		logger.Error("failed to store playlist", "error", err)
+		return nil, err
+	}
+	err = server.publish(artist.ArtistId)
+	if err != nil {
+		return nil, err
+	}
+	return playlist, nil
+}
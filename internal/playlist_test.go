@@ -0,0 +1,88 @@
+package audiostrike
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// TestParseTrackReference verifies that the artist id is parsed before the first slash of a track reference,
+// leaving any album hierarchy in the track id.
+func TestParseTrackReference(t *testing.T) {
+	trackReference, err := ParseTrackReference("aliceinchains/dirt/would")
+	if err != nil || trackReference.ArtistId != "aliceinchains" || trackReference.ArtistTrackId != "dirt/would" {
+		t.Errorf("expected track dirt/would of aliceinchains but got %v, error: %v", trackReference, err)
+	}
+	for _, reference := range []string{"", "would", "/would", "aliceinchains/"} {
+		_, err = ParseTrackReference(reference)
+		if err == nil {
+			t.Errorf("expected error parsing track reference %q", reference)
+		}
+	}
+}
+
+// TestCreatePlaylist verifies that a playlist is stored and published with its tracks in order,
+// including tracks of other artists not stored yet.
+func TestCreatePlaylist(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	err = fileServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	err = fileServer.StoreTrack(&art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID}, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+
+	_, err = austkServer.CreatePlaylist("Mixtape", []string{"not a reference"})
+	if err == nil {
+		t.Errorf("expected error creating playlist with malformed track reference")
+	}
+	playlist, err := austkServer.CreatePlaylist("Mixtape!", []string{"otherartist/othertrack", mockArtistID + "/" + mockTrackID})
+	if err != nil {
+		t.Fatalf("CreatePlaylist error: %v", err)
+	}
+	if playlist.ArtistId != mockArtistID || playlist.ArtistPlaylistId != "mixtape" || len(playlist.Tracks) != 2 {
+		t.Errorf("expected playlist mixtape of 2 tracks curated by %s but got %v", mockArtistID, playlist)
+	}
+	unresolved, err := UnresolvedPlaylistTracks(playlist, fileServer)
+	if err != nil || len(unresolved) != 1 || unresolved[0].ArtistId != "otherartist" {
+		t.Errorf("expected track of otherartist unresolved but got %v, error: %v", unresolved, err)
+	}
+
+	resources, err := austkServer.CollectResources()
+	if err != nil {
+		t.Fatalf("CollectResources error: %v", err)
+	}
+	if len(resources.Playlists) != 1 || resources.Playlists[0].Tracks[1].ArtistTrackId != mockTrackID {
+		t.Errorf("expected published playlist but got %v", resources.Playlists)
+	}
+
+	// The playlist is read again from the published art.
+	fileServer, err = NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s) again, error: %v", artDir, err)
+	}
+	storedPlaylist, err := fileServer.Playlist(mockArtistID, "mixtape")
+	if err != nil || len(storedPlaylist.Tracks) != 2 || storedPlaylist.Tracks[0].ArtistId != "otherartist" {
+		t.Errorf("expected playlist read from published art but got %v, error: %v", storedPlaylist, err)
+	}
+}
@@ -0,0 +1,237 @@
+package audiostrike
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// previewMime is the mime type of the preview clips, which are 16-bit pcm wav files.
+	previewMime = "audio/wav"
+	// wavFormatPcm is the audio format in the fmt chunk of a wav file of uncompressed samples.
+	wavFormatPcm = 1
+	// maxPreviewShare is the inverse of the most of a track its preview clips,
+	// so a track shorter than the preview seconds is not served whole for free.
+	maxPreviewShare = 3
+)
+
+// wavFormat is the length and content of the fmt chunk of a wav file.
+type wavFormat struct {
+	ChunkLength   uint32
+	AudioFormat   uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32 // bytes per second
+	BlockAlign    uint16 // bytes per sample of all channels
+	BitsPerSample uint16
+}
+
+// PreviewClip decodes up to the first seconds of audio and encodes them as a 16-bit pcm wav clip,
+// which any client can play without decoding the container of the track.
+// The clip is at most a third of the track, as long as the decoder knows the track's length.
+// It returns the clip and its length in whole seconds, less than seconds for a shorter track.
+func PreviewClip(audio AudioFile, seconds uint32) ([]byte, uint32, error) {
+	streamer, format, err := audio.Decode()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer streamer.Close()
+	if format.SampleRate <= 0 || format.NumChannels < 1 || format.NumChannels > 2 {
+		return nil, 0, fmt.Errorf("cannot clip %d channels at %d Hz", format.NumChannels, format.SampleRate)
+	}
+
+	remaining := int(format.SampleRate) * int(seconds)
+	if length := streamer.Len(); length > 0 && remaining > length/maxPreviewShare {
+		remaining = length / maxPreviewShare
+	}
+	clip := make([][2]float64, 0, remaining)
+	samples := make([][2]float64, 4096)
+	for remaining > 0 {
+		if remaining < len(samples) {
+			samples = samples[:remaining]
+		}
+		n, ok := streamer.Stream(samples)
+		clip = append(clip, samples[:n]...)
+		remaining -= n
+		if !ok {
+			break
+		}
+	}
+	err = streamer.Err()
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(clip) == 0 {
+		return nil, 0, fmt.Errorf("no audio to clip in %s", audio.Title())
+	}
+	clipSeconds := uint32((len(clip) + int(format.SampleRate) - 1) / int(format.SampleRate))
+	return encodeWav(clip, int(format.SampleRate), format.NumChannels), clipSeconds, nil
+}
+
+// encodeWav encodes samples, each with a left and right value from -1 to 1, as a 16-bit pcm wav file
+// of sampleRate samples per second. A mono file has the left value of each sample.
+func encodeWav(samples [][2]float64, sampleRate int, channels int) []byte {
+	const bytesPerValue = 2
+	dataLength := len(samples) * channels * bytesPerValue
+	var wav bytes.Buffer
+	wav.WriteString(riffMagic)
+	binary.Write(&wav, binary.LittleEndian, uint32(4+8+16+8+dataLength))
+	wav.WriteString(waveMagic)
+	wav.WriteString("fmt ")
+	binary.Write(&wav, binary.LittleEndian, wavFormat{
+		ChunkLength:   16,
+		AudioFormat:   wavFormatPcm,
+		Channels:      uint16(channels),
+		SampleRate:    uint32(sampleRate),
+		ByteRate:      uint32(sampleRate * channels * bytesPerValue),
+		BlockAlign:    uint16(channels * bytesPerValue),
+		BitsPerSample: 8 * bytesPerValue,
+	})
+	wav.WriteString("data")
+	binary.Write(&wav, binary.LittleEndian, uint32(dataLength))
+	for _, sample := range samples {
+		for channel := 0; channel < channels; channel++ {
+			value := math.Max(-1, math.Min(1, sample[channel]))
+			binary.Write(&wav, binary.LittleEndian, int16(math.Round(value*math.MaxInt16)))
+		}
+	}
+	return wav.Bytes()
+}
+
+// previewPath gets the path under rootPath of the file with the preview clip of track, beside its art.
+// It has no container extension, so it is never mistaken for a payload file.
+func previewPath(rootPath string, track *art.Track) string {
+	return filepath.Join(rootPath, track.ArtistId, track.ArtistTrackId+".preview")
+}
+
+// readPreviewFile reads the preview clip of track stored under rootPath,
+// returning ErrArtNotFound if the track has no preview or its clip is not stored.
+func readPreviewFile(rootPath string, track *art.Track) ([]byte, error) {
+	if track.PreviewSeconds == 0 {
+		return nil, ErrArtNotFound
+	}
+	preview, err := ioutil.ReadFile(previewPath(rootPath, track))
+	if os.IsNotExist(err) {
+		return nil, ErrArtNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
+// setTrackPreview records the length and hash of the preview clip on track,
+// stamping the track updated now if they changed. It returns whether they changed.
+func setTrackPreview(track *art.Track, preview []byte, seconds uint32) bool {
+	previewHash := sha256.Sum256(preview)
+	if track.PreviewSeconds == seconds && bytes.Equal(track.PreviewSha256, previewHash[:]) {
+		return false
+	}
+	track.PreviewSeconds = seconds
+	track.PreviewSha256 = previewHash[:]
+	track.UpdatedAt = nowUnix()
+	return true
+}
+
+// storePreview clips the first -preview seconds of audio and stores the clip as the preview of the stored track,
+// recording its length and hash on track.
+func (server *AustkServer) storePreview(track *art.Track, audio AudioFile) error {
+	preview, seconds, err := PreviewClip(audio, server.config.PreviewSeconds)
+	if err != nil {
+		return err
+	}
+	track.PreviewSeconds = seconds
+	return server.artServer.StoreTrackPreview(track, preview)
+}
+
+// RegeneratePreviews clips the preview of each stored track of the artists this node publishes again,
+// e.g. for tracks added before previews were clipped or to change their length with -preview,
+// then publishes the tracks whose preview changed. Tracks whose payload cannot be decoded are logged and skipped.
+// It returns the number of tracks whose preview changed.
+func (server *AustkServer) RegeneratePreviews() (int, error) {
+	if server.config.PreviewSeconds == 0 {
+		return 0, fmt.Errorf("no -preview seconds to clip")
+	}
+	artists, err := server.artServer.Artists()
+	if err != nil {
+		server.logger.Error("failed to get artists", "error", err)
+		return 0, err
+	}
+
+	regenerated := 0
+	signingArtistIDs := make(map[string]bool)
+	for artistID, artist := range artists {
+		if _, err := server.PublishingArtist(artistID); err != nil && artist.Pubkey != "" {
+			continue // to next artist, whose own node clips its previews
+		}
+		tracks, err := server.artServer.Tracks(artistID)
+		if err != nil {
+			server.logger.Error("failed to get tracks", "artist_id", artistID, "error", err)
+			return regenerated, err
+		}
+		for _, track := range tracks {
+			logger := server.logger.With("artist_id", artistID, "track_id", track.ArtistTrackId)
+			audio, closeAudio, err := OpenTrackAudio(server.artServer, track)
+			if err != nil {
+				logger.Warn("skip track whose payload cannot be opened", "error", err)
+				continue // to next track
+			}
+			clippedTrack := proto.Clone(track).(*art.Track)
+			err = server.storePreview(clippedTrack, audio)
+			closeAudio()
+			if err != nil {
+				logger.Warn("skip track whose preview cannot be clipped", "error", err)
+				continue // to next track
+			}
+			if clippedTrack.PreviewSeconds == track.PreviewSeconds &&
+				bytes.Equal(clippedTrack.PreviewSha256, track.PreviewSha256) {
+				continue // to next track, whose preview is unchanged
+			}
+			logger.Info("regenerated track preview", "seconds", clippedTrack.PreviewSeconds)
+			regenerated++
+			signingArtistIDs[server.signingArtistID(artistID)] = true
+		}
+	}
+
+	for artistID := range signingArtistIDs {
+		err = server.publish(artistID)
+		if err != nil {
+			return regenerated, err
+		}
+	}
+	return regenerated, nil
+}
+
+// previewHandler handles requests for the preview clip of a track by a specified artist.
+// Previews are served free, for clients to hear tracks before buying them.
+func (server *AustkServer) previewHandler(w http.ResponseWriter, req *http.Request) {
+	artistID := mux.Vars(req)["artist"]
+	artistTrackID := mux.Vars(req)["track"]
+	logger := server.logger.With("artist_id", artistID, "track_id", artistTrackID)
+
+	preview, err := server.artServer.TrackPreview(artistID, artistTrackID)
+	if err == ErrArtNotFound {
+		logger.Info("no track preview to get")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		logger.Error("failed to get track preview", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	logger.Debug("serve track preview", "bytes", len(preview), "range", req.Header.Get("Range"))
+	w.Header().Set("Content-Type", previewMime)
+	http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(preview))
+}
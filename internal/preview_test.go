@@ -0,0 +1,90 @@
+package audiostrike
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/gorilla/mux"
+)
+
+// TestPreviewClip verifies that the preview of audio is a 16-bit pcm wav file of its first seconds,
+// or of a third of it if shorter.
+func TestPreviewClip(t *testing.T) {
+	tests := []struct {
+		name            string
+		channels        int
+		length          int
+		expectedSeconds uint32
+		expectedSamples int
+	}{
+		{"clipped mono", 1, 7 * 8000, 2, 2 * 8000},
+		{"shorter stereo", 2, 12000, 1, 4000},
+	}
+	for _, test := range tests {
+		audio := sineAudio{frequency: 440, amplitude: 0.5, sampleRate: 8000, channels: test.channels, length: test.length}
+		clip, seconds, err := PreviewClip(audio, 2)
+		if err != nil {
+			t.Fatalf("%s: PreviewClip error: %v", test.name, err)
+		}
+		if seconds != test.expectedSeconds {
+			t.Errorf("%s: expected %d second clip but got %d", test.name, test.expectedSeconds, seconds)
+		}
+		dataLength := test.expectedSamples * test.channels * 2
+		if len(clip) != 44+dataLength || string(clip[:4]) != riffMagic || string(clip[8:12]) != waveMagic {
+			t.Errorf("%s: expected %d byte wav file but got %d bytes starting %q", test.name, 44+dataLength, len(clip), clip[:12])
+			continue
+		}
+		var format wavFormat
+		binary.Read(bytes.NewReader(clip[16:36]), binary.LittleEndian, &format)
+		if format.AudioFormat != wavFormatPcm || int(format.Channels) != test.channels ||
+			format.SampleRate != 8000 || format.BitsPerSample != 16 {
+			t.Errorf("%s: expected 16-bit pcm at 8000 Hz but got %+v", test.name, format)
+		}
+	}
+}
+
+// TestPreviewHandler verifies that the preview of a track is served free, and that a track without one is not found.
+func TestPreviewHandler(t *testing.T) {
+	artServer := NewMemoryArtServer()
+	austkServer, err := NewAustkServer(cfg, artServer, &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	for _, trackID := range []string{"previewed", "unpreviewed"} {
+		err = artServer.StoreTrack(&art.Track{ArtistId: mockArtistID, ArtistTrackId: trackID, Price: &art.Price{Sats: 1000}},
+			&mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreTrack error: %v", err)
+		}
+	}
+	err = artServer.StoreTrackPreview(&art.Track{ArtistId: mockArtistID, ArtistTrackId: "previewed", PreviewSeconds: 30},
+		[]byte("preview clip"))
+	if err != nil {
+		t.Fatalf("StoreTrackPreview error: %v", err)
+	}
+
+	testRouter := mux.NewRouter()
+	testRouter.HandleFunc("/preview/{artist:[^/]*}/{track:.*}", austkServer.previewHandler).Methods("GET")
+	testHttpServer := httptest.NewServer(testRouter)
+	defer testHttpServer.Close()
+
+	response, err := http.Get(testHttpServer.URL + "/preview/" + mockArtistID + "/previewed")
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("expected preview of priced track served free but got %v, error: %v", response, err)
+	}
+	defer response.Body.Close()
+	clip, err := ioutil.ReadAll(response.Body)
+	if err != nil || string(clip) != "preview clip" || response.Header.Get("Content-Type") != previewMime {
+		t.Errorf("expected %s preview clip but got %s %q, error: %v", previewMime, response.Header.Get("Content-Type"), clip, err)
+	}
+
+	response, err = http.Get(testHttpServer.URL + "/preview/" + mockArtistID + "/unpreviewed")
+	if err != nil || response.StatusCode != http.StatusNotFound {
+		t.Errorf("expected no preview of track without one but got %v, error: %v", response, err)
+	}
+}
@@ -0,0 +1,206 @@
+package audiostrike
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ProtocolVersion is the version of the sync protocol this node speaks.
+	// Version 0 is that of nodes from before the handshake, which serve all their art from GET /.
+	ProtocolVersion = 1
+	// minProtocolVersion is the oldest version of the sync protocol this node still speaks with peers.
+	minProtocolVersion = 0
+	// maxHandshakeBytes limits the handshake a peer may send.
+	maxHandshakeBytes = 4096
+)
+
+// Features of the sync protocol that a node may support, negotiated by the Handshake.
+const (
+	// FeatureDeltaSync serves only the art updated since the ?since time of a client's last sync.
+	FeatureDeltaSync = "delta_sync"
+	// FeatureScopedSync serves only the art of an ?artist, or of one of its albums, when asked.
+	FeatureScopedSync = "scoped_sync"
+	// FeatureResumeDownload serves the rest of a track from a Range start with PrefixChecksumHeader.
+	FeatureResumeDownload = "resume_download"
+	// FeatureStream sells tracks in chunks from /stream.
+	FeatureStream = "stream"
+	// FeatureArtistPublications lists the publication of each hosted artist at /publications
+	// and serves each one, signed by its artist, from /publication/{artist}.
+	FeatureArtistPublications = "artist_publications"
+	// FeatureAlbumInvoice sells all the tracks of an album with one invoice from /albuminvoice.
+	FeatureAlbumInvoice = "album_invoice"
+)
+
+// supportedFeatures are the features this node supports, in the order it prefers them.
+// CompressionGzip and CompressionZstd as features compress the art served from GET / in that codec.
+var supportedFeatures = []string{FeatureDeltaSync, FeatureScopedSync, FeatureResumeDownload, FeatureStream,
+	FeatureArtistPublications, FeatureAlbumInvoice, CompressionGzip, CompressionZstd}
+
+// Handshake is the sync protocol a node speaks: the newest version, the oldest it still speaks, and its features.
+// A client posts its own to /handshake at the start of a sync, the peer replies with its own,
+// and each negotiates the protocol they have in common.
+type Handshake struct {
+	ProtocolVersion    int      `json:"protocol_version"`
+	MinProtocolVersion int      `json:"min_protocol_version"`
+	Features           []string `json:"features"`
+	// Private is set by a node that serves only allowed peers, each proving its pubkey
+	// by signing a challenge from /challenge.
+	Private bool `json:"private,omitempty"`
+}
+
+// legacyHandshake is the protocol of a peer from before the handshake, which cannot be relied on
+// for any optional feature.
+var legacyHandshake = Handshake{}
+
+// localHandshake is the protocol this node speaks.
+func localHandshake() *Handshake {
+	return &Handshake{
+		ProtocolVersion:    ProtocolVersion,
+		MinProtocolVersion: minProtocolVersion,
+		Features:           append([]string(nil), supportedFeatures...),
+	}
+}
+
+// negotiate gets the protocol that nodes speaking local and peer have in common:
+// the older of their versions and the features both support.
+// It fails with ErrIncompatiblePeer if either no longer speaks the other's version.
+func negotiate(local *Handshake, peer *Handshake) (*Handshake, error) {
+	version := local.ProtocolVersion
+	if peer.ProtocolVersion < version {
+		version = peer.ProtocolVersion
+	}
+	if version < local.MinProtocolVersion || version < peer.MinProtocolVersion {
+		return nil, fmt.Errorf("%w: protocol versions %d-%d and %d-%d have none in common",
+			ErrIncompatiblePeer, local.MinProtocolVersion, local.ProtocolVersion,
+			peer.MinProtocolVersion, peer.ProtocolVersion)
+	}
+	negotiated := &Handshake{ProtocolVersion: version, MinProtocolVersion: version}
+	for _, feature := range local.Features {
+		if peer.Supports(feature) {
+			negotiated.Features = append(negotiated.Features, feature)
+		}
+	}
+	return negotiated, nil
+}
+
+// Supports checks whether the protocol of handshake has feature.
+func (handshake *Handshake) Supports(feature string) bool {
+	for _, supported := range handshake.Features {
+		if supported == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// handshakeHandler handles a client's handshake by replying with this node's own,
+// or 426 Upgrade Required if they speak no version of the protocol in common.
+func (server *AustkServer) handshakeHandler(w http.ResponseWriter, req *http.Request) {
+	clientHandshake := Handshake{}
+	err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxHandshakeBytes)).Decode(&clientHandshake)
+	if err != nil {
+		http.Error(w, "malformed handshake: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	local := localHandshake()
+	negotiated, err := negotiate(local, &clientHandshake)
+	if err != nil {
+		server.logger.Info("refuse handshake", "peer", req.Header.Get(PubkeyHeader), "error", err)
+		http.Error(w, err.Error(), http.StatusUpgradeRequired)
+		return
+	}
+	server.logger.Debug("negotiated protocol", "peer", req.Header.Get(PubkeyHeader),
+		"protocol_version", negotiated.ProtocolVersion, "features", negotiated.Features)
+	local.Private = server.peerAuthenticator != nil
+	responseData, err := json.Marshal(local)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseData)
+}
+
+// Handshake negotiates the sync protocol with the client's peer, once for the client's session,
+// and gets the protocol they have in common.
+// A peer from before the handshake is taken to speak protocol version 0 without optional features.
+// The client proves its pubkey to a private peer by signing the peer's challenge.
+// It fails with an error wrapping ErrIncompatiblePeer if they speak no version in common.
+func (client *Client) Handshake() (*Handshake, error) {
+	if client.protocol != nil {
+		return client.protocol, nil
+	}
+	local := localHandshake()
+	peerHandshake, err := client.postHandshake(local)
+	if err != nil {
+		return nil, err
+	}
+	negotiated, err := negotiate(local, peerHandshake)
+	if err != nil {
+		client.logger.Warn("refuse peer", "error", err)
+		return nil, err
+	}
+	client.logger.Debug("negotiated protocol",
+		"protocol_version", negotiated.ProtocolVersion, "features", negotiated.Features)
+	if peerHandshake.Private {
+		err = client.authenticate()
+		if err != nil {
+			client.logger.Warn("failed to prove pubkey to private peer", "error", err)
+			return nil, err
+		}
+	}
+	client.protocol = negotiated
+	return negotiated, nil
+}
+
+// postHandshake posts handshake to the client's peer and gets the peer's own.
+func (client *Client) postHandshake(handshake *Handshake) (*Handshake, error) {
+	handshakeURL := "http://" + client.peerAddress + "/handshake"
+	requestData, err := json.Marshal(handshake)
+	if err != nil {
+		return nil, err
+	}
+	request, err := client.newRequest("POST", handshakeURL)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Body = ioutil.NopCloser(bytes.NewReader(requestData))
+	request.ContentLength = int64(len(requestData))
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		client.logger.Warn("failed to handshake", "url", handshakeURL, "route", client.route(), "error", err)
+		return nil, client.connectionError(handshakeURL, err)
+	}
+	defer response.Body.Close()
+	replyBytes, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	isJSON := strings.HasPrefix(response.Header.Get("Content-Type"), "application/json")
+	switch {
+	case response.StatusCode == http.StatusUpgradeRequired:
+		return nil, fmt.Errorf("%w: peer %s refused handshake: %s",
+			ErrIncompatiblePeer, client.peerAddress, strings.TrimSpace(string(replyBytes)))
+	case response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusMethodNotAllowed ||
+		response.StatusCode == http.StatusOK && !isJSON:
+		// A peer from before the handshake has no /handshake, or may answer it with its art.
+		client.logger.Info("peer does not handshake, so sync without optional features", "status", response.StatusCode)
+		peerHandshake := legacyHandshake
+		return &peerHandshake, nil
+	case response.StatusCode != http.StatusOK:
+		return nil, client.replyError(response, replyBytes)
+	}
+	peerHandshake := Handshake{}
+	err = json.Unmarshal(replyBytes, &peerHandshake)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed handshake from peer %s: %v", ErrIncompatiblePeer, client.peerAddress, err)
+	}
+	return &peerHandshake, nil
+}
@@ -0,0 +1,67 @@
+package audiostrike
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestHandshake verifies that a client negotiates the protocol and features it has in common with its peer,
+// once for the session, that a peer from before the handshake is taken to speak version 0 without features,
+// and that nodes speaking no version in common refuse each other with ErrIncompatiblePeer.
+func TestHandshake(t *testing.T) {
+	austkServer, err := NewAustkServer(cfg, NewMemoryArtServer(), &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	handshakes := 0
+	testHttpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handshakes++
+		austkServer.handshakeHandler(w, req)
+	}))
+	defer testHttpServer.Close()
+	testUrl, _ := url.Parse(testHttpServer.URL)
+	client, err := NewClient(context.Background(), TorProxyDisabled, testUrl.Host, &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	defer client.CloseConnection()
+
+	for i := 0; i < 2; i++ {
+		protocol, err := client.Handshake()
+		if err != nil || protocol.ProtocolVersion != ProtocolVersion || !protocol.Supports(FeatureDeltaSync) {
+			t.Errorf("expected protocol %d with delta sync but got %v, error: %v", ProtocolVersion, protocol, err)
+		}
+	}
+	if handshakes != 1 {
+		t.Errorf("expected one handshake for the session but got %d", handshakes)
+	}
+
+	legacyHttpServer := httptest.NewServer(http.NotFoundHandler())
+	defer legacyHttpServer.Close()
+	legacyUrl, _ := url.Parse(legacyHttpServer.URL)
+	legacyClient, err := NewClient(context.Background(), TorProxyDisabled, legacyUrl.Host, &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewClient error: %v", err)
+	}
+	defer legacyClient.CloseConnection()
+	protocol, err := legacyClient.Handshake()
+	if err != nil || protocol.ProtocolVersion != 0 || len(protocol.Features) != 0 {
+		t.Errorf("expected protocol 0 without features for a legacy peer but got %v, error: %v", protocol, err)
+	}
+
+	futureHandshake := `{"protocol_version": 9, "min_protocol_version": 8, "features": ["teleport"]}`
+	recorder := httptest.NewRecorder()
+	austkServer.handshakeHandler(recorder, httptest.NewRequest("POST", "/handshake", strings.NewReader(futureHandshake)))
+	if recorder.Code != http.StatusUpgradeRequired {
+		t.Errorf("expected 426 for a client speaking only a newer protocol but got %d", recorder.Code)
+	}
+	_, err = negotiate(localHandshake(), &Handshake{ProtocolVersion: 9, MinProtocolVersion: 8})
+	if !errors.Is(err, ErrIncompatiblePeer) {
+		t.Errorf("expected ErrIncompatiblePeer but got %v", err)
+	}
+}
@@ -0,0 +1,751 @@
+package audiostrike
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/mux"
+)
+
+// publicationCacheSize is how many signed publications a publicationCache keeps.
+const publicationCacheSize = 64
+
+// publicationCache keeps the publications signed recently, by the signing artist and the hash of the resources
+// marshaled to sign, so the same art is signed by lnd only once. Any Store or Delete that changes the art
+// changes the hash of the resources collected after it, so a cached publication never publishes stale art,
+// and the publication of the art before the change is evicted in time. It is safe for concurrent use.
+type publicationCache struct {
+	mutex        sync.Mutex
+	publications map[publicationKey]*art.ArtistPublication
+	// keys are the keys of the cached publications, oldest first, to evict the oldest when full.
+	keys []publicationKey
+}
+
+// publicationKey names the publication by artistID of the resources whose marshaled bytes have resourcesHash.
+type publicationKey struct {
+	artistID      string
+	resourcesHash [sha256.Size]byte
+}
+
+func newPublicationCache() *publicationCache {
+	return &publicationCache{publications: make(map[publicationKey]*art.ArtistPublication)}
+}
+
+// get gets the cached publication with key, or nil if none is cached.
+func (cache *publicationCache) get(key publicationKey) *art.ArtistPublication {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.publications[key]
+}
+
+// put caches publication with key, evicting the oldest cached publication if full.
+func (cache *publicationCache) put(key publicationKey, publication *art.ArtistPublication) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.publications[key] != nil {
+		return
+	}
+	if len(cache.keys) >= publicationCacheSize {
+		delete(cache.publications, cache.keys[0])
+		cache.keys = cache.keys[1:]
+	}
+	cache.publications[key] = publication
+	cache.keys = append(cache.keys, key)
+}
+
+// clear drops all the cached publications, e.g. those signed with a key since rotated.
+func (cache *publicationCache) clear() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.publications = make(map[publicationKey]*art.ArtistPublication)
+	cache.keys = nil
+}
+
+// publishedSequenceKey is the key, which is no pubkey, under which a node stores the latest Sequence
+// it stamped on the resources it publishes.
+const publishedSequenceKey = ""
+
+// publicationSequencer stamps the resources a node publishes with a Sequence that increases whenever
+// they change but stays the same while they do not, so the same art is still signed only once.
+// The sequence is the Unix time in nanoseconds when the change was first published, or one more than
+// the previous sequence if the clock has not advanced past it, even across restarts, since the latest
+// sequence is stored. Its zero value is ready to use, and it is safe for concurrent use.
+type publicationSequencer struct {
+	mutex         sync.Mutex
+	resourcesHash [sha256.Size]byte
+	sequence      uint64
+	isLoaded      bool
+}
+
+// stamp sets the Sequence of all the resources a node publishes, before they are narrowed to any artist,
+// scope, or since time, so that every publication of the same art has the same sequence.
+// It stores each new sequence in artServer before stamping it.
+func (sequencer *publicationSequencer) stamp(resources *art.ArtResources, artServer ArtServer) error {
+	resources.Sequence = 0
+	resourceBytes, err := prepareForSigning(resources)
+	if err != nil {
+		return err
+	}
+	resourcesHash := sha256.Sum256(resourceBytes)
+
+	sequencer.mutex.Lock()
+	defer sequencer.mutex.Unlock()
+	if !sequencer.isLoaded {
+		sequencer.sequence, err = artServer.PublicationSequence(publishedSequenceKey)
+		if err != nil {
+			return err
+		}
+		sequencer.isLoaded = true
+	}
+	if sequencer.resourcesHash == ([sha256.Size]byte{}) || resourcesHash != sequencer.resourcesHash {
+		sequence := uint64(time.Now().UnixNano())
+		if sequence <= sequencer.sequence {
+			sequence = sequencer.sequence + 1
+		}
+		err = artServer.StorePublicationSequence(publishedSequenceKey, sequence)
+		if err != nil {
+			return err
+		}
+		sequencer.sequence = sequence
+		sequencer.resourcesHash = resourcesHash
+	}
+	resources.Sequence = sequencer.sequence
+	return nil
+}
+
+// checkSequence refuses, with ErrPublicationStale, a publication signed by pubkey whose sequence is older than
+// the latest validated from pubkey, e.g. one replayed by a relay to hide a later takedown.
+// Otherwise it stores the sequence as the latest from pubkey.
+func (server *AustkServer) checkSequence(pubkey string, sequence uint64) error {
+	server.sequenceMutex.Lock()
+	defer server.sequenceMutex.Unlock()
+	latest, err := server.artServer.PublicationSequence(pubkey)
+	if err != nil {
+		server.logger.Error("failed to get publication sequence", "pubkey", pubkey, "error", err)
+		return err
+	}
+	if sequence < latest {
+		return fmt.Errorf("%w: sequence %d of publication by %s is older than %d", ErrPublicationStale, sequence, pubkey, latest)
+	}
+	if sequence > latest {
+		return server.artServer.StorePublicationSequence(pubkey, sequence)
+	}
+	return nil
+}
+
+// PublicationListing lists a publication that a node serves from /publication/{artist}, for a client to pick
+// from /publications which artists to sync.
+type PublicationListing struct {
+	ArtistID string `json:"artistId"`
+	Pubkey   string `json:"pubkey"`
+	// AsOf is the latest update of the artist's art: the AsOf of its publication served without ?since.
+	AsOf uint64 `json:"asOf"`
+}
+
+// ArtistPublication collects the art of the hosted artist with artistID and signs it as that artist,
+// so a change to the art of one artist re-signs only that artist's publication.
+// The publication of this node's own artist also lists the node's peers.
+// If since is nonzero and not after the latest update of the art, the publication has only the art updated since.
+// It returns an error wrapping ErrArtNotFound if this server does not host the artist.
+func (server *AustkServer) ArtistPublication(ctx context.Context, artistID string, since uint64) (*art.ArtistPublication, *art.ArtResources, error) {
+	resources, err := server.CollectResources()
+	if err != nil {
+		server.logger.Error("failed to collect resources", "artist_id", artistID, "error", err)
+		return nil, nil, err
+	}
+	resources = artistResources(resources, artistID, artistID == server.config.ArtistID)
+	resources.AsOf = latestUpdate(resources)
+	if since > 0 && since <= resources.AsOf {
+		resources = resourcesSince(resources, since)
+	}
+	publication, err := server.Sign(ctx, artistID, resources)
+	if err != nil {
+		return nil, nil, err
+	}
+	return publication, resources, nil
+}
+
+// Publications lists the publication of each artist hosted by this server, ordered by artist id.
+func (server *AustkServer) Publications() ([]PublicationListing, error) {
+	resources, err := server.CollectResources()
+	if err != nil {
+		server.logger.Error("failed to collect resources", "error", err)
+		return nil, err
+	}
+	listings := make([]PublicationListing, 0, len(resources.Artists))
+	for _, artist := range resources.Artists {
+		published := artistResources(resources, artist.ArtistId, artist.ArtistId == server.config.ArtistID)
+		listings = append(listings, PublicationListing{
+			ArtistID: artist.ArtistId,
+			Pubkey:   artist.Pubkey,
+			AsOf:     latestUpdate(published),
+		})
+	}
+	return listings, nil
+}
+
+// publicationsHandler lists the publications this node serves, as json.
+func (server *AustkServer) publicationsHandler(w http.ResponseWriter, req *http.Request) {
+	listings, err := server.Publications()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	responseData, err := json.Marshal(listings)
+	if err != nil {
+		server.logger.Error("failed to marshal publications", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseData)
+}
+
+// artistPublicationHandler serves the publication of a hosted artist, with only the art updated
+// since the ?since time of the client's last sync of that artist, if set.
+func (server *AustkServer) artistPublicationHandler(w http.ResponseWriter, req *http.Request) {
+	artistID := mux.Vars(req)["artist"]
+	since, err := sinceParam(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	publication, _, err := server.ArtistPublication(req.Context(), artistID, since)
+	if errors.Is(err, ErrArtNotFound) {
+		server.logger.Info("no publication of requested artist", "artist_id", artistID)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		server.logger.Error("failed to sign artist publication", "artist_id", artistID, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	responseData, err := proto.Marshal(publication)
+	if err != nil {
+		server.logger.Error("failed to marshal publication", "artist_id", artistID, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	server.writeCompressed(w, req, responseData)
+}
+
+// rotatablePublisher is a Publisher that can sign as its hosted artists with a rotated key, e.g. a LightningNode.
+type rotatablePublisher interface {
+	// RefreshPubkey gets the current pubkey of the publisher's key.
+	RefreshPubkey(ctx context.Context) (string, error)
+	// UpdatePublishingArtist replaces the hosted artist with the id of artist.
+	UpdatePublishingArtist(artist *art.Artist) error
+}
+
+// pubkeyLinkMessage is the message that the old pubkey of an artist signs to link it to newPubkey,
+// so peers that stored the artist with oldPubkey accept art signed with newPubkey after the key is rotated.
+func pubkeyLinkMessage(oldPubkey string, newPubkey string) []byte {
+	return []byte("austk-pubkey-link/1\n" + oldPubkey + "\n" + newPubkey)
+}
+
+// LinkPubkey signs, with lnd's current identity key, the link from its pubkey to newPubkey,
+// e.g. the pubkey of the lnd node to rotate to, for ResignPublications on that node to publish.
+// It gets the link signature.
+func (server *AustkServer) LinkPubkey(newPubkey string) (string, error) {
+	pubkey, err := server.Pubkey(server.ctx)
+	if err != nil {
+		server.logger.Error("failed to get pubkey from lnd", "error", err)
+		return "", err
+	}
+	if newPubkey == pubkey {
+		return "", fmt.Errorf("pubkey %s is lnd's current pubkey, so link it from the node with the old key", newPubkey)
+	}
+	return server.SignMessage(server.ctx, pubkeyLinkMessage(pubkey, newPubkey))
+}
+
+// checkPubkeyLink checks that the artist of publication, if stored in localStorage with a pubkey,
+// still publishes with that pubkey or with a new pubkey linked from it by the signature of the old one,
+// so no one else takes over the artist by publishing it with their own pubkey.
+// It returns an error wrapping ErrPubkeyMismatch otherwise.
+func checkPubkeyLink(ctx context.Context, verifier Publisher, publication *art.ArtistPublication, localStorage ArtServer) error {
+	artist := publication.Artist
+	storedArtist, err := localStorage.Artist(artist.ArtistId)
+	if err == ErrArtNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if storedArtist.Pubkey == "" || storedArtist.Pubkey == artist.Pubkey {
+		return nil
+	}
+	if artist.PreviousPubkey != storedArtist.Pubkey || artist.PubkeyLinkSignature == "" {
+		return fmt.Errorf("%w: artist %s is stored with pubkey %s, not linked to its published pubkey %s",
+			ErrPubkeyMismatch, artist.ArtistId, storedArtist.Pubkey, artist.Pubkey)
+	}
+	signerPubkey, err := verifier.VerifyMessage(ctx, pubkeyLinkMessage(artist.PreviousPubkey, artist.Pubkey),
+		artist.PubkeyLinkSignature)
+	if err != nil {
+		return fmt.Errorf("%w: invalid link from pubkey %s to %s of artist %s: %v",
+			ErrPubkeyMismatch, artist.PreviousPubkey, artist.Pubkey, artist.ArtistId, err)
+	}
+	if signerPubkey != artist.PreviousPubkey {
+		return fmt.Errorf("%w: link to pubkey %s of artist %s is signed by %s, not %s",
+			ErrPubkeyMismatch, artist.Pubkey, artist.ArtistId, signerPubkey, artist.PreviousPubkey)
+	}
+	return nil
+}
+
+// ResignPublications publishes the art of each hosted artist again, signed with lnd's current identity key,
+// e.g. after the key is rotated and the publications signed with the old key no longer pass ValidatePublication.
+// Each hosted artist stored with another pubkey is stored with the current pubkey, stamped as updated,
+// and with linkSignature, made by LinkPubkey with the old key, so peers that sync the new publications
+// accept the artist's pubkey change and sync all its art again.
+// It fails with an error wrapping ErrPubkeyMismatch if linkSignature does not link the old pubkey to the current one.
+// Publications cached with the old key are dropped so none is served after the rotation.
+// It gets the ids of the artists whose pubkey changed.
+func (server *AustkServer) ResignPublications(linkSignature string) ([]string, error) {
+	publisher, isRotatable := server.publisher.(rotatablePublisher)
+	if !isRotatable {
+		return nil, fmt.Errorf("publisher %T cannot sign with a rotated key", server.publisher)
+	}
+	pubkey, err := publisher.RefreshPubkey(server.ctx)
+	if err != nil {
+		server.logger.Error("failed to get pubkey from lnd", "error", err)
+		return nil, err
+	}
+	server.publications.clear()
+
+	var rotatedArtistIDs []string
+	for _, artistID := range server.config.PublishingArtistIDs() {
+		logger := server.logger.With("artist_id", artistID)
+		artist, err := server.artServer.Artist(artistID)
+		if err != nil {
+			logger.Error("failed to get hosted artist", "error", err)
+			return nil, err
+		}
+		if artist.Pubkey != pubkey {
+			rotatedArtist := proto.Clone(artist).(*art.Artist)
+			rotatedArtist.Pubkey = pubkey
+			if artist.Pubkey != "" {
+				rotatedArtist.PreviousPubkey = artist.Pubkey
+				rotatedArtist.PubkeyLinkSignature = linkSignature
+				err = checkPubkeyLink(server.ctx, server.publisher, &art.ArtistPublication{Artist: rotatedArtist},
+					server.artServer)
+				if err != nil {
+					logger.Error("no link from old pubkey", "old_pubkey", artist.Pubkey, "pubkey", pubkey, "error", err)
+					return nil, fmt.Errorf("%w; run austk -linkpubkey %s with the old key and pass its signature "+
+						"to -resign with -pubkeylinksig", err, pubkey)
+				}
+			}
+			err = server.artServer.StoreArtist(rotatedArtist)
+			if err != nil {
+				logger.Error("failed to store artist with rotated pubkey", "error", err)
+				return nil, err
+			}
+			err = publisher.UpdatePublishingArtist(rotatedArtist)
+			if err != nil {
+				logger.Error("failed to sign as artist with rotated pubkey", "error", err)
+				return nil, err
+			}
+			logger.Info("rotated artist pubkey", "old_pubkey", artist.Pubkey, "pubkey", pubkey)
+			rotatedArtistIDs = append(rotatedArtistIDs, artistID)
+		}
+		err = server.publish(artistID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rotatedArtistIDs, nil
+}
+
+// CheckHostedPubkeys stores each hosted artist stored without a pubkey with the pubkey of lnd's identity key.
+// It fails with an error wrapping ErrPubkeyMismatch if a hosted artist is stored with another pubkey,
+// e.g. after the key is rotated without -resign, since peers would reject the art signed for the artist.
+func (server *AustkServer) CheckHostedPubkeys(ctx context.Context) error {
+	pubkey, err := server.Pubkey(ctx)
+	if err != nil {
+		server.logger.Error("failed to get pubkey from lnd", "error", err)
+		return err
+	}
+	for _, artistID := range server.config.PublishingArtistIDs() {
+		logger := server.logger.With("artist_id", artistID)
+		artist, err := server.artServer.Artist(artistID)
+		if err != nil {
+			logger.Error("failed to get hosted artist", "error", err)
+			return err
+		}
+		if artist.Pubkey == pubkey {
+			continue // to next artist
+		} else if artist.Pubkey != "" {
+			logger.Error("hosted artist has another pubkey than lnd", "artist_pubkey", artist.Pubkey, "pubkey", pubkey)
+			return fmt.Errorf("%w: artist %s is stored with pubkey %s but lnd has pubkey %s; "+
+				"run austk -resign -pubkeylinksig {signature} if lnd's identity key was rotated",
+				ErrPubkeyMismatch, artistID, artist.Pubkey, pubkey)
+		}
+		keyedArtist := proto.Clone(artist).(*art.Artist)
+		keyedArtist.Pubkey = pubkey
+		err = server.artServer.StoreArtist(keyedArtist)
+		if err != nil {
+			logger.Error("failed to store artist with pubkey", "pubkey", pubkey, "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportPublication signs all the art of this server by the artist with artistID, as published after -add,
+// and writes the signed publication to the file named filename, e.g. to carry to a node without a network route.
+func (server *AustkServer) ExportPublication(artistID string, filename string) (*art.ArtistPublication, error) {
+	logger := server.logger.With("artist_id", artistID, "path", filename)
+
+	resources, err := server.CollectResources()
+	if err != nil {
+		logger.Error("failed to collect resources", "error", err)
+		return nil, err
+	}
+	publication, err := server.Sign(server.ctx, artistID, resources)
+	if err != nil {
+		logger.Error("failed to sign resources", "error", err)
+		return nil, err
+	}
+	publicationBytes, err := proto.Marshal(publication)
+	if err != nil {
+		logger.Error("failed to marshal publication", "error", err)
+		return nil, err
+	}
+	err = ioutil.WriteFile(filename, publicationBytes, 0644)
+	if err != nil {
+		logger.Error("failed to write publication", "error", err)
+		return nil, err
+	}
+	logger.Info("exported publication", "bytes", len(publicationBytes))
+	return publication, nil
+}
+
+// ImportPublication reads a publication exported to the file named filename, checks that its artist signed it,
+// and stores its art like art synced from a peer, deleting the tracks and albums it withdraws.
+// It returns an error wrapping ErrSignatureInvalid if the signature does not match the artist's pubkey,
+// or ErrPubkeyMismatch if the artist is stored with another pubkey that did not link to it.
+func (server *AustkServer) ImportPublication(filename string) (*art.ArtResources, error) {
+	logger := server.logger.With("path", filename)
+
+	publicationBytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		logger.Error("failed to read publication", "error", err)
+		return nil, err
+	}
+	publication := &art.ArtistPublication{}
+	err = proto.Unmarshal(publicationBytes, publication)
+	if err != nil {
+		logger.Warn("failed to unmarshal publication", "error", err)
+		return nil, err
+	}
+	if publication.Artist == nil {
+		return nil, fmt.Errorf("%w: no artist signed the publication in %s", ErrSignatureInvalid, filename)
+	}
+	logger = logger.With("artist_id", publication.Artist.ArtistId)
+
+	resources, err := server.ValidatePublication(server.ctx, publication)
+	if errors.Is(err, ErrPubkeyMismatch) {
+		logger.Warn("reject publication signed by another pubkey", "pubkey", publication.Artist.Pubkey)
+		return nil, fmt.Errorf("%w: %s is not signed by pubkey %s of %s",
+			ErrSignatureInvalid, filename, publication.Artist.Pubkey, publication.Artist.ArtistId)
+	} else if err != nil {
+		logger.Warn("reject publication", "error", err)
+		return nil, err
+	}
+	err = checkPubkeyLink(server.ctx, server.publisher, publication, server.artServer)
+	if err != nil {
+		logger.Warn("reject publication by unlinked pubkey", "error", err)
+		return nil, err
+	}
+	err = server.artServer.StorePublication(publication)
+	if err != nil {
+		logger.Error("failed to store publication", "error", err)
+		return nil, err
+	}
+	err = applyTombstones(server.artServer, publication.Artist.Pubkey, resources, logger)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("imported publication", "artists", len(resources.Artists), "albums", len(resources.Albums),
+		"tracks", len(resources.Tracks), "playlists", len(resources.Playlists))
+	return resources, nil
+}
+
+// ForeignArtError identifies a record in a publication by an artist that the publishing artist does not host,
+// i.e. whose pubkey is not the publishing artist's, so the publisher may not sign for it.
+type ForeignArtError struct {
+	// Record is the kind of the record: artist, album, track, playlist, or tombstone.
+	Record   string
+	ArtistID string
+	// ID is the ArtistAlbumId, ArtistTrackId, or ArtistPlaylistId of the record, or of the track or album
+	// withdrawn by a tombstone, or empty for an artist.
+	ID string
+}
+
+func (err *ForeignArtError) Error() string {
+	if err.ID == "" {
+		return fmt.Sprintf("%v: %s %s", ErrForeignArt, err.Record, err.ArtistID)
+	}
+	return fmt.Sprintf("%v: %s %s/%s", ErrForeignArt, err.Record, err.ArtistID, err.ID)
+}
+
+// Unwrap lets errors.Is match a ForeignArtError to ErrForeignArt.
+func (err *ForeignArtError) Unwrap() error {
+	return ErrForeignArt
+}
+
+// checkPublishedArtists checks that every artist, album, track, playlist, and tombstone in resources is by the artist
+// who signed publication or by another artist hosted with the same pubkey. An artist is hosted with the pubkey
+// if its record in resources has the pubkey or, if resources published since an earlier publication omit
+// the artist's unchanged record, if the artist stored in localStorage has the pubkey.
+// It returns a *ForeignArtError for the first record by any other artist.
+func checkPublishedArtists(publication *art.ArtistPublication, resources *art.ArtResources, localStorage ArtServer) error {
+	pubkey := publication.Artist.Pubkey
+	isHosted := map[string]bool{publication.Artist.ArtistId: true}
+	for _, artist := range resources.Artists {
+		if artist.ArtistId == publication.Artist.ArtistId {
+			continue // to next artist
+		}
+		if artist.Pubkey != pubkey {
+			return &ForeignArtError{Record: "artist", ArtistID: artist.ArtistId}
+		}
+		isHosted[artist.ArtistId] = true
+	}
+	checkArtist := func(record string, artistID string, id string) error {
+		hosted, isChecked := isHosted[artistID]
+		if !isChecked {
+			storedArtist, err := localStorage.Artist(artistID)
+			if err != nil && !errors.Is(err, ErrArtNotFound) {
+				return err
+			}
+			hosted = storedArtist != nil && storedArtist.Pubkey == pubkey
+			isHosted[artistID] = hosted
+		}
+		if !hosted {
+			return &ForeignArtError{Record: record, ArtistID: artistID, ID: id}
+		}
+		return nil
+	}
+
+	for _, album := range resources.Albums {
+		err := checkArtist("album", album.ArtistId, album.ArtistAlbumId)
+		if err != nil {
+			return err
+		}
+	}
+	for _, track := range resources.Tracks {
+		err := checkArtist("track", track.ArtistId, track.ArtistTrackId)
+		if err != nil {
+			return err
+		}
+	}
+	for _, playlist := range resources.Playlists {
+		err := checkArtist("playlist", playlist.ArtistId, playlist.ArtistPlaylistId)
+		if err != nil {
+			return err
+		}
+	}
+	// Only the artist who published a track or album may withdraw it.
+	for _, tombstone := range resources.Tombstones {
+		id := tombstone.ArtistTrackId
+		if id == "" {
+			id = tombstone.ArtistAlbumId
+		}
+		err := checkArtist("tombstone", tombstone.ArtistId, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prepareForSigning marshals resources into the message that lnd signs to publish them.
+// The marshaling is deterministic, so resources listed in the same order always make the same message.
+func prepareForSigning(resources *art.ArtResources) ([]byte, error) {
+	buffer := proto.NewBuffer(nil)
+	buffer.SetDeterministic(true)
+	err := buffer.Marshal(resources)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// signedMessage is the message that lnd signs to publish the resources marshaled by prepareForSigning
+// by scheme: the scheme, a newline and the marshaled resources, or the marshaled resources alone
+// for publications signed before the scheme was signed with them.
+func signedMessage(scheme string, marshaledResources []byte) []byte {
+	if scheme == "" || scheme == signatureSchemeLndUnbound {
+		return marshaledResources
+	}
+	message := make([]byte, 0, len(scheme)+1+len(marshaledResources))
+	message = append(message, scheme...)
+	message = append(message, '\n')
+	return append(message, marshaledResources...)
+}
+
+// attachSignature makes the publication by artist of the resources marshaled by prepareForSigning
+// and signed by lnd with signature.
+func attachSignature(artist *art.Artist, marshaledResources []byte, signature string) *art.ArtistPublication {
+	return &art.ArtistPublication{
+		Artist:                 artist,
+		Signature:              signature,
+		SerializedArtResources: marshaledResources,
+		SignatureScheme:        SignatureSchemeLnd,
+	}
+}
+
+// PrepareForSigning marshals resources into the message to sign for a publication,
+// e.g. by an air-gapped lnd with SignPrepared, without signing it.
+func (server *AustkServer) PrepareForSigning(resources *art.ArtResources) ([]byte, error) {
+	return prepareForSigning(resources)
+}
+
+// SignPrepared signs the message made by PrepareForSigning as the hosted artist with artistID,
+// e.g. on an air-gapped node, and gets the signature with the signer's pubkey.
+func (server *AustkServer) SignPrepared(artistID string, prepared []byte) (signature string, pubkey string, err error) {
+	resources := &art.ArtResources{}
+	err = proto.Unmarshal(prepared, resources)
+	if err != nil {
+		return "", "", fmt.Errorf("malformed art to sign: %w", err)
+	}
+	publication, err := server.Sign(server.ctx, artistID, resources)
+	if err != nil {
+		return "", "", err
+	}
+	// The signature is over the message as marshaled again here, so it must be the message prepared.
+	if !bytes.Equal(publication.SerializedArtResources, prepared) {
+		return "", "", fmt.Errorf("art to sign for %s does not marshal again as it was prepared", artistID)
+	}
+	return publication.Signature, publication.Artist.Pubkey, nil
+}
+
+// AttachSignature makes the publication of resources with the signature made for them elsewhere,
+// e.g. by SignPrepared on an air-gapped node, by the artist with pubkey: the node's artist if it has the pubkey,
+// or else the first artist in resources with it. It checks the publication as ValidatePublication does,
+// so that it can be served as signed by Sign.
+// It fails with ErrPubkeyMismatch if no such artist has pubkey, and ErrSignatureInvalid for a bad signature.
+func (server *AustkServer) AttachSignature(resources *art.ArtResources, signature string, pubkey string) (*art.ArtistPublication, error) {
+	var signingArtist *art.Artist
+	nodeArtist, err := server.artServer.Artist(server.config.ArtistID)
+	if err == nil && nodeArtist.Pubkey == pubkey {
+		signingArtist = nodeArtist
+	}
+	for _, artist := range resources.Artists {
+		if signingArtist == nil && artist.Pubkey == pubkey {
+			signingArtist = artist
+		}
+	}
+	if signingArtist == nil {
+		return nil, fmt.Errorf("%w: no artist with pubkey %s to publish the art", ErrPubkeyMismatch, pubkey)
+	}
+	marshaledResources, err := prepareForSigning(resources)
+	if err != nil {
+		return nil, err
+	}
+	publication := attachSignature(signingArtist, marshaledResources, signature)
+	_, err = server.ValidatePublication(server.ctx, publication)
+	if err != nil {
+		server.logger.Warn("reject signature", "artist_id", signingArtist.ArtistId, "pubkey", pubkey, "error", err)
+		return nil, err
+	}
+	return publication, nil
+}
+
+// preparedSignature is the signature of a prepared publication, written beside it by SignPreparedFile.
+type preparedSignature struct {
+	Pubkey    string `json:"pubkey"`
+	Signature string `json:"signature"`
+}
+
+// signatureFilename names the file of the signature of the publication prepared in preparedFilename.
+func signatureFilename(preparedFilename string) string {
+	return preparedFilename + ".sig"
+}
+
+// PrepareSigningFile writes all the art of this server, as published after -add, unsigned to the file
+// named filename, for an air-gapped node to sign with SignPreparedFile.
+func (server *AustkServer) PrepareSigningFile(filename string) error {
+	resources, err := server.CollectResources()
+	if err != nil {
+		server.logger.Error("failed to collect resources", "error", err)
+		return err
+	}
+	prepared, err := server.PrepareForSigning(resources)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filename, prepared, 0644)
+	if err != nil {
+		server.logger.Error("failed to write art to sign", "path", filename, "error", err)
+		return err
+	}
+	server.logger.Info("prepared art to sign", "path", filename, "bytes", len(prepared))
+	return nil
+}
+
+// SignPreparedFile signs the art written by PrepareSigningFile to the file named filename
+// as the hosted artist with artistID, and writes the signature beside it for AttachSignatureFile.
+func (server *AustkServer) SignPreparedFile(artistID string, filename string) error {
+	prepared, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	signature, pubkey, err := server.SignPrepared(artistID, prepared)
+	if err != nil {
+		server.logger.Error("failed to sign prepared art", "artist_id", artistID, "path", filename, "error", err)
+		return err
+	}
+	signatureBytes, err := json.Marshal(preparedSignature{Pubkey: pubkey, Signature: signature})
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(signatureFilename(filename), signatureBytes, 0644)
+	if err != nil {
+		return err
+	}
+	server.logger.Info("signed prepared art", "artist_id", artistID, "path", signatureFilename(filename))
+	return nil
+}
+
+// AttachSignatureFile publishes the art written by PrepareSigningFile to the file named filename
+// with the signature that SignPreparedFile wrote beside it, storing the publication to serve.
+func (server *AustkServer) AttachSignatureFile(filename string) (*art.ArtistPublication, error) {
+	prepared, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	signatureBytes, err := ioutil.ReadFile(signatureFilename(filename))
+	if err != nil {
+		return nil, err
+	}
+	signed := preparedSignature{}
+	err = json.Unmarshal(signatureBytes, &signed)
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature in %s: %w", signatureFilename(filename), err)
+	}
+	resources := &art.ArtResources{}
+	err = proto.Unmarshal(prepared, resources)
+	if err != nil {
+		return nil, fmt.Errorf("malformed art to sign in %s: %w", filename, err)
+	}
+	publication, err := server.AttachSignature(resources, signed.Signature, signed.Pubkey)
+	if err != nil {
+		return nil, err
+	}
+	err = server.artServer.StorePublication(publication)
+	if err != nil {
+		server.logger.Error("failed to store publication", "artist_id", publication.Artist.ArtistId, "error", err)
+		return nil, err
+	}
+	server.logger.Info("published art signed offline", "artist_id", publication.Artist.ArtistId, "path", filename)
+	return publication, nil
+}
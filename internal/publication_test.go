@@ -0,0 +1,531 @@
+package audiostrike
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+)
+
+// TestExportImportPublication verifies that a publication exported by one node is imported by another
+// and that a publication whose signature does not match its pubkey is rejected.
+func TestExportImportPublication(t *testing.T) {
+	newServer := func(artDir string) (*FileServer, *AustkServer) {
+		fileServer, err := NewFileServer(artDir)
+		if err != nil {
+			t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+		}
+		mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+		if err != nil {
+			t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+		}
+		austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+		if err != nil {
+			t.Fatalf("NewAustkServer error: %v", err)
+		}
+		return fileServer, austkServer
+	}
+	exportDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(exportDir)
+	importDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(importDir)
+
+	exportFileServer, exportServer := newServer(exportDir)
+	err = exportFileServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	err = exportFileServer.StoreTrack(&art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID, Title: "Test Track"},
+		&mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	filename := filepath.Join(exportDir, "publication.pb")
+	_, err = exportServer.ExportPublication(mockArtistID, filename)
+	if err != nil {
+		t.Fatalf("ExportPublication error: %v", err)
+	}
+
+	importFileServer, importServer := newServer(importDir)
+	resources, err := importServer.ImportPublication(filename)
+	if err != nil {
+		t.Fatalf("ImportPublication error: %v", err)
+	}
+	if len(resources.Tracks) != 1 || resources.Tracks[0].ArtistTrackId != mockTrackID {
+		t.Errorf("expected track %s imported but got %v", mockTrackID, resources.Tracks)
+	}
+	track, err := importFileServer.Track(mockArtistID, mockTrackID)
+	if err != nil || track.Title != "Test Track" {
+		t.Errorf("expected imported track stored but got %v, error: %v", track, err)
+	}
+
+	// Forge the signature of the exported publication.
+	publicationBytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("ReadFile error: %v", err)
+	}
+	publication := &art.ArtistPublication{}
+	err = proto.Unmarshal(publicationBytes, publication)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	publication.Signature = "forged signature"
+	publicationBytes, err = proto.Marshal(publication)
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	err = ioutil.WriteFile(filename, publicationBytes, 0644)
+	if err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+	_, err = importServer.ImportPublication(filename)
+	if !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected ErrSignatureInvalid importing forged publication but got %v", err)
+	}
+}
+
+// TestValidatePublicationForeignArt verifies that a publication mixing in the art of an artist
+// with another pubkey is rejected, identifying the foreign record, and that hosted artists are accepted.
+func TestValidatePublicationForeignArt(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	foreignArtist := &art.Artist{ArtistId: "foreignartist", Pubkey: "foreignpubkey"}
+	err = fileServer.StoreArtist(foreignArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	ownTrack := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "own"}
+	foreignTrack := &art.Track{ArtistId: foreignArtist.ArtistId, ArtistTrackId: "smuggled"}
+	hostedArtist := &art.Artist{ArtistId: "hostedartist", Pubkey: mockPubkey}
+
+	tests := []struct {
+		name        string
+		resources   *art.ArtResources
+		expectedErr *ForeignArtError
+	}{
+		{"own art", &art.ArtResources{Artists: []*art.Artist{&mockArtist}, Tracks: []*art.Track{ownTrack}}, nil},
+		{"hosted artist", &art.ArtResources{Artists: []*art.Artist{&mockArtist, hostedArtist},
+			Tracks: []*art.Track{ownTrack, &art.Track{ArtistId: hostedArtist.ArtistId, ArtistTrackId: "hosted"}}}, nil},
+		{"foreign artist", &art.ArtResources{Artists: []*art.Artist{&mockArtist, foreignArtist},
+			Tracks: []*art.Track{ownTrack, foreignTrack}}, &ForeignArtError{Record: "artist", ArtistID: "foreignartist"}},
+		{"foreign track", &art.ArtResources{Artists: []*art.Artist{&mockArtist}, Tracks: []*art.Track{ownTrack, foreignTrack}},
+			&ForeignArtError{Record: "track", ArtistID: "foreignartist", ID: "smuggled"}},
+		{"unknown artist's album", &art.ArtResources{Albums: []*art.Album{&art.Album{ArtistId: unknownID, ArtistAlbumId: "album"}}},
+			&ForeignArtError{Record: "album", ArtistID: unknownID, ID: "album"}},
+		{"foreign tombstone", &art.ArtResources{Artists: []*art.Artist{&mockArtist},
+			Tombstones: []*art.Tombstone{{ArtistId: foreignArtist.ArtistId, ArtistTrackId: "takendown"}}},
+			&ForeignArtError{Record: "tombstone", ArtistID: "foreignartist", ID: "takendown"}},
+	}
+	for _, test := range tests {
+		publication, err := mockLightningNode.Sign(context.Background(), mockArtistID, test.resources)
+		if err != nil {
+			t.Fatalf("%s: Sign error: %v", test.name, err)
+		}
+		_, err = austkServer.ValidatePublication(context.Background(), publication)
+		var foreignArtErr *ForeignArtError
+		if test.expectedErr == nil {
+			if err != nil {
+				t.Errorf("%s: expected publication to validate but got %v", test.name, err)
+			}
+		} else if !errors.As(err, &foreignArtErr) || *foreignArtErr != *test.expectedErr || !errors.Is(err, ErrForeignArt) {
+			t.Errorf("%s: expected %v but got %v", test.name, test.expectedErr, err)
+		}
+	}
+
+	// The server publishes only the art of the artists it hosts.
+	err = fileServer.StoreTrack(foreignTrack, austkServer)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	resources, err := austkServer.CollectResources()
+	if err != nil {
+		t.Fatalf("CollectResources error: %v", err)
+	}
+	for _, artist := range resources.Artists {
+		if artist.ArtistId == foreignArtist.ArtistId {
+			t.Errorf("expected server not to publish synced artist %s", artist.ArtistId)
+		}
+	}
+	for _, track := range resources.Tracks {
+		if track.ArtistId == foreignArtist.ArtistId {
+			t.Errorf("expected server not to publish synced track %s/%s", track.ArtistId, track.ArtistTrackId)
+		}
+	}
+}
+
+// TestOfflineSigning verifies that art prepared by one node and signed by another, e.g. air-gapped,
+// is published with the signature attached as ValidatePublication accepts it, and that a forged signature is not.
+func TestOfflineSigning(t *testing.T) {
+	newServer := func(artServer ArtServer) *AustkServer {
+		err := artServer.StoreArtist(&mockArtist)
+		if err != nil {
+			t.Fatalf("StoreArtist error: %v", err)
+		}
+		mockLightningNode, err := NewMockLightningNode(cfg, artServer)
+		if err != nil {
+			t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+		}
+		austkServer, err := NewAustkServer(cfg, artServer, mockLightningNode)
+		if err != nil {
+			t.Fatalf("NewAustkServer error: %v", err)
+		}
+		return austkServer
+	}
+	dir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	onlineStorage, err := NewFileServer(dir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", dir, err)
+	}
+	onlineServer := newServer(onlineStorage)
+	err = onlineStorage.StoreTrack(&art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID, Title: "Test Track"},
+		&mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	offlineServer := newServer(NewMemoryArtServer())
+	filename := filepath.Join(dir, "art.pb")
+	err = onlineServer.PrepareSigningFile(filename)
+	if err != nil {
+		t.Fatalf("PrepareSigningFile error: %v", err)
+	}
+	err = offlineServer.SignPreparedFile(mockArtistID, filename)
+	if err != nil {
+		t.Fatalf("SignPreparedFile error: %v", err)
+	}
+	publication, err := onlineServer.AttachSignatureFile(filename)
+	if err != nil {
+		t.Fatalf("AttachSignatureFile error: %v", err)
+	}
+	resources, err := onlineServer.ValidatePublication(context.Background(), publication)
+	if err != nil || len(resources.Tracks) != 1 || resources.Tracks[0].ArtistTrackId != mockTrackID {
+		t.Errorf("expected valid publication of the prepared track but got %v, error: %v", resources, err)
+	}
+	storedResources, err := onlineStorage.readSavedResources(&mockArtist)
+	if err != nil || len(storedResources.Tracks) != 1 {
+		t.Errorf("expected publication stored to serve but got %v, error: %v", storedResources, err)
+	}
+
+	_, err = onlineServer.AttachSignature(resources, "forged signature", mockPubkey)
+	if !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("expected ErrSignatureInvalid attaching a forged signature but got %v", err)
+	}
+}
+
+// countingPublisher is a Publisher that counts the publications it signs.
+type countingPublisher struct {
+	Publisher
+	signatures int
+}
+
+func (publisher *countingPublisher) Sign(ctx context.Context, artistID string, resources *art.ArtResources) (*art.ArtistPublication, error) {
+	publisher.signatures++
+	return publisher.Publisher.Sign(ctx, artistID, resources)
+}
+
+// TestPublicationCache verifies that the same art is signed only once, whether published or served to sync,
+// and that changed art is signed again.
+func TestPublicationCache(t *testing.T) {
+	memoryServer := NewMemoryArtServer()
+	publisher := &countingPublisher{Publisher: &mockPublisher}
+	austkServer, err := NewAustkServer(cfg, memoryServer, publisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	err = memoryServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	err = memoryServer.StoreTrack(&art.Track{ArtistId: mockArtistID, ArtistTrackId: "first", Title: "First"}, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		err = austkServer.publish(mockArtistID)
+		if err != nil {
+			t.Fatalf("publish error: %v", err)
+		}
+	}
+	if publisher.signatures != 1 {
+		t.Errorf("expected the same art signed once but got %d signatures", publisher.signatures)
+	}
+	getAllArt := func() []byte {
+		recorder := httptest.NewRecorder()
+		austkServer.getAllArtHandler(recorder, httptest.NewRequest("GET", "/art", nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected art served but got %d", recorder.Code)
+		}
+		return recorder.Body.Bytes()
+	}
+	served := getAllArt()
+	if servedAgain := getAllArt(); !bytes.Equal(served, servedAgain) || publisher.signatures != 1 {
+		t.Errorf("expected the published art served twice without signing again but got %d signatures", publisher.signatures)
+	}
+
+	err = memoryServer.StoreTrack(&art.Track{ArtistId: mockArtistID, ArtistTrackId: "second", Title: "Second"}, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	err = austkServer.publish(mockArtistID)
+	if err != nil || publisher.signatures != 2 {
+		t.Errorf("expected changed art signed again but got %d signatures, error: %v", publisher.signatures, err)
+	}
+}
+
+// TestResignPublications verifies that after lnd's key is rotated, the daemon refuses to start
+// until -resign, with the signature linking the old key to the new one, stores the hosted artist with the new pubkey
+// and publishes art that validates against it again, which peers that stored the old pubkey accept only with the link.
+func TestResignPublications(t *testing.T) {
+	// The mock lightning client verifies this signature, of any message, as signed by oldPubkey.
+	const oldPubkey = "036f709187264df770bd453270a95b579595a42cd89eab2ea437dfd537048a7250"
+	const linkSignature = "dh7xh9aw4ce6zhwpczg5qce6xfxkfcyj8cf91j719bgmcks3i7kyhrwiywrhzk5tk7a6d8x3xauppjz6thzzdwbyq8ffzj3p614ko3op"
+	memoryServer := NewMemoryArtServer()
+	err := memoryServer.StoreArtist(&art.Artist{ArtistId: mockArtistID, Name: mockArtist.Name, Pubkey: oldPubkey})
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	mockLightningNode, err := NewMockLightningNode(cfg, memoryServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, memoryServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	ctx := context.Background()
+
+	// lnd now signs with the rotated key, so the publication fails to validate against the stored pubkey.
+	publication, _, err := austkServer.ArtistPublication(ctx, mockArtistID, 0)
+	if err != nil {
+		t.Fatalf("ArtistPublication error: %v", err)
+	}
+	_, err = austkServer.ValidatePublication(ctx, publication)
+	if err == nil {
+		t.Errorf("expected publication signed with the rotated key to fail validation against %s", oldPubkey)
+	}
+	err = austkServer.CheckHostedPubkeys(ctx)
+	if !errors.Is(err, ErrPubkeyMismatch) {
+		t.Errorf("expected ErrPubkeyMismatch for artist stored with the old pubkey but got %v", err)
+	}
+
+	for _, badSignature := range []string{"", mockSignature(pubkeyLinkMessage(oldPubkey, mockPubkey))} {
+		_, err = austkServer.ResignPublications(badSignature)
+		if !errors.Is(err, ErrPubkeyMismatch) {
+			t.Errorf("expected ErrPubkeyMismatch for -resign with link signature %q but got %v", badSignature, err)
+		}
+	}
+	rotatedArtistIDs, err := austkServer.ResignPublications(linkSignature)
+	if err != nil || len(rotatedArtistIDs) != 1 || rotatedArtistIDs[0] != mockArtistID {
+		t.Fatalf("expected pubkey of %s rotated but got %v, error: %v", mockArtistID, rotatedArtistIDs, err)
+	}
+	storedArtist, err := memoryServer.Artist(mockArtistID)
+	if err != nil || storedArtist.Pubkey != mockPubkey || storedArtist.PreviousPubkey != oldPubkey ||
+		storedArtist.PubkeyLinkSignature != linkSignature {
+		t.Errorf("expected artist stored with pubkey %s linked from %s but got %v, error: %v",
+			mockPubkey, oldPubkey, storedArtist, err)
+	}
+	publication, _, err = austkServer.ArtistPublication(ctx, mockArtistID, 0)
+	if err != nil {
+		t.Fatalf("ArtistPublication after -resign, error: %v", err)
+	}
+	if publication.Artist.Pubkey != mockPubkey {
+		t.Errorf("expected publication by pubkey %s but got %s", mockPubkey, publication.Artist.Pubkey)
+	}
+	_, err = austkServer.ValidatePublication(ctx, publication)
+	if err != nil {
+		t.Errorf("expected re-signed publication to validate but got error %v", err)
+	}
+	err = austkServer.CheckHostedPubkeys(ctx)
+	if err != nil {
+		t.Errorf("expected artist stored with lnd's pubkey after -resign but got error %v", err)
+	}
+
+	rotatedArtistIDs, err = austkServer.ResignPublications("")
+	if err != nil || len(rotatedArtistIDs) != 0 {
+		t.Errorf("expected no pubkey rotated signing again with the same key but got %v, error: %v", rotatedArtistIDs, err)
+	}
+
+	// A peer that stored the artist with the old pubkey accepts the new one only with the link.
+	peerStorage := NewMemoryArtServer()
+	err = peerStorage.StoreArtist(&art.Artist{ArtistId: mockArtistID, Name: mockArtist.Name, Pubkey: oldPubkey})
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	err = checkPubkeyLink(ctx, austkServer, publication, peerStorage)
+	if err != nil {
+		t.Errorf("expected publication by the linked pubkey accepted but got error %v", err)
+	}
+	unlinkedPublication := proto.Clone(publication).(*art.ArtistPublication)
+	unlinkedPublication.Artist.PubkeyLinkSignature = mockSignature(pubkeyLinkMessage(oldPubkey, mockPubkey))
+	err = checkPubkeyLink(ctx, austkServer, unlinkedPublication, peerStorage)
+	if !errors.Is(err, ErrPubkeyMismatch) {
+		t.Errorf("expected ErrPubkeyMismatch for link signed by the new pubkey but got %v", err)
+	}
+	unlinkedPublication.Artist.PreviousPubkey = ""
+	unlinkedPublication.Artist.PubkeyLinkSignature = ""
+	err = checkPubkeyLink(ctx, austkServer, unlinkedPublication, peerStorage)
+	if !errors.Is(err, ErrPubkeyMismatch) {
+		t.Errorf("expected ErrPubkeyMismatch for publication by an unlinked pubkey but got %v", err)
+	}
+	err = checkPubkeyLink(ctx, austkServer, unlinkedPublication, NewMemoryArtServer())
+	if err != nil {
+		t.Errorf("expected publication of an artist not yet stored accepted but got error %v", err)
+	}
+
+	linkSignatureByNewKey, err := austkServer.LinkPubkey(oldPubkey)
+	if err != nil || linkSignatureByNewKey != mockSignature(pubkeyLinkMessage(mockPubkey, oldPubkey)) {
+		t.Errorf("expected link signed by lnd's key but got %q, error: %v", linkSignatureByNewKey, err)
+	}
+	if _, err = austkServer.LinkPubkey(mockPubkey); err == nil {
+		t.Errorf("expected no link from lnd's pubkey to itself")
+	}
+}
+
+// TestStorePublicationRemovesOldPubkey verifies that a FileServer storing a publication with the artist's new pubkey
+// removes the publication signed with the old one, so the next FileServer reads only the new one.
+func TestStorePublicationRemovesOldPubkey(t *testing.T) {
+	const oldPubkey = "02aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	artDir := t.TempDir()
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer error: %v", err)
+	}
+	for _, pubkey := range []string{oldPubkey, mockPubkey} {
+		artist := &art.Artist{ArtistId: mockArtistID, Name: mockArtist.Name, Pubkey: pubkey}
+		marshaledResources, err := proto.Marshal(&art.ArtResources{Artists: []*art.Artist{artist}})
+		if err != nil {
+			t.Fatalf("Marshal error: %v", err)
+		}
+		err = fileServer.StorePublication(&art.ArtistPublication{Artist: artist, SerializedArtResources: marshaledResources})
+		if err != nil {
+			t.Fatalf("StorePublication by %s, error: %v", pubkey, err)
+		}
+	}
+	pubPaths, _ := filepath.Glob(filepath.Join(artDir, mockArtistID, "*.pub"))
+	if len(pubPaths) != 1 || filepath.Base(pubPaths[0]) != mockPubkey+".pub" {
+		t.Errorf("expected only the publication by %s but got %v", mockPubkey, pubPaths)
+	}
+}
+
+// TestPublicationSequence verifies that published art keeps its sequence until it changes, whichever part of it
+// is published, and that a publication validated out of order after a later one is refused as stale.
+func TestPublicationSequence(t *testing.T) {
+	memoryServer := NewMemoryArtServer()
+	austkServer, err := NewAustkServer(cfg, memoryServer, &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	err = memoryServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	err = memoryServer.StoreTrack(&art.Track{ArtistId: mockArtistID, ArtistTrackId: "first", Title: "First"}, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	ctx := context.Background()
+
+	first, firstResources, err := austkServer.ArtistPublication(ctx, mockArtistID, 0)
+	if err != nil || firstResources.Sequence == 0 {
+		t.Fatalf("expected a sequenced publication but got %v, error: %v", firstResources, err)
+	}
+	_, sinceResources, err := austkServer.ArtistPublication(ctx, mockArtistID, firstResources.AsOf)
+	if err != nil || sinceResources.Sequence != firstResources.Sequence {
+		t.Errorf("expected the same art published since its update with sequence %d but got %v, error: %v",
+			firstResources.Sequence, sinceResources, err)
+	}
+
+	err = memoryServer.DeleteTrack(&art.Track{ArtistId: mockArtistID, ArtistTrackId: "first"})
+	if err != nil {
+		t.Fatalf("DeleteTrack error: %v", err)
+	}
+	second, secondResources, err := austkServer.ArtistPublication(ctx, mockArtistID, 0)
+	if err != nil || secondResources.Sequence <= firstResources.Sequence {
+		t.Fatalf("expected a later sequence than %d after the takedown but got %v, error: %v",
+			firstResources.Sequence, secondResources, err)
+	}
+
+	// A peer validates the publication after the takedown, then the replayed one from before it.
+	peerServer, err := NewAustkServer(cfg, NewMemoryArtServer(), &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	for _, publication := range []*art.ArtistPublication{second, second} {
+		_, err = peerServer.ValidatePublication(ctx, publication)
+		if err != nil {
+			t.Errorf("expected the latest publication valid but got %v", err)
+		}
+	}
+	_, err = peerServer.ValidatePublication(ctx, first)
+	if !errors.Is(err, ErrPublicationStale) {
+		t.Errorf("expected ErrPublicationStale for a replayed publication but got %v", err)
+	}
+	sequence, err := peerServer.artServer.PublicationSequence(mockArtist.Pubkey)
+	if err != nil || sequence != secondResources.Sequence {
+		t.Errorf("expected the latest sequence %d stored but got %d, error: %v", secondResources.Sequence, sequence, err)
+	}
+}
+
+// TestPublicationSequenceStored verifies that a node restarted with its clock behind the sequence it last published
+// publishes a later sequence, stored for the next restart.
+func TestPublicationSequenceStored(t *testing.T) {
+	memoryServer := NewMemoryArtServer()
+	lastSequence := uint64(time.Now().Add(time.Hour).UnixNano())
+	err := memoryServer.StorePublicationSequence(publishedSequenceKey, lastSequence)
+	if err != nil {
+		t.Fatalf("StorePublicationSequence error: %v", err)
+	}
+	err = memoryServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	for restart := uint64(1); restart <= 2; restart++ {
+		austkServer, err := NewAustkServer(cfg, memoryServer, &mockPublisher)
+		if err != nil {
+			t.Fatalf("NewAustkServer error: %v", err)
+		}
+		_, resources, err := austkServer.ArtistPublication(context.Background(), mockArtistID, 0)
+		if err != nil || resources.Sequence != lastSequence+restart {
+			t.Errorf("expected sequence %d after restart %d but got %v, error: %v", lastSequence+restart, restart, resources, err)
+		}
+		storedSequence, err := memoryServer.PublicationSequence(publishedSequenceKey)
+		if err != nil || storedSequence != lastSequence+restart {
+			t.Errorf("expected sequence %d stored but got %d, error: %v", lastSequence+restart, storedSequence, err)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package audiostrike
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PubkeyHeader is the http header in which a client of a private node names the lnd pubkey of its node,
+// proven by ChallengeSignatureHeader, so that the node can limit the requests of each peer
+// however many connections it opens. A server limits each connection too.
+const PubkeyHeader = "X-Austk-Pubkey"
+
+// maxRateLimitedClients is how many connections and pubkeys a rateLimiter tracks
+// before forgetting those whose limits have recovered.
+const maxRateLimitedClients = 4096
+
+// rateLimiter limits the requests per second and the bytes per second served to each client,
+// by a token bucket for each connection and for each pubkey.
+// Each bucket holds up to a second of tokens, so a client may burst that much after idling.
+// It is safe for concurrent use.
+type rateLimiter struct {
+	requestsPerSecond float64
+	bytesPerSecond    float64
+
+	requestBuckets map[string]*tokenBucket
+	byteBuckets    map[string]*tokenBucket
+	mutex          sync.Mutex
+
+	// now gets the current time.
+	now func() time.Time
+}
+
+// tokenBucket has the tokens left to a client as of when they were last counted.
+// A byte bucket goes into debt for the bytes of a response larger than the tokens left.
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// newRateLimiter creates a rateLimiter of requestsPerSecond and bytesPerSecond for each client,
+// where a limit of 0 is no limit. It returns nil if neither is limited.
+func newRateLimiter(requestsPerSecond float64, bytesPerSecond int64) *rateLimiter {
+	if requestsPerSecond <= 0 && bytesPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{
+		requestsPerSecond: requestsPerSecond,
+		bytesPerSecond:    float64(bytesPerSecond),
+		requestBuckets:    make(map[string]*tokenBucket),
+		byteBuckets:       make(map[string]*tokenBucket),
+		now:               time.Now,
+	}
+}
+
+// allow takes a request token from the bucket of each client key, unless any client is out of requests
+// or in debt for bytes. Then it takes no token and returns how long to wait before trying again.
+func (limiter *rateLimiter) allow(keys []string) (retryAfter time.Duration, isAllowed bool) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	now := limiter.now()
+	for _, key := range keys {
+		if limiter.requestsPerSecond > 0 {
+			bucket := limiter.bucket(limiter.requestBuckets, key, limiter.requestsPerSecond, now)
+			if bucket.tokens < 1 {
+				retryAfter = maxDuration(retryAfter, waitFor(1-bucket.tokens, limiter.requestsPerSecond))
+			}
+		}
+		if limiter.bytesPerSecond > 0 {
+			bucket := limiter.bucket(limiter.byteBuckets, key, limiter.bytesPerSecond, now)
+			if bucket.tokens < 0 {
+				retryAfter = maxDuration(retryAfter, waitFor(-bucket.tokens, limiter.bytesPerSecond))
+			}
+		}
+	}
+	if retryAfter > 0 {
+		return retryAfter, false
+	}
+	if limiter.requestsPerSecond > 0 {
+		for _, key := range keys {
+			limiter.requestBuckets[key].tokens--
+		}
+	}
+	return 0, true
+}
+
+// spend takes count byte tokens from the bucket of each client key, into debt if need be.
+func (limiter *rateLimiter) spend(keys []string, count int) {
+	if limiter.bytesPerSecond <= 0 {
+		return
+	}
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	now := limiter.now()
+	for _, key := range keys {
+		limiter.bucket(limiter.byteBuckets, key, limiter.bytesPerSecond, now).tokens -= float64(count)
+	}
+}
+
+// bucket gets the bucket in buckets of the client with key, refilled at rate tokens per second until now.
+// The caller must hold limiter.mutex.
+func (limiter *rateLimiter) bucket(buckets map[string]*tokenBucket, key string, rate float64, now time.Time) *tokenBucket {
+	bucket, isTracked := buckets[key]
+	if !isTracked {
+		if len(buckets) >= maxRateLimitedClients {
+			forgetFullBuckets(buckets, rate, now)
+		}
+		bucket = &tokenBucket{tokens: rate, updatedAt: now}
+		buckets[key] = bucket
+		return bucket
+	}
+	bucket.refill(rate, now)
+	return bucket
+}
+
+// refill adds the tokens earned at rate per second since the bucket was last counted, up to a second's worth.
+func (bucket *tokenBucket) refill(rate float64, now time.Time) {
+	if now.After(bucket.updatedAt) {
+		bucket.tokens = math.Min(rate, bucket.tokens+rate*now.Sub(bucket.updatedAt).Seconds())
+		bucket.updatedAt = now
+	}
+}
+
+// forgetFullBuckets removes the buckets that have refilled by now, since a new bucket starts full anyway.
+func forgetFullBuckets(buckets map[string]*tokenBucket, rate float64, now time.Time) {
+	for key, bucket := range buckets {
+		bucket.refill(rate, now)
+		if bucket.tokens >= rate {
+			delete(buckets, key)
+		}
+	}
+}
+
+// waitFor gets how long it takes to earn tokens at rate per second.
+func waitFor(tokens float64, rate float64) time.Duration {
+	return time.Duration(math.Ceil(tokens / rate * float64(time.Second)))
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// rateLimitKeys gets the keys of the clients that req counts against: its connection,
+// and the pubkey its client proved to peersOnly if any. A pubkey merely claimed in PubkeyHeader
+// is not counted, lest a client throttle another by naming its pubkey.
+func rateLimitKeys(req *http.Request) []string {
+	keys := []string{"connection " + req.RemoteAddr}
+	if pubkey := provenPubkey(req); pubkey != "" {
+		keys = append(keys, "pubkey "+pubkey)
+	}
+	return keys
+}
+
+// rateLimited wraps handler to reply 429 Too Many Requests, with a Retry-After header,
+// to a client over the configured limit of requests or bytes per second,
+// and to count the bytes that handler writes against the client's limit.
+// It goes inside peersOnly, so that a peer's requests count against the pubkey it proved.
+func (server *AustkServer) rateLimited(handler http.HandlerFunc) http.HandlerFunc {
+	limiter := server.rateLimiter
+	if limiter == nil {
+		return handler
+	}
+	return func(w http.ResponseWriter, req *http.Request) {
+		keys := rateLimitKeys(req)
+		retryAfter, isAllowed := limiter.allow(keys)
+		if !isAllowed {
+			server.logger.Info("throttle request", "url", req.URL.Path, "client", keys, "retry_after", retryAfter)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(w, "rate limit exceeded, retry after "+retryAfter.Round(time.Millisecond).String(),
+				http.StatusTooManyRequests)
+			return
+		}
+		handler(&rateLimitedWriter{ResponseWriter: w, limiter: limiter, keys: keys}, req)
+	}
+}
+
+// rateLimitedWriter counts the bytes written to a response against the limits of its client.
+type rateLimitedWriter struct {
+	http.ResponseWriter
+	limiter *rateLimiter
+	keys    []string
+}
+
+func (w *rateLimitedWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.limiter.spend(w.keys, n)
+	return n, err
+}
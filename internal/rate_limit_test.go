@@ -0,0 +1,137 @@
+package audiostrike
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRateLimitedBurst verifies that a burst of requests past the limit of a connection or of a proven pubkey
+// is throttled with 429 Too Many Requests, that a pubkey merely claimed is not limited,
+// and that the client reports it as ErrRateLimited.
+func TestRateLimitedBurst(t *testing.T) {
+	limitedCfg := *cfg
+	limitedCfg.RequestsPerSecond = 3
+	austkServer, err := NewAustkServer(&limitedCfg, NewMemoryArtServer(), &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	now := time.Now()
+	austkServer.rateLimiter.now = func() time.Time { return now }
+	handler := austkServer.rateLimited(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	get := func(remoteAddr string, pubkey string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/peers/catalog", nil)
+		request.RemoteAddr = remoteAddr
+		if pubkey != "" {
+			request = withProvenPubkey(request, pubkey)
+		}
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+		return recorder
+	}
+
+	for i := 0; i < 3; i++ {
+		if response := get("127.0.0.1:1000", ""); response.Code != http.StatusOK {
+			t.Fatalf("expected request %d of burst served but got %d", i, response.Code)
+		}
+	}
+	throttled := get("127.0.0.1:1000", "")
+	if throttled.Code != http.StatusTooManyRequests || throttled.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected burst throttled with Retry-After 1 but got %d %q", throttled.Code, throttled.Header().Get("Retry-After"))
+	}
+	if response := get("127.0.0.1:1001", ""); response.Code != http.StatusOK {
+		t.Errorf("expected request on another connection served but got %d", response.Code)
+	}
+
+	// A peer that opens a connection per request is limited by the pubkey it proves.
+	for i := 0; i < 3; i++ {
+		if response := get(fmt.Sprintf("127.0.0.1:%d", 3000+i), mockPubkey); response.Code != http.StatusOK {
+			t.Fatalf("expected request %d of pubkey burst served but got %d", i, response.Code)
+		}
+	}
+	throttled = get("127.0.0.1:2000", mockPubkey)
+	if throttled.Code != http.StatusTooManyRequests {
+		t.Errorf("expected pubkey burst throttled but got %d", throttled.Code)
+	}
+
+	// A pubkey claimed without proof does not count, so no client can use up another's limit.
+	claimed := httptest.NewRequest("GET", "/peers/catalog", nil)
+	claimed.RemoteAddr = "127.0.0.1:4000"
+	claimed.Header.Set(PubkeyHeader, mockPubkey)
+	recorder := httptest.NewRecorder()
+	handler(recorder, claimed)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected request claiming a throttled pubkey served but got %d", recorder.Code)
+	}
+
+	now = now.Add(time.Second)
+	if response := get("127.0.0.1:1000", ""); response.Code != http.StatusOK {
+		t.Errorf("expected request served a second after burst but got %d", response.Code)
+	}
+
+	client := &Client{peerAddress: "127.0.0.1:1000"}
+	response := throttled.Result()
+	replyBytes, _ := ioutil.ReadAll(response.Body)
+	response.Request = httptest.NewRequest("GET", "/peers/catalog", nil)
+	err = client.replyError(response, replyBytes)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited but got %v", err)
+	}
+}
+
+// TestRateLimitedBytes verifies that a client who downloaded more bytes than its limit
+// is throttled until it earns back its debt.
+func TestRateLimitedBytes(t *testing.T) {
+	limiter := newRateLimiter(0, 100)
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	keys := []string{"connection 127.0.0.1:1000"}
+
+	if _, isAllowed := limiter.allow(keys); !isAllowed {
+		t.Fatalf("expected first request allowed")
+	}
+	limiter.spend(keys, 250)
+	retryAfter, isAllowed := limiter.allow(keys)
+	if isAllowed || retryAfter != 1500*time.Millisecond {
+		t.Errorf("expected request throttled for 1.5s of byte debt but got %v, %v", retryAfter, isAllowed)
+	}
+	now = now.Add(retryAfter)
+	if _, isAllowed := limiter.allow(keys); !isAllowed {
+		t.Errorf("expected request allowed after byte debt is earned back")
+	}
+	if newRateLimiter(0, 0) != nil {
+		t.Errorf("expected no rate limiter without limits")
+	}
+}
+
+// TestClientNamesPubkeyOnlyToPrivatePeer verifies that a client names its node's pubkey
+// only in the requests of a session proven to a private peer.
+func TestClientNamesPubkeyOnlyToPrivatePeer(t *testing.T) {
+	client := &Client{ctx: context.Background(), publisher: &mockPublisher, peerAddress: "127.0.0.1:1000"}
+	request, err := client.newRequest("GET", "http://127.0.0.1:1000/")
+	if err != nil {
+		t.Fatalf("newRequest error: %v", err)
+	}
+	if pubkey := request.Header.Get(PubkeyHeader); pubkey != "" {
+		t.Errorf("expected no pubkey named to a public peer but got %s", pubkey)
+	}
+
+	client.isPeerPrivate = true
+	client.challenge = "challenge"
+	client.challengeSignature = "signature"
+	client.authenticatedAt = time.Now()
+	request, err = client.newRequest("GET", "http://127.0.0.1:1000/")
+	if err != nil {
+		t.Fatalf("newRequest error: %v", err)
+	}
+	if pubkey := request.Header.Get(PubkeyHeader); pubkey != mockPubkey {
+		t.Errorf("expected pubkey %s named to a private peer but got %q", mockPubkey, pubkey)
+	}
+}
@@ -0,0 +1,335 @@
+package audiostrike
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+)
+
+// ReindexReport lists what Reindex changed to match the art records of a node to its payload files.
+type ReindexReport struct {
+	// AddedArtists are the hosted artists stored again for payload files of their tracks.
+	AddedArtists []*art.Artist
+	// AddedAlbums are the albums stored from the tags of payload files whose tracks had no album stored.
+	AddedAlbums []*art.Album
+	// AddedTracks are the tracks stored for payload files that had no track.
+	AddedTracks []*art.Track
+	// UpdatedTracks are the stored tracks whose container, or with rehash their payload hash,
+	// was corrected from their payload files.
+	UpdatedTracks []*art.Track
+	// MismatchedPayloads are the stored tracks whose payload files have another hash than the one signed,
+	// e.g. replaced or corrupted, which are kept unless rehash overwrites their hash.
+	MismatchedPayloads []*art.Track
+	// Unhosted are the paths of payload files without tracks of artists this node does not publish,
+	// which only the nodes of their artists can publish.
+	Unhosted []string
+	// MissingPayloads are the tracks without payload files, e.g. evicted or stored elsewhere, which are kept.
+	MissingPayloads []*art.Track
+	// Failed are the payload files that could not be read or stored.
+	Failed []ImportFailure
+	// Published are the ids of the artists whose art was signed and published again.
+	Published []string
+}
+
+// Changed tells whether Reindex stored any art.
+func (report ReindexReport) Changed() bool {
+	return len(report.AddedArtists) > 0 || len(report.AddedAlbums) > 0 ||
+		len(report.AddedTracks) > 0 || len(report.UpdatedTracks) > 0
+}
+
+// String summarizes the report, listing each change and problem on its own line.
+func (report ReindexReport) String() string {
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "added artists %d, albums %d, tracks %d, updated tracks %d, mismatched payloads %d, "+
+		"unhosted payloads %d, missing payloads %d, failed %d, published %d",
+		len(report.AddedArtists), len(report.AddedAlbums), len(report.AddedTracks), len(report.UpdatedTracks),
+		len(report.MismatchedPayloads), len(report.Unhosted), len(report.MissingPayloads), len(report.Failed),
+		len(report.Published))
+	for _, artist := range report.AddedArtists {
+		fmt.Fprintf(&summary, "\nadded artist %s", artist.ArtistId)
+	}
+	for _, album := range report.AddedAlbums {
+		fmt.Fprintf(&summary, "\nadded album %s/%s", album.ArtistId, album.ArtistAlbumId)
+	}
+	for _, track := range report.AddedTracks {
+		fmt.Fprintf(&summary, "\nadded track %s/%s", track.ArtistId, track.ArtistTrackId)
+	}
+	for _, track := range report.UpdatedTracks {
+		fmt.Fprintf(&summary, "\nupdated track %s/%s", track.ArtistId, track.ArtistTrackId)
+	}
+	for _, track := range report.MismatchedPayloads {
+		fmt.Fprintf(&summary, "\nmismatched payload of track %s/%s", track.ArtistId, track.ArtistTrackId)
+	}
+	for _, path := range report.Unhosted {
+		fmt.Fprintf(&summary, "\nunhosted payload %s", path)
+	}
+	for _, track := range report.MissingPayloads {
+		fmt.Fprintf(&summary, "\nmissing payload of track %s/%s", track.ArtistId, track.ArtistTrackId)
+	}
+	for _, failure := range report.Failed {
+		fmt.Fprintf(&summary, "\nfailed %s: %v", failure.Filename, failure.Err)
+	}
+	for _, artistID := range report.Published {
+		fmt.Fprintf(&summary, "\npublished %s", artistID)
+	}
+	return summary.String()
+}
+
+// Reindex rebuilds the art records of the artists this node publishes from the payload files under -payloaddir,
+// the truth when the records drift from the files, e.g. after the files are copied by hand.
+// A payload file without a track gets one, with the artist and album, from the tags of the file if it can be read,
+// or else named by its path. A stored track gets the container of its payload file.
+// A stored track whose payload file has another hash is reported, and gets the hash of the file only if rehash.
+// Then the art of each changed artist is signed and published again.
+// Payload files of other artists, which only their own nodes sign, and tracks without payload files are reported
+// but kept. Reindex is idempotent: once the records match the files, it changes nothing.
+func (server *AustkServer) Reindex(rehash bool) (ReindexReport, error) {
+	var report ReindexReport
+	payloadDir := filepath.Clean(server.config.payloadDir())
+	signingArtistIDs := make(map[string]bool)
+	// indexedPaths has the cleaned path of each payload file with a stored track.
+	indexedPaths := make(map[string]bool)
+	err := filepath.Walk(payloadDir, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		groups := artistTrackPayloadRegexp.FindStringSubmatch(strings.TrimPrefix(path, payloadDir))
+		if fileInfo.IsDir() || groups == nil {
+			return nil
+		}
+		artistID, artistTrackID, container := groups[1], groups[2], groups[3]
+		track, err := server.reindexPayload(path, artistID, artistTrackID, container, rehash, &report)
+		if err != nil {
+			report.Failed = append(report.Failed, ImportFailure{path, err})
+			return nil
+		}
+		if track != nil {
+			indexedPaths[filepath.Clean(path)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		server.logger.Error("failed to walk payload files", "path", payloadDir, "error", err)
+		return report, err
+	}
+
+	artists, err := server.artServer.Artists()
+	if err != nil {
+		server.logger.Error("failed to get artists", "error", err)
+		return report, err
+	}
+	artistIDs := make([]string, 0, len(artists))
+	for artistID := range artists {
+		artistIDs = append(artistIDs, artistID)
+	}
+	for _, artistID := range sortedPage(artistIDs, 0, -1) {
+		tracks, err := server.artServer.Tracks(artistID)
+		if err != nil {
+			server.logger.Error("failed to get tracks", "artist_id", artistID, "error", err)
+			return report, err
+		}
+		for _, track := range pageTracks(tracks, 0, -1) {
+			trackFilePath := server.artServer.TrackFilePath(track)
+			if trackFilePath != "" && !indexedPaths[filepath.Clean(trackFilePath)] {
+				report.MissingPayloads = append(report.MissingPayloads, track)
+			}
+		}
+	}
+
+	for _, artist := range report.AddedArtists {
+		signingArtistIDs[server.signingArtistID(artist.ArtistId)] = true
+	}
+	for _, track := range append(report.AddedTracks, report.UpdatedTracks...) {
+		signingArtistIDs[server.signingArtistID(track.ArtistId)] = true
+	}
+	for artistID := range signingArtistIDs {
+		report.Published = append(report.Published, artistID)
+	}
+	sort.Strings(report.Published)
+	for _, artistID := range report.Published {
+		err = server.publish(artistID)
+		if err != nil {
+			return report, err
+		}
+	}
+	server.logger.Info("reindexed payloads", "path", payloadDir, "added_tracks", len(report.AddedTracks),
+		"updated_tracks", len(report.UpdatedTracks), "mismatched_payloads", len(report.MismatchedPayloads),
+		"unhosted", len(report.Unhosted),
+		"missing_payloads", len(report.MissingPayloads), "failed", len(report.Failed), "published", report.Published)
+	return report, nil
+}
+
+// reindexPayload reconciles the track artistID/artistTrackID with its payload file at path, in container,
+// overwriting a mismatched payload hash only if rehash, and recording any change in report.
+// It gets the stored track of the file, or nil if the file is left unindexed.
+func (server *AustkServer) reindexPayload(path string, artistID string, artistTrackID string, container string,
+	rehash bool, report *ReindexReport) (*art.Track, error) {
+	logger := server.logger.With("artist_id", artistID, "track_id", artistTrackID, "path", path)
+	artist, err := server.artServer.Artist(artistID)
+	if err != nil && err != ErrArtNotFound {
+		return nil, err
+	}
+	_, hostedErr := server.PublishingArtist(artistID)
+	isHosted := hostedErr == nil
+
+	storedTrack, err := server.artServer.Track(artistID, artistTrackID)
+	if err != nil && err != ErrArtNotFound {
+		return nil, err
+	}
+	if storedTrack != nil && filepath.Clean(server.artServer.TrackFilePath(storedTrack)) != filepath.Clean(path) {
+		// The stored track names a payload file in another container, which is the truth if it exists.
+		if _, err := os.Stat(server.artServer.TrackFilePath(storedTrack)); err == nil || !isHosted {
+			logger.Info("skip payload file in another container than its stored track")
+			return nil, nil
+		}
+	}
+	if !isHosted {
+		if storedTrack == nil {
+			logger.Info("skip payload of track of an artist this node does not publish")
+			report.Unhosted = append(report.Unhosted, path)
+			return nil, nil
+		}
+		return storedTrack, nil // The track's own node signs its hash, which -verify checks.
+	}
+
+	payloadHash, err := hashFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if storedTrack != nil {
+		updatedTrack := proto.Clone(storedTrack).(*art.Track)
+		updatedTrack.Container = containerOfPayload(storedTrack, container)
+		isMismatched := !bytes.Equal(payloadHash, storedTrack.PayloadSha256)
+		if isMismatched && !rehash {
+			logger.Warn("keep hash of track whose payload file has another hash, which -rehash overwrites",
+				"hash", fmt.Sprintf("%x", payloadHash), "stored_hash", fmt.Sprintf("%x", storedTrack.PayloadSha256))
+			report.MismatchedPayloads = append(report.MismatchedPayloads, storedTrack)
+			return storedTrack, nil
+		}
+		updatedTrack.PayloadSha256 = payloadHash
+		if proto.Equal(updatedTrack, storedTrack) {
+			return storedTrack, nil
+		}
+		err = server.artServer.StoreTrack(updatedTrack, server)
+		if err != nil {
+			logger.Error("failed to store track", "error", err)
+			return nil, err
+		}
+		logger.Info("updated track from its payload file", "container", updatedTrack.Container, "rehashed", isMismatched)
+		report.UpdatedTracks = append(report.UpdatedTracks, updatedTrack)
+		return updatedTrack, nil
+	}
+
+	if artist == nil {
+		artist, err = server.PublishingArtist(artistID)
+		if err != nil {
+			return nil, err
+		}
+		err = server.artServer.StoreArtist(artist)
+		if err != nil {
+			logger.Error("failed to store artist", "error", err)
+			return nil, err
+		}
+		logger.Info("stored artist for payload file")
+		report.AddedArtists = append(report.AddedArtists, artist)
+	}
+	track, err := server.reindexedTrack(path, artistID, artistTrackID, container, report)
+	if err != nil {
+		return nil, err
+	}
+	track.PayloadSha256 = payloadHash
+	err = server.artServer.StoreTrack(track, server)
+	if err != nil {
+		logger.Error("failed to store track", "error", err)
+		return nil, err
+	}
+	logger.Info("stored track for payload file", "title", track.Title, "album_id", track.ArtistAlbumId)
+	report.AddedTracks = append(report.AddedTracks, track)
+	return track, nil
+}
+
+// reindexedTrack gets the track artistID/artistTrackID for its payload file at path, in container,
+// from the tags of the file, storing its album if not yet stored, or else named by its path
+// if the file cannot be read.
+func (server *AustkServer) reindexedTrack(path string, artistID string, artistTrackID string, container string,
+	report *ReindexReport) (*art.Track, error) {
+	logger := server.logger.With("artist_id", artistID, "track_id", artistTrackID, "path", path)
+	audio, err := OpenAudioFile(path)
+	if err != nil {
+		logger.Warn("name track by its payload path without tags", "error", err)
+		return &art.Track{ArtistId: artistID, ArtistTrackId: artistTrackID, Title: pathTitle(artistTrackID),
+			Container: container}, nil
+	}
+	_, album, track := AudioFileArt(audio)
+	track.ArtistId, track.ArtistTrackId = artistID, artistTrackID
+	track.ArtistAlbumId = ""
+	if album != nil {
+		album.ArtistId = artistID
+		// A payload file under an album's directory keeps that album's id, which may have been disambiguated.
+		if albumDir := filepath.Dir(artistTrackID); albumDir != "." {
+			album.ArtistAlbumId = albumDir
+		} else {
+			album.ArtistAlbumId, err = AlbumHierarchy(server.artServer, server.config.hierarchyRules(), artistID, album.Title)
+			if err != nil {
+				return nil, err
+			}
+		}
+		track.ArtistAlbumId = album.ArtistAlbumId
+		albums, err := server.artServer.Albums(artistID)
+		if err != nil {
+			return nil, err
+		}
+		if albums[album.ArtistAlbumId] == nil {
+			err = server.artServer.StoreAlbum(album, server)
+			if err != nil {
+				logger.Error("failed to store album", "album_id", album.ArtistAlbumId, "error", err)
+				return nil, err
+			}
+			err = server.storeAlbumCover(album, audio.CoverArt())
+			if err != nil {
+				logger.Warn("store album without cover art", "album_id", album.ArtistAlbumId, "error", err)
+			}
+			report.AddedAlbums = append(report.AddedAlbums, album)
+		}
+	}
+	track.Loudness, err = measureLoudness(audio)
+	if err != nil {
+		logger.Warn("store track without loudness", "error", err)
+	}
+	track.DurationMs, err = measureDuration(audio)
+	if err != nil {
+		logger.Warn("store track without duration", "error", err)
+	}
+	return track, nil
+}
+
+// containerOfPayload gets the Container to record on track for its payload file in container,
+// keeping the empty Container that means mp3.
+func containerOfPayload(track *art.Track, container string) string {
+	if TrackContainer(track) == container {
+		return track.Container
+	}
+	return container
+}
+
+// pathTitle gets a title for a track named only by its artistTrackID, the last part of its path.
+func pathTitle(artistTrackID string) string {
+	return path.Base(artistTrackID)
+}
+
+// hashFile gets the SHA-256 hash of the file at filename without reading it all into memory.
+func hashFile(filename string) ([]byte, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return hashPayload(file)
+}
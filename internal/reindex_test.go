@@ -0,0 +1,130 @@
+package audiostrike
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// TestReindex verifies that payload files copied by hand get tracks, from their tags or else their paths,
+// that stored tracks keep their hash when their payload files differ unless rehashed, that payloads of unhosted
+// artists, even when stored, and tracks without payloads are only reported,
+// and that reindexing again changes nothing.
+func TestReindex(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	for _, artist := range []*art.Artist{&mockArtist, {ArtistId: "bob", Name: "Bob", Pubkey: "foreignpubkey"}} {
+		err = fileServer.StoreArtist(artist)
+		if err != nil {
+			t.Fatalf("StoreArtist %s error: %v", artist.ArtistId, err)
+		}
+	}
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	reindexCfg := *cfg
+	reindexCfg.ArtDir = artDir
+	austkServer, err := NewAustkServer(&reindexCfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+
+	editedTrack := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "edited", Title: "Edited"}
+	missingTrack := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "missing", Title: "Missing"}
+	for _, track := range []*art.Track{editedTrack, missingTrack} {
+		err = fileServer.StoreTrack(track, mockLightningNode)
+		if err != nil {
+			t.Fatalf("StoreTrack %s error: %v", track.ArtistTrackId, err)
+		}
+	}
+	err = fileServer.StoreTrackPayload(editedTrack, []byte("first take"))
+	if err != nil {
+		t.Fatalf("StoreTrackPayload error: %v", err)
+	}
+	payloadFiles := map[string][]byte{
+		filepath.Join(mockArtistID, "edited.mp3"): []byte("second take"),
+		filepath.Join(mockArtistID, "would.wav"):  wavWithInfo("IART", "Alice the Artist", "INAM", "Would?", "IPRD", "Dirt"),
+		filepath.Join(mockArtistID, "rough.flac"): []byte("not flac"),
+		filepath.Join("bob", "synced.mp3"):        []byte("bob's track"),
+	}
+	for filename, payload := range payloadFiles {
+		err = writePayloadFile(filepath.Join(artDir, filename), payload)
+		if err != nil {
+			t.Fatalf("writePayloadFile %s error: %v", filename, err)
+		}
+	}
+
+	report, err := austkServer.Reindex(false)
+	if err != nil {
+		t.Fatalf("Reindex error: %v", err)
+	}
+	if len(report.AddedTracks) != 2 || len(report.UpdatedTracks) != 0 || len(report.MismatchedPayloads) != 1 ||
+		len(report.AddedAlbums) != 1 || len(report.AddedArtists) != 0 || len(report.Unhosted) != 1 ||
+		len(report.MissingPayloads) != 1 || len(report.Failed) != 0 ||
+		len(report.Published) != 1 || report.Published[0] != mockArtistID {
+		t.Errorf("expected 2 tracks added, 1 mismatched, 1 album added, 1 unhosted, 1 missing, and %s published "+
+			"but got %v", mockArtistID, report)
+	}
+
+	firstTakeHash := sha256.Sum256([]byte("first take"))
+	track, err := fileServer.Track(mockArtistID, "edited")
+	if err != nil || !bytes.Equal(track.PayloadSha256, firstTakeHash[:]) {
+		t.Errorf("expected edited track to keep its signed hash without rehash but got %v, error: %v", track, err)
+	}
+	track, err = fileServer.Track(mockArtistID, "would")
+	if err != nil || track.Title != "Would?" || track.ArtistAlbumId != "dirt" || track.Container != ContainerWav ||
+		len(track.PayloadSha256) == 0 {
+		t.Errorf("expected track from the tags of its payload file but got %v, error: %v", track, err)
+	}
+	albums, err := fileServer.Albums(mockArtistID)
+	if err != nil || albums["dirt"] == nil {
+		t.Errorf("expected album from the tags of a payload file but got %v, error: %v", albums, err)
+	}
+	track, err = fileServer.Track(mockArtistID, "rough")
+	if err != nil || track.Title != "rough" || track.Container != ContainerFlac {
+		t.Errorf("expected track named by the path of its unreadable payload file but got %v, error: %v", track, err)
+	}
+	_, err = fileServer.Track("bob", "synced")
+	if err != ErrArtNotFound {
+		t.Errorf("expected no track for payload of unhosted artist but got error %v", err)
+	}
+	err = fileServer.VerifyStoredTrack(&art.Track{ArtistId: mockArtistID, ArtistTrackId: "would"})
+	if err != nil {
+		t.Errorf("expected reindexed track to verify against its payload file but got %v", err)
+	}
+
+	report, err = austkServer.Reindex(false)
+	if err != nil || report.Changed() || len(report.Published) != 0 || len(report.MismatchedPayloads) != 1 {
+		t.Errorf("expected reindexing again to change nothing but report the mismatch but got %v, error: %v",
+			report, err)
+	}
+
+	report, err = austkServer.Reindex(true)
+	if err != nil || len(report.UpdatedTracks) != 1 || len(report.MismatchedPayloads) != 0 ||
+		len(report.Published) != 1 {
+		t.Errorf("expected rehash to update the mismatched track and publish it but got %v, error: %v", report, err)
+	}
+	secondTakeHash := sha256.Sum256([]byte("second take"))
+	track, err = fileServer.Track(mockArtistID, "edited")
+	if err != nil || !bytes.Equal(track.PayloadSha256, secondTakeHash[:]) || track.Title != "Edited" {
+		t.Errorf("expected edited track with hash of its payload file and its title kept but got %v, error: %v", track, err)
+	}
+
+	report, err = austkServer.Reindex(true)
+	if err != nil || report.Changed() || len(report.Published) != 0 {
+		t.Errorf("expected rehashing again to change nothing but got %v, error: %v", report, err)
+	}
+}
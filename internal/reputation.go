@@ -0,0 +1,190 @@
+package audiostrike
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+const (
+	// peerBackoff is how long to skip a peer after its first failure. It doubles with each further failure.
+	peerBackoff = time.Hour
+	// maxPeerBackoff is the longest to skip a peer, however many times it failed.
+	maxPeerBackoff = 7 * 24 * time.Hour
+)
+
+// PeerTracker tracks the reputation of peers in an ArtServer, so a node stops syncing from a peer
+// that fails signature validation or serves bad payloads until a cooldown elapses.
+// The cooldown doubles with each failure since the last successful sync from the peer.
+// It also tracks when each peer last answered and last synced, to sync first from peers reachable recently,
+// and which peers did not answer, to back off from dialing gossiped peers that never do.
+type PeerTracker struct {
+	artServer ArtServer
+	// now gets the current Unix time.
+	now    func() uint64
+	logger *slog.Logger
+
+	// dialFailures maps the pubkey of each peer that did not answer since it last synced to its failed dials,
+	// kept in memory only, since gossip may name any number of unreachable peers.
+	dialFailures map[string]*dialFailure
+	dialMutex    sync.Mutex
+}
+
+// dialFailure counts the dials of a peer that failed since it last synced.
+type dialFailure struct {
+	count         uint32
+	lastFailureAt uint64
+}
+
+// NewPeerTracker creates a PeerTracker storing peer reputations in artServer.
+func NewPeerTracker(artServer ArtServer) *PeerTracker {
+	return &PeerTracker{
+		artServer: artServer,
+		now:       nowUnix,
+		logger:    componentLogger("peerTracker"),
+
+		dialFailures: make(map[string]*dialFailure),
+	}
+}
+
+// RecordPeerFailure records that peer failed for the given reason, to back off from syncing with it.
+func (tracker *PeerTracker) RecordPeerFailure(peer *art.Peer, reason error) {
+	logger := tracker.logger.With("peer", peer.Pubkey)
+
+	reputation, err := tracker.artServer.PeerReputation(peer.Pubkey)
+	if err != nil {
+		logger.Error("failed to get peer reputation", "error", err)
+		return
+	}
+	reputation.FailureCount++
+	reputation.LastFailureAt = tracker.now()
+	// Each failure recorded is of a peer that answered but misbehaved.
+	reputation.LastSeenAt = reputation.LastFailureAt
+	reputation.LastFailureReason = reason.Error()
+	logger.Warn("peer failed, skip it until its cooldown elapses",
+		"failures", reputation.FailureCount, "cooldown", backoff(reputation), "reason", reason)
+	err = tracker.artServer.StorePeerReputation(reputation)
+	if err != nil {
+		logger.Error("failed to store peer reputation", "error", err)
+	}
+}
+
+// RecordPeerUnreachable records that peer did not answer, to back off from dialing it if it is gossiped.
+// Failed dials of peers that last failed over maxPeerBackoff ago are forgotten.
+func (tracker *PeerTracker) RecordPeerUnreachable(peer *art.Peer, reason error) {
+	tracker.dialMutex.Lock()
+	defer tracker.dialMutex.Unlock()
+	now := tracker.now()
+	for pubkey, failure := range tracker.dialFailures {
+		if failure.lastFailureAt+uint64(maxPeerBackoff/time.Second) < now {
+			delete(tracker.dialFailures, pubkey)
+		}
+	}
+	failure := tracker.dialFailures[peer.Pubkey]
+	if failure == nil {
+		failure = &dialFailure{}
+		tracker.dialFailures[peer.Pubkey] = failure
+	}
+	failure.count++
+	failure.lastFailureAt = now
+	tracker.logger.Info("peer unreachable, skip dialing it if gossiped until its cooldown elapses",
+		"peer", peer.Pubkey, "failures", failure.count, "cooldown", backoffAfter(failure.count), "reason", reason)
+}
+
+// ShouldDialPeer checks whether the cooldown after peer last failed to answer has elapsed.
+func (tracker *PeerTracker) ShouldDialPeer(peer *art.Peer) bool {
+	tracker.dialMutex.Lock()
+	defer tracker.dialMutex.Unlock()
+	failure := tracker.dialFailures[peer.Pubkey]
+	if failure == nil {
+		return true
+	}
+	return tracker.now() >= failure.lastFailureAt+uint64(backoffAfter(failure.count)/time.Second)
+}
+
+// RecordPeerSuccess records that peer synced successfully, which resets its failures
+// and marks it as reachable now.
+func (tracker *PeerTracker) RecordPeerSuccess(peer *art.Peer) {
+	tracker.dialMutex.Lock()
+	delete(tracker.dialFailures, peer.Pubkey)
+	tracker.dialMutex.Unlock()
+
+	now := tracker.now()
+	err := tracker.artServer.StorePeerReputation(&art.PeerReputation{
+		Pubkey:          peer.Pubkey,
+		LastSeenAt:      now,
+		LastReachableAt: now,
+	})
+	if err != nil {
+		tracker.logger.Error("failed to store peer reputation", "peer", peer.Pubkey, "error", err)
+	}
+}
+
+// ShouldSyncPeer checks whether the cooldown after the last failure of peer has elapsed.
+// It lets a node sync from a peer whose reputation cannot be read rather than skip it.
+func (tracker *PeerTracker) ShouldSyncPeer(peer *art.Peer) bool {
+	reputation, err := tracker.artServer.PeerReputation(peer.Pubkey)
+	if err != nil {
+		tracker.logger.Error("failed to get peer reputation", "peer", peer.Pubkey, "error", err)
+		return true
+	}
+	if reputation.FailureCount == 0 {
+		return true
+	}
+	retryAt := reputation.LastFailureAt + uint64(backoff(reputation)/time.Second)
+	return tracker.now() >= retryAt
+}
+
+// ReachablePeers gets the stored peers synced successfully within since of now,
+// the most recently reachable first.
+func (tracker *PeerTracker) ReachablePeers(since time.Duration) ([]*art.Peer, error) {
+	peers, err := tracker.artServer.Peers()
+	if err != nil {
+		return nil, err
+	}
+	var reachableAfter uint64
+	if now, sinceSeconds := tracker.now(), uint64(since/time.Second); sinceSeconds < now {
+		reachableAfter = now - sinceSeconds
+	}
+	var reachablePeers []*art.Peer
+	lastReachableAt := make(map[string]uint64)
+	for pubkey, peer := range peers {
+		reputation, err := tracker.artServer.PeerReputation(pubkey)
+		if err != nil {
+			return nil, err
+		}
+		if reputation.LastReachableAt == 0 || reputation.LastReachableAt < reachableAfter {
+			continue // to next peer, not reachable recently
+		}
+		lastReachableAt[pubkey] = reputation.LastReachableAt
+		reachablePeers = append(reachablePeers, peer)
+	}
+	sort.Slice(reachablePeers, func(i, j int) bool {
+		a, b := reachablePeers[i], reachablePeers[j]
+		if lastReachableAt[a.Pubkey] != lastReachableAt[b.Pubkey] {
+			return lastReachableAt[a.Pubkey] > lastReachableAt[b.Pubkey]
+		}
+		return a.Pubkey < b.Pubkey
+	})
+	return reachablePeers, nil
+}
+
+// backoff gets how long to skip a peer with the given reputation after its last failure.
+func backoff(reputation *art.PeerReputation) time.Duration {
+	return backoffAfter(reputation.FailureCount)
+}
+
+// backoffAfter gets how long to skip a peer after the last of failureCount failures.
+func backoffAfter(failureCount uint32) time.Duration {
+	duration := peerBackoff
+	for i := uint32(1); i < failureCount && duration < maxPeerBackoff; i++ {
+		duration *= 2
+	}
+	if duration > maxPeerBackoff {
+		return maxPeerBackoff
+	}
+	return duration
+}
@@ -0,0 +1,150 @@
+package audiostrike
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// TestPeerTrackerBackoff tests that a failed peer is skipped for a cooldown that doubles with each failure
+// and that a successful sync resets its failures.
+func TestPeerTrackerBackoff(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	var now uint64 = 1600000000
+	tracker := NewPeerTracker(fileServer)
+	tracker.now = func() uint64 { return now }
+	peer := &art.Peer{Pubkey: mockPubkey}
+	hour := uint64(time.Hour / time.Second)
+
+	if !tracker.ShouldSyncPeer(peer) {
+		t.Errorf("expected to sync from peer without failures")
+	}
+
+	tracker.RecordPeerFailure(peer, ErrSignatureInvalid)
+	now += hour - 1
+	if tracker.ShouldSyncPeer(peer) {
+		t.Errorf("expected to skip peer until an hour after its first failure")
+	}
+	now++
+	if !tracker.ShouldSyncPeer(peer) {
+		t.Errorf("expected to sync from peer an hour after its first failure")
+	}
+
+	tracker.RecordPeerFailure(peer, errors.New("second failure"))
+	now += 2*hour - 1
+	if tracker.ShouldSyncPeer(peer) {
+		t.Errorf("expected to skip peer until two hours after its second failure")
+	}
+
+	// The reputation persists for the next FileServer reading the art directory.
+	rereadFileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	reputation, err := rereadFileServer.PeerReputation(mockPubkey)
+	if err != nil || reputation.FailureCount != 2 || reputation.LastFailureReason != "second failure" {
+		t.Errorf("expected reputation with 2 failures but got %v, error: %v", reputation, err)
+	}
+
+	tracker.RecordPeerSuccess(peer)
+	if !tracker.ShouldSyncPeer(peer) {
+		t.Errorf("expected to sync from peer after a successful sync")
+	}
+
+	// The cooldown stops doubling at the maximum backoff.
+	for i := 0; i < 20; i++ {
+		tracker.RecordPeerFailure(peer, ErrPayloadMismatch)
+	}
+	now += uint64(maxPeerBackoff / time.Second)
+	if !tracker.ShouldSyncPeer(peer) {
+		t.Errorf("expected to sync from peer after the maximum backoff")
+	}
+}
+
+// TestPeerTrackerDialBackoff tests that a peer that did not answer is not dialed for a cooldown
+// that doubles with each failed dial, without storing its reputation, and that a successful sync resets it.
+func TestPeerTrackerDialBackoff(t *testing.T) {
+	memoryServer := NewMemoryArtServer()
+	var now uint64 = 1600000000
+	tracker := NewPeerTracker(memoryServer)
+	tracker.now = func() uint64 { return now }
+	peer := &art.Peer{Pubkey: mockPubkey}
+	hour := uint64(time.Hour / time.Second)
+
+	tracker.RecordPeerUnreachable(peer, errors.New("connection refused"))
+	tracker.RecordPeerUnreachable(peer, errors.New("connection refused"))
+	now += 2*hour - 1
+	if tracker.ShouldDialPeer(peer) {
+		t.Errorf("expected to skip dialing peer until two hours after its second failed dial")
+	}
+	if !tracker.ShouldSyncPeer(peer) {
+		t.Errorf("expected a peer that did not answer to keep its stored reputation")
+	}
+	now++
+	if !tracker.ShouldDialPeer(peer) {
+		t.Errorf("expected to dial peer two hours after its second failed dial")
+	}
+
+	tracker.RecordPeerUnreachable(peer, errors.New("connection refused"))
+	tracker.RecordPeerSuccess(peer)
+	if !tracker.ShouldDialPeer(peer) {
+		t.Errorf("expected to dial peer after a successful sync")
+	}
+}
+
+// TestReachablePeers tests that the peers synced recently are reachable, the most recent first,
+// and that a peer that answered but failed is seen without being reachable.
+func TestReachablePeers(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	var now uint64 = 1600000000
+	tracker := NewPeerTracker(fileServer)
+	tracker.now = func() uint64 { return now }
+	hour := uint64(time.Hour / time.Second)
+
+	peers := make([]*art.Peer, 3)
+	for i, pubkey := range []string{"stale", "recent", "failed"} {
+		peers[i] = &art.Peer{Pubkey: pubkey, Host: pubkey + ".onion", Port: 53545}
+		err = fileServer.StorePublication(peerPublication(peers[i]))
+		if err != nil {
+			t.Fatalf("StorePublication of peer %s error: %v", pubkey, err)
+		}
+	}
+	tracker.RecordPeerSuccess(peers[0])
+	now += 2 * hour
+	tracker.RecordPeerSuccess(peers[1])
+	tracker.RecordPeerFailure(peers[2], ErrSignatureInvalid)
+
+	reachablePeers, err := tracker.ReachablePeers(time.Hour)
+	if err != nil || len(reachablePeers) != 1 || reachablePeers[0].Pubkey != "recent" {
+		t.Errorf("expected recent peer reachable within an hour but got %v, error: %v", reachablePeers, err)
+	}
+	reachablePeers, err = tracker.ReachablePeers(3 * time.Hour)
+	if err != nil || len(reachablePeers) != 2 || reachablePeers[0].Pubkey != "recent" || reachablePeers[1].Pubkey != "stale" {
+		t.Errorf("expected recent then stale peer reachable within 3 hours but got %v, error: %v", reachablePeers, err)
+	}
+
+	reputation, err := fileServer.PeerReputation("failed")
+	if err != nil || reputation.LastSeenAt != now || reputation.LastReachableAt != 0 {
+		t.Errorf("expected failed peer seen at %d but never reachable, got %v, error: %v", now, reputation, err)
+	}
+}
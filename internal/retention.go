@@ -0,0 +1,137 @@
+package audiostrike
+
+import (
+	"os"
+	"sort"
+	"sync"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// storageRetention records the bytes of payloads stored when EnforceRetention last measured them, for /status.
+type storageRetention struct {
+	// enforceMutex lets one EnforceRetention run at a time.
+	enforceMutex sync.Mutex
+
+	mutex       sync.Mutex
+	isMeasured  bool
+	storedBytes uint64
+}
+
+// evictionCandidate is a synced track whose payload may be evicted, with its size and when it was last used.
+type evictionCandidate struct {
+	track      *art.Track
+	size       uint64
+	lastUsedAt uint64
+}
+
+// EnforceRetention evicts the payloads of synced tracks, least recently played first, until the stored payloads
+// take at most -maxstorage bytes. The tracks of the artists hosted by this node are never evicted.
+// It returns the tracks it evicted, keeping their art to download them again.
+func (server *AustkServer) EnforceRetention() ([]*art.Track, error) {
+	maxBytes := server.config.MaxStorageBytes
+	if maxBytes == 0 {
+		return nil, nil
+	}
+	server.retention.enforceMutex.Lock()
+	defer server.retention.enforceMutex.Unlock()
+
+	artists, err := server.artServer.Artists()
+	if err != nil {
+		server.logger.Error("failed to get artists to enforce retention", "error", err)
+		return nil, err
+	}
+	var storedBytes uint64
+	var candidates []evictionCandidate
+	for artistID := range artists {
+		tracks, err := server.artServer.Tracks(artistID)
+		if err != nil {
+			server.logger.Error("failed to get tracks to enforce retention", "artist_id", artistID, "error", err)
+			return nil, err
+		}
+		_, err = server.PublishingArtist(artistID)
+		isHosted := err == nil
+		for _, track := range tracks {
+			size, err := server.trackPayloadSize(track)
+			if err != nil {
+				continue // to next track, whose payload is not stored
+			}
+			storedBytes += uint64(size)
+			if isHosted {
+				continue // to next track, which this node publishes
+			}
+			lastUsedAt, err := server.lastUsedAt(track)
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, evictionCandidate{track: track, size: uint64(size), lastUsedAt: lastUsedAt})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.lastUsedAt != b.lastUsedAt {
+			return a.lastUsedAt < b.lastUsedAt
+		}
+		if a.track.ArtistId != b.track.ArtistId {
+			return a.track.ArtistId < b.track.ArtistId
+		}
+		return a.track.ArtistTrackId < b.track.ArtistTrackId
+	})
+
+	var evictedTracks []*art.Track
+	for _, candidate := range candidates {
+		if storedBytes <= maxBytes {
+			break
+		}
+		logger := server.logger.With("artist_id", candidate.track.ArtistId, "track_id", candidate.track.ArtistTrackId)
+		err = server.artServer.EvictTrack(candidate.track)
+		if err != nil {
+			logger.Error("failed to evict track payload", "error", err)
+			break
+		}
+		storedBytes -= candidate.size
+		logger.Info("evicted track payload", "bytes", candidate.size, "last_used_at", candidate.lastUsedAt)
+		evictedTracks = append(evictedTracks, candidate.track)
+	}
+	if err == nil && storedBytes > maxBytes {
+		server.logger.Warn("payloads of hosted artists exceed -maxstorage", "stored_bytes", storedBytes, "max_bytes", maxBytes)
+	}
+
+	server.retention.mutex.Lock()
+	server.retention.isMeasured = true
+	server.retention.storedBytes = storedBytes
+	server.retention.mutex.Unlock()
+	return evictedTracks, err
+}
+
+// lastUsedAt gets the Unix time track was last played from this node, or else when its payload was stored.
+func (server *AustkServer) lastUsedAt(track *art.Track) (uint64, error) {
+	stats, err := server.trackStats.trackStats(track.ArtistId, track.ArtistTrackId)
+	if err != nil {
+		return 0, err
+	}
+	if stats.LastPlayedAt != 0 {
+		return stats.LastPlayedAt, nil
+	}
+	if trackFilePath := server.artServer.TrackFilePath(track); trackFilePath != "" {
+		if fileInfo, err := os.Stat(trackFilePath); err == nil {
+			return uint64(fileInfo.ModTime().Unix()), nil
+		}
+	}
+	return track.UpdatedAt, nil
+}
+
+// storageStatus gets the bytes of payloads stored, as last measured, and those left under -maxstorage,
+// or false if there is no -maxstorage or the payloads were not measured yet.
+func (server *AustkServer) storageStatus() (storedBytes uint64, remainingBytes uint64, isMeasured bool) {
+	server.retention.mutex.Lock()
+	defer server.retention.mutex.Unlock()
+	maxBytes := server.config.MaxStorageBytes
+	if maxBytes == 0 || !server.retention.isMeasured {
+		return 0, 0, false
+	}
+	if server.retention.storedBytes < maxBytes {
+		remainingBytes = maxBytes - server.retention.storedBytes
+	}
+	return server.retention.storedBytes, remainingBytes, true
+}
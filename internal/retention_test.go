@@ -0,0 +1,126 @@
+package audiostrike
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/gorilla/mux"
+)
+
+// TestEnforceRetention verifies that the payloads of synced tracks are evicted, least recently played
+// or downloaded first, until the payloads fit in -maxstorage, and that hosted tracks are never evicted.
+func TestEnforceRetention(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	retentionCfg := *cfg
+	retentionCfg.MaxStorageBytes = 25
+	austkServer, err := NewAustkServer(&retentionCfg, fileServer, &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	for _, artist := range []*art.Artist{&mockArtist, {ArtistId: "bob", Name: "Bob", Pubkey: "03" + mockPubkey[2:]}} {
+		err = fileServer.StoreArtist(artist)
+		if err != nil {
+			t.Fatalf("StoreArtist %s error: %v", artist.ArtistId, err)
+		}
+	}
+
+	now := time.Now()
+	tracks := []struct {
+		artistID     string
+		trackID      string
+		lastPlayedAt time.Time
+		downloadedAt time.Time
+	}{
+		{mockArtistID, "hosted", time.Time{}, now.Add(-30 * 24 * time.Hour)},
+		{"bob", "replayed", now, now.Add(-10 * 24 * time.Hour)},
+		{"bob", "forgotten", now.Add(-48 * time.Hour), now.Add(-5 * 24 * time.Hour)},
+		{"bob", "unplayed", time.Time{}, now.Add(-24 * time.Hour)},
+	}
+	for _, test := range tracks {
+		track := &art.Track{ArtistId: test.artistID, ArtistTrackId: test.trackID, Title: test.trackID}
+		err = fileServer.StoreTrack(track, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreTrack %s error: %v", test.trackID, err)
+		}
+		err = fileServer.StoreTrackPayload(track, []byte("ten bytes!"))
+		if err != nil {
+			t.Fatalf("StoreTrackPayload %s error: %v", test.trackID, err)
+		}
+		err = os.Chtimes(fileServer.TrackFilePath(track), test.downloadedAt, test.downloadedAt)
+		if err != nil {
+			t.Fatalf("Chtimes %s error: %v", test.trackID, err)
+		}
+		if !test.lastPlayedAt.IsZero() {
+			err = fileServer.StoreTrackStats(&art.TrackStats{ArtistId: test.artistID, ArtistTrackId: test.trackID,
+				Plays: 1, LastPlayedAt: uint64(test.lastPlayedAt.Unix())})
+			if err != nil {
+				t.Fatalf("StoreTrackStats %s error: %v", test.trackID, err)
+			}
+		}
+	}
+
+	evictedTracks, err := austkServer.EnforceRetention()
+	if err != nil || len(evictedTracks) != 2 ||
+		evictedTracks[0].ArtistTrackId != "forgotten" || evictedTracks[1].ArtistTrackId != "unplayed" {
+		t.Errorf("expected forgotten then unplayed evicted but got %v, error: %v", evictedTracks, err)
+	}
+	for _, test := range tracks {
+		track, err := fileServer.Track(test.artistID, test.trackID)
+		if err != nil || track == nil {
+			t.Errorf("expected track %s still stored but got %v, error: %v", test.trackID, track, err)
+			continue
+		}
+		_, err = os.Stat(fileServer.TrackFilePath(track))
+		isEvicted := test.trackID == "forgotten" || test.trackID == "unplayed"
+		if isEvicted != os.IsNotExist(err) {
+			t.Errorf("expected payload of %s evicted %v but got stat error %v", test.trackID, isEvicted, err)
+		}
+	}
+	request := httptest.NewRequest("GET", "/art/bob/forgotten", nil)
+	request = mux.SetURLVars(request, map[string]string{"artist": "bob", "track": "forgotten"})
+	recorder := httptest.NewRecorder()
+	austkServer.getArtHandler(recorder, request)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected evicted payload not found but got %d", recorder.Code)
+	}
+	memoryServer := NewMemoryArtServer()
+	memoryTrack := &art.Track{ArtistId: "bob", ArtistTrackId: "forgotten", Title: "forgotten"}
+	err = memoryServer.StoreTrack(memoryTrack, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	err = memoryServer.StoreTrackPayload(memoryTrack, []byte("ten bytes!"))
+	if err != nil {
+		t.Fatalf("StoreTrackPayload error: %v", err)
+	}
+	err = memoryServer.EvictTrack(memoryTrack)
+	if err != nil {
+		t.Fatalf("EvictTrack error: %v", err)
+	}
+	memoryAustkServer, err := NewAustkServer(&retentionCfg, memoryServer, &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	recorder = httptest.NewRecorder()
+	memoryAustkServer.getArtHandler(recorder, request)
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("expected payload evicted from memory not found but got %d", recorder.Code)
+	}
+	status := austkServer.Status()
+	if status.StoredBytes == nil || *status.StoredBytes != 20 || status.RemainingBytes == nil || *status.RemainingBytes != 5 {
+		t.Errorf("expected 20 bytes stored and 5 remaining in status but got %+v", status)
+	}
+}
@@ -0,0 +1,307 @@
+package audiostrike
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+	// s3Service is the service name in the scope of an S3 request signature.
+	s3Service = "s3"
+	// amzDateFormat is the format of the time with which a request is signed.
+	amzDateFormat = "20060102T150405Z"
+	// s3Timeout limits each request to the s3 service, including reading its reply,
+	// long enough to transfer a large payload but not to hang on a service that stops answering.
+	s3Timeout = 10 * time.Minute
+)
+
+// S3PayloadStore stores track payloads as objects in a bucket of an S3-compatible service, e.g. AWS S3 or MinIO.
+// The bucket is addressed in the path of each request, which MinIO requires, and each request is signed
+// with AWS Signature Version 4.
+type S3PayloadStore struct {
+	endpoint   *url.URL
+	bucket     string
+	region     string
+	accessKey  string
+	secretKey  string
+	httpClient *http.Client
+
+	logger *slog.Logger
+}
+
+// NewS3PayloadStore creates an S3PayloadStore for the configured -s3endpoint and -s3bucket.
+func NewS3PayloadStore(cfg *Config) (*S3PayloadStore, error) {
+	endpoint, err := url.Parse(cfg.S3Endpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("invalid s3 endpoint %q: use a url like https://s3.us-east-1.amazonaws.com", cfg.S3Endpoint)
+	}
+	region := cfg.S3Region
+	if region == "" {
+		region = defaultS3Region
+	}
+	return &S3PayloadStore{
+		endpoint:   endpoint,
+		bucket:     cfg.S3Bucket,
+		region:     region,
+		accessKey:  cfg.S3AccessKey,
+		secretKey:  cfg.S3SecretKey,
+		httpClient: &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone(), Timeout: s3Timeout},
+		logger:     cfg.componentLogger("s3PayloadStore").With("bucket", cfg.S3Bucket),
+	}, nil
+}
+
+// objectKey gets the key of the object with the payload of track, named like its payload file under a payload dir.
+func objectKey(track *art.Track) string {
+	return track.ArtistId + "/" + track.ArtistTrackId + "." + TrackContainer(track)
+}
+
+// StorePayload stores the payload of track in its object.
+func (store *S3PayloadStore) StorePayload(track *art.Track, payload []byte) error {
+	return store.Put(objectKey(track), payload)
+}
+
+// OpenPayload opens the object with the payload of track to read from the byte at offset.
+func (store *S3PayloadStore) OpenPayload(track *art.Track, offset int64) (io.ReadCloser, error) {
+	return store.Get(objectKey(track), offset)
+}
+
+// PayloadSize gets the length in bytes of the object with the payload of track.
+func (store *S3PayloadStore) PayloadSize(track *art.Track) (int64, error) {
+	return store.Size(objectKey(track))
+}
+
+// DeletePayload removes the object with the payload of track.
+func (store *S3PayloadStore) DeletePayload(track *art.Track) error {
+	return store.Delete(objectKey(track))
+}
+
+// InitBucket creates the bucket if it does not exist yet.
+func (store *S3PayloadStore) InitBucket() error {
+	response, err := store.do("HEAD", "", nil, nil)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode == http.StatusOK {
+		return nil
+	} else if response.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to find s3 bucket %s: %s", store.bucket, response.Status)
+	}
+
+	// Outside the default region, a bucket is created in the region named in the request body.
+	var configuration []byte
+	if store.region != defaultS3Region {
+		configuration = []byte(`<CreateBucketConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">` +
+			`<LocationConstraint>` + store.region + `</LocationConstraint></CreateBucketConfiguration>`)
+	}
+	response, err = store.do("PUT", "", nil, configuration)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return s3Error(response, "create bucket "+store.bucket)
+	}
+	store.logger.Info("created s3 bucket")
+	return nil
+}
+
+// Put stores payload in the object with key, replacing any stored there.
+func (store *S3PayloadStore) Put(key string, payload []byte) error {
+	response, err := store.do("PUT", key, nil, payload)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return s3Error(response, "put "+key)
+	}
+	store.logger.Debug("put payload", "key", key, "bytes", len(payload))
+	return nil
+}
+
+// Get opens the object with key to read from the byte at offset.
+// It wraps ErrArtNotFound if no object is stored with key.
+func (store *S3PayloadStore) Get(key string, offset int64) (io.ReadCloser, error) {
+	header := make(http.Header)
+	if offset > 0 {
+		header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	response, err := store.do("GET", key, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch response.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return response.Body, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		// A range starting at the end of the object reads nothing, like a file read from its end.
+		response.Body.Close()
+		size, err := store.Size(key)
+		if err != nil {
+			return nil, err
+		}
+		if offset == size {
+			return ioutil.NopCloser(bytes.NewReader(nil)), nil
+		}
+		return nil, fmt.Errorf("offset %d outside %d byte object %s", offset, size, key)
+	default:
+		defer response.Body.Close()
+		return nil, s3Error(response, "get "+key)
+	}
+}
+
+// Size gets the length in bytes of the object with key.
+// It wraps ErrArtNotFound if no object is stored with key.
+func (store *S3PayloadStore) Size(key string) (int64, error) {
+	response, err := store.do("HEAD", key, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return 0, s3Error(response, "head "+key)
+	}
+	return response.ContentLength, nil
+}
+
+// Delete removes the object with key, if it is stored.
+func (store *S3PayloadStore) Delete(key string) error {
+	response, err := store.do("DELETE", key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK &&
+		response.StatusCode != http.StatusNotFound {
+		return s3Error(response, "delete "+key)
+	}
+	return nil
+}
+
+// do sends a signed request with payload for the object with key, or for the bucket if key is empty.
+func (store *S3PayloadStore) do(method string, key string, header http.Header, payload []byte) (*http.Response, error) {
+	objectURL := *store.endpoint
+	objectURL.Path = strings.TrimSuffix(objectURL.Path, "/") + "/" + store.bucket
+	if key != "" {
+		objectURL.Path += "/" + key
+	}
+	objectURL.RawPath = uriEncode(objectURL.Path, false)
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, objectURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	payloadHash := sha256.Sum256(payload)
+	signV4(req, hex.EncodeToString(payloadHash[:]), store.accessKey, store.secretKey, store.region, s3Service, time.Now())
+	return store.httpClient.Do(req)
+}
+
+// s3Error gets the error of a failed request to do action, wrapping ErrArtNotFound for a missing object or bucket.
+func s3Error(response *http.Response, action string) error {
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	if response.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("failed to %s in s3: %w", action, ErrArtNotFound)
+	}
+	return fmt.Errorf("failed to %s in s3: %s %s", action, response.Status, bytes.TrimSpace(message))
+}
+
+// signV4 signs req with AWS Signature Version 4 at time now, adding its X-Amz-Date, X-Amz-Content-Sha256,
+// and Authorization headers. The signature covers the host and every header already set on req.
+// payloadHash is the hex SHA-256 hash of the request body.
+func signV4(req *http.Request, payloadHash string, accessKey, secretKey, region, service string, now time.Time) {
+	amzDate := now.UTC().Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if service == s3Service {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := amzDate[:8] + "/" + region + "/" + service + "/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	signingKey := []byte("AWS4" + secretKey)
+	for _, part := range []string{amzDate[:8], region, service, "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes the query parameters sorted by name and value, as signed.
+func canonicalQuery(query url.Values) string {
+	var parameters []string
+	for name, values := range query {
+		for _, value := range values {
+			parameters = append(parameters, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(parameters)
+	return strings.Join(parameters, "&")
+}
+
+// uriEncode percent-encodes every byte of s but the unreserved characters, and but slashes unless isEncodingSlash.
+func uriEncode(s string, isEncodingSlash bool) string {
+	var encoded strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !isEncodingSlash) {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
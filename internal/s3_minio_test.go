@@ -0,0 +1,50 @@
+// +build minio
+
+package audiostrike
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestMinioPayloadStore runs the ArtServer conformance tests on a sqlite DbServer storing payloads
+// with `go test -tags minio` in a local MinIO server at AUSTK_S3_ENDPOINT (default http://localhost:9000)
+// with the credentials AUSTK_S3_ACCESS_KEY and AUSTK_S3_SECRET_KEY (default minioadmin).
+func TestMinioPayloadStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk-minio")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	getenv := func(name string, defaultValue string) string {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+		return defaultValue
+	}
+	// Each server stores payloads in its own bucket, so none keeps the payloads of an earlier test.
+	bucketPrefix := "austk-test-" + strconv.FormatInt(time.Now().Unix(), 10) + "-"
+
+	newMinioDbServer := func() *DbServer {
+		serverDir, err := ioutil.TempDir(dir, "server")
+		if err != nil {
+			t.Fatalf("TempDir error: %v", err)
+		}
+		dbCfg := *cfg
+		dbCfg.DbEngine = DbEngineSqlite
+		dbCfg.DbFile = filepath.Join(serverDir, "austk.db")
+		dbCfg.DbInit = true
+		dbCfg.ArtDir = filepath.Join(serverDir, "art")
+		dbCfg.S3Endpoint = getenv("AUSTK_S3_ENDPOINT", "http://localhost:9000")
+		dbCfg.S3Bucket = bucketPrefix + filepath.Base(serverDir)
+		dbCfg.S3AccessKey = getenv("AUSTK_S3_ACCESS_KEY", "minioadmin")
+		dbCfg.S3SecretKey = getenv("AUSTK_S3_SECRET_KEY", "minioadmin")
+		return newTestDbServer(t, &dbCfg)
+	}
+	runArtServerConformance(t, func() ArtServer { return newMinioDbServer() })
+	testS3TrackDownload(t, newMinioDbServer())
+}
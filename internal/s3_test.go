@@ -0,0 +1,147 @@
+package audiostrike
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/gorilla/mux"
+)
+
+// TestSignV4 verifies the signature of the get-vanilla request of the AWS Signature Version 4 test suite.
+func TestSignV4(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	emptyHash := sha256.Sum256(nil)
+	signV4(req, hex.EncodeToString(emptyHash[:]), "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		"us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if authorization := req.Header.Get("Authorization"); authorization != expected {
+		t.Errorf("expected %s but got %s", expected, authorization)
+	}
+}
+
+// fakeS3 serves the objects of buckets in memory like an S3-compatible service,
+// refusing requests not signed with the access key or whose body does not match the signed hash.
+type fakeS3 struct {
+	mutex   sync.Mutex
+	objects map[string][]byte
+	buckets map[string]bool
+}
+
+func (s3 *fakeS3) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	bodyHash := sha256.Sum256(body)
+	if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=austk/") ||
+		req.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(bodyHash[:]) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	s3.mutex.Lock()
+	defer s3.mutex.Unlock()
+	path := strings.Trim(req.URL.Path, "/")
+	if !strings.Contains(path, "/") {
+		if req.Method == "PUT" {
+			s3.buckets[path] = true
+		} else if !s3.buckets[path] {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	}
+	object, isStored := s3.objects[path]
+	switch {
+	case req.Method == "PUT":
+		s3.objects[path] = body
+	case !isStored:
+		w.WriteHeader(http.StatusNotFound)
+	case req.Method == "DELETE":
+		delete(s3.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.ServeContent(w, req, path, time.Time{}, bytes.NewReader(object))
+	}
+}
+
+// TestS3PayloadStore runs the ArtServer conformance tests on a sqlite DbServer storing payloads in a fake s3 bucket,
+// then verifies that the track handler streams a payload from the bucket.
+func TestS3PayloadStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk-s3")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	s3 := &fakeS3{objects: make(map[string][]byte), buckets: make(map[string]bool)}
+	s3Server := httptest.NewServer(s3)
+	defer s3Server.Close()
+
+	newS3DbServer := func() *DbServer {
+		serverDir, err := ioutil.TempDir(dir, "server")
+		if err != nil {
+			t.Fatalf("TempDir error: %v", err)
+		}
+		dbCfg := *cfg
+		dbCfg.DbEngine = DbEngineSqlite
+		dbCfg.DbFile = filepath.Join(serverDir, "austk.db")
+		dbCfg.DbInit = true
+		dbCfg.ArtDir = filepath.Join(serverDir, "art")
+		dbCfg.S3Endpoint = s3Server.URL
+		dbCfg.S3Bucket = filepath.Base(serverDir)
+		dbCfg.S3AccessKey = "austk"
+		dbCfg.S3SecretKey = "s3cr3t"
+		return newTestDbServer(t, &dbCfg)
+	}
+	runArtServerConformance(t, func() ArtServer { return newS3DbServer() })
+
+	dbServer := newS3DbServer()
+	testS3TrackDownload(t, dbServer)
+	if len(s3.objects) == 0 {
+		t.Errorf("expected payloads stored in the fake s3 bucket")
+	}
+}
+
+// testS3TrackDownload verifies that dbServer stores a payload outside files and the track handler streams it,
+// whole or from an offset.
+func testS3TrackDownload(t *testing.T, dbServer *DbServer) {
+	err := dbServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID, Title: "Test Track", Price: &art.Price{Sats: 0}}
+	err = dbServer.StoreTrack(track, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	err = dbServer.StoreTrackPayload(track, []byte("payload in a bucket"))
+	if err != nil {
+		t.Fatalf("StoreTrackPayload error: %v", err)
+	}
+	if path := dbServer.TrackFilePath(track); path != "" {
+		t.Errorf("expected no payload file but got %s", path)
+	}
+	austkServer, err := NewAustkServer(cfg, dbServer, &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	for rangeHeader, expected := range map[string]string{"": "payload in a bucket", "bytes=13-": "bucket"} {
+		request := httptest.NewRequest("GET", "/art/"+mockArtistID+"/"+mockTrackID, nil)
+		if rangeHeader != "" {
+			request.Header.Set("Range", rangeHeader)
+		}
+		request = mux.SetURLVars(request, map[string]string{"artist": mockArtistID, "track": mockTrackID})
+		recorder := httptest.NewRecorder()
+		austkServer.getArtHandler(recorder, request)
+		if recorder.Body.String() != expected {
+			t.Errorf("expected %q for range %q but got %d %q", expected, rangeHeader, recorder.Code, recorder.Body.String())
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package audiostrike
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// matchesQuery checks whether text contains query, ignoring case.
+func matchesQuery(text string, query string) bool {
+	return strings.Contains(strings.ToLower(text), strings.ToLower(query))
+}
+
+// searchArtists scans artists for those whose names contain query, ignoring case.
+// It orders them by name and then by ArtistId, like the DbServer query.
+func searchArtists(artists map[string]*art.Artist, query string) []*art.Artist {
+	var matchedArtists []*art.Artist
+	for _, artist := range artists {
+		if matchesQuery(artist.Name, query) {
+			matchedArtists = append(matchedArtists, artist)
+		}
+	}
+	sort.Slice(matchedArtists, func(i, j int) bool {
+		iName, jName := strings.ToLower(matchedArtists[i].Name), strings.ToLower(matchedArtists[j].Name)
+		if iName != jName {
+			return iName < jName
+		}
+		return matchedArtists[i].ArtistId < matchedArtists[j].ArtistId
+	})
+	return matchedArtists
+}
+
+// TrackFilter narrows a search to the tracks tagged with Genre, ignoring case, and released from MinYear to MaxYear.
+// Zero fields do not narrow the search, but a track of unknown year is never in a range of years.
+type TrackFilter struct {
+	Genre   string
+	MinYear uint32
+	MaxYear uint32
+}
+
+// matches checks whether track passes filter.
+func (filter TrackFilter) matches(track *art.Track) bool {
+	if filter.Genre != "" && !hasGenre(track.Genres, filter.Genre) {
+		return false
+	}
+	if (filter.MinYear > 0 || filter.MaxYear > 0) && track.Year == 0 {
+		return false
+	}
+	return track.Year >= filter.MinYear && (filter.MaxYear == 0 || track.Year <= filter.MaxYear)
+}
+
+// hasGenre checks whether genres include genre, ignoring case.
+func hasGenre(genres []string, genre string) bool {
+	for _, trackGenre := range genres {
+		if strings.EqualFold(trackGenre, genre) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxGenresColumnLength is the length in characters of the DbServer column of genres.
+const maxGenresColumnLength = 1024
+
+// genresColumn gets the value of the DbServer column of genres, each lower-case between | characters,
+// so a LIKE pattern of "%|genre|%" matches exactly one of them, e.g. "|grunge|alternative metal|".
+// Genres past maxGenresColumnLength are left out, so a track with too many is still stored but not found by them.
+func genresColumn(genres []string) string {
+	column := "|"
+	for _, genre := range genres {
+		genre = strings.ToLower(genre) + "|"
+		if utf8.RuneCountInString(column)+utf8.RuneCountInString(genre) > maxGenresColumnLength {
+			break
+		}
+		column += genre
+	}
+	if column == "|" {
+		return ""
+	}
+	return column
+}
+
+// ParseYearRange parses a year, e.g. "1992", or a range of years, e.g. "1990-1999", into the least and greatest year.
+// Either end of a range may be omitted, e.g. "2000-" for the tracks released since 2000.
+func ParseYearRange(years string) (minYear uint32, maxYear uint32, err error) {
+	bounds := strings.SplitN(years, "-", 2)
+	if len(bounds) == 1 {
+		bounds = append(bounds, bounds[0])
+	}
+	var parsedBounds [2]uint32
+	for i, bound := range bounds {
+		bound = strings.TrimSpace(bound)
+		if bound == "" {
+			continue // to the other bound of a range open at this end
+		}
+		year, err := strconv.ParseUint(bound, 10, 32)
+		if err != nil || year < 1000 || year > 9999 {
+			return 0, 0, fmt.Errorf("invalid year %q in %q, expected a four-digit year or range like 1990-1999", bound, years)
+		}
+		parsedBounds[i] = uint32(year)
+	}
+	if parsedBounds[1] > 0 && parsedBounds[0] > parsedBounds[1] {
+		return 0, 0, fmt.Errorf("invalid range of years %q, which ends before it starts", years)
+	}
+	return parsedBounds[0], parsedBounds[1], nil
+}
+
+// searchTracks scans the tracks of each artist for those whose titles contain query, ignoring case,
+// and that pass filter.
+// It orders them by ArtistId, then by title, then by ArtistTrackId, like the DbServer query.
+func searchTracks(tracksByArtist map[string]map[string]*art.Track, query string, filter TrackFilter) []*art.Track {
+	var matchedTracks []*art.Track
+	for _, tracks := range tracksByArtist {
+		for _, track := range tracks {
+			if matchesQuery(track.Title, query) && filter.matches(track) {
+				matchedTracks = append(matchedTracks, track)
+			}
+		}
+	}
+	sort.Slice(matchedTracks, func(i, j int) bool {
+		iTrack, jTrack := matchedTracks[i], matchedTracks[j]
+		if iTrack.ArtistId != jTrack.ArtistId {
+			return iTrack.ArtistId < jTrack.ArtistId
+		}
+		iTitle, jTitle := strings.ToLower(iTrack.Title), strings.ToLower(jTrack.Title)
+		if iTitle != jTitle {
+			return iTitle < jTitle
+		}
+		return iTrack.ArtistTrackId < jTrack.ArtistTrackId
+	})
+	return matchedTracks
+}
+
+// likePattern gets a sql LIKE pattern, with ! as the escape character, matching lower-case text containing query.
+func likePattern(query string) string {
+	escaper := strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+	return "%" + escaper.Replace(strings.ToLower(query)) + "%"
+}
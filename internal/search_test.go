@@ -0,0 +1,81 @@
+package audiostrike
+
+import (
+	"strings"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// TestParseYearRange verifies that a year or a range of years, open at either end, is parsed into its bounds.
+func TestParseYearRange(t *testing.T) {
+	tests := []struct {
+		years           string
+		minYear         uint32
+		maxYear         uint32
+		isErrorExpected bool
+	}{
+		{"1992", 1992, 1992, false},
+		{"1990-1999", 1990, 1999, false},
+		{" 1990 - 1999 ", 1990, 1999, false},
+		{"2000-", 2000, 0, false},
+		{"-1979", 0, 1979, false},
+		{"1999-1990", 0, 0, true},
+		{"92", 0, 0, true},
+		{"nineties", 0, 0, true},
+	}
+	for _, test := range tests {
+		minYear, maxYear, err := ParseYearRange(test.years)
+		if (err != nil) != test.isErrorExpected || minYear != test.minYear || maxYear != test.maxYear {
+			t.Errorf("expected %q to parse to %d-%d, error expected %v, but got %d-%d, error: %v",
+				test.years, test.minYear, test.maxYear, test.isErrorExpected, minYear, maxYear, err)
+		}
+	}
+}
+
+// TestGenresColumn verifies that the genres column has each genre between | characters
+// and leaves out the genres that would not fit in it.
+func TestGenresColumn(t *testing.T) {
+	long := strings.Repeat("x", maxGenresColumnLength)
+	tests := []struct {
+		genres   []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"Grunge", "Alternative Metal"}, "|grunge|alternative metal|"},
+		{[]string{"Grunge", long, "Metal"}, "|grunge|"},
+		{[]string{long}, ""},
+	}
+	for _, test := range tests {
+		column := genresColumn(test.genres)
+		if column != test.expected {
+			t.Errorf("expected genres column %q for %d genres but got %q", test.expected, len(test.genres), column)
+		}
+	}
+}
+
+// TestTrackFilterMatches verifies that a filter matches genres ignoring case and never puts a track of unknown year
+// in a range of years.
+func TestTrackFilterMatches(t *testing.T) {
+	grunge := &art.Track{Genres: []string{"Alternative Metal", "Grunge"}, Year: 1992}
+	undated := &art.Track{Genres: []string{"Grunge"}}
+	tests := []struct {
+		filter          TrackFilter
+		track           *art.Track
+		isMatchExpected bool
+	}{
+		{TrackFilter{}, undated, true},
+		{TrackFilter{Genre: "grunge"}, grunge, true},
+		{TrackFilter{Genre: "grunge"}, undated, true},
+		{TrackFilter{Genre: "grun"}, grunge, false},
+		{TrackFilter{MinYear: 1992, MaxYear: 1992}, grunge, true},
+		{TrackFilter{MinYear: 1993}, grunge, false},
+		{TrackFilter{MaxYear: 1991}, grunge, false},
+		{TrackFilter{MaxYear: 1999}, undated, false},
+	}
+	for _, test := range tests {
+		if test.filter.matches(test.track) != test.isMatchExpected {
+			t.Errorf("expected filter %+v to match %v: %v", test.filter, test.track, test.isMatchExpected)
+		}
+	}
+}
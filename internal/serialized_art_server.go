@@ -0,0 +1,394 @@
+package audiostrike
+
+import (
+	"io"
+	"sync"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// serializedArtServer is an ArtServer that makes one call at a time to the ArtServer it wraps,
+// so that goroutines can share an ArtServer not safe for concurrent use.
+type serializedArtServer struct {
+	artServer ArtServer
+	mutex     sync.Mutex
+}
+
+// NewSerializedArtServer wraps artServer to serialize the calls of concurrent goroutines to it,
+// e.g. to sync from several peers at once.
+// Maps of art are copied before returning, so that callers can range over them while others store art.
+func NewSerializedArtServer(artServer ArtServer) ArtServer {
+	return &serializedArtServer{artServer: artServer}
+}
+
+func (serialized *serializedArtServer) StoreArtist(artist *art.Artist) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.StoreArtist(artist)
+}
+
+func (serialized *serializedArtServer) Artists() (map[string]*art.Artist, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	artists, err := serialized.artServer.Artists()
+	if err != nil {
+		return nil, err
+	}
+	copied := make(map[string]*art.Artist, len(artists))
+	for key, value := range artists {
+		copied[key] = value
+	}
+	return copied, nil
+}
+
+func (serialized *serializedArtServer) Artist(artistID string) (*art.Artist, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.Artist(artistID)
+}
+
+func (serialized *serializedArtServer) SearchArtists(query string) ([]*art.Artist, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.SearchArtists(query)
+}
+
+func (serialized *serializedArtServer) StoreAlbum(album *art.Album, publisher Publisher) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.StoreAlbum(album, publisher)
+}
+
+func (serialized *serializedArtServer) Albums(artistID string) (map[string]*art.Album, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	albums, err := serialized.artServer.Albums(artistID)
+	if err != nil {
+		return nil, err
+	}
+	copied := make(map[string]*art.Album, len(albums))
+	for key, value := range albums {
+		copied[key] = value
+	}
+	return copied, nil
+}
+
+func (serialized *serializedArtServer) AlbumsPage(artistID string, offset int, limit int) ([]*art.Album, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.AlbumsPage(artistID, offset, limit)
+}
+
+func (serialized *serializedArtServer) SetAlbumPrice(album *art.Album, sats uint64) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.SetAlbumPrice(album, sats)
+}
+
+func (serialized *serializedArtServer) StoreAlbumArt(album *art.Album, image []byte, mime string) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.StoreAlbumArt(album, image, mime)
+}
+
+func (serialized *serializedArtServer) DeleteAlbum(album *art.Album) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.DeleteAlbum(album)
+}
+
+func (serialized *serializedArtServer) AlbumArt(artistID string, artistAlbumID string) ([]byte, string, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.AlbumArt(artistID, artistAlbumID)
+}
+
+func (serialized *serializedArtServer) StorePlaylist(playlist *art.Playlist, publisher Publisher) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.StorePlaylist(playlist, publisher)
+}
+
+func (serialized *serializedArtServer) Playlists(artistID string) (map[string]*art.Playlist, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	playlists, err := serialized.artServer.Playlists(artistID)
+	if err != nil {
+		return nil, err
+	}
+	copied := make(map[string]*art.Playlist, len(playlists))
+	for key, value := range playlists {
+		copied[key] = value
+	}
+	return copied, nil
+}
+
+func (serialized *serializedArtServer) Playlist(artistID string, artistPlaylistID string) (*art.Playlist, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.Playlist(artistID, artistPlaylistID)
+}
+
+func (serialized *serializedArtServer) StoreTrack(track *art.Track, publisher Publisher) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.StoreTrack(track, publisher)
+}
+
+func (serialized *serializedArtServer) StoreTrackPayload(track *art.Track, bytes []byte) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.StoreTrackPayload(track, bytes)
+}
+
+func (serialized *serializedArtServer) Tracks(artistID string) (map[string]*art.Track, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	tracks, err := serialized.artServer.Tracks(artistID)
+	if err != nil {
+		return nil, err
+	}
+	copied := make(map[string]*art.Track, len(tracks))
+	for key, value := range tracks {
+		copied[key] = value
+	}
+	return copied, nil
+}
+
+func (serialized *serializedArtServer) TracksPage(artistID string, offset int, limit int) ([]*art.Track, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.TracksPage(artistID, offset, limit)
+}
+
+func (serialized *serializedArtServer) Track(artistID string, artistTrackID string) (*art.Track, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.Track(artistID, artistTrackID)
+}
+
+func (serialized *serializedArtServer) SearchTracks(query string, filter TrackFilter) ([]*art.Track, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.SearchTracks(query, filter)
+}
+
+func (serialized *serializedArtServer) StoreTrackPreview(track *art.Track, preview []byte) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.StoreTrackPreview(track, preview)
+}
+
+func (serialized *serializedArtServer) TrackPreview(artistID string, artistTrackID string) ([]byte, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.TrackPreview(artistID, artistTrackID)
+}
+
+func (serialized *serializedArtServer) RecentTracks(limit int) ([]*art.Track, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.RecentTracks(limit)
+}
+
+func (serialized *serializedArtServer) TrackFilePath(track *art.Track) string {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.TrackFilePath(track)
+}
+
+func (serialized *serializedArtServer) TrackFilePartialReader(track *art.Track, offset int64) (io.ReadCloser, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.TrackFilePartialReader(track, offset)
+}
+
+// TrackPayloadSize gets the size of the payload of track from the wrapped ArtServer,
+// which reads the payload to measure it only if it is not a payloadSizer.
+func (serialized *serializedArtServer) TrackPayloadSize(track *art.Track) (int64, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return payloadSize(serialized.artServer, track)
+}
+
+func (serialized *serializedArtServer) VerifyStoredTrack(track *art.Track) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.VerifyStoredTrack(track)
+}
+
+func (serialized *serializedArtServer) SetTrackPrice(track *art.Track, sats uint64) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.SetTrackPrice(track, sats)
+}
+
+func (serialized *serializedArtServer) EvictTrack(track *art.Track) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.EvictTrack(track)
+}
+
+func (serialized *serializedArtServer) DeleteTrack(track *art.Track) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.DeleteTrack(track)
+}
+
+func (serialized *serializedArtServer) StorePeer(peer *art.Peer, publisher Publisher) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.StorePeer(peer, publisher)
+}
+
+func (serialized *serializedArtServer) Peers() (map[string]*art.Peer, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	peers, err := serialized.artServer.Peers()
+	if err != nil {
+		return nil, err
+	}
+	copied := make(map[string]*art.Peer, len(peers))
+	for key, value := range peers {
+		copied[key] = value
+	}
+	return copied, nil
+}
+
+func (serialized *serializedArtServer) PeersPage(offset int, limit int) ([]*art.Peer, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.PeersPage(offset, limit)
+}
+
+func (serialized *serializedArtServer) Peer(pubkey string) (*art.Peer, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.Peer(pubkey)
+}
+
+func (serialized *serializedArtServer) DeletePeer(pubkey string) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.DeletePeer(pubkey)
+}
+
+func (serialized *serializedArtServer) StorePublication(publication *art.ArtistPublication) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.StorePublication(publication)
+}
+
+func (serialized *serializedArtServer) SyncCursor(pubkey string) (uint64, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.SyncCursor(pubkey)
+}
+
+func (serialized *serializedArtServer) StoreSyncCursor(pubkey string, asOf uint64) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.StoreSyncCursor(pubkey, asOf)
+}
+
+func (serialized *serializedArtServer) PublicationSequence(pubkey string) (uint64, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.PublicationSequence(pubkey)
+}
+
+func (serialized *serializedArtServer) StorePublicationSequence(pubkey string, sequence uint64) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.StorePublicationSequence(pubkey, sequence)
+}
+
+func (serialized *serializedArtServer) StoreTombstone(tombstone *art.Tombstone) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.StoreTombstone(tombstone)
+}
+
+func (serialized *serializedArtServer) Tombstones() ([]*art.Tombstone, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.Tombstones()
+}
+
+func (serialized *serializedArtServer) DeleteExpiredTombstones(deletedBefore uint64) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.DeleteExpiredTombstones(deletedBefore)
+}
+
+func (serialized *serializedArtServer) PeerReputation(pubkey string) (*art.PeerReputation, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.PeerReputation(pubkey)
+}
+
+func (serialized *serializedArtServer) StorePeerReputation(reputation *art.PeerReputation) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.StorePeerReputation(reputation)
+}
+
+func (serialized *serializedArtServer) PeerBandwidth(pubkey string) (*art.PeerBandwidth, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.PeerBandwidth(pubkey)
+}
+
+func (serialized *serializedArtServer) StorePeerBandwidth(bandwidth *art.PeerBandwidth) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.StorePeerBandwidth(bandwidth)
+}
+
+func (serialized *serializedArtServer) TrackStats(artistID string, artistTrackID string) (*art.TrackStats, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.TrackStats(artistID, artistTrackID)
+}
+
+func (serialized *serializedArtServer) StoreTrackStats(stats *art.TrackStats) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.StoreTrackStats(stats)
+}
+
+func (serialized *serializedArtServer) AddTrackStats(stats *art.TrackStats) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.AddTrackStats(stats)
+}
+
+func (serialized *serializedArtServer) DeleteTrackStats(artistID string, artistTrackID string) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.DeleteTrackStats(artistID, artistTrackID)
+}
+
+func (serialized *serializedArtServer) TopTrackStats(limit int) ([]*art.TrackStats, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.TopTrackStats(limit)
+}
+
+func (serialized *serializedArtServer) StoreIssuedInvoice(invoice *art.IssuedInvoice) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.StoreIssuedInvoice(invoice)
+}
+
+func (serialized *serializedArtServer) IssuedInvoice(invoiceHash []byte) (*art.IssuedInvoice, error) {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.IssuedInvoice(invoiceHash)
+}
+
+func (serialized *serializedArtServer) DeleteExpiredInvoices(expiredBefore uint64) error {
+	serialized.mutex.Lock()
+	defer serialized.mutex.Unlock()
+	return serialized.artServer.DeleteExpiredInvoices(expiredBefore)
+}
@@ -0,0 +1,28 @@
+package audiostrike
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// TestSerializedArtServerConformance verifies that serializing calls to a FileServer keeps its ArtServer behavior.
+func TestSerializedArtServerConformance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk-serialized")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	runArtServerConformance(t, func() ArtServer {
+		serverDir, err := ioutil.TempDir(dir, "art")
+		if err != nil {
+			t.Fatalf("TempDir error: %v", err)
+		}
+		fileServer, err := NewFileServer(serverDir)
+		if err != nil {
+			t.Fatalf("NewFileServer error: %v", err)
+		}
+		return NewSerializedArtServer(fileServer)
+	})
+}
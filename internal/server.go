@@ -1,23 +1,62 @@
 package audiostrike
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
 
 	"errors"
 	art "github.com/audiostrike/music/pkg/art"
 	"github.com/golang/protobuf/proto"
 	"github.com/gorilla/mux"
-	"log"
+	"log/slog"
 	"regexp"
 	"strings"
 )
 
+const (
+	// PreimageHeader is the http header in which a client proves payment for a track
+	// with the hex-encoded preimage of the paid invoice.
+	PreimageHeader = "X-Austk-Preimage"
+
+	// PrefixChecksumHeader is the http header in which a client resuming a track download
+	// sends the hex-encoded CRC-32 (IEEE) checksum of the bytes it already downloaded.
+	// The server replies with the rest of the track only if its payload starts with those bytes.
+	PrefixChecksumHeader = "X-Austk-Prefix-Crc32"
+)
+
+// Errors returned by ArtServer, Publisher, AustkServer, and Client. Check for them with errors.Is.
 var (
 	ErrArtNotFound      = errors.New("ArtServer has no such art")
-	ErrInvalidSignature = errors.New("Signature is not valid for the artist pubkey and message")
+	ErrSignatureInvalid = errors.New("Signature is not valid for the artist pubkey and message")
+	ErrPubkeyMismatch   = errors.New("pubkey does not match the artist pubkey")
+	ErrPaymentRequired  = errors.New("payment required")
 	ErrPeerNotFound     = errors.New("AustkServer has no such peer")
+	ErrPayloadMismatch  = errors.New("payload does not match the SHA-256 hash published for its track")
+	ErrTrackCollision   = errors.New("another payload is stored for the track")
+	ErrForeignArt       = errors.New("publication has art of an artist the publishing artist does not host")
+	ErrRateLimited      = errors.New("peer is throttling requests over its rate limit")
+	ErrQuotaExceeded    = errors.New("peer was served its monthly quota of bytes")
+	ErrAlbumNotEmpty    = errors.New("album still has tracks")
+	ErrIncompatiblePeer = errors.New("peer speaks no version of the sync protocol in common")
+	ErrPeerUnreachable  = errors.New("peer cannot be reached")
+	ErrPeerNotAllowed   = errors.New("peer does not allow this node to sync")
+	ErrPublicationStale = errors.New("publication is older than one already validated from its artist")
+	ErrSelfPeer         = errors.New("peer is this node itself")
+	ErrLndUnavailable   = errors.New("lnd unavailable")
+	ErrPartialPurchase  = errors.New("some tracks of the album were not purchased")
+	ErrFeatureMissing   = errors.New("peer does not support the feature of the sync protocol")
+	ErrArtIDInvalid     = errors.New("art id or container is not safe to name a file")
 )
 
 // AustkServer hosts publishingArtist's art for http/tor clients who might pay the lightning node for it.
@@ -26,7 +65,52 @@ type AustkServer struct {
 	artServer   ArtServer // interface for storing art in a file system, database, or test mock
 	httpServer  *http.Server
 	publisher   Publisher
-	quitChannel chan bool
+	quitChannel chan bool // closed once by Stop or Shutdown to quit
+
+	// ctx is cancelled when the server stops, to cancel lnd calls made outside any one request.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// publications caches the publications signed by Sign, to sign art again only once it changes.
+	publications *publicationCache
+	// sequencer stamps the art this server publishes with a Sequence that increases when the art changes.
+	sequencer publicationSequencer
+	// sequenceMutex serializes checking and storing the sequences of validated publications.
+	sequenceMutex sync.Mutex
+
+	// invoiceMutex serializes settling the issued invoices stored by recordInvoice, to count each payment once.
+	invoiceMutex sync.Mutex
+
+	// streams maps the id of each stream to its bookkeeping for pay-as-you-go streaming.
+	// streamMutex guards the map, not the streams, which each serialize their own invoices and chunks.
+	streams     map[string]*trackStream
+	streamMutex sync.Mutex
+
+	// readiness caches whether lnd and storage were reachable to answer /readyz.
+	readiness readiness
+	// syncSchedule records when the daemon last synced from its peers and syncs next, to answer /status.
+	syncSchedule syncSchedule
+	// retention evicts the payloads of synced tracks past -maxstorage, recording the bytes stored for /status.
+	retention storageRetention
+
+	// peerClients keeps clients to peers idle to reuse their connections for the next sync.
+	peerClients *ClientPool
+
+	// rateLimiter limits the requests and bytes served to each client, or is nil for no limit.
+	rateLimiter *rateLimiter
+	// peerAuthenticator checks that each peer of a private node is allowed and proves its pubkey,
+	// or is nil for a public node, which serves every peer.
+	peerAuthenticator *peerAuthenticator
+	// bandwidth counts the bytes of payloads served to each peer against its monthly quota.
+	bandwidth *bandwidthMeter
+	// trackStats counts the plays and purchases of each track.
+	trackStats *trackCounter
+	// events streams the events logged by this node to admins, or is nil if not configured.
+	events *EventLog
+
+	quitOnce sync.Once
+
+	logger *slog.Logger
 }
 
 // ArtServer is a repository to store/serve music and related data for this austk node.
@@ -36,30 +120,113 @@ type ArtServer interface {
 	StoreArtist(artist *art.Artist) error
 	Artists() (map[string]*art.Artist, error)
 	Artist(artistId string) (*art.Artist, error)
+	SearchArtists(query string) ([]*art.Artist, error)
 
 	// Album: an artist's optional track container to name and sequence tracks
 	StoreAlbum(album *art.Album, publisher Publisher) error
 	Albums(artistId string) (map[string]*art.Album, error)
+	AlbumsPage(artistID string, offset int, limit int) ([]*art.Album, error)
+	SetAlbumPrice(album *art.Album, sats uint64) error
+	StoreAlbumArt(album *art.Album, image []byte, mime string) error
+	AlbumArt(artistID string, artistAlbumID string) (image []byte, mime string, err error)
+	// DeleteAlbum removes the album and its cover art, or fails with ErrAlbumNotEmpty if it has tracks.
+	DeleteAlbum(album *art.Album) error
+
+	// Playlist: an artist's ordered list of tracks by any artists, published like the artist's own art
+	StorePlaylist(playlist *art.Playlist, publisher Publisher) error
+	Playlists(artistID string) (map[string]*art.Playlist, error)
+	Playlist(artistID string, artistPlaylistID string) (*art.Playlist, error)
 
 	// Get and store Track info.
 	StoreTrack(track *art.Track, publisher Publisher) error
 	StoreTrackPayload(track *art.Track, bytes []byte) error
 	Tracks(artistID string) (map[string]*art.Track, error)
+	TracksPage(artistID string, offset int, limit int) ([]*art.Track, error)
 	Track(artistID string, artistTrackID string) (*art.Track, error)
+	// SearchTracks gets the tracks whose titles contain query, ignoring case, and that pass filter.
+	SearchTracks(query string, filter TrackFilter) ([]*art.Track, error)
+	// RecentTracks gets at most limit tracks by any artists, newest first by CreatedAt, or all if limit is negative.
+	RecentTracks(limit int) ([]*art.Track, error)
 	TrackFilePath(track *art.Track) string
+	// StoreTrackPreview stores the free preview clip of the stored track, recording its track.PreviewSeconds and hash.
+	StoreTrackPreview(track *art.Track, preview []byte) error
+	TrackPreview(artistID string, artistTrackID string) ([]byte, error)
+	TrackFilePartialReader(track *art.Track, offset int64) (io.ReadCloser, error)
+	VerifyStoredTrack(track *art.Track) error
+	SetTrackPrice(track *art.Track, sats uint64) error
+	// DeleteTrack removes the track and its stored payload.
+	DeleteTrack(track *art.Track) error
+	// EvictTrack removes the stored payload of track to free storage, keeping the track,
+	// or fails with ErrArtNotFound if the track is not stored.
+	EvictTrack(track *art.Track) error
 
 	// Get and store network info.
 	StorePeer(peer *art.Peer, publisher Publisher) error
 	Peers() (map[string]*art.Peer, error)
+	PeersPage(offset int, limit int) ([]*art.Peer, error)
 	Peer(pubkey string) (*art.Peer, error)
+	// DeletePeer removes the peer with pubkey, or fails with ErrPeerNotFound if none is stored.
+	DeletePeer(pubkey string) error
 
 	StorePublication(*art.ArtistPublication) error
+
+	// Track the AsOf time of the resources last synced from each peer, or from each artist publication of a peer.
+	SyncCursor(pubkey string) (asOf uint64, err error)
+	StoreSyncCursor(pubkey string, asOf uint64) error
+
+	// Track the Sequence of the latest publication validated from each artist pubkey, to refuse older ones replayed.
+	PublicationSequence(pubkey string) (sequence uint64, err error)
+	StorePublicationSequence(pubkey string, sequence uint64) error
+
+	// Record the tracks and albums deleted from the hosted art, to publish their withdrawal to peers.
+	// StoreTombstone replaces any tombstone of the same track or album.
+	StoreTombstone(tombstone *art.Tombstone) error
+	// Tombstones gets all the stored tombstones in the order of sortTombstones.
+	Tombstones() ([]*art.Tombstone, error)
+	// DeleteExpiredTombstones deletes the tombstones of art deleted before the unix time deletedBefore.
+	DeleteExpiredTombstones(deletedBefore uint64) error
+
+	// Track failures of each peer to back off from peers that misbehave.
+	PeerReputation(pubkey string) (*art.PeerReputation, error)
+	StorePeerReputation(reputation *art.PeerReputation) error
+
+	// Count the bytes served to each peer to spot abuse and enforce quotas.
+	PeerBandwidth(pubkey string) (*art.PeerBandwidth, error)
+	StorePeerBandwidth(bandwidth *art.PeerBandwidth) error
+
+	// Count the plays and purchases of each track as local analytics, which are not published.
+	TrackStats(artistID string, artistTrackID string) (*art.TrackStats, error)
+	StoreTrackStats(stats *art.TrackStats) error
+	// AddTrackStats adds the plays and purchases of stats to those stored for its track, keeping the later LastPlayedAt.
+	AddTrackStats(stats *art.TrackStats) error
+	// DeleteTrackStats deletes the stats of a track, if any, e.g. after they moved to another track.
+	DeleteTrackStats(artistID string, artistTrackID string) error
+	// TopTrackStats gets the stats of at most limit tracks, most played first, or of all if limit is negative.
+	TopTrackStats(limit int) ([]*art.TrackStats, error)
+
+	// Record the tracks sold by each invoice issued, for its preimage to get them after a restart too.
+	StoreIssuedInvoice(invoice *art.IssuedInvoice) error
+	// IssuedInvoice gets the invoice issued with invoiceHash, or ErrArtNotFound.
+	IssuedInvoice(invoiceHash []byte) (*art.IssuedInvoice, error)
+	// DeleteExpiredInvoices deletes the invoices never settled that expired before the unix time expiredBefore.
+	DeleteExpiredInvoices(expiredBefore uint64) error
 }
 
 type Publisher interface {
 	Artist() (*art.Artist, error)
-	Pubkey() (pubkey string, err error)
-	Sign(*art.ArtResources) (publication *art.ArtistPublication, err error)
+	PublishingArtist(artistID string) (*art.Artist, error)
+	Pubkey(ctx context.Context) (pubkey string, err error)
+	Sign(ctx context.Context, artistID string, resources *art.ArtResources) (publication *art.ArtistPublication, err error)
+	ValidatePublication(context.Context, *art.ArtistPublication) (*art.ArtResources, error)
+	// Sign and verify other messages, e.g. a peer's challenge, with the node's key.
+	SignMessage(ctx context.Context, message []byte) (signature string, err error)
+	VerifyMessage(ctx context.Context, message []byte, signature string) (signerPubkey string, err error)
+
+	// Sell and buy art over the lightning network.
+	AddInvoice(ctx context.Context, memo string, sats uint64) (paymentRequest string, invoiceHash []byte, err error)
+	PayInvoice(ctx context.Context, paymentRequest string, maxSats uint64) (preimage []byte, err error)
+	VerifyPayment(ctx context.Context, invoiceHash, preimage []byte) (bool, error)
+	Keysend(ctx context.Context, pubkey string, sats uint64) error
 }
 
 var invalidIDRegex = regexp.MustCompile("[^a-z0-9.-]")
@@ -72,151 +239,371 @@ func NameToID(name string) string {
 	return invalidIDRegex.ReplaceAllString(lowerCaseName, "")
 }
 
-var invalidHierarchyRegex = regexp.MustCompile("[^/a-z0-9.-]")
+const (
+	ContainerMp3  = "mp3"
+	ContainerFlac = "flac"
+	ContainerOgg  = "ogg"
+	ContainerWav  = "wav"
 
-func TitleToHierarchy(title string) string {
-	lowerCaseTitle := strings.ToLower(title)
-	return invalidHierarchyRegex.ReplaceAllString(lowerCaseTitle, "")
+	CodecMp3    = "mp3"
+	CodecFlac   = "flac"
+	CodecVorbis = "vorbis"
+	CodecOpus   = "opus"
+	CodecPcm    = "pcm"
+)
+
+// TrackMime gets the mime type of the track's payload, e.g. "audio/mpeg" for mp3.
+func TrackMime(track *art.Track) string {
+	switch TrackContainer(track) {
+	case ContainerMp3:
+		return "audio/mpeg"
+	case ContainerFlac:
+		return "audio/flac"
+	case ContainerOgg:
+		if track.Codec == CodecOpus {
+			return "audio/ogg; codecs=opus"
+		}
+		return "audio/ogg"
+	case ContainerWav:
+		return "audio/wav"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// TrackContainer gets the audio container format of the track's payload, e.g. "mp3" or "flac".
+// Tracks published before the container was recorded are mp3.
+func TrackContainer(track *art.Track) string {
+	if track.Container == "" {
+		return ContainerMp3
+	}
+	return track.Container
+}
+
+// TrackCodec gets the audio codec of the track's payload, e.g. "mp3", "flac", "vorbis", or "opus",
+// so a client can tell whether it can play the track.
+// Tracks published before the codec was recorded are mp3 or flac, named like their container.
+func TrackCodec(track *art.Track) string {
+	if track.Codec == "" {
+		return TrackContainer(track)
+	}
+	return track.Codec
 }
 
-// Artist gets the Artist publishing from this server.
+// EffectiveTrackPrice gets the price in satoshis to charge for the given track:
+// the price set for the track if any, otherwise the price set for its album if any,
+// otherwise the node's configured default price.
+func (server *AustkServer) EffectiveTrackPrice(track *art.Track) (uint64, error) {
+	if track.Price != nil {
+		return track.Price.Sats, nil
+	}
+	if track.ArtistAlbumId != "" {
+		albums, err := server.artServer.Albums(track.ArtistId)
+		if err != nil {
+			server.logger.Error("failed to get albums", "artist_id", track.ArtistId, "error", err)
+			return 0, err
+		}
+		album := albums[track.ArtistAlbumId]
+		if album != nil && album.Price != nil {
+			return album.Price.Sats, nil
+		}
+	}
+	return server.config.DefaultPrice, nil
+}
+
+// Artist gets the default Artist publishing from this server.
 func (server *AustkServer) Artist() (*art.Artist, error) {
 	return server.publisher.Artist()
 }
 
-func (server *AustkServer) Pubkey() (string, error) {
-	return server.publisher.Pubkey()
+// PublishingArtist gets the Artist with artistID if hosted by this server or else ErrArtNotFound.
+func (server *AustkServer) PublishingArtist(artistID string) (*art.Artist, error) {
+	return server.publisher.PublishingArtist(artistID)
 }
 
-func (server *AustkServer) Sign(resources *art.ArtResources) (*art.ArtistPublication, error) {
-	const logPrefix = "AustkServer Sign "
+func (server *AustkServer) Pubkey(ctx context.Context) (string, error) {
+	return server.publisher.Pubkey(ctx)
+}
 
-	publication, err := server.publisher.Sign(resources)
+// Sign signs the resources into a publication by the artist with artistID, who must be hosted by this server.
+// lnd signs the same resources only once, since their publication is cached to return again,
+// so callers must not modify the publication.
+func (server *AustkServer) Sign(ctx context.Context, artistID string, resources *art.ArtResources) (*art.ArtistPublication, error) {
+	logger := server.logger.With("artist_id", artistID)
+
+	publishingArtist, err := server.PublishingArtist(artistID)
 	if err != nil {
-		log.Fatalf(logPrefix+"lnd is not operational. SignMessage error: %v", err)
+		logger.Warn("failed to get publishing artist", "error", err)
 		return nil, err
 	}
-	publishingArtist, err := server.Artist()
+	if publishingArtist == nil {
+		logger.Error("server has no publishing artist")
+		return nil, fmt.Errorf("%w: no publishing artist %s", ErrArtNotFound, artistID)
+	}
+	resourceBytes, err := prepareForSigning(resources)
 	if err != nil {
-		log.Fatalf(logPrefix+"failed to get publishing artist, error: %v", err)
+		logger.Error("failed to marshal resources to sign", "error", err)
 		return nil, err
 	}
+	cacheKey := publicationKey{artistID: artistID, resourcesHash: sha256.Sum256(resourceBytes)}
+	publication := server.publications.get(cacheKey)
+	if publication != nil {
+		publicationCacheHitsTotal.Inc()
+	} else {
+		publication, err = server.publisher.Sign(ctx, artistID, resources)
+		if err != nil {
+			logger.Error("lnd is not operational", "error", err)
+			return nil, fmt.Errorf("lnd failed to sign for %s: %w", artistID, err)
+		}
+		publicationsSignedTotal.Inc()
+	}
 	if publication == nil {
-		log.Fatalf(logPrefix+"No publication to sign resources %v", resources)
-		return nil, ErrArtNotFound
+		logger.Error("publisher signed no publication")
+		return nil, fmt.Errorf("%w: no publication signed for %s", ErrArtNotFound, artistID)
 	} else if publication.Artist == nil {
-		log.Fatalf(logPrefix+"No publication artist to sign resources %v", resources)
-		return nil, ErrArtNotFound
-	}
-	if publishingArtist == nil {
-		log.Fatalf(logPrefix + "server has no publishingArtist")
-		return nil, ErrArtNotFound
+		logger.Error("publisher signed a publication with no artist")
+		return nil, fmt.Errorf("%w: no artist signed the publication for %s", ErrArtNotFound, artistID)
 	}
 	if publishingArtist.Pubkey != publication.Artist.Pubkey ||
 		publishingArtist.ArtistId != publication.Artist.ArtistId {
 		return nil, fmt.Errorf(
-			"lightning node signed with pubkey %s for artist %s but expected pubkey %s for %s",
+			"%w: lightning node signed with pubkey %s for artist %s but expected pubkey %s for %s",
+			ErrPubkeyMismatch,
 			publication.Artist.Pubkey, publication.Artist.ArtistId,
 			publishingArtist.Pubkey, publishingArtist.ArtistId)
 	}
 
+	server.publications.put(cacheKey, publication)
 	return publication, nil
 }
 
+// ValidatePublication checks the publication's signature through this server's lightning node
+// and returns the resources it publishes.
+// It returns a *ForeignArtError, which wraps ErrForeignArt, for the first record by an artist
+// that the publishing artist does not host, and ErrPublicationStale for a publication replayed
+// after a later one of the same artist pubkey was validated.
+func (server *AustkServer) ValidatePublication(ctx context.Context, publication *art.ArtistPublication) (*art.ArtResources, error) {
+	resources, err := server.publisher.ValidatePublication(ctx, publication)
+	if err != nil {
+		return nil, err
+	}
+	err = checkPublishedArtists(publication, resources, server.artServer)
+	if err != nil {
+		server.logger.Warn("reject publication with foreign art", "artist_id", publication.Artist.GetArtistId(), "error", err)
+		return nil, err
+	}
+	err = server.checkSequence(publication.Artist.Pubkey, resources.Sequence)
+	if err != nil {
+		server.logger.Warn("reject stale publication", "artist_id", publication.Artist.GetArtistId(), "error", err)
+		return nil, err
+	}
+	return resources, nil
+}
+
+// SignMessage signs message with the key of this server's lightning node.
+func (server *AustkServer) SignMessage(ctx context.Context, message []byte) (string, error) {
+	return server.publisher.SignMessage(ctx, message)
+}
+
+// VerifyMessage checks the signature of message through this server's lightning node and gets the signer's pubkey.
+func (server *AustkServer) VerifyMessage(ctx context.Context, message []byte, signature string) (string, error) {
+	return server.publisher.VerifyMessage(ctx, message, signature)
+}
+
+// AddInvoice adds an invoice for sats through this server's lightning node.
+func (server *AustkServer) AddInvoice(ctx context.Context, memo string, sats uint64) (string, []byte, error) {
+	return server.publisher.AddInvoice(ctx, memo, sats)
+}
+
+// PayInvoice pays an invoice for at most maxSats through this server's lightning node.
+func (server *AustkServer) PayInvoice(ctx context.Context, paymentRequest string, maxSats uint64) ([]byte, error) {
+	return server.publisher.PayInvoice(ctx, paymentRequest, maxSats)
+}
+
+// VerifyPayment checks that the invoice with invoiceHash is paid, as proven by preimage.
+func (server *AustkServer) VerifyPayment(ctx context.Context, invoiceHash, preimage []byte) (bool, error) {
+	return server.publisher.VerifyPayment(ctx, invoiceHash, preimage)
+}
+
+// Keysend pays sats without an invoice through this server's lightning node to the node with pubkey.
+func (server *AustkServer) Keysend(ctx context.Context, pubkey string, sats uint64) error {
+	return server.publisher.Keysend(ctx, pubkey, sats)
+}
+
+// CreateTrackInvoice creates a lightning invoice for the effective price of the given track.
+// The track's artist must be hosted by this server, and the invoice memo attributes the sale
+// to that artist by name and names the track as ArtistId/ArtistTrackId.
+func (server *AustkServer) CreateTrackInvoice(ctx context.Context, track *art.Track) (paymentRequest string, invoiceHash []byte, err error) {
+	logger := server.logger.With("artist_id", track.ArtistId, "track_id", track.ArtistTrackId)
+
+	artist, err := server.PublishingArtist(track.ArtistId)
+	if err != nil {
+		logger.Warn("cannot invoice track of artist not hosted", "error", err)
+		return "", nil, err
+	}
+	price, err := server.EffectiveTrackPrice(track)
+	if err != nil {
+		return "", nil, err
+	}
+	if price == 0 {
+		return "", nil, fmt.Errorf("track %s/%s is free", track.ArtistId, track.ArtistTrackId)
+	}
+
+	memo := resolveInvoiceMemo(server.config.invoiceMemo(), artist, track, price)
+	paymentRequest, invoiceHash, err = server.publisher.AddInvoice(ctx, memo, price)
+	if err != nil {
+		logger.Error("failed to add invoice", "sats", price, "error", err)
+		return "", nil, err
+	}
+	logger.Info("created invoice", "event", EventInvoiceCreated, "sats", price, "payment_request", paymentRequest)
+	invoicesCreatedTotal.Inc()
+
+	err = server.recordInvoice(invoiceHash, []*art.Track{track})
+	if err != nil {
+		return "", nil, err
+	}
+	return paymentRequest, invoiceHash, nil
+}
+
 // NewAustkServer creates a new network Server to serve the configured artist's art.
 func NewAustkServer(cfg *Config, localStorage ArtServer, publisher Publisher) (*AustkServer, error) {
-	const logPrefix = "server NewAustkServer "
-
+	ctx, cancel := context.WithCancel(context.Background())
 	server := &AustkServer{
 		artServer:   localStorage,
 		config:      cfg,
 		httpServer:  &http.Server{Addr: "localhost"},
 		publisher:   publisher,
 		quitChannel: make(chan bool),
+		ctx:         ctx,
+		cancel:      cancel,
+
+		publications: newPublicationCache(),
+
+		streams: make(map[string]*trackStream),
+
+		rateLimiter:       newRateLimiter(cfg.RequestsPerSecond, cfg.BytesPerSecond),
+		peerAuthenticator: newPeerAuthenticator(publisher, cfg.AllowedPeers),
+		bandwidth:         newBandwidthMeter(localStorage, cfg.PeerMonthlyQuota, cfg.QuotaPeriod),
+		trackStats:        newTrackCounter(localStorage),
+		events:            cfg.Events,
+
+		logger: cfg.componentLogger("server"),
 	}
+	server.peerClients = NewClientPool(cfg.TorProxy, server, cfg.MaxIdlePeers, cfg.peerIdleTimeout())
+	server.peerClients.compression = cfg.SyncCompression
+	ipfsNode, err := NewIPFSNode(cfg)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	server.peerClients.ipfs = ipfsNode
 
 	return server, nil
 }
 
 // Start the AustkServer listening for REST austk requests for art.
 func (s *AustkServer) Start() error {
-	const logPrefix = "AustkServer Start "
-
 	s.debugPrintInventory()
 
 	// Publish this austk node as the Peer with this server's Pubkey.
-	pubkey, err := s.publisher.Pubkey()
+	pubkey, err := s.publisher.Pubkey(s.ctx)
 	if err != nil {
-		log.Printf(logPrefix+"Pubkey retrieval error: %v", err)
+		s.logger.Error("failed to get pubkey", "error", err)
 		return err
 	}
-	log.Printf(logPrefix+"start with pubkey %s", pubkey)
-	restHost := s.RestHost()
+	logger := s.logger.With("pubkey", pubkey)
+	logger.Info("start", "version", Version, "commit", Commit, "build_date", BuildDate)
+	restHost := NormalizePeerHost(s.RestHost())
 	restPort := s.RestPort()
 
 	selfPeer, err := s.artServer.Peer(pubkey)
 	if err == ErrPeerNotFound {
-		log.Printf(logPrefix+"artServer has no peer with this publisher's pubkey %s", pubkey)
+		logger.Info("no stored peer has this publisher's pubkey")
 		selfPeer = &art.Peer{Pubkey: pubkey, Host: restHost, Port: restPort}
 	} else if err != nil {
-		log.Printf(logPrefix+"artServer.Peer(%v) error: %v", pubkey, err)
+		logger.Error("failed to get self peer", "error", err)
 		return err
 	} else {
-		if selfPeer.Host != restHost {
-			log.Printf(logPrefix+"Update self peer %s host from %s to %s",
-				pubkey, selfPeer.Host, restHost)
+		if selfPeer.Host != NormalizePeerHost(restHost) {
+			logger.Info("update self peer host", "old_host", selfPeer.Host, "host", restHost)
 			selfPeer.Host = restHost
 		}
 		if selfPeer.Port != restPort {
-			log.Printf(logPrefix+"Update self peer %s port from %d to %d",
-				pubkey, selfPeer.Port, restPort)
+			logger.Info("update self peer port", "old_port", selfPeer.Port, "port", restPort)
 			selfPeer.Port = restPort
 		}
 	}
 	err = s.artServer.StorePeer(selfPeer, s.publisher)
 	if err != nil {
-		log.Printf(logPrefix+"PutPeer %v error: %v", pubkey, err)
+		logger.Error("failed to store self peer", "error", err)
 		return err
 	}
 
 	// Listen for REST requests and serve in another thread.
 	go s.serve()
-	log.Printf(logPrefix+"serving REST requests for %s on %s:%d", pubkey, restHost, restPort)
+	logger.Info("serving REST requests", "host", restHost, "port", restPort, "listen_address", s.config.listenAddress())
 
 	return err
 }
 
 func (s *AustkServer) debugPrintInventory() {
-	const logPrefix = "server debugPrintInventory "
-
 	artists, err := s.artServer.Artists()
 	if err != nil {
-		log.Printf(logPrefix+"artServer.Artists error: %v", err)
+		s.logger.Error("failed to get artists", "error", err)
 		return
 	}
-	log.Printf(logPrefix+"%v artists:", len(artists))
+	s.logger.Debug("inventory", "artists", len(artists))
 	for artistID, artist := range artists {
-		log.Printf(logPrefix+"\tArtist id %s: %v", artistID, artist)
+		s.logger.Debug("inventory artist", "artist_id", artistID, "artist", artist)
 		tracks, err := s.artServer.Tracks(artistID)
 		if err != nil {
-			log.Printf(logPrefix+"artServer.Tracks error: %v", err)
+			s.logger.Error("failed to get tracks", "artist_id", artistID, "error", err)
 		}
 		for trackID, track := range tracks {
-			log.Printf("\t\tTrack id: %s: %v", trackID, track)
+			s.logger.Debug("inventory track", "artist_id", artistID, "track_id", trackID, "track", track)
 		}
 	}
 }
 
 // serve starts listening for and handling requests to austk endpoints.
 func (server *AustkServer) serve() (err error) {
-	const logPrefix = "server serve "
 	httpRouter := mux.NewRouter()
-	httpRouter.HandleFunc("/", server.getAllArtHandler).Methods("GET")
-	httpRouter.HandleFunc("/art/{artist:[^/]*}/{track:.*}", server.getArtHandler).Methods("GET")
-	restAddress := fmt.Sprintf(":%d", server.config.RestPort)
-	err = http.ListenAndServe(restAddress, httpRouter)
-	if err != nil {
-		log.Printf(logPrefix+"ListenAndServe error: %v", err)
+	server.handlePlayer(httpRouter)
+	// Limit the downloads and catalogs served to each client, so that no client can hog this node.
+	// A private node serves them only to allowed peers that sign a challenge from /challenge.
+	httpRouter.HandleFunc("/", server.peersOnly(server.rateLimited(server.getAllArtHandler))).Methods("GET")
+	httpRouter.HandleFunc("/handshake", server.rateLimited(server.handshakeHandler)).Methods("POST")
+	httpRouter.HandleFunc("/challenge", server.rateLimited(server.challengeHandler)).Methods("POST")
+	httpRouter.HandleFunc("/publications", server.peersOnly(server.rateLimited(server.publicationsHandler))).Methods("GET")
+	httpRouter.HandleFunc("/publication/{artist}", server.peersOnly(server.rateLimited(server.artistPublicationHandler))).Methods("GET")
+	httpRouter.HandleFunc("/art/{artist:[^/]*}/{track:.*}", server.peersOnly(server.rateLimited(server.getArtHandler))).Methods("GET")
+	httpRouter.HandleFunc("/cover/{artist:[^/]*}/{album:.*}", server.peersOnly(server.rateLimited(server.albumArtHandler))).Methods("GET")
+	httpRouter.HandleFunc("/preview/{artist:[^/]*}/{track:.*}", server.peersOnly(server.rateLimited(server.previewHandler))).Methods("GET")
+	httpRouter.HandleFunc("/invoice/{artist:[^/]*}/{track:.*}", server.peersOnly(server.rateLimited(server.createInvoiceHandler))).Methods("POST")
+	httpRouter.HandleFunc("/albuminvoice/{artist:[^/]*}/{album:.*}", server.peersOnly(server.rateLimited(server.createAlbumInvoiceHandler))).Methods("POST")
+	httpRouter.HandleFunc("/stream/{artist:[^/]*}/{track:.*}", server.peersOnly(server.rateLimited(server.startStreamHandler))).Methods("POST")
+	httpRouter.HandleFunc("/streaminvoice/{stream}", server.peersOnly(server.rateLimited(server.streamInvoiceHandler))).Methods("POST")
+	httpRouter.HandleFunc("/streamchunk/{stream}", server.peersOnly(server.rateLimited(server.streamChunkHandler))).Methods("GET")
+	httpRouter.HandleFunc("/artist/{artist}/catalog", server.peersOnly(server.rateLimited(server.catalogHandler))).Methods("GET")
+	httpRouter.HandleFunc("/recent", server.peersOnly(server.rateLimited(server.recentHandler))).Methods("GET")
+	httpRouter.HandleFunc("/peers/catalog", server.peersOnly(server.rateLimited(server.peersCatalogHandler))).Methods("GET")
+	httpRouter.HandleFunc("/healthz", server.healthzHandler).Methods("GET")
+	httpRouter.HandleFunc("/readyz", server.readyzHandler).Methods("GET")
+	httpRouter.HandleFunc("/status", server.statusHandler).Methods("GET")
+	// Admin requests need the -admintoken or the lnd macaroon.
+	httpRouter.HandleFunc("/events", server.adminOnly(server.eventsHandler)).Methods("GET")
+	httpRouter.HandleFunc("/art/{artist:[^/]*}/{track:.*}", server.adminOnly(server.deleteTrackHandler)).Methods("DELETE")
+	httpRouter.HandleFunc("/art/{artist:[^/]*}/{track:.*}", server.adminOnly(server.updateTrackHandler)).Methods("PATCH")
+	httpRouter.HandleFunc("/album/{artist:[^/]*}/{album:.*}", server.adminOnly(server.deleteAlbumHandler)).Methods("DELETE")
+	restAddress := server.config.listenAddress()
+	server.httpServer.Addr = restAddress
+	server.httpServer.Handler = server.versioned(httpRouter)
+	err = server.httpServer.ListenAndServe()
+	if err == http.ErrServerClosed {
+		server.logger.Info("stopped listening", "address", restAddress)
+		err = nil
+	} else if err != nil {
+		server.logger.Error("failed to listen and serve", "address", restAddress, "error", err)
 	}
 
 	return
@@ -224,88 +611,233 @@ func (server *AustkServer) serve() (err error) {
 
 // getAllArtHandler handles a request to get all the art from the ArtService.
 func (server *AustkServer) getAllArtHandler(w http.ResponseWriter, req *http.Request) {
-	const logPrefix = "server getAllArtHandler "
 	// TODO: read any predicates from req to filter results
 	// for price (per track, per minute, or per byte),
 	// preferred bit rate, or other conditions TBD.
 	// Maybe read any follow-back peer URL as well.
 
-	resources, err := CollectResources(server.artServer)
+	since, err := sinceParam(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// A client that wants only the art of one artist, or of one album, requests only that scope.
+	scopeArtistID := req.URL.Query().Get("artist")
+	scopeAlbumID := req.URL.Query().Get("album")
+	if scopeAlbumID != "" && scopeArtistID == "" {
+		http.Error(w, "album requires artist", http.StatusBadRequest)
+		return
+	}
+
+	resources, err := server.CollectResources()
 	if err != nil {
-		log.Printf(logPrefix+"collectResources error: %v", err)
+		server.logger.Error("failed to collect resources", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	// The art is as of its latest update, rather than now, so the same art makes the same publication
+	// to serve again without signing it again. Records updated later, even in the same second, are synced next time.
+	asOf := latestUpdate(resources)
+	resources.AsOf = asOf
+	if scopeArtistID != "" {
+		resources, err = resourcesInScope(resources, scopeArtistID, scopeAlbumID)
+		if err != nil {
+			server.logger.Info("no art in requested scope", "artist_id", scopeArtistID, "album_id", scopeAlbumID)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
+	// A since time later than the latest update is from before art was deleted or this server's clock was rewound,
+	// so reply with all the art for the client to sync again from scratch.
+	if since > 0 && since <= asOf {
+		resources = resourcesSince(resources, since)
+	}
 
-	publication, err := server.Sign(resources)
+	publishingArtist, err := server.Artist()
+	if err != nil {
+		server.logger.Error("failed to get publishing artist", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	publication, err := server.Sign(req.Context(), publishingArtist.ArtistId, resources)
 	if err != nil {
-		log.Printf(logPrefix+"failed to Sign resources %v, error: %v", resources, err)
+		server.logger.Error("failed to sign resources", "artist_id", publishingArtist.ArtistId, "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf(logPrefix+"Signed resources %v, publication: %v", resources, publication)
+	server.logger.Debug("signed resources", "artist_id", publishingArtist.ArtistId, "resources", resources)
 	responseData, err := proto.Marshal(publication)
 	if err != nil {
-		log.Printf(logPrefix+"Marshal %v, error: %v", publication, err)
+		server.logger.Error("failed to marshal publication", "artist_id", publishingArtist.ArtistId, "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	w.WriteHeader(http.StatusOK)
-	w.Write(responseData)
+	server.writeCompressed(w, req, responseData)
+}
+
+// sinceParam gets the ?since time of req, or 0 if it is not set.
+// A client that synced before requests only the art updated since the AsOf time of its last sync.
+func sinceParam(req *http.Request) (uint64, error) {
+	since := req.URL.Query().Get("since")
+	if since == "" {
+		return 0, nil
+	}
+	sinceTime, err := strconv.ParseUint(since, 10, 64)
+	if err != nil {
+		return 0, errors.New("since must be a Unix time")
+	}
+	return sinceTime, nil
 }
 
+// CollectResources collects the art from this server's ArtServer to publish,
+// with the effective price of each track resolved from the track, its album, or the node default.
+// It leaves out the art of artists synced from peers, which this server may not sign for,
+// but lists all the peers.
+func (server *AustkServer) CollectResources() (*art.ArtResources, error) {
+	resources, err := CollectResources(server.artServer)
+	if err != nil {
+		return nil, err
+	}
+	resources = server.hostedResources(resources)
+	resources.Tombstones, err = server.publishedTombstones(resources)
+	if err != nil {
+		return nil, err
+	}
+	for i, track := range resources.Tracks {
+		price, err := server.EffectiveTrackPrice(track)
+		if err != nil {
+			server.logger.Error("failed to get effective track price",
+				"artist_id", track.ArtistId, "track_id", track.ArtistTrackId, "error", err)
+			return nil, err
+		}
+		// Publish a copy so the stored track keeps only the price explicitly set for it.
+		pricedTrack := proto.Clone(track).(*art.Track)
+		pricedTrack.EffectivePriceSats = price
+		if price > 0 {
+			// Anyone with the CID could fetch a payload pinned in IPFS, e.g. before the track was priced, without paying.
+			pricedTrack.PayloadCid = ""
+		}
+		resources.Tracks[i] = pricedTrack
+	}
+	err = server.sequencer.stamp(resources, server.artServer)
+	if err != nil {
+		server.logger.Error("failed to stamp resources with sequence", "error", err)
+		return nil, err
+	}
+	return resources, nil
+}
+
+// hostedResources gets the art in resources by the artists hosted by this server, and all the peers.
+func (server *AustkServer) hostedResources(resources *art.ArtResources) *art.ArtResources {
+	isHosted := make(map[string]bool)
+	hostedResources := &art.ArtResources{Peers: resources.Peers}
+	for _, artist := range resources.Artists {
+		if _, err := server.PublishingArtist(artist.ArtistId); err == nil {
+			isHosted[artist.ArtistId] = true
+			hostedResources.Artists = append(hostedResources.Artists, artist)
+		}
+	}
+	for _, album := range resources.Albums {
+		if isHosted[album.ArtistId] {
+			hostedResources.Albums = append(hostedResources.Albums, album)
+		}
+	}
+	for _, track := range resources.Tracks {
+		if isHosted[track.ArtistId] {
+			hostedResources.Tracks = append(hostedResources.Tracks, track)
+		}
+	}
+	for _, playlist := range resources.Playlists {
+		if isHosted[playlist.ArtistId] {
+			hostedResources.Playlists = append(hostedResources.Playlists, playlist)
+		}
+	}
+	return hostedResources
+}
+
+// CollectResources collects all the artists, albums, tracks, playlists, and peers from the given ArtServer.
+// Each is listed in the same order every time, so the same art always marshals to the same bytes to sign:
+// artists by id, their albums and playlists by id, their tracks in album and track number order, and peers by pubkey.
 func CollectResources(artServer ArtServer) (*art.ArtResources, error) {
-	const logPrefix = "server collectResources "
+	logger := componentLogger("server")
 
 	artists, err := artServer.Artists()
 	if err != nil {
-		log.Printf(logPrefix+"SelectAllArtists error: %v", err)
+		logger.Error("failed to get artists", "error", err)
 		return nil, err
 	}
-	log.Printf(logPrefix+"found %d artists", len(artists))
+	artistIDs := make([]string, 0, len(artists))
+	for artistID := range artists {
+		artistIDs = append(artistIDs, artistID)
+	}
 	artistArray := make([]*art.Artist, 0, len(artists))
+	albumArray := make([]*art.Album, 0)
 	trackArray := make([]*art.Track, 0)
-	log.Println(logPrefix + "Select all artists:")
-	for _, artist := range artists {
-		log.Printf("\tArtist: %v", artist)
+	playlistArray := make([]*art.Playlist, 0)
+	for _, artistID := range sortedPage(artistIDs, 0, -1) {
+		artist := artists[artistID]
 		artistArray = append(artistArray, artist)
-		tracks, err := artServer.Tracks(artist.ArtistId)
+		for offset := 0; ; offset += pageSize {
+			albums, err := artServer.AlbumsPage(artist.ArtistId, offset, pageSize)
+			if err != nil {
+				logger.Error("failed to get albums page", "artist_id", artist.ArtistId, "offset", offset, "error", err)
+				return nil, err
+			}
+			albumArray = append(albumArray, albums...)
+			if len(albums) < pageSize {
+				break
+			}
+		}
+		for offset := 0; ; offset += pageSize {
+			tracks, err := artServer.TracksPage(artist.ArtistId, offset, pageSize)
+			if err != nil {
+				logger.Error("failed to get tracks page", "artist_id", artist.ArtistId, "offset", offset, "error", err)
+				return nil, err
+			}
+			trackArray = append(trackArray, tracks...)
+			if len(tracks) < pageSize {
+				break
+			}
+		}
+		playlists, err := artServer.Playlists(artist.ArtistId)
 		if err != nil {
-			log.Printf(logPrefix+"artServer.Tracks error: %v", err)
+			logger.Error("failed to get playlists", "artist_id", artist.ArtistId, "error", err)
 			return nil, err
 		}
-		for _, track := range tracks {
-			log.Printf("\tTrack: %v", track)
-			trackArray = append(trackArray, track)
-		}
+		playlistArray = append(playlistArray, pagePlaylists(playlists, 0, -1)...)
 	}
-	peers, err := artServer.Peers()
-	if err != nil {
-		log.Printf(logPrefix+"SelectAllPeers error: %v", err)
-		return nil, err
-	}
-	peerArray := make([]*art.Peer, 0, len(peers))
-	for _, peer := range peers {
-		log.Printf("\tPeer: %v", peer)
-		peerArray = append(peerArray, peer)
+	sortTracksInAlbumOrder(trackArray)
+	logger.Debug("collected art", "artists", len(artistArray), "albums", len(albumArray), "tracks", len(trackArray),
+		"playlists", len(playlistArray))
+	peerArray := make([]*art.Peer, 0)
+	for offset := 0; ; offset += pageSize {
+		peers, err := artServer.PeersPage(offset, pageSize)
+		if err != nil {
+			logger.Error("failed to get peers page", "offset", offset, "error", err)
+			return nil, err
+		}
+		peerArray = append(peerArray, peers...)
+		if len(peers) < pageSize {
+			break
+		}
 	}
 	resources := art.ArtResources{
-		Artists: artistArray,
-		Tracks:  trackArray,
-		Peers:   peerArray,
+		Artists:   artistArray,
+		Albums:    albumArray,
+		Tracks:    trackArray,
+		Peers:     peerArray,
+		Playlists: playlistArray,
 	}
 
 	return &resources, nil
 }
 
 func read(publication *art.ArtistPublication) (*art.ArtResources, error) {
-	const logPrefix = "server readPublication "
-
 	artResources := art.ArtResources{}
 	err := proto.Unmarshal(publication.SerializedArtResources, &artResources)
 	if err != nil {
-		log.Printf(logPrefix+"Unmarshal error: %v", err)
+		componentLogger("server").Warn("failed to unmarshal publication resources", "error", err)
 		return nil, err
 	}
 	return &artResources, nil
@@ -321,70 +853,484 @@ func (server *AustkServer) RestPort() uint32 {
 	return uint32(server.config.RestPort)
 }
 
-// WaitUntilQuitSignal waits for SIGINT (keyboard interrupt Ctrl-C) or for another reason to quit.
-func (server *AustkServer) WaitUntilQuitSignal() {
-	// Run a new thread to watch for a signal to quit.
-	go func() {
-		sigintKeyboardInterruptChannel := make(chan os.Signal, 1)
+// WaitUntilQuitSignal waits until quitCtx is done, e.g. by signal.NotifyContext on SIGINT (keyboard interrupt Ctrl-C),
+// or until Stop, then shuts down the server, waiting up to -shutdowntimeout for the requests in flight to finish.
+// Another SIGINT or SIGTERM while waiting closes their connections at once.
+func (server *AustkServer) WaitUntilQuitSignal(quitCtx context.Context) {
+	select {
+	case <-quitCtx.Done():
+		server.logger.Info("quit", "error", quitCtx.Err())
+	case <-server.quitChannel:
+	}
 
-		for {
-			select {
-			case <-sigintKeyboardInterruptChannel:
-				server.quitChannel <- true
-			}
+	forceSignals := make(chan os.Signal, 1)
+	signal.Notify(forceSignals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(forceSignals)
+	ctx, cancel := context.WithTimeout(context.Background(), server.config.shutdownTimeout())
+	defer cancel()
+	go func() {
+		select {
+		case <-forceSignals:
+			server.logger.Warn("quit again, close requests in flight")
+			cancel()
+		case <-ctx.Done():
 		}
 	}()
+	server.Shutdown(ctx)
+}
+
+// PeerClients gets the pool of clients to sync from peers, which Stop closes.
+func (server *AustkServer) PeerClients() *ClientPool {
+	return server.peerClients
+}
 
-	// Wait until the thread above signals through server.quitChannel
-	<-server.quitChannel
+// Shutdown stops the Server gracefully: it stops accepting connections and waits for the requests in flight,
+// e.g. downloads and stream chunks, to finish. If ctx is done first, it closes their connections
+// and returns the ctx error. Then it cancels the server's lnd calls, closes its idle connections to peers,
+// and stores the bytes served to each peer.
+func (server *AustkServer) Shutdown(ctx context.Context) error {
+	server.quitOnce.Do(func() { close(server.quitChannel) })
+	server.logger.Info("shut down, wait for requests in flight")
+	err := server.httpServer.Shutdown(ctx)
+	if err != nil {
+		server.logger.Warn("close requests still in flight", "error", err)
+		server.httpServer.Close()
+	}
+	server.cancel()
+	server.peerClients.Close()
+	server.bandwidth.flush()
+	server.trackStats.flush()
+	return err
 }
 
-// Stop the Server
+// Stop the Server at once, closing its connections, cancelling its lnd calls in flight,
+// closing its idle connections to peers, and storing the bytes served to each peer.
 func (server *AustkServer) Stop() error {
-	server.quitChannel <- true
+	server.quitOnce.Do(func() { close(server.quitChannel) })
+	err := server.httpServer.Close()
+	server.cancel()
+	server.peerClients.Close()
+	server.bandwidth.flush()
+	server.trackStats.flush()
+	return err
+}
+
+// createInvoiceHandler handles requests to buy a specified track by a specified artist
+// by replying with a lightning invoice for the track.
+func (server *AustkServer) createInvoiceHandler(w http.ResponseWriter, req *http.Request) {
+	artistID := mux.Vars(req)["artist"]
+	artistTrackID := mux.Vars(req)["track"]
+	logger := server.logger.With("artist_id", artistID, "track_id", artistTrackID)
+	track, err := server.artServer.Track(artistID, artistTrackID)
+	if err != nil || track == nil {
+		logger.Info("no track to invoice", "error", err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	price, err := server.EffectiveTrackPrice(track)
+	if err != nil {
+		logger.Error("failed to get effective track price", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	paymentRequest, invoiceHash, err := server.CreateTrackInvoice(req.Context(), track)
+	if err != nil {
+		logger.Warn("failed to create track invoice", "error", err)
+		if errors.Is(err, ErrArtNotFound) {
+			// This server does not host the artist to sell the track.
+			w.WriteHeader(http.StatusNotFound)
+		} else if errors.Is(err, ErrLndUnavailable) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	invoice := &art.Invoice{
+		ArtistId:       artistID,
+		ArtistTrackId:  artistTrackID,
+		PaymentRequest: paymentRequest,
+		InvoiceHash:    invoiceHash,
+		Sats:           price,
+	}
+	if acceptsJSON(req) {
+		server.writeInvoiceJSON(w, invoice)
+		return
+	}
+	responseData, err := proto.Marshal(invoice)
+	if err != nil {
+		logger.Error("failed to marshal invoice", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseData)
+}
+
+// checkPayment checks that hexPreimage proves payment of an invoice this server issued for track,
+// alone or with the other tracks of its album.
+func (server *AustkServer) checkPayment(ctx context.Context, track *art.Track, hexPreimage string) error {
+	trackPath := track.ArtistId + "/" + track.ArtistTrackId
+	if hexPreimage == "" {
+		return fmt.Errorf("%w for %s: POST /invoice/%s and pay the invoice", ErrPaymentRequired, trackPath, trackPath)
+	}
+	preimage, err := hex.DecodeString(hexPreimage)
+	if err != nil {
+		return fmt.Errorf("malformed %s header, error: %v", PreimageHeader, err)
+	}
+
+	invoiceHash := sha256.Sum256(preimage)
+	invoice, err := server.artServer.IssuedInvoice(invoiceHash[:])
+	if err != nil && err != ErrArtNotFound {
+		return err
+	}
+	invoicedTracks := invoicedTracks(invoice)
+	if !isInvoicedTrack(invoicedTracks, track) {
+		return fmt.Errorf("%w: preimage does not pay any invoice for %s", ErrPaymentRequired, trackPath)
+	}
+
+	isPaid, err := server.VerifyPayment(ctx, invoiceHash[:], preimage)
+	if err != nil {
+		return err
+	}
+	if !isPaid {
+		return fmt.Errorf("%w: invoice %x for %s is not settled", ErrPaymentRequired, invoiceHash, trackPath)
+	}
+
+	isNewlySettled, err := server.settleInvoice(invoiceHash[:])
+	if err != nil {
+		return err
+	}
+	if isNewlySettled {
+		paymentsSettledTotal.Inc()
+		server.logger.Info("payment settled", "event", EventPaymentSettled, "track", trackPath,
+			"invoice_hash", hex.EncodeToString(invoiceHash[:]))
+		for _, invoicedTrack := range invoicedTracks {
+			server.trackStats.count(invoicedTrack, 0, 1)
+		}
+	}
 	return nil
 }
 
+// isInvoicedTrack reports whether track is among the invoicedTracks of an invoice.
+func isInvoicedTrack(invoicedTracks []*art.Track, track *art.Track) bool {
+	for _, invoicedTrack := range invoicedTracks {
+		if invoicedTrack.ArtistId == track.ArtistId && invoicedTrack.ArtistTrackId == track.ArtistTrackId {
+			return true
+		}
+	}
+	return false
+}
+
 // getArtHandler handles requests to get a specified track by a specified artist.
 func (server *AustkServer) getArtHandler(w http.ResponseWriter, req *http.Request) {
-	const logPrefix = "server getArtHandler "
-
 	artistID := mux.Vars(req)["artist"]
 	artistTrackID := mux.Vars(req)["track"]
+	logger := server.logger.With("artist_id", artistID, "track_id", artistTrackID)
 	if artistID == "" || artistTrackID == "" {
-		log.Printf(logPrefix+"expected artist and track but received artist: %s, track: %s",
-			artistID, artistTrackID)
+		logger.Warn("expected artist and track")
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	log.Printf(logPrefix+"artist: %v, track: %v", artistID, artistTrackID)
+	logger.Debug("get art")
+	if server.rejectOverQuota(w, req) {
+		return
+	}
 
 	track, err := server.artServer.Track(artistID, artistTrackID)
+	if err == ErrArtNotFound {
+		logger.Info("no track to get")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		logger.Error("failed to get track", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Serve a track that has a price only to a client who proves payment of its invoice.
+	price, err := server.EffectiveTrackPrice(track)
 	if err != nil {
-		// TODO: if requested track isn't found, error with 404 Not Found
-		log.Printf(logPrefix+"failed to select track, error: %v", err)
+		logger.Error("failed to get effective track price", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if price > 0 {
+		err = server.checkPayment(req.Context(), track, req.Header.Get(PreimageHeader))
+		if err != nil {
+			logger.Info("reject unpaid request", "error", err)
+			if errors.Is(err, ErrPaymentRequired) {
+				http.Error(w, err.Error(), http.StatusPaymentRequired)
+			} else {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			}
+			return
+		}
+	}
 
-	// TODO: to require payment, check for secret received in receipt for paying invoice
-	// If valid secret is not supplied, issue a Lightning invoice.
-	// For now, skip the payment mechanics and serve the requested resource immediately.
+	w.Header().Set("Content-Type", TrackMime(track))
+	// Serve any range of a payload file, e.g. for a browser's <audio> to seek,
+	// but check the prefix of a resumed download against the payload as below.
 	trackFilePath := server.artServer.TrackFilePath(track)
-	mp3, err := OpenMp3ToRead(trackFilePath)
+	if trackFilePath != "" && req.Header.Get(PrefixChecksumHeader) == "" {
+		server.serveTrackFile(w, req, track, trackFilePath)
+		return
+	}
+
+	size, err := server.trackPayloadSize(track)
+	if isPayloadMissing(err) {
+		logger.Info("no track payload to get, e.g. evicted by -maxstorage")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		logger.Error("failed to get track payload size", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Serve a range of the track, e.g. the rest of it to a client resuming a download if its downloaded prefix matches.
+	offset, last, isRange, isSatisfiable := parseRange(req.Header.Get("Range"), size)
+	if !isSatisfiable {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	if isRange && req.Header.Get(PrefixChecksumHeader) != "" {
+		isPrefix, err := server.isPayloadPrefix(track, offset, req.Header.Get(PrefixChecksumHeader))
+		if err != nil {
+			logger.Error("failed to checksum payload prefix", "offset", offset, "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !isPrefix {
+			logger.Info("serve whole payload for mismatched prefix", "offset", offset)
+			isRange = false
+		}
+	}
+	if !isRange {
+		offset, last = 0, size-1
+	}
+
+	trackReader, err := server.artServer.TrackFilePartialReader(track, offset)
 	if err != nil {
-		log.Printf(logPrefix+"OpenMp3ForTrackToRead %s %s, error: %v", artistID, artistTrackID, err)
+		logger.Error("failed to read track file", "offset", offset, "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	defer trackReader.Close()
 
-	trackData, err := mp3.ReadBytes()
+	length := last - offset + 1
+	logger.Debug("serve track", "bytes", length, "size", size)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	if isRange {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, last, size))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	servedBytes, err := io.Copy(w, io.LimitReader(trackReader, length))
+	downloadBytesServedTotal.Add(float64(servedBytes))
+	server.recordBandwidth(req, uint64(servedBytes))
 	if err != nil {
-		log.Printf(logPrefix+"mp3.ReadBytes error: %v", err)
+		logger.Warn("failed to serve track", "served_bytes", servedBytes, "error", err)
+	} else if servedBytes == size {
+		// Count each download of the whole payload as a play, e.g. "bytes=0-" from a browser's <audio>,
+		// but not the rest of one resumed or a range a player seeks to.
+		server.trackStats.count(track, 1, 0)
+	} else {
+		server.trackStats.markPlayed(track)
+	}
+}
+
+// albumArtHandler handles requests for the cover art image of an album by a specified artist.
+// Cover art is served free, for clients to display albums before buying their tracks.
+func (server *AustkServer) albumArtHandler(w http.ResponseWriter, req *http.Request) {
+	artistID := mux.Vars(req)["artist"]
+	artistAlbumID := mux.Vars(req)["album"]
+	logger := server.logger.With("artist_id", artistID, "album_id", artistAlbumID)
+
+	image, mime, err := server.artServer.AlbumArt(artistID, artistAlbumID)
+	if err == ErrArtNotFound {
+		logger.Info("no album cover art to get")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		logger.Error("failed to get album cover art", "error", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	log.Printf(logPrefix+"serving track as %d bytes of data", len(trackData))
+	if !isAlbumArtMime(mime) {
+		// Serving another type, e.g. text/html, would run what the album's artist stored in browsers.
+		logger.Warn("refuse to serve album cover art that is not an image", "mime", mime)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	logger.Debug("serve album cover art", "bytes", len(image), "mime", mime)
+	w.Header().Set("Content-Type", mime)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Length", strconv.Itoa(len(image)))
 	w.WriteHeader(http.StatusOK)
-	w.Write(trackData)
+	w.Write(image)
+}
+
+// serveTrackFile serves the payload of track from the file at trackFilePath, or the ranges of it requested,
+// counting a download of the whole payload as a play.
+func (server *AustkServer) serveTrackFile(w http.ResponseWriter, req *http.Request, track *art.Track, trackFilePath string) {
+	logger := server.logger.With("artist_id", track.ArtistId, "track_id", track.ArtistTrackId)
+	trackFile, err := os.Open(trackFilePath)
+	if os.IsNotExist(err) {
+		logger.Info("no track file to get, e.g. evicted by -maxstorage", "path", trackFilePath)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	} else if err != nil {
+		logger.Error("failed to open track file", "path", trackFilePath, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer trackFile.Close()
+	fileInfo, err := trackFile.Stat()
+	if err != nil {
+		logger.Error("failed to stat track file", "path", trackFilePath, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	logger.Debug("serve track file", "range", req.Header.Get("Range"), "size", fileInfo.Size())
+	countingWriter := &statusCountingWriter{ResponseWriter: w}
+	http.ServeContent(countingWriter, req, "", fileInfo.ModTime(), trackFile)
+	downloadBytesServedTotal.Add(float64(countingWriter.bytes))
+	server.recordBandwidth(req, uint64(countingWriter.bytes))
+	isServed := countingWriter.status == http.StatusOK || countingWriter.status == http.StatusPartialContent
+	if isServed && countingWriter.bytes == fileInfo.Size() {
+		// Count each download of the whole payload as a play, e.g. "bytes=0-" from a browser's <audio>,
+		// but not each range a player seeks to. The parts of a multipart range add boundaries to more bytes.
+		server.trackStats.count(track, 1, 0)
+	} else if isServed {
+		server.trackStats.markPlayed(track)
+	}
+}
+
+// statusCountingWriter records the status and counts the bytes of the response written through it.
+type statusCountingWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusCountingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusCountingWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// parseRange parses a Range header requesting a single range of a payload of size bytes:
+// "bytes={first}-" for the rest of it after the bytes a client already has, "bytes={first}-{last}",
+// or "bytes=-{length}" for its last length bytes.
+// It returns the offsets of the first and last bytes of the range, with last clipped to the payload,
+// and isRange false for no Range header or an unsupported one, e.g. of several ranges, to serve the whole payload.
+// isSatisfiable is false only for a range that starts after the payload.
+func parseRange(rangeHeader string, size int64) (first, last int64, isRange, isSatisfiable bool) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(rangeHeader, prefix) {
+		return 0, 0, false, true
+	}
+	firstText, lastText, hasDash := strings.Cut(strings.TrimSpace(rangeHeader[len(prefix):]), "-")
+	if !hasDash || (firstText == "" && lastText == "") {
+		return 0, 0, false, true
+	}
+	if firstText == "" {
+		length, err := strconv.ParseInt(lastText, 10, 64)
+		if err != nil || length < 0 {
+			return 0, 0, false, true
+		}
+		if length == 0 || size == 0 {
+			return 0, 0, true, false
+		}
+		if length > size {
+			length = size
+		}
+		return size - length, size - 1, true, true
+	}
+	first, err := strconv.ParseInt(firstText, 10, 64)
+	if err != nil || first < 0 {
+		return 0, 0, false, true
+	}
+	last = size - 1
+	if lastText != "" {
+		last, err = strconv.ParseInt(lastText, 10, 64)
+		if err != nil || last < first {
+			return 0, 0, false, true
+		}
+		if last >= size {
+			last = size - 1
+		}
+	}
+	if first >= size {
+		return 0, 0, true, false
+	}
+	return first, last, true, true
+}
+
+// payloadSizer is implemented by an ArtServer that gets the size of a stored payload without reading it,
+// e.g. from an s3 bucket.
+type payloadSizer interface {
+	TrackPayloadSize(track *art.Track) (int64, error)
+}
+
+// trackPayloadSize gets the length in bytes of the stored payload of track.
+func (server *AustkServer) trackPayloadSize(track *art.Track) (int64, error) {
+	return payloadSize(server.artServer, track)
+}
+
+// isPayloadMissing checks whether err is from getting a payload that is not stored, e.g. evicted.
+func isPayloadMissing(err error) bool {
+	return errors.Is(err, ErrArtNotFound) || errors.Is(err, os.ErrNotExist)
+}
+
+// payloadSize gets the length in bytes of the payload of track stored by artServer: the size of its file if stored
+// in one, or else from artServer if it is a payloadSizer, or else by reading the payload.
+func payloadSize(artServer ArtServer, track *art.Track) (int64, error) {
+	if trackFilePath := artServer.TrackFilePath(track); trackFilePath != "" {
+		fileInfo, err := os.Stat(trackFilePath)
+		if err != nil {
+			return 0, err
+		}
+		return fileInfo.Size(), nil
+	}
+	if sizer, isSizer := artServer.(payloadSizer); isSizer {
+		return sizer.TrackPayloadSize(track)
+	}
+	payloadReader, err := artServer.TrackFilePartialReader(track, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer payloadReader.Close()
+	return io.Copy(ioutil.Discard, payloadReader)
+}
+
+// isPayloadPrefix checks whether the first length bytes of the payload of track have the hex checksum.
+func (server *AustkServer) isPayloadPrefix(track *art.Track, length int64, hexChecksum string) (bool, error) {
+	payloadReader, err := server.artServer.TrackFilePartialReader(track, 0)
+	if err != nil {
+		return false, err
+	}
+	defer payloadReader.Close()
+	checksum := crc32.NewIEEE()
+	_, err = io.CopyN(checksum, payloadReader, length)
+	if err != nil {
+		return false, err
+	}
+	return hex.EncodeToString(checksum.Sum(nil)) == hexChecksum, nil
 }
@@ -1,15 +1,30 @@
 package audiostrike
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	art "github.com/audiostrike/music/pkg/art"
 	"github.com/golang/protobuf/proto"
 	"github.com/gorilla/mux"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"os/signal"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 const (
@@ -30,11 +45,15 @@ var cfg *Config = &Config{
 var mockLightningClient MockLightningClient = MockLightningClient{}
 
 type MockArtServer struct {
-	artists  map[string]*art.Artist
-	albums   map[string]map[string]*art.Album
-	peers    map[string]*art.Peer
-	tracks   map[string]map[string]*art.Track
-	payloads map[string]map[string][]byte
+	artists   map[string]*art.Artist
+	albums    map[string]map[string]*art.Album
+	peers     map[string]*art.Peer
+	tracks    map[string]map[string]*art.Track
+	payloads  map[string]map[string][]byte
+	albumArt  map[string][]byte // indexed by artist id and album id joined by a slash
+	playlists map[string]map[string]*art.Playlist
+
+	issuedInvoices map[string]*art.IssuedInvoice // indexed by hex invoice hash, made when first stored
 }
 
 func (s *MockArtServer) Artists() (map[string]*art.Artist, error) {
@@ -54,6 +73,73 @@ func (s *MockArtServer) Albums(artistId string) (map[string]*art.Album, error) {
 	return s.albums[artistId], nil
 }
 
+func (s *MockArtServer) SetAlbumPrice(album *art.Album, sats uint64) error {
+	storedAlbum := s.albums[album.ArtistId][album.ArtistAlbumId]
+	if storedAlbum == nil {
+		return ErrArtNotFound
+	}
+	storedAlbum.Price = &art.Price{Sats: sats}
+	return nil
+}
+
+func (s *MockArtServer) StoreAlbumArt(album *art.Album, image []byte, mime string) error {
+	storedAlbum := s.albums[album.ArtistId][album.ArtistAlbumId]
+	if storedAlbum == nil {
+		return ErrArtNotFound
+	}
+	if s.albumArt == nil {
+		s.albumArt = make(map[string][]byte)
+	}
+	s.albumArt[album.ArtistId+"/"+album.ArtistAlbumId] = image
+	setAlbumArt(storedAlbum, image, mime)
+	return nil
+}
+
+func (s *MockArtServer) DeleteAlbum(album *art.Album) error {
+	if s.albums[album.ArtistId][album.ArtistAlbumId] == nil {
+		return ErrArtNotFound
+	}
+	for _, track := range s.tracks[album.ArtistId] {
+		if track.ArtistAlbumId == album.ArtistAlbumId {
+			return ErrAlbumNotEmpty
+		}
+	}
+	delete(s.albums[album.ArtistId], album.ArtistAlbumId)
+	delete(s.albumArt, album.ArtistId+"/"+album.ArtistAlbumId)
+	return nil
+}
+
+func (s *MockArtServer) AlbumArt(artistID string, artistAlbumID string) ([]byte, string, error) {
+	image, isStored := s.albumArt[artistID+"/"+artistAlbumID]
+	if !isStored {
+		return nil, "", ErrArtNotFound
+	}
+	return image, s.albums[artistID][artistAlbumID].CoverArtMime, nil
+}
+
+func (s *MockArtServer) StorePlaylist(playlist *art.Playlist, publisher Publisher) error {
+	if s.playlists == nil {
+		s.playlists = make(map[string]map[string]*art.Playlist)
+	}
+	if s.playlists[playlist.ArtistId] == nil {
+		s.playlists[playlist.ArtistId] = make(map[string]*art.Playlist)
+	}
+	s.playlists[playlist.ArtistId][playlist.ArtistPlaylistId] = playlist
+	return nil
+}
+
+func (s *MockArtServer) Playlists(artistID string) (map[string]*art.Playlist, error) {
+	return s.playlists[artistID], nil
+}
+
+func (s *MockArtServer) Playlist(artistID string, artistPlaylistID string) (*art.Playlist, error) {
+	playlist := s.playlists[artistID][artistPlaylistID]
+	if playlist == nil {
+		return nil, ErrArtNotFound
+	}
+	return playlist, nil
+}
+
 func (s *MockArtServer) Peer(pubkey string) (*art.Peer, error) {
 	for _, peer := range s.peers {
 		if peer.Pubkey == pubkey {
@@ -67,6 +153,18 @@ func (s *MockArtServer) Peers() (map[string]*art.Peer, error) {
 	return s.peers, nil
 }
 
+func (s *MockArtServer) PeersPage(offset int, limit int) ([]*art.Peer, error) {
+	return pagePeers(s.peers, offset, limit), nil
+}
+
+func (s *MockArtServer) AlbumsPage(artistID string, offset int, limit int) ([]*art.Album, error) {
+	return pageAlbums(s.albums[artistID], offset, limit), nil
+}
+
+func (s *MockArtServer) TracksPage(artistID string, offset int, limit int) ([]*art.Track, error) {
+	return pageTracks(s.tracks[artistID], offset, limit), nil
+}
+
 func (s *MockArtServer) StoreArtist(artist *art.Artist) error {
 	return fmt.Errorf("not implemented")
 }
@@ -97,11 +195,61 @@ func (s *MockArtServer) TrackFilePath(track *art.Track) string {
 	return filepath.Join(cfg.ArtDir, track.ArtistId, track.ArtistTrackId+".mp3")
 }
 
+func (s *MockArtServer) TrackFilePartialReader(track *art.Track, offset int64) (io.ReadCloser, error) {
+	return openPayloadFile(s.TrackFilePath(track), offset)
+}
+
+func (s *MockArtServer) SearchArtists(query string) ([]*art.Artist, error) {
+	return searchArtists(s.artists, query), nil
+}
+
+func (s *MockArtServer) SearchTracks(query string, filter TrackFilter) ([]*art.Track, error) {
+	return searchTracks(s.tracks, query, filter), nil
+}
+
+func (s *MockArtServer) StoreTrackPreview(track *art.Track, preview []byte) error {
+	return nil
+}
+
+func (s *MockArtServer) TrackPreview(artistID string, artistTrackID string) ([]byte, error) {
+	return nil, ErrArtNotFound
+}
+
+func (s *MockArtServer) RecentTracks(limit int) ([]*art.Track, error) {
+	return recentTracks(s.tracks, limit), nil
+}
+
+func (s *MockArtServer) VerifyStoredTrack(track *art.Track) error {
+	return verifyPayloadFile(s.TrackFilePath(track), track)
+}
+
 func (s *MockArtServer) StoreTrack(track *art.Track, publisher Publisher) error {
 	s.tracks[track.ArtistId][track.ArtistTrackId] = track
 	return nil
 }
 
+func (s *MockArtServer) SetTrackPrice(track *art.Track, sats uint64) error {
+	storedTrack := s.tracks[track.ArtistId][track.ArtistTrackId]
+	if storedTrack == nil {
+		return ErrArtNotFound
+	}
+	storedTrack.Price = &art.Price{Sats: sats}
+	return nil
+}
+
+func (s *MockArtServer) EvictTrack(track *art.Track) error {
+	return fmt.Errorf("MockArtServer EvictTrack not implemented")
+}
+
+func (s *MockArtServer) DeleteTrack(track *art.Track) error {
+	if s.tracks[track.ArtistId][track.ArtistTrackId] == nil {
+		return ErrArtNotFound
+	}
+	delete(s.tracks[track.ArtistId], track.ArtistTrackId)
+	delete(s.payloads[track.ArtistId], track.ArtistTrackId)
+	return nil
+}
+
 func (s *MockArtServer) StoreTrackPayload(track *art.Track, payload []byte) error {
 	s.payloads[track.ArtistId][track.ArtistTrackId] = payload
 	return nil
@@ -111,10 +259,98 @@ func (s *MockArtServer) Tracks(artistId string) (map[string]*art.Track, error) {
 	return s.tracks[artistId], nil
 }
 
+func (s *MockArtServer) DeletePeer(pubkey string) error {
+	return ErrPeerNotFound
+}
+
 func (s *MockArtServer) StorePublication(publication *art.ArtistPublication) error {
 	return fmt.Errorf("MockArtServer StorePublication not implemented")
 }
 
+func (s *MockArtServer) SyncCursor(pubkey string) (uint64, error) {
+	return 0, nil
+}
+
+func (s *MockArtServer) StoreSyncCursor(pubkey string, asOf uint64) error {
+	return nil
+}
+
+func (s *MockArtServer) PublicationSequence(pubkey string) (uint64, error) {
+	return 0, nil
+}
+
+func (s *MockArtServer) StorePublicationSequence(pubkey string, sequence uint64) error {
+	return nil
+}
+
+func (s *MockArtServer) StoreTombstone(tombstone *art.Tombstone) error {
+	return nil
+}
+
+func (s *MockArtServer) Tombstones() ([]*art.Tombstone, error) {
+	return nil, nil
+}
+
+func (s *MockArtServer) DeleteExpiredTombstones(deletedBefore uint64) error {
+	return nil
+}
+
+func (s *MockArtServer) PeerReputation(pubkey string) (*art.PeerReputation, error) {
+	return &art.PeerReputation{Pubkey: pubkey}, nil
+}
+
+func (s *MockArtServer) StorePeerReputation(reputation *art.PeerReputation) error {
+	return nil
+}
+
+func (s *MockArtServer) PeerBandwidth(pubkey string) (*art.PeerBandwidth, error) {
+	return &art.PeerBandwidth{Pubkey: pubkey}, nil
+}
+
+func (s *MockArtServer) StorePeerBandwidth(bandwidth *art.PeerBandwidth) error {
+	return nil
+}
+
+func (s *MockArtServer) TrackStats(artistID string, artistTrackID string) (*art.TrackStats, error) {
+	return &art.TrackStats{ArtistId: artistID, ArtistTrackId: artistTrackID}, nil
+}
+
+func (s *MockArtServer) StoreTrackStats(stats *art.TrackStats) error {
+	return nil
+}
+
+func (s *MockArtServer) AddTrackStats(stats *art.TrackStats) error {
+	return nil
+}
+
+func (s *MockArtServer) DeleteTrackStats(artistID string, artistTrackID string) error {
+	return nil
+}
+
+func (s *MockArtServer) TopTrackStats(limit int) ([]*art.TrackStats, error) {
+	return nil, nil
+}
+
+func (s *MockArtServer) StoreIssuedInvoice(invoice *art.IssuedInvoice) error {
+	if s.issuedInvoices == nil {
+		s.issuedInvoices = make(map[string]*art.IssuedInvoice)
+	}
+	s.issuedInvoices[issuedInvoiceKey(invoice.InvoiceHash)] = invoice
+	return nil
+}
+
+func (s *MockArtServer) IssuedInvoice(invoiceHash []byte) (*art.IssuedInvoice, error) {
+	invoice := s.issuedInvoices[issuedInvoiceKey(invoiceHash)]
+	if invoice == nil {
+		return nil, ErrArtNotFound
+	}
+	return invoice, nil
+}
+
+func (s *MockArtServer) DeleteExpiredInvoices(expiredBefore uint64) error {
+	return nil
+}
+
 var mockArtServer MockArtServer = MockArtServer{
 	artists: map[string]*art.Artist{
 		mockArtistID: &art.Artist{
@@ -235,6 +471,689 @@ func TestGetArt(t *testing.T) {
 	}
 }
 
+// TestCreateInvoice tests that AustkServer invoices a track for its effective price.
+func TestCreateInvoice(t *testing.T) {
+	invoiceCfg := *cfg
+	invoiceCfg.DefaultPrice = 1500
+	mockLightningNode, err := NewMockLightningNode(&invoiceCfg, &mockArtServer)
+	if err != nil {
+		t.Errorf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(&invoiceCfg, &mockArtServer, mockLightningNode)
+	if err != nil {
+		t.Errorf("Failed to connect to music DB, error %v", err)
+	}
+
+	testRouter := mux.NewRouter()
+	testRouter.HandleFunc("/invoice/{artist:[^/]*}/{track:.*}",
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			austkServer.createInvoiceHandler(w, req)
+		})).Methods("POST")
+	testHttpServer := httptest.NewServer(testRouter)
+	defer testHttpServer.Close()
+
+	invoiceUrl := fmt.Sprintf("%s/invoice/%s/%s", testHttpServer.URL, mockArtistID, mockTrackID)
+	response, err := http.Post(invoiceUrl, "application/octet-stream", nil)
+	if err != nil {
+		t.Fatalf("Post %s, error: %v", invoiceUrl, err)
+	}
+	if response.StatusCode != 200 {
+		t.Errorf("expected success but got %d", response.StatusCode)
+	}
+	bytes, err := ioutil.ReadAll(response.Body)
+	invoice := art.Invoice{}
+	err = proto.Unmarshal(bytes, &invoice)
+	if err != nil {
+		t.Errorf("failed to deserialize invoice %v, error: %v", bytes, err)
+	}
+	if invoice.Sats != 1500 || invoice.PaymentRequest == "" || len(invoice.InvoiceHash) == 0 {
+		t.Errorf("expected invoice for 1500 sats but got %v", invoice)
+	}
+
+	response, err = http.Post(fmt.Sprintf("%s/invoice/%s/nosuchtrack", testHttpServer.URL, mockArtistID),
+		"application/octet-stream", nil)
+	if err != nil || response.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found invoicing unknown track but got %v, error: %v", response, err)
+	}
+}
+
+// TestGetArtRequiresPayment tests that a track with a price is served only with proof of payment.
+func TestGetArtRequiresPayment(t *testing.T) {
+	pricedCfg := *cfg
+	pricedCfg.DefaultPrice = 1500
+	mockLightningNode, err := NewMockLightningNode(&pricedCfg, &mockArtServer)
+	if err != nil {
+		t.Errorf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(&pricedCfg, &mockArtServer, mockLightningNode)
+	if err != nil {
+		t.Errorf("Failed to connect to music DB, error %v", err)
+	}
+
+	testRouter := mux.NewRouter()
+	testRouter.HandleFunc("/art/{artist:[^/]*}/{track:.*}",
+		http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			austkServer.getArtHandler(w, req)
+		})).Methods("GET")
+	testHttpServer := httptest.NewServer(testRouter)
+	defer testHttpServer.Close()
+	artRequestUrl := fmt.Sprintf("%s/art/%s/%s", testHttpServer.URL, mockArtistID, mockTrackID)
+
+	getWithPreimage := func(preimage string) int {
+		request, _ := http.NewRequest("GET", artRequestUrl, nil)
+		if preimage != "" {
+			request.Header.Set(PreimageHeader, preimage)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("Get %s error: %v", artRequestUrl, err)
+		}
+		return response.StatusCode
+	}
+
+	if status := getWithPreimage(""); status != http.StatusPaymentRequired {
+		t.Errorf("expected payment required without preimage but got %d", status)
+	}
+	if status := getWithPreimage(hex.EncodeToString([]byte("not invoiced"))); status != http.StatusPaymentRequired {
+		t.Errorf("expected payment required with preimage of no invoice but got %d", status)
+	}
+
+	// The mock lightning node hashes the invoice memo, so the memo is the preimage of its invoice.
+	track, _ := mockArtServer.Track(mockArtistID, mockTrackID)
+	_, _, err = austkServer.CreateTrackInvoice(context.Background(), track)
+	if err != nil {
+		t.Errorf("CreateTrackInvoice error: %v", err)
+	}
+	artist, _ := austkServer.Artist()
+	paidPreimage := hex.EncodeToString([]byte(mockArtistID + "/" + mockTrackID + " by " + artist.Name))
+	if status := getWithPreimage(paidPreimage); status == http.StatusPaymentRequired {
+		t.Errorf("expected track to be served for paid invoice but got %d", status)
+	}
+}
+
+// TestGetArtRange verifies that a range of a track payload is served as 206 Partial Content
+// with its content type, so that a browser's <audio> can seek in it,
+// whether the payload is stored in a file or not.
+func TestGetArtRange(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	t.Run("file", func(t *testing.T) { testGetArtRange(t, fileServer) })
+	t.Run("memory", func(t *testing.T) { testGetArtRange(t, NewMemoryArtServer()) })
+}
+
+func testGetArtRange(t *testing.T, artServer ArtServer) {
+	austkServer, err := NewAustkServer(cfg, artServer, &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "seekable", Title: "Seekable",
+		Container: ContainerFlac, Codec: CodecFlac, Price: &art.Price{Sats: 0}}
+	err = artServer.StoreTrack(track, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	err = artServer.StoreTrackPayload(track, []byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("StoreTrackPayload error: %v", err)
+	}
+
+	tests := []struct {
+		rangeHeader  string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{"", http.StatusOK, "0123456789abcdef", ""},
+		{"bytes=4-7", http.StatusPartialContent, "4567", "bytes 4-7/16"},
+		{"bytes=-3", http.StatusPartialContent, "def", "bytes 13-15/16"},
+		{"bytes=10-", http.StatusPartialContent, "abcdef", "bytes 10-15/16"},
+		{"bytes=0-", http.StatusPartialContent, "0123456789abcdef", "bytes 0-15/16"},
+		{"bytes=12-99", http.StatusPartialContent, "cdef", "bytes 12-15/16"},
+		{"bytes=16-", http.StatusRequestedRangeNotSatisfiable, "", "bytes */16"},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", "/art/"+mockArtistID+"/seekable", nil)
+		if test.rangeHeader != "" {
+			request.Header.Set("Range", test.rangeHeader)
+		}
+		request = mux.SetURLVars(request, map[string]string{"artist": mockArtistID, "track": "seekable"})
+		recorder := httptest.NewRecorder()
+		austkServer.getArtHandler(recorder, request)
+		if recorder.Code != test.status || recorder.Header().Get("Content-Range") != test.contentRange {
+			t.Errorf("range %q: expected %d with Content-Range %q but got %d with %q", test.rangeHeader,
+				test.status, test.contentRange, recorder.Code, recorder.Header().Get("Content-Range"))
+		}
+		if test.body != "" && (recorder.Body.String() != test.body ||
+			recorder.Header().Get("Content-Length") != strconv.Itoa(len(test.body))) {
+			t.Errorf("range %q: expected %q but got %q of length %s", test.rangeHeader, test.body,
+				recorder.Body.String(), recorder.Header().Get("Content-Length"))
+		}
+		if test.status != http.StatusRequestedRangeNotSatisfiable && (recorder.Header().Get("Content-Type") != "audio/flac" ||
+			recorder.Header().Get("Accept-Ranges") != "bytes") {
+			t.Errorf("range %q: expected audio/flac with byte ranges but got %q, Accept-Ranges %q", test.rangeHeader,
+				recorder.Header().Get("Content-Type"), recorder.Header().Get("Accept-Ranges"))
+		}
+	}
+}
+
+// TestHostedArtists tests that a server hosting several artists signs and sells as each of them
+// and keeps the configured artist as its default.
+func TestHostedArtists(t *testing.T) {
+	const hostedArtistID = "hostedartist"
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	hostingCfg := *cfg
+	hostingCfg.HostedArtistIDs = []string{hostedArtistID, mockArtistID}
+	hostingCfg.DefaultPrice = 1000
+	mockLightningNode, err := NewMockLightningNode(&hostingCfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(&hostingCfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+
+	defaultArtist, err := austkServer.Artist()
+	if err != nil || defaultArtist.ArtistId != mockArtistID {
+		t.Errorf("expected default artist %s but got %v, error: %v", mockArtistID, defaultArtist, err)
+	}
+	resources := &art.ArtResources{}
+	for _, artistID := range []string{mockArtistID, hostedArtistID} {
+		publication, err := austkServer.Sign(context.Background(), artistID, resources)
+		if err != nil {
+			t.Errorf("Sign as %s, error: %v", artistID, err)
+		} else if publication.Artist.ArtistId != artistID {
+			t.Errorf("expected publication by %s but got %v", artistID, publication.Artist)
+		}
+	}
+	_, err = austkServer.Sign(context.Background(), unknownID, resources)
+	if !errors.Is(err, ErrArtNotFound) {
+		t.Errorf("expected ErrArtNotFound signing as unhosted artist but got %v", err)
+	}
+
+	hostedTrack := &art.Track{ArtistId: hostedArtistID, ArtistTrackId: "hostedtrack", Title: "Hosted Track"}
+	paymentRequest, _, err := austkServer.CreateTrackInvoice(context.Background(), hostedTrack)
+	if err != nil {
+		t.Errorf("CreateTrackInvoice for hosted artist, error: %v", err)
+	}
+	// The mock lightning node encodes the invoice memo in the payment request.
+	memo := hex.EncodeToString([]byte(hostedArtistID + "/hostedtrack by " + hostedArtistID))
+	if !strings.HasSuffix(paymentRequest, memo) {
+		t.Errorf("expected invoice attributed to %s but got %s", hostedArtistID, paymentRequest)
+	}
+	_, _, err = austkServer.CreateTrackInvoice(context.Background(), &art.Track{ArtistId: unknownID, ArtistTrackId: "othertrack"})
+	if !errors.Is(err, ErrArtNotFound) {
+		t.Errorf("expected ErrArtNotFound invoicing unhosted artist's track but got %v", err)
+	}
+}
+
+// TestCollectResourcesDeterministic verifies that the same stored art is always collected in the same order,
+// so that it marshals to the same bytes to sign every time.
+func TestCollectResourcesDeterministic(t *testing.T) {
+	memoryServer := NewMemoryArtServer()
+	artistIDs := []string{"zoe", "mallory", "bob", mockArtistID, "carol", "dave", "erin", "frank"}
+	for _, artistID := range artistIDs {
+		err := memoryServer.StoreArtist(&art.Artist{ArtistId: artistID, Name: artistID, Pubkey: mockPubkey})
+		if err != nil {
+			t.Fatalf("StoreArtist error: %v", err)
+		}
+	}
+	for _, albumID := range []string{"third", "second", "first"} {
+		err := memoryServer.StoreAlbum(&art.Album{ArtistId: mockArtistID, ArtistAlbumId: albumID, Title: albumID}, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreAlbum error: %v", err)
+		}
+		for _, trackNumber := range []uint32{3, 1, 2} {
+			track := &art.Track{ArtistId: mockArtistID, ArtistAlbumId: albumID, AlbumTrackNumber: trackNumber,
+				ArtistTrackId: fmt.Sprintf("%s/%d", albumID, trackNumber), Title: fmt.Sprintf("Track %d", trackNumber)}
+			err = memoryServer.StoreTrack(track, &mockPublisher)
+			if err != nil {
+				t.Fatalf("StoreTrack error: %v", err)
+			}
+		}
+	}
+
+	var firstBytes []byte
+	for i := 0; i < 20; i++ {
+		resources, err := CollectResources(memoryServer)
+		if err != nil {
+			t.Fatalf("CollectResources error: %v", err)
+		}
+		resourceBytes, err := prepareForSigning(resources)
+		if err != nil {
+			t.Fatalf("prepareForSigning error: %v", err)
+		}
+		if i == 0 {
+			firstBytes = resourceBytes
+			for j := 1; j < len(resources.Artists); j++ {
+				if resources.Artists[j-1].ArtistId >= resources.Artists[j].ArtistId {
+					t.Errorf("expected artists ordered by id but got %s before %s",
+						resources.Artists[j-1].ArtistId, resources.Artists[j].ArtistId)
+				}
+			}
+			if track := resources.Tracks[0]; track.ArtistAlbumId != "first" || track.AlbumTrackNumber != 1 {
+				t.Errorf("expected first track of first album collected first but got %v", track)
+			}
+		} else if !bytes.Equal(resourceBytes, firstBytes) {
+			t.Fatalf("expected the same bytes each time art is collected but collection %d differs", i)
+		}
+	}
+}
+
+// TestCatalogHandler tests that an artist's catalog is served as JSON with prices and payload hashes.
+func TestCatalogHandler(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	pricedCfg := *cfg
+	pricedCfg.DefaultPrice = 1000
+	mockLightningNode, err := NewMockLightningNode(&pricedCfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(&pricedCfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	album := &art.Album{ArtistId: mockArtistID, ArtistAlbumId: "album", Title: "Album", Price: &art.Price{Sats: 2000}}
+	err = fileServer.StoreAlbum(album, austkServer)
+	if err != nil {
+		t.Fatalf("StoreAlbum error: %v", err)
+	}
+	tracks := []*art.Track{
+		&art.Track{ArtistId: mockArtistID, ArtistAlbumId: "album", ArtistTrackId: "album/first", Title: "First"},
+		&art.Track{ArtistId: mockArtistID, ArtistTrackId: "single", Title: "Single", Container: ContainerFlac},
+	}
+	for _, track := range tracks {
+		err = fileServer.StoreTrack(track, austkServer)
+		if err != nil {
+			t.Fatalf("StoreTrack error: %v", err)
+		}
+	}
+	err = fileServer.StoreTrackPayload(tracks[1], []byte("single payload"))
+	if err != nil {
+		t.Fatalf("StoreTrackPayload error: %v", err)
+	}
+
+	testRouter := mux.NewRouter()
+	testRouter.HandleFunc("/artist/{artist}/catalog", austkServer.catalogHandler).Methods("GET")
+	testHttpServer := httptest.NewServer(testRouter)
+	defer testHttpServer.Close()
+
+	response, err := http.Get(fmt.Sprintf("%s/artist/%s/catalog", testHttpServer.URL, mockArtistID))
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("expected catalog but got %v, error: %v", response, err)
+	}
+	defer response.Body.Close()
+	if contentType := response.Header.Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("expected json content but got %s", contentType)
+	}
+	var catalog Catalog
+	err = json.NewDecoder(response.Body).Decode(&catalog)
+	if err != nil {
+		t.Fatalf("Decode catalog error: %v", err)
+	}
+	payloadHash := sha256.Sum256([]byte("single payload"))
+	expectedTracks := []CatalogTrack{
+		{ArtistTrackID: "album/first", ArtistAlbumID: "album", Title: "First", Container: ContainerMp3, Codec: CodecMp3, PriceSats: 2000},
+		{ArtistTrackID: "single", Title: "Single", Container: ContainerFlac, Codec: CodecFlac, PriceSats: 1000,
+			PayloadSha256: hex.EncodeToString(payloadHash[:])},
+	}
+	if catalog.ArtistID != mockArtistID || len(catalog.Albums) != 1 || *catalog.Albums[0].PriceSats != 2000 {
+		t.Errorf("expected %s catalog with album priced 2000 sats but got %+v", mockArtistID, catalog)
+	}
+	if !reflect.DeepEqual(catalog.Tracks, expectedTracks) {
+		t.Errorf("expected tracks %+v but got %+v", expectedTracks, catalog.Tracks)
+	}
+	etag := response.Header.Get("ETag")
+	if etag == "" || response.Header.Get("Last-Modified") == "" {
+		t.Errorf("expected catalog tagged with ETag and Last-Modified but got headers %v", response.Header)
+	}
+
+	getIfNoneMatch := func(etag string) *http.Response {
+		request, _ := http.NewRequest("GET", fmt.Sprintf("%s/artist/%s/catalog", testHttpServer.URL, mockArtistID), nil)
+		request.Header.Set("If-None-Match", etag)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("conditional GET error: %v", err)
+		}
+		response.Body.Close()
+		return response
+	}
+	if response := getIfNoneMatch(etag); response.StatusCode != http.StatusNotModified {
+		t.Errorf("expected unchanged catalog not modified but got %d", response.StatusCode)
+	}
+	err = fileServer.StoreTrack(&art.Track{ArtistId: mockArtistID, ArtistTrackId: "another", Title: "Another"}, austkServer)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	response = getIfNoneMatch(etag)
+	if response.StatusCode != http.StatusOK || response.Header.Get("ETag") == etag {
+		t.Errorf("expected changed catalog served with a new ETag but got %d with %s", response.StatusCode,
+			response.Header.Get("ETag"))
+	}
+
+	response, err = http.Get(fmt.Sprintf("%s/artist/%s/catalog", testHttpServer.URL, unknownID))
+	if err != nil || response.StatusCode != http.StatusNotFound {
+		t.Errorf("expected not found for unknown artist but got %v, error: %v", response, err)
+	}
+}
+
+// TestRecentHandler tests that the newest tracks are listed first with their published prices, up to the limit.
+func TestRecentHandler(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	pricedCfg := *cfg
+	pricedCfg.DefaultPrice = 1000
+	mockLightningNode, err := NewMockLightningNode(&pricedCfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(&pricedCfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	for _, track := range []*art.Track{
+		&art.Track{ArtistId: mockArtistID, ArtistTrackId: "older", Title: "Older", CreatedAt: 100},
+		&art.Track{ArtistId: mockArtistID, ArtistTrackId: "newer", Title: "Newer", CreatedAt: 200,
+			Price: &art.Price{Sats: 3000}},
+	} {
+		err = fileServer.StoreTrack(track, austkServer)
+		if err != nil {
+			t.Fatalf("StoreTrack error: %v", err)
+		}
+	}
+
+	testRouter := mux.NewRouter()
+	testRouter.HandleFunc("/recent", austkServer.recentHandler).Methods("GET")
+	testHttpServer := httptest.NewServer(testRouter)
+	defer testHttpServer.Close()
+
+	getRecent := func(query string) (*http.Response, RecentCatalog) {
+		response, err := http.Get(testHttpServer.URL + "/recent" + query)
+		if err != nil {
+			t.Fatalf("GET /recent%s error: %v", query, err)
+		}
+		defer response.Body.Close()
+		var catalog RecentCatalog
+		if response.StatusCode == http.StatusOK {
+			err = json.NewDecoder(response.Body).Decode(&catalog)
+			if err != nil {
+				t.Fatalf("Decode recent tracks error: %v", err)
+			}
+		}
+		return response, catalog
+	}
+	response, catalog := getRecent("")
+	if response.StatusCode != http.StatusOK || len(catalog.Tracks) != 2 {
+		t.Fatalf("expected 2 recent tracks but got %d %+v", response.StatusCode, catalog)
+	}
+	newer, older := catalog.Tracks[0], catalog.Tracks[1]
+	if newer.ArtistID != mockArtistID || newer.ArtistTrackID != "newer" || newer.CreatedAt != 200 || newer.PriceSats != 3000 {
+		t.Errorf("expected newer track priced 3000 sats first but got %+v", newer)
+	}
+	if older.ArtistTrackID != "older" || older.CreatedAt != 100 || older.PriceSats != 1000 {
+		t.Errorf("expected older track at the default price last but got %+v", older)
+	}
+
+	response, catalog = getRecent("?limit=1")
+	if response.StatusCode != http.StatusOK || len(catalog.Tracks) != 1 || catalog.Tracks[0].ArtistTrackID != "newer" {
+		t.Errorf("expected only the newer track but got %d %+v", response.StatusCode, catalog)
+	}
+	if response, _ = getRecent("?limit=many"); response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected bad request for invalid limit but got %d", response.StatusCode)
+	}
+}
+
+// TestPeersCatalog tests that the stored peers are cataloged with when each was last seen and reachable.
+func TestPeersCatalog(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	peer := &art.Peer{Pubkey: "peerpubkey", Host: "peer.onion", Port: 53545}
+	err = fileServer.StorePublication(peerPublication(peer))
+	if err != nil {
+		t.Fatalf("StorePublication error: %v", err)
+	}
+	err = fileServer.StorePeerReputation(&art.PeerReputation{Pubkey: peer.Pubkey, LastSeenAt: 1600000100, LastReachableAt: 1600000000})
+	if err != nil {
+		t.Fatalf("StorePeerReputation error: %v", err)
+	}
+
+	catalog, err := austkServer.PeersCatalog()
+	if err != nil {
+		t.Fatalf("PeersCatalog error: %v", err)
+	}
+	expectedPeer := CatalogPeer{Pubkey: "peerpubkey", Host: "peer.onion", Port: 53545, LastSeenAt: 1600000100, LastReachableAt: 1600000000}
+	var cataloged bool
+	for _, catalogPeer := range catalog.Peers {
+		if catalogPeer.Pubkey == peer.Pubkey {
+			cataloged = reflect.DeepEqual(catalogPeer, expectedPeer)
+		}
+	}
+	if !cataloged {
+		t.Errorf("expected catalog to have peer %+v but got %+v", expectedPeer, catalog.Peers)
+	}
+}
+
+// slowArtServer is an ArtServer whose Track blocks until release is closed, to hold a download in flight.
+// It sends on trackRequested when Track is called.
+type slowArtServer struct {
+	ArtServer
+	trackRequested chan bool
+	release        chan bool
+}
+
+func (artServer *slowArtServer) Track(artistID string, artistTrackID string) (*art.Track, error) {
+	artServer.trackRequested <- true
+	<-artServer.release
+	return artServer.ArtServer.Track(artistID, artistTrackID)
+}
+
+// startSlowDownloadServer starts an AustkServer, quitting after shutdownTimeout, on a free port
+// with a track "slow" whose download waits in slowArtServer.Track until released.
+// It returns the server, its slow storage, and its URL.
+func startSlowDownloadServer(t *testing.T, shutdownTimeout time.Duration) (*AustkServer, *slowArtServer, string) {
+	fileServer, err := NewFileServer(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileServer error: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	shutdownCfg := *cfg
+	shutdownCfg.RestPort = port
+	shutdownCfg.ShutdownTimeout = shutdownTimeout
+	mockLightningNode, err := NewMockLightningNode(&shutdownCfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	slowStorage := &slowArtServer{ArtServer: fileServer, trackRequested: make(chan bool, 1), release: make(chan bool)}
+	austkServer, err := NewAustkServer(&shutdownCfg, slowStorage, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "slow", Title: "Slow"}
+	err = fileServer.StoreTrack(track, austkServer)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	err = fileServer.StoreTrackPayload(track, []byte("slow payload"))
+	if err != nil {
+		t.Fatalf("StoreTrackPayload error: %v", err)
+	}
+	err = austkServer.Start()
+	if err != nil {
+		t.Fatalf("Start error: %v", err)
+	}
+	serverURL := fmt.Sprintf("http://127.0.0.1:%d", port)
+	for i := 0; ; i++ {
+		response, err := http.Get(serverURL + "/healthz")
+		if err == nil {
+			response.Body.Close()
+			break
+		} else if i == 100 {
+			t.Fatalf("server did not start listening, error: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return austkServer, slowStorage, serverURL
+}
+
+// TestShutdownDrainsDownload tests that Shutdown stops accepting connections
+// but lets a download in flight finish before it returns.
+func TestShutdownDrainsDownload(t *testing.T) {
+	austkServer, slowStorage, serverURL := startSlowDownloadServer(t, 0)
+	payload := []byte("slow payload")
+
+	type download struct {
+		body []byte
+		err  error
+	}
+	downloaded := make(chan download)
+	go func() {
+		response, err := http.Get(fmt.Sprintf("%s/art/%s/slow", serverURL, mockArtistID))
+		if err != nil {
+			downloaded <- download{err: err}
+			return
+		}
+		defer response.Body.Close()
+		body, err := ioutil.ReadAll(response.Body)
+		downloaded <- download{body: body, err: err}
+	}()
+	<-slowStorage.trackRequested
+
+	shutdownErr := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownErr <- austkServer.Shutdown(ctx)
+	}()
+	// Shutdown closes the listener before waiting for the download in flight.
+	for i := 0; ; i++ {
+		response, err := http.Get(serverURL + "/healthz")
+		if err != nil {
+			break
+		}
+		response.Body.Close()
+		if i == 100 {
+			t.Fatalf("expected server to stop accepting connections on shutdown")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("expected Shutdown to wait for the download in flight but it returned %v", err)
+	default:
+	}
+
+	close(slowStorage.release)
+	result := <-downloaded
+	if result.err != nil || string(result.body) != string(payload) {
+		t.Errorf("expected download in flight to finish with %q but got %q, error: %v", payload, result.body, result.err)
+	}
+	err := <-shutdownErr
+	if err != nil {
+		t.Errorf("expected Shutdown to drain the download but got %v", err)
+	}
+}
+
+// TestSecondSignalClosesDownload tests that WaitUntilQuitSignal waits for a download in flight after the quit signal
+// but closes it at once on a second SIGINT rather than waiting out -shutdowntimeout.
+func TestSecondSignalClosesDownload(t *testing.T) {
+	// Catch SIGINT in the test too, so a signal sent before WaitUntilQuitSignal catches it does not kill the test.
+	caughtSignals := make(chan os.Signal, 1)
+	signal.Notify(caughtSignals, os.Interrupt)
+	defer signal.Stop(caughtSignals)
+	austkServer, slowStorage, serverURL := startSlowDownloadServer(t, time.Minute)
+	defer close(slowStorage.release)
+
+	downloadErr := make(chan error)
+	go func() {
+		response, err := http.Get(fmt.Sprintf("%s/art/%s/slow", serverURL, mockArtistID))
+		if err == nil {
+			_, err = ioutil.ReadAll(response.Body)
+			response.Body.Close()
+		}
+		downloadErr <- err
+	}()
+	<-slowStorage.trackRequested
+
+	quitCtx, quit := context.WithCancel(context.Background())
+	quit()
+	quitted := make(chan bool)
+	go func() {
+		austkServer.WaitUntilQuitSignal(quitCtx)
+		close(quitted)
+	}()
+	select {
+	case <-quitted:
+		t.Fatalf("expected WaitUntilQuitSignal to wait for the download in flight")
+	case <-time.After(100 * time.Millisecond):
+	}
+	// Signal again until WaitUntilQuitSignal, which may not be catching SIGINT yet, quits.
+	for isQuit := false; !isQuit; {
+		err := syscall.Kill(os.Getpid(), syscall.SIGINT)
+		if err != nil {
+			t.Fatalf("Kill error: %v", err)
+		}
+		select {
+		case <-quitted:
+			isQuit = true
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	err := <-downloadErr
+	if err == nil {
+		t.Errorf("expected the download in flight to be closed on a second signal")
+	}
+}
+
 // Verify that the server publishes itself as the Peer with its Pubkey.
 func TestPeersForServerPubkey(t *testing.T) {
 	mockLightningNode, err := NewMockLightningNode(cfg, &mockArtServer)
@@ -251,7 +1170,7 @@ func TestPeersForServerPubkey(t *testing.T) {
 	if err != nil {
 		t.Errorf("Failed to Start austkServer, error: %v", err)
 	}
-	lndPubkey, err := austkServer.Pubkey()
+	lndPubkey, err := austkServer.Pubkey(context.Background())
 	if err != nil {
 		t.Errorf("lndPubkey error: %v", err)
 	}
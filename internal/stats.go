@@ -0,0 +1,136 @@
+package audiostrike
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	// statsFlushInterval is how often a trackCounter adds the plays and purchases it counted to the stored stats,
+	// so that playing a track does not store the stats of every track.
+	statsFlushInterval = time.Minute
+	// maxPendingTrackStats is how many tracks a trackCounter counts before it stores their stats early.
+	maxPendingTrackStats = 4096
+)
+
+// trackCounter counts the plays and purchases of each track in an ArtServer.
+// The counts are local analytics, kept apart from the art so they are never signed or synced.
+// It keeps the counts in memory and adds them to the stored stats every statsFlushInterval and by flush.
+type trackCounter struct {
+	artServer ArtServer
+
+	// pending maps the key of each track to its plays and purchases counted since they were last stored.
+	pending     map[string]*art.TrackStats
+	lastFlushAt time.Time
+	// mutex locks pending.
+	mutex sync.Mutex
+
+	// now gets the current time.
+	now    func() time.Time
+	logger *slog.Logger
+}
+
+// newTrackCounter creates a trackCounter storing the stats of each track in artServer.
+func newTrackCounter(artServer ArtServer) *trackCounter {
+	return &trackCounter{
+		artServer: artServer,
+		pending:   make(map[string]*art.TrackStats),
+		now:       time.Now,
+		logger:    componentLogger("trackCounter"),
+	}
+}
+
+// count adds plays and purchases to the stats of track.
+// It stores the counts of every track if they were last stored statsFlushInterval ago.
+func (counter *trackCounter) count(track *art.Track, plays uint64, purchases uint64) {
+	counter.add(track, plays, purchases, plays > 0)
+}
+
+// markPlayed records that part of track was played now without counting a play, e.g. a range a player seeks to,
+// so that retention keeps the payload of a track still listened to.
+func (counter *trackCounter) markPlayed(track *art.Track) {
+	counter.add(track, 0, 0, true)
+}
+
+// add adds plays and purchases to the stats of track, and the time now as when it was last played if isPlayed.
+func (counter *trackCounter) add(track *art.Track, plays uint64, purchases uint64, isPlayed bool) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	key := memoryKey(track.ArtistId, track.ArtistTrackId)
+	stats := counter.pending[key]
+	if stats == nil {
+		stats = &art.TrackStats{ArtistId: track.ArtistId, ArtistTrackId: track.ArtistTrackId}
+		counter.pending[key] = stats
+	}
+	now := counter.now()
+	stats.Plays += plays
+	stats.Purchases += purchases
+	if isPlayed {
+		stats.LastPlayedAt = uint64(now.Unix())
+	}
+	if now.Sub(counter.lastFlushAt) >= statsFlushInterval || len(counter.pending) >= maxPendingTrackStats {
+		counter.flushLocked()
+	}
+}
+
+// flush adds the plays and purchases counted since they were last stored to the stored stats,
+// e.g. as the server shuts down.
+func (counter *trackCounter) flush() {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	counter.flushLocked()
+}
+
+// flushLocked adds the pending counts to the stored stats, keeping any that fail to store to try again.
+// The caller must hold counter.mutex.
+func (counter *trackCounter) flushLocked() {
+	counter.lastFlushAt = counter.now()
+	for key, stats := range counter.pending {
+		err := counter.artServer.AddTrackStats(stats)
+		if err != nil {
+			counter.logger.Error("failed to store track stats",
+				"artist_id", stats.ArtistId, "track_id", stats.ArtistTrackId, "error", err)
+			continue
+		}
+		delete(counter.pending, key)
+	}
+}
+
+// trackStats gets the stats of the track with artistTrackID by the artist with artistID,
+// including the counts not stored yet.
+func (counter *trackCounter) trackStats(artistID string, artistTrackID string) (*art.TrackStats, error) {
+	stats, err := counter.artServer.TrackStats(artistID, artistTrackID)
+	if err != nil {
+		return nil, err
+	}
+	stats = proto.Clone(stats).(*art.TrackStats)
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+	if pendingStats := counter.pending[memoryKey(artistID, artistTrackID)]; pendingStats != nil {
+		addTrackStats(stats, pendingStats)
+	}
+	return stats, nil
+}
+
+// addTrackStats adds the plays and purchases of added to stats, keeping the later LastPlayedAt.
+func addTrackStats(stats *art.TrackStats, added *art.TrackStats) {
+	stats.Plays += added.Plays
+	stats.Purchases += added.Purchases
+	if added.LastPlayedAt > stats.LastPlayedAt {
+		stats.LastPlayedAt = added.LastPlayedAt
+	}
+}
+
+// TrackStats gets how many times this server has played track, by starting a stream or serving a whole download,
+// and how many times it has sold track, by settling an invoice for it.
+func (server *AustkServer) TrackStats(track *art.Track) (plays, purchases uint64, err error) {
+	stats, err := server.trackStats.trackStats(track.ArtistId, track.ArtistTrackId)
+	if err != nil {
+		return 0, 0, err
+	}
+	return stats.Plays, stats.Purchases, nil
+}
@@ -0,0 +1,159 @@
+package audiostrike
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/gorilla/mux"
+)
+
+// TestTrackCounterConcurrent verifies that plays and purchases counted at once are each counted.
+func TestTrackCounterConcurrent(t *testing.T) {
+	artServer := NewMemoryArtServer()
+	counter := newTrackCounter(artServer)
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "popular"}
+
+	var counting sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		counting.Add(1)
+		go func(i int) {
+			defer counting.Done()
+			counter.count(track, 1, uint64(i%2))
+		}(i)
+	}
+	counting.Wait()
+
+	stats, err := counter.trackStats(mockArtistID, "popular")
+	if err != nil || stats.Plays != 50 || stats.Purchases != 25 {
+		t.Errorf("expected 50 plays and 25 purchases counted but got %v, error: %v", stats, err)
+	}
+	counter.flush()
+	stats, err = artServer.TrackStats(mockArtistID, "popular")
+	if err != nil || stats.Plays != 50 || stats.Purchases != 25 {
+		t.Errorf("expected 50 plays and 25 purchases stored but got %v, error: %v", stats, err)
+	}
+}
+
+// TestTrackCounterFlush verifies that counts are stored when statsFlushInterval has passed since they were last stored,
+// and counted meanwhile without being stored.
+func TestTrackCounterFlush(t *testing.T) {
+	artServer := NewMemoryArtServer()
+	counter := newTrackCounter(artServer)
+	now := time.Unix(1600000000, 0)
+	counter.now = func() time.Time { return now }
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "batched"}
+
+	counter.count(track, 1, 0)
+	now = now.Add(time.Second)
+	counter.count(track, 1, 0)
+	stored, err := artServer.TrackStats(mockArtistID, "batched")
+	if err != nil || stored.Plays != 1 {
+		t.Errorf("expected only the first play stored but got %v, error: %v", stored, err)
+	}
+	counted, err := counter.trackStats(mockArtistID, "batched")
+	if err != nil || counted.Plays != 2 || counted.LastPlayedAt != uint64(now.Unix()) {
+		t.Errorf("expected 2 plays counted, the last at %d, but got %v, error: %v", now.Unix(), counted, err)
+	}
+
+	now = now.Add(statsFlushInterval)
+	counter.count(track, 0, 1)
+	stored, err = artServer.TrackStats(mockArtistID, "batched")
+	if err != nil || stored.Plays != 2 || stored.Purchases != 1 {
+		t.Errorf("expected 2 plays and 1 purchase stored after %v but got %v, error: %v", statsFlushInterval, stored, err)
+	}
+}
+
+// TestMalformedStatsFile verifies that a FileServer sets aside a .stats file it cannot read rather than failing to start.
+func TestMalformedStatsFile(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	err = ioutil.WriteFile(filepath.Join(artDir, ".stats"), []byte("not track stats"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile error: %v", err)
+	}
+
+	artServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("expected malformed .stats file set aside but got NewFileServer error: %v", err)
+	}
+	stats, err := artServer.TrackStats(mockArtistID, "played")
+	if err != nil || stats.Plays != 0 {
+		t.Errorf("expected no plays but got %v, error: %v", stats, err)
+	}
+	setAside, err := filepath.Glob(filepath.Join(artDir, ".stats.malformed-*"))
+	if err != nil || len(setAside) != 1 {
+		t.Errorf("expected the malformed .stats file set aside but got %v, error: %v", setAside, err)
+	}
+}
+
+// TestDownloadCountsPlays verifies that each whole download of a track counts a play, but resuming one does not,
+// and that a FileServer keeps the counts when reopened.
+func TestDownloadCountsPlays(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	artServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	austkServer, err := NewAustkServer(cfg, artServer, &mockPublisher)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: "played", Title: "Played", Price: &art.Price{Sats: 0}}
+	err = artServer.StoreTrack(track, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	err = artServer.StoreTrackPayload(track, []byte("twelve bytes"))
+	if err != nil {
+		t.Fatalf("StoreTrackPayload error: %v", err)
+	}
+	download := func(rangeHeader string) {
+		request := httptest.NewRequest("GET", "/art/"+mockArtistID+"/played", nil)
+		if rangeHeader != "" {
+			request.Header.Set("Range", rangeHeader)
+		}
+		request = mux.SetURLVars(request, map[string]string{"artist": mockArtistID, "track": "played"})
+		recorder := httptest.NewRecorder()
+		austkServer.getArtHandler(recorder, request)
+		if recorder.Code != http.StatusOK && recorder.Code != http.StatusPartialContent {
+			t.Fatalf("expected download served but got %d", recorder.Code)
+		}
+	}
+
+	download("bytes=6-")
+	stats, err := austkServer.trackStats.trackStats(mockArtistID, "played")
+	if err != nil || stats.Plays != 0 || stats.LastPlayedAt == 0 {
+		t.Errorf("expected a range played without counting a play but got %v, error: %v", stats, err)
+	}
+	download("")
+	download("bytes=0-")
+	download("bytes=0-1")
+	plays, purchases, err := austkServer.TrackStats(track)
+	if err != nil || plays != 2 || purchases != 0 {
+		t.Errorf("expected 2 plays and no purchases but got %d and %d, error: %v", plays, purchases, err)
+	}
+	austkServer.Stop()
+
+	reopenedServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	stats, err = reopenedServer.TrackStats(mockArtistID, "played")
+	if err != nil || stats.Plays != 2 {
+		t.Errorf("expected 2 plays read from the .stats file but got %v, error: %v", stats, err)
+	}
+}
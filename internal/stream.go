@@ -0,0 +1,460 @@
+package audiostrike
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+	"github.com/gorilla/mux"
+)
+
+// streamIdleTimeout is how long a stream is kept after its client last asked for an invoice or a chunk.
+const streamIdleTimeout = time.Hour
+
+// trackStream is the server's bookkeeping for a client streaming a track by paying for it chunk by chunk.
+// It remembers how many bytes are paid so a client that reconnects is not charged again for them.
+type trackStream struct {
+	track      *art.Track
+	totalBytes uint64
+	chunkCount uint64
+	chunkSats  uint64
+	price      uint64
+
+	// lastActiveAt is when the client last asked for an invoice or a chunk, guarded by the server's streamMutex.
+	lastActiveAt time.Time
+
+	// mutex serializes invoicing and releasing the chunks of this stream without blocking other streams.
+	mutex sync.Mutex
+	// paidChunks is the number of chunks that the client has paid.
+	paidChunks uint64
+	// paidBytes is the length of the prefix of the track payload that the client has paid.
+	paidBytes uint64
+	// pendingInvoice is the invoice for the next chunk, if issued and not yet paid.
+	pendingInvoice *art.StreamInvoice
+}
+
+// chunkEnd gets the offset just past the chunk with the given index. The chunks differ in length by at most a byte,
+// so there are exactly chunkCount of them.
+func (stream *trackStream) chunkEnd(index uint64) uint64 {
+	return stream.totalBytes * (index + 1) / stream.chunkCount
+}
+
+// chunkPrice gets the price of the chunk with the given index: chunkSats, or the rest of the price for the last chunk,
+// so the chunks add up to the track price.
+func (stream *trackStream) chunkPrice(index uint64) uint64 {
+	if index+1 == stream.chunkCount {
+		return stream.price - index*stream.chunkSats
+	}
+	return stream.chunkSats
+}
+
+// stream gets the stream with streamID, or nil if there is none, and marks it active.
+func (server *AustkServer) stream(streamID string) *trackStream {
+	server.streamMutex.Lock()
+	defer server.streamMutex.Unlock()
+	stream := server.streams[streamID]
+	if stream != nil {
+		stream.lastActiveAt = time.Now()
+	}
+	return stream
+}
+
+// startStream stores stream with streamID and forgets the streams idle over streamIdleTimeout.
+func (server *AustkServer) startStream(streamID string, stream *trackStream) {
+	server.streamMutex.Lock()
+	defer server.streamMutex.Unlock()
+	now := time.Now()
+	for idleID, idleStream := range server.streams {
+		if now.Sub(idleStream.lastActiveAt) > streamIdleTimeout {
+			delete(server.streams, idleID)
+		}
+	}
+	stream.lastActiveAt = now
+	server.streams[streamID] = stream
+}
+
+// startStreamHandler handles a request to stream a track paying chunkSats per chunk.
+// It replies with the invoice for the first chunk.
+func (server *AustkServer) startStreamHandler(w http.ResponseWriter, req *http.Request) {
+	artistID := mux.Vars(req)["artist"]
+	artistTrackID := mux.Vars(req)["track"]
+	logger := server.logger.With("artist_id", artistID, "track_id", artistTrackID)
+	chunkSats, err := strconv.ParseUint(req.URL.Query().Get("chunksats"), 10, 64)
+	if err != nil || chunkSats == 0 {
+		http.Error(w, "chunksats must be a positive number of satoshis", http.StatusBadRequest)
+		return
+	}
+	track, err := server.artServer.Track(artistID, artistTrackID)
+	if err != nil || track == nil {
+		logger.Info("no track to stream", "error", err)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	price, err := server.EffectiveTrackPrice(track)
+	if err != nil {
+		logger.Error("failed to get effective track price", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if price == 0 {
+		http.Error(w, "track is free to download without streaming payments", http.StatusBadRequest)
+		return
+	}
+	size, err := server.trackPayloadSize(track)
+	if err != nil {
+		logger.Error("failed to get track payload size", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Split the payload into as many chunks as it takes to pay the price at chunkSats per chunk.
+	totalBytes := uint64(size)
+	if totalBytes == 0 {
+		http.Error(w, "track has no payload to stream", http.StatusNotFound)
+		return
+	}
+	chunkCount := (price + chunkSats - 1) / chunkSats
+	if chunkCount > totalBytes {
+		http.Error(w, fmt.Sprintf("chunksats must be at least %d to split the track into chunks of a byte or more",
+			(price+totalBytes-1)/totalBytes), http.StatusBadRequest)
+		return
+	}
+	stream := &trackStream{
+		track:      track,
+		totalBytes: totalBytes,
+		chunkCount: chunkCount,
+		chunkSats:  chunkSats,
+		price:      price,
+	}
+
+	idBytes := make([]byte, 16)
+	_, err = rand.Read(idBytes)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	streamID := hex.EncodeToString(idBytes)
+	server.startStream(streamID, stream)
+	logger.Info("start stream", "stream_id", streamID, "chunk_count", chunkCount, "chunk_sats", chunkSats)
+	server.trackStats.count(track, 1, 0)
+
+	server.writeStreamInvoice(req.Context(), w, streamID)
+}
+
+// streamInvoiceHandler handles a request for the invoice to pay for the next chunk of a stream.
+func (server *AustkServer) streamInvoiceHandler(w http.ResponseWriter, req *http.Request) {
+	server.writeStreamInvoice(req.Context(), w, mux.Vars(req)["stream"])
+}
+
+// writeStreamInvoice replies with the invoice for the next unpaid chunk of the stream,
+// reusing any invoice already issued for it.
+func (server *AustkServer) writeStreamInvoice(ctx context.Context, w http.ResponseWriter, streamID string) {
+	stream := server.stream(streamID)
+	if stream == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+	if stream.paidBytes >= stream.totalBytes {
+		http.Error(w, "stream is fully paid", http.StatusGone)
+		return
+	}
+
+	if stream.pendingInvoice == nil {
+		offset := stream.paidBytes
+		length := stream.chunkEnd(stream.paidChunks) - offset
+		sats := stream.chunkPrice(stream.paidChunks)
+		memo := fmt.Sprintf("%s/%s bytes %d-%d", stream.track.ArtistId, stream.track.ArtistTrackId, offset, offset+length-1)
+		paymentRequest, invoiceHash, err := server.publisher.AddInvoice(ctx, memo, sats)
+		if err != nil {
+			server.logger.Error("failed to add stream invoice", "stream_id", streamID, "memo", memo, "sats", sats, "error", err)
+			if errors.Is(err, ErrLndUnavailable) {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			} else {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+		stream.pendingInvoice = &art.StreamInvoice{
+			StreamId: streamID,
+			Invoice: &art.Invoice{
+				ArtistId:       stream.track.ArtistId,
+				ArtistTrackId:  stream.track.ArtistTrackId,
+				PaymentRequest: paymentRequest,
+				InvoiceHash:    invoiceHash,
+				Sats:           sats,
+			},
+			Offset:     offset,
+			Length:     length,
+			TotalBytes: stream.totalBytes,
+		}
+	}
+
+	responseData, err := proto.Marshal(stream.pendingInvoice)
+	if err != nil {
+		server.logger.Error("failed to marshal stream invoice", "stream_id", streamID, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseData)
+}
+
+// streamChunkHandler handles a request for the bytes of a stream from the given offset.
+// Bytes already paid are served again without payment, e.g. after a dropped connection.
+// Otherwise the preimage of the pending chunk invoice must prove payment to release that chunk.
+func (server *AustkServer) streamChunkHandler(w http.ResponseWriter, req *http.Request) {
+	streamID := mux.Vars(req)["stream"]
+	offset, err := strconv.ParseUint(req.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		http.Error(w, "offset must be a byte offset into the track", http.StatusBadRequest)
+		return
+	}
+	if server.rejectOverQuota(w, req) {
+		return
+	}
+
+	stream := server.stream(streamID)
+	if stream == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	stream.mutex.Lock()
+	defer stream.mutex.Unlock()
+
+	if offset >= stream.paidBytes {
+		pendingInvoice := stream.pendingInvoice
+		if pendingInvoice == nil || offset != pendingInvoice.Offset {
+			http.Error(w, fmt.Sprintf("payment required for bytes from %d: POST /streaminvoice/%s", offset, streamID),
+				http.StatusPaymentRequired)
+			return
+		}
+		preimage, err := hex.DecodeString(req.Header.Get(PreimageHeader))
+		if err != nil || len(preimage) == 0 {
+			http.Error(w, "payment required for chunk: pay the stream invoice", http.StatusPaymentRequired)
+			return
+		}
+		isPaid, err := server.VerifyPayment(req.Context(), pendingInvoice.Invoice.InvoiceHash, preimage)
+		if err != nil {
+			server.logger.Error("failed to verify stream payment", "stream_id", streamID, "error", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !isPaid {
+			http.Error(w, "chunk invoice is not settled", http.StatusPaymentRequired)
+			return
+		}
+		stream.paidChunks++
+		stream.paidBytes = pendingInvoice.Offset + pendingInvoice.Length
+		stream.pendingInvoice = nil
+	}
+
+	chunk, err := server.readPayloadRange(stream.track, offset, stream.paidBytes-offset)
+	if err != nil {
+		server.logger.Error("failed to read stream chunk", "stream_id", streamID, "offset", offset, "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	servedBytes, _ := w.Write(chunk)
+	server.recordBandwidth(req, uint64(servedBytes))
+}
+
+// readPayloadRange reads length bytes from offset of the stored payload of track.
+func (server *AustkServer) readPayloadRange(track *art.Track, offset uint64, length uint64) ([]byte, error) {
+	payloadReader, err := server.artServer.TrackFilePartialReader(track, int64(offset))
+	if err != nil {
+		return nil, err
+	}
+	defer payloadReader.Close()
+
+	chunk := make([]byte, length)
+	_, err = io.ReadFull(payloadReader, chunk)
+	if err != nil {
+		return nil, err
+	}
+	return chunk, nil
+}
+
+// StreamTrack streams the given track from client's peer, paying an invoice of chunkSats
+// for each chunk and receiving the next chunk only after paying for it.
+// A chunk is a share of the payload bytes, so its playing time is about the track duration
+// times chunkSats over the track price.
+// Reading a chunk is retried after a dropped connection without paying again.
+func (client *Client) StreamTrack(track *art.Track, chunkSats uint64) (io.ReadCloser, error) {
+	if track.EffectivePriceSats == 0 {
+		payload, err := client.GetTrack(track.ArtistId, track.ArtistTrackId, nil)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(payload)), nil
+	}
+
+	streamUrl := fmt.Sprintf("http://%s/stream/%s/%s?chunksats=%d",
+		client.peerAddress, track.ArtistId, track.ArtistTrackId, chunkSats)
+	streamInvoice, err := client.postStreamInvoice(streamUrl)
+	if err != nil {
+		client.logger.Warn("failed to start stream", "url", streamUrl, "error", err)
+		return nil, err
+	}
+
+	return &streamReader{
+		client:         client,
+		track:          track,
+		chunkSats:      chunkSats,
+		streamID:       streamInvoice.StreamId,
+		totalBytes:     streamInvoice.TotalBytes,
+		pendingInvoice: streamInvoice,
+	}, nil
+}
+
+// postStreamInvoice posts to streamUrl and reads the StreamInvoice in reply.
+func (client *Client) postStreamInvoice(streamUrl string) (*art.StreamInvoice, error) {
+	response, err := client.post(streamUrl)
+	if err != nil {
+		return nil, client.connectionError(streamUrl, err)
+	}
+	defer response.Body.Close()
+	replyBytes, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, client.replyError(response, replyBytes)
+	}
+	streamInvoice := art.StreamInvoice{}
+	err = proto.Unmarshal(replyBytes, &streamInvoice)
+	if err != nil {
+		return nil, err
+	}
+	return &streamInvoice, nil
+}
+
+// streamReader reads a track from a peer that streams it chunk by chunk as each chunk is paid.
+type streamReader struct {
+	client     *Client
+	track      *art.Track
+	chunkSats  uint64
+	streamID   string
+	totalBytes uint64
+
+	// offset is the number of bytes of the track received so far.
+	offset uint64
+	// paidBytes is the number of bytes of the track paid so far.
+	paidBytes uint64
+	// pendingInvoice is the invoice for the next chunk, if received and not yet paid.
+	pendingInvoice *art.StreamInvoice
+	// preimage proves payment of the chunk at paidBytes until that chunk is received.
+	preimage []byte
+	buffer   []byte
+}
+
+// maxChunkAttempts limits the attempts to get a chunk over a flaky connection.
+const maxChunkAttempts = 3
+
+func (reader *streamReader) Read(p []byte) (int, error) {
+	if len(reader.buffer) == 0 {
+		if reader.offset >= reader.totalBytes {
+			return 0, io.EOF
+		}
+		err := reader.nextChunk()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, reader.buffer)
+	reader.buffer = reader.buffer[n:]
+	return n, nil
+}
+
+// nextChunk pays for the next chunk unless already paid and then gets it from the peer.
+func (reader *streamReader) nextChunk() error {
+	logger := reader.client.logger.With("stream_id", reader.streamID)
+
+	if reader.offset >= reader.paidBytes && reader.preimage == nil {
+		if reader.pendingInvoice == nil {
+			invoiceUrl := fmt.Sprintf("http://%s/streaminvoice/%s", reader.client.peerAddress, reader.streamID)
+			streamInvoice, err := reader.client.postStreamInvoice(invoiceUrl)
+			if err != nil {
+				logger.Warn("failed to get stream invoice", "error", err)
+				return err
+			}
+			reader.pendingInvoice = streamInvoice
+		}
+		if reader.pendingInvoice.Offset != reader.offset {
+			return fmt.Errorf("peer invoiced bytes from %d but expected %d", reader.pendingInvoice.Offset, reader.offset)
+		}
+		preimage, err := reader.client.publisher.PayInvoice(reader.client.ctx, reader.pendingInvoice.Invoice.PaymentRequest, reader.chunkSats)
+		if err != nil {
+			logger.Warn("failed to pay stream invoice", "error", err)
+			return err
+		}
+		reader.preimage = preimage
+		reader.paidBytes = reader.pendingInvoice.Offset + reader.pendingInvoice.Length
+		reader.pendingInvoice = nil
+	}
+
+	var chunk []byte
+	var err error
+	for attempt := 1; attempt <= maxChunkAttempts; attempt++ {
+		chunk, err = reader.getChunk()
+		if err == nil {
+			break
+		}
+		logger.Info("failed to get stream chunk", "attempt", attempt, "offset", reader.offset, "error", err)
+	}
+	if err != nil {
+		return err
+	}
+	if len(chunk) == 0 {
+		return io.ErrUnexpectedEOF
+	}
+	reader.preimage = nil
+	reader.offset += uint64(len(chunk))
+	reader.buffer = chunk
+	return nil
+}
+
+// getChunk gets the stream bytes from the reader's offset, proving payment with any unused preimage.
+func (reader *streamReader) getChunk() ([]byte, error) {
+	chunkUrl := fmt.Sprintf("http://%s/streamchunk/%s?offset=%d",
+		reader.client.peerAddress, reader.streamID, reader.offset)
+	request, err := reader.client.newRequest("GET", chunkUrl)
+	if err != nil {
+		return nil, err
+	}
+	if reader.preimage != nil {
+		request.Header.Set(PreimageHeader, hex.EncodeToString(reader.preimage))
+	}
+	response, err := reader.client.httpClient.Do(request)
+	if err != nil {
+		return nil, reader.client.connectionError(chunkUrl, err)
+	}
+	defer response.Body.Close()
+	replyBytes, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, reader.client.replyError(response, replyBytes)
+	}
+	return replyBytes, nil
+}
+
+// Close stops reading the stream. The peer keeps the stream's paid bytes.
+func (reader *streamReader) Close() error {
+	reader.buffer = nil
+	return nil
+}
@@ -0,0 +1,140 @@
+package audiostrike
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/gorilla/mux"
+)
+
+// TestStreamTrack tests that a client streams a whole track by paying for it chunk by chunk
+// and that paid bytes are served again without payment to resume a dropped stream.
+func TestStreamTrack(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	err = fileServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	track := &art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID, Price: &art.Price{Sats: 100}}
+	err = fileServer.StoreTrack(track, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	payload := bytes.Repeat([]byte("0123456789"), 100)
+	err = fileServer.StoreTrackPayload(track, payload)
+	if err != nil {
+		t.Fatalf("StoreTrackPayload error: %v", err)
+	}
+
+	mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+	if err != nil {
+		t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+	}
+	austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+	if err != nil {
+		t.Fatalf("NewAustkServer error: %v", err)
+	}
+	testRouter := mux.NewRouter()
+	testRouter.HandleFunc("/art/{artist:[^/]*}/{track:.*}", austkServer.getArtHandler).Methods("GET")
+	testRouter.HandleFunc("/stream/{artist:[^/]*}/{track:.*}", austkServer.startStreamHandler).Methods("POST")
+	testRouter.HandleFunc("/streaminvoice/{stream}", austkServer.streamInvoiceHandler).Methods("POST")
+	testRouter.HandleFunc("/streamchunk/{stream}", austkServer.streamChunkHandler).Methods("GET")
+	testHttpServer := httptest.NewServer(testRouter)
+	defer testHttpServer.Close()
+	testUrl, _ := url.Parse(testHttpServer.URL)
+
+	client := &Client{
+		peerAddress: testUrl.Host,
+		httpClient:  &http.Client{},
+		publisher:   mockLightningNode,
+		ctx:         context.Background(),
+		logger:      componentLogger("client"),
+	}
+	publishedTrack := &art.Track{ArtistId: mockArtistID, ArtistTrackId: mockTrackID, EffectivePriceSats: 100}
+	stream, err := client.StreamTrack(publishedTrack, 30)
+	if err != nil {
+		t.Fatalf("StreamTrack error: %v", err)
+	}
+	streamedBytes, err := ioutil.ReadAll(stream)
+	if err != nil {
+		t.Errorf("ReadAll stream error: %v", err)
+	}
+	stream.Close()
+	if !bytes.Equal(streamedBytes, payload) {
+		t.Errorf("expected %d streamed bytes to match payload but got %d bytes", len(payload), len(streamedBytes))
+	}
+
+	// A resumed stream gets paid bytes again without a preimage, but not unpaid bytes.
+	streamID := stream.(*streamReader).streamID
+	response, err := http.Get(testHttpServer.URL + "/streamchunk/" + streamID + "?offset=500")
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Errorf("expected paid bytes to be served again but got %v, error: %v", response, err)
+	}
+
+	secondStream, err := client.StreamTrack(publishedTrack, 30)
+	if err != nil {
+		t.Fatalf("StreamTrack error: %v", err)
+	}
+	secondStreamID := secondStream.(*streamReader).streamID
+	response, err = http.Get(testHttpServer.URL + "/streamchunk/" + secondStreamID + "?offset=0")
+	if err != nil || response.StatusCode != http.StatusPaymentRequired {
+		t.Errorf("expected payment required for unpaid bytes but got %v, error: %v", response, err)
+	}
+
+	// Streaming payments do not pay to download the whole track.
+	_, err = client.GetTrack(mockArtistID, mockTrackID, nil)
+	if !errors.Is(err, ErrPaymentRequired) {
+		t.Errorf("expected ErrPaymentRequired to get unpaid track but got %v", err)
+	}
+	_, err = client.GetTrack(mockArtistID, "unknowntrack", nil)
+	if !errors.Is(err, ErrArtNotFound) {
+		t.Errorf("expected ErrArtNotFound to get unknown track but got %v", err)
+	}
+}
+
+// TestStreamChunksPayPrice tests that the chunks of a stream cover its payload without gaps
+// and their prices add up to the track price, each at most the chunk price the client offered.
+func TestStreamChunksPayPrice(t *testing.T) {
+	for _, test := range []struct{ totalBytes, price, chunkSats uint64 }{
+		{1000, 100, 30},
+		{10, 6, 1},
+		{1000, 41, 1},
+		{7, 7, 1},
+		{1000, 100, 1000},
+	} {
+		chunkCount := (test.price + test.chunkSats - 1) / test.chunkSats
+		stream := &trackStream{totalBytes: test.totalBytes, chunkCount: chunkCount, chunkSats: test.chunkSats, price: test.price}
+		var paidBytes, paidSats uint64
+		for index := uint64(0); index < chunkCount; index++ {
+			end := stream.chunkEnd(index)
+			if end <= paidBytes {
+				t.Errorf("%+v: expected chunk %d to end after %d but got %d", test, index, paidBytes, end)
+			}
+			sats := stream.chunkPrice(index)
+			if sats > test.chunkSats {
+				t.Errorf("%+v: expected chunk %d to cost at most %d sats but got %d", test, index, test.chunkSats, sats)
+			}
+			paidBytes, paidSats = end, paidSats+sats
+		}
+		if paidBytes != test.totalBytes || paidSats != test.price {
+			t.Errorf("%+v: expected chunks to pay %d sats for %d bytes but got %d sats for %d bytes",
+				test, test.price, test.totalBytes, paidSats, paidBytes)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package audiostrike
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+	"github.com/golang/protobuf/proto"
+)
+
+// nowUnix gets the current Unix time to stamp updated records and to mark when resources were collected.
+func nowUnix() uint64 {
+	return uint64(time.Now().Unix())
+}
+
+// setUpdatedAt sets the UpdatedAt of an Artist, Album, Track, Peer, or Playlist record.
+func setUpdatedAt(record proto.Message, updatedAt uint64) {
+	switch record := record.(type) {
+	case *art.Artist:
+		record.UpdatedAt = updatedAt
+	case *art.Album:
+		record.UpdatedAt = updatedAt
+	case *art.Track:
+		record.UpdatedAt = updatedAt
+	case *art.Peer:
+		record.UpdatedAt = updatedAt
+	case *art.Playlist:
+		record.UpdatedAt = updatedAt
+	}
+}
+
+// isSameArt checks whether two versions of a record have the same art,
+// ignoring when they were updated and the price resolved to publish a track.
+func isSameArt(previous, record proto.Message) bool {
+	previous = proto.Clone(previous)
+	record = proto.Clone(record)
+	for _, version := range []proto.Message{previous, record} {
+		setUpdatedAt(version, 0)
+		if track, isTrack := version.(*art.Track); isTrack {
+			track.EffectivePriceSats = 0
+		}
+	}
+	return proto.Equal(previous, record)
+}
+
+// updatedRecord is an Artist, Album, Track, Peer, or Playlist record stamped with the time it was updated.
+type updatedRecord interface {
+	proto.Message
+	GetUpdatedAt() uint64
+}
+
+// stampUpdatedAt sets record's UpdatedAt to that of the previously stored version if the art is unchanged
+// or else to now, so peers who synced before now get the changed record on their next sync.
+// previous is nil if no version of the record is stored yet.
+func stampUpdatedAt(previous, record updatedRecord, now uint64) {
+	if previous != nil && !reflect.ValueOf(previous).IsNil() && isSameArt(previous, record) {
+		setUpdatedAt(record, previous.GetUpdatedAt())
+	} else {
+		setUpdatedAt(record, now)
+	}
+}
+
+// stampCreatedAt sets the CreatedAt of track, if unset, to that of the previously stored version, if any,
+// or else to now, when the track is first stored. A track synced from a peer keeps the time its artist's node
+// first stored it, but not a time after now, so a peer's clock cannot keep its tracks the newest.
+func stampCreatedAt(previous, track *art.Track, now uint64) {
+	if track.CreatedAt == 0 {
+		if previous != nil && previous.CreatedAt != 0 {
+			track.CreatedAt = previous.CreatedAt
+		} else {
+			track.CreatedAt = now
+		}
+	}
+	if track.CreatedAt > now {
+		track.CreatedAt = now
+	}
+}
+
+// latestUpdate gets the latest UpdatedAt time of the records in resources, or DeletedAt time of their tombstones,
+// or 0 if there are none.
+func latestUpdate(resources *art.ArtResources) uint64 {
+	var latest uint64
+	records := make([]updatedRecord, 0, len(resources.Artists)+len(resources.Albums)+len(resources.Tracks)+
+		len(resources.Peers)+len(resources.Playlists))
+	for _, artist := range resources.Artists {
+		records = append(records, artist)
+	}
+	for _, album := range resources.Albums {
+		records = append(records, album)
+	}
+	for _, track := range resources.Tracks {
+		records = append(records, track)
+	}
+	for _, peer := range resources.Peers {
+		records = append(records, peer)
+	}
+	for _, playlist := range resources.Playlists {
+		records = append(records, playlist)
+	}
+	for _, record := range records {
+		if record.GetUpdatedAt() > latest {
+			latest = record.GetUpdatedAt()
+		}
+	}
+	// A deletion updates the art too, so a peer syncs only the tombstones since its last sync, not all of them again.
+	for _, tombstone := range resources.Tombstones {
+		if tombstone.DeletedAt > latest {
+			latest = tombstone.DeletedAt
+		}
+	}
+	return latest
+}
+
+// resourcesSince gets the resources updated at or after since, which includes records stamped
+// during the second when the previous resources were collected.
+func resourcesSince(resources *art.ArtResources, since uint64) *art.ArtResources {
+	updatedResources := &art.ArtResources{
+		AsOf:          resources.AsOf,
+		Sequence:      resources.Sequence,
+		Since:         since,
+		ScopeArtistId: resources.ScopeArtistId,
+		ScopeAlbumId:  resources.ScopeAlbumId,
+	}
+	for _, artist := range resources.Artists {
+		if artist.UpdatedAt >= since {
+			updatedResources.Artists = append(updatedResources.Artists, artist)
+		}
+	}
+	for _, album := range resources.Albums {
+		if album.UpdatedAt >= since {
+			updatedResources.Albums = append(updatedResources.Albums, album)
+		}
+	}
+	for _, track := range resources.Tracks {
+		if track.UpdatedAt >= since {
+			updatedResources.Tracks = append(updatedResources.Tracks, track)
+		}
+	}
+	for _, peer := range resources.Peers {
+		if peer.UpdatedAt >= since {
+			updatedResources.Peers = append(updatedResources.Peers, peer)
+		}
+	}
+	for _, playlist := range resources.Playlists {
+		if playlist.UpdatedAt >= since {
+			updatedResources.Playlists = append(updatedResources.Playlists, playlist)
+		}
+	}
+	for _, tombstone := range resources.Tombstones {
+		if tombstone.DeletedAt >= since {
+			updatedResources.Tombstones = append(updatedResources.Tombstones, tombstone)
+		}
+	}
+	return updatedResources
+}
+
+// resourcesInScope gets the resources of the artist with artistID and, if albumID is set, only that album
+// and its tracks, for a client that syncs only the art it wants. Peers are out of any scope,
+// and the artist's playlists are out of the scope of an album.
+// It returns ErrArtNotFound if the resources have no such artist or album.
+func resourcesInScope(resources *art.ArtResources, artistID string, albumID string) (*art.ArtResources, error) {
+	scopedResources := &art.ArtResources{
+		AsOf:          resources.AsOf,
+		Sequence:      resources.Sequence,
+		ScopeArtistId: artistID,
+		ScopeAlbumId:  albumID,
+	}
+	for _, artist := range resources.Artists {
+		if artist.ArtistId == artistID {
+			scopedResources.Artists = append(scopedResources.Artists, artist)
+		}
+	}
+	if len(scopedResources.Artists) == 0 {
+		return nil, fmt.Errorf("%w: artist %s", ErrArtNotFound, artistID)
+	}
+	for _, album := range resources.Albums {
+		if album.ArtistId == artistID && (albumID == "" || album.ArtistAlbumId == albumID) {
+			scopedResources.Albums = append(scopedResources.Albums, album)
+		}
+	}
+	if albumID != "" && len(scopedResources.Albums) == 0 {
+		return nil, fmt.Errorf("%w: album %s/%s", ErrArtNotFound, artistID, albumID)
+	}
+	for _, track := range resources.Tracks {
+		if track.ArtistId == artistID && (albumID == "" || track.ArtistAlbumId == albumID) {
+			scopedResources.Tracks = append(scopedResources.Tracks, track)
+		}
+	}
+	for _, playlist := range resources.Playlists {
+		if playlist.ArtistId == artistID && albumID == "" {
+			scopedResources.Playlists = append(scopedResources.Playlists, playlist)
+		}
+	}
+	// A tombstone does not name the album of its track, so all the artist's tombstones are in scope of an album.
+	for _, tombstone := range resources.Tombstones {
+		if tombstone.ArtistId == artistID {
+			scopedResources.Tombstones = append(scopedResources.Tombstones, tombstone)
+		}
+	}
+	return scopedResources, nil
+}
+
+// artistResources gets the art of the artist with artistID in resources, and the peers if withPeers is set,
+// for the artist to publish on its own. Unlike the resources in the scope of an artist, these are all the art
+// the artist publishes, so they replace rather than update the art stored from the artist's earlier publications.
+func artistResources(resources *art.ArtResources, artistID string, withPeers bool) *art.ArtResources {
+	publishedResources := &art.ArtResources{AsOf: resources.AsOf, Sequence: resources.Sequence}
+	for _, artist := range resources.Artists {
+		if artist.ArtistId == artistID {
+			publishedResources.Artists = append(publishedResources.Artists, artist)
+		}
+	}
+	for _, album := range resources.Albums {
+		if album.ArtistId == artistID {
+			publishedResources.Albums = append(publishedResources.Albums, album)
+		}
+	}
+	for _, track := range resources.Tracks {
+		if track.ArtistId == artistID {
+			publishedResources.Tracks = append(publishedResources.Tracks, track)
+		}
+	}
+	for _, playlist := range resources.Playlists {
+		if playlist.ArtistId == artistID {
+			publishedResources.Playlists = append(publishedResources.Playlists, playlist)
+		}
+	}
+	for _, tombstone := range resources.Tombstones {
+		if tombstone.ArtistId == artistID {
+			publishedResources.Tombstones = append(publishedResources.Tombstones, tombstone)
+		}
+	}
+	if withPeers {
+		publishedResources.Peers = resources.Peers
+	}
+	return publishedResources
+}
+
+// isPartialResources checks whether resources have only some of the art of their publisher,
+// either the records updated since an earlier publication or those in the scope of an artist or album,
+// so they update the resources stored from earlier publications instead of replacing them.
+func isPartialResources(resources *art.ArtResources) bool {
+	return resources.Since > 0 || resources.ScopeArtistId != ""
+}
+
+// mergeResources merges the updated resources into the previously stored resources,
+// replacing records with the same ids and adding new records.
+// The tracks and albums withdrawn by the tombstones of the updated resources are dropped, with the tracks
+// of withdrawn albums. The tombstones are kept too, without those of tracks and albums the updated resources
+// store again.
+func mergeResources(previous, updated *art.ArtResources) *art.ArtResources {
+	merged := &art.ArtResources{AsOf: updated.AsOf}
+	isWithdrawn := withdrawnKeys(updated.Tombstones)
+
+	artistIndexes := make(map[string]int)
+	for _, artists := range [][]*art.Artist{previous.Artists, updated.Artists} {
+		for _, artist := range artists {
+			if i, isMerged := artistIndexes[artist.ArtistId]; isMerged {
+				merged.Artists[i] = artist
+			} else {
+				artistIndexes[artist.ArtistId] = len(merged.Artists)
+				merged.Artists = append(merged.Artists, artist)
+			}
+		}
+	}
+	albumIndexes := make(map[string]int)
+	for _, albums := range [][]*art.Album{previous.Albums, updated.Albums} {
+		for _, album := range albums {
+			if isWithdrawn[albumTombstoneKey(album.ArtistId, album.ArtistAlbumId)] {
+				continue // to next album
+			}
+			key := album.ArtistId + "/" + album.ArtistAlbumId
+			if i, isMerged := albumIndexes[key]; isMerged {
+				merged.Albums[i] = album
+			} else {
+				albumIndexes[key] = len(merged.Albums)
+				merged.Albums = append(merged.Albums, album)
+			}
+		}
+	}
+	trackIndexes := make(map[string]int)
+	for _, tracks := range [][]*art.Track{previous.Tracks, updated.Tracks} {
+		for _, track := range tracks {
+			if isWithdrawn[trackTombstoneKey(track.ArtistId, track.ArtistTrackId)] ||
+				isWithdrawn[albumTombstoneKey(track.ArtistId, track.ArtistAlbumId)] {
+				continue // to next track
+			}
+			key := track.ArtistId + "/" + track.ArtistTrackId
+			if i, isMerged := trackIndexes[key]; isMerged {
+				merged.Tracks[i] = track
+			} else {
+				trackIndexes[key] = len(merged.Tracks)
+				merged.Tracks = append(merged.Tracks, track)
+			}
+		}
+	}
+	peerIndexes := make(map[string]int)
+	for _, peers := range [][]*art.Peer{previous.Peers, updated.Peers} {
+		for _, peer := range peers {
+			if i, isMerged := peerIndexes[peer.Pubkey]; isMerged {
+				merged.Peers[i] = peer
+			} else {
+				peerIndexes[peer.Pubkey] = len(merged.Peers)
+				merged.Peers = append(merged.Peers, peer)
+			}
+		}
+	}
+	playlistIndexes := make(map[string]int)
+	for _, playlists := range [][]*art.Playlist{previous.Playlists, updated.Playlists} {
+		for _, playlist := range playlists {
+			key := playlist.ArtistId + "/" + playlist.ArtistPlaylistId
+			if i, isMerged := playlistIndexes[key]; isMerged {
+				merged.Playlists[i] = playlist
+			} else {
+				playlistIndexes[key] = len(merged.Playlists)
+				merged.Playlists = append(merged.Playlists, playlist)
+			}
+		}
+	}
+	isStoredAgain := make(map[string]bool)
+	for _, album := range updated.Albums {
+		isStoredAgain[albumTombstoneKey(album.ArtistId, album.ArtistAlbumId)] = true
+	}
+	for _, track := range updated.Tracks {
+		isStoredAgain[trackTombstoneKey(track.ArtistId, track.ArtistTrackId)] = true
+	}
+	tombstoneIndexes := make(map[string]int)
+	for _, tombstones := range [][]*art.Tombstone{previous.Tombstones, updated.Tombstones} {
+		for _, tombstone := range tombstones {
+			key := tombstoneKey(tombstone)
+			if isStoredAgain[key] {
+				continue // to next tombstone, of art stored again
+			}
+			if i, isMerged := tombstoneIndexes[key]; isMerged {
+				merged.Tombstones[i] = tombstone
+			} else {
+				tombstoneIndexes[key] = len(merged.Tombstones)
+				merged.Tombstones = append(merged.Tombstones, tombstone)
+			}
+		}
+	}
+	return merged
+}
+
+// keepVouchedPeers keeps, of the peers in resources published by the node with pubkey, only that node's own
+// peer record and the peers already stored. A node vouches only for its own record, so the other peers it
+// gossips are stored once a client reaches them and syncs their own records from them.
+// Peers already stored keep their stored records, so gossip cannot redirect them to another host.
+func keepVouchedPeers(artServer ArtServer, pubkey string, resources *art.ArtResources) error {
+	var peers []*art.Peer
+	isKept := make(map[string]bool)
+	for _, peer := range resources.Peers {
+		if isKept[peer.Pubkey] {
+			continue // to next peer, listed again
+		}
+		if peer.Pubkey != pubkey {
+			storedPeer, err := artServer.Peer(peer.Pubkey)
+			if err == ErrPeerNotFound {
+				continue // to next peer, only gossiped
+			} else if err != nil {
+				return err
+			}
+			peer = storedPeer
+		}
+		isKept[peer.Pubkey] = true
+		peers = append(peers, peer)
+	}
+	resources.Peers = peers
+	return nil
+}
+
+// stampResources stamps each record of resources with the time it was updated in artServer.
+// Records already stored with the same art keep their stamp, and new or changed records are stamped now.
+func stampResources(artServer ArtServer, resources *art.ArtResources, now uint64) error {
+	for _, artist := range resources.Artists {
+		previous, err := artServer.Artist(artist.ArtistId)
+		if err != nil && err != ErrArtNotFound {
+			return err
+		}
+		stampUpdatedAt(previous, artist, now)
+	}
+	for _, album := range resources.Albums {
+		albums, err := artServer.Albums(album.ArtistId)
+		if err != nil && err != ErrArtNotFound {
+			return err
+		}
+		stampUpdatedAt(albums[album.ArtistAlbumId], album, now)
+	}
+	for _, track := range resources.Tracks {
+		previous, err := artServer.Track(track.ArtistId, track.ArtistTrackId)
+		if err != nil && err != ErrArtNotFound {
+			return err
+		}
+		stampCreatedAt(previous, track, now)
+		stampUpdatedAt(previous, track, now)
+	}
+	for _, peer := range resources.Peers {
+		previous, err := artServer.Peer(peer.Pubkey)
+		if err != nil && err != ErrPeerNotFound {
+			return err
+		}
+		stampUpdatedAt(previous, peer, now)
+	}
+	for _, playlist := range resources.Playlists {
+		previous, err := artServer.Playlist(playlist.ArtistId, playlist.ArtistPlaylistId)
+		if err != nil && err != ErrArtNotFound {
+			return err
+		}
+		stampUpdatedAt(previous, playlist, now)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package audiostrike
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// syncSchedule records whether the daemon is syncing from its peers, when it last synced,
+// and when it syncs next, to answer /status.
+type syncSchedule struct {
+	mutex      sync.Mutex
+	isSyncing  bool
+	lastSyncAt time.Time
+	nextSyncAt time.Time
+}
+
+// Status is the JSON view of the daemon's status at /status.
+type Status struct {
+	Version string `json:"version"`
+	Syncing bool   `json:"syncing"`
+	// LastSyncAt is the Unix time the last sync from the peers finished, if any yet.
+	LastSyncAt uint64 `json:"lastSyncAt,omitempty"`
+	// NextSyncAt is the Unix time the next sync from the peers is scheduled, if any.
+	NextSyncAt uint64 `json:"nextSyncAt,omitempty"`
+	// StoredBytes are the bytes of track payloads stored as of the last sync, and RemainingBytes those left
+	// under -maxstorage, listed only with -maxstorage.
+	StoredBytes    *uint64 `json:"storedBytes,omitempty"`
+	RemainingBytes *uint64 `json:"remainingBytes,omitempty"`
+}
+
+// SyncPeers runs syncPeers to sync from the peers, unless a sync is still running, and records when it finished.
+// Then it evicts the payloads of synced tracks past -maxstorage. It reports whether it ran syncPeers.
+func (server *AustkServer) SyncPeers(ctx context.Context, syncPeers func(ctx context.Context)) bool {
+	server.syncSchedule.mutex.Lock()
+	if server.syncSchedule.isSyncing {
+		server.syncSchedule.mutex.Unlock()
+		server.logger.Info("skip sync while the previous sync is still running")
+		return false
+	}
+	server.syncSchedule.isSyncing = true
+	server.syncSchedule.mutex.Unlock()
+
+	syncPeers(ctx)
+	_, err := server.EnforceRetention()
+	if err != nil {
+		server.logger.Error("failed to enforce -maxstorage after sync", "error", err)
+	}
+
+	server.syncSchedule.mutex.Lock()
+	defer server.syncSchedule.mutex.Unlock()
+	server.syncSchedule.isSyncing = false
+	server.syncSchedule.lastSyncAt = time.Now()
+	return true
+}
+
+// SyncPeriodically syncs from the peers with syncPeers now and then every interval until ctx is done,
+// skipping a scheduled sync while the previous one is still running.
+// It returns once ctx is done and the sync under way, if any, finishes.
+func (server *AustkServer) SyncPeriodically(ctx context.Context, interval time.Duration, syncPeers func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var running sync.WaitGroup
+	defer running.Wait()
+
+	startSync := func() {
+		server.syncSchedule.mutex.Lock()
+		server.syncSchedule.nextSyncAt = time.Now().Add(interval)
+		server.syncSchedule.mutex.Unlock()
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			server.SyncPeers(ctx, syncPeers)
+		}()
+	}
+	startSync()
+	for {
+		select {
+		case <-ticker.C:
+			startSync()
+		case <-ctx.Done():
+			server.syncSchedule.mutex.Lock()
+			server.syncSchedule.nextSyncAt = time.Time{}
+			server.syncSchedule.mutex.Unlock()
+			server.logger.Info("stop scheduling syncs", "error", ctx.Err())
+			return
+		}
+	}
+}
+
+// Status gets the version of this node, when it last synced from its peers and syncs next,
+// and the storage left for payloads.
+func (server *AustkServer) Status() *Status {
+	status := &Status{Version: VersionString()}
+	if storedBytes, remainingBytes, isMeasured := server.storageStatus(); isMeasured {
+		status.StoredBytes = &storedBytes
+		status.RemainingBytes = &remainingBytes
+	}
+	server.syncSchedule.mutex.Lock()
+	defer server.syncSchedule.mutex.Unlock()
+	status.Syncing = server.syncSchedule.isSyncing
+	if !server.syncSchedule.lastSyncAt.IsZero() {
+		status.LastSyncAt = uint64(server.syncSchedule.lastSyncAt.Unix())
+	}
+	if !server.syncSchedule.nextSyncAt.IsZero() {
+		status.NextSyncAt = uint64(server.syncSchedule.nextSyncAt.Unix())
+	}
+	return status
+}
+
+// statusHandler replies with the Status of this node as JSON.
+func (server *AustkServer) statusHandler(w http.ResponseWriter, req *http.Request) {
+	responseData, err := json.Marshal(server.Status())
+	if err != nil {
+		server.logger.Error("failed to marshal status", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(responseData)
+}
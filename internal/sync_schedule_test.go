@@ -0,0 +1,58 @@
+package audiostrike
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestSyncPeriodically verifies that syncs are scheduled every interval, that a sync is skipped
+// while the previous one is still running, and that the status reports when the last sync finished.
+func TestSyncPeriodically(t *testing.T) {
+	austkServer := &AustkServer{config: cfg, logger: cfg.componentLogger("austkServer")}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var syncs, running, overlaps int32
+	release := make(chan struct{})
+	syncPeers := func(ctx context.Context) {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		if atomic.AddInt32(&syncs, 1) == 1 {
+			<-release // Hold the first sync past several ticks.
+		}
+		atomic.AddInt32(&running, -1)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		austkServer.SyncPeriodically(ctx, 10*time.Millisecond, syncPeers)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	status := austkServer.Status()
+	if !status.Syncing || status.LastSyncAt != 0 || status.NextSyncAt == 0 {
+		t.Errorf("expected a sync running and the next scheduled but got %+v", status)
+	}
+	if syncs := atomic.LoadInt32(&syncs); syncs != 1 {
+		t.Errorf("expected the later syncs skipped while the first runs but got %d syncs", syncs)
+	}
+	close(release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&syncs) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	status = austkServer.Status()
+	if atomic.LoadInt32(&syncs) < 3 || status.Syncing || status.LastSyncAt == 0 || status.NextSyncAt != 0 {
+		t.Errorf("expected syncs to resume, then none scheduled after cancel, but got %d syncs and %+v",
+			atomic.LoadInt32(&syncs), status)
+	}
+	if overlaps := atomic.LoadInt32(&overlaps); overlaps != 0 {
+		t.Errorf("expected no overlapping syncs but got %d", overlaps)
+	}
+}
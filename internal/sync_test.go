@@ -0,0 +1,142 @@
+package audiostrike
+
+import (
+	"errors"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// TestResourcesSince tests that only records updated at or after since are synced.
+func TestResourcesSince(t *testing.T) {
+	resources := &art.ArtResources{
+		AsOf: 300,
+		Artists: []*art.Artist{
+			&art.Artist{ArtistId: mockArtistID, UpdatedAt: 100},
+		},
+		Tracks: []*art.Track{
+			&art.Track{ArtistId: mockArtistID, ArtistTrackId: "oldtrack", UpdatedAt: 100},
+			&art.Track{ArtistId: mockArtistID, ArtistTrackId: "newtrack", UpdatedAt: 200},
+		},
+	}
+	updated := resourcesSince(resources, 200)
+	if updated.AsOf != 300 || updated.Since != 200 {
+		t.Errorf("expected resources as of 300 since 200 but got as of %d since %d", updated.AsOf, updated.Since)
+	}
+	if len(updated.Artists) != 0 {
+		t.Errorf("expected no artists updated since 200 but got %v", updated.Artists)
+	}
+	if len(updated.Tracks) != 1 || updated.Tracks[0].ArtistTrackId != "newtrack" {
+		t.Errorf("expected only newtrack updated since 200 but got %v", updated.Tracks)
+	}
+}
+
+// TestResourcesInScope tests that only the art of the requested artist or album is synced.
+func TestResourcesInScope(t *testing.T) {
+	resources := &art.ArtResources{
+		AsOf: 300,
+		Artists: []*art.Artist{
+			&art.Artist{ArtistId: mockArtistID},
+			&art.Artist{ArtistId: "otherartist"},
+		},
+		Albums: []*art.Album{
+			&art.Album{ArtistId: mockArtistID, ArtistAlbumId: "dirt"},
+			&art.Album{ArtistId: mockArtistID, ArtistAlbumId: "facelift"},
+		},
+		Tracks: []*art.Track{
+			&art.Track{ArtistId: mockArtistID, ArtistAlbumId: "dirt", ArtistTrackId: "dirt/would"},
+			&art.Track{ArtistId: mockArtistID, ArtistTrackId: "single"},
+			&art.Track{ArtistId: "otherartist", ArtistTrackId: "other"},
+		},
+		Peers: []*art.Peer{&art.Peer{Pubkey: mockPubkey}},
+	}
+	scoped, err := resourcesInScope(resources, mockArtistID, "")
+	if err != nil {
+		t.Fatalf("resourcesInScope artist error: %v", err)
+	}
+	if len(scoped.Artists) != 1 || len(scoped.Albums) != 2 || len(scoped.Tracks) != 2 || len(scoped.Peers) != 0 {
+		t.Errorf("expected art of only %s but got %v", mockArtistID, scoped)
+	}
+	scoped, err = resourcesInScope(resources, mockArtistID, "dirt")
+	if err != nil {
+		t.Fatalf("resourcesInScope album error: %v", err)
+	}
+	if len(scoped.Albums) != 1 || len(scoped.Tracks) != 1 || scoped.Tracks[0].ArtistTrackId != "dirt/would" ||
+		scoped.AsOf != 300 || scoped.ScopeAlbumId != "dirt" {
+		t.Errorf("expected art of only album dirt but got %v", scoped)
+	}
+	for _, scope := range [][2]string{{unknownID, ""}, {mockArtistID, unknownID}} {
+		_, err = resourcesInScope(resources, scope[0], scope[1])
+		if !errors.Is(err, ErrArtNotFound) {
+			t.Errorf("expected ErrArtNotFound for scope %v but got %v", scope, err)
+		}
+	}
+}
+
+// TestMergeResources tests that synced updates replace and add to previously synced resources.
+func TestMergeResources(t *testing.T) {
+	previous := &art.ArtResources{
+		AsOf: 100,
+		Tracks: []*art.Track{
+			&art.Track{ArtistId: mockArtistID, ArtistTrackId: "track1", Title: "Old Title"},
+			&art.Track{ArtistId: mockArtistID, ArtistTrackId: "track2", Title: "Track 2"},
+		},
+	}
+	updated := &art.ArtResources{
+		AsOf:  200,
+		Since: 100,
+		Tracks: []*art.Track{
+			&art.Track{ArtistId: mockArtistID, ArtistTrackId: "track1", Title: "New Title"},
+			&art.Track{ArtistId: mockArtistID, ArtistTrackId: "track3", Title: "Track 3"},
+		},
+	}
+	merged := mergeResources(previous, updated)
+	if merged.AsOf != 200 || merged.Since != 0 {
+		t.Errorf("expected merged resources as of 200 since 0 but got as of %d since %d", merged.AsOf, merged.Since)
+	}
+	titles := []string{"New Title", "Track 2", "Track 3"}
+	if len(merged.Tracks) != len(titles) {
+		t.Fatalf("expected %d merged tracks but got %v", len(titles), merged.Tracks)
+	}
+	for i, title := range titles {
+		if merged.Tracks[i].Title != title {
+			t.Errorf("expected merged track %d titled %s but got %v", i, title, merged.Tracks[i])
+		}
+	}
+}
+
+// TestMergeResourcesTombstones tests that synced tombstones are kept with previously synced ones,
+// without those of art synced again, and drop the art they withdraw.
+func TestMergeResourcesTombstones(t *testing.T) {
+	previous := &art.ArtResources{
+		AsOf: 100,
+		Tracks: []*art.Track{
+			&art.Track{ArtistId: mockArtistID, ArtistTrackId: "track1"},
+		},
+		Tombstones: []*art.Tombstone{
+			&art.Tombstone{ArtistId: mockArtistID, ArtistTrackId: "restored", DeletedAt: 50},
+			&art.Tombstone{ArtistId: mockArtistID, ArtistAlbumId: "withdrawn", DeletedAt: 60},
+		},
+	}
+	updated := &art.ArtResources{
+		AsOf:  200,
+		Since: 100,
+		Tracks: []*art.Track{
+			&art.Track{ArtistId: mockArtistID, ArtistTrackId: "restored"},
+		},
+		Tombstones: []*art.Tombstone{
+			&art.Tombstone{ArtistId: mockArtistID, ArtistTrackId: "track1", DeletedAt: 150},
+		},
+	}
+	merged := mergeResources(previous, updated)
+	if len(merged.Tracks) != 1 || merged.Tracks[0].ArtistTrackId != "restored" {
+		t.Errorf("expected only the track synced again but got %v", merged.Tracks)
+	}
+	if len(merged.Tombstones) != 2 || merged.Tombstones[0].ArtistAlbumId != "withdrawn" ||
+		merged.Tombstones[1].ArtistTrackId != "track1" {
+		t.Errorf("expected tombstones of the withdrawn album and track1 but got %v", merged.Tombstones)
+	}
+	if latestUpdate(updated) != 150 {
+		t.Errorf("expected the deletion as the latest update but got %d", latestUpdate(updated))
+	}
+}
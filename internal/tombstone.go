@@ -0,0 +1,175 @@
+package audiostrike
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// tombstoneLifetime is how long a tombstone is published after its art was deleted. A peer that syncs less often
+// syncs the art again from scratch and keeps its copies of art deleted earlier, but the tombstones do not pile up
+// in every publication forever.
+const tombstoneLifetime = 90 * 24 * time.Hour
+
+// tombstoneKey identifies the track or album withdrawn by tombstone, so a later tombstone of it replaces the earlier.
+// Artist ids have no slashes, so the key of a track never matches the key of an album.
+func tombstoneKey(tombstone *art.Tombstone) string {
+	if tombstone.ArtistTrackId != "" {
+		return trackTombstoneKey(tombstone.ArtistId, tombstone.ArtistTrackId)
+	}
+	return albumTombstoneKey(tombstone.ArtistId, tombstone.ArtistAlbumId)
+}
+
+func trackTombstoneKey(artistID string, artistTrackID string) string {
+	return "track/" + artistID + "/" + artistTrackID
+}
+
+func albumTombstoneKey(artistID string, artistAlbumID string) string {
+	return "album/" + artistID + "/" + artistAlbumID
+}
+
+// sortTombstones sorts tombstones by artist id, then album id, then track id, so they marshal to the same bytes
+// to sign every time. The tombstones of an artist's tracks, which have no album id, sort before those of its albums.
+func sortTombstones(tombstones []*art.Tombstone) {
+	sort.Slice(tombstones, func(i, j int) bool {
+		if tombstones[i].ArtistId != tombstones[j].ArtistId {
+			return tombstones[i].ArtistId < tombstones[j].ArtistId
+		}
+		if tombstones[i].ArtistAlbumId != tombstones[j].ArtistAlbumId {
+			return tombstones[i].ArtistAlbumId < tombstones[j].ArtistAlbumId
+		}
+		return tombstones[i].ArtistTrackId < tombstones[j].ArtistTrackId
+	})
+}
+
+// storeTombstone records that the track with artistTrackID, or else the album with artistAlbumID,
+// was deleted from the art of the artist with artistID, to publish its withdrawal to peers,
+// and deletes the tombstones expired over tombstoneLifetime ago.
+func (server *AustkServer) storeTombstone(artistID string, artistAlbumID string, artistTrackID string) error {
+	now := time.Now()
+	tombstone := &art.Tombstone{ArtistId: artistID, DeletedAt: uint64(now.Unix())}
+	if artistTrackID != "" {
+		tombstone.ArtistTrackId = artistTrackID
+	} else {
+		tombstone.ArtistAlbumId = artistAlbumID
+	}
+	err := server.artServer.StoreTombstone(tombstone)
+	if err != nil {
+		server.logger.Error("failed to store tombstone", "artist_id", artistID, "album_id", artistAlbumID,
+			"track_id", artistTrackID, "error", err)
+		return err
+	}
+	err = server.artServer.DeleteExpiredTombstones(uint64(now.Add(-tombstoneLifetime).Unix()))
+	if err != nil {
+		// Keep the new tombstone; the expired ones are deleted with the next one stored.
+		server.logger.Warn("failed to delete expired tombstones", "error", err)
+	}
+	return nil
+}
+
+// publishedTombstones gets the stored tombstones of the artists in resources, without those of tracks and albums
+// in resources, which the artist stored again after deleting them, and those expired over tombstoneLifetime ago.
+func (server *AustkServer) publishedTombstones(resources *art.ArtResources) ([]*art.Tombstone, error) {
+	tombstones, err := server.artServer.Tombstones()
+	if err != nil {
+		server.logger.Error("failed to get tombstones", "error", err)
+		return nil, err
+	}
+	isPublished := make(map[string]bool)
+	for _, artist := range resources.Artists {
+		isPublished[artist.ArtistId] = true
+	}
+	isStored := make(map[string]bool)
+	for _, album := range resources.Albums {
+		isStored[albumTombstoneKey(album.ArtistId, album.ArtistAlbumId)] = true
+	}
+	for _, track := range resources.Tracks {
+		isStored[trackTombstoneKey(track.ArtistId, track.ArtistTrackId)] = true
+	}
+	expiredBefore := uint64(time.Now().Add(-tombstoneLifetime).Unix())
+	var published []*art.Tombstone
+	for _, tombstone := range tombstones {
+		if isPublished[tombstone.ArtistId] && !isStored[tombstoneKey(tombstone)] && tombstone.DeletedAt >= expiredBefore {
+			published = append(published, tombstone)
+		}
+	}
+	return published, nil
+}
+
+// withdrawnKeys gets the tombstoneKey of each track and album withdrawn by tombstones.
+func withdrawnKeys(tombstones []*art.Tombstone) map[string]bool {
+	isWithdrawn := make(map[string]bool, len(tombstones))
+	for _, tombstone := range tombstones {
+		isWithdrawn[tombstoneKey(tombstone)] = true
+	}
+	return isWithdrawn
+}
+
+// applyTombstones deletes from localStorage the tracks and albums withdrawn by the tombstones in resources,
+// published by the artist with pubkey, with their payloads, so that a peer stops serving art its artist took down.
+// It applies only the tombstones of artists stored with pubkey, which ValidatePublication checks.
+// A withdrawn album is deleted with any of its tracks still stored. Art already deleted is skipped.
+func applyTombstones(localStorage ArtServer, pubkey string, resources *art.ArtResources, logger *slog.Logger) error {
+	isSignedBy := make(map[string]bool)
+	for _, tombstone := range resources.Tombstones {
+		logger := logger.With("artist_id", tombstone.ArtistId)
+		isSigned, isChecked := isSignedBy[tombstone.ArtistId]
+		if !isChecked {
+			artist, err := localStorage.Artist(tombstone.ArtistId)
+			if err != nil && !errors.Is(err, ErrArtNotFound) {
+				return err
+			}
+			isSigned = artist != nil && artist.Pubkey == pubkey
+			isSignedBy[tombstone.ArtistId] = isSigned
+		}
+		if !isSigned {
+			logger.Warn("ignore tombstone of artist with another pubkey", "pubkey", pubkey)
+			continue // to next tombstone
+		}
+
+		if tombstone.ArtistTrackId != "" {
+			err := deleteWithdrawnTrack(localStorage, &art.Track{ArtistId: tombstone.ArtistId, ArtistTrackId: tombstone.ArtistTrackId}, logger)
+			if err != nil {
+				return err
+			}
+			continue // to next tombstone
+		}
+		tracks, err := localStorage.Tracks(tombstone.ArtistId)
+		if err != nil && !errors.Is(err, ErrArtNotFound) {
+			return err
+		}
+		for _, track := range tracks {
+			if track.ArtistAlbumId == tombstone.ArtistAlbumId {
+				err = deleteWithdrawnTrack(localStorage, track, logger)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		err = localStorage.DeleteAlbum(&art.Album{ArtistId: tombstone.ArtistId, ArtistAlbumId: tombstone.ArtistAlbumId})
+		if errors.Is(err, ErrArtNotFound) {
+			continue // to next tombstone, of an album already deleted
+		} else if err != nil {
+			logger.Error("failed to delete withdrawn album", "album_id", tombstone.ArtistAlbumId, "error", err)
+			return err
+		}
+		logger.Info("deleted withdrawn album", "album_id", tombstone.ArtistAlbumId)
+	}
+	return nil
+}
+
+// deleteWithdrawnTrack deletes the stored track withdrawn by its artist, if it is still stored.
+func deleteWithdrawnTrack(localStorage ArtServer, track *art.Track, logger *slog.Logger) error {
+	err := localStorage.DeleteTrack(track)
+	if errors.Is(err, ErrArtNotFound) {
+		return nil
+	} else if err != nil {
+		logger.Error("failed to delete withdrawn track", "track_id", track.ArtistTrackId, "error", err)
+		return err
+	}
+	logger.Info("deleted withdrawn track", "track_id", track.ArtistTrackId)
+	return nil
+}
@@ -0,0 +1,190 @@
+package audiostrike
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// TestTombstones verifies that a peer importing the publication after an artist deletes a track and an album
+// deletes its copies with their payloads, that the publication from before the takedown cannot be replayed
+// to restore them, that a peer syncing since an earlier deletion gets only the later tombstones,
+// that art stored again after its deletion is published without its tombstone,
+// and that expired tombstones are no longer published and are deleted as the next one is stored.
+func TestTombstones(t *testing.T) {
+	newServer := func(artDir string) (*FileServer, *AustkServer) {
+		fileServer, err := NewFileServer(artDir)
+		if err != nil {
+			t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+		}
+		mockLightningNode, err := NewMockLightningNode(cfg, fileServer)
+		if err != nil {
+			t.Fatalf("Failed to instantiate lightning node, error: %v", err)
+		}
+		austkServer, err := NewAustkServer(cfg, fileServer, mockLightningNode)
+		if err != nil {
+			t.Fatalf("NewAustkServer error: %v", err)
+		}
+		return fileServer, austkServer
+	}
+	artistDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artistDir)
+	peerDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(peerDir)
+
+	artistFileServer, artistServer := newServer(artistDir)
+	err = artistFileServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	err = artistFileServer.StoreAlbum(&art.Album{ArtistId: mockArtistID, ArtistAlbumId: "facelift", Title: "Facelift"}, &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreAlbum error: %v", err)
+	}
+	tracks := []*art.Track{
+		{ArtistId: mockArtistID, ArtistTrackId: "would", Title: "Would?"},
+		{ArtistId: mockArtistID, ArtistTrackId: "rooster", Title: "Rooster"},
+		{ArtistId: mockArtistID, ArtistAlbumId: "facelift", ArtistTrackId: "maninthebox", Title: "Man in the Box"},
+	}
+	for _, track := range tracks {
+		err = artistFileServer.StoreTrack(track, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreTrack %s error: %v", track.ArtistTrackId, err)
+		}
+	}
+	beforeFilename := filepath.Join(artistDir, "before.pb")
+	_, err = artistServer.ExportPublication(mockArtistID, beforeFilename)
+	if err != nil {
+		t.Fatalf("ExportPublication error: %v", err)
+	}
+
+	peerFileServer, peerServer := newServer(peerDir)
+	_, err = peerServer.ImportPublication(beforeFilename)
+	if err != nil {
+		t.Fatalf("ImportPublication error: %v", err)
+	}
+	for _, track := range tracks {
+		err = peerFileServer.StoreTrackPayload(track, []byte(track.Title))
+		if err != nil {
+			t.Fatalf("StoreTrackPayload %s error: %v", track.ArtistTrackId, err)
+		}
+	}
+
+	err = artistServer.DeleteTrack(mockArtistID, "would")
+	if err != nil {
+		t.Fatalf("DeleteTrack error: %v", err)
+	}
+	_, resources, err := artistServer.ArtistPublication(context.Background(), mockArtistID, 0)
+	if err != nil {
+		t.Fatalf("ArtistPublication error: %v", err)
+	}
+	sinceDeletion := resources.AsOf
+	if len(resources.Tombstones) != 1 {
+		t.Fatalf("expected the tombstone of the deleted track but got %v", resources.Tombstones)
+	}
+	// Back date the deletion so the next is later.
+	resources.Tombstones[0].DeletedAt--
+	err = artistFileServer.StoreTombstone(resources.Tombstones[0])
+	if err != nil {
+		t.Fatalf("StoreTombstone error: %v", err)
+	}
+	err = artistServer.DeleteAlbum(mockArtistID, "facelift", true)
+	if err != nil {
+		t.Fatalf("DeleteAlbum error: %v", err)
+	}
+	_, resources, err = artistServer.ArtistPublication(context.Background(), mockArtistID, sinceDeletion)
+	if err != nil || len(resources.Tombstones) != 2 {
+		t.Errorf("expected only the tombstones since the first deletion but got %v, error: %v", resources, err)
+	}
+	afterFilename := filepath.Join(artistDir, "after.pb")
+	_, err = artistServer.ExportPublication(mockArtistID, afterFilename)
+	if err != nil {
+		t.Fatalf("ExportPublication error: %v", err)
+	}
+	resources, err = peerServer.ImportPublication(afterFilename)
+	if err != nil {
+		t.Fatalf("ImportPublication error: %v", err)
+	}
+	if len(resources.Tombstones) != 3 {
+		t.Errorf("expected tombstones of 2 tracks and an album but got %v", resources.Tombstones)
+	}
+	for _, trackID := range []string{"would", "maninthebox"} {
+		_, err = peerFileServer.Track(mockArtistID, trackID)
+		if err != ErrArtNotFound {
+			t.Errorf("expected withdrawn track %s deleted but got error %v", trackID, err)
+		}
+		_, err = os.Stat(filepath.Join(peerDir, mockArtistID, trackID+".mp3"))
+		if !os.IsNotExist(err) {
+			t.Errorf("expected payload of withdrawn track %s deleted but got error %v", trackID, err)
+		}
+	}
+	albums, err := peerFileServer.Albums(mockArtistID)
+	if err != nil || albums["facelift"] != nil {
+		t.Errorf("expected withdrawn album deleted but got %v, error: %v", albums, err)
+	}
+	_, err = peerFileServer.Track(mockArtistID, "rooster")
+	if err != nil {
+		t.Errorf("expected track not withdrawn kept but got error %v", err)
+	}
+
+	_, err = peerServer.ImportPublication(beforeFilename)
+	if !errors.Is(err, ErrPublicationStale) {
+		t.Errorf("expected ErrPublicationStale replaying the publication before the takedown but got %v", err)
+	}
+	_, err = peerFileServer.Track(mockArtistID, "would")
+	if err != ErrArtNotFound {
+		t.Errorf("expected withdrawn track to stay deleted but got error %v", err)
+	}
+
+	err = artistFileServer.StoreTrack(tracks[0], &mockPublisher)
+	if err != nil {
+		t.Fatalf("StoreTrack error: %v", err)
+	}
+	resources, err = artistServer.CollectResources()
+	if err != nil {
+		t.Fatalf("CollectResources error: %v", err)
+	}
+	for _, tombstone := range resources.Tombstones {
+		if tombstone.ArtistTrackId == "would" {
+			t.Errorf("expected no tombstone published for a track stored again but got %v", tombstone)
+		}
+	}
+	if len(resources.Tombstones) != 2 {
+		t.Errorf("expected tombstones of the deleted album and its track but got %v", resources.Tombstones)
+	}
+
+	expiredAt := uint64(time.Now().Add(-tombstoneLifetime).Unix()) - 1
+	err = artistFileServer.StoreTombstone(&art.Tombstone{ArtistId: mockArtistID, ArtistTrackId: "expired", DeletedAt: expiredAt})
+	if err != nil {
+		t.Fatalf("StoreTombstone error: %v", err)
+	}
+	resources, err = artistServer.CollectResources()
+	if err != nil || len(resources.Tombstones) != 2 {
+		t.Errorf("expected no expired tombstone published but got %v, error: %v", resources.GetTombstones(), err)
+	}
+	err = artistServer.DeleteTrack(mockArtistID, "rooster")
+	if err != nil {
+		t.Fatalf("DeleteTrack error: %v", err)
+	}
+	tombstones, err := artistFileServer.Tombstones()
+	if err != nil {
+		t.Fatalf("Tombstones error: %v", err)
+	}
+	for _, tombstone := range tombstones {
+		if tombstone.ArtistTrackId == "expired" {
+			t.Errorf("expected the expired tombstone deleted as the next is stored but got %v", tombstones)
+		}
+	}
+}
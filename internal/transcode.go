@@ -0,0 +1,57 @@
+package audiostrike
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// flacEncoder is the command that Transcode runs to encode flac, from the flac package of most distributions.
+var flacEncoder = "flac"
+
+// transcodeCodecs maps each container that Transcode can encode onto the codec of the audio it encodes.
+var transcodeCodecs = map[string]string{
+	ContainerFlac: CodecFlac,
+}
+
+// Transcode encodes the audio of a wav file in the target container, e.g. "flac", to store it in less space.
+// It runs the flac command, copying the tags of audio into the flac file's vorbis comments.
+func Transcode(audio AudioFile, target string) ([]byte, error) {
+	if _, isTarget := transcodeCodecs[target]; !isTarget {
+		return nil, fmt.Errorf("cannot transcode to %s, only to flac", target)
+	}
+	if audio.Container() != ContainerWav {
+		return nil, fmt.Errorf("cannot transcode %s to %s, only wav", audio.Container(), target)
+	}
+	payload, err := audio.ReadBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{"--silent", "--stdout", "--best"}
+	albumTitle, _ := audio.AlbumTitle()
+	tags := []string{"ARTIST=" + audio.ArtistName(), "ALBUM=" + albumTitle, "TITLE=" + audio.Title()}
+	if trackNumber := audio.TrackNumber(); trackNumber > 0 {
+		tags = append(tags, "TRACKNUMBER="+strconv.Itoa(int(trackNumber)))
+	}
+	for _, tag := range tags {
+		if !strings.HasSuffix(tag, "=") {
+			args = append(args, "--tag="+tag)
+		}
+	}
+	args = append(args, "-") // to encode stdin
+
+	var encoded, encoderErrors bytes.Buffer
+	encoder := exec.Command(flacEncoder, args...)
+	encoder.Stdin = bytes.NewReader(payload)
+	encoder.Stdout = &encoded
+	encoder.Stderr = &encoderErrors
+	err = encoder.Run()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed to encode %s: %w: %s",
+			flacEncoder, audio.Title(), err, strings.TrimSpace(encoderErrors.String()))
+	}
+	return encoded.Bytes(), nil
+}
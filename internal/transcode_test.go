@@ -0,0 +1,72 @@
+package audiostrike
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeFlacEncoder writes to dir a script that stands in for the flac command, printing its arguments
+// instead of encoding stdin, and sets flacEncoder to run it until the returned func restores it.
+func fakeFlacEncoder(t *testing.T, dir string) func() {
+	script := filepath.Join(dir, "flac")
+	err := ioutil.WriteFile(script, []byte("#!/bin/sh\ncat >/dev/null\nprintf 'fLaC %s' \"$*\"\n"), 0755)
+	if err != nil {
+		t.Fatalf("WriteFile %s error: %v", script, err)
+	}
+	originalEncoder := flacEncoder
+	flacEncoder = script
+	return func() { flacEncoder = originalEncoder }
+}
+
+// TestTranscode verifies that wav audio is encoded with its tags and that other transcodes are refused.
+func TestTranscode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer fakeFlacEncoder(t, dir)()
+	wavPath := filepath.Join(dir, "would.wav")
+	err = ioutil.WriteFile(wavPath, wavWithInfo("IART", "Alice in Chains", "INAM", "Would?", "ITRK", "9/13"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile %s error: %v", wavPath, err)
+	}
+	flacPath := filepath.Join(dir, "would.flac")
+	err = ioutil.WriteFile(flacPath, flacWithComments("TITLE=Would?"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile %s error: %v", flacPath, err)
+	}
+	wav, err := OpenAudioFile(wavPath)
+	if err != nil {
+		t.Fatalf("OpenAudioFile %s error: %v", wavPath, err)
+	}
+	flac, err := OpenAudioFile(flacPath)
+	if err != nil {
+		t.Fatalf("OpenAudioFile %s error: %v", flacPath, err)
+	}
+
+	encoded, err := Transcode(wav, ContainerFlac)
+	if err != nil {
+		t.Fatalf("Transcode error: %v", err)
+	}
+	for _, expected := range []string{"fLaC", "--tag=ARTIST=Alice in Chains", "--tag=TITLE=Would?", "--tag=TRACKNUMBER=9"} {
+		if !strings.Contains(string(encoded), expected) {
+			t.Errorf("expected %q encoding wav but got %q", expected, encoded)
+		}
+	}
+	if strings.Contains(string(encoded), "ALBUM") {
+		t.Errorf("expected no album tag encoding wav without album but got %q", encoded)
+	}
+
+	_, err = Transcode(wav, ContainerMp3)
+	if err == nil {
+		t.Errorf("expected error transcoding to mp3")
+	}
+	_, err = Transcode(flac, ContainerFlac)
+	if err == nil {
+		t.Errorf("expected error transcoding flac")
+	}
+}
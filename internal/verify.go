@@ -0,0 +1,169 @@
+package audiostrike
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// VerifyReport lists the problems that VerifyArt found between the art records and the payload files of a node.
+type VerifyReport struct {
+	// MissingPayloads are the tracks whose payload file is not stored.
+	MissingPayloads []*art.Track
+	// EmptyAlbums are the albums without any tracks.
+	EmptyAlbums []*art.Album
+	// OrphanedPayloads are the paths of payload files for which no track is stored.
+	OrphanedPayloads []string
+	// RemovedPayloads are the orphaned payload files that were removed to repair the node.
+	RemovedPayloads []string
+}
+
+// OK tells whether the report found no problems.
+func (report VerifyReport) OK() bool {
+	return len(report.MissingPayloads) == 0 && len(report.EmptyAlbums) == 0 &&
+		len(report.OrphanedPayloads) == len(report.RemovedPayloads)
+}
+
+// String summarizes the report, listing each problem on its own line.
+func (report VerifyReport) String() string {
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "missing payloads %d, empty albums %d, orphaned payloads %d, removed %d",
+		len(report.MissingPayloads), len(report.EmptyAlbums), len(report.OrphanedPayloads), len(report.RemovedPayloads))
+	for _, track := range report.MissingPayloads {
+		fmt.Fprintf(&summary, "\nmissing payload of track %s/%s", track.ArtistId, track.ArtistTrackId)
+	}
+	for _, album := range report.EmptyAlbums {
+		fmt.Fprintf(&summary, "\nno tracks on album %s/%s", album.ArtistId, album.ArtistAlbumId)
+	}
+	removed := make(map[string]bool)
+	for _, path := range report.RemovedPayloads {
+		removed[path] = true
+	}
+	for _, path := range report.OrphanedPayloads {
+		if removed[path] {
+			fmt.Fprintf(&summary, "\nremoved orphaned payload %s", path)
+		} else {
+			fmt.Fprintf(&summary, "\norphaned payload %s", path)
+		}
+	}
+	return summary.String()
+}
+
+// isPayloadStored checks whether artServer stores a payload for track outside any payload file,
+// by its size if artServer is a payloadSizer, or else by opening it.
+func isPayloadStored(artServer ArtServer, track *art.Track) (bool, error) {
+	var err error
+	if sizer, isSizer := artServer.(payloadSizer); isSizer {
+		_, err = sizer.TrackPayloadSize(track)
+	} else {
+		var payloadReader io.ReadCloser
+		payloadReader, err = artServer.TrackFilePartialReader(track, 0)
+		if err == nil {
+			payloadReader.Close()
+		}
+	}
+	if errors.Is(err, ErrArtNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// VerifyArt checks the art records of artServer against the payload files stored under payloadDir,
+// like fsck checks a file system: tracks without payloads, albums without tracks, and payloads without tracks.
+// If repair is set, orphaned payload files are removed. Other problems are only reported.
+func VerifyArt(artServer ArtServer, payloadDir string, repair bool) (VerifyReport, error) {
+	logger := componentLogger("verify")
+	var report VerifyReport
+
+	artists, err := artServer.Artists()
+	if err != nil {
+		logger.Error("failed to get artists", "error", err)
+		return report, err
+	}
+	artistIDs := make([]string, 0, len(artists))
+	for artistID := range artists {
+		artistIDs = append(artistIDs, artistID)
+	}
+	// trackPayloads has the cleaned path of the payload file of each stored track.
+	trackPayloads := make(map[string]bool)
+	for _, artistID := range sortedPage(artistIDs, 0, -1) {
+		tracks, err := artServer.Tracks(artistID)
+		if err != nil {
+			logger.Error("failed to get tracks", "artist_id", artistID, "error", err)
+			return report, err
+		}
+		albumTrackCounts := make(map[string]int)
+		for _, track := range pageTracks(tracks, 0, -1) {
+			albumTrackCounts[track.ArtistAlbumId]++
+			if artServer.TrackFilePath(track) == "" {
+				// The payload is stored outside the payload dir, e.g. in an s3 bucket, so check the store for it.
+				isStored, err := isPayloadStored(artServer, track)
+				if err != nil {
+					logger.Error("failed to check payload", "artist_id", artistID, "track_id", track.ArtistTrackId, "error", err)
+					return report, err
+				}
+				if !isStored {
+					report.MissingPayloads = append(report.MissingPayloads, track)
+				}
+				continue
+			}
+			payloadPath := filepath.Clean(artServer.TrackFilePath(track))
+			trackPayloads[payloadPath] = true
+			_, err = os.Stat(payloadPath)
+			if os.IsNotExist(err) {
+				report.MissingPayloads = append(report.MissingPayloads, track)
+			} else if err != nil {
+				logger.Error("failed to stat payload", "artist_id", artistID, "track_id", track.ArtistTrackId, "error", err)
+				return report, err
+			}
+		}
+
+		albums, err := artServer.Albums(artistID)
+		if err != nil {
+			logger.Error("failed to get albums", "artist_id", artistID, "error", err)
+			return report, err
+		}
+		for _, album := range pageAlbums(albums, 0, -1) {
+			if albumTrackCounts[album.ArtistAlbumId] == 0 {
+				report.EmptyAlbums = append(report.EmptyAlbums, album)
+			}
+		}
+	}
+
+	payloadDir = filepath.Clean(payloadDir)
+	err = filepath.Walk(payloadDir, func(path string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath := strings.TrimPrefix(path, payloadDir)
+		if fileInfo.IsDir() || !artistTrackPayloadRegexp.MatchString(relativePath) {
+			return nil
+		}
+		if trackPayloads[filepath.Clean(path)] {
+			return nil
+		}
+		report.OrphanedPayloads = append(report.OrphanedPayloads, path)
+		if repair {
+			err = os.Remove(path)
+			if err != nil {
+				logger.Error("failed to remove orphaned payload", "path", path, "error", err)
+				return err
+			}
+			logger.Info("removed orphaned payload", "path", path)
+			report.RemovedPayloads = append(report.RemovedPayloads, path)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("failed to walk payload files", "path", payloadDir, "error", err)
+		return report, err
+	}
+	logger.Info("verified art", "missing_payloads", len(report.MissingPayloads), "empty_albums", len(report.EmptyAlbums),
+		"orphaned_payloads", len(report.OrphanedPayloads), "removed_payloads", len(report.RemovedPayloads))
+	return report, nil
+}
@@ -0,0 +1,82 @@
+package audiostrike
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	art "github.com/audiostrike/music/pkg/art"
+)
+
+// TestVerifyArt verifies that VerifyArt reports tracks without payloads, albums without tracks,
+// and payloads without tracks, and that repair removes only the payloads without tracks.
+func TestVerifyArt(t *testing.T) {
+	artDir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(artDir)
+	fileServer, err := NewFileServer(artDir)
+	if err != nil {
+		t.Fatalf("NewFileServer(%s), error: %v", artDir, err)
+	}
+	err = fileServer.StoreArtist(&mockArtist)
+	if err != nil {
+		t.Fatalf("StoreArtist error: %v", err)
+	}
+	for _, albumID := range []string{"dirt", "facelift"} {
+		err = fileServer.StoreAlbum(&art.Album{ArtistId: mockArtistID, ArtistAlbumId: albumID}, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreAlbum %s error: %v", albumID, err)
+		}
+	}
+	storedTrack := &art.Track{ArtistId: mockArtistID, ArtistAlbumId: "dirt", ArtistTrackId: "dirt/would"}
+	missingTrack := &art.Track{ArtistId: mockArtistID, ArtistAlbumId: "dirt", ArtistTrackId: "dirt/rooster"}
+	for _, track := range []*art.Track{storedTrack, missingTrack} {
+		err = fileServer.StoreTrack(track, &mockPublisher)
+		if err != nil {
+			t.Fatalf("StoreTrack %s error: %v", track.ArtistTrackId, err)
+		}
+	}
+	err = fileServer.StoreTrackPayload(storedTrack, []byte("would"))
+	if err != nil {
+		t.Fatalf("StoreTrackPayload error: %v", err)
+	}
+	orphanedPayload := filepath.Join(artDir, mockArtistID, "dirt", "rain.mp3")
+	err = ioutil.WriteFile(orphanedPayload, []byte("rain"), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile %s error: %v", orphanedPayload, err)
+	}
+
+	report, err := VerifyArt(fileServer, artDir, false)
+	if err != nil {
+		t.Fatalf("VerifyArt error: %v", err)
+	}
+	if report.OK() {
+		t.Errorf("expected problems but got %v", report)
+	}
+	if len(report.MissingPayloads) != 1 || report.MissingPayloads[0].ArtistTrackId != missingTrack.ArtistTrackId {
+		t.Errorf("expected missing payload of %s but got %v", missingTrack.ArtistTrackId, report.MissingPayloads)
+	}
+	if len(report.EmptyAlbums) != 1 || report.EmptyAlbums[0].ArtistAlbumId != "facelift" {
+		t.Errorf("expected empty album facelift but got %v", report.EmptyAlbums)
+	}
+	if len(report.OrphanedPayloads) != 1 || report.OrphanedPayloads[0] != orphanedPayload || len(report.RemovedPayloads) != 0 {
+		t.Errorf("expected orphaned payload %s kept but got %v", orphanedPayload, report)
+	}
+
+	report, err = VerifyArt(fileServer, artDir, true)
+	if err != nil {
+		t.Fatalf("VerifyArt with repair error: %v", err)
+	}
+	if len(report.RemovedPayloads) != 1 || report.RemovedPayloads[0] != orphanedPayload {
+		t.Errorf("expected orphaned payload %s removed but got %v", orphanedPayload, report)
+	}
+	if _, err = os.Stat(orphanedPayload); !os.IsNotExist(err) {
+		t.Errorf("expected %s removed but got error %v", orphanedPayload, err)
+	}
+	if _, err = os.Stat(fileServer.TrackFilePath(storedTrack)); err != nil {
+		t.Errorf("expected payload of %s kept but got error %v", storedTrack.ArtistTrackId, err)
+	}
+}
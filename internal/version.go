@@ -0,0 +1,84 @@
+package audiostrike
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// VersionHeader is the http header in which a client and the peer it syncs from name their austk Version,
+// so that either can warn about an incompatible peer.
+const VersionHeader = "X-Austk-Version"
+
+// The build of austk, injected by ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/audiostrike/music/internal.Version=v0.4.0
+//	-X github.com/audiostrike/music/internal.Commit=$(git rev-parse --short HEAD)
+//	-X github.com/audiostrike/music/internal.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/austk
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// VersionString describes the build of austk, e.g. "v0.4.0 (commit 1a2b3c4, built 2026-10-17T12:00:00Z)".
+func VersionString() string {
+	return fmt.Sprintf("%s (commit %s, built %s)", Version, Commit, BuildDate)
+}
+
+// isCompatibleVersion checks whether a node of version may sync with a peer of peerVersion:
+// semantic versions with the same major version, or for v0 the same minor version, as semver allows breaking
+// changes between those. A version that is not semantic, e.g. "dev" or the "" of a peer that names none, is
+// assumed compatible.
+func isCompatibleVersion(version string, peerVersion string) bool {
+	major, minor, isSemantic := parseVersion(version)
+	peerMajor, peerMinor, isPeerSemantic := parseVersion(peerVersion)
+	if !isSemantic || !isPeerSemantic {
+		return true
+	}
+	return major == peerMajor && (major != 0 || minor == peerMinor)
+}
+
+// parseVersion parses the major and minor numbers of a semantic version such as v1.2.3 or 1.2.3-rc1.
+func parseVersion(version string) (major int, minor int, isSemantic bool) {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 3 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err = strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
+
+// versioned wraps handler to name this node's Version in each reply,
+// noting requests from peers whose version is incompatible.
+func (server *AustkServer) versioned(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(VersionHeader, Version)
+		peerVersion := req.Header.Get(VersionHeader)
+		if !isCompatibleVersion(Version, peerVersion) {
+			server.logger.Debug("request from peer of incompatible version",
+				"peer", req.Header.Get(PubkeyHeader), "peer_version", peerVersion, "version", Version)
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// checkPeerVersion warns if the peer names a version of austk incompatible with this one,
+// once for each version it names.
+func (client *Client) checkPeerVersion(peerVersion string) {
+	if peerVersion == client.peerVersion {
+		return
+	}
+	client.peerVersion = peerVersion
+	if !isCompatibleVersion(Version, peerVersion) {
+		client.logger.Warn("peer runs incompatible version of austk", "peer_version", peerVersion, "version", Version)
+	}
+}
@@ -0,0 +1,28 @@
+package audiostrike
+
+import (
+	"testing"
+)
+
+// TestIsCompatibleVersion verifies that peers are compatible within a major version, or a minor version before v1,
+// and that a version that is not semantic is assumed compatible.
+func TestIsCompatibleVersion(t *testing.T) {
+	for _, test := range []struct {
+		version      string
+		peerVersion  string
+		isCompatible bool
+	}{
+		{"v1.2.3", "v1.4.0", true},
+		{"v1.2.3", "v2.0.0", false},
+		{"v0.3.1", "v0.3.7-rc1", true},
+		{"v0.3.1", "v0.4.0", false},
+		{"1.0.0", "v1.0.1", true},
+		{"dev", "v2.0.0", true},
+		{"v1.0.0", "", true},
+	} {
+		if isCompatible := isCompatibleVersion(test.version, test.peerVersion); isCompatible != test.isCompatible {
+			t.Errorf("expected isCompatibleVersion(%q, %q) %v but got %v",
+				test.version, test.peerVersion, test.isCompatible, isCompatible)
+		}
+	}
+}
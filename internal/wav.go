@@ -0,0 +1,272 @@
+package audiostrike
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/faiface/beep"
+	faifacewav "github.com/faiface/beep/wav"
+)
+
+const (
+	riffMagic = "RIFF"
+	waveMagic = "WAVE"
+
+	// riffInfoList identifies the LIST chunk whose subchunks hold the wav tags.
+	riffInfoList = "INFO"
+)
+
+// riffInfoTags maps the ids of RIFF INFO subchunks onto the tag names used for mp3 ID3 tags.
+// There is no standard INFO subchunk for the track number, so both ITRK and IPRT are read.
+var riffInfoTags = map[string]string{
+	"IART": "Artist",
+	"IPRD": "Album",
+	"INAM": "Title",
+	"ITRK": "Track",
+	"IPRT": "Track",
+	"IGNR": "Genre",
+	"ICRD": "Year",
+}
+
+// Wav exposes the Tags (RIFF INFO) and bytes of a given .wav file of PCM audio.
+type Wav struct {
+	path             string
+	buffer           []byte
+	Tags             map[string]string
+	playbackFinished chan bool
+}
+
+// OpenWavToRead opens a wav file to read its data and tags (metadata).
+// A file without a title tag is titled by its filename, since wav files are often untagged.
+func OpenWavToRead(path string) (AudioFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tags, err := readWavTags(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wav tags from %s: %w", path, err)
+	}
+	if tags["Title"] == "" {
+		tags["Title"] = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	return &Wav{
+		path: path,
+		Tags: tags,
+	}, nil
+}
+
+// readWavTags reads the RIFF chunks from reader and returns the subchunks of its INFO list
+// keyed by the same tag names that parseTags uses for mp3 files.
+// Other chunks, including the audio data, are skipped.
+func readWavTags(reader io.ReadSeeker) (map[string]string, error) {
+	header := make([]byte, 12)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != riffMagic || string(header[8:]) != waveMagic {
+		return nil, fmt.Errorf("not a wav file, missing %s and %s markers", riffMagic, waveMagic)
+	}
+
+	tags := map[string]string{
+		"Artist": "",
+		"Album":  "",
+		"Title":  "",
+	}
+	for {
+		chunkID, chunkLength, err := readRiffChunkHeader(reader)
+		if err == io.EOF {
+			return tags, nil
+		} else if err != nil {
+			return nil, err
+		}
+		// Chunks are padded to an even length.
+		paddedLength := int64(chunkLength) + int64(chunkLength%2)
+		if chunkID != "LIST" {
+			_, err = reader.Seek(paddedLength, io.SeekCurrent)
+			if err != nil {
+				return nil, err
+			}
+			continue // to next chunk
+		}
+
+		chunk := make([]byte, paddedLength)
+		_, err = io.ReadFull(reader, chunk)
+		if err == io.ErrUnexpectedEOF && chunkLength%2 == 1 {
+			err = nil // The last chunk may omit its pad byte.
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasPrefix(chunk, []byte(riffInfoList)) {
+			continue // to next chunk, e.g. an adtl list of cue labels
+		}
+		err = parseRiffInfo(chunk[len(riffInfoList):chunkLength], tags)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readWavDuration reads the length of the audio data of a wav file from the lengths of its data chunk
+// and the byte rate in its fmt chunk.
+func readWavDuration(reader io.ReadSeeker) (time.Duration, error) {
+	header := make([]byte, 12)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return 0, err
+	}
+	if string(header[:4]) != riffMagic || string(header[8:]) != waveMagic {
+		return 0, fmt.Errorf("not a wav file, missing %s and %s markers", riffMagic, waveMagic)
+	}
+
+	var byteRate, dataLength uint32
+	hasData := false
+	for byteRate == 0 || !hasData {
+		chunkID, chunkLength, err := readRiffChunkHeader(reader)
+		if err == io.EOF {
+			return 0, fmt.Errorf("wav file has no fmt chunk with a byte rate or no data chunk")
+		} else if err != nil {
+			return 0, err
+		}
+		paddedLength := int64(chunkLength) + int64(chunkLength%2)
+		if chunkID == "fmt " && chunkLength >= 12 {
+			format := make([]byte, 12)
+			_, err = io.ReadFull(reader, format)
+			if err != nil {
+				return 0, err
+			}
+			byteRate = binary.LittleEndian.Uint32(format[8:])
+			paddedLength -= int64(len(format))
+		} else if chunkID == "data" {
+			dataLength, hasData = chunkLength, true
+		}
+		_, err = reader.Seek(paddedLength, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return time.Duration(int64(dataLength) * int64(time.Second) / int64(byteRate)), nil
+}
+
+// readRiffChunkHeader reads the id and length of the next RIFF chunk from reader.
+// It returns io.EOF if there are no more chunks.
+func readRiffChunkHeader(reader io.Reader) (string, uint32, error) {
+	header := make([]byte, 8)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(header[:4]), binary.LittleEndian.Uint32(header[4:]), nil
+}
+
+// parseRiffInfo parses the subchunks of an INFO list into tags.
+func parseRiffInfo(list []byte, tags map[string]string) error {
+	reader := bytes.NewReader(list)
+	for reader.Len() > 0 {
+		subchunkID, subchunkLength, err := readRiffChunkHeader(reader)
+		if err != nil {
+			return err
+		}
+		if int64(subchunkLength) > int64(reader.Len()) {
+			return fmt.Errorf("wav %s tag length %d exceeds INFO list", subchunkID, subchunkLength)
+		}
+		value := make([]byte, subchunkLength)
+		_, err = io.ReadFull(reader, value)
+		if err != nil {
+			return err
+		}
+		if subchunkLength%2 == 1 && reader.Len() > 0 {
+			reader.Seek(1, io.SeekCurrent) // past the pad byte
+		}
+		tagName, isKnownTag := riffInfoTags[subchunkID]
+		if isKnownTag {
+			tags[tagName] = strings.TrimRight(string(value), "\x00 ")
+		}
+	}
+	return nil
+}
+
+func (wav *Wav) ArtistName() string {
+	return wav.Tags["Artist"]
+}
+
+func (wav *Wav) AlbumTitle() (string, bool) {
+	albumTitle := wav.Tags["Album"]
+	return albumTitle, albumTitle != ""
+}
+
+func (wav *Wav) Title() string {
+	return wav.Tags["Title"]
+}
+
+func (wav *Wav) TrackNumber() uint32 {
+	return parseTrackNumber(wav.Tags["Track"])
+}
+
+func (wav *Wav) Genres() []string {
+	return parseGenres(wav.Tags["Genre"])
+}
+
+func (wav *Wav) Year() uint32 {
+	return parseYear(wav.Tags["Year"])
+}
+
+func (wav *Wav) Container() string {
+	return ContainerWav
+}
+
+func (wav *Wav) Codec() string {
+	return CodecPcm
+}
+
+// CoverArt gets no picture, since wav files have no standard chunk to embed one.
+func (wav *Wav) CoverArt() *Picture {
+	return nil
+}
+
+// Duration reads the length of the audio from the chunks of the wav file, without decoding it.
+func (wav *Wav) Duration() (time.Duration, error) {
+	file, err := os.Open(wav.path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return readWavDuration(file)
+}
+
+// ReadBytes returns the raw data from the .wav file.
+func (wav *Wav) ReadBytes() ([]byte, error) {
+	if wav.buffer != nil {
+		return wav.buffer, nil
+	}
+
+	buffer, err := ioutil.ReadFile(wav.path)
+	if err != nil {
+		return nil, err
+	}
+	wav.buffer = buffer
+	return wav.buffer, nil
+}
+
+func (wav *Wav) Decode() (beep.StreamSeekCloser, beep.Format, error) {
+	return decodeFile(wav.path, func(file *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+		return faifacewav.Decode(file)
+	})
+}
+
+func (wav *Wav) PlayAndWait() error {
+	wav.playbackFinished = make(chan bool)
+	return playAndWait(wav.path, wav.Decode, wav.playbackFinished)
+}
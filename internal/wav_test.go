@@ -0,0 +1,88 @@
+package audiostrike
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// riffChunk builds a RIFF chunk with id holding data, padded to an even length.
+func riffChunk(id string, data []byte) []byte {
+	var chunk bytes.Buffer
+	chunk.WriteString(id)
+	binary.Write(&chunk, binary.LittleEndian, uint32(len(data)))
+	chunk.Write(data)
+	if len(data)%2 == 1 {
+		chunk.WriteByte(0)
+	}
+	return chunk.Bytes()
+}
+
+// wavWithInfo builds a wav file of a short silent PCM stream tagged with an INFO subchunk
+// for each id and value pair in info, e.g. "INAM", "Would?".
+func wavWithInfo(info ...string) []byte {
+	format := make([]byte, 16)
+	binary.LittleEndian.PutUint16(format[0:], 1)      // PCM
+	binary.LittleEndian.PutUint16(format[2:], 2)      // channels
+	binary.LittleEndian.PutUint32(format[4:], 44100)  // sample rate
+	binary.LittleEndian.PutUint32(format[8:], 176400) // byte rate
+	binary.LittleEndian.PutUint16(format[12:], 4)     // block align
+	binary.LittleEndian.PutUint16(format[14:], 16)    // bits per sample
+	chunks := append(riffChunk("fmt ", format), riffChunk("data", make([]byte, 400))...)
+	if len(info) > 0 {
+		list := []byte(riffInfoList)
+		for i := 0; i+1 < len(info); i += 2 {
+			list = append(list, riffChunk(info[i], append([]byte(info[i+1]), 0))...)
+		}
+		chunks = append(chunks, riffChunk("LIST", list)...)
+	}
+	return riffChunk(riffMagic, append([]byte(waveMagic), chunks...))
+}
+
+// TestReadWavTags verifies that the INFO tags of a wav file are read after its audio data.
+func TestReadWavTags(t *testing.T) {
+	wav := wavWithInfo("IART", "Alice in Chains", "INAM", "Would?", "IPRD", "Dirt", "ITRK", "9", "ICMT", "master",
+		"IGNR", "Grunge", "ICRD", "1992-09-29")
+	tags, err := readWavTags(bytes.NewReader(wav))
+	if err != nil {
+		t.Fatalf("readWavTags error: %v", err)
+	}
+	expectedTags := map[string]string{"Artist": "Alice in Chains", "Title": "Would?", "Album": "Dirt", "Track": "9",
+		"Genre": "Grunge", "Year": "1992-09-29"}
+	for tagName, expectedValue := range expectedTags {
+		if tags[tagName] != expectedValue {
+			t.Errorf("expected %s tag %q but got %q", tagName, expectedValue, tags[tagName])
+		}
+	}
+
+	_, err = readWavTags(bytes.NewReader(flacWithComments("TITLE=Would?")))
+	if err == nil {
+		t.Errorf("expected error reading flac as wav")
+	}
+}
+
+// TestWavFileArt verifies that an untagged wav file is sniffed as wav and titled by its filename.
+func TestWavFileArt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "austk")
+	if err != nil {
+		t.Fatalf("TempDir error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "Would.WAV")
+	err = ioutil.WriteFile(path, wavWithInfo(), 0644)
+	if err != nil {
+		t.Fatalf("WriteFile %s error: %v", path, err)
+	}
+
+	audio, err := OpenAudioFile(path)
+	if err != nil {
+		t.Fatalf("OpenAudioFile %s error: %v", path, err)
+	}
+	_, _, track := AudioFileArt(audio)
+	if track.ArtistTrackId != "would" || track.Title != "Would" || track.Container != ContainerWav || track.Codec != CodecPcm {
+		t.Errorf("expected pcm track would in wav container but got %v", track)
+	}
+}
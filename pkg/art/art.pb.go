@@ -83,6 +83,9 @@ type Artist struct {
 	ArtistId             string   `protobuf:"bytes,1,opt,name=artist_id,json=artistId,proto3" json:"artist_id,omitempty"`
 	Name                 string   `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
 	Pubkey               string   `protobuf:"bytes,3,opt,name=pubkey,proto3" json:"pubkey,omitempty"`
+	UpdatedAt            uint64   `protobuf:"varint,4,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	PreviousPubkey       string   `protobuf:"bytes,5,opt,name=previous_pubkey,json=previousPubkey,proto3" json:"previous_pubkey,omitempty"`
+	PubkeyLinkSignature  string   `protobuf:"bytes,6,opt,name=pubkey_link_signature,json=pubkeyLinkSignature,proto3" json:"pubkey_link_signature,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -134,10 +137,32 @@ func (m *Artist) GetPubkey() string {
 	return ""
 }
 
+func (m *Artist) GetUpdatedAt() uint64 {
+	if m != nil {
+		return m.UpdatedAt
+	}
+	return 0
+}
+
+func (m *Artist) GetPreviousPubkey() string {
+	if m != nil {
+		return m.PreviousPubkey
+	}
+	return ""
+}
+
+func (m *Artist) GetPubkeyLinkSignature() string {
+	if m != nil {
+		return m.PubkeyLinkSignature
+	}
+	return ""
+}
+
 type ArtistPublication struct {
 	Artist                 *Artist  `protobuf:"bytes,1,opt,name=artist,proto3" json:"artist,omitempty"`
 	Signature              string   `protobuf:"bytes,2,opt,name=signature,proto3" json:"signature,omitempty"`
 	SerializedArtResources []byte   `protobuf:"bytes,3,opt,name=serialized_art_resources,json=serializedArtResources,proto3" json:"serialized_art_resources,omitempty"`
+	SignatureScheme        string   `protobuf:"bytes,4,opt,name=signature_scheme,json=signatureScheme,proto3" json:"signature_scheme,omitempty"`
 	XXX_NoUnkeyedLiteral   struct{} `json:"-"`
 	XXX_unrecognized       []byte   `json:"-"`
 	XXX_sizecache          int32    `json:"-"`
@@ -189,14 +214,28 @@ func (m *ArtistPublication) GetSerializedArtResources() []byte {
 	return nil
 }
 
+func (m *ArtistPublication) GetSignatureScheme() string {
+	if m != nil {
+		return m.SignatureScheme
+	}
+	return ""
+}
+
 type ArtResources struct {
-	Artists              []*Artist `protobuf:"bytes,1,rep,name=artists,proto3" json:"artists,omitempty"`
-	Albums               []*Album  `protobuf:"bytes,2,rep,name=albums,proto3" json:"albums,omitempty"`
-	Tracks               []*Track  `protobuf:"bytes,3,rep,name=tracks,proto3" json:"tracks,omitempty"`
-	Peers                []*Peer   `protobuf:"bytes,4,rep,name=peers,proto3" json:"peers,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
-	XXX_unrecognized     []byte    `json:"-"`
-	XXX_sizecache        int32     `json:"-"`
+	Artists              []*Artist    `protobuf:"bytes,1,rep,name=artists,proto3" json:"artists,omitempty"`
+	Albums               []*Album     `protobuf:"bytes,2,rep,name=albums,proto3" json:"albums,omitempty"`
+	Tracks               []*Track     `protobuf:"bytes,3,rep,name=tracks,proto3" json:"tracks,omitempty"`
+	Peers                []*Peer      `protobuf:"bytes,4,rep,name=peers,proto3" json:"peers,omitempty"`
+	AsOf                 uint64       `protobuf:"varint,5,opt,name=as_of,json=asOf,proto3" json:"as_of,omitempty"`
+	Since                uint64       `protobuf:"varint,6,opt,name=since,proto3" json:"since,omitempty"`
+	ScopeArtistId        string       `protobuf:"bytes,7,opt,name=scope_artist_id,json=scopeArtistId,proto3" json:"scope_artist_id,omitempty"`
+	ScopeAlbumId         string       `protobuf:"bytes,8,opt,name=scope_album_id,json=scopeAlbumId,proto3" json:"scope_album_id,omitempty"`
+	Playlists            []*Playlist  `protobuf:"bytes,9,rep,name=playlists,proto3" json:"playlists,omitempty"`
+	Sequence             uint64       `protobuf:"varint,10,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	Tombstones           []*Tombstone `protobuf:"bytes,11,rep,name=tombstones,proto3" json:"tombstones,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
 }
 
 func (m *ArtResources) Reset()         { *m = ArtResources{} }
@@ -252,11 +291,168 @@ func (m *ArtResources) GetPeers() []*Peer {
 	return nil
 }
 
+func (m *ArtResources) GetAsOf() uint64 {
+	if m != nil {
+		return m.AsOf
+	}
+	return 0
+}
+
+func (m *ArtResources) GetSince() uint64 {
+	if m != nil {
+		return m.Since
+	}
+	return 0
+}
+
+func (m *ArtResources) GetScopeArtistId() string {
+	if m != nil {
+		return m.ScopeArtistId
+	}
+	return ""
+}
+
+func (m *ArtResources) GetScopeAlbumId() string {
+	if m != nil {
+		return m.ScopeAlbumId
+	}
+	return ""
+}
+
+func (m *ArtResources) GetPlaylists() []*Playlist {
+	if m != nil {
+		return m.Playlists
+	}
+	return nil
+}
+
+func (m *ArtResources) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+func (m *ArtResources) GetTombstones() []*Tombstone {
+	if m != nil {
+		return m.Tombstones
+	}
+	return nil
+}
+
+type Tombstone struct {
+	ArtistId             string   `protobuf:"bytes,1,opt,name=artist_id,json=artistId,proto3" json:"artist_id,omitempty"`
+	ArtistTrackId        string   `protobuf:"bytes,2,opt,name=artist_track_id,json=artistTrackId,proto3" json:"artist_track_id,omitempty"`
+	ArtistAlbumId        string   `protobuf:"bytes,3,opt,name=artist_album_id,json=artistAlbumId,proto3" json:"artist_album_id,omitempty"`
+	DeletedAt            uint64   `protobuf:"varint,4,opt,name=deleted_at,json=deletedAt,proto3" json:"deleted_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Tombstone) Reset()         { *m = Tombstone{} }
+func (m *Tombstone) String() string { return proto.CompactTextString(m) }
+func (*Tombstone) ProtoMessage()    {}
+func (*Tombstone) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{4}
+}
+
+func (m *Tombstone) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Tombstone.Unmarshal(m, b)
+}
+func (m *Tombstone) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Tombstone.Marshal(b, m, deterministic)
+}
+func (m *Tombstone) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Tombstone.Merge(m, src)
+}
+func (m *Tombstone) XXX_Size() int {
+	return xxx_messageInfo_Tombstone.Size(m)
+}
+func (m *Tombstone) XXX_DiscardUnknown() {
+	xxx_messageInfo_Tombstone.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Tombstone proto.InternalMessageInfo
+
+func (m *Tombstone) GetArtistId() string {
+	if m != nil {
+		return m.ArtistId
+	}
+	return ""
+}
+
+func (m *Tombstone) GetArtistTrackId() string {
+	if m != nil {
+		return m.ArtistTrackId
+	}
+	return ""
+}
+
+func (m *Tombstone) GetArtistAlbumId() string {
+	if m != nil {
+		return m.ArtistAlbumId
+	}
+	return ""
+}
+
+func (m *Tombstone) GetDeletedAt() uint64 {
+	if m != nil {
+		return m.DeletedAt
+	}
+	return 0
+}
+
+type Tombstones struct {
+	Tombstones           []*Tombstone `protobuf:"bytes,1,rep,name=tombstones,proto3" json:"tombstones,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}     `json:"-"`
+	XXX_unrecognized     []byte       `json:"-"`
+	XXX_sizecache        int32        `json:"-"`
+}
+
+func (m *Tombstones) Reset()         { *m = Tombstones{} }
+func (m *Tombstones) String() string { return proto.CompactTextString(m) }
+func (*Tombstones) ProtoMessage()    {}
+func (*Tombstones) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{5}
+}
+
+func (m *Tombstones) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Tombstones.Unmarshal(m, b)
+}
+func (m *Tombstones) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Tombstones.Marshal(b, m, deterministic)
+}
+func (m *Tombstones) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Tombstones.Merge(m, src)
+}
+func (m *Tombstones) XXX_Size() int {
+	return xxx_messageInfo_Tombstones.Size(m)
+}
+func (m *Tombstones) XXX_DiscardUnknown() {
+	xxx_messageInfo_Tombstones.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Tombstones proto.InternalMessageInfo
+
+func (m *Tombstones) GetTombstones() []*Tombstone {
+	if m != nil {
+		return m.Tombstones
+	}
+	return nil
+}
+
 type Album struct {
 	ArtistId             string   `protobuf:"bytes,1,opt,name=artist_id,json=artistId,proto3" json:"artist_id,omitempty"`
 	ArtistAlbumId        string   `protobuf:"bytes,2,opt,name=artist_album_id,json=artistAlbumId,proto3" json:"artist_album_id,omitempty"`
 	Title                string   `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
 	ArtistTrackId        []string `protobuf:"bytes,4,rep,name=artist_track_id,json=artistTrackId,proto3" json:"artist_track_id,omitempty"`
+	Price                *Price   `protobuf:"bytes,5,opt,name=price,proto3" json:"price,omitempty"`
+	UpdatedAt            uint64   `protobuf:"varint,6,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	CoverArtMime         string   `protobuf:"bytes,7,opt,name=cover_art_mime,json=coverArtMime,proto3" json:"cover_art_mime,omitempty"`
+	CoverArtSha256       []byte   `protobuf:"bytes,8,opt,name=cover_art_sha256,json=coverArtSha256,proto3" json:"cover_art_sha256,omitempty"`
+	Genres               []string `protobuf:"bytes,9,rep,name=genres,proto3" json:"genres,omitempty"`
+	Year                 uint32   `protobuf:"varint,10,opt,name=year,proto3" json:"year,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -266,7 +462,7 @@ func (m *Album) Reset()         { *m = Album{} }
 func (m *Album) String() string { return proto.CompactTextString(m) }
 func (*Album) ProtoMessage()    {}
 func (*Album) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a83fef21c75be787, []int{4}
+	return fileDescriptor_a83fef21c75be787, []int{6}
 }
 
 func (m *Album) XXX_Unmarshal(b []byte) error {
@@ -315,22 +511,81 @@ func (m *Album) GetArtistTrackId() []string {
 	return nil
 }
 
+func (m *Album) GetPrice() *Price {
+	if m != nil {
+		return m.Price
+	}
+	return nil
+}
+
+func (m *Album) GetUpdatedAt() uint64 {
+	if m != nil {
+		return m.UpdatedAt
+	}
+	return 0
+}
+
+func (m *Album) GetCoverArtMime() string {
+	if m != nil {
+		return m.CoverArtMime
+	}
+	return ""
+}
+
+func (m *Album) GetCoverArtSha256() []byte {
+	if m != nil {
+		return m.CoverArtSha256
+	}
+	return nil
+}
+
+func (m *Album) GetGenres() []string {
+	if m != nil {
+		return m.Genres
+	}
+	return nil
+}
+
+func (m *Album) GetYear() uint32 {
+	if m != nil {
+		return m.Year
+	}
+	return 0
+}
+
 type Track struct {
-	ArtistId             string   `protobuf:"bytes,1,opt,name=artist_id,json=artistId,proto3" json:"artist_id,omitempty"`
-	ArtistAlbumId        string   `protobuf:"bytes,2,opt,name=artist_album_id,json=artistAlbumId,proto3" json:"artist_album_id,omitempty"`
-	ArtistTrackId        string   `protobuf:"bytes,3,opt,name=artist_track_id,json=artistTrackId,proto3" json:"artist_track_id,omitempty"`
-	AlbumTrackNumber     uint32   `protobuf:"varint,4,opt,name=album_track_number,json=albumTrackNumber,proto3" json:"album_track_number,omitempty"`
-	Title                string   `protobuf:"bytes,5,opt,name=title,proto3" json:"title,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	ArtistId             string    `protobuf:"bytes,1,opt,name=artist_id,json=artistId,proto3" json:"artist_id,omitempty"`
+	ArtistAlbumId        string    `protobuf:"bytes,2,opt,name=artist_album_id,json=artistAlbumId,proto3" json:"artist_album_id,omitempty"`
+	ArtistTrackId        string    `protobuf:"bytes,3,opt,name=artist_track_id,json=artistTrackId,proto3" json:"artist_track_id,omitempty"`
+	AlbumTrackNumber     uint32    `protobuf:"varint,4,opt,name=album_track_number,json=albumTrackNumber,proto3" json:"album_track_number,omitempty"`
+	Title                string    `protobuf:"bytes,5,opt,name=title,proto3" json:"title,omitempty"`
+	Container            string    `protobuf:"bytes,6,opt,name=container,proto3" json:"container,omitempty"`
+	Price                *Price    `protobuf:"bytes,7,opt,name=price,proto3" json:"price,omitempty"`
+	EffectivePriceSats   uint64    `protobuf:"varint,8,opt,name=effective_price_sats,json=effectivePriceSats,proto3" json:"effective_price_sats,omitempty"`
+	UpdatedAt            uint64    `protobuf:"varint,9,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	PayloadSha256        []byte    `protobuf:"bytes,10,opt,name=payload_sha256,json=payloadSha256,proto3" json:"payload_sha256,omitempty"`
+	Codec                string    `protobuf:"bytes,11,opt,name=codec,proto3" json:"codec,omitempty"`
+	Loudness             *Loudness `protobuf:"bytes,12,opt,name=loudness,proto3" json:"loudness,omitempty"`
+	OriginalContainer    string    `protobuf:"bytes,13,opt,name=original_container,json=originalContainer,proto3" json:"original_container,omitempty"`
+	OriginalCodec        string    `protobuf:"bytes,14,opt,name=original_codec,json=originalCodec,proto3" json:"original_codec,omitempty"`
+	OriginalSha256       []byte    `protobuf:"bytes,15,opt,name=original_sha256,json=originalSha256,proto3" json:"original_sha256,omitempty"`
+	PayloadCid           string    `protobuf:"bytes,16,opt,name=payload_cid,json=payloadCid,proto3" json:"payload_cid,omitempty"`
+	CreatedAt            uint64    `protobuf:"varint,17,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	PreviewSeconds       uint32    `protobuf:"varint,18,opt,name=preview_seconds,json=previewSeconds,proto3" json:"preview_seconds,omitempty"`
+	PreviewSha256        []byte    `protobuf:"bytes,19,opt,name=preview_sha256,json=previewSha256,proto3" json:"preview_sha256,omitempty"`
+	DurationMs           uint32    `protobuf:"varint,20,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	Genres               []string  `protobuf:"bytes,21,rep,name=genres,proto3" json:"genres,omitempty"`
+	Year                 uint32    `protobuf:"varint,22,opt,name=year,proto3" json:"year,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
 }
 
 func (m *Track) Reset()         { *m = Track{} }
 func (m *Track) String() string { return proto.CompactTextString(m) }
 func (*Track) ProtoMessage()    {}
 func (*Track) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a83fef21c75be787, []int{5}
+	return fileDescriptor_a83fef21c75be787, []int{7}
 }
 
 func (m *Track) XXX_Unmarshal(b []byte) error {
@@ -386,105 +641,1384 @@ func (m *Track) GetTitle() string {
 	return ""
 }
 
-type Peer struct {
-	Pubkey               string   `protobuf:"bytes,1,opt,name=pubkey,proto3" json:"pubkey,omitempty"`
-	Host                 string   `protobuf:"bytes,2,opt,name=host,proto3" json:"host,omitempty"`
-	Port                 uint32   `protobuf:"varint,3,opt,name=port,proto3" json:"port,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+func (m *Track) GetContainer() string {
+	if m != nil {
+		return m.Container
+	}
+	return ""
 }
 
-func (m *Peer) Reset()         { *m = Peer{} }
-func (m *Peer) String() string { return proto.CompactTextString(m) }
-func (*Peer) ProtoMessage()    {}
-func (*Peer) Descriptor() ([]byte, []int) {
-	return fileDescriptor_a83fef21c75be787, []int{6}
+func (m *Track) GetPrice() *Price {
+	if m != nil {
+		return m.Price
+	}
+	return nil
 }
 
-func (m *Peer) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_Peer.Unmarshal(m, b)
+func (m *Track) GetEffectivePriceSats() uint64 {
+	if m != nil {
+		return m.EffectivePriceSats
+	}
+	return 0
 }
-func (m *Peer) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_Peer.Marshal(b, m, deterministic)
+
+func (m *Track) GetUpdatedAt() uint64 {
+	if m != nil {
+		return m.UpdatedAt
+	}
+	return 0
 }
-func (m *Peer) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_Peer.Merge(m, src)
+
+func (m *Track) GetPayloadSha256() []byte {
+	if m != nil {
+		return m.PayloadSha256
+	}
+	return nil
 }
-func (m *Peer) XXX_Size() int {
-	return xxx_messageInfo_Peer.Size(m)
+
+func (m *Track) GetCodec() string {
+	if m != nil {
+		return m.Codec
+	}
+	return ""
 }
-func (m *Peer) XXX_DiscardUnknown() {
-	xxx_messageInfo_Peer.DiscardUnknown(m)
+
+func (m *Track) GetLoudness() *Loudness {
+	if m != nil {
+		return m.Loudness
+	}
+	return nil
 }
 
-var xxx_messageInfo_Peer proto.InternalMessageInfo
+func (m *Track) GetOriginalContainer() string {
+	if m != nil {
+		return m.OriginalContainer
+	}
+	return ""
+}
 
-func (m *Peer) GetPubkey() string {
+func (m *Track) GetOriginalCodec() string {
 	if m != nil {
-		return m.Pubkey
+		return m.OriginalCodec
 	}
 	return ""
 }
 
-func (m *Peer) GetHost() string {
+func (m *Track) GetOriginalSha256() []byte {
 	if m != nil {
-		return m.Host
+		return m.OriginalSha256
+	}
+	return nil
+}
+
+func (m *Track) GetPayloadCid() string {
+	if m != nil {
+		return m.PayloadCid
 	}
 	return ""
 }
 
-func (m *Peer) GetPort() uint32 {
+func (m *Track) GetCreatedAt() uint64 {
 	if m != nil {
-		return m.Port
+		return m.CreatedAt
+	}
+	return 0
+}
+
+func (m *Track) GetPreviewSeconds() uint32 {
+	if m != nil {
+		return m.PreviewSeconds
+	}
+	return 0
+}
+
+func (m *Track) GetPreviewSha256() []byte {
+	if m != nil {
+		return m.PreviewSha256
+	}
+	return nil
+}
+
+func (m *Track) GetDurationMs() uint32 {
+	if m != nil {
+		return m.DurationMs
+	}
+	return 0
+}
+
+func (m *Track) GetGenres() []string {
+	if m != nil {
+		return m.Genres
+	}
+	return nil
+}
+
+func (m *Track) GetYear() uint32 {
+	if m != nil {
+		return m.Year
 	}
 	return 0
 }
 
+type Playlist struct {
+	ArtistId             string            `protobuf:"bytes,1,opt,name=artist_id,json=artistId,proto3" json:"artist_id,omitempty"`
+	ArtistPlaylistId     string            `protobuf:"bytes,2,opt,name=artist_playlist_id,json=artistPlaylistId,proto3" json:"artist_playlist_id,omitempty"`
+	Title                string            `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
+	Tracks               []*TrackReference `protobuf:"bytes,4,rep,name=tracks,proto3" json:"tracks,omitempty"`
+	UpdatedAt            uint64            `protobuf:"varint,5,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *Playlist) Reset()         { *m = Playlist{} }
+func (m *Playlist) String() string { return proto.CompactTextString(m) }
+func (*Playlist) ProtoMessage()    {}
+func (*Playlist) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{8}
+}
+
+func (m *Playlist) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Playlist.Unmarshal(m, b)
+}
+func (m *Playlist) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Playlist.Marshal(b, m, deterministic)
+}
+func (m *Playlist) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Playlist.Merge(m, src)
+}
+func (m *Playlist) XXX_Size() int {
+	return xxx_messageInfo_Playlist.Size(m)
+}
+func (m *Playlist) XXX_DiscardUnknown() {
+	xxx_messageInfo_Playlist.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Playlist proto.InternalMessageInfo
+
+func (m *Playlist) GetArtistId() string {
+	if m != nil {
+		return m.ArtistId
+	}
+	return ""
+}
+
+func (m *Playlist) GetArtistPlaylistId() string {
+	if m != nil {
+		return m.ArtistPlaylistId
+	}
+	return ""
+}
+
+func (m *Playlist) GetTitle() string {
+	if m != nil {
+		return m.Title
+	}
+	return ""
+}
+
+func (m *Playlist) GetTracks() []*TrackReference {
+	if m != nil {
+		return m.Tracks
+	}
+	return nil
+}
+
+func (m *Playlist) GetUpdatedAt() uint64 {
+	if m != nil {
+		return m.UpdatedAt
+	}
+	return 0
+}
+
+type TrackReference struct {
+	ArtistId             string   `protobuf:"bytes,1,opt,name=artist_id,json=artistId,proto3" json:"artist_id,omitempty"`
+	ArtistTrackId        string   `protobuf:"bytes,2,opt,name=artist_track_id,json=artistTrackId,proto3" json:"artist_track_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TrackReference) Reset()         { *m = TrackReference{} }
+func (m *TrackReference) String() string { return proto.CompactTextString(m) }
+func (*TrackReference) ProtoMessage()    {}
+func (*TrackReference) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{9}
+}
+
+func (m *TrackReference) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TrackReference.Unmarshal(m, b)
+}
+func (m *TrackReference) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TrackReference.Marshal(b, m, deterministic)
+}
+func (m *TrackReference) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TrackReference.Merge(m, src)
+}
+func (m *TrackReference) XXX_Size() int {
+	return xxx_messageInfo_TrackReference.Size(m)
+}
+func (m *TrackReference) XXX_DiscardUnknown() {
+	xxx_messageInfo_TrackReference.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TrackReference proto.InternalMessageInfo
+
+func (m *TrackReference) GetArtistId() string {
+	if m != nil {
+		return m.ArtistId
+	}
+	return ""
+}
+
+func (m *TrackReference) GetArtistTrackId() string {
+	if m != nil {
+		return m.ArtistTrackId
+	}
+	return ""
+}
+
+type Price struct {
+	Sats                 uint64   `protobuf:"varint,1,opt,name=sats,proto3" json:"sats,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Price) Reset()         { *m = Price{} }
+func (m *Price) String() string { return proto.CompactTextString(m) }
+func (*Price) ProtoMessage()    {}
+func (*Price) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{10}
+}
+
+func (m *Price) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Price.Unmarshal(m, b)
+}
+func (m *Price) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Price.Marshal(b, m, deterministic)
+}
+func (m *Price) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Price.Merge(m, src)
+}
+func (m *Price) XXX_Size() int {
+	return xxx_messageInfo_Price.Size(m)
+}
+func (m *Price) XXX_DiscardUnknown() {
+	xxx_messageInfo_Price.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Price proto.InternalMessageInfo
+
+func (m *Price) GetSats() uint64 {
+	if m != nil {
+		return m.Sats
+	}
+	return 0
+}
+
+type Loudness struct {
+	IntegratedLufs       float64  `protobuf:"fixed64,1,opt,name=integrated_lufs,json=integratedLufs,proto3" json:"integrated_lufs,omitempty"`
+	SamplePeak           float64  `protobuf:"fixed64,2,opt,name=sample_peak,json=samplePeak,proto3" json:"sample_peak,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Loudness) Reset()         { *m = Loudness{} }
+func (m *Loudness) String() string { return proto.CompactTextString(m) }
+func (*Loudness) ProtoMessage()    {}
+func (*Loudness) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{11}
+}
+
+func (m *Loudness) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Loudness.Unmarshal(m, b)
+}
+func (m *Loudness) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Loudness.Marshal(b, m, deterministic)
+}
+func (m *Loudness) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Loudness.Merge(m, src)
+}
+func (m *Loudness) XXX_Size() int {
+	return xxx_messageInfo_Loudness.Size(m)
+}
+func (m *Loudness) XXX_DiscardUnknown() {
+	xxx_messageInfo_Loudness.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Loudness proto.InternalMessageInfo
+
+func (m *Loudness) GetIntegratedLufs() float64 {
+	if m != nil {
+		return m.IntegratedLufs
+	}
+	return 0
+}
+
+func (m *Loudness) GetSamplePeak() float64 {
+	if m != nil {
+		return m.SamplePeak
+	}
+	return 0
+}
+
+type Invoice struct {
+	ArtistId             string   `protobuf:"bytes,1,opt,name=artist_id,json=artistId,proto3" json:"artist_id,omitempty"`
+	ArtistTrackId        string   `protobuf:"bytes,2,opt,name=artist_track_id,json=artistTrackId,proto3" json:"artist_track_id,omitempty"`
+	PaymentRequest       string   `protobuf:"bytes,3,opt,name=payment_request,json=paymentRequest,proto3" json:"payment_request,omitempty"`
+	InvoiceHash          []byte   `protobuf:"bytes,4,opt,name=invoice_hash,json=invoiceHash,proto3" json:"invoice_hash,omitempty"`
+	Sats                 uint64   `protobuf:"varint,5,opt,name=sats,proto3" json:"sats,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Invoice) Reset()         { *m = Invoice{} }
+func (m *Invoice) String() string { return proto.CompactTextString(m) }
+func (*Invoice) ProtoMessage()    {}
+func (*Invoice) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{12}
+}
+
+func (m *Invoice) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Invoice.Unmarshal(m, b)
+}
+func (m *Invoice) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Invoice.Marshal(b, m, deterministic)
+}
+func (m *Invoice) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Invoice.Merge(m, src)
+}
+func (m *Invoice) XXX_Size() int {
+	return xxx_messageInfo_Invoice.Size(m)
+}
+func (m *Invoice) XXX_DiscardUnknown() {
+	xxx_messageInfo_Invoice.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Invoice proto.InternalMessageInfo
+
+func (m *Invoice) GetArtistId() string {
+	if m != nil {
+		return m.ArtistId
+	}
+	return ""
+}
+
+func (m *Invoice) GetArtistTrackId() string {
+	if m != nil {
+		return m.ArtistTrackId
+	}
+	return ""
+}
+
+func (m *Invoice) GetPaymentRequest() string {
+	if m != nil {
+		return m.PaymentRequest
+	}
+	return ""
+}
+
+func (m *Invoice) GetInvoiceHash() []byte {
+	if m != nil {
+		return m.InvoiceHash
+	}
+	return nil
+}
+
+func (m *Invoice) GetSats() uint64 {
+	if m != nil {
+		return m.Sats
+	}
+	return 0
+}
+
+type AlbumInvoice struct {
+	ArtistId             string   `protobuf:"bytes,1,opt,name=artist_id,json=artistId,proto3" json:"artist_id,omitempty"`
+	ArtistAlbumId        string   `protobuf:"bytes,2,opt,name=artist_album_id,json=artistAlbumId,proto3" json:"artist_album_id,omitempty"`
+	Invoice              *Invoice `protobuf:"bytes,3,opt,name=invoice,proto3" json:"invoice,omitempty"`
+	ArtistTrackId        []string `protobuf:"bytes,4,rep,name=artist_track_id,json=artistTrackId,proto3" json:"artist_track_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AlbumInvoice) Reset()         { *m = AlbumInvoice{} }
+func (m *AlbumInvoice) String() string { return proto.CompactTextString(m) }
+func (*AlbumInvoice) ProtoMessage()    {}
+func (*AlbumInvoice) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{13}
+}
+
+func (m *AlbumInvoice) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AlbumInvoice.Unmarshal(m, b)
+}
+func (m *AlbumInvoice) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AlbumInvoice.Marshal(b, m, deterministic)
+}
+func (m *AlbumInvoice) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AlbumInvoice.Merge(m, src)
+}
+func (m *AlbumInvoice) XXX_Size() int {
+	return xxx_messageInfo_AlbumInvoice.Size(m)
+}
+func (m *AlbumInvoice) XXX_DiscardUnknown() {
+	xxx_messageInfo_AlbumInvoice.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AlbumInvoice proto.InternalMessageInfo
+
+func (m *AlbumInvoice) GetArtistId() string {
+	if m != nil {
+		return m.ArtistId
+	}
+	return ""
+}
+
+func (m *AlbumInvoice) GetArtistAlbumId() string {
+	if m != nil {
+		return m.ArtistAlbumId
+	}
+	return ""
+}
+
+func (m *AlbumInvoice) GetInvoice() *Invoice {
+	if m != nil {
+		return m.Invoice
+	}
+	return nil
+}
+
+func (m *AlbumInvoice) GetArtistTrackId() []string {
+	if m != nil {
+		return m.ArtistTrackId
+	}
+	return nil
+}
+
+type StreamInvoice struct {
+	StreamId             string   `protobuf:"bytes,1,opt,name=stream_id,json=streamId,proto3" json:"stream_id,omitempty"`
+	Invoice              *Invoice `protobuf:"bytes,2,opt,name=invoice,proto3" json:"invoice,omitempty"`
+	Offset               uint64   `protobuf:"varint,3,opt,name=offset,proto3" json:"offset,omitempty"`
+	Length               uint64   `protobuf:"varint,4,opt,name=length,proto3" json:"length,omitempty"`
+	TotalBytes           uint64   `protobuf:"varint,5,opt,name=total_bytes,json=totalBytes,proto3" json:"total_bytes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StreamInvoice) Reset()         { *m = StreamInvoice{} }
+func (m *StreamInvoice) String() string { return proto.CompactTextString(m) }
+func (*StreamInvoice) ProtoMessage()    {}
+func (*StreamInvoice) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{14}
+}
+
+func (m *StreamInvoice) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StreamInvoice.Unmarshal(m, b)
+}
+func (m *StreamInvoice) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StreamInvoice.Marshal(b, m, deterministic)
+}
+func (m *StreamInvoice) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StreamInvoice.Merge(m, src)
+}
+func (m *StreamInvoice) XXX_Size() int {
+	return xxx_messageInfo_StreamInvoice.Size(m)
+}
+func (m *StreamInvoice) XXX_DiscardUnknown() {
+	xxx_messageInfo_StreamInvoice.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StreamInvoice proto.InternalMessageInfo
+
+func (m *StreamInvoice) GetStreamId() string {
+	if m != nil {
+		return m.StreamId
+	}
+	return ""
+}
+
+func (m *StreamInvoice) GetInvoice() *Invoice {
+	if m != nil {
+		return m.Invoice
+	}
+	return nil
+}
+
+func (m *StreamInvoice) GetOffset() uint64 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+func (m *StreamInvoice) GetLength() uint64 {
+	if m != nil {
+		return m.Length
+	}
+	return 0
+}
+
+func (m *StreamInvoice) GetTotalBytes() uint64 {
+	if m != nil {
+		return m.TotalBytes
+	}
+	return 0
+}
+
+type Peer struct {
+	Pubkey               string   `protobuf:"bytes,1,opt,name=pubkey,proto3" json:"pubkey,omitempty"`
+	Host                 string   `protobuf:"bytes,2,opt,name=host,proto3" json:"host,omitempty"`
+	Port                 uint32   `protobuf:"varint,3,opt,name=port,proto3" json:"port,omitempty"`
+	UpdatedAt            uint64   `protobuf:"varint,4,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Peer) Reset()         { *m = Peer{} }
+func (m *Peer) String() string { return proto.CompactTextString(m) }
+func (*Peer) ProtoMessage()    {}
+func (*Peer) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{15}
+}
+
+func (m *Peer) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Peer.Unmarshal(m, b)
+}
+func (m *Peer) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Peer.Marshal(b, m, deterministic)
+}
+func (m *Peer) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Peer.Merge(m, src)
+}
+func (m *Peer) XXX_Size() int {
+	return xxx_messageInfo_Peer.Size(m)
+}
+func (m *Peer) XXX_DiscardUnknown() {
+	xxx_messageInfo_Peer.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Peer proto.InternalMessageInfo
+
+func (m *Peer) GetPubkey() string {
+	if m != nil {
+		return m.Pubkey
+	}
+	return ""
+}
+
+func (m *Peer) GetHost() string {
+	if m != nil {
+		return m.Host
+	}
+	return ""
+}
+
+func (m *Peer) GetPort() uint32 {
+	if m != nil {
+		return m.Port
+	}
+	return 0
+}
+
+func (m *Peer) GetUpdatedAt() uint64 {
+	if m != nil {
+		return m.UpdatedAt
+	}
+	return 0
+}
+
+type SyncCursor struct {
+	Pubkey               string   `protobuf:"bytes,1,opt,name=pubkey,proto3" json:"pubkey,omitempty"`
+	AsOf                 uint64   `protobuf:"varint,2,opt,name=as_of,json=asOf,proto3" json:"as_of,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SyncCursor) Reset()         { *m = SyncCursor{} }
+func (m *SyncCursor) String() string { return proto.CompactTextString(m) }
+func (*SyncCursor) ProtoMessage()    {}
+func (*SyncCursor) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{16}
+}
+
+func (m *SyncCursor) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SyncCursor.Unmarshal(m, b)
+}
+func (m *SyncCursor) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SyncCursor.Marshal(b, m, deterministic)
+}
+func (m *SyncCursor) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SyncCursor.Merge(m, src)
+}
+func (m *SyncCursor) XXX_Size() int {
+	return xxx_messageInfo_SyncCursor.Size(m)
+}
+func (m *SyncCursor) XXX_DiscardUnknown() {
+	xxx_messageInfo_SyncCursor.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SyncCursor proto.InternalMessageInfo
+
+func (m *SyncCursor) GetPubkey() string {
+	if m != nil {
+		return m.Pubkey
+	}
+	return ""
+}
+
+func (m *SyncCursor) GetAsOf() uint64 {
+	if m != nil {
+		return m.AsOf
+	}
+	return 0
+}
+
+type SyncCursors struct {
+	SyncCursors          []*SyncCursor `protobuf:"bytes,1,rep,name=sync_cursors,json=syncCursors,proto3" json:"sync_cursors,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *SyncCursors) Reset()         { *m = SyncCursors{} }
+func (m *SyncCursors) String() string { return proto.CompactTextString(m) }
+func (*SyncCursors) ProtoMessage()    {}
+func (*SyncCursors) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{17}
+}
+
+func (m *SyncCursors) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SyncCursors.Unmarshal(m, b)
+}
+func (m *SyncCursors) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SyncCursors.Marshal(b, m, deterministic)
+}
+func (m *SyncCursors) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SyncCursors.Merge(m, src)
+}
+func (m *SyncCursors) XXX_Size() int {
+	return xxx_messageInfo_SyncCursors.Size(m)
+}
+func (m *SyncCursors) XXX_DiscardUnknown() {
+	xxx_messageInfo_SyncCursors.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SyncCursors proto.InternalMessageInfo
+
+func (m *SyncCursors) GetSyncCursors() []*SyncCursor {
+	if m != nil {
+		return m.SyncCursors
+	}
+	return nil
+}
+
+type PublicationSequence struct {
+	Pubkey               string   `protobuf:"bytes,1,opt,name=pubkey,proto3" json:"pubkey,omitempty"`
+	Sequence             uint64   `protobuf:"varint,2,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PublicationSequence) Reset()         { *m = PublicationSequence{} }
+func (m *PublicationSequence) String() string { return proto.CompactTextString(m) }
+func (*PublicationSequence) ProtoMessage()    {}
+func (*PublicationSequence) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{18}
+}
+
+func (m *PublicationSequence) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PublicationSequence.Unmarshal(m, b)
+}
+func (m *PublicationSequence) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PublicationSequence.Marshal(b, m, deterministic)
+}
+func (m *PublicationSequence) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PublicationSequence.Merge(m, src)
+}
+func (m *PublicationSequence) XXX_Size() int {
+	return xxx_messageInfo_PublicationSequence.Size(m)
+}
+func (m *PublicationSequence) XXX_DiscardUnknown() {
+	xxx_messageInfo_PublicationSequence.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PublicationSequence proto.InternalMessageInfo
+
+func (m *PublicationSequence) GetPubkey() string {
+	if m != nil {
+		return m.Pubkey
+	}
+	return ""
+}
+
+func (m *PublicationSequence) GetSequence() uint64 {
+	if m != nil {
+		return m.Sequence
+	}
+	return 0
+}
+
+type PublicationSequences struct {
+	PublicationSequences []*PublicationSequence `protobuf:"bytes,1,rep,name=publication_sequences,json=publicationSequences,proto3" json:"publication_sequences,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}               `json:"-"`
+	XXX_unrecognized     []byte                 `json:"-"`
+	XXX_sizecache        int32                  `json:"-"`
+}
+
+func (m *PublicationSequences) Reset()         { *m = PublicationSequences{} }
+func (m *PublicationSequences) String() string { return proto.CompactTextString(m) }
+func (*PublicationSequences) ProtoMessage()    {}
+func (*PublicationSequences) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{19}
+}
+
+func (m *PublicationSequences) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PublicationSequences.Unmarshal(m, b)
+}
+func (m *PublicationSequences) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PublicationSequences.Marshal(b, m, deterministic)
+}
+func (m *PublicationSequences) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PublicationSequences.Merge(m, src)
+}
+func (m *PublicationSequences) XXX_Size() int {
+	return xxx_messageInfo_PublicationSequences.Size(m)
+}
+func (m *PublicationSequences) XXX_DiscardUnknown() {
+	xxx_messageInfo_PublicationSequences.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PublicationSequences proto.InternalMessageInfo
+
+func (m *PublicationSequences) GetPublicationSequences() []*PublicationSequence {
+	if m != nil {
+		return m.PublicationSequences
+	}
+	return nil
+}
+
+type PeerReputation struct {
+	Pubkey               string   `protobuf:"bytes,1,opt,name=pubkey,proto3" json:"pubkey,omitempty"`
+	FailureCount         uint32   `protobuf:"varint,2,opt,name=failure_count,json=failureCount,proto3" json:"failure_count,omitempty"`
+	LastFailureAt        uint64   `protobuf:"varint,3,opt,name=last_failure_at,json=lastFailureAt,proto3" json:"last_failure_at,omitempty"`
+	LastFailureReason    string   `protobuf:"bytes,4,opt,name=last_failure_reason,json=lastFailureReason,proto3" json:"last_failure_reason,omitempty"`
+	LastSeenAt           uint64   `protobuf:"varint,5,opt,name=last_seen_at,json=lastSeenAt,proto3" json:"last_seen_at,omitempty"`
+	LastReachableAt      uint64   `protobuf:"varint,6,opt,name=last_reachable_at,json=lastReachableAt,proto3" json:"last_reachable_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PeerReputation) Reset()         { *m = PeerReputation{} }
+func (m *PeerReputation) String() string { return proto.CompactTextString(m) }
+func (*PeerReputation) ProtoMessage()    {}
+func (*PeerReputation) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{20}
+}
+
+func (m *PeerReputation) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PeerReputation.Unmarshal(m, b)
+}
+func (m *PeerReputation) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PeerReputation.Marshal(b, m, deterministic)
+}
+func (m *PeerReputation) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PeerReputation.Merge(m, src)
+}
+func (m *PeerReputation) XXX_Size() int {
+	return xxx_messageInfo_PeerReputation.Size(m)
+}
+func (m *PeerReputation) XXX_DiscardUnknown() {
+	xxx_messageInfo_PeerReputation.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PeerReputation proto.InternalMessageInfo
+
+func (m *PeerReputation) GetPubkey() string {
+	if m != nil {
+		return m.Pubkey
+	}
+	return ""
+}
+
+func (m *PeerReputation) GetFailureCount() uint32 {
+	if m != nil {
+		return m.FailureCount
+	}
+	return 0
+}
+
+func (m *PeerReputation) GetLastFailureAt() uint64 {
+	if m != nil {
+		return m.LastFailureAt
+	}
+	return 0
+}
+
+func (m *PeerReputation) GetLastFailureReason() string {
+	if m != nil {
+		return m.LastFailureReason
+	}
+	return ""
+}
+
+func (m *PeerReputation) GetLastSeenAt() uint64 {
+	if m != nil {
+		return m.LastSeenAt
+	}
+	return 0
+}
+
+func (m *PeerReputation) GetLastReachableAt() uint64 {
+	if m != nil {
+		return m.LastReachableAt
+	}
+	return 0
+}
+
+type PeerReputations struct {
+	PeerReputations      []*PeerReputation `protobuf:"bytes,1,rep,name=peer_reputations,json=peerReputations,proto3" json:"peer_reputations,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *PeerReputations) Reset()         { *m = PeerReputations{} }
+func (m *PeerReputations) String() string { return proto.CompactTextString(m) }
+func (*PeerReputations) ProtoMessage()    {}
+func (*PeerReputations) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{21}
+}
+
+func (m *PeerReputations) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PeerReputations.Unmarshal(m, b)
+}
+func (m *PeerReputations) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PeerReputations.Marshal(b, m, deterministic)
+}
+func (m *PeerReputations) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PeerReputations.Merge(m, src)
+}
+func (m *PeerReputations) XXX_Size() int {
+	return xxx_messageInfo_PeerReputations.Size(m)
+}
+func (m *PeerReputations) XXX_DiscardUnknown() {
+	xxx_messageInfo_PeerReputations.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PeerReputations proto.InternalMessageInfo
+
+func (m *PeerReputations) GetPeerReputations() []*PeerReputation {
+	if m != nil {
+		return m.PeerReputations
+	}
+	return nil
+}
+
+type PeerBandwidth struct {
+	Pubkey               string            `protobuf:"bytes,1,opt,name=pubkey,proto3" json:"pubkey,omitempty"`
+	TotalBytes           uint64            `protobuf:"varint,2,opt,name=total_bytes,json=totalBytes,proto3" json:"total_bytes,omitempty"`
+	Days                 []*DailyBandwidth `protobuf:"bytes,3,rep,name=days,proto3" json:"days,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *PeerBandwidth) Reset()         { *m = PeerBandwidth{} }
+func (m *PeerBandwidth) String() string { return proto.CompactTextString(m) }
+func (*PeerBandwidth) ProtoMessage()    {}
+func (*PeerBandwidth) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{22}
+}
+
+func (m *PeerBandwidth) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PeerBandwidth.Unmarshal(m, b)
+}
+func (m *PeerBandwidth) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PeerBandwidth.Marshal(b, m, deterministic)
+}
+func (m *PeerBandwidth) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PeerBandwidth.Merge(m, src)
+}
+func (m *PeerBandwidth) XXX_Size() int {
+	return xxx_messageInfo_PeerBandwidth.Size(m)
+}
+func (m *PeerBandwidth) XXX_DiscardUnknown() {
+	xxx_messageInfo_PeerBandwidth.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PeerBandwidth proto.InternalMessageInfo
+
+func (m *PeerBandwidth) GetPubkey() string {
+	if m != nil {
+		return m.Pubkey
+	}
+	return ""
+}
+
+func (m *PeerBandwidth) GetTotalBytes() uint64 {
+	if m != nil {
+		return m.TotalBytes
+	}
+	return 0
+}
+
+func (m *PeerBandwidth) GetDays() []*DailyBandwidth {
+	if m != nil {
+		return m.Days
+	}
+	return nil
+}
+
+type DailyBandwidth struct {
+	Day                  uint64   `protobuf:"varint,1,opt,name=day,proto3" json:"day,omitempty"`
+	Bytes                uint64   `protobuf:"varint,2,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DailyBandwidth) Reset()         { *m = DailyBandwidth{} }
+func (m *DailyBandwidth) String() string { return proto.CompactTextString(m) }
+func (*DailyBandwidth) ProtoMessage()    {}
+func (*DailyBandwidth) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{23}
+}
+
+func (m *DailyBandwidth) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DailyBandwidth.Unmarshal(m, b)
+}
+func (m *DailyBandwidth) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DailyBandwidth.Marshal(b, m, deterministic)
+}
+func (m *DailyBandwidth) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DailyBandwidth.Merge(m, src)
+}
+func (m *DailyBandwidth) XXX_Size() int {
+	return xxx_messageInfo_DailyBandwidth.Size(m)
+}
+func (m *DailyBandwidth) XXX_DiscardUnknown() {
+	xxx_messageInfo_DailyBandwidth.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DailyBandwidth proto.InternalMessageInfo
+
+func (m *DailyBandwidth) GetDay() uint64 {
+	if m != nil {
+		return m.Day
+	}
+	return 0
+}
+
+func (m *DailyBandwidth) GetBytes() uint64 {
+	if m != nil {
+		return m.Bytes
+	}
+	return 0
+}
+
+type PeerBandwidths struct {
+	PeerBandwidths       []*PeerBandwidth `protobuf:"bytes,1,rep,name=peer_bandwidths,json=peerBandwidths,proto3" json:"peer_bandwidths,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
+}
+
+func (m *PeerBandwidths) Reset()         { *m = PeerBandwidths{} }
+func (m *PeerBandwidths) String() string { return proto.CompactTextString(m) }
+func (*PeerBandwidths) ProtoMessage()    {}
+func (*PeerBandwidths) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{24}
+}
+
+func (m *PeerBandwidths) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PeerBandwidths.Unmarshal(m, b)
+}
+func (m *PeerBandwidths) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PeerBandwidths.Marshal(b, m, deterministic)
+}
+func (m *PeerBandwidths) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PeerBandwidths.Merge(m, src)
+}
+func (m *PeerBandwidths) XXX_Size() int {
+	return xxx_messageInfo_PeerBandwidths.Size(m)
+}
+func (m *PeerBandwidths) XXX_DiscardUnknown() {
+	xxx_messageInfo_PeerBandwidths.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PeerBandwidths proto.InternalMessageInfo
+
+func (m *PeerBandwidths) GetPeerBandwidths() []*PeerBandwidth {
+	if m != nil {
+		return m.PeerBandwidths
+	}
+	return nil
+}
+
+type TrackStats struct {
+	ArtistId             string   `protobuf:"bytes,1,opt,name=artist_id,json=artistId,proto3" json:"artist_id,omitempty"`
+	ArtistTrackId        string   `protobuf:"bytes,2,opt,name=artist_track_id,json=artistTrackId,proto3" json:"artist_track_id,omitempty"`
+	Plays                uint64   `protobuf:"varint,3,opt,name=plays,proto3" json:"plays,omitempty"`
+	Purchases            uint64   `protobuf:"varint,4,opt,name=purchases,proto3" json:"purchases,omitempty"`
+	LastPlayedAt         uint64   `protobuf:"varint,5,opt,name=last_played_at,json=lastPlayedAt,proto3" json:"last_played_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *TrackStats) Reset()         { *m = TrackStats{} }
+func (m *TrackStats) String() string { return proto.CompactTextString(m) }
+func (*TrackStats) ProtoMessage()    {}
+func (*TrackStats) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{25}
+}
+
+func (m *TrackStats) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TrackStats.Unmarshal(m, b)
+}
+func (m *TrackStats) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TrackStats.Marshal(b, m, deterministic)
+}
+func (m *TrackStats) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TrackStats.Merge(m, src)
+}
+func (m *TrackStats) XXX_Size() int {
+	return xxx_messageInfo_TrackStats.Size(m)
+}
+func (m *TrackStats) XXX_DiscardUnknown() {
+	xxx_messageInfo_TrackStats.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TrackStats proto.InternalMessageInfo
+
+func (m *TrackStats) GetArtistId() string {
+	if m != nil {
+		return m.ArtistId
+	}
+	return ""
+}
+
+func (m *TrackStats) GetArtistTrackId() string {
+	if m != nil {
+		return m.ArtistTrackId
+	}
+	return ""
+}
+
+func (m *TrackStats) GetPlays() uint64 {
+	if m != nil {
+		return m.Plays
+	}
+	return 0
+}
+
+func (m *TrackStats) GetPurchases() uint64 {
+	if m != nil {
+		return m.Purchases
+	}
+	return 0
+}
+
+func (m *TrackStats) GetLastPlayedAt() uint64 {
+	if m != nil {
+		return m.LastPlayedAt
+	}
+	return 0
+}
+
+type TrackStatsList struct {
+	TrackStats           []*TrackStats `protobuf:"bytes,1,rep,name=track_stats,json=trackStats,proto3" json:"track_stats,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *TrackStatsList) Reset()         { *m = TrackStatsList{} }
+func (m *TrackStatsList) String() string { return proto.CompactTextString(m) }
+func (*TrackStatsList) ProtoMessage()    {}
+func (*TrackStatsList) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{26}
+}
+
+func (m *TrackStatsList) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TrackStatsList.Unmarshal(m, b)
+}
+func (m *TrackStatsList) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TrackStatsList.Marshal(b, m, deterministic)
+}
+func (m *TrackStatsList) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TrackStatsList.Merge(m, src)
+}
+func (m *TrackStatsList) XXX_Size() int {
+	return xxx_messageInfo_TrackStatsList.Size(m)
+}
+func (m *TrackStatsList) XXX_DiscardUnknown() {
+	xxx_messageInfo_TrackStatsList.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TrackStatsList proto.InternalMessageInfo
+
+func (m *TrackStatsList) GetTrackStats() []*TrackStats {
+	if m != nil {
+		return m.TrackStats
+	}
+	return nil
+}
+
+type IssuedInvoice struct {
+	InvoiceHash          []byte            `protobuf:"bytes,1,opt,name=invoice_hash,json=invoiceHash,proto3" json:"invoice_hash,omitempty"`
+	Tracks               []*TrackReference `protobuf:"bytes,2,rep,name=tracks,proto3" json:"tracks,omitempty"`
+	ExpiresAt            uint64            `protobuf:"varint,3,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	SettledAt            uint64            `protobuf:"varint,4,opt,name=settled_at,json=settledAt,proto3" json:"settled_at,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *IssuedInvoice) Reset()         { *m = IssuedInvoice{} }
+func (m *IssuedInvoice) String() string { return proto.CompactTextString(m) }
+func (*IssuedInvoice) ProtoMessage()    {}
+func (*IssuedInvoice) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{27}
+}
+
+func (m *IssuedInvoice) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_IssuedInvoice.Unmarshal(m, b)
+}
+func (m *IssuedInvoice) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_IssuedInvoice.Marshal(b, m, deterministic)
+}
+func (m *IssuedInvoice) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_IssuedInvoice.Merge(m, src)
+}
+func (m *IssuedInvoice) XXX_Size() int {
+	return xxx_messageInfo_IssuedInvoice.Size(m)
+}
+func (m *IssuedInvoice) XXX_DiscardUnknown() {
+	xxx_messageInfo_IssuedInvoice.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_IssuedInvoice proto.InternalMessageInfo
+
+func (m *IssuedInvoice) GetInvoiceHash() []byte {
+	if m != nil {
+		return m.InvoiceHash
+	}
+	return nil
+}
+
+func (m *IssuedInvoice) GetTracks() []*TrackReference {
+	if m != nil {
+		return m.Tracks
+	}
+	return nil
+}
+
+func (m *IssuedInvoice) GetExpiresAt() uint64 {
+	if m != nil {
+		return m.ExpiresAt
+	}
+	return 0
+}
+
+func (m *IssuedInvoice) GetSettledAt() uint64 {
+	if m != nil {
+		return m.SettledAt
+	}
+	return 0
+}
+
+type IssuedInvoices struct {
+	IssuedInvoices       []*IssuedInvoice `protobuf:"bytes,1,rep,name=issued_invoices,json=issuedInvoices,proto3" json:"issued_invoices,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
+}
+
+func (m *IssuedInvoices) Reset()         { *m = IssuedInvoices{} }
+func (m *IssuedInvoices) String() string { return proto.CompactTextString(m) }
+func (*IssuedInvoices) ProtoMessage()    {}
+func (*IssuedInvoices) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a83fef21c75be787, []int{28}
+}
+
+func (m *IssuedInvoices) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_IssuedInvoices.Unmarshal(m, b)
+}
+func (m *IssuedInvoices) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_IssuedInvoices.Marshal(b, m, deterministic)
+}
+func (m *IssuedInvoices) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_IssuedInvoices.Merge(m, src)
+}
+func (m *IssuedInvoices) XXX_Size() int {
+	return xxx_messageInfo_IssuedInvoices.Size(m)
+}
+func (m *IssuedInvoices) XXX_DiscardUnknown() {
+	xxx_messageInfo_IssuedInvoices.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_IssuedInvoices proto.InternalMessageInfo
+
+func (m *IssuedInvoices) GetIssuedInvoices() []*IssuedInvoice {
+	if m != nil {
+		return m.IssuedInvoices
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*ArtRequest)(nil), "net.audiostrike.art.ArtRequest")
 	proto.RegisterType((*Artist)(nil), "net.audiostrike.art.Artist")
 	proto.RegisterType((*ArtistPublication)(nil), "net.audiostrike.art.ArtistPublication")
 	proto.RegisterType((*ArtResources)(nil), "net.audiostrike.art.ArtResources")
+	proto.RegisterType((*Tombstone)(nil), "net.audiostrike.art.Tombstone")
+	proto.RegisterType((*Tombstones)(nil), "net.audiostrike.art.Tombstones")
 	proto.RegisterType((*Album)(nil), "net.audiostrike.art.Album")
 	proto.RegisterType((*Track)(nil), "net.audiostrike.art.Track")
+	proto.RegisterType((*Playlist)(nil), "net.audiostrike.art.Playlist")
+	proto.RegisterType((*TrackReference)(nil), "net.audiostrike.art.TrackReference")
+	proto.RegisterType((*Price)(nil), "net.audiostrike.art.Price")
+	proto.RegisterType((*Loudness)(nil), "net.audiostrike.art.Loudness")
+	proto.RegisterType((*Invoice)(nil), "net.audiostrike.art.Invoice")
+	proto.RegisterType((*AlbumInvoice)(nil), "net.audiostrike.art.AlbumInvoice")
+	proto.RegisterType((*StreamInvoice)(nil), "net.audiostrike.art.StreamInvoice")
 	proto.RegisterType((*Peer)(nil), "net.audiostrike.art.Peer")
+	proto.RegisterType((*SyncCursor)(nil), "net.audiostrike.art.SyncCursor")
+	proto.RegisterType((*SyncCursors)(nil), "net.audiostrike.art.SyncCursors")
+	proto.RegisterType((*PublicationSequence)(nil), "net.audiostrike.art.PublicationSequence")
+	proto.RegisterType((*PublicationSequences)(nil), "net.audiostrike.art.PublicationSequences")
+	proto.RegisterType((*PeerReputation)(nil), "net.audiostrike.art.PeerReputation")
+	proto.RegisterType((*PeerReputations)(nil), "net.audiostrike.art.PeerReputations")
+	proto.RegisterType((*PeerBandwidth)(nil), "net.audiostrike.art.PeerBandwidth")
+	proto.RegisterType((*DailyBandwidth)(nil), "net.audiostrike.art.DailyBandwidth")
+	proto.RegisterType((*PeerBandwidths)(nil), "net.audiostrike.art.PeerBandwidths")
+	proto.RegisterType((*TrackStats)(nil), "net.audiostrike.art.TrackStats")
+	proto.RegisterType((*TrackStatsList)(nil), "net.audiostrike.art.TrackStatsList")
+	proto.RegisterType((*IssuedInvoice)(nil), "net.audiostrike.art.IssuedInvoice")
+	proto.RegisterType((*IssuedInvoices)(nil), "net.audiostrike.art.IssuedInvoices")
 }
 
 func init() { proto.RegisterFile("pkg/art/art.proto", fileDescriptor_a83fef21c75be787) }
 
 var fileDescriptor_a83fef21c75be787 = []byte{
-	// 477 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x54, 0xc1, 0x6e, 0xd3, 0x4c,
-	0x10, 0xfe, 0xb7, 0xb1, 0xfd, 0x93, 0xa1, 0x11, 0x74, 0x41, 0x95, 0x69, 0x91, 0x88, 0x7c, 0xa8,
-	0x72, 0x40, 0xae, 0x94, 0x0a, 0x89, 0x6b, 0x2e, 0xa0, 0x5e, 0x50, 0x59, 0x38, 0x71, 0x89, 0xd6,
-	0xf1, 0x28, 0xac, 0x92, 0xd8, 0x66, 0x77, 0x7c, 0x80, 0x47, 0xe0, 0x29, 0x78, 0x0c, 0x9e, 0x86,
-	0x67, 0x41, 0x3b, 0xeb, 0x28, 0x16, 0xb8, 0x85, 0x03, 0x87, 0x48, 0xb3, 0x33, 0xdf, 0x7c, 0xf3,
-	0xad, 0xf7, 0x9b, 0xc0, 0x49, 0xb3, 0x59, 0x5f, 0x6a, 0x4b, 0xfe, 0x97, 0x37, 0xb6, 0xa6, 0x5a,
-	0x3e, 0xaa, 0x90, 0x72, 0xdd, 0x96, 0xa6, 0x76, 0x64, 0xcd, 0x06, 0x73, 0x6d, 0x29, 0x5b, 0x03,
-	0x2c, 0x2c, 0x29, 0xfc, 0xd4, 0xa2, 0x23, 0x79, 0x0e, 0x63, 0x6d, 0xc9, 0x38, 0x5a, 0x9a, 0x32,
-	0x15, 0x53, 0x31, 0x1b, 0xab, 0x7b, 0x21, 0x71, 0x5d, 0xca, 0x0b, 0x78, 0xd0, 0x15, 0xc9, 0xea,
-	0xd5, 0xc6, 0x43, 0x8e, 0x18, 0x32, 0x09, 0xe9, 0xf7, 0x3e, 0x7b, 0x5d, 0xca, 0xc7, 0x10, 0x3b,
-	0x53, 0xad, 0x30, 0x1d, 0x4d, 0xc5, 0x2c, 0x52, 0xe1, 0x90, 0xbd, 0x85, 0x64, 0xc1, 0xb0, 0xbb,
-	0x87, 0x48, 0x88, 0x2a, 0xbd, 0xc3, 0x8e, 0x99, 0x63, 0x79, 0x0a, 0x49, 0xd3, 0x16, 0x1b, 0xfc,
-	0xcc, 0x8c, 0x63, 0xd5, 0x9d, 0xb2, 0x6f, 0x02, 0x4e, 0x02, 0xe7, 0x4d, 0x5b, 0x6c, 0xcd, 0x4a,
-	0x93, 0xa9, 0x2b, 0x79, 0x05, 0x49, 0x60, 0x63, 0xee, 0xfb, 0xf3, 0xf3, 0x7c, 0xe0, 0xde, 0x79,
-	0xe8, 0x53, 0x1d, 0x54, 0x3e, 0x85, 0xb1, 0x33, 0xeb, 0x4a, 0x53, 0x6b, 0xf7, 0xb3, 0x0f, 0x09,
-	0xf9, 0x12, 0x52, 0x87, 0xd6, 0xe8, 0xad, 0xf9, 0x82, 0xe5, 0x52, 0x5b, 0x5a, 0x5a, 0x74, 0x75,
-	0x6b, 0x57, 0xe8, 0x58, 0xd2, 0xb1, 0x3a, 0x3d, 0xd4, 0xf9, 0x73, 0x76, 0xd5, 0xec, 0x87, 0x80,
-	0xe3, 0x7e, 0x42, 0xbe, 0x80, 0xff, 0xc3, 0x48, 0x97, 0x8a, 0xe9, 0xe8, 0x4f, 0xf2, 0xf6, 0x58,
-	0x39, 0x87, 0x44, 0x6f, 0x8b, 0x76, 0xe7, 0xd2, 0x23, 0xee, 0x3a, 0x1b, 0xee, 0xf2, 0x10, 0xd5,
-	0x21, 0x7d, 0x0f, 0x3f, 0x94, 0xd7, 0x78, 0x7b, 0x0f, 0xbf, 0x9a, 0xea, 0x90, 0xf2, 0x12, 0xe2,
-	0x06, 0xd1, 0xba, 0x34, 0xe2, 0x96, 0x27, 0x83, 0x2d, 0x37, 0x88, 0x56, 0x05, 0x5c, 0xf6, 0x55,
-	0x40, 0xcc, 0x63, 0xff, 0xd6, 0x3b, 0x2c, 0xee, 0x37, 0xef, 0x30, 0x45, 0xf0, 0x0e, 0x19, 0xda,
-	0x62, 0xf7, 0xd2, 0xe1, 0x30, 0xe4, 0x3c, 0xaf, 0xef, 0x57, 0xe7, 0x65, 0xdf, 0x05, 0xc4, 0x1c,
-	0xff, 0x1b, 0x31, 0x03, 0x63, 0x47, 0x43, 0x86, 0x7f, 0x0e, 0x32, 0x10, 0x05, 0x58, 0xd5, 0xee,
-	0x0a, 0xb4, 0x69, 0x34, 0x15, 0xb3, 0x89, 0x7a, 0xc8, 0x15, 0x46, 0xbe, 0xe1, 0xfc, 0xe1, 0x8a,
-	0x71, 0xef, 0x8a, 0xd9, 0x2b, 0x88, 0xfc, 0x67, 0xed, 0x79, 0x5d, 0xf4, 0xbd, 0xee, 0xf7, 0xe2,
-	0x63, 0xed, 0x68, 0xbf, 0x17, 0x3e, 0xf6, 0xb9, 0xa6, 0xb6, 0xc4, 0xa2, 0x26, 0x8a, 0xe3, 0xf9,
-	0x07, 0x18, 0x2d, 0x2c, 0xc9, 0x77, 0x90, 0xbc, 0x46, 0xf2, 0xd1, 0xb3, 0xdb, 0xfc, 0xd5, 0xed,
-	0xfc, 0xd9, 0xc5, 0x1d, 0x06, 0xec, 0xed, 0x55, 0xf6, 0x5f, 0x91, 0xf0, 0xff, 0xc8, 0xd5, 0xcf,
-	0x00, 0x00, 0x00, 0xff, 0xff, 0x56, 0x3d, 0x15, 0xd6, 0x5c, 0x04, 0x00, 0x00,
+	// 1727 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x58, 0xdd, 0x8e, 0x2b, 0x47,
+	0x11, 0x66, 0xbc, 0xb6, 0x77, 0x5d, 0xfe, 0xd9, 0xdd, 0xde, 0xcd, 0x91, 0x39, 0x3f, 0x9c, 0x65,
+	0xf2, 0x77, 0x40, 0xb0, 0x89, 0x36, 0x4a, 0x48, 0x14, 0x09, 0xe1, 0x73, 0x10, 0xb0, 0x62, 0x13,
+	0x96, 0x76, 0xb8, 0x41, 0x8a, 0x46, 0xed, 0x99, 0xf6, 0xba, 0xb5, 0xe3, 0x99, 0xa1, 0xbb, 0x67,
+	0x83, 0xb9, 0xe3, 0x29, 0x78, 0x08, 0x14, 0x6e, 0x10, 0xcf, 0xc0, 0x05, 0xe2, 0x9a, 0xd7, 0x40,
+	0xe2, 0x05, 0x50, 0x57, 0xf7, 0xfc, 0xf9, 0xd8, 0xce, 0x39, 0xd1, 0x5e, 0x58, 0x9a, 0xfe, 0xfa,
+	0xab, 0xea, 0xaa, 0xea, 0xea, 0xaa, 0x6e, 0xc3, 0x71, 0x76, 0x7b, 0xf3, 0x1e, 0x93, 0xda, 0xfc,
+	0xce, 0x33, 0x99, 0xea, 0x94, 0x9c, 0x24, 0x5c, 0x9f, 0xb3, 0x3c, 0x12, 0xa9, 0xd2, 0x52, 0xdc,
+	0xf2, 0x73, 0x26, 0xb5, 0x7f, 0x03, 0x30, 0x91, 0x9a, 0xf2, 0x3f, 0xe4, 0x5c, 0x69, 0xf2, 0x08,
+	0x7a, 0x4c, 0x6a, 0xa1, 0x74, 0x20, 0xa2, 0xb1, 0x77, 0xe6, 0x3d, 0xeb, 0xd1, 0x03, 0x0b, 0x5c,
+	0x46, 0xe4, 0x1d, 0x38, 0x74, 0x93, 0x5a, 0xb2, 0xf0, 0xd6, 0x50, 0x5a, 0x48, 0x19, 0x5a, 0xf8,
+	0x0b, 0x83, 0x5e, 0x46, 0xe4, 0x14, 0x3a, 0x4a, 0x24, 0x21, 0x1f, 0xef, 0x9d, 0x79, 0xcf, 0xda,
+	0xd4, 0x0e, 0xfc, 0x7f, 0x7b, 0xd0, 0x9d, 0x20, 0x6f, 0xf7, 0x2a, 0x04, 0xda, 0x09, 0x5b, 0x72,
+	0xa7, 0x1a, 0xbf, 0xc9, 0x03, 0xe8, 0x66, 0xf9, 0xec, 0x96, 0xaf, 0x50, 0x65, 0x8f, 0xba, 0x11,
+	0x79, 0x02, 0x90, 0x67, 0x11, 0xd3, 0x3c, 0x0a, 0x98, 0x1e, 0xb7, 0x71, 0xb9, 0x9e, 0x43, 0x26,
+	0x9a, 0xbc, 0x0b, 0x87, 0x99, 0xe4, 0x77, 0x22, 0xcd, 0x55, 0xe0, 0xe4, 0x3b, 0x28, 0x3f, 0x2a,
+	0xe0, 0x6b, 0xab, 0xe7, 0x02, 0xde, 0xb0, 0xf3, 0x41, 0x2c, 0x92, 0xdb, 0x40, 0x89, 0x9b, 0x84,
+	0xe9, 0x5c, 0xf2, 0x71, 0x17, 0xe9, 0x27, 0x76, 0xf2, 0x4a, 0x24, 0xb7, 0xd3, 0x62, 0xca, 0xff,
+	0x97, 0x07, 0xc7, 0xd6, 0x9f, 0xeb, 0x7c, 0x16, 0x8b, 0x90, 0x69, 0x91, 0x26, 0xe4, 0x03, 0xe8,
+	0x5a, 0x4f, 0xd0, 0xaf, 0xfe, 0xc5, 0xa3, 0xf3, 0x0d, 0x41, 0x3f, 0xb7, 0x72, 0xd4, 0x51, 0xc9,
+	0x63, 0xe8, 0x55, 0x4b, 0x5a, 0xbf, 0x2b, 0x80, 0x7c, 0x0c, 0x63, 0xc5, 0xa5, 0x60, 0xb1, 0xf8,
+	0x93, 0xf1, 0x53, 0xea, 0x40, 0x72, 0x95, 0xe6, 0x32, 0xe4, 0x0a, 0xc3, 0x31, 0xa0, 0x0f, 0xaa,
+	0x79, 0xdc, 0x4b, 0x37, 0x4b, 0x7e, 0x00, 0x47, 0xa5, 0x9a, 0x40, 0x85, 0x0b, 0xbe, 0xe4, 0x18,
+	0xa4, 0x1e, 0x3d, 0x2c, 0xf1, 0x29, 0xc2, 0xfe, 0x7f, 0xf7, 0x60, 0xd0, 0x90, 0xfd, 0x10, 0xf6,
+	0xad, 0x75, 0x6a, 0xec, 0x9d, 0xed, 0x7d, 0x93, 0x27, 0x05, 0x97, 0x5c, 0x40, 0x97, 0xc5, 0xb3,
+	0x7c, 0xa9, 0xc6, 0x2d, 0x94, 0x7a, 0xb8, 0x59, 0xca, 0x50, 0xa8, 0x63, 0x1a, 0x19, 0x4c, 0x28,
+	0xe3, 0xce, 0x76, 0x19, 0xcc, 0x2e, 0xea, 0x98, 0xe4, 0x3d, 0xe8, 0x64, 0x9c, 0x4b, 0x35, 0x6e,
+	0xa3, 0xc8, 0x77, 0x37, 0x8a, 0x5c, 0x73, 0x2e, 0xa9, 0xe5, 0x91, 0x13, 0xe8, 0x30, 0x15, 0xa4,
+	0x73, 0xcc, 0x80, 0x36, 0x6d, 0x33, 0xf5, 0x9b, 0x79, 0x95, 0xa9, 0xdd, 0x5a, 0xa6, 0x9a, 0x3c,
+	0x57, 0x61, 0x9a, 0xf1, 0xa0, 0x4a, 0xd2, 0x7d, 0x9b, 0xe7, 0x08, 0x4f, 0x8a, 0x4c, 0x7d, 0x0b,
+	0x46, 0x8e, 0x67, 0xfc, 0x30, 0xb4, 0x03, 0xa4, 0x0d, 0x2c, 0xcd, 0x80, 0x97, 0x11, 0xf9, 0x14,
+	0x7a, 0x59, 0xcc, 0x56, 0x31, 0x86, 0xb2, 0x87, 0xd6, 0x3e, 0xd9, 0x6c, 0xad, 0x63, 0xd1, 0x8a,
+	0x4f, 0x1e, 0xc2, 0x81, 0x32, 0x47, 0xd3, 0xd8, 0x08, 0x68, 0x63, 0x39, 0x26, 0x3f, 0x05, 0xd0,
+	0xe9, 0x72, 0xa6, 0x74, 0x9a, 0x70, 0x35, 0xee, 0xa3, 0xe6, 0xef, 0x6d, 0x0e, 0x5d, 0x41, 0xa3,
+	0x35, 0x09, 0xff, 0x2f, 0x1e, 0xf4, 0xca, 0x99, 0xfb, 0x39, 0xf9, 0x15, 0xaf, 0x0c, 0xc9, 0x5e,
+	0x9d, 0x57, 0xc4, 0xe4, 0x09, 0x40, 0xc4, 0x63, 0xde, 0x3c, 0xb7, 0x0e, 0x99, 0x68, 0xff, 0x0a,
+	0xa0, 0x34, 0x4c, 0xad, 0xf9, 0xe9, 0xbd, 0xb6, 0x9f, 0xff, 0x69, 0x41, 0x07, 0x17, 0x7e, 0x55,
+	0x1f, 0x4b, 0xdb, 0x5b, 0x9b, 0x6c, 0x3f, 0x85, 0x8e, 0x16, 0x3a, 0xe6, 0xce, 0x33, 0x3b, 0xd8,
+	0x14, 0x21, 0x93, 0x99, 0x2f, 0x45, 0xe8, 0x7d, 0xe8, 0x64, 0x52, 0x84, 0x1c, 0xd3, 0x70, 0x5b,
+	0xaa, 0x5f, 0x1b, 0x06, 0xb5, 0xc4, 0xb5, 0x1a, 0xd7, 0x5d, 0xaf, 0x71, 0x6f, 0xc1, 0x28, 0x4c,
+	0xef, 0xb8, 0xc4, 0xc2, 0xb0, 0x14, 0x4b, 0xee, 0x72, 0x75, 0x80, 0xe8, 0x44, 0xea, 0xcf, 0xc4,
+	0x92, 0x93, 0x67, 0x70, 0x54, 0xb1, 0xd4, 0x82, 0x5d, 0x7c, 0xf8, 0x11, 0x26, 0xeb, 0x80, 0x8e,
+	0x0a, 0xde, 0x14, 0x51, 0x53, 0x6a, 0x6f, 0x78, 0x22, 0xb9, 0xcd, 0xd5, 0x1e, 0x75, 0x23, 0x53,
+	0x96, 0x57, 0x9c, 0x49, 0xcc, 0xc2, 0x21, 0xc5, 0x6f, 0xff, 0xeb, 0x2e, 0x74, 0xd0, 0xb1, 0xfb,
+	0x89, 0xec, 0x86, 0x18, 0xee, 0x6d, 0xca, 0xb2, 0x1f, 0x01, 0xb1, 0x8a, 0x2c, 0x2d, 0xc9, 0x97,
+	0x33, 0x2e, 0x31, 0x8b, 0x86, 0xf4, 0x08, 0x67, 0x90, 0xf9, 0x39, 0xe2, 0xd5, 0x7e, 0x75, 0xea,
+	0xfb, 0xf5, 0x18, 0x7a, 0x61, 0x9a, 0x68, 0x26, 0x12, 0x2e, 0x5d, 0x95, 0xaf, 0x80, 0x6a, 0x97,
+	0xf6, 0x5f, 0x75, 0x97, 0xde, 0x87, 0x53, 0x3e, 0x9f, 0xf3, 0x50, 0x8b, 0x3b, 0x1e, 0x20, 0x14,
+	0x28, 0xa6, 0x15, 0x06, 0xb9, 0x4d, 0x49, 0x39, 0x87, 0x42, 0x53, 0xa6, 0xd5, 0xda, 0xbe, 0xf6,
+	0xd6, 0xf7, 0xf5, 0x6d, 0x18, 0x65, 0x6c, 0x15, 0xa7, 0x2c, 0x2a, 0xf6, 0x0b, 0x70, 0xbf, 0x86,
+	0x0e, 0x75, 0xdb, 0x75, 0x0a, 0x9d, 0x30, 0x8d, 0x78, 0x38, 0xee, 0x5b, 0xef, 0x70, 0x40, 0x3e,
+	0x81, 0x83, 0x38, 0xcd, 0xa3, 0x84, 0x2b, 0x35, 0x1e, 0x9c, 0x79, 0x5b, 0x4b, 0xce, 0x95, 0x23,
+	0xd1, 0x92, 0x4e, 0x7e, 0x0c, 0x24, 0x95, 0xe2, 0x46, 0x24, 0x2c, 0x0e, 0xaa, 0x08, 0x0d, 0x51,
+	0xfb, 0x71, 0x31, 0xf3, 0xa2, 0x8c, 0xd4, 0xdb, 0x30, 0xaa, 0xd1, 0x8d, 0x21, 0x23, 0xbb, 0x65,
+	0x15, 0xd5, 0x18, 0xf4, 0x2e, 0x1c, 0x96, 0x34, 0xe7, 0xce, 0xa1, 0x4d, 0xbf, 0x02, 0x76, 0xfe,
+	0x3c, 0x85, 0x7e, 0xe1, 0x76, 0x28, 0xa2, 0xf1, 0x11, 0x2a, 0x03, 0x07, 0xbd, 0x10, 0x58, 0x3a,
+	0x42, 0xc9, 0x8b, 0xb0, 0x1d, 0xdb, 0xb0, 0x39, 0xa4, 0xd6, 0xf2, 0xf9, 0x57, 0x81, 0xe2, 0x61,
+	0x9a, 0x44, 0x6a, 0x4c, 0x30, 0x31, 0x46, 0x0e, 0x9e, 0x5a, 0x14, 0xe3, 0x5b, 0x10, 0xad, 0x41,
+	0x27, 0x2e, 0xbe, 0x8e, 0x57, 0xda, 0x13, 0xe5, 0x12, 0x7b, 0x7b, 0xb0, 0x54, 0xe3, 0x53, 0xd4,
+	0x05, 0x05, 0xf4, 0x99, 0xaa, 0x9d, 0x97, 0x37, 0x36, 0x9e, 0x97, 0x07, 0xb5, 0xf3, 0xf2, 0x4f,
+	0x0f, 0x0e, 0x8a, 0x2a, 0xbf, 0xfb, 0xc8, 0x98, 0x14, 0xb7, 0x93, 0x45, 0x2f, 0xa8, 0x4e, 0xcd,
+	0x91, 0x9d, 0x29, 0x14, 0x6d, 0x2d, 0x49, 0x9f, 0x96, 0x6d, 0xd5, 0xf6, 0xc8, 0x37, 0x77, 0xb4,
+	0x55, 0x3e, 0xe7, 0xd2, 0x34, 0x95, 0xb2, 0xbf, 0x36, 0xb3, 0xb3, 0xb3, 0x96, 0x9d, 0xfe, 0xef,
+	0x60, 0xd4, 0x14, 0xbc, 0x97, 0xfe, 0xe1, 0x3f, 0x82, 0x0e, 0x1e, 0x10, 0x13, 0x3d, 0x3c, 0x3e,
+	0x9e, 0x6d, 0xd6, 0xe6, 0xdb, 0xff, 0x02, 0x0e, 0x8a, 0x7c, 0x35, 0xdb, 0x2c, 0x12, 0xcd, 0x6f,
+	0x24, 0x5a, 0x18, 0xe7, 0x73, 0x4b, 0xf5, 0xe8, 0xa8, 0x82, 0xaf, 0xf2, 0xb9, 0x32, 0xfb, 0xa7,
+	0xd8, 0x32, 0x8b, 0x79, 0x90, 0x71, 0x76, 0x8b, 0xab, 0x7a, 0x14, 0x2c, 0x74, 0xcd, 0xd9, 0xad,
+	0xff, 0x37, 0x0f, 0xf6, 0x2f, 0x93, 0xbb, 0x54, 0xdc, 0x93, 0x0f, 0x98, 0x81, 0x6c, 0xb5, 0xe4,
+	0x89, 0xb9, 0xa7, 0xe1, 0xad, 0xda, 0x6d, 0xcb, 0xc8, 0xc1, 0xc5, 0x5d, 0xfb, 0xfb, 0x30, 0x10,
+	0x76, 0xe1, 0x60, 0xc1, 0xd4, 0x02, 0x0b, 0xd8, 0x80, 0xf6, 0x1d, 0xf6, 0x2b, 0xa6, 0x16, 0x65,
+	0x18, 0x3a, 0xb5, 0x30, 0xfc, 0xdd, 0x83, 0x81, 0xad, 0x98, 0xaf, 0x67, 0xf5, 0xee, 0xda, 0xfb,
+	0x11, 0xec, 0xbb, 0x85, 0xd1, 0xda, 0xfe, 0xc5, 0xe3, 0x8d, 0xd9, 0xe2, 0xd6, 0xa4, 0x05, 0xf9,
+	0x55, 0xfb, 0x9e, 0xff, 0x0f, 0x0f, 0x86, 0x53, 0x2d, 0x39, 0xab, 0x9b, 0xad, 0x10, 0xa8, 0x99,
+	0x6d, 0x81, 0xa6, 0x39, 0xad, 0xd7, 0x31, 0xe7, 0x01, 0x74, 0xd3, 0xf9, 0x5c, 0x71, 0xed, 0xde,
+	0x1e, 0x6e, 0x64, 0xf0, 0x98, 0x27, 0x37, 0x7a, 0xe1, 0x2e, 0x1b, 0x6e, 0x64, 0xd2, 0x43, 0xa7,
+	0x9a, 0xc5, 0xc1, 0x6c, 0xa5, 0x79, 0x11, 0x67, 0x40, 0xe8, 0xb9, 0x41, 0x7c, 0x0e, 0x6d, 0x73,
+	0x8b, 0xac, 0xbd, 0x40, 0xbc, 0xc6, 0x0b, 0x84, 0x40, 0x7b, 0x91, 0x2a, 0x5d, 0xbc, 0x56, 0xcc,
+	0xb7, 0xc1, 0xb2, 0x54, 0x5a, 0x13, 0x86, 0x14, 0xbf, 0xbf, 0xe1, 0xa5, 0xe2, 0x7f, 0x02, 0x30,
+	0x5d, 0x25, 0xe1, 0x8b, 0x5c, 0xaa, 0x74, 0xfb, 0x62, 0xe5, 0x1d, 0xb6, 0x55, 0xdd, 0x61, 0xfd,
+	0xdf, 0x42, 0xbf, 0x12, 0x55, 0xe4, 0x39, 0x0c, 0xd4, 0x2a, 0x09, 0x83, 0xd0, 0x8e, 0xdd, 0x7d,
+	0xe9, 0xe9, 0xc6, 0xf0, 0x55, 0x72, 0xb4, 0xaf, 0x2a, 0x1d, 0xfe, 0x25, 0x9c, 0xd4, 0xde, 0x34,
+	0xd3, 0xe2, 0xc2, 0xb9, 0xcd, 0xac, 0xfa, 0x25, 0xb5, 0xd5, 0xbc, 0xa4, 0xfa, 0x39, 0x9c, 0x6e,
+	0x50, 0xa5, 0xc8, 0x97, 0xf8, 0xe2, 0x2a, 0xf0, 0xa0, 0xe0, 0x17, 0xf6, 0x3e, 0xdb, 0xdc, 0x71,
+	0x5f, 0xd6, 0x44, 0x4f, 0xb3, 0x0d, 0xea, 0xfd, 0xff, 0x79, 0x30, 0xc2, 0xdb, 0x3f, 0xcf, 0x72,
+	0x8d, 0x73, 0x5b, 0xad, 0x7f, 0x13, 0x86, 0x73, 0x26, 0x62, 0xf3, 0x44, 0x0a, 0xd3, 0x3c, 0xb1,
+	0x5b, 0x39, 0xa4, 0x03, 0x07, 0xbe, 0x30, 0x98, 0x49, 0xf3, 0x98, 0x29, 0x1d, 0x14, 0x4c, 0x56,
+	0x24, 0xd8, 0xd0, 0xc0, 0xbf, 0xb0, 0xe8, 0x44, 0x93, 0x73, 0x38, 0x69, 0xf0, 0x24, 0x67, 0x2a,
+	0x4d, 0xdc, 0xa3, 0xeb, 0xb8, 0xc6, 0xa5, 0x38, 0x41, 0xce, 0x60, 0x80, 0x7c, 0xc5, 0x79, 0x52,
+	0x15, 0x5a, 0x30, 0xd8, 0x94, 0xf3, 0x64, 0xa2, 0xc9, 0x0f, 0x01, 0xc5, 0x8c, 0xa6, 0x70, 0xc1,
+	0x66, 0x31, 0xaf, 0x6e, 0x81, 0x68, 0x12, 0x2d, 0xf0, 0x89, 0xf6, 0x19, 0x1c, 0x36, 0x9d, 0x56,
+	0xe4, 0x73, 0x38, 0x32, 0xef, 0x9f, 0x40, 0x56, 0xd8, 0xd8, 0xdb, 0xd1, 0x0e, 0x9a, 0xf2, 0xf4,
+	0x30, 0x6b, 0xea, 0xf3, 0xff, 0xec, 0xc1, 0xd0, 0x70, 0x9e, 0xb3, 0x24, 0xfa, 0x4a, 0x44, 0x7a,
+	0xb1, 0x35, 0xae, 0x6b, 0x47, 0xab, 0xb5, 0x7e, 0xb4, 0xc8, 0x4f, 0xa0, 0x1d, 0xb1, 0x55, 0xf1,
+	0xe8, 0xdb, 0x6c, 0xce, 0xcf, 0x99, 0x88, 0x57, 0xe5, 0x5a, 0x14, 0x05, 0xfc, 0x8f, 0x61, 0xd4,
+	0xc4, 0xc9, 0x11, 0xec, 0x45, 0x6c, 0xe5, 0xba, 0x85, 0xf9, 0x34, 0x2d, 0xb1, 0xbe, 0xae, 0x1d,
+	0xf8, 0x5f, 0xda, 0xac, 0x28, 0x05, 0x15, 0xf9, 0x35, 0xa0, 0x8b, 0xc1, 0xac, 0x84, 0x5c, 0x78,
+	0xfc, 0xad, 0xe1, 0xa9, 0xcc, 0x19, 0x65, 0x0d, 0x65, 0xfe, 0x5f, 0x3d, 0x00, 0x2c, 0x78, 0x53,
+	0xcd, 0xb4, 0xba, 0xb7, 0x3f, 0x53, 0xb2, 0xd8, 0x86, 0x09, 0x1d, 0xc1, 0x81, 0xb9, 0xbe, 0x66,
+	0xb9, 0x0c, 0x17, 0x4c, 0x71, 0x55, 0x54, 0x93, 0x12, 0x30, 0x6f, 0x02, 0xcc, 0x19, 0xc3, 0xad,
+	0x37, 0x70, 0xcc, 0xb5, 0x6b, 0x04, 0x27, 0xda, 0xa7, 0x30, 0xaa, 0x8c, 0xbd, 0x12, 0x4a, 0x93,
+	0x9f, 0x41, 0xdf, 0x1a, 0xa3, 0x34, 0xd3, 0xbb, 0x4b, 0x47, 0x25, 0x49, 0x41, 0x97, 0xdf, 0xfe,
+	0xd7, 0x1e, 0x0c, 0x2f, 0x95, 0xca, 0x79, 0x54, 0x94, 0xf9, 0xf5, 0x2e, 0xe7, 0xbd, 0xdc, 0xe5,
+	0xaa, 0x8b, 0x4a, 0xeb, 0x5b, 0x5d, 0x54, 0xf8, 0x1f, 0x33, 0x21, 0xb9, 0xaa, 0x0e, 0x65, 0xcf,
+	0x21, 0x13, 0xac, 0xbb, 0x8a, 0x6b, 0x1d, 0x37, 0xea, 0xae, 0x43, 0x26, 0xda, 0x24, 0x44, 0xc3,
+	0x5c, 0x4c, 0x08, 0x81, 0x48, 0xe0, 0x4c, 0xdc, 0x9d, 0x10, 0x0d, 0x69, 0x3a, 0x12, 0x0d, 0x65,
+	0x17, 0xbf, 0x87, 0xbd, 0x89, 0xd4, 0x64, 0x0a, 0xdd, 0x5f, 0x72, 0x6d, 0xbe, 0x9e, 0x6e, 0xfb,
+	0x13, 0xc5, 0x5d, 0x0a, 0x1e, 0xbe, 0xb3, 0xe3, 0x5f, 0x96, 0x5a, 0xf9, 0xf3, 0xbf, 0x33, 0xeb,
+	0xe2, 0x9f, 0x7a, 0x1f, 0xfc, 0x7f, 0x00, 0x9a, 0xf4, 0xee, 0x07, 0xe9, 0x13, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.